@@ -0,0 +1,132 @@
+// Package bsdiff creates and applies binary patches in the BSDIFF40 format
+// of Colin Percival's bsdiff.
+package bsdiff
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const magic = "BSDIFF40"
+
+const headerSize = 32
+
+// ErrCorrupt is returned for malformed patches.
+var ErrCorrupt = errors.New("corrupt patch")
+
+// Patch applies patch to old and returns the new contents. maxSize bounds the
+// size of the result, guarding against patches announcing huge outputs; a
+// maxSize <= 0 disables the check.
+func Patch(old, patch []byte, maxSize int64) ([]byte, error) {
+	var out bytes.Buffer
+	err := Apply(&out, bytes.NewReader(old), int64(len(old)),
+		io.NewSectionReader(bytes.NewReader(patch), 0, int64(len(patch))), maxSize)
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// chunkSize is the size of the buffers Apply works with.
+const chunkSize = 64 << 10
+
+// Apply applies patch to old, of oldSize bytes, writing the new contents to
+// w as they are produced, so neither needs to fit in memory. maxSize bounds
+// the size of the result as with Patch.
+func Apply(w io.Writer, old io.ReaderAt, oldSize int64, patch *io.SectionReader, maxSize int64) error {
+	var header [headerSize]byte
+	if _, err := patch.ReadAt(header[:], 0); err != nil || string(header[:8]) != magic {
+		return fmt.Errorf("%w: bad header", ErrCorrupt)
+	}
+
+	ctrlLen := offtin(header[8:16])
+	diffLen := offtin(header[16:24])
+	newSize := offtin(header[24:32])
+	bodyLen := patch.Size() - headerSize
+	if ctrlLen < 0 || diffLen < 0 || newSize < 0 ||
+		ctrlLen > bodyLen || diffLen > bodyLen-ctrlLen {
+		return fmt.Errorf("%w: bad header", ErrCorrupt)
+	}
+	if maxSize > 0 && newSize > maxSize {
+		return fmt.Errorf("%w: output of %d bytes exceeds %d bytes", ErrCorrupt, newSize, maxSize)
+	}
+
+	ctrl := bzip2.NewReader(io.NewSectionReader(patch, headerSize, ctrlLen))
+	diff := bzip2.NewReader(io.NewSectionReader(patch, headerSize+ctrlLen, diffLen))
+	extra := bzip2.NewReader(io.NewSectionReader(patch, headerSize+ctrlLen+diffLen, bodyLen-ctrlLen-diffLen))
+
+	var buf [24]byte
+	chunk := make([]byte, chunkSize)
+	oldChunk := make([]byte, chunkSize)
+	var oldPos, newPos int64
+
+	for newPos < newSize {
+		if _, err := io.ReadFull(ctrl, buf[:]); err != nil {
+			return fmt.Errorf("%w: control block: %v", ErrCorrupt, err)
+		}
+		add := offtin(buf[0:8])
+		copyLen := offtin(buf[8:16])
+		seek := offtin(buf[16:24])
+
+		if add < 0 || copyLen < 0 || add > newSize-newPos {
+			return fmt.Errorf("%w: bad control entry", ErrCorrupt)
+		}
+		for add > 0 {
+			n := min(add, chunkSize)
+			if _, err := io.ReadFull(diff, chunk[:n]); err != nil {
+				return fmt.Errorf("%w: diff block: %v", ErrCorrupt, err)
+			}
+			// bytes outside old are added to zeros
+			if from, to := max(oldPos, 0), min(oldPos+n, oldSize); from < to {
+				if _, err := old.ReadAt(oldChunk[:to-from], from); err != nil {
+					return err
+				}
+				for i, c := range oldChunk[:to-from] {
+					chunk[from-oldPos+int64(i)] += c
+				}
+			}
+			if _, err := w.Write(chunk[:n]); err != nil {
+				return err
+			}
+			add -= n
+			newPos += n
+			oldPos += n
+		}
+
+		if copyLen > newSize-newPos {
+			return fmt.Errorf("%w: bad control entry", ErrCorrupt)
+		}
+		for copyLen > 0 {
+			n := min(copyLen, chunkSize)
+			if _, err := io.ReadFull(extra, chunk[:n]); err != nil {
+				return fmt.Errorf("%w: extra block: %v", ErrCorrupt, err)
+			}
+			if _, err := w.Write(chunk[:n]); err != nil {
+				return err
+			}
+			copyLen -= n
+			newPos += n
+		}
+		oldPos += seek
+	}
+	return nil
+}
+
+// offtin decodes bsdiff's sign-magnitude little-endian 64-bit integers.
+func offtin(b []byte) int64 {
+	var y int64
+	for i := 7; i >= 0; i-- {
+		v := b[i]
+		if i == 7 {
+			v &= 0x7f
+		}
+		y = y<<8 | int64(v)
+	}
+	if b[7]&0x80 != 0 {
+		y = -y
+	}
+	return y
+}
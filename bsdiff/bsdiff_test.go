@@ -0,0 +1,111 @@
+package bsdiff_test
+
+import (
+	"bytes"
+	"errors"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/napalu/gosafedate/bsdiff"
+)
+
+// BSDIFF40 patch from "old-binary-v1" to "new-binary-v2!"
+var testPatch = []byte{
+	0x42, 0x53, 0x44, 0x49, 0x46, 0x46, 0x34, 0x30, 0x29, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x2d, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0e, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0x9f, 0xca, 0x1c, 0xcc, 0x00, 0x00,
+	0x05, 0xc0, 0x00, 0x68, 0x0a, 0x20, 0x00, 0x30, 0xcd, 0x00, 0x90, 0x1a, 0x41, 0x56, 0x6e, 0x2e,
+	0xe4, 0x8a, 0x70, 0xa1, 0x21, 0x3f, 0x94, 0x39, 0x98, 0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59,
+	0x26, 0x53, 0x59, 0x3a, 0x99, 0xc0, 0x5b, 0x00, 0x00, 0x04, 0x60, 0x00, 0xe2, 0x00, 0x08, 0x00,
+	0x00, 0x20, 0xa0, 0x00, 0x21, 0x80, 0x0c, 0x02, 0x23, 0x15, 0xdb, 0x8b, 0xb9, 0x22, 0x9c, 0x28,
+	0x48, 0x1d, 0x4c, 0xe0, 0x2d, 0x80, 0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59,
+	0x2d, 0x15, 0xeb, 0x1c, 0x00, 0x00, 0x00, 0x10, 0x00, 0x20, 0x00, 0x20, 0x00, 0x21, 0x18, 0x46,
+	0x82, 0xee, 0x48, 0xa7, 0x0a, 0x12, 0x05, 0xa2, 0xbd, 0x63, 0x80,
+}
+
+func TestPatch(t *testing.T) {
+	got, err := bsdiff.Patch([]byte("old-binary-v1"), testPatch, 0)
+	if err != nil {
+		t.Fatalf("Patch returned error: %v", err)
+	}
+	if string(got) != "new-binary-v2!" {
+		t.Fatalf("unexpected result %q", got)
+	}
+}
+
+func TestPatchRejectsOversizedOutput(t *testing.T) {
+	_, err := bsdiff.Patch([]byte("old-binary-v1"), testPatch, 4)
+	if !errors.Is(err, bsdiff.ErrCorrupt) {
+		t.Fatalf("expected ErrCorrupt, got %v", err)
+	}
+}
+
+func TestPatchDoesNotTrustHeaderSize(t *testing.T) {
+	// announces a 1 TiB output, which is produced as the patch is read
+	patch := bytes.Clone(testPatch)
+	patch[24+5] = 0x01
+	_, err := bsdiff.Patch([]byte("old-binary-v1"), patch, 0)
+	if !errors.Is(err, bsdiff.ErrCorrupt) {
+		t.Fatalf("expected ErrCorrupt, got %v", err)
+	}
+}
+
+func TestPatchRejectsGarbage(t *testing.T) {
+	_, err := bsdiff.Patch([]byte("old-binary-v1"), []byte("not a patch"), 0)
+	if !errors.Is(err, bsdiff.ErrCorrupt) {
+		t.Fatalf("expected ErrCorrupt, got %v", err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	random := make([]byte, 300<<10)
+	for i := range random {
+		random[i] = byte(rng.IntN(256))
+	}
+	edited := bytes.Clone(random)
+	copy(edited[1000:], "patched section")
+	edited = append(edited[:50000], edited[60000:]...)
+	edited = append(edited, bytes.Repeat([]byte{0}, 1<<20)...)
+
+	tests := []struct {
+		name     string
+		old, new []byte
+	}{
+		{"empty", nil, nil},
+		{"from empty", nil, []byte("new-binary-v2!")},
+		{"to empty", []byte("old-binary-v1"), nil},
+		{"small", []byte("old-binary-v1"), []byte("new-binary-v2!")},
+		{"identical", random, random},
+		{"edited", random, edited},
+		{"runs", bytes.Repeat([]byte("ab"), 100000), bytes.Repeat([]byte("abc"), 100000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch := bsdiff.Diff(tt.old, tt.new)
+			got, err := bsdiff.Patch(tt.old, patch, 0)
+			if err != nil {
+				t.Fatalf("Patch returned error: %v", err)
+			}
+			if !bytes.Equal(got, tt.new) {
+				t.Fatalf("patched %d bytes, want %d", len(got), len(tt.new))
+			}
+		})
+	}
+}
+
+func TestDiffIsSmall(t *testing.T) {
+	old := make([]byte, 200<<10)
+	rng := rand.New(rand.NewPCG(3, 4))
+	for i := range old {
+		old[i] = byte(rng.IntN(256))
+	}
+	new := bytes.Clone(old)
+	for i := 0; i < len(new); i += 4096 {
+		new[i]++
+	}
+
+	if patch := bsdiff.Diff(old, new); len(patch) > len(new)/10 {
+		t.Fatalf("patch of %d bytes for %d changed bytes", len(patch), len(new)/4096)
+	}
+}
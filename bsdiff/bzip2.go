@@ -0,0 +1,378 @@
+package bsdiff
+
+import (
+	"container/heap"
+	"slices"
+)
+
+// bzip2 compression of the patch blocks, which compress/bzip2 can only
+// decompress. Blocks use a single Huffman table, written twice since the
+// format requires at least two: patches compress somewhat worse than with
+// bzip2 itself, but any bzip2 decoder reads them.
+
+const (
+	bzBlockMagic = 0x314159265359
+	bzEOSMagic   = 0x177245385090
+	// bzBlockSize is the maximum size of a block after the initial run
+	// length encoding, as used by bzip2 -9.
+	bzBlockSize = 900000 - 19
+	bzMaxCode   = 17 // maximum Huffman code length
+	bzGroupSize = 50 // symbols coded by each selector
+)
+
+// bzip2Compress returns data compressed in the bzip2 format.
+func bzip2Compress(data []byte) []byte {
+	w := &bitWriter{}
+	w.bytes([]byte("BZh9"))
+
+	var streamCRC uint32
+	for len(data) > 0 {
+		block, n := rle1(data)
+		crc := bzCRC(data[:n])
+		streamCRC = (streamCRC<<1 | streamCRC>>31) ^ crc
+		writeBlock(w, block, crc)
+		data = data[n:]
+	}
+
+	w.bits(bzEOSMagic>>24, 24)
+	w.bits(bzEOSMagic&0xffffff, 24)
+	w.bits(uint64(streamCRC), 32)
+	return w.flush()
+}
+
+// rle1 returns the initial run length encoding of a block of data, where
+// runs of 4 to 255 equal bytes are written as 4 bytes and a count, and the
+// number of bytes of data it encodes.
+func rle1(data []byte) ([]byte, int) {
+	var out []byte
+	i := 0
+	for i < len(data) && len(out) < bzBlockSize-5 {
+		c, run := data[i], 1
+		for run < 255 && i+run < len(data) && data[i+run] == c {
+			run++
+		}
+		if run < 4 {
+			out = append(out, data[i:i+run]...)
+		} else {
+			out = append(out, c, c, c, c, byte(run-4))
+		}
+		i += run
+	}
+	return out, i
+}
+
+func writeBlock(w *bitWriter, block []byte, crc uint32) {
+	// Burrows-Wheeler transform
+	rotations := sortRotations(block)
+	n := len(block)
+	last := make([]byte, n)
+	origPtr := 0
+	for i, r := range rotations {
+		if r == 0 {
+			origPtr = i
+		}
+		last[i] = block[(r+n-1)%n]
+	}
+
+	// move-to-front transform, with runs of zeros coded as RUNA and RUNB
+	var inUse [256]bool
+	for _, c := range block {
+		inUse[c] = true
+	}
+	var mtf []byte
+	for c := range inUse {
+		if inUse[c] {
+			mtf = append(mtf, byte(c))
+		}
+	}
+	eob := uint16(len(mtf) + 1)
+	var syms []uint16
+	zeros := 0
+	flushZeros := func() {
+		for zeros > 0 {
+			zeros--
+			syms = append(syms, uint16(zeros&1))
+			zeros >>= 1
+		}
+	}
+	for _, c := range last {
+		j := slices.Index(mtf, c)
+		if j == 0 {
+			zeros++
+			continue
+		}
+		flushZeros()
+		copy(mtf[1:j+1], mtf[:j])
+		mtf[0] = c
+		syms = append(syms, uint16(j+1))
+	}
+	flushZeros()
+	syms = append(syms, eob)
+
+	alphaSize := int(eob) + 1
+	freqs := make([]int, alphaSize)
+	for _, s := range syms {
+		freqs[s]++
+	}
+	lengths := codeLengths(freqs, bzMaxCode)
+	codes := canonicalCodes(lengths)
+
+	w.bits(bzBlockMagic>>24, 24)
+	w.bits(bzBlockMagic&0xffffff, 24)
+	w.bits(uint64(crc), 32)
+	w.bits(0, 1) // not randomized
+	w.bits(uint64(origPtr), 24)
+
+	var ranges uint64
+	for r := range 16 {
+		if slices.Contains(inUse[r*16:r*16+16], true) {
+			ranges |= 1 << (15 - r)
+		}
+	}
+	w.bits(ranges, 16)
+	for r := range 16 {
+		if ranges&(1<<(15-r)) == 0 {
+			continue
+		}
+		var used uint64
+		for c := range 16 {
+			if inUse[r*16+c] {
+				used |= 1 << (15 - c)
+			}
+		}
+		w.bits(used, 16)
+	}
+
+	const tables = 2
+	selectors := (len(syms) + bzGroupSize - 1) / bzGroupSize
+	w.bits(tables, 3)
+	w.bits(uint64(selectors), 15)
+	for range selectors {
+		w.bits(0, 1) // table 0, unary coded after the move-to-front transform
+	}
+	for range tables {
+		cur := lengths[0]
+		w.bits(uint64(cur), 5)
+		for _, l := range lengths {
+			for ; cur < l; cur++ {
+				w.bits(0b10, 2)
+			}
+			for ; cur > l; cur-- {
+				w.bits(0b11, 2)
+			}
+			w.bits(0, 1)
+		}
+	}
+
+	for _, s := range syms {
+		w.bits(uint64(codes[s]), uint(lengths[s]))
+	}
+}
+
+// sortRotations returns the start of the rotations of b in sorted order,
+// sorting them by prefix doubling.
+func sortRotations(b []byte) []int {
+	n := len(b)
+	rotations := make([]int, n)
+	rank := make([]int, n)
+	tmp := make([]int, n)
+	counts := make([]int, max(256, n))
+
+	for _, c := range b {
+		counts[c]++
+	}
+	for c := 1; c < 256; c++ {
+		counts[c] += counts[c-1]
+	}
+	for i := n - 1; i >= 0; i-- {
+		counts[b[i]]--
+		rotations[counts[b[i]]] = i
+	}
+	classes := 1
+	for j := 1; j < n; j++ {
+		if b[rotations[j]] != b[rotations[j-1]] {
+			classes++
+		}
+		rank[rotations[j]] = classes - 1
+	}
+
+	for k := 1; k < n && classes < n; k <<= 1 {
+		// sorted by their second half, then stably by their first
+		for j, r := range rotations {
+			tmp[j] = (r - k + n) % n
+		}
+		clear(counts[:classes])
+		for _, r := range tmp {
+			counts[rank[r]]++
+		}
+		for c := 1; c < classes; c++ {
+			counts[c] += counts[c-1]
+		}
+		for j := n - 1; j >= 0; j-- {
+			r := tmp[j]
+			counts[rank[r]]--
+			rotations[counts[rank[r]]] = r
+		}
+
+		next := tmp
+		next[rotations[0]] = 0
+		classes = 1
+		for j := 1; j < n; j++ {
+			cur, prev := rotations[j], rotations[j-1]
+			if rank[cur] != rank[prev] || rank[(cur+k)%n] != rank[(prev+k)%n] {
+				classes++
+			}
+			next[cur] = classes - 1
+		}
+		rank, tmp = next, rank
+	}
+	return rotations
+}
+
+// codeLengths returns the Huffman code lengths of symbols of the given
+// frequencies, at most maxLen bits long. Unused symbols are given a code
+// too, since the format codes every symbol of the alphabet.
+func codeLengths(freqs []int, maxLen int) []uint8 {
+	weights := make([]int, len(freqs))
+	for i, f := range freqs {
+		weights[i] = max(f, 1)
+	}
+	for {
+		lengths, longest := huffman(weights)
+		if longest <= maxLen {
+			return lengths
+		}
+		for i := range weights {
+			weights[i] = 1 + weights[i]/2
+		}
+	}
+}
+
+type huffmanNode struct {
+	weight      int
+	left, right int // children, -1 for leaves
+}
+
+type nodeHeap struct {
+	nodes []huffmanNode
+	order []int
+}
+
+func (h *nodeHeap) Len() int { return len(h.order) }
+func (h *nodeHeap) Less(i, j int) bool {
+	return h.nodes[h.order[i]].weight < h.nodes[h.order[j]].weight
+}
+func (h *nodeHeap) Swap(i, j int) { h.order[i], h.order[j] = h.order[j], h.order[i] }
+func (h *nodeHeap) Push(x any)    { h.order = append(h.order, x.(int)) }
+func (h *nodeHeap) Pop() any {
+	x := h.order[len(h.order)-1]
+	h.order = h.order[:len(h.order)-1]
+	return x
+}
+
+// huffman returns the Huffman code lengths of symbols of the given
+// weights, of which there are at least two, and the longest.
+func huffman(weights []int) ([]uint8, int) {
+	h := &nodeHeap{}
+	for i, w := range weights {
+		h.nodes = append(h.nodes, huffmanNode{weight: w, left: -1, right: -1})
+		h.order = append(h.order, i)
+	}
+	heap.Init(h)
+	for h.Len() > 1 {
+		a, b := heap.Pop(h).(int), heap.Pop(h).(int)
+		h.nodes = append(h.nodes, huffmanNode{weight: h.nodes[a].weight + h.nodes[b].weight, left: a, right: b})
+		heap.Push(h, len(h.nodes)-1)
+	}
+
+	lengths := make([]uint8, len(weights))
+	longest := 0
+	var walk func(node, depth int)
+	walk = func(node, depth int) {
+		if n := h.nodes[node]; n.left >= 0 {
+			walk(n.left, depth+1)
+			walk(n.right, depth+1)
+			return
+		}
+		lengths[node] = uint8(min(depth, 255))
+		longest = max(longest, depth)
+	}
+	walk(len(h.nodes)-1, 0)
+	return lengths, longest
+}
+
+// canonicalCodes assigns codes of the given lengths as bzip2 does: in order
+// of length, then of symbol.
+func canonicalCodes(lengths []uint8) []uint32 {
+	codes := make([]uint32, len(lengths))
+	var code uint32
+	for l := uint8(1); l <= bzMaxCode; l++ {
+		for s, sl := range lengths {
+			if sl == l {
+				codes[s] = code
+				code++
+			}
+		}
+		code <<= 1
+	}
+	return codes
+}
+
+// bzCRC is the CRC-32 of bzip2, which processes bits most significant
+// first unlike hash/crc32.
+func bzCRC(data []byte) uint32 {
+	crc := ^uint32(0)
+	for _, b := range data {
+		crc = crc<<8 ^ bzCRCTable[byte(crc>>24)^b]
+	}
+	return ^crc
+}
+
+var bzCRCTable = func() (t [256]uint32) {
+	for i := range t {
+		crc := uint32(i) << 24
+		for range 8 {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+		t[i] = crc
+	}
+	return t
+}()
+
+// bitWriter writes bits most significant first.
+type bitWriter struct {
+	out  []byte
+	acc  uint64
+	nacc uint
+}
+
+func (w *bitWriter) bits(v uint64, n uint) {
+	for n > 0 {
+		k := min(n, 32)
+		n -= k
+		w.acc = w.acc<<k | (v>>n)&(1<<k-1)
+		w.nacc += k
+		for w.nacc >= 8 {
+			w.nacc -= 8
+			w.out = append(w.out, byte(w.acc>>w.nacc))
+		}
+	}
+}
+
+func (w *bitWriter) bytes(b []byte) {
+	for _, c := range b {
+		w.bits(uint64(c), 8)
+	}
+}
+
+// flush returns the bits written, padding the last byte with zeros.
+func (w *bitWriter) flush() []byte {
+	if w.nacc > 0 {
+		w.bits(0, 8-w.nacc)
+	}
+	return w.out
+}
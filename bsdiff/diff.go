@@ -0,0 +1,273 @@
+package bsdiff
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Diff returns a BSDIFF40 patch turning old into new, as bsdiff 4.3 would
+// produce it: Patch(old, Diff(old, new), 0) returns new.
+func Diff(old, new []byte) []byte {
+	index := qsufsort(old)
+
+	var ctrl, diff, extra bytes.Buffer
+	var scan, pos, length, lastScan, lastPos, lastOffset int
+	for scan < len(new) {
+		oldScore := 0
+		scan += length
+		for scsc := scan; scan < len(new); scan++ {
+			pos, length = search(index, old, new[scan:], 0, len(old))
+			for ; scsc < scan+length; scsc++ {
+				if scsc+lastOffset < len(old) && old[scsc+lastOffset] == new[scsc] {
+					oldScore++
+				}
+			}
+			if (length == oldScore && length != 0) || length > oldScore+8 {
+				break
+			}
+			if scan+lastOffset < len(old) && old[scan+lastOffset] == new[scan] {
+				oldScore--
+			}
+		}
+		if length == oldScore && scan != len(new) {
+			continue
+		}
+
+		// extend the previous match forwards and this one backwards
+		var lenf, lenb int
+		for i, s, sf := 0, 0, 0; lastScan+i < scan && lastPos+i < len(old); {
+			if old[lastPos+i] == new[lastScan+i] {
+				s++
+			}
+			i++
+			if s*2-i > sf*2-lenf {
+				sf, lenf = s, i
+			}
+		}
+		if scan < len(new) {
+			for i, s, sb := 1, 0, 0; scan >= lastScan+i && pos >= i; i++ {
+				if old[pos-i] == new[scan-i] {
+					s++
+				}
+				if s*2-i > sb*2-lenb {
+					sb, lenb = s, i
+				}
+			}
+		}
+		if overlap := lastScan + lenf - (scan - lenb); overlap > 0 {
+			s, ss, lens := 0, 0, 0
+			for i := range overlap {
+				if new[lastScan+lenf-overlap+i] == old[lastPos+lenf-overlap+i] {
+					s++
+				}
+				if new[scan-lenb+i] == old[pos-lenb+i] {
+					s--
+				}
+				if s > ss {
+					ss, lens = s, i+1
+				}
+			}
+			lenf += lens - overlap
+			lenb -= lens
+		}
+
+		for i := range lenf {
+			diff.WriteByte(new[lastScan+i] - old[lastPos+i])
+		}
+		extra.Write(new[lastScan+lenf : scan-lenb])
+		ctrl.Write(offtout(int64(lenf)))
+		ctrl.Write(offtout(int64(scan - lenb - (lastScan + lenf))))
+		ctrl.Write(offtout(int64(pos - lenb - (lastPos + lenf))))
+
+		lastScan, lastPos, lastOffset = scan-lenb, pos-lenb, pos-scan
+	}
+
+	ctrlBlock := bzip2Compress(ctrl.Bytes())
+	diffBlock := bzip2Compress(diff.Bytes())
+	extraBlock := bzip2Compress(extra.Bytes())
+
+	patch := make([]byte, 0, headerSize+len(ctrlBlock)+len(diffBlock)+len(extraBlock))
+	patch = append(patch, magic...)
+	patch = append(patch, offtout(int64(len(ctrlBlock)))...)
+	patch = append(patch, offtout(int64(len(diffBlock)))...)
+	patch = append(patch, offtout(int64(len(new)))...)
+	patch = append(patch, ctrlBlock...)
+	patch = append(patch, diffBlock...)
+	return append(patch, extraBlock...)
+}
+
+// search returns the position and length of the longest match of new in
+// old among the suffixes index[st:en+1], sorted by qsufsort.
+func search(index []int, old, new []byte, st, en int) (int, int) {
+	for en-st >= 2 {
+		x := st + (en-st)/2
+		if bytes.Compare(old[index[x]:min(len(old), index[x]+len(new))], new[:min(len(new), len(old)-index[x])]) < 0 {
+			st = x
+		} else {
+			en = x
+		}
+	}
+	x, y := matchLen(old[index[st]:], new), matchLen(old[index[en]:], new)
+	if x > y {
+		return index[st], x
+	}
+	return index[en], y
+}
+
+func matchLen(a, b []byte) int {
+	n := min(len(a), len(b))
+	for i := range n {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
+
+// qsufsort returns the suffix array of b, including its empty suffix, using
+// the Larsson-Sadakane algorithm as bsdiff does.
+func qsufsort(b []byte) []int {
+	n := len(b)
+	index := make([]int, n+1)
+	group := make([]int, n+1)
+
+	var buckets [256]int
+	for _, c := range b {
+		buckets[c]++
+	}
+	for i := 1; i < 256; i++ {
+		buckets[i] += buckets[i-1]
+	}
+	for i := 255; i > 0; i-- {
+		buckets[i] = buckets[i-1]
+	}
+	buckets[0] = 0
+	for i, c := range b {
+		buckets[c]++
+		index[buckets[c]] = i
+	}
+	index[0] = n
+	for i, c := range b {
+		group[i] = buckets[c]
+	}
+	group[n] = 0
+	for i := 1; i < 256; i++ {
+		if buckets[i] == buckets[i-1]+1 {
+			index[buckets[i]] = -1
+		}
+	}
+	index[0] = -1
+
+	for h := 1; index[0] != -(n + 1); h += h {
+		length, i := 0, 0
+		for i < n+1 {
+			if index[i] < 0 {
+				length -= index[i]
+				i -= index[i]
+				continue
+			}
+			if length != 0 {
+				index[i-length] = -length
+			}
+			length = group[index[i]] + 1 - i
+			split(index, group, i, length, h)
+			i += length
+			length = 0
+		}
+		if length != 0 {
+			index[i-length] = -length
+		}
+	}
+
+	for i := range n + 1 {
+		index[group[i]] = i
+	}
+	return index
+}
+
+// split sorts index[start:start+length], whose suffixes share their first
+// h bytes, by their next h bytes, updating their groups.
+func split(index, group []int, start, length, h int) {
+	if length < 16 {
+		for k, j := start, 0; k < start+length; k += j {
+			j = 1
+			x := group[index[k]+h]
+			for i := 1; k+i < start+length; i++ {
+				if v := group[index[k+i]+h]; v < x {
+					x, j = v, 0
+				}
+				if group[index[k+i]+h] == x {
+					index[k+i], index[k+j] = index[k+j], index[k+i]
+					j++
+				}
+			}
+			for i := range j {
+				group[index[k+i]] = k + j - 1
+			}
+			if j == 1 {
+				index[k] = -1
+			}
+		}
+		return
+	}
+
+	x := group[index[start+length/2]+h]
+	var jj, kk int
+	for i := start; i < start+length; i++ {
+		if v := group[index[i]+h]; v < x {
+			jj++
+		} else if v == x {
+			kk++
+		}
+	}
+	jj += start
+	kk += jj
+
+	i, j, k := start, 0, 0
+	for i < jj {
+		switch v := group[index[i]+h]; {
+		case v < x:
+			i++
+		case v == x:
+			index[i], index[jj+j] = index[jj+j], index[i]
+			j++
+		default:
+			index[i], index[kk+k] = index[kk+k], index[i]
+			k++
+		}
+	}
+	for jj+j < kk {
+		if group[index[jj+j]+h] == x {
+			j++
+		} else {
+			index[jj+j], index[kk+k] = index[kk+k], index[jj+j]
+			k++
+		}
+	}
+
+	if jj > start {
+		split(index, group, start, jj-start, h)
+	}
+	for i := range kk - jj {
+		group[index[jj+i]] = kk - 1
+	}
+	if jj == kk-1 {
+		index[jj] = -1
+	}
+	if start+length > kk {
+		split(index, group, kk, start+length-kk, h)
+	}
+}
+
+// offtout encodes x as bsdiff's sign-magnitude little-endian 64-bit
+// integers; see offtin.
+func offtout(x int64) []byte {
+	b := make([]byte, 8)
+	if x < 0 {
+		binary.LittleEndian.PutUint64(b, uint64(-x))
+		b[7] |= 0x80
+	} else {
+		binary.LittleEndian.PutUint64(b, uint64(x))
+	}
+	return b
+}
@@ -0,0 +1,30 @@
+// Package blake3 registers the BLAKE3 checksum algorithm with package
+// checksum. It lives in its own package so the core stays free of
+// dependencies.
+//
+// Import it for its side effect:
+//
+//	import _ "github.com/napalu/gosafedate/checksum/blake3"
+//
+// Checksums prefixed with "blake3:" are then computed and verified, with
+// the SIMD and multi-threaded implementation of lukechampine.com/blake3.
+package blake3
+
+import (
+	"hash"
+
+	"github.com/napalu/gosafedate/checksum"
+	"lukechampine.com/blake3"
+)
+
+// Size is the size of a BLAKE3 checksum in bytes.
+const Size = 32
+
+func init() {
+	checksum.Register(checksum.BLAKE3, New)
+}
+
+// New returns a hash computing 256-bit BLAKE3 digests.
+func New() hash.Hash {
+	return blake3.New(Size, nil)
+}
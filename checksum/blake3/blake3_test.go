@@ -0,0 +1,39 @@
+package blake3_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/napalu/gosafedate/checksum"
+	_ "github.com/napalu/gosafedate/checksum/blake3"
+)
+
+// input returns the input of the official test vectors: bytes 0..250
+// repeated.
+func input(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i % 251)
+	}
+	return b
+}
+
+func TestRegistered(t *testing.T) {
+	for _, tc := range []struct {
+		in   []byte
+		want string
+	}{
+		{nil, "af1349b9f5f9a1a6a0404dea36dcc9499bcb25c9adc112b7cc9a93cae41f3262"},
+		{[]byte("abc"), "6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85"},
+		{input(1025), "d00278ae47eb27b34faecf67b4fe263f82d5412916c1ffd97c8cb7fb814b8444"},
+		{input(8192), "aae792484c8efe4f19e2ca7d371d8c467ffb10748d8a5a1ae579948f718a2a63"},
+	} {
+		got, err := checksum.Reader(bytes.NewReader(tc.in), checksum.BLAKE3)
+		if err != nil {
+			t.Fatalf("Reader: %v", err)
+		}
+		if want := "blake3:" + tc.want; got != want {
+			t.Errorf("checksum of %d bytes = %s, want %s", len(tc.in), got, want)
+		}
+	}
+}
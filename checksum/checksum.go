@@ -0,0 +1,130 @@
+// Package checksum computes the checksums of release metadata.
+//
+// A checksum is the hex digest of the file, qualified by its algorithm in a
+// multihash-style prefix unless it is SHA-256, the default:
+//
+//	9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08
+//	sha512:ee26b0dd4af7e749aa1a8ee3c10ae9923f618980772e473f8819a5d4940e0db2...
+//	blake3:4878ca0425c739fa427f7eda20fe845f6b2e46ba5fe2a14df5b1e32f50603215
+//
+// The prefix is part of the signed "version+checksum" message, so the
+// algorithm can't be changed without invalidating the signature.
+package checksum
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Supported algorithms.
+const (
+	SHA256  = "sha256"
+	SHA512  = "sha512"
+	BLAKE2b = "blake2b" // BLAKE2b-512
+	BLAKE3  = "blake3"  // 256-bit output; see Register
+)
+
+// readBufferSize is the size of the writes of Reader to a hash.
+const readBufferSize = 1 << 20
+
+// ErrUnsupported is returned for an unknown algorithm.
+var ErrUnsupported = errors.New("unsupported checksum algorithm")
+
+var (
+	algorithmsMu sync.RWMutex
+	algorithms   = map[string]func() hash.Hash{}
+)
+
+// Register makes a checksum algorithm available under name, lower case.
+// Registering an existing name replaces it.
+//
+// Algorithms which would pull dependencies into this package live in
+// subpackages registering themselves on import, e.g. BLAKE3:
+//
+//	import _ "github.com/napalu/gosafedate/checksum/blake3"
+func Register(name string, newHash func() hash.Hash) {
+	algorithmsMu.Lock()
+	defer algorithmsMu.Unlock()
+
+	algorithms[name] = newHash
+}
+
+// New returns a hash computing the checksum algorithm alg; empty is SHA-256.
+func New(alg string) (hash.Hash, error) {
+	alg = strings.ToLower(alg)
+	switch alg {
+	case "", SHA256:
+		return sha256.New(), nil
+	case SHA512:
+		return sha512.New(), nil
+	case BLAKE2b:
+		return blake2b.New512(nil)
+	}
+
+	algorithmsMu.RLock()
+	newHash, ok := algorithms[alg]
+	algorithmsMu.RUnlock()
+	switch {
+	case ok:
+		return newHash(), nil
+	case alg == BLAKE3:
+		return nil, fmt.Errorf("%w: %s: import github.com/napalu/gosafedate/checksum/blake3", ErrUnsupported, alg)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupported, alg)
+}
+
+// Format returns the checksum of digest computed with alg.
+func Format(alg string, digest []byte) string {
+	alg = strings.ToLower(alg)
+	if alg == "" || alg == SHA256 {
+		return fmt.Sprintf("%x", digest)
+	}
+	return fmt.Sprintf("%s:%x", alg, digest)
+}
+
+// Algorithm returns the algorithm of checksum.
+func Algorithm(checksum string) (string, error) {
+	alg, _, ok := strings.Cut(checksum, ":")
+	if !ok {
+		return SHA256, nil
+	}
+	alg = strings.ToLower(alg)
+	if _, err := New(alg); err != nil {
+		return "", err
+	}
+	return alg, nil
+}
+
+// Reader returns the checksum of r computed with alg.
+func Reader(r io.Reader, alg string) (string, error) {
+	h, err := New(alg)
+	if err != nil {
+		return "", err
+	}
+	// large writes let BLAKE3 hash chunks in parallel; hiding r's WriteTo
+	// keeps os.File from copying in its own small buffer
+	buf := make([]byte, readBufferSize)
+	if _, err = io.CopyBuffer(h, struct{ io.Reader }{r}, buf); err != nil {
+		return "", err
+	}
+	return Format(alg, h.Sum(nil)), nil
+}
+
+// File returns the checksum of the file at path computed with alg.
+func File(path, alg string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return Reader(f, alg)
+}
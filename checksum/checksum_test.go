@@ -0,0 +1,37 @@
+package checksum_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/napalu/gosafedate/checksum"
+	_ "github.com/napalu/gosafedate/checksum/blake3"
+)
+
+func TestReader(t *testing.T) {
+	for _, tc := range []struct {
+		alg  string
+		want string
+	}{
+		{checksum.SHA256, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{checksum.SHA512, "sha512:ddaf35a193617abacc417349ae20413112e6fa4e89a97ea20a9eeee64b55d39a2192992a274fc1a836ba3c23a3feebbd454d4423643ce80e2a9ac94fa54ca49f"},
+		{checksum.BLAKE2b, "blake2b:ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d17d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923"},
+		{checksum.BLAKE3, "blake3:6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85"},
+	} {
+		got, err := checksum.Reader(strings.NewReader("abc"), tc.alg)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.alg, err)
+		}
+		if got != tc.want {
+			t.Errorf("%s = %s, want %s", tc.alg, got, tc.want)
+		}
+		if alg, err := checksum.Algorithm(got); err != nil || alg != tc.alg {
+			t.Errorf("Algorithm(%s) = %q, %v", got, alg, err)
+		}
+	}
+
+	if _, err := checksum.Algorithm("md5:900150983cd24fb0d6963f7d28e17f72"); !errors.Is(err, checksum.ErrUnsupported) {
+		t.Fatalf("expected ErrUnsupported, got %v", err)
+	}
+}
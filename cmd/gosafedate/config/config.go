@@ -2,27 +2,196 @@ package config
 
 import "github.com/napalu/goopt/v2"
 
+// Signer holds the flags choosing the signing key, shared by the commands
+// which sign. Embedded in a command, its flags keep their names rather than
+// taking the field's as a prefix; see FlagNameConverter.
+type Signer struct {
+	KeyPath  string `goopt:"name:key;short:k;desc:Private key path (PEM or OpenSSH)"`
+	UseAgent bool   `goopt:"name:use-agent;desc:Sign with the ssh-agent key whose fingerprint is given by --key"`
+	KMSKey   string `goopt:"name:kms-key-uri;desc:Sign with a KMS key (awskms://, gcpkms://, azurekms://, hashivault://)"`
+	PKCS11   string `goopt:"name:pkcs11-module;desc:Sign with the PKCS #11 token key labelled --key, using this module"`
+	Slot     uint   `goopt:"name:slot;desc:PKCS #11 slot ID"`
+	PINEnv   string `goopt:"name:pin-env;desc:Environment variable holding the PKCS #11 PIN"`
+}
+
+// FlagNameConverter names the flags of untagged fields. goopt prefixes the
+// flags of a nested struct with its name; the empty name of Signer leaves
+// them unprefixed.
+func FlagNameConverter(name string) string {
+	if name == "Signer" {
+		return ""
+	}
+	return goopt.DefaultFlagNameConverter(name)
+}
+
 type Config struct {
+	JSON       bool   `goopt:"name:json;desc:Print results as JSON"`
+	ConfigPath string `goopt:"name:config;desc:Configuration file of flag defaults (default gosafedate.yaml if present)"`
+
 	Keygen struct {
-		Prefix string `goopt:"pos:0;required:true;desc:Prefix for key files"`
-		Exec   goopt.CommandFunc
+		Prefix    string `goopt:"pos:0;required:true;desc:Prefix for key files"`
+		Encrypt   bool   `goopt:"name:encrypt;desc:Encrypt the private key with a passphrase"`
+		Format    string `goopt:"name:format;short:f;desc:Also write the public key as raw, base64, go or json (default pem only)"`
+		OutDir    string `goopt:"name:out-dir;short:o;desc:Directory to write the keys to (default .)"`
+		Force     bool   `goopt:"name:force;desc:Overwrite existing key files"`
+		GoPackage string `goopt:"name:go-package;desc:Package of the Go file of --format go (default main)"`
+		GoVar     string `goopt:"name:go-var;desc:Variable of the Go file of --format go (default pubKey)"`
+		Exec      goopt.CommandFunc
 	} `goopt:"kind:command;name:keygen;desc:Generate Ed25519 keypair"`
 
 	Sign struct {
-		KeyPath string `goopt:"name:key;short:k;required:true;desc:Private key path (PEM)"`
-		Message string `goopt:"pos:0;required:true;desc:Message to sign"`
+		Signer
+		Message string `goopt:"pos:0;desc:Message to sign, or - to read it from stdin"`
+		File    string `goopt:"name:file;desc:Sign the SHA-256 digest of this file (- for stdin) instead of a message"`
 		Exec    goopt.CommandFunc
 	} `goopt:"kind:command;name:sign;desc:Sign a message"`
 
 	Verify struct {
-		PubPath   string `goopt:"name:pub;short:p;required:true;desc:Public key path (PEM)"`
-		Message   string `goopt:"pos:0;required:true;desc:Message"`
-		Signature string `goopt:"pos:1;required:true;desc:Signature (base64) to verify"`
+		PubPath   string `goopt:"name:pub;short:p;required:true;desc:Public key path (PEM or OpenSSH)"`
+		Message   string `goopt:"pos:0;desc:Message, or - to read it from stdin (with --file: the signature)"`
+		Signature string `goopt:"pos:1;desc:Signature (base64) to verify"`
+		File      string `goopt:"name:file;desc:Verify the signature of the SHA-256 digest of this file (- for stdin)"`
 		Exec      goopt.CommandFunc
 	} `goopt:"kind:command;name:verify;desc:Verify a signature"`
 
+	SignFile struct {
+		Signer
+		File string `goopt:"pos:0;required:true;desc:File whose SHA-256 is signed, or - for stdin"`
+		Exec goopt.CommandFunc
+	} `goopt:"kind:command;name:sign-file;desc:Sign the SHA-256 digest of a file"`
+
+	VerifyFile struct {
+		PubPath   string `goopt:"name:pub;short:p;required:true;desc:Public key path (PEM or OpenSSH)"`
+		File      string `goopt:"pos:0;required:true;desc:File, or - for stdin"`
+		Signature string `goopt:"pos:1;required:true;desc:Signature (base64) to verify"`
+		Exec      goopt.CommandFunc
+	} `goopt:"kind:command;name:verify-file;desc:Verify the signature of a file"`
+
+	Checksum struct {
+		File string `goopt:"pos:0;required:true;desc:File to checksum"`
+		Algo string `goopt:"name:algo;short:a;desc:Checksum algorithm: sha256 (default), sha512, blake2b or blake3"`
+		Exec goopt.CommandFunc
+	} `goopt:"kind:command;name:checksum;desc:Print the checksum of a file as written in metadata"`
+
+	Check struct {
+		URL        string `goopt:"name:url;short:u;required:true;desc:Metadata file or URL"`
+		Current    string `goopt:"name:current;short:c;required:true;desc:Installed version, e.g. v1.2.3"`
+		PubPath    string `goopt:"name:pub;short:p;desc:Public key path to check the signature with (PEM, OpenSSH or minisign)"`
+		Prerelease bool   `goopt:"name:prerelease;desc:Offer pre-releases, as Config.AllowPrerelease"`
+		Detached   bool   `goopt:"name:detached;desc:Accept releases signed only by a .sig or .minisig file next to the artifact, as update --detached"`
+		Exec       goopt.CommandFunc
+	} `goopt:"kind:command;name:check;desc:Report whether the updater would install an update"`
+
+	Update struct {
+		URL        string `goopt:"name:url;short:u;required:true;desc:Metadata file or URL"`
+		PubPath    string `goopt:"name:pub;short:p;required:true;desc:Public key path (PEM, OpenSSH or minisign)"`
+		Target     string `goopt:"name:target;short:t;required:true;desc:Binary to update, installed if missing"`
+		Current    string `goopt:"name:current;short:c;desc:Installed version (default: the output of <target> --version)"`
+		Prerelease bool   `goopt:"name:prerelease;desc:Install pre-releases"`
+		Detached   bool   `goopt:"name:detached;desc:Accept releases signed only by a .sig or .minisig file next to the artifact, whose version isn't signed"`
+		Downgrade  bool   `goopt:"name:allow-downgrade;desc:Install the offered release whenever the target's checksum differs, even if it isn't newer"`
+		Exec       goopt.CommandFunc
+	} `goopt:"kind:command;name:update;desc:Update a binary from a metadata document"`
+
+	VerifyRelease struct {
+		Meta     string `goopt:"name:meta;short:m;required:true;desc:Metadata file or URL"`
+		PubPath  string `goopt:"name:pub;short:p;required:true;desc:Public key path (PEM or OpenSSH)"`
+		Artifact string `goopt:"name:artifact;short:a;desc:Local artifact to check instead of downloading it"`
+		Version  string `goopt:"name:version;desc:Release of a feed to check (default: the latest)"`
+		Exec     goopt.CommandFunc
+	} `goopt:"kind:command;name:verify-release;desc:Check that a release downloads and verifies as the updater would"`
+
+	Inspect struct {
+		Meta    string `goopt:"pos:0;required:true;desc:Metadata file or URL"`
+		PubPath string `goopt:"name:pub;short:p;desc:Public key path to check the signatures with (PEM or OpenSSH)"`
+		Exec    goopt.CommandFunc
+	} `goopt:"kind:command;name:inspect;desc:Describe the releases of a metadata document"`
+
+	Serve struct {
+		Dir     string `goopt:"name:dir;short:d;desc:Directory to serve (default .)"`
+		Addr    string `goopt:"name:addr;short:a;desc:Listen address (default :8080)"`
+		KeyPath string `goopt:"name:key;short:k;desc:Private key path: re-sign metadata.json when its artifacts change"`
+		Exec    goopt.CommandFunc
+	} `goopt:"kind:command;name:serve;desc:Serve a release directory over HTTP for local testing"`
+
+	Release struct {
+		Pack struct {
+			Bins      []string `goopt:"name:bin;short:b;desc:Binary to release, or GOOS/GOARCH=path of each platform (comma separated)"`
+			Dist      string   `goopt:"name:dist;desc:goreleaser dist directory whose binaries to release"`
+			Name      string   `goopt:"name:name;desc:Tool name of a multi-platform release (default: the binary name)"`
+			Version   string   `goopt:"name:version;required:true;desc:Release version, e.g. v1.2.3"`
+			Out       string   `goopt:"name:out;short:o;desc:Output directory (default .)"`
+			BaseURL   string   `goopt:"name:base-url;desc:URL the artifact is published under (default: relative to the metadata)"`
+			Algorithm string   `goopt:"name:algorithm;desc:Checksum algorithm: sha256 (default), sha512, blake2b or blake3"`
+			Signer
+			Exec goopt.CommandFunc
+		} `goopt:"kind:command;name:pack;desc:Compress and sign binaries and write their metadata.json or fleet.json"`
+
+		Publish struct {
+			Dir        string `goopt:"name:dir;short:d;desc:Directory written by release pack (default .)"`
+			To         string `goopt:"name:to;required:true;desc:Destination: s3://bucket/prefix/, gs://bucket/prefix/, az://account/container/prefix/ or github://owner/repo"`
+			Version    string `goopt:"name:version;desc:Release of metadata.json to publish (default: the latest)"`
+			Tag        string `goopt:"name:tag;desc:GitHub release tag (default: the version)"`
+			S3Endpoint string `goopt:"name:s3-endpoint;desc:Endpoint of an S3-compatible store, e.g. https://minio.local:9000"`
+			GitHubURL  string `goopt:"name:github-url;desc:GitHub API URL (default https://api.github.com)"`
+			Exec       goopt.CommandFunc
+		} `goopt:"kind:command;name:publish;desc:Upload a packed release and its metadata to object storage or a GitHub release"`
+
+		Attest struct {
+			PubPath  string `goopt:"name:pub;short:p;required:true;desc:Public key path of the release signature (PEM or OpenSSH)"`
+			RekorURL string `goopt:"name:rekor-url;desc:Rekor instance to log in (default https://rekor.sigstore.dev)"`
+			Metadata string `goopt:"pos:0;required:true;desc:Signed metadata file to record the log entry in"`
+			Exec     goopt.CommandFunc
+		} `goopt:"kind:command;name:attest;desc:Log the release signature in the Rekor transparency log"`
+	} `goopt:"kind:command;name:release;desc:Release operations"`
+
+	Delta struct {
+		Old       string `goopt:"name:old;required:true;desc:Binary of the release to patch from"`
+		New       string `goopt:"name:new;required:true;desc:Binary of the release to patch to"`
+		Out       string `goopt:"name:out;short:o;desc:Patch file (default <old>-<to>.patch)"`
+		From      string `goopt:"name:from;desc:Version of --old (default: from its file name, e.g. app-v1.2.2)"`
+		To        string `goopt:"name:to;desc:Version of --new (default: from its file name, or the latest release of --meta)"`
+		Meta      string `goopt:"name:meta;short:m;desc:Metadata file whose release of --to to add the patch to"`
+		BaseURL   string `goopt:"name:base-url;desc:URL the patch is published under (default: relative to the metadata)"`
+		Algorithm string `goopt:"name:algorithm;desc:Checksum algorithm: sha256 (default), sha512, blake2b or blake3"`
+		Signer
+		Exec goopt.CommandFunc
+	} `goopt:"kind:command;name:delta;desc:Write a signed bsdiff patch between the binaries of two releases"`
+
+	SelfUpdate struct {
+		Check      bool `goopt:"name:check;desc:Only report whether an update is available"`
+		Prerelease bool `goopt:"name:prerelease;desc:Install pre-releases"`
+		Exec       goopt.CommandFunc
+	} `goopt:"kind:command;name:self-update;desc:Update gosafedate to its latest release"`
+
+	Keys struct {
+		Root struct {
+			KeyPath   string   `goopt:"name:key;short:k;required:true;desc:Root private key path (PEM or OpenSSH)"`
+			Pubs      []string `goopt:"name:pub;short:p;required:true;desc:Public key paths of the release keys (comma separated)"`
+			Version   int      `goopt:"name:version;required:true;desc:Manifest version, higher than the previous one"`
+			Expires   string   `goopt:"name:expires;desc:Expiry date (YYYY-MM-DD)"`
+			Threshold int      `goopt:"name:threshold;desc:Signatures required per release"`
+			Exec      goopt.CommandFunc
+		} `goopt:"kind:command;name:root;desc:Print a key manifest listing the release keys, signed by the root key"`
+
+		Rotate struct {
+			OldPath   string `goopt:"name:old;required:true;desc:Private key path of the current key (PEM or OpenSSH)"`
+			NewPrefix string `goopt:"name:new-prefix;required:true;desc:Prefix for the new key files"`
+			Version   int    `goopt:"name:version;required:true;desc:Manifest version, higher than the previous one"`
+			Expires   string `goopt:"name:expires;desc:Expiry date (YYYY-MM-DD)"`
+			KeepOld   bool   `goopt:"name:keep-old;desc:List the current key as well, for a transition period"`
+			Encrypt   bool   `goopt:"name:encrypt;desc:Encrypt the new private key with a passphrase"`
+			Out       string `goopt:"name:out;short:o;desc:Key manifest path (default root.json)"`
+			Exec      goopt.CommandFunc
+		} `goopt:"kind:command;name:rotate;desc:Generate a new key pair and a key manifest handing over to it, signed by the current key"`
+	} `goopt:"kind:command;name:keys;desc:Key management"`
+
 	PubBytes struct {
-		PubPath string `goopt:"name:pub;short:p;required:true;desc:Public key path (PEM)"`
+		PubPath string `goopt:"name:pub;short:p;required:true;desc:Public key path (PEM or OpenSSH), or - for stdin"`
+		Format  string `goopt:"name:format;short:f;desc:literal, go, base64, json, raw or pem (default: go for a .go --out, else literal)"`
+		Out     string `goopt:"name:out;short:o;desc:File to write instead of stdout"`
+		Package string `goopt:"name:package;desc:Package of the Go file of --format go (default main)"`
+		Var     string `goopt:"name:var;desc:Variable of the Go file of --format go (default pubKey)"`
 		Exec    goopt.CommandFunc
-	} `goopt:"kind:command;name:pubkey-bytes;desc:Print Go []byte literal for public key"`
+	} `goopt:"kind:command;name:pubkey-bytes;desc:Print a public key for embedding, by default as a Go []byte literal"`
 }
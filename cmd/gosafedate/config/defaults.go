@@ -0,0 +1,348 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/napalu/goopt/v2"
+)
+
+const (
+	// FileName is the configuration file read from the working directory
+	// unless --config or ConfigEnv names another.
+	FileName = "gosafedate.yaml"
+	// ConfigEnv names the configuration file.
+	ConfigEnv = "GOSAFEDATE_CONFIG"
+	// EnvPrefix prefixes the environment variables giving flag defaults:
+	// GOSAFEDATE_KEY for --key, GOSAFEDATE_OUT_DIR for --out-dir. Others,
+	// such as those the updater passes its helper, are ignored.
+	EnvPrefix = "GOSAFEDATE_"
+)
+
+// Defaults are the values of flags not given on the command line, read from
+// a configuration file and the environment. Environment variables apply to
+// every command and take precedence over the file.
+//
+// The file is a subset of YAML: top-level keys are flags of any command,
+// keys nested under a command name are flags of that command and its
+// subcommands, and lists are joined with commas:
+//
+//	key: keys/release
+//	url: https://example.com/releases/metadata.json
+//	release:
+//	  pack:
+//	    out: dist
+//	    bin:
+//	      - linux/amd64=build/app-linux
+//	      - darwin/arm64=build/app-darwin
+type Defaults struct {
+	sections map[string]map[string]string // by command path, "" for any command
+	env      map[string]string
+}
+
+// LoadDefaults reads the configuration file given by --config in args, by
+// ConfigEnv or, if it exists, FileName, and the environment variables of the
+// flags of p.
+func LoadDefaults(p *goopt.Parser, args []string) (*Defaults, error) {
+	path, explicit := os.Getenv(ConfigEnv), true
+	for i, a := range args {
+		if a == "--config" && i+1 < len(args) {
+			path = args[i+1]
+		} else if v, ok := strings.CutPrefix(a, "--config="); ok {
+			path = v
+		}
+	}
+	if path == "" {
+		path, explicit = FileName, false
+	}
+
+	d := &Defaults{}
+	f, err := os.Open(path)
+	switch {
+	case err == nil:
+		defer f.Close()
+		if d, err = ParseDefaults(f); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	case explicit || !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	}
+	d.Env(os.Environ(), func(flag string) bool { return isFlag(p, flag) })
+	return d, nil
+}
+
+// ParseDefaults reads a configuration file; see Defaults.
+func ParseDefaults(r io.Reader) (*Defaults, error) {
+	d := &Defaults{}
+	type section struct {
+		indent int
+		path   string
+	}
+	var (
+		stack = []section{{indent: -1}}
+		list  struct {
+			indent     int
+			path, flag string
+			items      []string
+			open       bool
+		}
+	)
+	flush := func() {
+		if list.open && len(list.items) > 0 {
+			d.set(list.path, list.flag, strings.Join(list.items, ","))
+		}
+		list.open, list.items = false, nil
+	}
+
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimRight(sc.Text(), " \t\r")
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || trimmed[0] == '#' || trimmed == "---" {
+			continue
+		}
+		if trimmed[0] == '\t' {
+			return nil, fmt.Errorf("line %d: indentation must use spaces", n)
+		}
+		indent := len(line) - len(trimmed)
+
+		if item, ok := strings.CutPrefix(trimmed, "-"); ok && (item == "" || item[0] == ' ') {
+			if !list.open || indent < list.indent {
+				return nil, fmt.Errorf("line %d: unexpected list item", n)
+			}
+			v, err := scalar(strings.TrimSpace(item))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			list.items = append(list.items, v)
+			continue
+		}
+		flush()
+
+		for indent <= stack[len(stack)-1].indent {
+			stack = stack[:len(stack)-1]
+		}
+		key, value, ok := strings.Cut(trimmed, ":")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \"'") {
+			return nil, fmt.Errorf("line %d: expected key: value", n)
+		}
+		path := stack[len(stack)-1].path
+		if value = strings.TrimSpace(value); value == "" || value[0] == '#' {
+			// a command section, or a flag whose value is the list which
+			// follows
+			stack = append(stack, section{indent: indent, path: strings.TrimSpace(path + " " + key)})
+			list.indent, list.path, list.flag, list.open = indent, path, key, true
+			continue
+		}
+		v, err := scalar(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		d.set(path, key, v)
+	}
+	flush()
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// scalar returns the value of a plain, quoted or flow list ([a, b]) YAML
+// scalar, joining list items with commas.
+func scalar(s string) (string, error) {
+	switch {
+	case s == "":
+		return "", nil
+	case s[0] == '"':
+		q, err := strconv.QuotedPrefix(s)
+		if err != nil {
+			return "", fmt.Errorf("invalid quoted value %s", s)
+		}
+		if err = trailer(s[len(q):]); err != nil {
+			return "", err
+		}
+		return strconv.Unquote(q)
+	case s[0] == '\'':
+		var b strings.Builder
+		for i := 1; i < len(s); i++ {
+			if s[i] != '\'' {
+				b.WriteByte(s[i])
+				continue
+			}
+			if i+1 < len(s) && s[i+1] == '\'' {
+				b.WriteByte('\'')
+				i++
+				continue
+			}
+			return b.String(), trailer(s[i+1:])
+		}
+		return "", fmt.Errorf("invalid quoted value %s", s)
+	case s[0] == '[':
+		end := strings.LastIndexByte(s, ']')
+		if end < 0 {
+			return "", fmt.Errorf("invalid list %s", s)
+		}
+		if err := trailer(s[end+1:]); err != nil {
+			return "", err
+		}
+		var items []string
+		for _, item := range strings.Split(s[1:end], ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			v, err := scalar(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, v)
+		}
+		return strings.Join(items, ","), nil
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s), nil
+}
+
+// trailer checks that only a comment follows a quoted value or list.
+func trailer(s string) error {
+	if s = strings.TrimSpace(s); s != "" && s[0] != '#' {
+		return fmt.Errorf("unexpected %q after value", s)
+	}
+	return nil
+}
+
+func (d *Defaults) set(path, flag, value string) {
+	if d.sections == nil {
+		d.sections = map[string]map[string]string{}
+	}
+	if d.sections[path] == nil {
+		d.sections[path] = map[string]string{}
+	}
+	d.sections[path][flag] = value
+}
+
+// Env adds the defaults given by the EnvPrefix variables of environ, in the
+// form of os.Environ, for the flags known reports.
+func (d *Defaults) Env(environ []string, known func(flag string) bool) {
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		flag, ok := strings.CutPrefix(name, EnvPrefix)
+		if !ok || name == ConfigEnv {
+			continue
+		}
+		if flag = strings.ToLower(strings.ReplaceAll(flag, "_", "-")); !known(flag) {
+			continue
+		}
+		if d.env == nil {
+			d.env = map[string]string{}
+		}
+		d.env[flag] = value
+	}
+}
+
+// isFlag reports whether flag is a flag of p or of one of its commands.
+func isFlag(p *goopt.Parser, flag string) bool {
+	if _, err := p.GetArgument(flag); err == nil {
+		return true
+	}
+	return slices.ContainsFunc(p.GetCompletionData().Commands, func(path string) bool {
+		_, err := p.GetArgument(flag, path)
+		return err == nil
+	})
+}
+
+// lookup returns the default of a flag of the command at path: from the
+// environment, else from the most specific section of the file.
+func (d *Defaults) lookup(path []string, flag string) (string, bool) {
+	if v, ok := d.env[flag]; ok {
+		return v, true
+	}
+	for i := len(path); i >= 0; i-- {
+		if v, ok := d.sections[strings.Join(path[:i], " ")][flag]; ok {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// Apply returns args, without the program name, with the defaults of the
+// flags of the command they run which aren't given added as --flag=value.
+// Names of unknown flags and positional arguments are ignored.
+func (d *Defaults) Apply(p *goopt.Parser, args []string) []string {
+	path := commandPath(p, args)
+
+	var names []string
+	for name := range d.env {
+		names = append(names, name)
+	}
+	for i := 0; i <= len(path); i++ {
+		for name := range d.sections[strings.Join(path[:i], " ")] {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	names = slices.Compact(names)
+
+	var global, command []string
+	for _, name := range names {
+		arg, err := p.GetArgument(name)
+		isGlobal := err == nil
+		if !isGlobal && len(path) > 0 {
+			arg, err = p.GetArgument(name, strings.Join(path, " "))
+		}
+		if err != nil || arg.Position != nil || name == arg.Short || given(args, name, arg.Short) {
+			continue
+		}
+		v, ok := d.lookup(path, name)
+		switch {
+		case !ok:
+		case isGlobal:
+			global = append(global, "--"+name+"="+v)
+		default:
+			command = append(command, "--"+name+"="+v)
+		}
+	}
+	// global flags with a value are only parsed before the command
+	return slices.Concat(global, args, command)
+}
+
+// commandPath returns the command args run, e.g. ["release", "pack"].
+func commandPath(p *goopt.Parser, args []string) []string {
+	var path []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--config" {
+			i++
+			continue
+		}
+		if strings.HasPrefix(a, "-") {
+			continue
+		}
+		// without options, SetCommand only looks the command up: HasCommand
+		// reports the commands seen by Parse
+		if p.SetCommand(strings.Join(append(path, a), " ")) != nil {
+			break
+		}
+		path = append(path, a)
+	}
+	return path
+}
+
+// given reports whether args set the flag name or its short form.
+func given(args []string, name, short string) bool {
+	return slices.ContainsFunc(args, func(a string) bool {
+		if !strings.HasPrefix(a, "-") {
+			return false
+		}
+		f, _, _ := strings.Cut(strings.TrimLeft(a, "-"), "=")
+		return f == name || (short != "" && f == short)
+	})
+}
@@ -0,0 +1,225 @@
+package config
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/napalu/goopt/v2"
+)
+
+func newParser(t *testing.T) (*Config, *goopt.Parser) {
+	t.Helper()
+	cfg := &Config{}
+	p, err := goopt.NewParserFromStruct(cfg, goopt.WithFlagNameConverter(FlagNameConverter))
+	if err != nil {
+		t.Fatalf("parser: %v", err)
+	}
+	return cfg, p
+}
+
+func TestDefaults_Precedence(t *testing.T) {
+	const file = `
+key: file.pem
+json: true
+release:
+  pack:
+    out: dist # the packed release
+    bin:
+      - linux/amd64=app-linux
+      - "darwin/arm64=app-darwin"
+`
+	pack := []string{"release", "pack", "--version", "v1.0.0"}
+	rotate := []string{"keys", "rotate", "--old", "old.pem", "--new-prefix", "new", "--version", "2"}
+	key := func(c *Config) string { return c.Release.Pack.KeyPath }
+	out := func(c *Config) string { return c.Release.Pack.Out }
+	bins := func(c *Config) string { return strings.Join(c.Release.Pack.Bins, ",") }
+	jsonFlag := func(c *Config) string { return strconv.FormatBool(c.JSON) }
+	rotateOut := func(c *Config) string { return c.Keys.Rotate.Out }
+
+	tests := []struct {
+		name    string
+		file    string
+		environ []string
+		args    []string
+		want    func(*Config) string
+		wantVal string
+	}{
+		{name: "file", file: file, args: pack, want: key, wantVal: "file.pem"},
+		{name: "file section", file: file, args: pack, want: out, wantVal: "dist"},
+		{name: "file list", file: file, args: pack, want: bins, wantVal: "linux/amd64=app-linux,darwin/arm64=app-darwin"},
+		{name: "file global flag", file: file, args: pack, want: jsonFlag, wantVal: "true"},
+		{name: "section over top level", file: file + "    key: pack.pem\n", args: pack, want: key, wantVal: "pack.pem"},
+		{name: "env over file", file: file, environ: []string{"GOSAFEDATE_KEY=env.pem", "GOSAFEDATE_OUT=env"}, args: pack, want: out, wantVal: "env"},
+		{name: "env over file section", file: file + "    key: pack.pem\n", environ: []string{"GOSAFEDATE_KEY=env.pem"}, args: pack, want: key, wantVal: "env.pem"},
+		{name: "flag over env", file: file, environ: []string{"GOSAFEDATE_KEY=env.pem"}, args: append(pack, "--key", "flag.pem"), want: key, wantVal: "flag.pem"},
+		{name: "flag=value over env", environ: []string{"GOSAFEDATE_KEY=env.pem"}, args: append(pack, "--key=flag.pem"), want: key, wantVal: "flag.pem"},
+		{name: "short flag over file", file: file, args: append(pack, "-k", "flag.pem"), want: key, wantVal: "flag.pem"},
+		{name: "flag over file list", file: file, args: append(pack, "--bin", "app"), want: bins, wantVal: "app"},
+		{name: "other command's section", file: file, args: rotate, want: rotateOut, wantVal: ""},
+		{name: "env applies to any command", environ: []string{"GOSAFEDATE_OUT=env"}, args: rotate, want: rotateOut, wantVal: "env"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, p := newParser(t)
+			d, err := ParseDefaults(strings.NewReader(tt.file))
+			if err != nil {
+				t.Fatalf("ParseDefaults: %v", err)
+			}
+			d.Env(tt.environ, func(flag string) bool { return isFlag(p, flag) })
+
+			args := d.Apply(p, tt.args)
+			if !p.Parse(args) {
+				t.Fatalf("Parse(%q): %v", args, p.GetErrors())
+			}
+			if got := tt.want(cfg); got != tt.wantVal {
+				t.Fatalf("got %q, want %q (args %q)", got, tt.wantVal, args)
+			}
+		})
+	}
+}
+
+func TestDefaults_Env(t *testing.T) {
+	_, p := newParser(t)
+
+	tests := []struct {
+		name    string
+		environ []string
+		want    map[string]string
+	}{
+		{name: "flags", environ: []string{"GOSAFEDATE_KEY=k.pem", "GOSAFEDATE_OUT_DIR=keys", "GOSAFEDATE_JSON=true"},
+			want: map[string]string{"key": "k.pem", "out-dir": "keys", "json": "true"}},
+		{name: "value with =", environ: []string{"GOSAFEDATE_BASE_URL=https://example.com/?a=b"},
+			want: map[string]string{"base-url": "https://example.com/?a=b"}},
+		// e.g. the variables the updater passes its helper
+		{name: "unknown", environ: []string{"GOSAFEDATE_HELPER=1", "GOSAFEDATE_TARGET_PID=42", "GOSAFEDATE_=x"}},
+		{name: "config file", environ: []string{"GOSAFEDATE_CONFIG=other.yaml"}},
+		{name: "other prefix", environ: []string{"KEY=k.pem", "XGOSAFEDATE_KEY=k.pem", "gosafedate_key=k.pem"}},
+		{name: "mixed", environ: []string{"PATH=/bin", "GOSAFEDATE_HELPER=1", "GOSAFEDATE_URL=https://example.com/metadata.json"},
+			want: map[string]string{"url": "https://example.com/metadata.json"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &Defaults{}
+			d.Env(tt.environ, func(flag string) bool { return isFlag(p, flag) })
+			if !maps.Equal(d.env, tt.want) {
+				t.Fatalf("env = %v, want %v", d.env, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDefaults(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		want map[string]map[string]string
+	}{
+		{name: "empty", file: "# nothing\n---\n"},
+		{name: "scalars", file: "key: k.pem\nurl: 'it''s' # comment\nout: \"a #b\"\n",
+			want: map[string]map[string]string{"": {"key": "k.pem", "url": "it's", "out": "a #b"}}},
+		{name: "flow list", file: "bin: [a, \"b\", ]\n",
+			want: map[string]map[string]string{"": {"bin": "a,b"}}},
+		{name: "nested", file: "release:\n  pack:\n    out: dist\n  publish:\n    to: s3://b/\nkey: k\n",
+			want: map[string]map[string]string{"release pack": {"out": "dist"}, "release publish": {"to": "s3://b/"}, "": {"key": "k"}}},
+		{name: "block list", file: "bin:\n- a\n- b\nkey: k\n",
+			want: map[string]map[string]string{"": {"bin": "a,b", "key": "k"}}},
+		{name: "windows line endings", file: "key: k.pem\r\n",
+			want: map[string]map[string]string{"": {"key": "k.pem"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := ParseDefaults(strings.NewReader(tt.file))
+			if err != nil {
+				t.Fatalf("ParseDefaults: %v", err)
+			}
+			if !maps.EqualFunc(d.sections, tt.want, maps.Equal) {
+				t.Fatalf("sections = %v, want %v", d.sections, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDefaults_Malformed(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		wantErr string
+	}{
+		{name: "tab indentation", file: "release:\n\tout: dist\n", wantErr: "line 2: indentation must use spaces"},
+		{name: "no colon", file: "key k.pem\n", wantErr: "line 1: expected key: value"},
+		{name: "empty key", file: ": k.pem\n", wantErr: "line 1: expected key: value"},
+		{name: "quoted key", file: "\"key\": k.pem\n", wantErr: "line 1: expected key: value"},
+		{name: "list item without flag", file: "key: k.pem\n- a\n", wantErr: "line 2: unexpected list item"},
+		{name: "list item outdented", file: "release:\n  bin:\n  - a\n- b\n", wantErr: "line 4: unexpected list item"},
+		{name: "unterminated double quote", file: "key: \"k.pem\n", wantErr: "line 1: invalid quoted value"},
+		{name: "unterminated single quote", file: "key: 'k.pem\n", wantErr: "line 1: invalid quoted value"},
+		{name: "unterminated list", file: "bin: [a, b\n", wantErr: "line 1: invalid list"},
+		{name: "text after quote", file: "key: \"k\" pem\n", wantErr: "line 1: unexpected \"pem\" after value"},
+		{name: "bad list item", file: "bin:\n  - \"a\n", wantErr: "line 2: invalid quoted value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseDefaults(strings.NewReader(tt.file))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	_, p := newParser(t)
+	dir := t.TempDir()
+	bad := filepath.Join(dir, "bad.yaml")
+	if err := os.WriteFile(bad, []byte("key k.pem\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	good := filepath.Join(dir, "good.yaml")
+	if err := os.WriteFile(good, []byte("key: k.pem\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+
+	tests := []struct {
+		name    string
+		env     string
+		args    []string
+		wantErr string
+	}{
+		{name: "no file"},
+		{name: "flag", args: []string{"sign", "--config", good}},
+		{name: "flag=value", args: []string{"sign", "--config=" + good}},
+		{name: "env", env: good},
+		{name: "malformed", args: []string{"--config", bad}, wantErr: bad + ": line 1: expected key: value"},
+		{name: "malformed from env", env: bad, wantErr: bad + ": line 1"},
+		{name: "missing", args: []string{"--config", filepath.Join(dir, "missing.yaml")}, wantErr: "missing.yaml"},
+		{name: "missing from env", env: filepath.Join(dir, "missing.yaml"), wantErr: "missing.yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(ConfigEnv, tt.env)
+			// only the file sets --key
+			t.Setenv("GOSAFEDATE_KEY", "")
+			_ = os.Unsetenv("GOSAFEDATE_KEY")
+
+			d, err := LoadDefaults(p, tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadDefaults: %v", err)
+			}
+			v, ok := d.lookup([]string{"sign"}, "key")
+			if want := tt.name != "no file"; ok != want || ok && v != "k.pem" {
+				t.Fatalf("key = %q, %v; want set=%v", v, ok, want)
+			}
+		})
+	}
+}
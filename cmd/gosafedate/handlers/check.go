@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/napalu/goopt/v2"
+	"github.com/napalu/gosafedate/cmd/gosafedate/config"
+	"github.com/napalu/gosafedate/self"
+)
+
+// HandleCheck reports whether an installed version would be updated from a
+// metadata document, and if not why, using the version selection of the
+// updater. With --pub, the signature of the offered release is verified
+// too, as update verifies it, and a release failing to verify is an error as
+// the updater would refuse it.
+func HandleCheck(p *goopt.Parser, _ *goopt.Command) error {
+	cfg, ok := goopt.GetStructCtxAs[*config.Config](p)
+	if !ok {
+		return fmt.Errorf("failed to get options from context")
+	}
+	opts := cfg.Check
+
+	var pub []byte
+	if opts.PubPath != "" {
+		var err error
+		if pub, err = releaseKey(opts.PubPath); err != nil {
+			return fmt.Errorf("check failed: %w", err)
+		}
+	}
+	metaURL, err := metadataURL(opts.URL)
+	if err != nil {
+		return fmt.Errorf("check failed: %w", err)
+	}
+
+	u := self.New(self.Config{
+		URL:                metaURL,
+		PubKey:             pub,
+		CurrentVer:         opts.Current,
+		AllowPrerelease:    opts.Prerelease,
+		LogInfo:            func(string, ...any) {},
+		LogError:           func(string, ...any) {},
+		DetachedSignatures: opts.Detached,
+	})
+	plan, err := u.Plan()
+	if err != nil {
+		return fmt.Errorf("check failed: %w", err)
+	}
+
+	res := checkResult{
+		Current:     plan.CurrentVersion,
+		Offered:     plan.TargetVersion,
+		DownloadURL: plan.DownloadURL,
+		Size:        plan.DownloadSize,
+		Signature:   sigUnchecked,
+		Update:      plan.Newer,
+		Reason:      string(plan.Reason),
+	}
+	var verr error
+	if pub != nil {
+		res.Signature = sigValid
+		if verr = u.VerifyPlan(plan); verr != nil {
+			res.Signature = sigInvalid
+		}
+	}
+	err = printResult(cfg, res, func() {
+		fmt.Printf("current:      %s\n", res.Current)
+		fmt.Printf("offered:      %s\n", res.Offered)
+		fmt.Printf("download URL: %s\n", res.DownloadURL)
+		if res.Size >= 0 {
+			fmt.Printf("size:         %d\n", res.Size)
+		}
+		fmt.Printf("signature:    %s\n", res.Signature)
+		switch {
+		case res.Signature == sigInvalid:
+		case res.Update:
+			fmt.Printf("update to %s would be installed\n", res.Offered)
+		default:
+			fmt.Printf("no update: %s\n", res.Reason)
+		}
+	})
+	if err == nil && res.Signature == sigInvalid {
+		err = fmt.Errorf("check failed: %s: %w: %s: %v", res.Offered, ErrInvalidSignature, opts.PubPath, verr)
+	}
+	return err
+}
+
+// checkResult is the JSON result of check.
+type checkResult struct {
+	Current     string `json:"current"`
+	Offered     string `json:"offered"`
+	DownloadURL string `json:"downloadUrl"`
+	Size        int64  `json:"size"` // -1 if unknown
+	Signature   string `json:"signature"`
+	Update      bool   `json:"update"`           // the offered release would be installed
+	Reason      string `json:"reason,omitempty"` // if not, why
+}
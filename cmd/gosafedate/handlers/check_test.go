@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/napalu/gosafedate/metadata"
+	"github.com/napalu/gosafedate/signing"
+)
+
+// sidecarRelease packs data as release version signed only by a .sig file
+// next to its artifact, signed by sigKey, and returns its metadata.json.
+func sidecarRelease(t *testing.T, key, sigKey, version string, data []byte) string {
+	t.Helper()
+	dir := t.TempDir()
+	meta := pack(t, dir, key, "tool", version, data)
+
+	b, err := os.ReadFile(meta)
+	if err != nil {
+		t.Fatalf("read metadata: %v", err)
+	}
+	var m metadata.Metadata
+	if err = json.Unmarshal(b, &m); err != nil {
+		t.Fatalf("parse metadata: %v", err)
+	}
+	m.Signature, m.Signatures = "", nil
+	if err = writeJSON(meta, m); err != nil {
+		t.Fatalf("write metadata: %v", err)
+	}
+
+	artifact := filepath.Join(dir, m.DownloadURL)
+	sig, err := signing.SignBinary(sigKey, artifact)
+	if err != nil {
+		t.Fatalf("sign artifact: %v", err)
+	}
+	if err = os.WriteFile(artifact+".sig", []byte(sig+"\n"), 0o644); err != nil {
+		t.Fatalf("write signature: %v", err)
+	}
+	return meta
+}
+
+func TestHandleCheck_AgreesWithUpdate(t *testing.T) {
+	dir := t.TempDir()
+	key, pub := testKeys(t, dir)
+	other, _ := testKeys(t, t.TempDir())
+	data := []byte("tool v1.1.0")
+
+	tests := []struct {
+		name     string
+		meta     string
+		detached bool
+		valid    bool
+	}{
+		{name: "inline", meta: pack(t, t.TempDir(), key, "tool", "v1.1.0", data), valid: true},
+		{name: "sidecar", meta: sidecarRelease(t, key, key, "v1.1.0", data), detached: true, valid: true},
+		{name: "sidecar not accepted", meta: sidecarRelease(t, key, key, "v1.1.0", data)},
+		{name: "sidecar by another key", meta: sidecarRelease(t, key, other, "v1.1.0", data), detached: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.detached && tt.valid && runtime.GOOS == "windows" {
+				t.Skip("the update helper installing the checked app requires inline signatures")
+			}
+			args := []string{"--url", tt.meta, "--pub", pub, "--current", "v1.0.0"}
+			if tt.detached {
+				args = append(args, "--detached")
+			}
+
+			out, checkErr := run(t, append([]string{"--json", "check"}, args...)...)
+			target := filepath.Join(t.TempDir(), "tool")
+			_, updateErr := run(t, append([]string{"update", "--target", target}, args...)...)
+
+			if (checkErr == nil) != tt.valid || (updateErr == nil) != tt.valid {
+				t.Fatalf("check: %v, update: %v; want valid=%v", checkErr, updateErr, tt.valid)
+			}
+			if checkErr != nil && !errors.Is(checkErr, ErrInvalidSignature) {
+				t.Fatalf("check: %v, want %v", checkErr, ErrInvalidSignature)
+			}
+
+			var res checkResult
+			if err := json.Unmarshal([]byte(out), &res); err != nil {
+				t.Fatalf("result %q: %v", out, err)
+			}
+			want := sigInvalid
+			if tt.valid {
+				want = sigValid
+			}
+			if res.Signature != want || res.Update != true {
+				t.Fatalf("result = %+v, want signature %s", res, want)
+			}
+			if _, err := os.Stat(target); (err == nil) != tt.valid {
+				t.Fatalf("target installed: %v, want %v", err == nil, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/napalu/goopt/v2"
+	"github.com/napalu/gosafedate/checksum"
+	"github.com/napalu/gosafedate/cmd/gosafedate/config"
+)
+
+// HandleChecksum prints the checksum of a file in the format of the
+// metadata: lowercase hex, prefixed by the algorithm unless it is SHA-256.
+func HandleChecksum(p *goopt.Parser, _ *goopt.Command) error {
+	cfg, ok := goopt.GetStructCtxAs[*config.Config](p)
+	if !ok {
+		return fmt.Errorf("failed to get options from context")
+	}
+
+	sum, err := checksum.File(cfg.Checksum.File, cfg.Checksum.Algo)
+	if err != nil {
+		return fmt.Errorf("checksum failed: %w", err)
+	}
+
+	return printResult(cfg, map[string]string{"file": cfg.Checksum.File, "checksum": sum}, func() { fmt.Println(sum) })
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/napalu/goopt/v2"
+	"github.com/napalu/gosafedate/bsdiff"
+	"github.com/napalu/gosafedate/checksum"
+	"github.com/napalu/gosafedate/cmd/gosafedate/config"
+	"github.com/napalu/gosafedate/metadata"
+	"github.com/napalu/gosafedate/signing"
+)
+
+// HandleDelta writes a bsdiff patch turning the binary of one release into
+// that of the next and signs it as sign-file does into <patch>.sig. With
+// --meta, the patch is listed in the patches of the release it updates to,
+// so the updater downloads it rather than the full artifact.
+func HandleDelta(p *goopt.Parser, _ *goopt.Command) error {
+	cfg, ok := goopt.GetStructCtxAs[*config.Config](p)
+	if !ok {
+		return fmt.Errorf("failed to get options from context")
+	}
+	opts := cfg.Delta
+
+	from := or(opts.From, fileVersion(opts.Old))
+	if from == "" {
+		return fmt.Errorf("delta failed: no version in the name of %s: set --from", opts.Old)
+	}
+	to := or(opts.To, fileVersion(opts.New))
+
+	var (
+		feed    *metadata.Feed
+		isFeed  bool
+		release *metadata.Metadata
+	)
+	if opts.Meta != "" {
+		var err error
+		if feed, isFeed, err = readReleases(opts.Meta); err != nil {
+			return fmt.Errorf("delta failed: %w", err)
+		}
+		if release, err = findRelease(feed.Releases, to); err != nil {
+			return fmt.Errorf("delta failed: %s: %w", opts.Meta, err)
+		}
+		to = release.Version
+		if err = checkBinary(opts.New, release); err != nil {
+			return fmt.Errorf("delta failed: %w", err)
+		}
+	}
+	if to == "" {
+		return fmt.Errorf("delta failed: no version in the name of %s: set --to or --meta", opts.New)
+	}
+	out := or(opts.Out, strings.TrimSuffix(filepath.Base(opts.Old), ".exe")+"-"+to+".patch")
+
+	signer, err := loadSigner(signerFlags(opts.Signer))
+	if err != nil {
+		return fmt.Errorf("delta failed: %w", err)
+	}
+	defer closeSigner(signer)
+
+	oldBin, err := os.ReadFile(opts.Old)
+	if err != nil {
+		return fmt.Errorf("delta failed: %w", err)
+	}
+	newBin, err := os.ReadFile(opts.New)
+	if err != nil {
+		return fmt.Errorf("delta failed: %w", err)
+	}
+	if err = os.WriteFile(out, bsdiff.Diff(oldBin, newBin), 0o644); err != nil {
+		return fmt.Errorf("delta failed: %w", err)
+	}
+	files := &fileList{json: cfg.JSON}
+	files.add(out)
+
+	digest, err := fileDigest(out)
+	if err != nil {
+		return fmt.Errorf("delta failed: %w", err)
+	}
+	sig, err := signing.SignWith(signer, digest)
+	if err != nil {
+		return fmt.Errorf("delta failed: %w", err)
+	}
+	if err = os.WriteFile(out+".sig", []byte(sig+"\n"), 0o644); err != nil {
+		return fmt.Errorf("delta failed: %w", err)
+	}
+	files.add(out + ".sig")
+
+	if release == nil {
+		return files.done()
+	}
+	patch, err := describePatch(out, from, opts.BaseURL, opts.Algorithm)
+	if err != nil {
+		return fmt.Errorf("delta failed: %w", err)
+	}
+	release.Patches = slices.DeleteFunc(release.Patches, func(p metadata.Patch) bool {
+		return sameVersion(p.FromVersion, from)
+	})
+	release.Patches = append(release.Patches, *patch)
+	if isFeed {
+		err = writeJSON(opts.Meta, feed)
+	} else {
+		err = writeJSON(opts.Meta, feed.Releases[0])
+	}
+	if err != nil {
+		return fmt.Errorf("delta failed: %w", err)
+	}
+	files.add(opts.Meta)
+	return files.done()
+}
+
+// versionSuffix matches the version ending a file name such as
+// app-v1.2.3 or app_1.2.3-rc.1.exe.
+var versionSuffix = regexp.MustCompile(`[-_](v?\d+\.\d+\.\d+(?:-[0-9A-Za-z.-]+)?(?:\+[0-9A-Za-z.-]+)?)(?:\.exe)?$`)
+
+// fileVersion returns the version ending the name of the binary at path, or
+// "" if there is none.
+func fileVersion(path string) string {
+	if m := versionSuffix.FindStringSubmatch(filepath.Base(path)); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+func sameVersion(a, b string) bool {
+	return strings.TrimPrefix(a, "v") == strings.TrimPrefix(b, "v")
+}
+
+// readReleases reads a metadata document holding a release or a feed,
+// reporting which.
+func readReleases(path string) (*metadata.Feed, bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false, err
+	}
+	if feed, ok := parseFeed(data); ok {
+		return feed, true, nil
+	}
+	var m metadata.Metadata
+	if err = json.Unmarshal(data, &m); err != nil {
+		return nil, false, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return &metadata.Feed{Releases: []metadata.Metadata{m}}, false, nil
+}
+
+// findRelease returns the release of version, or the latest if version is
+// empty.
+func findRelease(releases []metadata.Metadata, version string) (*metadata.Metadata, error) {
+	if len(releases) == 0 {
+		return nil, errors.New("no releases")
+	}
+	if version == "" {
+		latest, err := metadata.Latest(releases)
+		if err != nil {
+			return nil, err
+		}
+		version = latest.Version
+	}
+	for i := range releases {
+		if sameVersion(releases[i].Version, version) {
+			return &releases[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no release %s", version)
+}
+
+// checkBinary checks that bin is the binary m installs, which the patch
+// must produce.
+func checkBinary(bin string, m *metadata.Metadata) error {
+	alg, err := checksum.Algorithm(m.Checksum)
+	if err != nil {
+		return err
+	}
+	sum, err := checksum.File(bin, alg)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(sum, m.Checksum) {
+		return fmt.Errorf("%s is not the binary of release %s: checksum %s != %s", bin, m.Version, sum, m.Checksum)
+	}
+	return nil
+}
+
+// describePatch returns the metadata entry of the patch at path.
+func describePatch(path, from, baseURL, alg string) (*metadata.Patch, error) {
+	sum, err := checksum.File(path, or(alg, checksum.SHA256))
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.Base(path)
+	downloadURL := name
+	if baseURL != "" {
+		downloadURL = strings.TrimSuffix(baseURL, "/") + "/" + url.PathEscape(name)
+	}
+	return &metadata.Patch{
+		FromVersion: from,
+		DownloadURL: downloadURL,
+		Checksum:    sum,
+		Size:        fi.Size(),
+	}, nil
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/napalu/gosafedate/self"
+	"github.com/napalu/gosafedate/signing"
+)
+
+// deltaRelease packs newData as release v1.1.0 of a tool and writes the
+// patch from oldData to it with delta, listed in the metadata. The full
+// artifact is removed, so that only the patch can update to it. It returns
+// the release directory, its metadata and the public key.
+func deltaRelease(t *testing.T, oldData, newData []byte) (dir, meta, pub string) {
+	t.Helper()
+	dir = t.TempDir()
+	key, pub := testKeys(t, t.TempDir())
+	meta = pack(t, dir, key, "tool", "v1.1.0", newData)
+
+	bins := t.TempDir()
+	oldBin, newBin := filepath.Join(bins, "tool-v1.0.0"), filepath.Join(bins, "tool-v1.1.0")
+	if err := os.WriteFile(oldBin, oldData, 0o755); err != nil {
+		t.Fatalf("write old binary: %v", err)
+	}
+	if err := os.WriteFile(newBin, newData, 0o755); err != nil {
+		t.Fatalf("write new binary: %v", err)
+	}
+	if _, err := run(t, "delta", "--old", oldBin, "--new", newBin, "--meta", meta, "--key", key,
+		"--out", filepath.Join(dir, "tool-v1.1.0.patch")); err != nil {
+		t.Fatalf("delta: %v", err)
+	}
+	if err := os.Remove(filepath.Join(dir, "tool-v1.1.0.gz")); err != nil {
+		t.Fatalf("remove artifact: %v", err)
+	}
+	return dir, meta, pub
+}
+
+// binaries returns the data of two releases differing by a few bytes.
+func binaries() (oldData, newData []byte) {
+	oldData = bytes.Repeat([]byte("gosafedate delta test binary "), 2048)
+	newData = bytes.Clone(oldData)
+	copy(newData[1000:], "patched")
+	return oldData, append(newData, "v1.1.0"...)
+}
+
+// updateTool updates a tool installed as oldData from meta, returning the
+// installed binary and the warnings logged.
+func updateTool(t *testing.T, meta, pub string, oldData []byte, maxBinarySize int64) ([]byte, string, error) {
+	t.Helper()
+	target := filepath.Join(t.TempDir(), "tool")
+	if err := os.WriteFile(target, oldData, 0o755); err != nil {
+		t.Fatalf("write target: %v", err)
+	}
+	metaURL, err := metadataURL(meta)
+	if err != nil {
+		t.Fatalf("metadata URL: %v", err)
+	}
+	key, err := signing.PublicKeyFromFile(pub)
+	if err != nil {
+		t.Fatalf("public key: %v", err)
+	}
+
+	var warnings strings.Builder
+	err = self.UpdateIfNewer(self.Config{
+		URL:           metaURL,
+		PubKey:        key,
+		TargetPath:    target,
+		CurrentVer:    "v1.0.0",
+		Managed:       true,
+		MaxBinarySize: maxBinarySize,
+		LogInfo:       func(string, ...any) {},
+		LogError: func(format string, args ...any) {
+			fmt.Fprintf(&warnings, format+"\n", args...)
+		},
+	})
+	got, rerr := os.ReadFile(target)
+	if rerr != nil {
+		t.Fatalf("read target: %v", rerr)
+	}
+	return got, warnings.String(), err
+}
+
+func TestHandleDelta_RoundTrip(t *testing.T) {
+	oldData, newData := binaries()
+	dir, meta, pub := deltaRelease(t, oldData, newData)
+	if _, err := os.Stat(filepath.Join(dir, "tool-v1.1.0.patch.sig")); err != nil {
+		t.Fatalf("patch signature: %v", err)
+	}
+
+	got, warnings, err := updateTool(t, meta, pub, oldData, 0)
+	if err != nil {
+		t.Fatalf("update: %v\n%s", err, warnings)
+	}
+	if !bytes.Equal(got, newData) {
+		t.Fatal("target not patched to the new release")
+	}
+}
+
+func TestHandleDelta_PatchRefused(t *testing.T) {
+	oldData, newData := binaries()
+
+	tests := []struct {
+		name          string
+		tamper        func(t *testing.T, dir string)
+		maxBinarySize int64
+		wantWarning   string
+	}{
+		{
+			name: "patch signed by another key",
+			tamper: func(t *testing.T, dir string) {
+				sig := filepath.Join(dir, "tool-v1.1.0.patch.sig")
+				other, _, _ := deltaRelease(t, newData, oldData)
+				b, err := os.ReadFile(filepath.Join(other, "tool-v1.1.0.patch.sig"))
+				if err == nil {
+					err = os.WriteFile(sig, b, 0o644)
+				}
+				if err != nil {
+					t.Fatalf("replace signature: %v", err)
+				}
+			},
+			wantWarning: "patch signature verification failed",
+		},
+		{
+			name: "missing signature",
+			tamper: func(t *testing.T, dir string) {
+				if err := os.Remove(filepath.Join(dir, "tool-v1.1.0.patch.sig")); err != nil {
+					t.Fatalf("remove signature: %v", err)
+				}
+			},
+			wantWarning: "fetch signature",
+		},
+		{
+			name:          "larger than MaxBinarySize",
+			maxBinarySize: int64(len(newData)) - 1,
+			wantWarning:   fmt.Sprintf("exceeds %d bytes", len(newData)-1),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, meta, pub := deltaRelease(t, oldData, newData)
+			if tt.tamper != nil {
+				tt.tamper(t, dir)
+			}
+
+			// without the full artifact to fall back to, the update fails
+			got, warnings, err := updateTool(t, meta, pub, oldData, tt.maxBinarySize)
+			if err == nil {
+				t.Fatal("update succeeded")
+			}
+			if !strings.Contains(warnings, "delta update failed") || !strings.Contains(warnings, tt.wantWarning) {
+				t.Fatalf("warnings %q, want %q", warnings, tt.wantWarning)
+			}
+			if !bytes.Equal(got, oldData) {
+				t.Fatal("target replaced")
+			}
+		})
+	}
+}
+
+func TestHandleDelta_Errors(t *testing.T) {
+	oldData, newData := binaries()
+	dir := t.TempDir()
+	key, _ := testKeys(t, dir)
+	meta := pack(t, t.TempDir(), key, "tool", "v1.1.0", newData)
+
+	oldBin, newBin := filepath.Join(dir, "tool-v1.0.0"), filepath.Join(dir, "tool-v1.1.0")
+	if err := os.WriteFile(oldBin, oldData, 0o755); err != nil {
+		t.Fatalf("write old binary: %v", err)
+	}
+	if err := os.WriteFile(newBin, newData, 0o755); err != nil {
+		t.Fatalf("write new binary: %v", err)
+	}
+	out := filepath.Join(dir, "out.patch")
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "missing old binary", args: []string{"--old", filepath.Join(dir, "tool-v0.9.0"), "--new", newBin}, wantErr: "tool-v0.9.0"},
+		{name: "missing new binary", args: []string{"--old", oldBin, "--new", filepath.Join(dir, "tool-v1.2.0")}, wantErr: "tool-v1.2.0"},
+		{name: "no version", args: []string{"--old", filepath.Join(dir, "tool"), "--new", newBin}, wantErr: "set --from"},
+		{name: "not the release binary", args: []string{"--old", oldBin, "--new", oldBin, "--to", "v1.1.0", "--meta", meta}, wantErr: "is not the binary of release v1.1.0"},
+		{name: "no such release", args: []string{"--old", oldBin, "--new", newBin, "--to", "v2.0.0", "--meta", meta}, wantErr: "no release v2.0.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := run(t, append([]string{"delta", "--key", key, "--out", out}, tt.args...)...)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+			if _, err = os.Stat(out); err == nil {
+				t.Fatal("patch written")
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"go/format"
+	"go/token"
+)
+
+// Encodings of a public key for embedding; the key is in the form of
+// signing.PublicKeyFromFile.
+const (
+	formatPEM     = "pem"     // PKIX PEM, as written by keygen
+	formatRaw     = "raw"     // the key bytes
+	formatBase64  = "base64"  // the key bytes, base64 encoded
+	formatGo      = "go"      // a Go source file declaring a []byte variable
+	formatJSON    = "json"    // {"publicKey": "<base64>"}
+	formatLiteral = "literal" // a []byte composite literal
+)
+
+// goDecl names the variable and package of a formatGo key.
+type goDecl struct {
+	pkg, name string
+}
+
+// encodePublicKey encodes pub in format.
+func encodePublicKey(pub []byte, format string, decl goDecl) ([]byte, error) {
+	switch format {
+	case formatPEM:
+		der := pub
+		if len(pub) == ed25519.PublicKeySize {
+			var err error
+			if der, err = x509.MarshalPKIXPublicKey(ed25519.PublicKey(pub)); err != nil {
+				return nil, err
+			}
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+	case formatRaw:
+		return pub, nil
+	case formatBase64:
+		return []byte(base64.StdEncoding.EncodeToString(pub) + "\n"), nil
+	case formatJSON:
+		b, err := json.MarshalIndent(map[string]string{"publicKey": base64.StdEncoding.EncodeToString(pub)}, "", "  ")
+		return append(b, '\n'), err
+	case formatGo:
+		return goSource(pub, decl)
+	case formatLiteral:
+		return []byte(byteLiteral(pub) + "\n"), nil
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// goSource returns a Go source file declaring pub as the []byte variable
+// of decl.
+func goSource(pub []byte, decl goDecl) ([]byte, error) {
+	if !token.IsIdentifier(decl.pkg) || !token.IsIdentifier(decl.name) {
+		return nil, fmt.Errorf("invalid Go package %q or variable %q", decl.pkg, decl.name)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by gosafedate; DO NOT EDIT.\n\npackage %s\n\n", decl.pkg)
+	fmt.Fprintf(&b, "// %s is the public key releases are verified with.\n", decl.name)
+	fmt.Fprintf(&b, "var %s = %s\n", decl.name, byteLiteral(pub))
+	return format.Source(b.Bytes())
+}
+
+// byteLiteral returns the []byte composite literal of b.
+func byteLiteral(b []byte) string {
+	var s bytes.Buffer
+	s.WriteString("[]byte{")
+	for i, c := range b {
+		if i%12 == 0 {
+			s.WriteString("\n\t")
+		} else {
+			s.WriteString(" ")
+		}
+		fmt.Fprintf(&s, "0x%02x,", c)
+	}
+	s.WriteString("\n}")
+	return s.String()
+}
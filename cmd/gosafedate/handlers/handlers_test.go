@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/napalu/goopt/v2"
+	"github.com/napalu/gosafedate/cmd/gosafedate/config"
+	"github.com/napalu/gosafedate/signing"
+)
+
+// run runs a gosafedate command line as main does, and returns what it
+// printed and the error of the command.
+func run(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	cfg := &config.Config{}
+	p, err := goopt.NewParserFromStruct(cfg,
+		goopt.WithExecOnParseComplete(true),
+		goopt.WithFlagNameConverter(config.FlagNameConverter),
+		goopt.WithGlobalPreHook(RestoreStdin))
+	if err != nil {
+		t.Fatalf("parser: %v", err)
+	}
+	cfg.Check.Exec = HandleCheck
+	cfg.Update.Exec = HandleUpdate
+	cfg.Delta.Exec = HandleDelta
+	cfg.Release.Pack.Exec = HandleReleasePack
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("pipe: %v", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	out := make(chan string)
+	go func() {
+		var b bytes.Buffer
+		_, _ = io.Copy(&b, r)
+		out <- b.String()
+	}()
+	ok := p.Parse(args)
+	os.Stdout = stdout
+	_ = w.Close()
+	printed := <-out
+
+	if ok {
+		return printed, nil
+	}
+	for _, kv := range p.GetCommandExecutionErrors() {
+		if kv.Value != nil {
+			return printed, kv.Value
+		}
+	}
+	return printed, errors.Join(p.GetErrors()...)
+}
+
+// testKeys writes a key pair to dir and returns the paths of its private
+// and public key.
+func testKeys(t *testing.T, dir string) (priv, pub string) {
+	t.Helper()
+	priv, pub = filepath.Join(dir, "key"), filepath.Join(dir, "key.pub")
+	if err := signing.GenerateKeys(priv, pub); err != nil {
+		t.Fatalf("keys: %v", err)
+	}
+	return priv, pub
+}
+
+// pack packs the binary data as release version of a tool named after bin
+// into dir, signed with key, and returns the path of its metadata.json.
+func pack(t *testing.T, dir, key, bin, version string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), bin)
+	if err := os.WriteFile(path, data, 0o755); err != nil {
+		t.Fatalf("write binary: %v", err)
+	}
+	if _, err := run(t, "release", "pack", "--bin", path, "--version", version, "--key", key, "--out", dir); err != nil {
+		t.Fatalf("release pack: %v", err)
+	}
+	return filepath.Join(dir, metadataName)
+}
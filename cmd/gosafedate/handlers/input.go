@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/napalu/goopt/v2"
+	"github.com/napalu/gosafedate/cmd/gosafedate/config"
+)
+
+// Stdin stands in for a "-" argument, which goopt would take for a flag,
+// while the command line is parsed: main passes it instead, and RestoreStdin
+// turns it back into "-" before the command runs.
+const Stdin = "\x00-"
+
+// RestoreStdin is a goopt pre-hook replacing Stdin with "-" in the options,
+// so handlers and their errors see the arguments as given.
+func RestoreStdin(p *goopt.Parser, _ *goopt.Command) error {
+	cfg, ok := goopt.GetStructCtxAs[*config.Config](p)
+	if !ok {
+		return fmt.Errorf("failed to get options from context")
+	}
+	restoreStdin(reflect.ValueOf(cfg).Elem())
+	return nil
+}
+
+func restoreStdin(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := range v.NumField() {
+			if v.Type().Field(i).IsExported() {
+				restoreStdin(v.Field(i))
+			}
+		}
+	case reflect.Slice:
+		for i := range v.Len() {
+			restoreStdin(v.Index(i))
+		}
+	case reflect.String:
+		if v.String() == Stdin {
+			v.SetString("-")
+		}
+	}
+}
+
+// isStdin reports whether arg reads a message or file from stdin.
+func isStdin(arg string) bool {
+	return arg == "-"
+}
+
+// readMessage returns msg, or the message read from stdin if msg is "-",
+// without its trailing newline.
+func readMessage(msg string) (string, error) {
+	if !isStdin(msg) {
+		return msg, nil
+	}
+	b, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", err
+	}
+	s := strings.TrimSuffix(string(b), "\n")
+	return strings.TrimSuffix(s, "\r"), nil
+}
+
+// fileDigest returns the SHA-256 digest of the file at path, or of stdin
+// if path is "-", as signed by sign-file.
+func fileDigest(path string) (string, error) {
+	r := io.Reader(os.Stdin)
+	if !isStdin(path) {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return string(h.Sum(nil)), nil
+}
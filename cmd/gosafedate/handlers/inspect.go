@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/napalu/goopt/v2"
+	"github.com/napalu/gosafedate/cmd/gosafedate/config"
+	"github.com/napalu/gosafedate/metadata"
+	"github.com/napalu/gosafedate/self"
+	"github.com/napalu/gosafedate/signing"
+)
+
+// inspectTimeout bounds the metadata download of inspect.
+const inspectTimeout = time.Minute
+
+// Signature states of an inspected release.
+const (
+	sigValid     = "valid"
+	sigInvalid   = "invalid"
+	sigMissing   = "missing"
+	sigUnchecked = "unchecked" // no public key given
+)
+
+// releaseReport describes a release of an inspected metadata document.
+type releaseReport struct {
+	Version       string   `json:"version"`
+	Checksum      string   `json:"checksum"`
+	Size          int64    `json:"size,omitempty"`
+	DownloadURL   string   `json:"downloadUrl"` // resolved against the metadata URL
+	Signature     string   `json:"signature"`   // see sigValid
+	Error         string   `json:"error,omitempty"`
+	UnknownFields []string `json:"unknownFields,omitempty"`
+}
+
+// inspectReport describes a metadata document.
+type inspectReport struct {
+	URL           string          `json:"url"`
+	Releases      []releaseReport `json:"releases"`
+	UnknownFields []string        `json:"unknownFields,omitempty"` // of a feed
+}
+
+// HandleInspect prints the releases of a metadata document: their version,
+// checksum, resolved download URL, whether they are valid and signed, and
+// the fields the updater ignores, e.g. misspelled ones.
+func HandleInspect(p *goopt.Parser, _ *goopt.Command) error {
+	cfg, ok := goopt.GetStructCtxAs[*config.Config](p)
+	if !ok {
+		return fmt.Errorf("failed to get options from context")
+	}
+	opts := cfg.Inspect
+
+	var pub []byte
+	if opts.PubPath != "" {
+		var err error
+		if pub, err = signing.PublicKeyFromFile(opts.PubPath); err != nil {
+			return fmt.Errorf("inspect failed: %w", err)
+		}
+	}
+	metaURL, err := metadataURL(opts.Meta)
+	if err != nil {
+		return fmt.Errorf("inspect failed: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), inspectTimeout)
+	defer cancel()
+	rc, err := metadataSource(metaURL).FetchMetadata(ctx)
+	if err != nil {
+		return fmt.Errorf("inspect failed: %w", err)
+	}
+	data, err := io.ReadAll(rc)
+	_ = rc.Close()
+	if err != nil {
+		return fmt.Errorf("inspect failed: %w", err)
+	}
+
+	report, err := inspect(metaURL, data, pub)
+	if err != nil {
+		return fmt.Errorf("inspect failed: %w", err)
+	}
+
+	return printResult(cfg, report, func() { printReport(report) })
+}
+
+// inspect describes the releases of the metadata document data found at
+// metaURL, verifying their signatures with pub if set.
+func inspect(metaURL string, data []byte, pub []byte) (*inspectReport, error) {
+	report := &inspectReport{URL: metaURL}
+
+	var objs []map[string]json.RawMessage
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &objs); err != nil {
+			return nil, fmt.Errorf("parse metadata: %w", err)
+		}
+	} else {
+		var doc map[string]json.RawMessage
+		if err := json.Unmarshal(trimmed, &doc); err != nil {
+			return nil, fmt.Errorf("parse metadata: %w", err)
+		}
+		if releases, ok := doc["releases"]; ok {
+			if err := json.Unmarshal(releases, &objs); err != nil {
+				return nil, fmt.Errorf("parse metadata: %w", err)
+			}
+			report.UnknownFields = unknownFields(doc, reflect.TypeFor[metadata.Feed]())
+		} else {
+			objs = append(objs, doc)
+		}
+	}
+
+	sc := self.Config{URL: metaURL}
+	for _, obj := range objs {
+		raw, _ := json.Marshal(obj)
+		var (
+			m metadata.Metadata
+			r releaseReport
+		)
+		if err := json.Unmarshal(raw, &m); err != nil {
+			r.Error = err.Error()
+		} else if err = m.Validate(); err != nil {
+			r.Error = err.Error()
+		}
+		r.Version, r.Checksum, r.Size = m.Version, m.Checksum, m.Size
+		if u, err := self.DownloadURL(sc, &m); err == nil {
+			r.DownloadURL = u
+		}
+
+		switch {
+		case len(m.AllSignatures()) == 0:
+			r.Signature = sigMissing
+		case pub == nil:
+			r.Signature = sigUnchecked
+		default:
+			r.Signature = sigInvalid
+			if ok, _ := m.Verify(pub); ok {
+				r.Signature = sigValid
+			}
+		}
+		r.UnknownFields = unknownFields(obj, reflect.TypeFor[metadata.Metadata]())
+		report.Releases = append(report.Releases, r)
+	}
+	return report, nil
+}
+
+// unknownFields returns the sorted keys of obj which aren't JSON fields of
+// the struct type t. Like encoding/json, keys match case-insensitively.
+func unknownFields(obj map[string]json.RawMessage, t reflect.Type) []string {
+	known := map[string]bool{}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" {
+			name = f.Name
+		}
+		known[strings.ToLower(name)] = true
+	}
+
+	var unknown []string
+	for k := range obj {
+		if !known[strings.ToLower(k)] {
+			unknown = append(unknown, k)
+		}
+	}
+	slices.Sort(unknown)
+	return unknown
+}
+
+func printReport(report *inspectReport) {
+	fmt.Printf("metadata:       %s\n", report.URL)
+	if len(report.UnknownFields) > 0 {
+		fmt.Printf("unknown fields: %s\n", strings.Join(report.UnknownFields, ", "))
+	}
+	for _, r := range report.Releases {
+		fmt.Println()
+		fmt.Printf("version:        %s\n", r.Version)
+		fmt.Printf("checksum:       %s\n", r.Checksum)
+		if r.Size > 0 {
+			fmt.Printf("size:           %d\n", r.Size)
+		}
+		fmt.Printf("download URL:   %s\n", r.DownloadURL)
+		fmt.Printf("signature:      %s\n", r.Signature)
+		if r.Error != "" {
+			fmt.Printf("invalid:        %s\n", r.Error)
+		}
+		if len(r.UnknownFields) > 0 {
+			fmt.Printf("unknown fields: %s\n", strings.Join(r.UnknownFields, ", "))
+		}
+	}
+}
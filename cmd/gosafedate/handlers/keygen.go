@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
 
 	"github.com/napalu/goopt/v2"
@@ -9,20 +11,103 @@ import (
 	"github.com/napalu/gosafedate/signing"
 )
 
-// HandleKeygen creates an Ed25519 key pair.
+// keyFileSuffixes name the public key files of the formats of keygen.
+var keyFileSuffixes = map[string]string{
+	formatRaw:    ".pub.raw",
+	formatBase64: ".pub.b64",
+	formatJSON:   ".pub.json",
+	formatGo:     "_pubkey.go",
+}
+
+// HandleKeygen creates an Ed25519 key pair, and with --format a copy of
+// the public key ready to embed.
 func HandleKeygen(p *goopt.Parser, _ *goopt.Command) error {
 	cfg, ok := goopt.GetStructCtxAs[*config.Config](p)
 	if !ok {
 		return fmt.Errorf("failed to get options from context")
 	}
+	opts := cfg.Keygen
 
-	priv := cfg.Keygen.Prefix
-	pub := cfg.Keygen.Prefix + ".pub"
+	dir := opts.OutDir
+	if dir == "" {
+		dir = "."
+	}
+	priv := filepath.Join(dir, opts.Prefix)
+	pub := priv + ".pub"
+	files := []string{priv, pub}
+
+	var embedded string
+	if opts.Format != "" && opts.Format != formatPEM {
+		suffix, ok := keyFileSuffixes[opts.Format]
+		if !ok {
+			return fmt.Errorf("keygen failed: unknown format %q", opts.Format)
+		}
+		embedded = priv + suffix
+		files = append(files, embedded)
+	}
 
-	if err := signing.GenerateKeys(priv, pub); err != nil {
+	for _, f := range files {
+		if _, err := os.Stat(f); err == nil && !opts.Force {
+			return fmt.Errorf("keygen failed: %w: %s", signing.ErrKeysAlreadyExist, f)
+		}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return fmt.Errorf("keygen failed: %w", err)
 	}
+	if opts.Force {
+		for _, f := range files {
+			if err := os.Remove(f); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("keygen failed: %w", err)
+			}
+		}
+	}
 
-	fmt.Printf("✅ Generated key pair:\n  %s\n  %s\n", filepath.Base(priv), filepath.Base(pub))
-	return nil
+	var pass []byte
+	if opts.Encrypt {
+		var err error
+		if pass, err = newPassphrase(); err != nil {
+			return fmt.Errorf("keygen failed: %w", err)
+		}
+	}
+
+	if err := signing.GenerateEncryptedKeys(priv, pub, pass); err != nil {
+		return fmt.Errorf("keygen failed: %w", err)
+	}
+
+	if embedded != "" {
+		key, err := signing.PublicKeyFromFile(pub)
+		if err != nil {
+			return fmt.Errorf("keygen failed: %w", err)
+		}
+		b, err := encodePublicKey(key, opts.Format, goDecl{pkg: or(opts.GoPackage, "main"), name: or(opts.GoVar, "pubKey")})
+		if err != nil {
+			return fmt.Errorf("keygen failed: %w", err)
+		}
+		if err = os.WriteFile(embedded, b, 0o644); err != nil {
+			return fmt.Errorf("keygen failed: %w", err)
+		}
+	}
+
+	res := keygenResult{PrivateKey: priv, PublicKey: pub, Embedded: embedded}
+	return printResult(cfg, res, func() {
+		fmt.Println("✅ Generated key pair:")
+		for _, f := range files {
+			fmt.Printf("  %s\n", filepath.Base(f))
+		}
+	})
+}
+
+// keygenResult is the JSON result of keygen.
+type keygenResult struct {
+	PrivateKey string `json:"privateKey"`
+	PublicKey  string `json:"publicKey"`
+	Embedded   string `json:"embedded,omitempty"` // the public key in --format
+}
+
+// or returns s, or def if s is empty.
+func or(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
 }
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/napalu/goopt/v2"
+	"github.com/napalu/gosafedate/cmd/gosafedate/config"
+	"github.com/napalu/gosafedate/metadata"
+	"github.com/napalu/gosafedate/signing"
+)
+
+// HandleKeysRoot prints a key manifest listing the release keys, signed by
+// the root key.
+func HandleKeysRoot(p *goopt.Parser, _ *goopt.Command) error {
+	cfg, ok := goopt.GetStructCtxAs[*config.Config](p)
+	if !ok {
+		return fmt.Errorf("failed to get options from context")
+	}
+	opts := cfg.Keys.Root
+
+	keys := metadata.RootKeys{Version: opts.Version, Threshold: opts.Threshold}
+	if err := setExpiry(&keys, opts.Expires); err != nil {
+		return err
+	}
+	for _, path := range opts.Pubs {
+		if err := addKey(&keys, path); err != nil {
+			return err
+		}
+	}
+	if opts.Threshold > len(keys.Keys) {
+		return fmt.Errorf("threshold %d exceeds the %d release keys", opts.Threshold, len(keys.Keys))
+	}
+
+	signer, err := loadSigner(signerOptions{keyPath: opts.KeyPath})
+	if err != nil {
+		return fmt.Errorf("sign failed: %w", err)
+	}
+	defer closeSigner(signer)
+	b, err := signRoot(keys, signer)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+	return nil
+}
+
+// HandleKeysRotate generates a new key pair and writes a key manifest
+// listing the new key, signed by the current one. Binaries trusting the
+// current key as their root key (self.Config.RootKey) accept releases
+// signed by the new key once the manifest is published at their RootURL.
+func HandleKeysRotate(p *goopt.Parser, _ *goopt.Command) error {
+	cfg, ok := goopt.GetStructCtxAs[*config.Config](p)
+	if !ok {
+		return fmt.Errorf("failed to get options from context")
+	}
+	opts := cfg.Keys.Rotate
+
+	keys := metadata.RootKeys{Version: opts.Version}
+	if err := setExpiry(&keys, opts.Expires); err != nil {
+		return err
+	}
+	out := opts.Out
+	if out == "" {
+		out = "root.json"
+	}
+
+	// load the current key before creating files
+	signer, err := loadSigner(signerOptions{keyPath: opts.OldPath})
+	if err != nil {
+		return fmt.Errorf("rotate failed: %w", err)
+	}
+	defer closeSigner(signer)
+
+	priv, pub := opts.NewPrefix, opts.NewPrefix+".pub"
+	var pass []byte
+	if opts.Encrypt {
+		if pass, err = newPassphrase(); err != nil {
+			return fmt.Errorf("rotate failed: %w", err)
+		}
+	}
+	if err = signing.GenerateEncryptedKeys(priv, pub, pass); err != nil {
+		return fmt.Errorf("rotate failed: %w", err)
+	}
+
+	if err = addKey(&keys, pub); err != nil {
+		return err
+	}
+	if opts.KeepOld {
+		old, err := embeddedKey(signer.PublicKey())
+		if err != nil {
+			return fmt.Errorf("rotate failed: %w", err)
+		}
+		keys.Keys = append(keys.Keys, base64.StdEncoding.EncodeToString(old))
+	}
+
+	b, err := signRoot(keys, signer)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(out, append(b, '\n'), 0o644); err != nil {
+		return fmt.Errorf("rotate failed: %w", err)
+	}
+
+	res := rotateResult{PrivateKey: priv, PublicKey: pub, Manifest: out, Version: keys.Version}
+	return printResult(cfg, res, func() {
+		fmt.Printf("✅ Generated key pair:\n  %s\n  %s\n", filepath.Base(priv), filepath.Base(pub))
+		fmt.Printf("✅ Key manifest version %d signed by %s:\n  %s\n", keys.Version, filepath.Base(opts.OldPath), out)
+	})
+}
+
+// rotateResult is the JSON result of keys rotate.
+type rotateResult struct {
+	PrivateKey string `json:"privateKey"`
+	PublicKey  string `json:"publicKey"`
+	Manifest   string `json:"manifest"`
+	Version    int    `json:"version"`
+}
+
+// setExpiry sets the expiry of keys to the date expires, if set.
+func setExpiry(keys *metadata.RootKeys, expires string) error {
+	if expires == "" {
+		return nil
+	}
+	t, err := time.Parse(time.DateOnly, expires)
+	if err != nil {
+		return fmt.Errorf("invalid expiry date: %w", err)
+	}
+	keys.Expires = t
+	return nil
+}
+
+// addKey adds the public key at path to keys.
+func addKey(keys *metadata.RootKeys, path string) error {
+	pub, err := signing.PublicKeyFromFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read pubkey: %w", err)
+	}
+	keys.Keys = append(keys.Keys, base64.StdEncoding.EncodeToString(pub))
+	return nil
+}
+
+// embeddedKey encodes pub as signing.PublicKeyFromFile does.
+func embeddedKey(pub crypto.PublicKey) ([]byte, error) {
+	if k, ok := pub.(ed25519.PublicKey); ok {
+		return k, nil
+	}
+	return x509.MarshalPKIXPublicKey(pub)
+}
+
+// signRoot returns the indented key manifest of keys signed by signer.
+func signRoot(keys metadata.RootKeys, signer signing.Signer) ([]byte, error) {
+	signed, err := json.Marshal(keys)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := signing.SignWith(signer, string(signed))
+	if err != nil {
+		return nil, fmt.Errorf("sign failed: %w", err)
+	}
+
+	return json.MarshalIndent(metadata.Root{Signed: signed, Signatures: []string{sig}}, "", "  ")
+}
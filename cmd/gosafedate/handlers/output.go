@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/napalu/gosafedate/cmd/gosafedate/config"
+	"github.com/napalu/gosafedate/self"
+)
+
+// Exit codes of failed commands.
+const (
+	ExitError   = 1 // the command failed, e.g. a file couldn't be read
+	ExitInvalid = 2 // a signature, checksum or size doesn't verify
+)
+
+// ErrInvalidSignature is returned when a signature doesn't verify.
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// invalidErrors are the verification failures of ExitInvalid.
+var invalidErrors = []error{
+	ErrInvalidSignature,
+	self.ErrChecksumMismatch,
+	self.ErrSizeMismatch,
+	self.ErrInsufficientSignatures,
+	self.ErrTampered,
+	self.ErrNotLogged,
+}
+
+// ExitCode returns the exit code of a command failing with err.
+func ExitCode(err error) int {
+	for _, target := range invalidErrors {
+		if errors.Is(err, target) {
+			return ExitInvalid
+		}
+	}
+	return ExitError
+}
+
+// printResult prints the result of a command: v as JSON with --json,
+// otherwise the text printed by text.
+func printResult(cfg *config.Config, v any, text func()) error {
+	if !cfg.JSON {
+		text()
+		return nil
+	}
+	return printJSON(v)
+}
+
+func printJSON(v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+	return nil
+}
+
+// fileList collects the files a command writes or uploads: printed one per
+// line as they come, or as {"files": [...]} once done with --json.
+type fileList struct {
+	json  bool
+	Files []string `json:"files"`
+}
+
+func (l *fileList) add(name string) {
+	l.Files = append(l.Files, name)
+	if !l.json {
+		fmt.Println(name)
+	}
+}
+
+func (l *fileList) done() error {
+	if !l.json {
+		return nil
+	}
+	return printJSON(l)
+}
+
+// printSignature prints the result of the sign commands.
+func printSignature(cfg *config.Config, sig string) error {
+	return printResult(cfg, map[string]string{"signature": sig}, func() { fmt.Println(sig) })
+}
+
+// printValid prints the result of the verify commands, which fail unless
+// the signature is valid.
+func printValid(cfg *config.Config) error {
+	return printResult(cfg, map[string]bool{"valid": true}, func() { fmt.Println("valid signature") })
+}
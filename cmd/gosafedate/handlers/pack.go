@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/napalu/goopt/v2"
+	"github.com/napalu/gosafedate/cmd/gosafedate/config"
+	"github.com/napalu/gosafedate/metadata"
+	"github.com/napalu/gosafedate/signing"
+)
+
+// Names of the documents written to the output directory: metadata.json
+// for a single binary, fleet.json for the binaries of several platforms.
+const (
+	metadataName = "metadata.json"
+	fleetName    = "fleet.json"
+)
+
+// packTarget is a binary to release, for platform "GOOS/GOARCH" or, if
+// empty, for any platform.
+type packTarget struct {
+	platform string
+	path     string
+}
+
+// HandleReleasePack gzips a binary as <name>-<version>.gz, signs it and
+// writes metadata.json, adding the release to it if it is a feed. The
+// binaries of several platforms are packed as
+// <name>-<version>-<goos>-<goarch>.gz and described by the tool of the same
+// name in fleet.json.
+func HandleReleasePack(p *goopt.Parser, _ *goopt.Command) error {
+	cfg, ok := goopt.GetStructCtxAs[*config.Config](p)
+	if !ok {
+		return fmt.Errorf("failed to get options from context")
+	}
+	opts := cfg.Release.Pack
+
+	targets, err := packTargets(opts.Bins, opts.Dist)
+	if err != nil {
+		return fmt.Errorf("pack failed: %w", err)
+	}
+
+	out := opts.Out
+	if out == "" {
+		out = "."
+	}
+	if err = os.MkdirAll(out, 0o755); err != nil {
+		return fmt.Errorf("pack failed: %w", err)
+	}
+
+	signer, err := loadSigner(signerFlags(opts.Signer))
+	if err != nil {
+		return fmt.Errorf("pack failed: %w", err)
+	}
+	defer closeSigner(signer)
+
+	files := &fileList{json: cfg.JSON}
+	pack := func(bin, name string) (*metadata.Metadata, error) {
+		artifact := filepath.Join(out, name)
+		if err := gzipFile(bin, artifact); err != nil {
+			return nil, err
+		}
+		files.add(artifact)
+		return metadata.GenerateWith(artifact, opts.Version, signer, metadata.GenerateOptions{
+			BaseURL:    opts.BaseURL,
+			Algorithm:  opts.Algorithm,
+			BinaryPath: bin,
+		})
+	}
+
+	if len(targets) == 1 && targets[0].platform == "" {
+		m, err := pack(targets[0].path, toolName(targets[0].path)+"-"+opts.Version+".gz")
+		if err != nil {
+			return fmt.Errorf("pack failed: %w", err)
+		}
+		metaPath := filepath.Join(out, metadataName)
+		if err = addRelease(metaPath, m); err != nil {
+			return fmt.Errorf("pack failed: %w", err)
+		}
+		files.add(metaPath)
+		return files.done()
+	}
+
+	tool := metadata.FleetTool{Name: opts.Name, Platforms: map[string]metadata.Metadata{}}
+	for _, t := range targets {
+		name := toolName(t.path)
+		switch {
+		case opts.Name != "":
+		case tool.Name == "":
+			tool.Name = name
+		case tool.Name != name:
+			return fmt.Errorf("pack failed: binaries of several tools (%s, %s): set --name", tool.Name, name)
+		}
+	}
+	for _, t := range targets {
+		name := tool.Name + "-" + opts.Version + "-" + strings.ReplaceAll(t.platform, "/", "-") + ".gz"
+		m, err := pack(t.path, name)
+		if err != nil {
+			return fmt.Errorf("pack failed: %s: %w", t.platform, err)
+		}
+		tool.Platforms[t.platform] = *m
+	}
+	fleetPath := filepath.Join(out, fleetName)
+	if err = addTool(fleetPath, tool, signer); err != nil {
+		return fmt.Errorf("pack failed: %w", err)
+	}
+	files.add(fleetPath)
+	return files.done()
+}
+
+// toolName returns the name of a binary without the ".exe" suffix, which
+// names its artifacts and fleet tool.
+func toolName(bin string) string {
+	return strings.TrimSuffix(filepath.Base(bin), ".exe")
+}
+
+// packTargets returns the binaries given as paths or GOOS/GOARCH=path, or
+// those of a goreleaser dist directory.
+func packTargets(bins []string, dist string) ([]packTarget, error) {
+	switch {
+	case dist != "" && len(bins) > 0:
+		return nil, errors.New("--bin and --dist are mutually exclusive")
+	case dist != "":
+		return goreleaserBinaries(dist)
+	case len(bins) == 0:
+		return nil, errors.New("--bin or --dist is required")
+	}
+
+	var targets []packTarget
+	for _, b := range bins {
+		platform, path, ok := strings.Cut(b, "=")
+		if !ok {
+			platform, path = "", b
+		}
+		if ok && !validPlatform(platform) {
+			return nil, fmt.Errorf("invalid platform %q: expected GOOS/GOARCH", platform)
+		}
+		if !ok && len(bins) > 1 {
+			return nil, fmt.Errorf("%s: several binaries must be given as GOOS/GOARCH=path", b)
+		}
+		if slices.ContainsFunc(targets, func(t packTarget) bool { return ok && t.platform == platform }) {
+			return nil, fmt.Errorf("duplicate platform %s", platform)
+		}
+		targets = append(targets, packTarget{platform: platform, path: path})
+	}
+	return targets, nil
+}
+
+func validPlatform(platform string) bool {
+	goos, goarch, ok := strings.Cut(platform, "/")
+	return ok && goos != "" && goarch != "" && !strings.Contains(goarch, "/")
+}
+
+// goreleaserBinaries returns the binaries listed by the artifacts.json of a
+// goreleaser dist directory.
+func goreleaserBinaries(dist string) ([]packTarget, error) {
+	data, err := os.ReadFile(filepath.Join(dist, "artifacts.json"))
+	if err != nil {
+		return nil, err
+	}
+	var artifacts []struct {
+		Path   string `json:"path"`
+		Goos   string `json:"goos"`
+		Goarch string `json:"goarch"`
+		Type   string `json:"type"`
+	}
+	if err = json.Unmarshal(data, &artifacts); err != nil {
+		return nil, fmt.Errorf("parse artifacts.json: %w", err)
+	}
+
+	var targets []packTarget
+	for _, a := range artifacts {
+		if a.Type != "Binary" {
+			continue
+		}
+		t := packTarget{platform: a.Goos + "/" + a.Goarch, path: a.Path}
+		if slices.ContainsFunc(targets, func(o packTarget) bool { return o.platform == t.platform }) {
+			return nil, fmt.Errorf("duplicate platform %s in artifacts.json", t.platform)
+		}
+		// paths are relative to the project goreleaser ran in, the parent
+		// of dist by default
+		if _, err = os.Stat(t.path); err != nil && !filepath.IsAbs(t.path) {
+			t.path = filepath.Join(filepath.Dir(filepath.Clean(dist)), t.path)
+		}
+		targets = append(targets, t)
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no binaries in %s", filepath.Join(dist, "artifacts.json"))
+	}
+	return targets, nil
+}
+
+// addTool writes tool to the fleet at path, replacing a tool of the same
+// name, and signs the fleet with signer. A file which isn't a fleet is
+// overwritten.
+func addTool(path string, tool metadata.FleetTool, signer signing.Signer) error {
+	var fleet metadata.Fleet
+	if data, err := os.ReadFile(path); err == nil {
+		if json.Unmarshal(data, &fleet) != nil {
+			fleet = metadata.Fleet{}
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	fleet.Tools = slices.DeleteFunc(fleet.Tools, func(t metadata.FleetTool) bool {
+		return t.Name == tool.Name
+	})
+	fleet.Tools = append(fleet.Tools, tool)
+	fleet.Signatures = nil
+	if err := fleet.Sign(signer); err != nil {
+		return err
+	}
+	return writeJSON(path, fleet)
+}
+
+func gzipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	zw, err := gzip.NewWriterLevel(out, gzip.BestCompression)
+	if err != nil {
+		_ = out.Close()
+		return err
+	}
+	zw.Name = filepath.Base(src)
+	if _, err = io.Copy(zw, in); err == nil {
+		err = zw.Close()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(dst)
+	}
+	return err
+}
+
+// addRelease writes m to path. If path holds a feed, m is added to its
+// releases, replacing a release of the same version; otherwise path is
+// overwritten.
+func addRelease(path string, m *metadata.Metadata) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return writeJSON(path, m)
+	}
+	if err != nil {
+		return err
+	}
+
+	feed, ok := parseFeed(data)
+	if !ok {
+		return writeJSON(path, m)
+	}
+	feed.Releases = slices.DeleteFunc(feed.Releases, func(r metadata.Metadata) bool {
+		return r.Version == m.Version
+	})
+	feed.Releases = append(feed.Releases, *m)
+	if err = metadata.Sort(feed.Releases); err != nil {
+		return err
+	}
+	return writeJSON(path, feed)
+}
+
+// parseFeed parses data as a metadata.Feed or an array of releases.
+func parseFeed(data []byte) (*metadata.Feed, bool) {
+	var feed metadata.Feed
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		return &feed, json.Unmarshal(trimmed, &feed.Releases) == nil
+	}
+	var doc struct {
+		metadata.Feed
+		Releases *[]metadata.Metadata `json:"releases"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil || doc.Releases == nil {
+		return nil, false
+	}
+	feed.SchemaVersion, feed.Releases = doc.SchemaVersion, *doc.Releases
+	return &feed, true
+}
+
+func writeJSON(path string, v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
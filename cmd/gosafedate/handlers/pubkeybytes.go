@@ -2,31 +2,72 @@ package handlers
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"strings"
 
 	"github.com/napalu/goopt/v2"
 	"github.com/napalu/gosafedate/cmd/gosafedate/config"
 	"github.com/napalu/gosafedate/signing"
 )
 
-// HandlePubKeyBytes prints the []byte{} literal for embedding.
+// HandlePubKeyBytes prints the public key for embedding, by default as a
+// []byte{} literal, or writes it to a file, e.g. a complete Go source file.
 func HandlePubKeyBytes(p *goopt.Parser, _ *goopt.Command) error {
 	cfg, ok := goopt.GetStructCtxAs[*config.Config](p)
 	if !ok {
 		return fmt.Errorf("failed to get options from context")
 	}
+	opts := cfg.PubBytes
 
-	data, err := signing.PublicKeyFromFile(cfg.PubBytes.PubPath)
+	var (
+		data []byte
+		err  error
+	)
+	if isStdin(opts.PubPath) {
+		data, err = readStdinKey()
+	} else {
+		data, err = signing.PublicKeyFromFile(opts.PubPath)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to read pubkey: %w", err)
 	}
 
-	fmt.Print("[]byte{")
-	for i, b := range data {
-		if i > 0 {
-			fmt.Print(", ")
-		}
-		fmt.Printf("0x%02x", b)
-	}
-	fmt.Println("}")
-	return nil
+	format := opts.Format
+	switch {
+	case format != "":
+	case strings.HasSuffix(opts.Out, ".go"):
+		format = formatGo
+	case cfg.JSON:
+		format = formatJSON
+	default:
+		format = formatLiteral
+	}
+	b, err := encodePublicKey(data, format, goDecl{pkg: or(opts.Package, "main"), name: or(opts.Var, "pubKey")})
+	if err != nil {
+		return fmt.Errorf("failed to encode pubkey: %w", err)
+	}
+
+	if opts.Out == "" {
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+	if err = os.WriteFile(opts.Out, b, 0o644); err != nil {
+		return fmt.Errorf("failed to write pubkey: %w", err)
+	}
+	return printResult(cfg, map[string]string{"file": opts.Out}, func() {})
+}
+
+// readStdinKey reads a public key in any form accepted by
+// signing.ParsePublicKey from stdin and returns its embedded form.
+func readStdinKey() ([]byte, error) {
+	b, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := signing.ParsePublicKey([]byte(strings.TrimSpace(string(b))))
+	if err != nil {
+		return nil, err
+	}
+	return embeddedKey(pub)
 }
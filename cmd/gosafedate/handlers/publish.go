@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/napalu/goopt/v2"
+	"github.com/napalu/gosafedate/cmd/gosafedate/config"
+	"github.com/napalu/gosafedate/metadata"
+	"github.com/napalu/gosafedate/self/source/github"
+	"github.com/napalu/gosafedate/self/source/objstore"
+)
+
+// publishTimeout bounds the uploads of a release.
+const publishTimeout = 30 * time.Minute
+
+// sidecarSuffixes are the detached signatures published next to artifacts.
+var sidecarSuffixes = []string{".sig", ".minisig", ".sigstore.json"}
+
+// upload stores data under name at the destination.
+type upload func(ctx context.Context, name string, data []byte) error
+
+// HandleReleasePublish uploads the artifacts of a release packed into a
+// directory, their patches and detached signatures, and then metadata.json
+// and fleet.json, so the published metadata never refers to missing files.
+func HandleReleasePublish(p *goopt.Parser, _ *goopt.Command) error {
+	cfg, ok := goopt.GetStructCtxAs[*config.Config](p)
+	if !ok {
+		return fmt.Errorf("failed to get options from context")
+	}
+	opts := cfg.Release.Publish
+
+	dir := opts.Dir
+	if dir == "" {
+		dir = "."
+	}
+	releases, docs, err := publishedReleases(dir, opts.Version)
+	if err != nil {
+		return fmt.Errorf("publish failed: %w", err)
+	}
+
+	toGitHub := strings.HasPrefix(opts.To, "github://")
+	var files []string
+	for _, m := range releases {
+		names := []string{m.DownloadURL}
+		for _, patch := range m.Patches {
+			names = append(names, patch.DownloadURL)
+		}
+		for _, n := range names {
+			name, err := localName(dir, n)
+			if err != nil {
+				return fmt.Errorf("publish failed: %w", err)
+			}
+			files = append(files, name)
+			for _, suffix := range sidecarSuffixes {
+				if _, err = os.Stat(filepath.Join(dir, name+suffix)); err == nil && !(toGitHub && suffix == ".sig") {
+					files = append(files, name+suffix)
+				}
+			}
+		}
+	}
+
+	put, err := newUpload(opts.To, opts.Tag, opts.S3Endpoint, opts.GitHubURL, releases)
+	if err != nil {
+		return fmt.Errorf("publish failed: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	uploaded := &fileList{json: cfg.JSON}
+
+	for _, name := range slices.Compact(files) {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("publish failed: %w", err)
+		}
+		if err = put(ctx, name, data); err != nil {
+			return fmt.Errorf("publish failed: %w", err)
+		}
+		uploaded.add(name)
+	}
+	if toGitHub {
+		// the github source reads the checksum and signature from ".sig"
+		for _, m := range releases {
+			name, _ := localName(dir, m.DownloadURL)
+			if m.Signature == "" {
+				continue
+			}
+			if err = put(ctx, name+".sig", github.Sidecar(&m)); err != nil {
+				return fmt.Errorf("publish failed: %w", err)
+			}
+			uploaded.add(name + ".sig")
+		}
+	}
+	for _, doc := range docs {
+		data, err := os.ReadFile(filepath.Join(dir, doc))
+		if err != nil {
+			return fmt.Errorf("publish failed: %w", err)
+		}
+		if err = put(ctx, doc, data); err != nil {
+			return fmt.Errorf("publish failed: %w", err)
+		}
+		uploaded.add(doc)
+	}
+	return uploaded.done()
+}
+
+// publishedReleases returns the releases of version in dir/metadata.json,
+// or its latest release, and those of dir/fleet.json, along with the names
+// of these documents.
+func publishedReleases(dir, version string) ([]metadata.Metadata, []string, error) {
+	var (
+		releases []metadata.Metadata
+		docs     []string
+	)
+
+	if f, err := os.Open(filepath.Join(dir, metadataName)); err == nil {
+		all, err := metadata.Decode(f)
+		_ = f.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", metadataName, err)
+		}
+		if version == "" {
+			latest, err := metadata.Latest(all)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", metadataName, err)
+			}
+			version = latest.Version
+		}
+		for _, m := range all {
+			if m.Version == version {
+				releases = append(releases, m)
+			}
+		}
+		if len(releases) == 0 {
+			return nil, nil, fmt.Errorf("%s has no release %s", metadataName, version)
+		}
+		docs = append(docs, metadataName)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, err
+	}
+
+	if data, err := os.ReadFile(filepath.Join(dir, fleetName)); err == nil {
+		var fleet metadata.Fleet
+		if err = json.Unmarshal(data, &fleet); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", fleetName, err)
+		}
+		for _, tool := range fleet.Tools {
+			platforms := make([]string, 0, len(tool.Platforms))
+			for platform := range tool.Platforms {
+				platforms = append(platforms, platform)
+			}
+			slices.Sort(platforms)
+			for _, platform := range platforms {
+				releases = append(releases, tool.Platforms[platform])
+			}
+		}
+		docs = append(docs, fleetName)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, err
+	}
+
+	if len(docs) == 0 {
+		return nil, nil, fmt.Errorf("neither %s nor %s found in %s", metadataName, fleetName, dir)
+	}
+	return releases, docs, nil
+}
+
+// localName returns the name in dir of the file published at downloadURL:
+// the URL itself if relative, otherwise its base name.
+func localName(dir, downloadURL string) (string, error) {
+	u, err := url.Parse(downloadURL)
+	if err != nil {
+		return "", err
+	}
+	name := downloadURL
+	if u.IsAbs() {
+		name = path.Base(u.Path)
+	}
+	if !filepath.IsLocal(filepath.FromSlash(name)) {
+		return "", fmt.Errorf("download URL %q is outside %s", downloadURL, dir)
+	}
+	if _, err = os.Stat(filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// newUpload returns the upload to destination to. Releases are attached to
+// the GitHub release tagged with their version, unless tag is set.
+func newUpload(to, tag, s3Endpoint, githubURL string, releases []metadata.Metadata) (upload, error) {
+	if rest, ok := strings.CutPrefix(to, "github://"); ok {
+		owner, repo, _ := strings.Cut(rest, "/")
+		if owner == "" || repo == "" || strings.Contains(repo, "/") {
+			return nil, fmt.Errorf("invalid destination %q: expected github://owner/repo", to)
+		}
+		if tag == "" && len(releases) > 0 {
+			tag = releases[0].Version
+		}
+		if tag == "" {
+			return nil, errors.New("--tag is required")
+		}
+		src := &github.Source{Owner: owner, Repo: repo, Token: firstEnv("GITHUB_TOKEN", "GH_TOKEN"), BaseURL: githubURL}
+		if src.Token == "" {
+			return nil, errors.New("GITHUB_TOKEN is required")
+		}
+		return func(ctx context.Context, name string, data []byte) error {
+			return src.UploadAsset(ctx, tag, path.Base(name), data, contentType(name))
+		}, nil
+	}
+
+	u, err := url.Parse(to)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "s3", "gs", "az":
+	default:
+		return nil, fmt.Errorf("invalid destination %q: expected s3://, gs://, az:// or github://", to)
+	}
+	prefix := strings.TrimSuffix(to, "/") + "/"
+	src := &objstore.Source{S3Endpoint: s3Endpoint}
+	return func(ctx context.Context, name string, data []byte) error {
+		return src.Put(ctx, prefix+name, data, contentType(name))
+	}, nil
+}
+
+func contentType(name string) string {
+	switch {
+	case strings.HasSuffix(name, ".json"):
+		return "application/json"
+	case strings.HasSuffix(name, ".sig"), strings.HasSuffix(name, ".minisig"):
+		return "text/plain"
+	}
+	return "application/octet-stream"
+}
+
+func firstEnv(names ...string) string {
+	for _, n := range names {
+		if v := os.Getenv(n); v != "" {
+			return v
+		}
+	}
+	return ""
+}
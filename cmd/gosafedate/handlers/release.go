@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/napalu/goopt/v2"
+	"github.com/napalu/gosafedate/cmd/gosafedate/config"
+	"github.com/napalu/gosafedate/metadata"
+	"github.com/napalu/gosafedate/self/sigstore"
+	"github.com/napalu/gosafedate/signing"
+)
+
+// rekorTimeout bounds the round trips to Rekor.
+const rekorTimeout = time.Minute
+
+// HandleReleaseAttest logs the signature of a metadata file in Rekor and
+// records the entry in the file.
+func HandleReleaseAttest(p *goopt.Parser, _ *goopt.Command) error {
+	cfg, ok := goopt.GetStructCtxAs[*config.Config](p)
+	if !ok {
+		return fmt.Errorf("failed to get options from context")
+	}
+	opts := cfg.Release.Attest
+
+	b, err := os.ReadFile(opts.Metadata)
+	if err != nil {
+		return fmt.Errorf("attest failed: %w", err)
+	}
+	var m metadata.Metadata
+	if err = json.Unmarshal(b, &m); err != nil {
+		return fmt.Errorf("attest failed: parse metadata: %w", err)
+	}
+	if m.Signature == "" {
+		return fmt.Errorf("attest failed: metadata has no signature")
+	}
+
+	pub, err := signing.PublicKeyFromFile(opts.PubPath)
+	if err != nil {
+		return fmt.Errorf("attest failed: %w", err)
+	}
+	if ok, err = signing.VerifyRaw(pub, m.SigningMessage(), m.Signature); err != nil || !ok {
+		return fmt.Errorf("attest failed: signature does not verify with %s", opts.PubPath)
+	}
+
+	rekorURL := opts.RekorURL
+	if rekorURL == "" {
+		rekorURL = sigstore.DefaultRekorURL
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), rekorTimeout)
+	defer cancel()
+	if m.TransparencyLog, err = sigstore.Attest(ctx, rekorURL, &m, pub); err != nil {
+		return fmt.Errorf("attest failed: %w", err)
+	}
+
+	if b, err = json.MarshalIndent(m, "", "  "); err != nil {
+		return fmt.Errorf("attest failed: %w", err)
+	}
+	if err = os.WriteFile(opts.Metadata, append(b, '\n'), 0o644); err != nil {
+		return fmt.Errorf("attest failed: %w", err)
+	}
+
+	return printResult(cfg, map[string]int64{"logIndex": m.TransparencyLog.LogIndex}, func() {
+		fmt.Printf("logged at index %d\n", m.TransparencyLog.LogIndex)
+	})
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"runtime"
+
+	"github.com/napalu/goopt/v2"
+	"github.com/napalu/gosafedate/cmd/gosafedate/config"
+	"github.com/napalu/gosafedate/self"
+	"github.com/napalu/gosafedate/self/source/github"
+	"github.com/napalu/gosafedate/version"
+)
+
+// releasePublicKey is the base64 DER public key the gosafedate releases are
+// signed with, set at build time, see the Makefile:
+//
+//	-ldflags "-X github.com/napalu/gosafedate/cmd/gosafedate/handlers.releasePublicKey=MCowBQYDK2VwAyEA..."
+var releasePublicKey string
+
+// HandleSelfUpdate updates the running gosafedate from the GitHub releases
+// of the project, published by "release pack" and "release publish" as
+// gosafedate-<version>-<goos>-<goarch>.gz assets with ".sig" sidecars.
+func HandleSelfUpdate(p *goopt.Parser, _ *goopt.Command) error {
+	cfg, ok := goopt.GetStructCtxAs[*config.Config](p)
+	if !ok {
+		return fmt.Errorf("failed to get options from context")
+	}
+	opts := cfg.SelfUpdate
+
+	if releasePublicKey == "" {
+		return errors.New("self-update failed: this build has no release key, reinstall gosafedate from a release")
+	}
+	pub, err := base64.StdEncoding.DecodeString(releasePublicKey)
+	if err != nil {
+		return fmt.Errorf("self-update failed: invalid release key: %w", err)
+	}
+
+	current := version.Version
+	if current == "" || current == "dev" {
+		current = version.FromBuildInfo()
+	}
+
+	sc := self.Config{
+		Source: &github.Source{
+			Owner:        "napalu",
+			Repo:         "gosafedate",
+			AssetPattern: fmt.Sprintf("gosafedate-*-%s-%s.gz", runtime.GOOS, runtime.GOARCH),
+			Prerelease:   opts.Prerelease,
+			Token:        firstEnv("GITHUB_TOKEN", "GH_TOKEN"),
+		},
+		PubKey:          pub,
+		CurrentVer:      current,
+		AllowPrerelease: opts.Prerelease,
+		LogInfo:         func(string, ...any) {},
+		LogError:        func(string, ...any) {},
+	}
+	newer, m, err := self.HasNewer(sc)
+	if err != nil {
+		return fmt.Errorf("self-update failed: %w", err)
+	}
+	res := updateResult{Current: current, Available: newer}
+	if m != nil {
+		res.Version = m.Version
+	}
+	if newer && !opts.Check {
+		if err = self.UpdateFromMetadata(sc, m); err != nil {
+			return fmt.Errorf("self-update failed: %w", err)
+		}
+		res.Updated = true
+	}
+	return printResult(cfg, res, func() {
+		switch {
+		case res.Updated:
+			fmt.Printf("gosafedate updated to %s\n", res.Version)
+		case res.Available:
+			fmt.Printf("gosafedate %s is available (installed: %s)\n", res.Version, res.Current)
+		default:
+			fmt.Printf("gosafedate %s is up to date\n", res.Current)
+		}
+	})
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/napalu/goopt/v2"
+	"github.com/napalu/gosafedate/checksum"
+	"github.com/napalu/gosafedate/cmd/gosafedate/config"
+	"github.com/napalu/gosafedate/metadata"
+	"github.com/napalu/gosafedate/signing"
+)
+
+// watchInterval is how often serve looks for changed artifacts.
+const watchInterval = time.Second
+
+// HandleServe serves a release directory over HTTP, without caching, to
+// test the update flow locally. With --key, the releases of metadata.json
+// whose artifact changed since it was written are regenerated and signed
+// again, so rebuilt artifacts can be served without packing them.
+func HandleServe(p *goopt.Parser, _ *goopt.Command) error {
+	cfg, ok := goopt.GetStructCtxAs[*config.Config](p)
+	if !ok {
+		return fmt.Errorf("failed to get options from context")
+	}
+	opts := cfg.Serve
+
+	dir, addr := opts.Dir, opts.Addr
+	if dir == "" {
+		dir = "."
+	}
+	if addr == "" {
+		addr = ":8080"
+	}
+
+	if opts.KeyPath != "" {
+		signer, err := loadSigner(signerOptions{keyPath: opts.KeyPath})
+		if err != nil {
+			return fmt.Errorf("serve failed: %w", err)
+		}
+		defer closeSigner(signer)
+		go watchReleases(dir, signer)
+	}
+
+	files := http.FileServer(http.Dir(dir))
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s", r.Method, r.URL.Path)
+		w.Header().Set("Cache-Control", "no-store")
+		files.ServeHTTP(w, r)
+	})
+
+	err := printResult(cfg, map[string]string{"dir": dir, "addr": addr}, func() {
+		fmt.Printf("serving %s on %s\n", dir, addr)
+	})
+	if err != nil {
+		return fmt.Errorf("serve failed: %w", err)
+	}
+	if err = http.ListenAndServe(addr, handler); err != nil {
+		return fmt.Errorf("serve failed: %w", err)
+	}
+	return nil
+}
+
+// watchReleases re-signs the releases of dir/metadata.json whose artifact
+// changes.
+func watchReleases(dir string, signer signing.Signer) {
+	for range time.Tick(watchInterval) {
+		if err := refreshReleases(dir, signer); err != nil {
+			log.Printf("failed to refresh %s: %v", metadataName, err)
+		}
+	}
+}
+
+// refreshReleases regenerates and signs the releases of dir/metadata.json
+// whose local artifact is newer than the document.
+func refreshReleases(dir string, signer signing.Signer) error {
+	path := filepath.Join(dir, metadataName)
+	fi, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	feed, isFeed := parseFeed(data)
+	if !isFeed {
+		var m metadata.Metadata
+		if err = json.Unmarshal(data, &m); err != nil {
+			return err
+		}
+		feed = &metadata.Feed{Releases: []metadata.Metadata{m}}
+	}
+
+	changed := false
+	for i := range feed.Releases {
+		m := &feed.Releases[i]
+		name, err := localName(dir, m.DownloadURL)
+		if err != nil {
+			continue // not served from dir
+		}
+		artifact := filepath.Join(dir, filepath.FromSlash(name))
+		if ai, err := os.Stat(artifact); err != nil || !ai.ModTime().After(fi.ModTime()) {
+			continue
+		}
+		if err = regenerate(m, artifact, signer); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		log.Printf("re-signed %s for %s", m.Version, name)
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	if isFeed {
+		return writeJSON(path, feed)
+	}
+	return writeJSON(path, feed.Releases[0])
+}
+
+// regenerate updates the checksums and size of m for artifact and signs it
+// again with signer. The other fields of m are kept.
+func regenerate(m *metadata.Metadata, artifact string, signer signing.Signer) error {
+	alg, err := checksum.Algorithm(m.Checksum)
+	if err != nil {
+		return err
+	}
+	g, err := metadata.GenerateWith(artifact, m.Version, nil, metadata.GenerateOptions{Algorithm: alg})
+	if err != nil {
+		return err
+	}
+	m.Checksum, m.ChecksumCompressed, m.Size = g.Checksum, g.ChecksumCompressed, g.Size
+	m.Signature, m.Signatures, m.TransparencyLog = "", nil, nil
+	return m.Sign(signer)
+}
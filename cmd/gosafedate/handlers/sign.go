@@ -14,11 +14,35 @@ func HandleSign(p *goopt.Parser, _ *goopt.Command) error {
 		return fmt.Errorf("failed to get options from context")
 	}
 
-	sig, err := signing.SignFile(cfg.Sign.KeyPath, cfg.Sign.Message)
+	// the signed message: the given one, or the digest of --file
+	var (
+		msg string
+		err error
+	)
+	switch {
+	case cfg.Sign.File != "" && cfg.Sign.Message != "":
+		return fmt.Errorf("sign failed: a message and --file are exclusive")
+	case cfg.Sign.File != "":
+		msg, err = fileDigest(cfg.Sign.File)
+	case cfg.Sign.Message != "":
+		msg, err = readMessage(cfg.Sign.Message)
+	default:
+		return fmt.Errorf("sign failed: a message or --file is required")
+	}
+	if err != nil {
+		return fmt.Errorf("sign failed: %w", err)
+	}
+
+	signer, err := loadSigner(signerFlags(cfg.Sign.Signer))
+	if err != nil {
+		return fmt.Errorf("sign failed: %w", err)
+	}
+	defer closeSigner(signer)
+
+	sig, err := signing.SignWith(signer, msg)
 	if err != nil {
 		return fmt.Errorf("sign failed: %w", err)
 	}
 
-	fmt.Println(sig)
-	return nil
+	return printSignature(cfg, sig)
 }
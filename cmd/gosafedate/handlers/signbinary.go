@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/napalu/goopt/v2"
+	"github.com/napalu/gosafedate/cmd/gosafedate/config"
+	"github.com/napalu/gosafedate/signing"
+)
+
+// HandleSignFile signs the SHA-256 digest of a file.
+func HandleSignFile(p *goopt.Parser, _ *goopt.Command) error {
+	cfg, ok := goopt.GetStructCtxAs[*config.Config](p)
+	if !ok {
+		return fmt.Errorf("failed to get options from context")
+	}
+
+	signer, err := loadSigner(signerFlags(cfg.SignFile.Signer))
+	if err != nil {
+		return fmt.Errorf("sign failed: %w", err)
+	}
+	defer closeSigner(signer)
+
+	digest, err := fileDigest(cfg.SignFile.File)
+	if err != nil {
+		return fmt.Errorf("sign failed: %w", err)
+	}
+	sig, err := signing.SignWith(signer, digest)
+	if err != nil {
+		return fmt.Errorf("sign failed: %w", err)
+	}
+
+	return printSignature(cfg, sig)
+}
+
+// HandleVerifyFile verifies a signature created by sign-file.
+func HandleVerifyFile(p *goopt.Parser, _ *goopt.Command) error {
+	cfg, ok := goopt.GetStructCtxAs[*config.Config](p)
+	if !ok {
+		return fmt.Errorf("failed to get options from context")
+	}
+
+	digest, err := fileDigest(cfg.VerifyFile.File)
+	if err != nil {
+		return fmt.Errorf("verify failed: %w", err)
+	}
+	valid, err := signing.VerifyFile(cfg.VerifyFile.PubPath, digest, cfg.VerifyFile.Signature)
+	if err != nil {
+		return fmt.Errorf("verify failed: %w", err)
+	}
+	if !valid {
+		return ErrInvalidSignature
+	}
+
+	return printValid(cfg)
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/napalu/gosafedate/cmd/gosafedate/config"
+	"github.com/napalu/gosafedate/signing"
+	"github.com/napalu/gosafedate/signing/kms"
+	"github.com/napalu/gosafedate/signing/pkcs11"
+	"golang.org/x/term"
+)
+
+// signerOptions are the key options shared by the sign commands.
+type signerOptions struct {
+	keyPath  string // key path, agent key fingerprint or PKCS #11 key label
+	useAgent bool
+	kmsKey   string
+	pkcs11   string
+	slot     uint
+	pinEnv   string
+}
+
+// signerFlags returns the options given by the signer flags of a command.
+func signerFlags(s config.Signer) signerOptions {
+	return signerOptions{
+		keyPath:  s.KeyPath,
+		useAgent: s.UseAgent,
+		kmsKey:   s.KMSKey,
+		pkcs11:   s.PKCS11,
+		slot:     s.Slot,
+		pinEnv:   s.PINEnv,
+	}
+}
+
+// loadSigner returns the signer selected by o: a KMS key, a PKCS #11 token
+// key, an ssh-agent key or the key at o.keyPath. Signers implementing
+// io.Closer must be closed.
+func loadSigner(o signerOptions) (signing.Signer, error) {
+	switch {
+	case o.kmsKey != "" && o.keyPath != "":
+		return nil, errors.New("--key and --kms-key-uri are mutually exclusive")
+	case o.kmsKey != "":
+		return kms.New(kms.Config{KeyURI: o.kmsKey})
+	case o.pkcs11 != "":
+		return pkcs11.New(pkcs11.Config{Module: o.pkcs11, Slot: o.slot, PINEnv: o.pinEnv, Label: o.keyPath})
+	case o.keyPath == "":
+		return nil, errors.New("--key or --kms-key-uri is required")
+	case o.useAgent:
+		return signing.NewAgentSigner(o.keyPath)
+	}
+	return signing.LoadPrivateKey(o.keyPath, passphrase)
+}
+
+// closeSigner closes s if it holds resources, e.g. a PKCS #11 session.
+func closeSigner(s signing.Signer) {
+	if c, ok := s.(io.Closer); ok {
+		_ = c.Close()
+	}
+}
+
+// passphrase reads the passphrase of an encrypted key from
+// GOSAFEDATE_KEY_PASSPHRASE, or prompts for it on the terminal.
+func passphrase() ([]byte, error) {
+	if p, ok := os.LookupEnv(signing.PassphraseEnv); ok {
+		return []byte(p), nil
+	}
+	return readPassword("Key passphrase: ")
+}
+
+// newPassphrase is passphrase for new keys, which prompts twice.
+func newPassphrase() ([]byte, error) {
+	if p, ok := os.LookupEnv(signing.PassphraseEnv); ok {
+		return []byte(p), nil
+	}
+	p, err := readPassword("New key passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	again, err := readPassword("Repeat passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(p, again) {
+		return nil, errors.New("passphrases don't match")
+	}
+	if len(p) == 0 {
+		return nil, errors.New("empty passphrase")
+	}
+	return p, nil
+}
+
+func readPassword(prompt string) ([]byte, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("%w: set %s", signing.ErrEncryptedKey, signing.PassphraseEnv)
+	}
+
+	_, _ = fmt.Fprint(os.Stderr, prompt)
+	p, err := term.ReadPassword(fd)
+	_, _ = fmt.Fprintln(os.Stderr)
+	return p, err
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/napalu/goopt/v2"
+	"github.com/napalu/gosafedate/checksum"
+	"github.com/napalu/gosafedate/cmd/gosafedate/config"
+	"github.com/napalu/gosafedate/metadata"
+	"github.com/napalu/gosafedate/self"
+	"github.com/napalu/gosafedate/signing"
+	"github.com/napalu/gosafedate/version"
+)
+
+// HandleUpdate updates the binary at --target, as a managed binary of the
+// library: it is replaced in place once the release is verified, never
+// restarted, and installed if missing. The installed version is --current
+// or, without it, read from "<target> --version"; only newer releases are
+// installed. With --allow-downgrade, the target is instead updated whenever
+// its checksum differs from that of the offered release, as tools of a
+// fleet with Config.AllowDowngrade are.
+func HandleUpdate(p *goopt.Parser, _ *goopt.Command) error {
+	cfg, ok := goopt.GetStructCtxAs[*config.Config](p)
+	if !ok {
+		return fmt.Errorf("failed to get options from context")
+	}
+	opts := cfg.Update
+
+	pub, err := releaseKey(opts.PubPath)
+	if err != nil {
+		return fmt.Errorf("update failed: %w", err)
+	}
+	metaURL, err := metadataURL(opts.URL)
+	if err != nil {
+		return fmt.Errorf("update failed: %w", err)
+	}
+
+	current := opts.Current
+	if current == "" && !opts.Downgrade {
+		if current, err = installedVersion(opts.Target); err != nil {
+			return fmt.Errorf("update failed: %w", err)
+		}
+	}
+
+	sc := self.Config{
+		URL:                metaURL,
+		PubKey:             pub,
+		TargetPath:         opts.Target,
+		CurrentVer:         current,
+		Managed:            true,
+		AllowPrerelease:    opts.Prerelease,
+		AllowDowngrade:     opts.Downgrade,
+		LogInfo:            func(string, ...any) {},
+		LogError:           func(string, ...any) {},
+		DetachedSignatures: opts.Detached,
+	}
+	newer, m, err := self.HasNewer(sc)
+	if err != nil {
+		return fmt.Errorf("update failed: %w", err)
+	}
+	if m == nil {
+		return fmt.Errorf("update failed: no release found")
+	}
+	if opts.Downgrade {
+		if newer, err = differs(opts.Target, m); err != nil {
+			return fmt.Errorf("update failed: %w", err)
+		}
+	}
+	res := updateResult{Target: opts.Target, Current: current, Version: m.Version}
+	if newer {
+		if err = self.UpdateFromMetadata(sc, m); err != nil {
+			return fmt.Errorf("update failed: %w", err)
+		}
+		res.Updated = true
+	}
+	res.Available = newer
+	return printResult(cfg, res, func() {
+		if res.Updated {
+			fmt.Printf("%s updated to %s\n", res.Target, res.Version)
+		} else {
+			fmt.Printf("%s is up to date (%s)\n", res.Target, res.Version)
+		}
+	})
+}
+
+// updateResult is the JSON result of update and self-update.
+type updateResult struct {
+	Target    string `json:"target,omitempty"`
+	Current   string `json:"current,omitempty"`
+	Version   string `json:"version"`   // offered by the metadata
+	Updated   bool   `json:"updated"`   // installed
+	Available bool   `json:"available"` // newer than the installed version
+}
+
+// releaseKey reads the public key releases are verified with: a PEM or
+// OpenSSH key, or a minisign public key, which verifies .minisig files.
+func releaseKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if signing.IsMinisignKey(data) {
+		return data, nil
+	}
+	return signing.PublicKeyFromFile(path)
+}
+
+// versionTimeout bounds "<target> --version".
+const versionTimeout = 10 * time.Second
+
+// installedVersion returns the version printed by "<path> --version": its
+// first word which is a semantic version, e.g. "tool v1.2.3 (linux/amd64)".
+// A missing binary has no version and is installed by the updater.
+func installedVersion(path string) (string, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), versionTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, path, "--version").Output()
+	if err == nil {
+		for _, f := range strings.Fields(string(out)) {
+			f = strings.TrimRight(f, ",;:)")
+			if _, verr := version.NewSemVer(f, "v"); verr == nil {
+				return f, nil
+			}
+		}
+		err = errors.New("no version in its output")
+	}
+	return "", fmt.Errorf("installed version of %s unknown: %s --version: %v; set --current, or --allow-downgrade to update whenever its checksum differs", path, path, err)
+}
+
+// differs reports whether the binary at path is missing or isn't the one
+// described by m.
+func differs(path string, m *metadata.Metadata) (bool, error) {
+	alg, err := checksum.Algorithm(m.Checksum)
+	if err != nil {
+		return false, err
+	}
+	sum, err := checksum.File(path, alg)
+	if errors.Is(err, os.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !strings.EqualFold(sum, m.Checksum), nil
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// script returns a shell script printing out for --version.
+func script(out string) []byte {
+	return []byte("#!/bin/sh\necho '" + out + "'\n")
+}
+
+func TestHandleUpdate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("targets are shell scripts")
+	}
+	dir := t.TempDir()
+	key, pub := testKeys(t, dir)
+	release := script("tool v1.1.0")
+	meta := pack(t, dir, key, "tool", "v1.1.0", release)
+
+	tests := []struct {
+		name      string
+		installed []byte // nil: missing
+		args      []string
+		updated   bool
+		current   string
+		wantErr   string
+	}{
+		{name: "older installed", installed: script("tool v1.0.0 (linux/amd64)"), updated: true, current: "v1.0.0"},
+		{name: "up to date", installed: script("tool version 1.1.0"), current: "1.1.0"},
+		{name: "newer installed", installed: script("tool v1.2.0"), current: "v1.2.0"},
+		{name: "missing", updated: true},
+		{name: "current flag", installed: script("tool v1.2.0"), args: []string{"--current", "v1.0.0"}, updated: true, current: "v1.0.0"},
+		{name: "unknown version", installed: script("tool"), wantErr: "installed version of"},
+		{name: "allow downgrade", installed: script("tool v1.2.0"), args: []string{"--allow-downgrade"}, updated: true},
+		{name: "allow downgrade, same binary", installed: release, args: []string{"--allow-downgrade"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := filepath.Join(t.TempDir(), "tool")
+			if tt.installed != nil {
+				if err := os.WriteFile(target, tt.installed, 0o755); err != nil {
+					t.Fatalf("write target: %v", err)
+				}
+			}
+
+			args := append([]string{"--json", "update", "--url", meta, "--pub", pub, "--target", target}, tt.args...)
+			out, err := run(t, args...)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("update: %v", err)
+			}
+
+			var res updateResult
+			if err = json.Unmarshal([]byte(out), &res); err != nil {
+				t.Fatalf("result %q: %v", out, err)
+			}
+			if res.Updated != tt.updated || res.Current != tt.current || res.Version != "v1.1.0" {
+				t.Fatalf("result = %+v, want updated=%v current=%q", res, tt.updated, tt.current)
+			}
+			got, _ := os.ReadFile(target)
+			switch {
+			case tt.updated && !bytes.Equal(got, release):
+				t.Fatalf("target not updated: %q", got)
+			case !tt.updated && tt.installed != nil && !bytes.Equal(got, tt.installed):
+				t.Fatalf("target replaced: %q", got)
+			}
+		})
+	}
+}
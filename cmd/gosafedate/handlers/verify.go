@@ -14,14 +14,35 @@ func HandleVerify(p *goopt.Parser, _ *goopt.Command) error {
 		return fmt.Errorf("failed to get options from context")
 	}
 
-	valid, err := signing.VerifyFile(cfg.Verify.PubPath, cfg.Verify.Message, cfg.Verify.Signature)
+	// with --file, the only argument is the signature
+	var (
+		msg, sig string
+		err      error
+	)
+	if cfg.Verify.File != "" {
+		if cfg.Verify.Message == "" || cfg.Verify.Signature != "" {
+			return fmt.Errorf("verify failed: --file takes the signature as only argument")
+		}
+		sig = cfg.Verify.Message
+		msg, err = fileDigest(cfg.Verify.File)
+	} else {
+		if cfg.Verify.Message == "" || cfg.Verify.Signature == "" {
+			return fmt.Errorf("verify failed: a message and a signature are required")
+		}
+		sig = cfg.Verify.Signature
+		msg, err = readMessage(cfg.Verify.Message)
+	}
+	if err != nil {
+		return fmt.Errorf("verify failed: %w", err)
+	}
+
+	valid, err := signing.VerifyFile(cfg.Verify.PubPath, msg, sig)
 	if err != nil {
 		return fmt.Errorf("verify failed: %w", err)
 	}
 	if !valid {
-		return fmt.Errorf("invalid signature")
+		return ErrInvalidSignature
 	}
 
-	fmt.Println("valid signature")
-	return nil
+	return printValid(cfg)
 }
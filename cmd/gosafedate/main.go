@@ -1,18 +1,24 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"slices"
 
 	"github.com/napalu/goopt/v2"
+	_ "github.com/napalu/gosafedate/checksum/blake3"
 	"github.com/napalu/gosafedate/cmd/gosafedate/config"
 	"github.com/napalu/gosafedate/cmd/gosafedate/handlers"
 )
 
 func main() {
 	cfg := &config.Config{}
-	parser, err := goopt.NewParserFromStruct(cfg, goopt.WithExecOnParseComplete(true))
+	parser, err := goopt.NewParserFromStruct(cfg,
+		goopt.WithExecOnParseComplete(true),
+		goopt.WithFlagNameConverter(config.FlagNameConverter),
+		goopt.WithGlobalPreHook(handlers.RestoreStdin))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -21,12 +27,60 @@ func main() {
 	cfg.Keygen.Exec = handlers.HandleKeygen
 	cfg.Sign.Exec = handlers.HandleSign
 	cfg.Verify.Exec = handlers.HandleVerify
+	cfg.SignFile.Exec = handlers.HandleSignFile
+	cfg.VerifyFile.Exec = handlers.HandleVerifyFile
+	cfg.Checksum.Exec = handlers.HandleChecksum
+	cfg.Check.Exec = handlers.HandleCheck
+	cfg.Update.Exec = handlers.HandleUpdate
+	cfg.VerifyRelease.Exec = handlers.HandleVerifyRelease
+	cfg.Inspect.Exec = handlers.HandleInspect
+	cfg.Serve.Exec = handlers.HandleServe
+	cfg.Release.Pack.Exec = handlers.HandleReleasePack
+	cfg.Release.Publish.Exec = handlers.HandleReleasePublish
+	cfg.Release.Attest.Exec = handlers.HandleReleaseAttest
+	cfg.Delta.Exec = handlers.HandleDelta
+	cfg.SelfUpdate.Exec = handlers.HandleSelfUpdate
+	cfg.Keys.Root.Exec = handlers.HandleKeysRoot
+	cfg.Keys.Rotate.Exec = handlers.HandleKeysRotate
 	cfg.PubBytes.Exec = handlers.HandlePubKeyBytes
 
-	if !parser.Parse(os.Args) {
-		for _, e := range parser.GetErrors() {
-			_, _ = fmt.Fprintf(os.Stderr, "%s\n", e.Error())
+	// goopt takes a lone "-" for a flag
+	args := slices.Clone(os.Args[1:])
+	for i, a := range args {
+		if a == "-" {
+			args[i] = handlers.Stdin
 		}
-		os.Exit(1)
+	}
+
+	// flags not given default to the values of gosafedate.yaml and
+	// GOSAFEDATE_* environment variables
+	defaults, err := config.LoadDefaults(parser, args)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "config: %s\n", err)
+		os.Exit(handlers.ExitError)
+	}
+	args = defaults.Apply(parser, args)
+
+	if !parser.Parse(args) {
+		// failed commands exit with their handlers.ExitCode, other errors
+		// with handlers.ExitError
+		code := handlers.ExitError
+		for _, kv := range parser.GetCommandExecutionErrors() {
+			code = max(code, handlers.ExitCode(kv.Value))
+		}
+
+		if cfg.JSON {
+			msgs := []string{}
+			for _, e := range parser.GetErrors() {
+				msgs = append(msgs, e.Error())
+			}
+			b, _ := json.MarshalIndent(map[string]any{"errors": msgs, "exitCode": code}, "", "  ")
+			_, _ = fmt.Fprintf(os.Stderr, "%s\n", b)
+		} else {
+			for _, e := range parser.GetErrors() {
+				_, _ = fmt.Fprintf(os.Stderr, "%s\n", e.Error())
+			}
+		}
+		os.Exit(code)
 	}
 }
@@ -2,13 +2,20 @@ module github.com/napalu/gosafedate
 
 go 1.25.3
 
-require github.com/napalu/goopt/v2 v2.4.1
+require (
+	github.com/klauspost/compress v1.18.0
+	github.com/napalu/goopt/v2 v2.4.1
+	github.com/ulikunitz/xz v0.5.12
+	golang.org/x/crypto v0.44.0
+	golang.org/x/term v0.37.0
+	lukechampine.com/blake3 v1.4.1
+)
 
 require (
 	github.com/araddon/dateparse v0.0.0-20210429162001-6b43995a97de // indirect
 	github.com/google/shlex v0.0.0-20191202100458-e7afc7fbc510 // indirect
 	github.com/iancoleman/strcase v0.3.0 // indirect
+	github.com/klauspost/cpuid/v2 v2.0.9 // indirect
 	golang.org/x/sys v0.38.0 // indirect
-	golang.org/x/term v0.37.0 // indirect
 	golang.org/x/text v0.31.0 // indirect
 )
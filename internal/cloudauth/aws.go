@@ -0,0 +1,310 @@
+package cloudauth
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/napalu/gosafedate/internal/sigv4"
+)
+
+// AWS resolves AWS credentials, from the first of:
+//
+//   - AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN;
+//   - the static keys of the profile AWS_PROFILE (or AWS_DEFAULT_PROFILE,
+//     else "default") in the shared credentials and config files,
+//     ~/.aws/credentials and ~/.aws/config unless AWS_SHARED_CREDENTIALS_FILE
+//     and AWS_CONFIG_FILE name others;
+//   - the container credentials endpoint of ECS and EKS Pod Identity,
+//     AWS_CONTAINER_CREDENTIALS_RELATIVE_URI or
+//     AWS_CONTAINER_CREDENTIALS_FULL_URI;
+//   - the role of the EC2 instance profile, from the instance metadata
+//     service at AWS_EC2_METADATA_SERVICE_ENDPOINT or 169.254.169.254,
+//     unless AWS_EC2_METADATA_DISABLED is true.
+//
+// Profiles assuming a role, using SSO or a credential process aren't
+// supported and are an error.
+type AWS struct {
+	cache cache[sigv4.Credentials]
+}
+
+// Credentials returns the credentials of a, and whether there are any.
+func (a *AWS) Credentials(ctx context.Context) (sigv4.Credentials, bool, error) {
+	return a.cache.get(ctx, resolveAWS)
+}
+
+// AWSRegion returns AWS_REGION, AWS_DEFAULT_REGION or the region of the
+// profile in the config file, else us-east-1.
+func AWSRegion() string {
+	if r := firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"); r != "" {
+		return r
+	}
+	if p, _, err := awsProfileKeys(); err == nil && p["region"] != "" {
+		return p["region"]
+	}
+	return "us-east-1"
+}
+
+func resolveAWS(ctx context.Context) (sigv4.Credentials, bool, time.Time, error) {
+	keyID, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	switch {
+	case keyID != "" && secret != "":
+		return sigv4.Credentials{KeyID: keyID, Secret: secret, SessionToken: os.Getenv("AWS_SESSION_TOKEN")}, true, time.Time{}, nil
+	case keyID != "" || secret != "":
+		return sigv4.Credentials{}, false, time.Time{}, errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set together")
+	}
+
+	if creds, found, err := awsProfile(); err != nil || found {
+		return creds, found, time.Time{}, err
+	}
+	if creds, found, expires, err := awsContainer(ctx); err != nil || found {
+		return creds, found, expires, err
+	}
+	return awsInstance(ctx)
+}
+
+// awsProfile returns the static keys of the profile.
+func awsProfile() (sigv4.Credentials, bool, error) {
+	keys, name, err := awsProfileKeys()
+	if err != nil || keys == nil {
+		return sigv4.Credentials{}, false, err
+	}
+
+	id, secret := keys["aws_access_key_id"], keys["aws_secret_access_key"]
+	if id != "" && secret != "" {
+		return sigv4.Credentials{KeyID: id, Secret: secret, SessionToken: keys["aws_session_token"]}, true, nil
+	}
+	for _, k := range []string{"role_arn", "sso_session", "sso_start_url", "credential_process", "web_identity_token_file"} {
+		if keys[k] != "" {
+			return sigv4.Credentials{}, false, fmt.Errorf("AWS profile %q: %s isn't supported", name, k)
+		}
+	}
+	if id != "" || secret != "" || firstEnv("AWS_PROFILE", "AWS_DEFAULT_PROFILE") != "" {
+		return sigv4.Credentials{}, false, fmt.Errorf("AWS profile %q: no aws_access_key_id and aws_secret_access_key", name)
+	}
+	// e.g. a default profile setting the region only
+	return sigv4.Credentials{}, false, nil
+}
+
+// awsProfileKeys returns the keys of the profile in the credentials file,
+// completed by those of the config file, and its name. keys is nil if
+// neither file has the profile, which is an error if it was selected.
+func awsProfileKeys() (keys map[string]string, name string, err error) {
+	name = firstEnv("AWS_PROFILE", "AWS_DEFAULT_PROFILE")
+	explicit := name != ""
+	if !explicit {
+		name = "default"
+	}
+
+	credsPath, credsExplicit := configPath("AWS_SHARED_CREDENTIALS_FILE", ".aws", "credentials")
+	credsData, err := readConfig(credsPath, credsExplicit)
+	if err != nil {
+		return nil, name, err
+	}
+	confPath, confExplicit := configPath("AWS_CONFIG_FILE", ".aws", "config")
+	confData, err := readConfig(confPath, confExplicit)
+	if err != nil {
+		return nil, name, err
+	}
+
+	keys, inCreds := iniSection(credsData, name)
+	section := "profile " + name
+	if name == "default" {
+		section = "default"
+	}
+	conf, inConf := iniSection(confData, section)
+	if !inCreds && !inConf {
+		if explicit {
+			return nil, name, fmt.Errorf("AWS profile %q not found in %s or %s", name, credsPath, confPath)
+		}
+		return nil, name, nil
+	}
+	if keys == nil {
+		keys = map[string]string{}
+	}
+	for k, v := range conf {
+		if _, ok := keys[k]; !ok {
+			keys[k] = v
+		}
+	}
+	return keys, name, nil
+}
+
+// iniSection returns the keys of the section name of an INI file, whose
+// names are lower-cased. Indented lines, which configure services in the
+// config file, are skipped.
+func iniSection(data []byte, name string) (map[string]string, bool) {
+	var (
+		keys  map[string]string
+		found bool
+		in    bool
+	)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := sc.Text()
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || trimmed[0] == '#' || trimmed[0] == ';':
+		case trimmed[0] == '[' && strings.HasSuffix(trimmed, "]"):
+			in = strings.Join(strings.Fields(trimmed[1:len(trimmed)-1]), " ") == name
+			if in && !found {
+				found, keys = true, map[string]string{}
+			}
+		case in && line[0] != ' ' && line[0] != '\t':
+			if k, v, ok := strings.Cut(trimmed, "="); ok {
+				keys[strings.ToLower(strings.TrimSpace(k))] = strings.TrimSpace(v)
+			}
+		}
+	}
+	return keys, found
+}
+
+// awsCredentials are the temporary credentials served by the container and
+// instance metadata endpoints.
+type awsCredentials struct {
+	Code            string    `json:"Code"` // instance metadata only
+	Message         string    `json:"Message"`
+	AccessKeyID     string    `json:"AccessKeyId"`
+	SecretAccessKey string    `json:"SecretAccessKey"`
+	Token           string    `json:"Token"`
+	Expiration      time.Time `json:"Expiration"`
+}
+
+func (c *awsCredentials) credentials() (sigv4.Credentials, bool, time.Time, error) {
+	if c.Code != "" && c.Code != "Success" {
+		return sigv4.Credentials{}, false, time.Time{}, fmt.Errorf("%s: %s", c.Code, c.Message)
+	}
+	if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+		return sigv4.Credentials{}, false, time.Time{}, errors.New("no credentials in the response")
+	}
+	return sigv4.Credentials{KeyID: c.AccessKeyID, Secret: c.SecretAccessKey, SessionToken: c.Token}, true, c.Expiration, nil
+}
+
+// awsContainerHost serves the credentials of ECS tasks at
+// AWS_CONTAINER_CREDENTIALS_RELATIVE_URI.
+const awsContainerHost = "http://169.254.170.2"
+
+// awsContainer returns the credentials of the container endpoint.
+func awsContainer(ctx context.Context) (sigv4.Credentials, bool, time.Time, error) {
+	endpoint := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if rel := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); rel != "" {
+		endpoint = awsContainerHost + rel
+	}
+	if endpoint == "" {
+		return sigv4.Credentials{}, false, time.Time{}, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return sigv4.Credentials{}, false, time.Time{}, err
+	}
+	token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	if path := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return sigv4.Credentials{}, false, time.Time{}, fmt.Errorf("AWS container credentials: %w", err)
+		}
+		token = strings.TrimSpace(string(b))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+
+	var c awsCredentials
+	if err = fetchJSON(metadataClient, req, &c); err != nil {
+		return sigv4.Credentials{}, false, time.Time{}, fmt.Errorf("AWS container credentials: %w", err)
+	}
+	creds, found, expires, err := c.credentials()
+	if err != nil {
+		err = fmt.Errorf("AWS container credentials: %w", err)
+	}
+	return creds, found, expires, err
+}
+
+// awsInstance returns the credentials of the instance profile role, from
+// IMDSv2, or IMDSv1 if the session token is refused.
+func awsInstance(ctx context.Context) (sigv4.Credentials, bool, time.Time, error) {
+	if strings.EqualFold(os.Getenv("AWS_EC2_METADATA_DISABLED"), "true") {
+		return sigv4.Credentials{}, false, time.Time{}, nil
+	}
+	base := strings.TrimSuffix(os.Getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT"), "/")
+	if base == "" {
+		base = "http://169.254.169.254"
+	}
+
+	var token string
+	err := probe(ctx, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, base+"/latest/api/token", nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+		b, err := send(metadataClient, req)
+		var se *statusError
+		if errors.As(err, &se) {
+			return nil // IMDSv1
+		}
+		token = string(b)
+		return err
+	})
+	switch {
+	case errors.Is(err, errNoService):
+		return sigv4.Credentials{}, false, time.Time{}, nil
+	case err != nil:
+		return sigv4.Credentials{}, false, time.Time{}, fmt.Errorf("AWS instance metadata: %w", err)
+	}
+
+	get := func(path string) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		if token != "" {
+			req.Header.Set("X-aws-ec2-metadata-token", token)
+		}
+		return send(metadataClient, req)
+	}
+	const rolesPath = "/latest/meta-data/iam/security-credentials/"
+	roles, err := get(rolesPath)
+	if hasStatus(err, http.StatusBadRequest, http.StatusNotFound) {
+		// no instance profile, or another cloud's metadata service
+		return sigv4.Credentials{}, false, time.Time{}, nil
+	}
+	if err != nil {
+		return sigv4.Credentials{}, false, time.Time{}, fmt.Errorf("AWS instance metadata: %w", err)
+	}
+	role, _, _ := strings.Cut(strings.TrimSpace(string(roles)), "\n")
+	if role == "" {
+		return sigv4.Credentials{}, false, time.Time{}, nil
+	}
+
+	var c awsCredentials
+	b, err := get(rolesPath + role)
+	if err == nil {
+		err = json.Unmarshal(b, &c)
+	}
+	if err != nil {
+		return sigv4.Credentials{}, false, time.Time{}, fmt.Errorf("AWS instance metadata: role %s: %w", role, err)
+	}
+	creds, found, expires, err := c.credentials()
+	if err != nil {
+		err = fmt.Errorf("AWS instance metadata: role %s: %w", role, err)
+	}
+	return creds, found, expires, err
+}
+
+func firstEnv(names ...string) string {
+	for _, n := range names {
+		if v := os.Getenv(n); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,151 @@
+package cloudauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Azure resolves Microsoft Entra ID access tokens, from the first of:
+//
+//   - the service principal AZURE_CLIENT_SECRET of AZURE_CLIENT_ID in
+//     AZURE_TENANT_ID;
+//   - the workload identity AZURE_FEDERATED_TOKEN_FILE of AZURE_CLIENT_ID in
+//     AZURE_TENANT_ID, e.g. on AKS;
+//   - the managed identity of App Service and Functions, IDENTITY_ENDPOINT
+//     and IDENTITY_HEADER;
+//   - the managed identity of the VM, from the instance metadata service at
+//     169.254.169.254; a user-assigned one if AZURE_CLIENT_ID is set.
+type Azure struct {
+	Resource string       // resource the tokens are for, e.g. "https://storage.azure.com/"
+	Client   *http.Client // for token endpoints; if nil: http.DefaultClient
+
+	cache cache[string]
+}
+
+// Token returns an access token, and whether there is any.
+func (a *Azure) Token(ctx context.Context) (string, bool, error) {
+	return a.cache.get(ctx, a.resolve)
+}
+
+func (a *Azure) resolve(ctx context.Context) (string, bool, time.Time, error) {
+	tenant, client := os.Getenv("AZURE_TENANT_ID"), os.Getenv("AZURE_CLIENT_ID")
+	secret, tokenFile := os.Getenv("AZURE_CLIENT_SECRET"), os.Getenv("AZURE_FEDERATED_TOKEN_FILE")
+	if secret != "" || tokenFile != "" {
+		if tenant == "" || client == "" {
+			return "", false, time.Time{}, errors.New("Azure service principal: AZURE_TENANT_ID and AZURE_CLIENT_ID must be set")
+		}
+		form := url.Values{
+			"grant_type": {"client_credentials"},
+			"client_id":  {client},
+			"scope":      {strings.TrimSuffix(a.Resource, "/") + "/.default"},
+		}
+		what := "Azure service principal"
+		if secret != "" {
+			form.Set("client_secret", secret)
+		} else {
+			what = "Azure workload identity"
+			b, err := os.ReadFile(tokenFile)
+			if err != nil {
+				return "", false, time.Time{}, fmt.Errorf("%s: %w", what, err)
+			}
+			form.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+			form.Set("client_assertion", strings.TrimSpace(string(b)))
+		}
+		authority := strings.TrimSuffix(os.Getenv("AZURE_AUTHORITY_HOST"), "/")
+		if authority == "" {
+			authority = "https://login.microsoftonline.com"
+		}
+
+		var t azureToken
+		if err := postForm(ctx, a.Client, authority+"/"+url.PathEscape(tenant)+"/oauth2/v2.0/token", form, &t); err != nil {
+			return "", false, time.Time{}, fmt.Errorf("%s: %w", what, err)
+		}
+		return t.token(what)
+	}
+
+	if endpoint, header := os.Getenv("IDENTITY_ENDPOINT"), os.Getenv("IDENTITY_HEADER"); endpoint != "" && header != "" {
+		return a.appService(ctx, endpoint, header, client)
+	}
+	return a.instance(ctx, client)
+}
+
+// azureToken is the response of a token endpoint, whose managed identity
+// variants give the expiry as expires_on only.
+type azureToken struct {
+	AccessToken string  `json:"access_token"`
+	ExpiresIn   seconds `json:"expires_in"`
+	ExpiresOn   seconds `json:"expires_on"` // Unix time
+}
+
+func (t *azureToken) token(what string) (string, bool, time.Time, error) {
+	if t.AccessToken == "" {
+		return "", false, time.Time{}, fmt.Errorf("%s: no access token in the response", what)
+	}
+	expires := t.ExpiresIn.expiresIn()
+	if expires.IsZero() && t.ExpiresOn > 0 {
+		expires = time.Unix(int64(t.ExpiresOn), 0)
+	}
+	return t.AccessToken, true, expires, nil
+}
+
+// appService returns a token of the App Service managed identity.
+func (a *Azure) appService(ctx context.Context, endpoint, header, client string) (string, bool, time.Time, error) {
+	q := url.Values{"api-version": {"2019-08-01"}, "resource": {a.Resource}}
+	if client != "" {
+		q.Set("client_id", client)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"?"+q.Encode(), nil)
+	if err != nil {
+		return "", false, time.Time{}, err
+	}
+	req.Header.Set("X-IDENTITY-HEADER", header)
+
+	var t azureToken
+	if err = fetchJSON(metadataClient, req, &t); err != nil {
+		return "", false, time.Time{}, fmt.Errorf("Azure managed identity: %w", err)
+	}
+	return t.token("Azure managed identity")
+}
+
+// instance returns a token of the VM's managed identity, the user-assigned
+// identity client if set.
+func (a *Azure) instance(ctx context.Context, client string) (string, bool, time.Time, error) {
+	host := strings.TrimSuffix(os.Getenv("AZURE_POD_IDENTITY_AUTHORITY_HOST"), "/")
+	if host == "" {
+		host = "http://169.254.169.254"
+	}
+	q := url.Values{"api-version": {"2018-02-01"}, "resource": {a.Resource}}
+	if client != "" {
+		q.Set("client_id", client)
+	}
+	endpoint := host + "/metadata/identity/oauth2/token?" + q.Encode()
+
+	// without the Metadata header, the service refuses requests as bad
+	resp, err := ping(ctx, host+"/metadata/identity/oauth2/token")
+	if errors.Is(err, errNoService) || err == nil && resp.StatusCode != http.StatusBadRequest {
+		// not on Azure
+		return "", false, time.Time{}, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", false, time.Time{}, err
+	}
+	req.Header.Set("Metadata", "true")
+	var t azureToken
+	err = fetchJSON(metadataClient, req, &t)
+	switch {
+	case client == "" && hasStatus(err, http.StatusBadRequest, http.StatusNotFound):
+		// no managed identity assigned
+		return "", false, time.Time{}, nil
+	case err != nil:
+		return "", false, time.Time{}, fmt.Errorf("Azure managed identity: %w", err)
+	}
+	return t.token("Azure managed identity")
+}
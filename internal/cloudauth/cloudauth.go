@@ -0,0 +1,220 @@
+// Package cloudauth resolves the credentials of AWS, Google Cloud and Azure
+// as their SDKs do, for the object storage source: from the environment,
+// the shared configuration files and the instance metadata services. It
+// exists so gosafedate stays free of dependencies.
+//
+// Credentials which are configured but can't be resolved are an error, e.g.
+// an AWS_PROFILE missing from the configuration files; only their absence
+// is reported as not found, for anonymous access to public objects.
+package cloudauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// probeTimeout bounds the first request to an instance metadata service,
+	// which doesn't answer outside of the cloud.
+	probeTimeout = time.Second
+	// refreshMargin is how long before they expire credentials are renewed.
+	refreshMargin = 5 * time.Minute
+	// maxResponseSize bounds the responses of credential endpoints.
+	maxResponseSize = 1 << 20
+)
+
+// errNoService is returned by a probe whose metadata service doesn't
+// answer.
+var errNoService = errors.New("no instance metadata service")
+
+// metadataClient talks to the link-local metadata services, never through a
+// proxy.
+var metadataClient = &http.Client{Transport: &http.Transport{}}
+
+// cache holds resolved credentials until shortly before they expire.
+// Failures aren't cached.
+type cache[T any] struct {
+	mu       sync.Mutex
+	resolved bool
+	val      T
+	found    bool
+	expires  time.Time // zero: never
+}
+
+func (c *cache[T]) get(ctx context.Context, resolve func(context.Context) (T, bool, time.Time, error)) (T, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.resolved && (c.expires.IsZero() || time.Until(c.expires) > refreshMargin) {
+		return c.val, c.found, nil
+	}
+	v, found, expires, err := resolve(ctx)
+	if err != nil {
+		var zero T
+		return zero, false, err
+	}
+	c.resolved, c.val, c.found, c.expires = true, v, found, expires
+	return v, found, nil
+}
+
+// send sends req with client, http.DefaultClient if nil, and returns the
+// body of its response, a statusError unless it is 200 OK.
+func send(client *http.Client, req *http.Request) ([]byte, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg := strings.TrimSpace(string(body))
+		if len(msg) > 200 {
+			msg = msg[:200] + "..."
+		}
+		return nil, &statusError{url: req.URL.Redacted(), code: resp.StatusCode, body: msg}
+	}
+	return body, nil
+}
+
+// fetchJSON sends req with client and decodes its JSON response into v.
+func fetchJSON(client *http.Client, req *http.Request, v any) error {
+	body, err := send(client, req)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("%s: %w", req.URL.Redacted(), err)
+	}
+	return nil
+}
+
+// postForm posts form to endpoint and decodes the JSON response into v.
+func postForm(ctx context.Context, client *http.Client, endpoint string, form url.Values, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return fetchJSON(client, req, v)
+}
+
+// statusError is an unexpected HTTP status of a credential endpoint.
+type statusError struct {
+	url  string
+	code int
+	body string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s: HTTP %d: %s", e.url, e.code, e.body)
+}
+
+// hasStatus reports whether err is a statusError with one of codes.
+func hasStatus(err error, codes ...int) bool {
+	var se *statusError
+	if !errors.As(err, &se) {
+		return false
+	}
+	for _, c := range codes {
+		if se.code == c {
+			return true
+		}
+	}
+	return false
+}
+
+// probe runs the first request to a metadata service, failing with
+// errNoService if the service doesn't answer within probeTimeout.
+func probe(ctx context.Context, do func(ctx context.Context) error) error {
+	pctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	err := do(pctx)
+	var se *statusError
+	if err != nil && !errors.As(err, &se) && ctx.Err() == nil {
+		return fmt.Errorf("%w: %v", errNoService, err)
+	}
+	return err
+}
+
+// ping probes the metadata service at endpoint before the requests for
+// tokens, which may take longer, and returns its response, whose body is
+// closed. The other clouds' services answer at the same address: callers
+// tell them apart by the response.
+func ping(ctx context.Context, endpoint string) (*http.Response, error) {
+	var resp *http.Response
+	err := probe(ctx, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+		if err != nil {
+			return err
+		}
+		if resp, err = metadataClient.Do(req); err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	})
+	return resp, err
+}
+
+// seconds is a duration in seconds, given as a JSON number or string.
+type seconds int64
+
+func (s *seconds) UnmarshalJSON(b []byte) error {
+	n, err := strconv.ParseInt(strings.Trim(string(b), `"`), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid seconds %s", b)
+	}
+	*s = seconds(n)
+	return nil
+}
+
+// expiresIn returns when a token valid for s from now expires.
+func (s seconds) expiresIn() time.Time {
+	if s <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(s) * time.Second)
+}
+
+// configPath returns the path given by the environment variable env, or
+// the file at rel in the home directory. explicit reports the former, whose
+// absence is an error.
+func configPath(env string, rel ...string) (path string, explicit bool) {
+	if p := os.Getenv(env); p != "" {
+		return p, true
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", false
+	}
+	return filepath.Join(append([]string{home}, rel...)...), false
+}
+
+// readConfig reads the configuration file at path: a missing file is only
+// an error if it was named explicitly.
+func readConfig(path string, explicit bool) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return nil, nil
+	}
+	return data, err
+}
@@ -0,0 +1,514 @@
+package cloudauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/napalu/gosafedate/internal/sigv4"
+)
+
+// isolate clears the credential environment and points the home directory
+// at a temporary one, so that only what a test configures is found. The
+// metadata services are disabled, Azure's by a closed server.
+func isolate(t *testing.T) string {
+	t.Helper()
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		for _, prefix := range []string{"AWS_", "GOOGLE_", "GCE_", "CLOUDSDK_", "AZURE_", "IDENTITY_"} {
+			if strings.HasPrefix(name, prefix) {
+				t.Setenv(name, "")
+				_ = os.Unsetenv(name)
+			}
+		}
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv("APPDATA", filepath.Join(home, "AppData"))
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("NO_GCE_CHECK", "true")
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	t.Setenv("AZURE_POD_IDENTITY_AUTHORITY_HOST", closed.URL)
+	return home
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAWS(t *testing.T) {
+	const (
+		credentials = "[default]\naws_access_key_id = DEFAULTID\naws_secret_access_key = defaultsecret\n\n" +
+			"[dev]\naws_access_key_id=DEVID\naws_secret_access_key=devsecret\naws_session_token=devtoken\n" +
+			"[sso]\nregion = eu-west-1\n"
+		config = "[profile dev]\nregion = eu-central-1\ns3 =\n  region = ignored\n" +
+			"[profile sso]\nsso_session = corp\n[profile role]\nrole_arn = arn:aws:iam::1:role/r\n"
+	)
+
+	tests := []struct {
+		name       string
+		files      bool
+		env        map[string]string
+		want       sigv4.Credentials
+		wantFound  bool
+		wantErr    string
+		wantRegion string
+	}{
+		{name: "none", wantRegion: "us-east-1"},
+		{name: "env", files: true, env: map[string]string{"AWS_ACCESS_KEY_ID": "ENVID", "AWS_SECRET_ACCESS_KEY": "envsecret", "AWS_REGION": "ap-south-1"},
+			want: sigv4.Credentials{KeyID: "ENVID", Secret: "envsecret"}, wantFound: true, wantRegion: "ap-south-1"},
+		{name: "env key without secret", env: map[string]string{"AWS_ACCESS_KEY_ID": "ENVID"}, wantErr: "must be set together"},
+		{name: "default profile", files: true,
+			want: sigv4.Credentials{KeyID: "DEFAULTID", Secret: "defaultsecret"}, wantFound: true, wantRegion: "us-east-1"},
+		{name: "named profile", files: true, env: map[string]string{"AWS_PROFILE": "dev"},
+			want: sigv4.Credentials{KeyID: "DEVID", Secret: "devsecret", SessionToken: "devtoken"}, wantFound: true, wantRegion: "eu-central-1"},
+		{name: "missing profile", files: true, env: map[string]string{"AWS_PROFILE": "prod"}, wantErr: `AWS profile "prod" not found`},
+		{name: "profile without keys", files: true, env: map[string]string{"AWS_PROFILE": "sso"}, wantErr: "sso_session isn't supported"},
+		{name: "role profile", files: true, env: map[string]string{"AWS_PROFILE": "role"}, wantErr: "role_arn isn't supported"},
+		{name: "missing credentials file", env: map[string]string{"AWS_SHARED_CREDENTIALS_FILE": "missing"}, wantErr: "missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := isolate(t)
+			if tt.files {
+				writeFile(t, filepath.Join(home, ".aws", "credentials"), credentials)
+				writeFile(t, filepath.Join(home, ".aws", "config"), config)
+			}
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			var a AWS
+			creds, found, err := a.Credentials(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Credentials: %v", err)
+			}
+			if creds != tt.want || found != tt.wantFound {
+				t.Fatalf("got %+v, %v; want %+v, %v", creds, found, tt.want, tt.wantFound)
+			}
+			if got := AWSRegion(); got != tt.wantRegion {
+				t.Fatalf("region = %q, want %q", got, tt.wantRegion)
+			}
+		})
+	}
+}
+
+// imds serves the AWS instance metadata of role, none if empty, requiring a
+// session token if v2.
+func imds(t *testing.T, role string, v2 bool, expires time.Time) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		const token = "session-token"
+		if r.URL.Path == "/latest/api/token" {
+			if !v2 || r.Method != http.MethodPut || r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds") == "" {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			_, _ = w.Write([]byte(token))
+			return
+		}
+		if v2 && r.Header.Get("X-aws-ec2-metadata-token") != token {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/latest/meta-data/iam/security-credentials/":
+			if role == "" {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = w.Write([]byte(role + "\n"))
+		case "/latest/meta-data/iam/security-credentials/" + role:
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"Code": "Success", "AccessKeyId": "ROLEID", "SecretAccessKey": "rolesecret", "Token": "roletoken", "Expiration": expires,
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestAWS_Metadata(t *testing.T) {
+	role := sigv4.Credentials{KeyID: "ROLEID", Secret: "rolesecret", SessionToken: "roletoken"}
+	later := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name      string
+		setup     func(t *testing.T)
+		want      sigv4.Credentials
+		wantFound bool
+		wantErr   string
+	}{
+		{name: "IMDSv2", setup: func(t *testing.T) {
+			t.Setenv("AWS_EC2_METADATA_DISABLED", "")
+			t.Setenv("AWS_EC2_METADATA_SERVICE_ENDPOINT", imds(t, "app", true, later).URL)
+		}, want: role, wantFound: true},
+		{name: "IMDSv1", setup: func(t *testing.T) {
+			t.Setenv("AWS_EC2_METADATA_DISABLED", "")
+			t.Setenv("AWS_EC2_METADATA_SERVICE_ENDPOINT", imds(t, "app", false, later).URL)
+		}, want: role, wantFound: true},
+		{name: "no instance profile", setup: func(t *testing.T) {
+			t.Setenv("AWS_EC2_METADATA_DISABLED", "")
+			t.Setenv("AWS_EC2_METADATA_SERVICE_ENDPOINT", imds(t, "", true, later).URL)
+		}},
+		{name: "no service", setup: func(t *testing.T) {
+			srv := httptest.NewServer(http.NotFoundHandler())
+			srv.Close()
+			t.Setenv("AWS_EC2_METADATA_DISABLED", "")
+			t.Setenv("AWS_EC2_METADATA_SERVICE_ENDPOINT", srv.URL)
+		}},
+		{name: "container", setup: func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "container-token" {
+					http.Error(w, "unauthorized", http.StatusUnauthorized)
+					return
+				}
+				_ = json.NewEncoder(w).Encode(map[string]any{"AccessKeyId": "ROLEID", "SecretAccessKey": "rolesecret", "Token": "roletoken"})
+			}))
+			t.Cleanup(srv.Close)
+			tokenFile := filepath.Join(t.TempDir(), "token")
+			writeFile(t, tokenFile, "container-token\n")
+			t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", srv.URL+"/creds")
+			t.Setenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE", tokenFile)
+		}, want: role, wantFound: true},
+		{name: "container refused", setup: func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+			}))
+			t.Cleanup(srv.Close)
+			t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", srv.URL+"/creds")
+		}, wantErr: "HTTP 401"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolate(t)
+			tt.setup(t)
+
+			var a AWS
+			creds, found, err := a.Credentials(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Credentials: %v", err)
+			}
+			if creds != tt.want || found != tt.wantFound {
+				t.Fatalf("got %+v, %v; want %+v, %v", creds, found, tt.want, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestAWS_Refresh(t *testing.T) {
+	isolate(t)
+	expires := time.Now().Add(time.Minute) // within refreshMargin
+	var hits int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		_ = json.NewEncoder(w).Encode(map[string]any{"AccessKeyId": "ID", "SecretAccessKey": "secret", "Expiration": expires})
+	}))
+	defer srv.Close()
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", srv.URL)
+
+	var a AWS
+	for range 2 {
+		if _, _, err := a.Credentials(context.Background()); err != nil {
+			t.Fatalf("Credentials: %v", err)
+		}
+	}
+	if hits != 2 {
+		t.Fatalf("%d requests, want 2: expiring credentials cached", hits)
+	}
+
+	expires = time.Now().Add(time.Hour)
+	for range 2 {
+		if _, _, err := a.Credentials(context.Background()); err != nil {
+			t.Fatalf("Credentials: %v", err)
+		}
+	}
+	if hits != 3 {
+		t.Fatalf("%d requests, want 3: credentials not cached", hits)
+	}
+}
+
+// tokenServer serves OAuth tokens, passing each form posted to check.
+func tokenServer(t *testing.T, check func(t *testing.T, r *http.Request)) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse form: %v", err)
+		}
+		check(t, r)
+		_ = json.NewEncoder(w).Encode(map[string]any{"access_token": "access-token", "expires_in": 3600})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestGoogle(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemKey := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	const scope = "https://www.googleapis.com/auth/devstorage.read_write"
+
+	serviceAccount := func(t *testing.T) string {
+		srv := tokenServer(t, func(t *testing.T, r *http.Request) {
+			if r.Form.Get("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+				t.Errorf("grant_type = %q", r.Form.Get("grant_type"))
+			}
+			parts := strings.Split(r.Form.Get("assertion"), ".")
+			if len(parts) != 3 {
+				t.Fatalf("assertion %q", r.Form.Get("assertion"))
+			}
+			sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+			sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+			if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, sum[:], sig); err != nil {
+				t.Errorf("assertion signature: %v", err)
+			}
+			var claims map[string]any
+			b, _ := base64.RawURLEncoding.DecodeString(parts[1])
+			if err := json.Unmarshal(b, &claims); err != nil {
+				t.Fatalf("claims: %v", err)
+			}
+			if claims["iss"] != "ci@project.iam.gserviceaccount.com" || claims["scope"] != scope || claims["aud"] != "http://"+r.Host+"/token" {
+				t.Errorf("claims = %v", claims)
+			}
+		})
+		b, _ := json.Marshal(map[string]string{
+			"type": "service_account", "client_email": "ci@project.iam.gserviceaccount.com",
+			"private_key": pemKey, "token_uri": srv.URL + "/token",
+		})
+		return string(b)
+	}
+	authorizedUser := func(t *testing.T) string {
+		srv := tokenServer(t, func(t *testing.T, r *http.Request) {
+			if r.Form.Get("grant_type") != "refresh_token" || r.Form.Get("refresh_token") != "refresh" {
+				t.Errorf("form = %v", r.Form)
+			}
+		})
+		b, _ := json.Marshal(map[string]string{
+			"type": "authorized_user", "client_id": "id", "client_secret": "secret", "refresh_token": "refresh", "token_uri": srv.URL,
+		})
+		return string(b)
+	}
+
+	tests := []struct {
+		name      string
+		setup     func(t *testing.T, home string)
+		want      string
+		wantFound bool
+		wantErr   string
+	}{
+		{name: "none"},
+		{name: "env token", setup: func(t *testing.T, home string) {
+			t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "env-token")
+		}, want: "env-token", wantFound: true},
+		{name: "service account", setup: func(t *testing.T, home string) {
+			path := filepath.Join(t.TempDir(), "sa.json")
+			writeFile(t, path, serviceAccount(t))
+			t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", path)
+		}, want: "access-token", wantFound: true},
+		{name: "gcloud login", setup: func(t *testing.T, home string) {
+			dir := t.TempDir()
+			writeFile(t, filepath.Join(dir, "application_default_credentials.json"), authorizedUser(t))
+			t.Setenv("CLOUDSDK_CONFIG", dir)
+		}, want: "access-token", wantFound: true},
+		{name: "missing credentials file", setup: func(t *testing.T, home string) {
+			t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", filepath.Join(home, "missing.json"))
+		}, wantErr: "missing.json"},
+		{name: "unsupported type", setup: func(t *testing.T, home string) {
+			path := filepath.Join(home, "ext.json")
+			writeFile(t, path, `{"type": "external_account"}`)
+			t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", path)
+		}, wantErr: `credential type "external_account" isn't supported`},
+		{name: "metadata server", setup: func(t *testing.T, home string) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Metadata-Flavor", "Google")
+				if r.URL.Path != "/computeMetadata/v1/instance/service-accounts/default/token" {
+					return
+				}
+				if r.Header.Get("Metadata-Flavor") != "Google" || r.URL.Query().Get("scopes") != scope {
+					http.Error(w, "forbidden", http.StatusForbidden)
+					return
+				}
+				_, _ = w.Write([]byte(`{"access_token": "instance-token", "expires_in": 3599}`))
+			}))
+			t.Cleanup(srv.Close)
+			t.Setenv("NO_GCE_CHECK", "")
+			t.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(srv.URL, "http://"))
+		}, want: "instance-token", wantFound: true},
+		{name: "other cloud's metadata server", setup: func(t *testing.T, home string) {
+			srv := httptest.NewServer(http.NotFoundHandler())
+			t.Cleanup(srv.Close)
+			t.Setenv("NO_GCE_CHECK", "")
+			t.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(srv.URL, "http://"))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := isolate(t)
+			if tt.setup != nil {
+				tt.setup(t, home)
+			}
+
+			g := Google{Scope: scope}
+			tok, found, err := g.Token(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Token: %v", err)
+			}
+			if tok != tt.want || found != tt.wantFound {
+				t.Fatalf("got %q, %v; want %q, %v", tok, found, tt.want, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestAzure(t *testing.T) {
+	const resource = "https://storage.azure.com/"
+
+	// imds serves the VM's managed identity, if assigned
+	imds := func(assigned bool) func(t *testing.T) {
+		return func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Metadata") != "true" {
+					http.Error(w, `{"error": "bad_request"}`, http.StatusBadRequest)
+					return
+				}
+				if !assigned {
+					http.Error(w, `{"error": "invalid_request", "error_description": "Identity not found"}`, http.StatusBadRequest)
+					return
+				}
+				if r.URL.Query().Get("resource") != resource {
+					t.Errorf("resource = %q", r.URL.Query().Get("resource"))
+				}
+				_, _ = w.Write([]byte(`{"access_token": "vm-token", "expires_on": "1900000000"}`))
+			}))
+			t.Cleanup(srv.Close)
+			t.Setenv("AZURE_POD_IDENTITY_AUTHORITY_HOST", srv.URL)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		setup     func(t *testing.T)
+		want      string
+		wantFound bool
+		wantErr   string
+	}{
+		{name: "none"},
+		{name: "service principal", setup: func(t *testing.T) {
+			srv := tokenServer(t, func(t *testing.T, r *http.Request) {
+				if r.URL.Path != "/tenant/oauth2/v2.0/token" || r.Form.Get("client_secret") != "secret" ||
+					r.Form.Get("scope") != "https://storage.azure.com/.default" {
+					t.Errorf("%s: form = %v", r.URL.Path, r.Form)
+				}
+			})
+			t.Setenv("AZURE_AUTHORITY_HOST", srv.URL)
+			t.Setenv("AZURE_TENANT_ID", "tenant")
+			t.Setenv("AZURE_CLIENT_ID", "client")
+			t.Setenv("AZURE_CLIENT_SECRET", "secret")
+		}, want: "access-token", wantFound: true},
+		{name: "service principal without tenant", setup: func(t *testing.T) {
+			t.Setenv("AZURE_CLIENT_ID", "client")
+			t.Setenv("AZURE_CLIENT_SECRET", "secret")
+		}, wantErr: "AZURE_TENANT_ID and AZURE_CLIENT_ID must be set"},
+		{name: "workload identity", setup: func(t *testing.T) {
+			srv := tokenServer(t, func(t *testing.T, r *http.Request) {
+				if r.Form.Get("client_assertion") != "federated" {
+					t.Errorf("form = %v", r.Form)
+				}
+			})
+			tokenFile := filepath.Join(t.TempDir(), "token")
+			writeFile(t, tokenFile, "federated")
+			t.Setenv("AZURE_AUTHORITY_HOST", srv.URL)
+			t.Setenv("AZURE_TENANT_ID", "tenant")
+			t.Setenv("AZURE_CLIENT_ID", "client")
+			t.Setenv("AZURE_FEDERATED_TOKEN_FILE", tokenFile)
+		}, want: "access-token", wantFound: true},
+		{name: "app service", setup: func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("X-IDENTITY-HEADER") != "secret-header" {
+					http.Error(w, "unauthorized", http.StatusUnauthorized)
+					return
+				}
+				_, _ = w.Write([]byte(`{"access_token": "app-token", "expires_on": 1900000000}`))
+			}))
+			t.Cleanup(srv.Close)
+			t.Setenv("IDENTITY_ENDPOINT", srv.URL)
+			t.Setenv("IDENTITY_HEADER", "secret-header")
+		}, want: "app-token", wantFound: true},
+		{name: "VM managed identity", setup: imds(true), want: "vm-token", wantFound: true},
+		{name: "VM without identity", setup: imds(false)},
+		{name: "VM without the user-assigned identity", setup: func(t *testing.T) {
+			imds(false)(t)
+			t.Setenv("AZURE_CLIENT_ID", "client")
+		}, wantErr: "Identity not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolate(t)
+			if tt.setup != nil {
+				tt.setup(t)
+			}
+
+			a := Azure{Resource: resource}
+			tok, found, err := a.Token(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Token: %v", err)
+			}
+			if tok != tt.want || found != tt.wantFound {
+				t.Fatalf("got %q, %v; want %q, %v", tok, found, tt.want, tt.wantFound)
+			}
+		})
+	}
+}
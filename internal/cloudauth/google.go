@@ -0,0 +1,248 @@
+package cloudauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// googleTokenURL is the OAuth token endpoint of authorized users without a
+// token_uri.
+const googleTokenURL = "https://oauth2.googleapis.com/token"
+
+// Google resolves Google Cloud OAuth access tokens, from the first of:
+//
+//   - GOOGLE_OAUTH_ACCESS_TOKEN;
+//   - the application default credentials at GOOGLE_APPLICATION_CREDENTIALS,
+//     else those written by gcloud auth application-default login: service
+//     account keys and authorized users;
+//   - the service account of the instance, from the metadata server at
+//     GCE_METADATA_HOST or 169.254.169.254, unless NO_GCE_CHECK is true.
+//
+// Other credential types, e.g. external accounts, are an error.
+type Google struct {
+	Scope  string       // OAuth scope of the tokens
+	Client *http.Client // for token endpoints; if nil: http.DefaultClient
+
+	cache cache[string]
+}
+
+// Token returns an access token, and whether there is any.
+func (g *Google) Token(ctx context.Context) (string, bool, error) {
+	return g.cache.get(ctx, g.resolve)
+}
+
+func (g *Google) resolve(ctx context.Context) (string, bool, time.Time, error) {
+	if tok := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); tok != "" {
+		return tok, true, time.Time{}, nil
+	}
+	if tok, found, expires, err := g.applicationDefault(ctx); err != nil || found {
+		return tok, found, expires, err
+	}
+	return g.metadata(ctx)
+}
+
+// googleCredentials is an application default credentials file.
+type googleCredentials struct {
+	Type string `json:"type"`
+
+	// service_account
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+
+	// authorized_user
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// oauthToken is the response of an OAuth token endpoint.
+type oauthToken struct {
+	AccessToken string  `json:"access_token"`
+	ExpiresIn   seconds `json:"expires_in"`
+}
+
+func (t *oauthToken) token() (string, bool, time.Time, error) {
+	if t.AccessToken == "" {
+		return "", false, time.Time{}, errors.New("no access token in the response")
+	}
+	return t.AccessToken, true, t.ExpiresIn.expiresIn(), nil
+}
+
+// applicationDefault exchanges the application default credentials for a
+// token.
+func (g *Google) applicationDefault(ctx context.Context) (string, bool, time.Time, error) {
+	path, explicit := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"), true
+	if path == "" {
+		path, explicit = gcloudConfigPath("application_default_credentials.json"), false
+	}
+	data, err := readConfig(path, explicit)
+	if err != nil || data == nil {
+		return "", false, time.Time{}, err
+	}
+
+	tok, found, expires, err := g.exchange(ctx, data)
+	if err != nil {
+		err = fmt.Errorf("Google credentials %s: %w", path, err)
+	}
+	return tok, found, expires, err
+}
+
+func (g *Google) exchange(ctx context.Context, data []byte) (string, bool, time.Time, error) {
+	var c googleCredentials
+	if err := json.Unmarshal(data, &c); err != nil {
+		return "", false, time.Time{}, err
+	}
+
+	var (
+		endpoint = c.TokenURI
+		form     url.Values
+	)
+	switch c.Type {
+	case "service_account":
+		if endpoint == "" {
+			endpoint = googleTokenURL
+		}
+		assertion, err := c.assertion(endpoint, g.Scope, time.Now())
+		if err != nil {
+			return "", false, time.Time{}, err
+		}
+		form = url.Values{
+			"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+			"assertion":  {assertion},
+		}
+	case "authorized_user":
+		if endpoint == "" {
+			endpoint = googleTokenURL
+		}
+		form = url.Values{
+			"grant_type":    {"refresh_token"},
+			"client_id":     {c.ClientID},
+			"client_secret": {c.ClientSecret},
+			"refresh_token": {c.RefreshToken},
+		}
+	default:
+		return "", false, time.Time{}, fmt.Errorf("credential type %q isn't supported", c.Type)
+	}
+
+	var t oauthToken
+	if err := postForm(ctx, g.Client, endpoint, form, &t); err != nil {
+		return "", false, time.Time{}, err
+	}
+	return t.token()
+}
+
+// assertion returns the JWT a service account exchanges for a token of scope
+// at aud.
+func (c *googleCredentials) assertion(aud, scope string, now time.Time) (string, error) {
+	block, _ := pem.Decode([]byte(c.PrivateKey))
+	if block == nil {
+		return "", errors.New("no PEM private key")
+	}
+	var key *rsa.PrivateKey
+	if k, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		rk, ok := k.(*rsa.PrivateKey)
+		if !ok {
+			return "", errors.New("private key is not RSA")
+		}
+		key = rk
+	} else if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+		return "", fmt.Errorf("parse private key: %w", err)
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": c.PrivateKeyID})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		"iss":   c.ClientEmail,
+		"scope": scope,
+		"aud":   aud,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	signed := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + enc.EncodeToString(sig), nil
+}
+
+// gcloudConfigPath returns the path of file in gcloud's configuration
+// directory: CLOUDSDK_CONFIG, else %APPDATA%\gcloud on Windows and
+// ~/.config/gcloud elsewhere.
+func gcloudConfigPath(file string) string {
+	if dir := os.Getenv("CLOUDSDK_CONFIG"); dir != "" {
+		return filepath.Join(dir, file)
+	}
+	if runtime.GOOS == "windows" {
+		if dir := os.Getenv("APPDATA"); dir != "" {
+			return filepath.Join(dir, "gcloud", file)
+		}
+		return ""
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "gcloud", file)
+}
+
+// metadata returns a token of the instance's service account.
+func (g *Google) metadata(ctx context.Context) (string, bool, time.Time, error) {
+	if strings.EqualFold(os.Getenv("NO_GCE_CHECK"), "true") {
+		return "", false, time.Time{}, nil
+	}
+	host := os.Getenv("GCE_METADATA_HOST")
+	if host == "" {
+		host = "169.254.169.254"
+	}
+	resp, err := ping(ctx, "http://"+host)
+	if errors.Is(err, errNoService) || err == nil && resp.Header.Get("Metadata-Flavor") != "Google" {
+		// not on GCE
+		return "", false, time.Time{}, nil
+	}
+
+	endpoint := "http://" + host + "/computeMetadata/v1/instance/service-accounts/default/token"
+	if g.Scope != "" {
+		endpoint += "?" + url.Values{"scopes": {g.Scope}}.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", false, time.Time{}, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	var t oauthToken
+	err = fetchJSON(metadataClient, req, &t)
+	switch {
+	case hasStatus(err, http.StatusNotFound):
+		// no service account
+		return "", false, time.Time{}, nil
+	case err != nil:
+		return "", false, time.Time{}, fmt.Errorf("Google metadata server: %w", err)
+	}
+	return t.token()
+}
@@ -0,0 +1,97 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/napalu/gosafedate/version"
+)
+
+// Feed is a metadata document listing several releases rather than only
+// the latest, so clients can install or roll back to a specific version.
+// A JSON array of releases is accepted as well.
+type Feed struct {
+	SchemaVersion string     `json:"schemaVersion,omitempty"` // default of releases without one
+	Releases      []Metadata `json:"releases"`
+}
+
+// Decode reads a metadata document, a single release, a Feed or an array of
+// releases, and returns its releases after validating them.
+func Decode(r io.Reader) ([]Metadata, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var releases []Metadata
+	switch trimmed := bytes.TrimSpace(data); {
+	case len(trimmed) > 0 && trimmed[0] == '[':
+		err = json.Unmarshal(trimmed, &releases)
+	default:
+		var doc struct {
+			Metadata
+			Releases *[]Metadata `json:"releases"`
+		}
+		if err = json.Unmarshal(trimmed, &doc); err != nil {
+			break
+		}
+		if doc.Releases == nil {
+			releases = []Metadata{doc.Metadata}
+			break
+		}
+		releases = *doc.Releases
+		for i := range releases {
+			if releases[i].SchemaVersion == "" {
+				releases[i].SchemaVersion = doc.SchemaVersion
+			}
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse metadata: %w", err)
+	}
+
+	if len(releases) == 0 {
+		return nil, fmt.Errorf("%w: no releases", ErrInvalid)
+	}
+	for i := range releases {
+		if err = releases[i].Validate(); err != nil {
+			if len(releases) > 1 {
+				return nil, fmt.Errorf("release %d: %w", i, err)
+			}
+			return nil, err
+		}
+	}
+	return releases, nil
+}
+
+// Sort sorts releases by ascending version. All versions must be semantic
+// versions, optionally prefixed by "v".
+func Sort(releases []Metadata) error {
+	keys := make(map[string]*version.Semver, len(releases))
+	for _, m := range releases {
+		v, err := version.NewSemVer(m.Version, "v")
+		if err != nil {
+			return fmt.Errorf("%w: version %q: %v", ErrInvalid, m.Version, err)
+		}
+		keys[m.Version] = v
+	}
+	slices.SortStableFunc(releases, func(a, b Metadata) int {
+		return keys[a.Version].Compare(keys[b.Version])
+	})
+	return nil
+}
+
+// Latest returns the release with the highest version; see Sort.
+func Latest(releases []Metadata) (*Metadata, error) {
+	if len(releases) == 1 {
+		return &releases[0], nil
+	}
+	sorted := slices.Clone(releases)
+	if err := Sort(sorted); err != nil {
+		return nil, err
+	}
+	return &sorted[len(sorted)-1], nil
+}
@@ -0,0 +1,73 @@
+package metadata_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/napalu/gosafedate/metadata"
+)
+
+func TestDecode(t *testing.T) {
+	sum := strings.Repeat("ab", 32)
+	release := func(v string) string {
+		return `{"version":"` + v + `","sha256":"` + sum + `","downloadUrl":"myapp-` + v + `.gz"}`
+	}
+
+	tests := []struct {
+		name     string
+		in       string
+		versions []string
+		latest   string
+		wantErr  error
+	}{
+		{name: "single release", in: release("v1.2.3"), versions: []string{"v1.2.3"}, latest: "v1.2.3"},
+		{name: "feed", in: `{"schemaVersion":"1.0","releases":[` + release("v1.2.3") + `,` + release("v1.10.0") + `,` + release("v1.9.0") + `]}`,
+			versions: []string{"v1.2.3", "v1.10.0", "v1.9.0"}, latest: "v1.10.0"},
+		{name: "array", in: ` [` + release("1.0.0") + `,` + release("0.9.0") + `]`, versions: []string{"1.0.0", "0.9.0"}, latest: "1.0.0"},
+		{name: "empty feed", in: `{"releases":[]}`, wantErr: metadata.ErrInvalid},
+		{name: "invalid release", in: `[` + release("v1.2.3") + `,{"version":"v1.2.4"}]`, wantErr: metadata.ErrInvalid},
+		{name: "feed schema version", in: `{"schemaVersion":"2.0","releases":[` + release("v1.2.3") + `]}`, wantErr: metadata.ErrSchemaVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			releases, err := metadata.Decode(strings.NewReader(tt.in))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Decode error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+
+			var got []string
+			for _, m := range releases {
+				got = append(got, m.Version)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.versions, ",") {
+				t.Fatalf("Decode versions = %v, want %v", got, tt.versions)
+			}
+
+			latest, err := metadata.Latest(releases)
+			if err != nil || latest.Version != tt.latest {
+				t.Fatalf("Latest = %v, %v; want %s", latest, err, tt.latest)
+			}
+		})
+	}
+}
+
+func TestSort(t *testing.T) {
+	releases := []metadata.Metadata{{Version: "v2.0.0"}, {Version: "v1.10.1"}, {Version: "1.2.0"}}
+	if err := metadata.Sort(releases); err != nil {
+		t.Fatalf("Sort: %v", err)
+	}
+	if releases[0].Version != "1.2.0" || releases[2].Version != "v2.0.0" {
+		t.Fatalf("unexpected order: %+v", releases)
+	}
+
+	if err := metadata.Sort([]metadata.Metadata{{Version: "latest"}}); !errors.Is(err, metadata.ErrInvalid) {
+		t.Fatalf("Sort of an invalid version: %v", err)
+	}
+}
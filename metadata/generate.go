@@ -0,0 +1,135 @@
+package metadata
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/napalu/gosafedate/checksum"
+	"github.com/napalu/gosafedate/signing"
+)
+
+// GenerateOptions customize GenerateWith.
+type GenerateOptions struct {
+	BaseURL    string // if set: DownloadURL is BaseURL/<artifact name>; if empty: the name, relative to the metadata URL
+	Algorithm  string // checksum algorithm, see package checksum; if empty: SHA-256
+	BinaryPath string // the binary the artifact installs; required for archives and for compressions other than gzip and bzip2
+}
+
+// Generate describes the release artifact at artifactPath as version: it
+// computes the checksums and size, signs "version+checksum" with signer (nil
+// leaves the metadata unsigned) and names the artifact as DownloadURL.
+// Compression follows the artifact's extension; a file without a known
+// extension is a raw binary.
+func Generate(artifactPath, version string, signer signing.Signer) (*Metadata, error) {
+	return GenerateWith(artifactPath, version, signer, GenerateOptions{})
+}
+
+// GenerateWith is Generate with options.
+func GenerateWith(artifactPath, version string, signer signing.Signer, opts GenerateOptions) (*Metadata, error) {
+	fi, err := os.Stat(artifactPath)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", artifactPath)
+	}
+
+	name := filepath.Base(artifactPath)
+	m := &Metadata{
+		SchemaVersion: SchemaVersion,
+		Version:       version,
+		DownloadURL:   name,
+		Size:          fi.Size(),
+	}
+	if opts.BaseURL != "" {
+		m.DownloadURL = strings.TrimSuffix(opts.BaseURL, "/") + "/" + url.PathEscape(name)
+	}
+
+	compression, archive := artifactFormat(name)
+	if compression == "none" {
+		m.Compression = "none"
+	}
+
+	artifactSum, err := checksum.File(artifactPath, opts.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case opts.BinaryPath != "":
+		if m.Checksum, err = checksum.File(opts.BinaryPath, opts.Algorithm); err != nil {
+			return nil, err
+		}
+	case archive:
+		return nil, fmt.Errorf("%s is an archive: the binary it installs is required", name)
+	case compression == "none":
+		m.Checksum = artifactSum
+	default:
+		if m.Checksum, err = decompressedChecksum(artifactPath, compression, opts.Algorithm); err != nil {
+			return nil, err
+		}
+	}
+	if m.Checksum != artifactSum {
+		m.ChecksumCompressed = artifactSum
+	}
+
+	if signer != nil {
+		if err = m.Sign(signer); err != nil {
+			return nil, err
+		}
+	}
+	if err = m.Validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// artifactFormat derives the compression and whether name is an archive
+// from its extension, as the updater does.
+func artifactFormat(name string) (compression string, archive bool) {
+	archive = strings.HasSuffix(name, ".zip") || strings.HasSuffix(name, ".tgz") || strings.Contains(name, ".tar")
+	switch ext := filepath.Ext(name); {
+	case ext == ".gz" || ext == ".tgz":
+		return "gzip", archive
+	case ext == ".bz2":
+		return "bzip2", archive
+	case ext == ".xz":
+		return "xz", archive
+	case ext == ".zst":
+		return "zstd", archive
+	case ext == ".zip":
+		return "", archive
+	}
+	return "none", archive
+}
+
+func decompressedChecksum(path, compression, alg string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var r io.Reader
+	switch compression {
+	case "gzip":
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return "", err
+		}
+		defer zr.Close()
+		r = zr
+	case "bzip2":
+		r = bzip2.NewReader(f)
+	default:
+		return "", errors.New(compression + " artifacts require the binary they install")
+	}
+	return checksum.Reader(r, alg)
+}
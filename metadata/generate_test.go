@@ -0,0 +1,82 @@
+package metadata_test
+
+import (
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/napalu/gosafedate/checksum"
+	_ "github.com/napalu/gosafedate/checksum/blake3"
+	"github.com/napalu/gosafedate/metadata"
+	"github.com/napalu/gosafedate/signing"
+)
+
+func TestGenerate(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	dir := t.TempDir()
+	bin := []byte("new-binary")
+	binPath := filepath.Join(dir, "myapp")
+	if err = os.WriteFile(binPath, bin, 0o755); err != nil {
+		t.Fatalf("write binary: %v", err)
+	}
+
+	gzPath := filepath.Join(dir, "myapp-v1.2.3.gz")
+	f, err := os.Create(gzPath)
+	if err != nil {
+		t.Fatalf("create artifact: %v", err)
+	}
+	zw := gzip.NewWriter(f)
+	_, _ = zw.Write(bin)
+	_ = zw.Close()
+	_ = f.Close()
+	gzInfo, _ := os.Stat(gzPath)
+
+	m, err := metadata.Generate(gzPath, "v1.2.3", signing.KeySigner(priv))
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	sum := fmt.Sprintf("%x", sha256.Sum256(bin))
+	gzSum, _ := checksum.File(gzPath, checksum.SHA256)
+	if m.Checksum != sum || m.ChecksumCompressed != gzSum || m.Size != gzInfo.Size() ||
+		m.DownloadURL != "myapp-v1.2.3.gz" || m.Compression != "" || m.SchemaVersion != metadata.SchemaVersion {
+		t.Fatalf("unexpected metadata %+v", m)
+	}
+	if ok, err := signing.VerifyRaw(pub, "v1.2.3+"+sum, m.Signature); !ok || err != nil {
+		t.Fatalf("signature does not verify: %v", err)
+	}
+
+	// raw binary, BLAKE3, absolute URL, unsigned
+	m, err = metadata.GenerateWith(binPath, "v1.2.3", nil, metadata.GenerateOptions{
+		BaseURL:   "https://repo.example.com/myapp/",
+		Algorithm: checksum.BLAKE3,
+	})
+	if err != nil {
+		t.Fatalf("GenerateWith: %v", err)
+	}
+	b3, _ := checksum.File(binPath, checksum.BLAKE3)
+	if m.Checksum != b3 || m.ChecksumCompressed != "" || m.Compression != "none" ||
+		m.DownloadURL != "https://repo.example.com/myapp/myapp" || m.Signature != "" {
+		t.Fatalf("unexpected metadata %+v", m)
+	}
+
+	// archives need the binary they install
+	zipPath := filepath.Join(dir, "myapp.zip")
+	if err = os.WriteFile(zipPath, []byte("PK"), 0o644); err != nil {
+		t.Fatalf("write archive: %v", err)
+	}
+	if _, err = metadata.Generate(zipPath, "v1.2.3", nil); err == nil {
+		t.Fatal("Generate of an archive without the binary succeeded")
+	}
+	m, err = metadata.GenerateWith(zipPath, "v1.2.3", nil, metadata.GenerateOptions{BinaryPath: binPath})
+	if err != nil || m.Checksum != sum || m.Compression != "" {
+		t.Fatalf("GenerateWith archive = %+v, %v", m, err)
+	}
+}
@@ -0,0 +1,69 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// ManifestName is the name of the manifest at the root of a bundle artifact.
+const ManifestName = "gosafedate-manifest.json"
+
+// Manifest lists the files of a bundle artifact. The metadata checksum of a
+// bundle is the SHA-256 of its manifest, so the signature over
+// "version+sha256" covers every file listed here.
+type Manifest struct {
+	Files []ManifestFile `json:"files"`
+}
+
+// ManifestFile is a single file of a bundle, relative to the install directory.
+type ManifestFile struct {
+	Path     string `json:"path"` // slash-separated
+	Checksum string `json:"sha256"`
+}
+
+// Fleet lists the releases of a suite of tools, e.g. an internal CLI suite
+// distributed as one unit. Every artifact is a regular Metadata whose
+// signature covers it, but not the tool it belongs to: the signatures of the
+// fleet are over the compact JSON encoding of Tools, so a release can't be
+// listed under another tool's name.
+type Fleet struct {
+	Tools      []FleetTool `json:"tools"`
+	Signatures []string    `json:"signatures,omitempty"` // base64, see SigningMessage
+
+	signed []byte // tools as read by DecodeFleet
+}
+
+// FleetTool is one tool of a Fleet.
+type FleetTool struct {
+	Name      string              `json:"name"`      // binary name without the ".exe" suffix
+	Platforms map[string]Metadata `json:"platforms"` // keyed by "GOOS/GOARCH"
+}
+
+// DecodeFleet reads a fleet document. Its signatures are verified against
+// the tools as read, see SigningMessage, so they hold whatever fields of
+// the releases this version of the package knows about.
+func DecodeFleet(r io.Reader) (*Fleet, error) {
+	var doc struct {
+		Tools      json.RawMessage `json:"tools"`
+		Signatures []string        `json:"signatures"`
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parse fleet: %w", err)
+	}
+	if len(doc.Tools) == 0 {
+		return nil, fmt.Errorf("%w: no tools", ErrInvalid)
+	}
+
+	f := &Fleet{Signatures: doc.Signatures}
+	if err := json.Unmarshal(doc.Tools, &f.Tools); err != nil {
+		return nil, fmt.Errorf("parse fleet: %w", err)
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, doc.Tools); err != nil {
+		return nil, fmt.Errorf("parse fleet: %w", err)
+	}
+	f.signed = compact.Bytes()
+	return f, nil
+}
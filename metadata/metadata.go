@@ -1,8 +1,56 @@
 package metadata
 
+// Metadata describes a release. Checksums are hex SHA-256 digests, or
+// "algorithm:digest" for the other algorithms of package checksum; the
+// JSON keys keep their historical "sha256" names.
 type Metadata struct {
-	Version     string `json:"version"`
-	Checksum    string `json:"sha256"`
-	Signature   string `json:"signature"`
+	SchemaVersion string `json:"schemaVersion,omitempty"` // if empty: 1.0, see SchemaVersion
+	Version       string `json:"version"`
+	Checksum      string `json:"sha256"` // of the binary
+	Signature     string `json:"signature"`
+	DownloadURL   string `json:"downloadUrl"`
+	Size          int64  `json:"size,omitempty"`        // size of the download in bytes, enforced; 0 if unknown
+	Compression   string `json:"compression,omitempty"` // if empty: derived from DownloadURL, default gzip
+	Archive       string `json:"archive,omitempty"`     // "tar" or "zip"; if empty: derived from DownloadURL
+	Bundle        bool   `json:"bundle,omitempty"`      // archive is a bundle described by a Manifest
+	Mandatory     bool   `json:"mandatory,omitempty"`   // can't be skipped or snoozed by the user
+
+	// CompatibleWith optionally restricts the installed versions updated to
+	// this release, e.g. "^1.0.0" to only update within major version 1; see
+	// version.Constraint.
+	CompatibleWith string `json:"compatibleWith,omitempty"`
+
+	// Signatures optionally holds further signatures of "version+sha256" by
+	// other keys, for releases requiring several signers.
+	Signatures []string `json:"signatures,omitempty"`
+
+	// Patches optionally lists binary diffs to Version from previous versions.
+	Patches []Patch `json:"patches,omitempty"`
+
+	// ChecksumCompressed is the optional checksum of the download itself. It is
+	// checked before decompressing so corrupted downloads are rejected early.
+	ChecksumCompressed string `json:"sha256Compressed,omitempty"`
+
+	// TransparencyLog optionally records the entry of Signature in a
+	// transparency log, e.g. Rekor, as written by "gosafedate release attest".
+	TransparencyLog *LogEntry `json:"transparencyLog,omitempty"`
+}
+
+// LogEntry is a transparency log entry with the log's signed promise to
+// include it (its signed entry timestamp).
+type LogEntry struct {
+	LogIndex             int64  `json:"logIndex"`
+	LogID                string `json:"logID"`                // hex
+	IntegratedTime       int64  `json:"integratedTime"`       // Unix time
+	Body                 string `json:"body"`                 // base64 canonicalized entry
+	SignedEntryTimestamp string `json:"signedEntryTimestamp"` // base64
+}
+
+// Patch is a BSDIFF40 binary diff turning the binary of FromVersion into the
+// binary described by the enclosing Metadata.
+type Patch struct {
+	FromVersion string `json:"fromVersion"`
 	DownloadURL string `json:"downloadUrl"`
+	Checksum    string `json:"sha256,omitempty"` // of the patch file
+	Size        int64  `json:"size,omitempty"`
 }
@@ -0,0 +1,22 @@
+package metadata
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Root is a key manifest: the list of valid release keys, signed by a
+// long-term root key so release keys can be rotated without shipping a new
+// binary. The signatures are over the compact JSON encoding of Signed.
+type Root struct {
+	Signed     json.RawMessage `json:"signed"`     // RootKeys
+	Signatures []string        `json:"signatures"` // base64
+}
+
+// RootKeys lists the valid release keys of a Root.
+type RootKeys struct {
+	Version   int       `json:"version"` // increases with every rotation; older manifests are rejected
+	Expires   time.Time `json:"expires,omitzero"`
+	Keys      []string  `json:"keys"`                // base64 public keys in their embedded form, see signing.PublicKeyFromFile
+	Threshold int       `json:"threshold,omitempty"` // signatures required per release
+}
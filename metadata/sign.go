@@ -0,0 +1,108 @@
+package metadata
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/napalu/gosafedate/signing"
+)
+
+// SigningMessage returns the message a release signature covers:
+// "version+checksum". The checksum is that of the installed binary, so the
+// signature holds whatever the artifact's compression or location.
+func (m *Metadata) SigningMessage() string {
+	return m.Version + "+" + m.Checksum
+}
+
+// Sign signs m with signer. The first signature becomes Signature; further
+// ones, e.g. by the other signers of a release requiring several, are
+// appended to Signatures.
+func (m *Metadata) Sign(signer signing.Signer) error {
+	if m.Version == "" || m.Checksum == "" {
+		return errors.New("metadata version and checksum required to sign")
+	}
+	sig, err := signing.SignWith(signer, m.SigningMessage())
+	if err != nil {
+		return err
+	}
+	if m.Signature == "" {
+		m.Signature = sig
+	} else {
+		m.Signatures = append(m.Signatures, sig)
+	}
+	return nil
+}
+
+// Verify reports whether Signature or one of Signatures verifies with
+// pubKey, in any form accepted by signing.VerifyRaw. The error is that of
+// the first signature failing to verify, if none does.
+func (m *Metadata) Verify(pubKey []byte) (bool, error) {
+	var firstErr error
+	for _, sig := range m.AllSignatures() {
+		ok, err := signing.VerifyRaw(pubKey, m.SigningMessage(), sig)
+		if ok {
+			return true, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return false, firstErr
+}
+
+// AllSignatures returns Signature, if set, followed by Signatures.
+func (m *Metadata) AllSignatures() []string {
+	var sigs []string
+	if m.Signature != "" {
+		sigs = append(sigs, m.Signature)
+	}
+	return append(sigs, m.Signatures...)
+}
+
+// SigningMessage returns the message the signatures of f cover: the compact
+// JSON encoding of its tools, as read by DecodeFleet if f was.
+func (f *Fleet) SigningMessage() (string, error) {
+	if f.signed != nil {
+		return string(f.signed), nil
+	}
+	b, err := json.Marshal(f.Tools)
+	return string(b), err
+}
+
+// Sign appends the signature of f by signer to Signatures. Signatures must
+// be cleared whenever Tools changes.
+func (f *Fleet) Sign(signer signing.Signer) error {
+	if len(f.Tools) == 0 {
+		return errors.New("fleet tools required to sign")
+	}
+	msg, err := f.SigningMessage()
+	if err != nil {
+		return err
+	}
+	sig, err := signing.SignWith(signer, msg)
+	if err != nil {
+		return err
+	}
+	f.Signatures = append(f.Signatures, sig)
+	return nil
+}
+
+// Verify reports whether one of Signatures verifies with pubKey, as
+// Metadata.Verify.
+func (f *Fleet) Verify(pubKey []byte) (bool, error) {
+	msg, err := f.SigningMessage()
+	if err != nil {
+		return false, err
+	}
+	var firstErr error
+	for _, sig := range f.Signatures {
+		ok, err := signing.VerifyRaw(pubKey, msg, sig)
+		if ok {
+			return true, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return false, firstErr
+}
@@ -0,0 +1,94 @@
+package metadata_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/napalu/gosafedate/metadata"
+	"github.com/napalu/gosafedate/signing"
+)
+
+func TestMetadata_SignVerify(t *testing.T) {
+	var pubs []ed25519.PublicKey
+	var privs []ed25519.PrivateKey
+	for range 3 {
+		pub, priv, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatalf("generate key: %v", err)
+		}
+		pubs, privs = append(pubs, pub), append(privs, priv)
+	}
+
+	m := &metadata.Metadata{Version: "v1.2.3", Checksum: strings.Repeat("ab", 32)}
+	if got := m.SigningMessage(); got != "v1.2.3+"+m.Checksum {
+		t.Fatalf("SigningMessage = %q", got)
+	}
+
+	for _, priv := range privs[:2] {
+		if err := m.Sign(signing.KeySigner(priv)); err != nil {
+			t.Fatalf("Sign: %v", err)
+		}
+	}
+	if m.Signature == "" || len(m.Signatures) != 1 {
+		t.Fatalf("signatures not recorded: %+v", m)
+	}
+
+	for i, pub := range pubs {
+		ok, err := m.Verify(pub)
+		if want := i < 2; ok != want {
+			t.Errorf("Verify with key %d = %v, %v; want %v", i, ok, err, want)
+		}
+	}
+
+	// the signature covers the checksum
+	m.Checksum = strings.Repeat("cd", 32)
+	if ok, _ := m.Verify(pubs[0]); ok {
+		t.Fatal("Verify succeeded after changing the checksum")
+	}
+}
+
+func TestFleet_SignVerify(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	release := metadata.Metadata{Version: "v1.2.3", Checksum: strings.Repeat("ab", 32), DownloadURL: "deploy.gz"}
+	f := &metadata.Fleet{Tools: []metadata.FleetTool{
+		{Name: "deploy", Platforms: map[string]metadata.Metadata{"linux/amd64": release}},
+		{Name: "lint", Platforms: map[string]metadata.Metadata{"linux/amd64": {Version: "v1.0.0", Checksum: strings.Repeat("cd", 32)}}},
+	}}
+	if err = f.Sign(signing.KeySigner(priv)); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	// indented as written by release pack
+	doc, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := metadata.DecodeFleet(bytes.NewReader(doc))
+	if err != nil {
+		t.Fatalf("DecodeFleet: %v", err)
+	}
+	if ok, err := decoded.Verify(pub); !ok {
+		t.Fatalf("Verify = %v, %v", ok, err)
+	}
+
+	// the signature covers the tool names
+	swapped := strings.Replace(string(doc), `"deploy"`, `"lint2"`, 1)
+	decoded, err = metadata.DecodeFleet(strings.NewReader(swapped))
+	if err != nil {
+		t.Fatalf("DecodeFleet: %v", err)
+	}
+	if ok, _ := decoded.Verify(pub); ok {
+		t.Fatal("Verify succeeded after renaming a tool")
+	}
+
+	if _, err = metadata.DecodeFleet(strings.NewReader(`{"signatures": []}`)); !errors.Is(err, metadata.ErrInvalid) {
+		t.Fatalf("DecodeFleet without tools = %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package metadata
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/napalu/gosafedate/checksum"
+	"github.com/napalu/gosafedate/version"
+)
+
+// SchemaVersion is the version of the metadata format described by this
+// package. Documents without a schemaVersion are 1.0. A new minor version
+// only adds optional fields, so any 1.x document is accepted; other major
+// versions are rejected.
+const SchemaVersion = "1.0"
+
+var (
+	// ErrInvalid is returned by Validate for malformed metadata.
+	ErrInvalid = errors.New("invalid metadata")
+	// ErrSchemaVersion is returned by Validate for metadata of an unknown
+	// major schema version.
+	ErrSchemaVersion = errors.New("unsupported metadata schema version")
+)
+
+// Validate checks that m is well-formed: the required fields are set,
+// checksums are hex digests of a known algorithm, signatures are base64 and
+// URLs parse. It doesn't verify signatures or checksums. All problems found
+// are reported, each wrapping ErrInvalid.
+func (m *Metadata) Validate() error {
+	if err := checkSchemaVersion(m.SchemaVersion); err != nil {
+		return err
+	}
+
+	var errs []error
+	invalid := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%w: "+format, append([]any{ErrInvalid}, args...)...))
+	}
+
+	if m.Version == "" {
+		invalid("version missing")
+	}
+	if m.Checksum == "" {
+		invalid("sha256 missing")
+	} else if err := checkChecksum(m.Checksum); err != nil {
+		invalid("sha256: %v", err)
+	}
+	if m.ChecksumCompressed != "" {
+		if err := checkChecksum(m.ChecksumCompressed); err != nil {
+			invalid("sha256Compressed: %v", err)
+		}
+	}
+	if m.Signature != "" {
+		if _, err := base64.StdEncoding.DecodeString(m.Signature); err != nil {
+			invalid("signature is not base64")
+		}
+	}
+	for i, sig := range m.Signatures {
+		if _, err := base64.StdEncoding.DecodeString(sig); err != nil {
+			invalid("signatures[%d] is not base64", i)
+		}
+	}
+	if m.DownloadURL == "" {
+		invalid("downloadUrl missing")
+	} else if err := checkURL(m.DownloadURL); err != nil {
+		invalid("downloadUrl: %v", err)
+	}
+	if m.Size < 0 {
+		invalid("negative size")
+	}
+	if m.CompatibleWith != "" {
+		if _, err := version.NewConstraint(m.CompatibleWith); err != nil {
+			invalid("compatibleWith: %v", err)
+		}
+	}
+
+	for i, p := range m.Patches {
+		if p.FromVersion == "" {
+			invalid("patches[%d]: fromVersion missing", i)
+		}
+		if err := checkURL(p.DownloadURL); p.DownloadURL == "" || err != nil {
+			invalid("patches[%d]: invalid downloadUrl %q", i, p.DownloadURL)
+		}
+		if p.Checksum != "" {
+			if err := checkChecksum(p.Checksum); err != nil {
+				invalid("patches[%d]: sha256: %v", i, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func checkSchemaVersion(v string) error {
+	if v == "" {
+		return nil
+	}
+	major, _, _ := strings.Cut(v, ".")
+	if n, err := strconv.Atoi(major); err != nil || n != 1 {
+		return fmt.Errorf("%w: %s (supported: %s)", ErrSchemaVersion, v, SchemaVersion)
+	}
+	return nil
+}
+
+// checkChecksum checks that sum is a hex digest of the size of its algorithm.
+func checkChecksum(sum string) error {
+	alg, err := checksum.Algorithm(sum)
+	if err != nil {
+		return err
+	}
+	h, _ := checksum.New(alg)
+	digest := sum[strings.IndexByte(sum, ':')+1:]
+	if _, err = hex.DecodeString(digest); err != nil || len(digest) != 2*h.Size() {
+		return fmt.Errorf("not a %s hex digest", alg)
+	}
+	return nil
+}
+
+func checkURL(s string) error {
+	if strings.TrimSpace(s) != s {
+		return errors.New("surrounding whitespace")
+	}
+	_, err := url.Parse(s)
+	return err
+}
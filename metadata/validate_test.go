@@ -0,0 +1,56 @@
+package metadata_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/napalu/gosafedate/metadata"
+)
+
+func TestMetadata_Validate(t *testing.T) {
+	valid := func() metadata.Metadata {
+		return metadata.Metadata{
+			Version:     "v1.2.3",
+			Checksum:    strings.Repeat("ab", 32),
+			Signature:   "c2lnbmF0dXJl",
+			DownloadURL: "myapp-v1.2.3.gz",
+		}
+	}
+
+	for _, tc := range []struct {
+		name    string
+		modify  func(m *metadata.Metadata)
+		wantErr error
+	}{
+		{name: "valid", modify: func(m *metadata.Metadata) {}},
+		{name: "minor schema version", modify: func(m *metadata.Metadata) { m.SchemaVersion = "1.7" }},
+		{name: "prefixed checksum", modify: func(m *metadata.Metadata) { m.Checksum = "blake3:" + strings.Repeat("ab", 32) }},
+		{name: "unknown major schema version", modify: func(m *metadata.Metadata) { m.SchemaVersion = "2.0" }, wantErr: metadata.ErrSchemaVersion},
+		{name: "missing version", modify: func(m *metadata.Metadata) { m.Version = "" }, wantErr: metadata.ErrInvalid},
+		{name: "missing checksum", modify: func(m *metadata.Metadata) { m.Checksum = "" }, wantErr: metadata.ErrInvalid},
+		{name: "short checksum", modify: func(m *metadata.Metadata) { m.Checksum = "deadbeef" }, wantErr: metadata.ErrInvalid},
+		{name: "non-hex checksum", modify: func(m *metadata.Metadata) { m.Checksum = strings.Repeat("zz", 32) }, wantErr: metadata.ErrInvalid},
+		{name: "sha512 digest as sha256", modify: func(m *metadata.Metadata) { m.Checksum = strings.Repeat("ab", 64) }, wantErr: metadata.ErrInvalid},
+		{name: "signature not base64", modify: func(m *metadata.Metadata) { m.Signature = "not base64!" }, wantErr: metadata.ErrInvalid},
+		{name: "missing download URL", modify: func(m *metadata.Metadata) { m.DownloadURL = "" }, wantErr: metadata.ErrInvalid},
+		{name: "malformed download URL", modify: func(m *metadata.Metadata) { m.DownloadURL = "http://[::1" }, wantErr: metadata.ErrInvalid},
+		{name: "compatibility constraint", modify: func(m *metadata.Metadata) { m.CompatibleWith = ">=1.2.0, <2.0.0" }},
+		{name: "invalid compatibility constraint", modify: func(m *metadata.Metadata) { m.CompatibleWith = "1.x.2" }, wantErr: metadata.ErrInvalid},
+		{name: "patch without version", modify: func(m *metadata.Metadata) {
+			m.Patches = []metadata.Patch{{DownloadURL: "p.bsdiff"}}
+		}, wantErr: metadata.ErrInvalid},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m := valid()
+			tc.modify(&m)
+			err := m.Validate()
+			if tc.wantErr == nil && err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Validate error = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package self
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/napalu/gosafedate/metadata"
+)
+
+// supported archive formats
+const (
+	archiveNone = ""
+	archiveTar  = "tar"
+	archiveZip  = "zip"
+)
+
+// archiveFor returns the archive format of m, by its Archive field or by the
+// extension of the resolved download URL (".tar.*", ".tgz", ".zip").
+func archiveFor(m *metadata.Metadata, downloadURL string) (string, error) {
+	switch m.Archive {
+	case archiveNone:
+	case archiveTar, archiveZip:
+		return m.Archive, nil
+	default:
+		return "", fmt.Errorf("unsupported archive format %q", m.Archive)
+	}
+
+	name := downloadURL
+	if u, err := url.Parse(downloadURL); err == nil {
+		name = u.Path
+	}
+	name = path.Base(name)
+
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return archiveZip, nil
+	case strings.HasSuffix(name, ".tgz"), strings.Contains(name, ".tar"):
+		return archiveTar, nil
+	}
+	return archiveNone, nil
+}
+
+// binaryName returns the archive entry pattern identifying the new binary.
+func binaryName(cfg Config, currPath string) string {
+	if cfg.BinaryName != "" {
+		return cfg.BinaryName
+	}
+	return path.Base(strings.ReplaceAll(currPath, "\\", "/"))
+}
+
+// matchEntry reports whether the archive entry name matches pattern, either
+// as a whole or by its base name.
+func matchEntry(pattern, name string) bool {
+	if ok, _ := path.Match(pattern, name); ok {
+		return true
+	}
+	ok, _ := path.Match(pattern, path.Base(name))
+	return ok
+}
+
+// extractTar writes the first regular file in the (optionally compressed) tar
+// archive src matching pattern to dst.
+func extractTar(src, dst, pattern string, d Decompressor, limit int64) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	var r io.Reader = in
+	if d != nil {
+		dr, err := d(in)
+		if err != nil {
+			return err
+		}
+		defer dr.Close()
+		r = dr
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return fmt.Errorf("no entry matching %q in archive", pattern)
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg || !matchEntry(pattern, hdr.Name) {
+			continue
+		}
+		if hdr.Size > limit {
+			return fmt.Errorf("%w: archive entry %s larger than %d bytes", ErrTooLarge, hdr.Name, limit)
+		}
+		return writeSynced(dst, limitReader(tr, limit, "archive entry"))
+	}
+}
+
+// extractZip writes the first regular file in the zip archive src matching
+// pattern to dst.
+func extractZip(src, dst, pattern string, limit int64) error {
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() || !matchEntry(pattern, f.Name) {
+			continue
+		}
+		if f.UncompressedSize64 > uint64(limit) {
+			return fmt.Errorf("%w: archive entry %s larger than %d bytes", ErrTooLarge, f.Name, limit)
+		}
+
+		r, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		return writeSynced(dst, limitReader(r, limit, "archive entry"))
+	}
+
+	return fmt.Errorf("no entry matching %q in archive", pattern)
+}
@@ -0,0 +1,85 @@
+package self
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/napalu/gosafedate/metadata"
+)
+
+// artifact is a downloaded update artifact.
+type artifact struct {
+	path string
+	comp compression
+	arch string
+}
+
+// downloadArtifact downloads the artifact of m from resolvedURL into the work
+// directory and verifies its compressed checksum, if any. Uncompressed
+// binaries are downloaded straight to newFile. The download must match the
+// metadata size, if any; warn reports a disagreeing Content-Length.
+func downloadArtifact(cfg Config, m *metadata.Metadata, currPath, resolvedURL, newFile string, logInfo, warn LogFunc) (*artifact, error) {
+	comp, err := compressionFor(m, resolvedURL)
+	if err != nil {
+		return nil, err
+	}
+
+	arch, err := archiveFor(m, resolvedURL)
+	if err != nil {
+		return nil, err
+	}
+	if arch == archiveZip {
+		// zip entries are compressed individually
+		comp = compression{name: archiveZip, ext: ".zip"}
+	}
+
+	ext := comp.ext
+	if arch == archiveTar {
+		ext = ".tar" + ext
+	}
+
+	a := &artifact{
+		path: filepath.Join(workDir(cfg, currPath), fmt.Sprintf("%s-%s%s", filepath.Base(currPath), m.Version, ext)),
+		comp: comp,
+		arch: arch,
+	}
+
+	limit := cfg.maxDownloadSize()
+	if comp.fn == nil && arch == archiveNone {
+		// uncompressed artifact: download straight to the new binary
+		a.path = newFile
+		limit = min(limit, cfg.maxBinarySize())
+	}
+
+	logInfo("downloading")
+	if err = fetchAndDownload(cfg, resolvedURL, a.path, limit, m.Size, warn); err != nil {
+		return nil, err
+	}
+
+	if m.ChecksumCompressed != "" {
+		logInfo("verifying download checksum")
+		if err = verifyChecksum(a.path, m.ChecksumCompressed); err != nil {
+			_ = os.Remove(a.path)
+			return nil, fmt.Errorf("download: %w", err)
+		}
+	}
+
+	return a, nil
+}
+
+// unpack decompresses or extracts the artifact into newFile.
+func (a *artifact) unpack(cfg Config, currPath, newFile string, logInfo LogFunc) error {
+	switch {
+	case a.arch == archiveTar:
+		logInfo("extracting %s from tar archive", binaryName(cfg, currPath))
+		return extractTar(a.path, newFile, binaryName(cfg, currPath), a.comp.fn, cfg.maxBinarySize())
+	case a.arch == archiveZip:
+		logInfo("extracting %s from zip archive", binaryName(cfg, currPath))
+		return extractZip(a.path, newFile, binaryName(cfg, currPath), cfg.maxBinarySize())
+	case a.comp.fn != nil:
+		logInfo("decompressing (%s)", a.comp.name)
+		return decompressFile(a.path, newFile, a.comp.fn, cfg.maxBinarySize())
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package self
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// copyAttributes gives newPath the extended attributes of oldPath: file
+// capabilities (security.capability), the SELinux context (security.selinux),
+// ACLs and user attributes. Call it after restoreOwner, as chown clears
+// capabilities.
+func copyAttributes(oldPath, newPath string) error {
+	names, err := listXattrs(oldPath)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		val, err := getXattr(oldPath, name)
+		if err != nil {
+			return fmt.Errorf("read attribute %s: %w", name, err)
+		}
+		if err = syscall.Setxattr(newPath, name, val, 0); err != nil {
+			return fmt.Errorf("copy attribute %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func listXattrs(path string) ([]string, error) {
+	sz, err := syscall.Listxattr(path, nil)
+	if errors.Is(err, syscall.ENOTSUP) {
+		return nil, nil
+	}
+	if err != nil || sz == 0 {
+		return nil, err
+	}
+	buf := make([]byte, sz)
+	if sz, err = syscall.Listxattr(path, buf); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	start := 0
+	for i, b := range buf[:sz] {
+		if b == 0 {
+			if i > start {
+				names = append(names, string(buf[start:i]))
+			}
+			start = i + 1
+		}
+	}
+	return names, nil
+}
+
+func getXattr(path, name string) ([]byte, error) {
+	sz, err := syscall.Getxattr(path, name, nil)
+	if err != nil || sz == 0 {
+		return nil, err
+	}
+	buf := make([]byte, sz)
+	if sz, err = syscall.Getxattr(path, name, buf); err != nil {
+		return nil, err
+	}
+	return buf[:sz], nil
+}
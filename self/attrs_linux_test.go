@@ -0,0 +1,37 @@
+package self
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestCopyAttributes(t *testing.T) {
+	dir := t.TempDir()
+	oldPath := filepath.Join(dir, "myapp")
+	newPath := filepath.Join(dir, "myapp.new")
+	for _, p := range []string{oldPath, newPath} {
+		if err := os.WriteFile(p, []byte("binary"), 0o755); err != nil {
+			t.Fatalf("write %s: %v", p, err)
+		}
+	}
+
+	err := syscall.Setxattr(oldPath, "user.gosafedate.test", []byte("kept"), 0)
+	if errors.Is(err, syscall.ENOTSUP) || errors.Is(err, syscall.EPERM) {
+		t.Skipf("user xattrs not supported here: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("setxattr: %v", err)
+	}
+
+	if err = copyAttributes(oldPath, newPath); err != nil {
+		t.Fatalf("copyAttributes returned error: %v", err)
+	}
+	got, err := getXattr(newPath, "user.gosafedate.test")
+	if err != nil || !bytes.Equal(got, []byte("kept")) {
+		t.Fatalf("attribute = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package self
+
+// copyAttributes is a no-op outside Linux.
+func copyAttributes(_, _ string) error {
+	return nil
+}
@@ -0,0 +1,262 @@
+package self
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/napalu/gosafedate/metadata"
+)
+
+const stagingSuffix = ".staging"
+
+// stageBundle prepares a bundle artifact for installation: the archive is
+// extracted into a staging directory next to the install directory, and the
+// manifest is verified against m.Checksum and every listed file against the
+// manifest. It returns the staging directory, the install directory and the
+// manifest.
+func stageBundle(cfg Config, m *metadata.Metadata, currPath, src, arch string, d Decompressor, logInfo LogFunc) (string, string, *metadata.Manifest, error) {
+	if arch == archiveNone {
+		return "", "", nil, errors.New("bundle artifacts must be tar or zip archives")
+	}
+
+	installDir := cfg.BundleDir
+	if installDir == "" {
+		installDir = filepath.Dir(currPath)
+	}
+
+	staging := filepath.Join(installDir, fmt.Sprintf("%s-%s%s", filepath.Base(currPath), m.Version, stagingSuffix))
+	if err := os.RemoveAll(staging); err != nil {
+		return "", "", nil, err
+	}
+
+	logInfo("staging bundle in %s", staging)
+	var err error
+	if arch == archiveZip {
+		err = extractAllZip(src, staging, cfg.maxBinarySize())
+	} else {
+		err = extractAllTar(src, staging, d, cfg.maxBinarySize())
+	}
+	if err != nil {
+		_ = os.RemoveAll(staging)
+		return "", "", nil, fmt.Errorf("extract bundle: %w", err)
+	}
+
+	logInfo("verifying bundle manifest")
+	manifest, err := verifyBundle(cfg, m, staging)
+	cfg.Metrics.verify(m.Version, err)
+	if err != nil {
+		_ = os.RemoveAll(staging)
+		return "", "", nil, err
+	}
+	return staging, installDir, manifest, nil
+}
+
+// verifyBundle verifies the signed manifest in staging and the checksums of
+// all the files it lists.
+func verifyBundle(cfg Config, m *metadata.Metadata, staging string) (*metadata.Manifest, error) {
+	manifestPath := filepath.Join(staging, metadata.ManifestName)
+	if err := verifyChecksum(manifestPath, m.Checksum); err != nil {
+		return nil, fmt.Errorf("manifest: %w", err)
+	}
+	if !sidecarSigned(cfg, m) { // else the artifact was verified on download
+		if err := verifySignature(cfg, m); err != nil {
+			return nil, err
+		}
+	}
+
+	b, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	var manifest metadata.Manifest
+	if err = json.Unmarshal(b, &manifest); err != nil {
+		return nil, fmt.Errorf("parse manifest: %w", err)
+	}
+
+	for _, f := range manifest.Files {
+		p := filepath.FromSlash(f.Path)
+		if !filepath.IsLocal(p) || f.Path == metadata.ManifestName {
+			return nil, fmt.Errorf("invalid manifest path %q", f.Path)
+		}
+		if err = verifyChecksum(filepath.Join(staging, p), f.Checksum); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Path, err)
+		}
+	}
+	return &manifest, nil
+}
+
+// swapFiles moves the staged files into installDir, keeping backups of the
+// files they replace until all of them have been moved.
+func swapFiles(cfg Config, staging, installDir string, files []metadata.ManifestFile) (err error) {
+	type swapped struct{ dst, bak string }
+	var done []swapped
+
+	defer func() {
+		if err == nil {
+			for _, s := range done {
+				if s.bak != "" {
+					_ = os.Remove(s.bak)
+				}
+			}
+			return
+		}
+		// roll back in reverse order
+		for i := len(done) - 1; i >= 0; i-- {
+			s := done[i]
+			if s.bak != "" {
+				_ = cfg.rename(s.bak, s.dst)
+			} else {
+				_ = os.Remove(s.dst)
+			}
+		}
+	}()
+
+	for _, f := range files {
+		p := filepath.FromSlash(f.Path)
+		src := filepath.Join(staging, p)
+		dst := filepath.Join(installDir, p)
+
+		if err = os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return err
+		}
+
+		var bak string
+		if _, statErr := os.Lstat(dst); statErr == nil {
+			bak = dst + bakSuffix
+			if err = cfg.rename(dst, bak); err != nil {
+				return fmt.Errorf("back up %s: %w", dst, err)
+			}
+		}
+		if err = cfg.rename(src, dst); err != nil {
+			if bak != "" {
+				_ = cfg.rename(bak, dst)
+			}
+			return fmt.Errorf("install %s: %w", dst, err)
+		}
+		done = append(done, swapped{dst: dst, bak: bak})
+	}
+
+	return nil
+}
+
+// extractAllTar extracts the regular files and directories of the
+// (optionally compressed) tar archive src into dir.
+func extractAllTar(src, dir string, d Decompressor, limit int64) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	var r io.Reader = in
+	if d != nil {
+		dr, err := d(in)
+		if err != nil {
+			return err
+		}
+		defer dr.Close()
+		r = dr
+	}
+
+	tr := tar.NewReader(limitReader(r, limit, "bundle"))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		dst, err := stagedPath(dir, hdr.Name)
+		if err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(dst, 0o755)
+		case tar.TypeReg:
+			err = writeStaged(dst, tr, hdr.FileInfo().Mode().Perm())
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// extractAllZip extracts the regular files and directories of the zip
+// archive src into dir.
+func extractAllZip(src, dir string, limit int64) error {
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	var total uint64
+	for _, f := range zr.File {
+		total += f.UncompressedSize64
+	}
+	if total > uint64(limit) {
+		return fmt.Errorf("%w: bundle of %d bytes larger than %d bytes", ErrTooLarge, total, limit)
+	}
+
+	for _, f := range zr.File {
+		dst, err := stagedPath(dir, f.Name)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case f.Mode().IsDir():
+			err = os.MkdirAll(dst, 0o755)
+		case f.Mode().IsRegular():
+			err = extractZipFile(f, dst, limit)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func extractZipFile(f *zip.File, dst string, limit int64) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return writeStaged(dst, limitReader(r, limit, "bundle entry"), f.Mode().Perm())
+}
+
+// stagedPath returns the path of the archive entry name below dir, rejecting
+// entries which would escape it.
+func stagedPath(dir, name string) (string, error) {
+	p := filepath.FromSlash(name)
+	if !filepath.IsLocal(p) {
+		return "", fmt.Errorf("invalid archive entry %q", name)
+	}
+	return filepath.Join(dir, p), nil
+}
+
+func writeStaged(dst string, r io.Reader, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	if err := writeSynced(dst, r); err != nil {
+		return err
+	}
+	if perm == 0 {
+		perm = 0o644
+	}
+	return os.Chmod(dst, perm)
+}
@@ -0,0 +1,119 @@
+package self
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// minChunkSize is the smallest range fetched by a parallel download; smaller
+// artifacts are downloaded with a single request.
+const minChunkSize = 1 << 20 // 1 MiB
+
+// fetchChunked downloads url in up to s.Chunks concurrent ranged requests,
+// writing each chunk at its offset. It reports false without error if the
+// server or w don't support it, so the caller falls back to a single GET.
+func (s *HTTPSource) fetchChunked(ctx context.Context, url string, w io.Writer) (bool, error) {
+	wa, ok := writerAt(w)
+	if !ok {
+		return false, nil
+	}
+
+	resp, err := s.do(ctx, http.MethodHead, url)
+	if err != nil {
+		return false, nil
+	}
+	_ = resp.Body.Close()
+	size := resp.ContentLength
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Accept-Ranges") != "bytes" || size <= 0 {
+		return false, nil
+	}
+
+	n := int64(s.Chunks)
+	if max := size / minChunkSize; n > max {
+		n = max
+	}
+	if n < 2 {
+		return false, nil
+	}
+	if err = checkContentLength(w, size); err != nil {
+		return true, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	chunk := (size + n - 1) / n
+	for off := int64(0); off < size; off += chunk {
+		end := min(off+chunk, size) - 1
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.fetchRange(ctx, url, wa, off, end); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return true, errors.Join(errs...)
+}
+
+// fetchRange downloads bytes [off, end] of url to wa.
+func (s *HTTPSource) fetchRange(ctx context.Context, url string, wa io.WriterAt, off, end int64) error {
+	h := http.Header{}
+	h.Set("Range", fmt.Sprintf("bytes=%d-%d", off, end))
+
+	resp, err := s.doHeader(ctx, http.MethodGet, url, h)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("download range %d-%d: HTTP %d", off, end, resp.StatusCode)
+	}
+
+	want := end - off + 1
+	got, err := io.Copy(io.NewOffsetWriter(wa, off), io.LimitReader(resp.Body, want))
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("download range %d-%d: short read of %d bytes", off, end, got)
+	}
+	return nil
+}
+
+// writerAt returns w as an io.WriterAt, looking through size limits.
+func writerAt(w io.Writer) (io.WriterAt, bool) {
+	if lw, ok := w.(*limitedWriter); ok {
+		if _, ok := lw.w.(io.WriterAt); !ok {
+			return nil, false
+		}
+		return lw, true
+	}
+	wa, ok := w.(io.WriterAt)
+	return wa, ok
+}
+
+// WriteAt enforces the limit for chunks written out of order.
+func (l *limitedWriter) WriteAt(p []byte, off int64) (int, error) {
+	if off+int64(len(p)) > l.limit {
+		return 0, fmt.Errorf("%w: %s larger than %d bytes", ErrTooLarge, l.what, l.limit)
+	}
+	n, err := l.w.(io.WriterAt).WriteAt(p, off)
+	l.report(n)
+	return n, err
+}
@@ -0,0 +1,115 @@
+package self
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// CleanupArtifacts removes leftovers of previous interrupted updates of the
+// target: downloads ("<exe>-<ver>.gz", archives or another registered
+// extension), partial downloads ("*.part"), decompressed binaries
+// ("<exe>-<ver>.new"), pending helper files ("<exe>.new", "<exe>.new.meta"),
+// backups ("<exe>.bak") and bundle staging directories
+// ("<exe>-<ver>.staging"). Other files named after the target, such as
+// "<exe>-assets.zip", are kept, as is an update staged with OnNextStart
+// which is still waiting for a restart: "<exe>.new" and "<exe>.new.meta" are
+// only removed once they have expired, i.e. their checksum doesn't match or
+// their version isn't newer than cfg.CurrentVer.
+//
+// It is called automatically at the start of every update. Files that can't
+// be removed are skipped and reported in the returned error.
+func CleanupArtifacts(cfg Config) error {
+	currPath, err := targetPath(cfg)
+	if err != nil {
+		return err
+	}
+
+	dirs := []string{filepath.Dir(currPath)}
+	for _, d := range []string{workDir(cfg, currPath), cfg.BundleDir} {
+		if d != "" && !slices.Contains(dirs, d) {
+			dirs = append(dirs, d)
+		}
+	}
+
+	var errs []error
+	base := filepath.Base(currPath)
+	staged := stagedForStartup(cfg, currPath) != nil
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, e := range entries {
+			switch {
+			case e.IsDir() && isStagingDir(base, e.Name()):
+				err = os.RemoveAll(filepath.Join(dir, e.Name()))
+			case staged && dir == dirs[0] && (e.Name() == base+newSuffix || e.Name() == base+newSuffix+metaSuffix):
+				continue
+			case !e.IsDir() && isArtifact(base, e.Name()):
+				err = os.Remove(filepath.Join(dir, e.Name()))
+			default:
+				continue
+			}
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// isArtifact reports whether name is an update artifact belonging to the
+// binary named base.
+func isArtifact(base, name string) bool {
+	switch name {
+	case base + newSuffix, base + newSuffix + metaSuffix, base + bakSuffix:
+		return true
+	}
+
+	rest, ok := strings.CutPrefix(name, base+"-")
+	if !ok {
+		return false
+	}
+	rest = strings.TrimSuffix(rest, partSuffix)
+	for _, suffix := range []string{
+		newSuffix + ".exe", // staged for the elevated helper
+		newSuffix,
+		patchSuffix,
+		".zip",
+	} {
+		if v, ok := strings.CutSuffix(rest, suffix); ok {
+			return isVersion(v)
+		}
+	}
+	ext := compressedExt(rest)
+	rest = strings.TrimSuffix(rest, ext)
+	if v, ok := strings.CutSuffix(rest, ".tar"); ok {
+		return isVersion(v)
+	}
+	return ext != "" && isVersion(rest)
+}
+
+// isStagingDir reports whether name is a bundle staging directory belonging
+// to the binary named base.
+func isStagingDir(base, name string) bool {
+	v, ok := strings.CutPrefix(name, base+"-")
+	if !ok {
+		return false
+	}
+	v, ok = strings.CutSuffix(v, stagingSuffix)
+	return ok && isVersion(v)
+}
+
+// versionPattern matches the versions artifacts are named after: semantic
+// or calendar versions, with an optional "v" prefix.
+var versionPattern = regexp.MustCompile(`^v?\d+(\.\d+)*(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+
+func isVersion(s string) bool {
+	return versionPattern.MatchString(s)
+}
@@ -0,0 +1,27 @@
+package self
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// httpClient returns the client of the default HTTP source.
+func (c Config) httpClient() *http.Client {
+	if c.updater != nil && c.updater.client != nil {
+		return c.updater.client
+	}
+	if c.TLS == nil && c.ProxyURL == "" {
+		return http.DefaultClient
+	}
+
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if c.TLS != nil {
+		tr.TLSClientConfig = c.TLS.clientConfig()
+	}
+	if c.ProxyURL != "" {
+		tr.Proxy = func(*http.Request) (*url.URL, error) {
+			return url.Parse(c.ProxyURL)
+		}
+	}
+	return &http.Client{Transport: tr}
+}
@@ -0,0 +1,204 @@
+// Package selfupdate eases the migration from
+// github.com/rhysd/go-github-selfupdate: it provides its Updater and
+// functions on top of the self and github packages, so updates from GitHub
+// Releases are verified by gosafedate's pipeline.
+//
+//	latest, err := selfupdate.UpdateSelf(version, "owner/repo")
+//
+// Releases need the ".sig" asset of package github next to the binary
+// asset. Versions are strings rather than semver.Version values, and
+// Config.AssetPattern, a glob, replaces the Filters regular expressions.
+// Only the checksum is verified unless Config.PubKey is set, so prefer an
+// Updater with the release key over the package-level functions:
+//
+//	up, err := selfupdate.NewUpdater(selfupdate.Config{PubKey: releaseKey})
+//	latest, err := up.UpdateSelf(version, "owner/repo")
+package selfupdate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"strings"
+
+	"github.com/napalu/gosafedate/metadata"
+	"github.com/napalu/gosafedate/self"
+	"github.com/napalu/gosafedate/self/source/github"
+	"github.com/napalu/gosafedate/version"
+)
+
+// Config configures an Updater.
+type Config struct {
+	APIToken          string // for private repositories
+	EnterpriseBaseURL string // GitHub Enterprise API endpoint; if empty: github.DefaultBaseURL
+	AssetPattern      string // glob matching the binary asset; if empty: "*[_-]<GOOS>[_-]<GOARCH>*"
+	PubKey            []byte // release key verifying the signature of the ".sig" asset, see self.Config
+}
+
+// Release is a release providing an update.
+type Release struct {
+	Version       string
+	AssetURL      string
+	AssetByteSize int
+	RepoOwner     string
+	RepoName      string
+
+	src *github.Source
+	m   *metadata.Metadata
+}
+
+// Updater detects and installs updates from GitHub Releases.
+type Updater struct {
+	cfg Config
+}
+
+// NewUpdater returns an Updater for cfg.
+func NewUpdater(cfg Config) (*Updater, error) {
+	if cfg.AssetPattern == "" {
+		cfg.AssetPattern = fmt.Sprintf("*[_-]%s[_-]%s*", runtime.GOOS, runtime.GOARCH)
+	}
+	return &Updater{cfg: cfg}, nil
+}
+
+// DefaultUpdater returns an Updater for public repositories, verifying
+// checksums only.
+func DefaultUpdater() *Updater {
+	u, _ := NewUpdater(Config{})
+	return u
+}
+
+// DetectLatest returns the latest release of the repository slug
+// ("owner/name") with a matching asset, and whether there is one.
+func (u *Updater) DetectLatest(slug string) (*Release, bool, error) {
+	src, err := u.source(slug)
+	if err != nil {
+		return nil, false, err
+	}
+
+	rc, err := src.FetchMetadata(context.Background())
+	if errors.Is(err, github.ErrNoRelease) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	defer rc.Close()
+
+	var m metadata.Metadata
+	if err = json.NewDecoder(rc).Decode(&m); err != nil {
+		return nil, false, err
+	}
+	return &Release{
+		Version:       strings.TrimPrefix(m.Version, "v"),
+		AssetURL:      m.DownloadURL,
+		AssetByteSize: int(m.Size),
+		RepoOwner:     src.Owner,
+		RepoName:      src.Repo,
+		src:           src,
+		m:             &m,
+	}, true, nil
+}
+
+// UpdateSelf updates the running executable of version current to the
+// latest release of slug, if newer. It returns the latest release, or one
+// of version current if there is no update.
+func (u *Updater) UpdateSelf(current, slug string) (*Release, error) {
+	return u.UpdateCommand("", current, slug)
+}
+
+// UpdateCommand is UpdateSelf for the executable at cmdPath.
+func (u *Updater) UpdateCommand(cmdPath, current, slug string) (*Release, error) {
+	rel, found, err := u.DetectLatest(slug)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return &Release{Version: current}, nil
+	}
+
+	cur, err := version.NewSemVer(current, "v")
+	if err != nil {
+		return nil, err
+	}
+	latest, err := version.NewSemVer(rel.Version, "v")
+	if err != nil {
+		return nil, err
+	}
+	if !latest.GreaterThan(cur) {
+		return &Release{Version: current}, nil
+	}
+	if err = u.UpdateTo(rel, cmdPath); err != nil {
+		return nil, err
+	}
+	return rel, nil
+}
+
+// UpdateTo installs rel, as returned by DetectLatest, at cmdPath, or in
+// place of the running executable if cmdPath is empty.
+func (u *Updater) UpdateTo(rel *Release, cmdPath string) error {
+	if rel.m == nil {
+		return errors.New("release not detected by this package")
+	}
+	return self.UpdateFromMetadata(self.Config{
+		Source:     rel.src,
+		PubKey:     u.cfg.PubKey,
+		TargetPath: cmdPath,
+	}, rel.m)
+}
+
+func (u *Updater) source(slug string) (*github.Source, error) {
+	owner, repo, ok := strings.Cut(slug, "/")
+	if !ok || owner == "" || repo == "" || strings.Contains(repo, "/") {
+		return nil, fmt.Errorf("invalid slug format %q, expected \"owner/name\"", slug)
+	}
+	return &github.Source{
+		Owner:        owner,
+		Repo:         repo,
+		AssetPattern: u.cfg.AssetPattern,
+		Token:        u.cfg.APIToken,
+		BaseURL:      u.cfg.EnterpriseBaseURL,
+	}, nil
+}
+
+// DetectLatest is DefaultUpdater().DetectLatest.
+func DetectLatest(slug string) (*Release, bool, error) {
+	return DefaultUpdater().DetectLatest(slug)
+}
+
+// UpdateSelf is DefaultUpdater().UpdateSelf.
+func UpdateSelf(current, slug string) (*Release, error) {
+	return DefaultUpdater().UpdateSelf(current, slug)
+}
+
+// UpdateCommand is DefaultUpdater().UpdateCommand.
+func UpdateCommand(cmdPath, current, slug string) (*Release, error) {
+	return DefaultUpdater().UpdateCommand(cmdPath, current, slug)
+}
+
+// UpdateTo installs the binary asset at assetURL at cmdPath after
+// verifying its checksum, from the ".sig" asset next to it.
+func UpdateTo(assetURL, cmdPath string) error {
+	resp, err := http.Get(assetURL + ".sig")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("selfupdate: GET %s.sig: HTTP %d", assetURL, resp.StatusCode)
+	}
+	line, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return err
+	}
+	sum, _, _ := strings.Cut(strings.TrimSpace(string(line)), " ")
+
+	return self.UpdateFromMetadata(self.Config{TargetPath: cmdPath}, &metadata.Metadata{
+		Version:     "latest",
+		Checksum:    sum,
+		DownloadURL: assetURL,
+	})
+}
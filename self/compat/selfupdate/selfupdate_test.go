@@ -0,0 +1,106 @@
+package selfupdate_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/napalu/gosafedate/self/compat/selfupdate"
+)
+
+func TestUpdater_UpdateCommand(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	newData := []byte("new-binary")
+	sum := fmt.Sprintf("%x", sha256.Sum256(newData))
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte("v1.2.4+"+sum)))
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write(newData)
+	_ = zw.Close()
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/acme/myapp/releases":
+			dl := srv.URL + "/download/"
+			_ = json.NewEncoder(w).Encode([]map[string]any{
+				{"tag_name": "v1.2.4", "assets": []map[string]any{
+					// the signature asset matches the pattern too
+					{"name": "myapp_linux_amd64.gz.sig", "browser_download_url": dl + "myapp_linux_amd64.gz.sig"},
+					{"name": "myapp_linux_amd64.gz", "size": gz.Len(), "browser_download_url": dl + "myapp_linux_amd64.gz"},
+				}},
+			})
+		case "/download/myapp_linux_amd64.gz":
+			_, _ = w.Write(gz.Bytes())
+		case "/download/myapp_linux_amd64.gz.sig":
+			_, _ = fmt.Fprintf(w, "%s %s\n", sum, sig)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	up, err := selfupdate.NewUpdater(selfupdate.Config{
+		EnterpriseBaseURL: srv.URL + "/",
+		AssetPattern:      "myapp_linux_amd64*",
+		PubKey:            pub,
+	})
+	if err != nil {
+		t.Fatalf("NewUpdater: %v", err)
+	}
+
+	rel, found, err := up.DetectLatest("acme/myapp")
+	if err != nil || !found {
+		t.Fatalf("DetectLatest = %v, %v", found, err)
+	}
+	if rel.Version != "1.2.4" || rel.AssetURL != srv.URL+"/download/myapp_linux_amd64.gz" || rel.AssetByteSize != gz.Len() {
+		t.Fatalf("unexpected release: %+v", rel)
+	}
+
+	tests := []struct {
+		name    string
+		current string
+		want    []byte
+	}{
+		{name: "up to date", current: "v1.2.4", want: []byte("old-binary")},
+		{name: "update", current: "1.2.3", want: newData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmdPath := filepath.Join(t.TempDir(), "myapp")
+			if err := os.WriteFile(cmdPath, []byte("old-binary"), 0o755); err != nil {
+				t.Fatalf("write temp exe: %v", err)
+			}
+
+			if _, err := up.UpdateCommand(cmdPath, tt.current, "acme/myapp"); err != nil {
+				t.Fatalf("UpdateCommand: %v", err)
+			}
+
+			got, err := os.ReadFile(cmdPath)
+			if err != nil {
+				t.Fatalf("read exe: %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Fatalf("exe = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, _, err = up.DetectLatest("acme"); err == nil {
+		t.Fatal("DetectLatest accepted an invalid slug")
+	}
+}
@@ -0,0 +1,39 @@
+package update
+
+import (
+	"io"
+
+	"github.com/napalu/gosafedate/bsdiff"
+)
+
+// Patcher applies a binary patch, as in go-update.
+type Patcher interface {
+	Patch(old io.Reader, new io.Writer, patch io.Reader) error
+}
+
+type patchFn func(io.Reader, io.Writer, io.Reader) error
+
+func (fn patchFn) Patch(old io.Reader, new io.Writer, patch io.Reader) error {
+	return fn(old, new, patch)
+}
+
+// NewBSDiffPatcher returns a Patcher for BSDIFF40 patches, see package
+// bsdiff.
+func NewBSDiffPatcher() Patcher {
+	return patchFn(func(old io.Reader, new io.Writer, patch io.Reader) error {
+		o, err := io.ReadAll(old)
+		if err != nil {
+			return err
+		}
+		p, err := io.ReadAll(patch)
+		if err != nil {
+			return err
+		}
+		n, err := bsdiff.Patch(o, p, 0)
+		if err != nil {
+			return err
+		}
+		_, err = new.Write(n)
+		return err
+	})
+}
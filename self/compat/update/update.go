@@ -0,0 +1,225 @@
+// Package update eases the migration from github.com/inconshreveable/go-update:
+// it provides its Apply function and Options on top of gosafedate's
+// verification and install pipeline. Changing the import path is enough for
+// most callers:
+//
+//	err := update.Apply(resp.Body, update.Options{
+//		Checksum:  checksum,
+//		PublicKey: publicKey,
+//		Signature: signature,
+//		Verifier:  update.NewECDSAVerifier(),
+//	})
+//
+// Signatures are verified exactly as go-update does, over the checksum of
+// the new binary, so existing keys and signed releases keep working. The
+// binary is installed by the self package, with its Windows update helper:
+// call self.MaybeRunUpdateHelper first thing in main.
+package update
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/napalu/gosafedate/checksum"
+	"github.com/napalu/gosafedate/metadata"
+	"github.com/napalu/gosafedate/self"
+)
+
+// artifactURL names the update for the install pipeline.
+const artifactURL = "go-update"
+
+// Options are the options of Apply, as in go-update.
+type Options struct {
+	TargetPath  string      // if empty: the running executable
+	TargetMode  os.FileMode // if set: the mode of the new binary
+	Checksum    []byte      // if set: the expected checksum of the new binary, using Hash
+	PublicKey   crypto.PublicKey
+	Signature   []byte      // signature by PublicKey over the checksum, required with PublicKey
+	Verifier    Verifier    // verifies Signature, required with PublicKey
+	Hash        crypto.Hash // crypto.SHA256 or crypto.SHA512; if 0: crypto.SHA256
+	Patcher     Patcher     // if set: the update is a patch to the current binary
+	OldSavePath string      // if set: the previous binary is kept at this path
+}
+
+// Apply installs the new binary read from update, or the binary patch if
+// opts.Patcher is set, after verifying its checksum and signature.
+func Apply(update io.Reader, opts Options) error {
+	alg, err := opts.algorithm()
+	if err != nil {
+		return err
+	}
+	target, err := opts.target()
+	if err != nil {
+		return err
+	}
+
+	data, err := io.ReadAll(update)
+	if err != nil {
+		return err
+	}
+	if opts.Patcher != nil {
+		if data, err = patch(target, data, opts.Patcher); err != nil {
+			return err
+		}
+	}
+
+	sum := opts.Checksum
+	if sum == nil {
+		h := opts.hash().New()
+		h.Write(data)
+		sum = h.Sum(nil)
+	}
+
+	cfg := self.Config{
+		Source:     &source{data: data, signature: opts.Signature},
+		TargetPath: target,
+	}
+	if opts.PublicKey != nil {
+		if opts.Verifier == nil {
+			return errors.New("no verifier set for the public key")
+		}
+		if opts.Signature == nil {
+			return errors.New("no signature to verify")
+		}
+		cfg.Verifier = &verifier{opts: opts}
+	}
+
+	if opts.OldSavePath != "" {
+		if err = copyFile(target, opts.OldSavePath); err != nil {
+			return fmt.Errorf("save old binary: %w", err)
+		}
+	}
+
+	err = self.UpdateFromMetadata(cfg, &metadata.Metadata{
+		Version:     "go-update",
+		Checksum:    checksum.Format(alg, sum),
+		DownloadURL: artifactURL,
+		Size:        int64(len(data)),
+		Compression: "none",
+	})
+	if err != nil {
+		return err
+	}
+	if opts.TargetMode != 0 {
+		return os.Chmod(target, opts.TargetMode)
+	}
+	return nil
+}
+
+// CheckPermissions reports whether the directory of the target can be
+// written, which installing the update requires.
+func (o *Options) CheckPermissions() error {
+	target, err := o.target()
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(target), ".go-update-check-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	_ = f.Close()
+	return os.Remove(name)
+}
+
+// SetPublicKeyPEM sets PublicKey from a PEM encoded PKIX public key.
+func (o *Options) SetPublicKeyPEM(pembytes []byte) error {
+	block, _ := pem.Decode(pembytes)
+	if block == nil {
+		return errors.New("couldn't parse PEM data")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return err
+	}
+	o.PublicKey = pub
+	return nil
+}
+
+// RollbackError returns the error of restoring the previous binary after a
+// failed install, as in go-update. The self package restores it as part of
+// the install and reports a failure to do so in the error of Apply, so it
+// always returns nil.
+func RollbackError(err error) error {
+	return nil
+}
+
+func (o *Options) hash() crypto.Hash {
+	if o.Hash == 0 {
+		return crypto.SHA256
+	}
+	return o.Hash
+}
+
+func (o *Options) algorithm() (string, error) {
+	switch o.hash() {
+	case crypto.SHA256:
+		return checksum.SHA256, nil
+	case crypto.SHA512:
+		return checksum.SHA512, nil
+	}
+	return "", fmt.Errorf("%w: %v", checksum.ErrUnsupported, o.Hash)
+}
+
+func (o *Options) target() (string, error) {
+	if o.TargetPath != "" {
+		return o.TargetPath, nil
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(exe)
+}
+
+func patch(target string, p []byte, patcher Patcher) ([]byte, error) {
+	old, err := os.Open(target)
+	if err != nil {
+		return nil, err
+	}
+	defer old.Close()
+
+	var buf bytes.Buffer
+	if err = patcher.Patch(old, &buf, bytes.NewReader(p)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0o755)
+}
+
+// source serves the update, and its signature to verifier.
+type source struct {
+	data      []byte
+	signature []byte
+}
+
+func (s *source) FetchMetadata(context.Context) (io.ReadCloser, error) {
+	return nil, errors.New("go-update: no metadata")
+}
+
+func (s *source) FetchArtifact(_ context.Context, url string, w io.Writer) error {
+	switch url {
+	case artifactURL:
+		_, err := w.Write(s.data)
+		return err
+	case artifactURL + signatureSuffix:
+		_, err := w.Write(s.signature)
+		return err
+	}
+	return fmt.Errorf("go-update: unknown artifact %s", url)
+}
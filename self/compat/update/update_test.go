@@ -0,0 +1,93 @@
+package update_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/napalu/gosafedate/self/compat/update"
+)
+
+func TestApply(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	newData := []byte("new-binary")
+	sum := sha256.Sum256(newData)
+	sig, err := ecdsa.SignASN1(rand.Reader, priv, sum[:])
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		checksum  []byte
+		signature []byte
+		wantErr   bool
+	}{
+		{name: "signed", checksum: sum[:], signature: sig},
+		{name: "checksum mismatch", checksum: make([]byte, sha256.Size), signature: sig, wantErr: true},
+		{name: "bad signature", signature: append([]byte{}, sig[:len(sig)-1]...), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			target := filepath.Join(dir, "myapp")
+			if err := os.WriteFile(target, []byte("old-binary"), 0o755); err != nil {
+				t.Fatalf("write temp exe: %v", err)
+			}
+
+			opts := update.Options{
+				TargetPath:  target,
+				Checksum:    tt.checksum,
+				Signature:   tt.signature,
+				Verifier:    update.NewECDSAVerifier(),
+				Hash:        crypto.SHA256,
+				OldSavePath: filepath.Join(dir, "myapp.old"),
+			}
+			if err := opts.SetPublicKeyPEM(pemKey); err != nil {
+				t.Fatalf("SetPublicKeyPEM: %v", err)
+			}
+			if err := opts.CheckPermissions(); err != nil {
+				t.Fatalf("CheckPermissions: %v", err)
+			}
+
+			err := update.Apply(bytes.NewReader(newData), opts)
+			want := newData
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Apply succeeded")
+				}
+				want = []byte("old-binary")
+			} else if err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+
+			got, err := os.ReadFile(target)
+			if err != nil {
+				t.Fatalf("read exe: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("exe = %q, want %q", got, want)
+			}
+			if old, err := os.ReadFile(opts.OldSavePath); err != nil || string(old) != "old-binary" {
+				t.Fatalf("old binary not saved: %q, %v", old, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package update
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"io"
+	"math/big"
+	"os"
+)
+
+// signatureSuffix is the name under which source serves the signature.
+const signatureSuffix = ".sig"
+
+// Verifier verifies a signature over the checksum of an update, as in
+// go-update.
+type Verifier interface {
+	VerifySignature(checksum, signature []byte, h crypto.Hash, publicKey crypto.PublicKey) error
+}
+
+type verifyFn func([]byte, []byte, crypto.Hash, crypto.PublicKey) error
+
+func (fn verifyFn) VerifySignature(checksum []byte, signature []byte, hash crypto.Hash, publicKey crypto.PublicKey) error {
+	return fn(checksum, signature, hash, publicKey)
+}
+
+// NewECDSAVerifier returns a Verifier for ASN.1 encoded ECDSA signatures.
+func NewECDSAVerifier() Verifier {
+	return verifyFn(func(checksum, signature []byte, _ crypto.Hash, publicKey crypto.PublicKey) error {
+		key, ok := publicKey.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.New("not a valid ECDSA public key")
+		}
+		var rs struct{ R, S *big.Int }
+		if _, err := asn1.Unmarshal(signature, &rs); err != nil {
+			return err
+		}
+		if !ecdsa.Verify(key, checksum, rs.R, rs.S) {
+			return errors.New("failed to verify ECDSA signature")
+		}
+		return nil
+	})
+}
+
+// NewRSAVerifier returns a Verifier for RSA PKCS #1 v1.5 signatures.
+func NewRSAVerifier() Verifier {
+	return verifyFn(func(checksum, signature []byte, hash crypto.Hash, publicKey crypto.PublicKey) error {
+		key, ok := publicKey.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("not a valid RSA public key")
+		}
+		return rsa.VerifyPKCS1v15(key, hash, checksum, signature)
+	})
+}
+
+// verifier is the self.ArtifactVerifier checking the signature of Options.
+type verifier struct {
+	opts Options
+}
+
+func (v *verifier) SignatureSuffix() string {
+	return signatureSuffix
+}
+
+func (v *verifier) VerifyArtifact(path string, sig []byte) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := v.opts.hash().New()
+	if _, err = io.Copy(h, f); err != nil {
+		return err
+	}
+	return v.opts.Verifier.VerifySignature(h.Sum(nil), sig, v.opts.hash(), v.opts.PublicKey)
+}
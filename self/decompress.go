@@ -0,0 +1,141 @@
+package self
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/napalu/gosafedate/metadata"
+)
+
+// Decompressor returns a reader yielding the decompressed contents of r.
+type Decompressor func(r io.Reader) (io.ReadCloser, error)
+
+type compression struct {
+	name string
+	ext  string
+	fn   Decompressor
+}
+
+const defaultCompression = "gzip"
+
+var (
+	compressionsMu sync.RWMutex
+	compressions   = map[string]compression{
+		"gzip":  {name: "gzip", ext: ".gz", fn: newGzipReader},
+		"bzip2": {name: "bzip2", ext: ".bz2", fn: newBzip2Reader},
+		"none":  {name: "none"}, // raw binary, downloaded as is
+	}
+)
+
+// RegisterDecompressor makes a compression format available to the updater.
+// name is matched against the metadata "compression" field; if that field is
+// empty, ext (e.g. ".zst") is matched against the download URL. Registering
+// an existing name replaces it.
+//
+// Formats which would pull dependencies into the self package live in
+// subpackages registering themselves on import, e.g.:
+//
+//	import _ "github.com/napalu/gosafedate/self/zstd"
+func RegisterDecompressor(name, ext string, d Decompressor) {
+	compressionsMu.Lock()
+	defer compressionsMu.Unlock()
+
+	compressions[name] = compression{name: name, ext: ext, fn: d}
+}
+
+// compressionFor selects the decompressor for m, by its Compression field or
+// by the extension of the resolved download URL. Gzip is the default; an
+// uncompressed artifact must be declared with "compression": "none".
+func compressionFor(m *metadata.Metadata, downloadURL string) (compression, error) {
+	compressionsMu.RLock()
+	defer compressionsMu.RUnlock()
+
+	if m.Compression != "" {
+		c, ok := compressions[m.Compression]
+		if !ok {
+			return compression{}, fmt.Errorf("unsupported compression %q", m.Compression)
+		}
+		return c, nil
+	}
+
+	p := downloadURL
+	if u, err := url.Parse(downloadURL); err == nil {
+		p = u.Path
+	}
+	if strings.HasSuffix(p, ".tgz") {
+		return compressions["gzip"], nil
+	}
+	for _, c := range compressions {
+		if c.ext != "" && strings.HasSuffix(path.Base(p), c.ext) {
+			return c, nil
+		}
+	}
+
+	return compressions[defaultCompression], nil
+}
+
+// compressedExt returns the extension of a registered compression format
+// name ends in, or "".
+func compressedExt(name string) string {
+	compressionsMu.RLock()
+	defer compressionsMu.RUnlock()
+
+	for _, c := range compressions {
+		if c.ext != "" && strings.HasSuffix(name, c.ext) {
+			return c.ext
+		}
+	}
+	return ""
+}
+
+// decompressFile decompresses src into dst, failing with ErrTooLarge if the
+// output exceeds limit bytes. dst is synced to disk before returning.
+func decompressFile(src, dst string, d Decompressor, limit int64) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	r, err := d(in)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return writeSynced(dst, limitReader(r, limit, "decompressed binary"))
+}
+
+// writeSynced writes r to a new file dst and syncs it to disk.
+func writeSynced(dst string, r io.Reader) error {
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(out, r); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err = out.Sync(); err != nil {
+		_ = out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+func newGzipReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+func newBzip2Reader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(bzip2.NewReader(r)), nil
+}
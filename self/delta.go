@@ -0,0 +1,161 @@
+package self
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/napalu/gosafedate/bsdiff"
+	"github.com/napalu/gosafedate/metadata"
+	"github.com/napalu/gosafedate/signing"
+)
+
+// patchFor returns the patch of m applying to currentVersion, if any.
+func patchFor(m *metadata.Metadata, currentVersion string) *metadata.Patch {
+	if currentVersion == "" {
+		return nil
+	}
+	cur := strings.TrimPrefix(currentVersion, "v")
+	for i := range m.Patches {
+		if strings.TrimPrefix(m.Patches[i].FromVersion, "v") == cur {
+			return &m.Patches[i]
+		}
+	}
+	return nil
+}
+
+// patchSuffix is the extension of patches downloaded to the work directory.
+const patchSuffix = ".patch"
+
+// applyDelta downloads patch p of m, applies it to the binary at currPath
+// and writes the result to newFile. The patch must be signed by one of the
+// configured keys in <patch>.sig, as written by "gosafedate delta", and
+// match its checksum, if any, before it is applied; the result must match
+// the checksum of m. Otherwise newFile is removed and an error returned so
+// the caller can fall back to the full artifact.
+func applyDelta(cfg Config, m *metadata.Metadata, p *metadata.Patch, currPath, newFile string, warn LogFunc) error {
+	patchURL, err := resolveURL(cfg.URL, p.DownloadURL, m.Version)
+	if err != nil {
+		return err
+	}
+
+	patchPath := strings.TrimSuffix(newFile, newSuffix) + patchSuffix
+	if err = fetchAndDownload(cfg, patchURL, patchPath, cfg.maxDownloadSize(), p.Size, warn); err != nil {
+		return err
+	}
+	defer os.Remove(patchPath)
+	if err = verifyPatch(cfg, p, patchURL, patchPath); err != nil {
+		return err
+	}
+
+	limit, err := patchLimit(cfg, m)
+	if err != nil {
+		return err
+	}
+	if err = patchFile(currPath, patchPath, newFile, limit); err != nil {
+		_ = os.Remove(newFile)
+		return err
+	}
+	if err = verifyChecksum(newFile, m.Checksum); err != nil {
+		_ = os.Remove(newFile)
+		return fmt.Errorf("after patching: %w", err)
+	}
+	return nil
+}
+
+// verifyPatch checks the patch at path against its checksum, if any, and,
+// if cfg has keys, the detached signature at patchURL + ".sig".
+func verifyPatch(cfg Config, p *metadata.Patch, patchURL, path string) error {
+	if p.Checksum != "" {
+		if err := verifyChecksum(path, p.Checksum); err != nil {
+			return fmt.Errorf("patch: %w", err)
+		}
+	}
+	if !cfg.hasKeys() {
+		return nil
+	}
+
+	sig, err := fetchSignature(cfg, patchURL+sigSuffix)
+	if err != nil {
+		return err
+	}
+	for _, key := range append([][]byte{cfg.PubKey}, cfg.PubKeys...) {
+		if len(key) == 0 {
+			continue
+		}
+		if ok, _ := signing.VerifyBinaryRaw(key, path, strings.TrimSpace(string(sig))); ok {
+			return nil
+		}
+	}
+	return errors.New("patch signature verification failed")
+}
+
+// patchLimit returns the maximum size of the binary a patch produces: the
+// size of the download if it is the uncompressed binary, else
+// cfg.MaxBinarySize.
+func patchLimit(cfg Config, m *metadata.Metadata) (int64, error) {
+	limit := cfg.maxBinarySize()
+	if m.Size <= 0 {
+		return limit, nil
+	}
+	resolvedURL, err := resolveURL(cfg.URL, m.DownloadURL, m.Version)
+	if err != nil {
+		return 0, err
+	}
+	comp, err := compressionFor(m, resolvedURL)
+	if err != nil {
+		return 0, err
+	}
+	arch, err := archiveFor(m, resolvedURL)
+	if err != nil {
+		return 0, err
+	}
+	if comp.fn == nil && arch == archiveNone {
+		limit = min(limit, m.Size)
+	}
+	return limit, nil
+}
+
+// patchFile applies the patch at patchPath to the binary at oldPath, writing
+// the result to newPath without holding either in memory.
+func patchFile(oldPath, patchPath, newPath string, limit int64) error {
+	old, err := os.Open(oldPath)
+	if err != nil {
+		return err
+	}
+	defer old.Close()
+	oldInfo, err := old.Stat()
+	if err != nil {
+		return err
+	}
+
+	patch, err := os.Open(patchPath)
+	if err != nil {
+		return err
+	}
+	defer patch.Close()
+	patchInfo, err := patch.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(newPath)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriterSize(out, 1<<16)
+	err = bsdiff.Apply(w, old, oldInfo.Size(), io.NewSectionReader(patch, 0, patchInfo.Size()), limit)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
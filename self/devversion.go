@@ -0,0 +1,45 @@
+package self
+
+import (
+	"log/slog"
+	"strings"
+)
+
+// DevVersionPolicy decides how update checks treat development builds,
+// whose Config.CurrentVer contains "dev", e.g. "dev" or "v1.3.0-dev.2".
+type DevVersionPolicy int
+
+const (
+	// DevSkip never updates development builds (the default).
+	DevSkip DevVersionPolicy = iota
+	// DevWarn is DevSkip, logging a warning on each check.
+	DevWarn
+	// DevAsZero compares development builds as version 0.0.0, so any
+	// release is an update, e.g. to replace nightly builds by releases. A
+	// Config.VersionComparator must accept "0.0.0" for it.
+	DevAsZero
+)
+
+// NoUpdateReason tells why a check found no update, see UpdatePlan.Reason.
+type NoUpdateReason string
+
+const (
+	ReasonUpToDate       NoUpdateReason = "up to date"
+	ReasonDevVersion     NoUpdateReason = "development version"     // see Config.DevVersionPolicy
+	ReasonUnknownVersion NoUpdateReason = "current version unknown" // Config.CurrentVer is empty
+	ReasonIncompatible   NoUpdateReason = "incompatible"            // see metadata.Metadata.CompatibleWith
+)
+
+func isDevVersion(v string) bool {
+	return strings.Contains(v, "dev")
+}
+
+// logWarn returns the LogInfo hook, or a function logging warnings to
+// Logger.
+func (c Config) logWarn() LogFunc {
+	if c.LogInfo == nil && c.Logger != nil {
+		return slogFunc(c.Logger, slog.LevelWarn)
+	}
+	logInfo, _ := normalizeLogs(c)
+	return logInfo
+}
@@ -0,0 +1,130 @@
+//go:build windows
+
+package self
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/napalu/gosafedate/metadata"
+)
+
+// argElevatedHelper starts the elevated helper. ShellExecute doesn't pass the
+// environment on, so its settings are passed as a JSON argument.
+const argElevatedHelper = "--gosafedate-elevated-helper"
+
+// elevatedSuffix is appended to the staged binary: ShellExecute only runs
+// files with an executable extension.
+const elevatedSuffix = ".exe"
+
+// seErrAccessDenied is returned by ShellExecute when the UAC prompt is declined.
+const seErrAccessDenied = 5
+
+var (
+	procShellExecuteW = syscall.NewLazyDLL("shell32.dll").NewProc("ShellExecuteW")
+	shellExecute      = shellExecuteRunas
+)
+
+// elevatedRequest tells the elevated helper what to install where.
+type elevatedRequest struct {
+	Target   string             `json:"target"`
+	Metadata *metadata.Metadata `json:"metadata"`
+	Env      []string           `json:"env"`
+}
+
+// elevate relaunches the staged binary elevated. It copies itself next to
+// target and starts the regular helper from there, which inherits the
+// elevated token.
+func elevate(target, staged string, m *metadata.Metadata, env []string) error {
+	req, err := json.Marshal(elevatedRequest{Target: target, Metadata: m, Env: env})
+	if err != nil {
+		return fmt.Errorf("marshal helper request: %w", err)
+	}
+
+	exe := staged + elevatedSuffix
+	if err = rename(staged, exe); err != nil {
+		return err
+	}
+	if err = shellExecute(exe, syscall.EscapeArg(argElevatedHelper)+" "+syscall.EscapeArg(string(req))); err != nil {
+		_ = os.Remove(exe)
+		return err
+	}
+	return nil
+}
+
+// shellExecuteRunas starts exe with params via the UAC "runas" verb.
+func shellExecuteRunas(exe, params string) error {
+	verb, err := syscall.UTF16PtrFromString("runas")
+	if err != nil {
+		return err
+	}
+	file, err := syscall.UTF16PtrFromString(exe)
+	if err != nil {
+		return err
+	}
+	args, err := syscall.UTF16PtrFromString(params)
+	if err != nil {
+		return err
+	}
+
+	r, _, _ := procShellExecuteW.Call(0, uintptr(unsafe.Pointer(verb)), uintptr(unsafe.Pointer(file)),
+		uintptr(unsafe.Pointer(args)), 0, syscall.SW_HIDE)
+	switch {
+	case r == seErrAccessDenied:
+		return fmt.Errorf("%w: elevation declined", ErrNeedsElevation)
+	case r <= 32:
+		return fmt.Errorf("starting elevated helper: ShellExecute error %d", r)
+	}
+	return nil
+}
+
+// runElevatedHelper is called by MaybeRunUpdateHelper in the elevated
+// process. It verifies itself against the signed metadata before copying
+// anything into the install directory.
+func runElevatedHelper(pubKey []byte, raw string) error {
+	var req elevatedRequest
+	if err := json.Unmarshal([]byte(raw), &req); err != nil {
+		return fmt.Errorf("parse helper request: %w", err)
+	}
+	if req.Metadata == nil || req.Target == "" {
+		return fmt.Errorf("incomplete helper request")
+	}
+
+	if err := VerifySelf(pubKey, req.Metadata); err != nil {
+		return err
+	}
+	exe, err := executable()
+	if err != nil {
+		return err
+	}
+
+	newPath := req.Target + newSuffix
+	if err = copyToSibling(exe, newPath); err != nil {
+		return fmt.Errorf("copy %q -> %q: %w", exe, newPath, err)
+	}
+
+	metaBytes, err := json.Marshal(req.Metadata)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(newPath+metaSuffix, metaBytes, 0o600); err != nil {
+		return fmt.Errorf("write metadata: %w", err)
+	}
+
+	env := os.Environ()
+	for _, kv := range req.Env {
+		if strings.HasPrefix(kv, "GOSAFEDATE_") {
+			env = append(env, kv)
+		}
+	}
+	cmd := execCmd(newPath)
+	cmd.Env = env
+	if err = cmd.Start(); err != nil {
+		return fmt.Errorf("starting update helper: %w", err)
+	}
+	return nil
+}
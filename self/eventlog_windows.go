@@ -0,0 +1,62 @@
+//go:build windows
+
+package self
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	advapi32                  = syscall.NewLazyDLL("advapi32.dll")
+	procRegisterEventSourceW  = advapi32.NewProc("RegisterEventSourceW")
+	procDeregisterEventSource = advapi32.NewProc("DeregisterEventSource")
+	procReportEventW          = advapi32.NewProc("ReportEventW")
+)
+
+const (
+	eventlogErrorType       = 0x0001
+	eventlogInformationType = 0x0004
+)
+
+// eventLog is a handle to an Event Log source. The source does not have to
+// be registered; Event Viewer then shows the message together with a note
+// that the event description can't be found.
+type eventLog uintptr
+
+func openEventLog(source string) (eventLog, error) {
+	p, err := syscall.UTF16PtrFromString(source)
+	if err != nil {
+		return 0, err
+	}
+	h, _, err := procRegisterEventSourceW.Call(0, uintptr(unsafe.Pointer(p)))
+	if h == 0 {
+		return 0, err
+	}
+	return eventLog(h), nil
+}
+
+func (e eventLog) report(isErr bool, msg string) error {
+	p, err := syscall.UTF16PtrFromString(msg)
+	if err != nil {
+		return err
+	}
+	typ := uintptr(eventlogInformationType)
+	if isErr {
+		typ = eventlogErrorType
+	}
+	strs := [1]*uint16{p}
+	r, _, err := procReportEventW.Call(uintptr(e), typ, 0, 1, 0, 1, 0, uintptr(unsafe.Pointer(&strs[0])), 0)
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+func (e eventLog) close() error {
+	r, _, err := procDeregisterEventSource.Call(uintptr(e))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package self
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/napalu/gosafedate/metadata"
+)
+
+// ErrNotNewer is reported by UpdateFleet for a tool whose release in the
+// fleet isn't newer than the version installed, e.g. a replayed older
+// fleet, unless Config.AllowDowngrade is set.
+var ErrNotNewer = errors.New("release not newer than the installed version")
+
+// fleetBase names the files UpdateFleet keeps in the tools directory: the
+// cached key manifest and the fleet state.
+const fleetBase = ".fleet"
+
+// FleetResult is the outcome of updating one tool of a fleet.
+type FleetResult struct {
+	Name    string
+	Path    string
+	Version string // version in the fleet manifest
+	Updated bool
+	Reason  NoUpdateReason // why an installed tool which differs from the manifest wasn't updated
+	Err     error
+}
+
+// fleetState records the versions of the tools UpdateFleet found or
+// installed, by name, so that older releases aren't installed over them.
+type fleetState struct {
+	Versions map[string]string `json:"versions"`
+}
+
+// UpdateFleet fetches the metadata.Fleet manifest at cfg.URL (or from
+// cfg.Source) and updates each of its tools installed in dir to the release
+// for the current platform. The manifest must be signed as a release is,
+// see Config.PubKey, Config.RequiredSignatures and Config.RootKey, and its
+// artifacts are verified as usual.
+//
+// A tool matching the checksum of its release is up to date. Otherwise it is
+// only replaced by a newer release than the version UpdateFleet last found
+// or installed, recorded in dir; a tool installed by other means has no
+// known version and is only replaced if cfg.AllowDowngrade is set, as is an
+// older release. Tools not installed in dir are skipped. The running
+// executable is updated like any other tool, but never restarted.
+//
+// The error reports failures to fetch or verify the manifest; failed tools
+// are reported in their result.
+func UpdateFleet(cfg Config, dir string) ([]FleetResult, error) {
+	logInfo, logError := normalizeLogs(cfg)
+
+	cfg, err := withReleaseKeys(cfg, filepath.Join(dir, fleetBase), logError)
+	if err != nil {
+		logError("failed to load release keys: %v", err)
+		return nil, err
+	}
+	fleet, err := fetchFleet(cfg)
+	if err != nil {
+		logError("failed to fetch fleet manifest: %v", err)
+		return nil, err
+	}
+
+	statePath := filepath.Join(dir, fleetBase+stateSuffix)
+	st := loadFleetState(statePath, warnLog(cfg, logError))
+	exe, _ := cfg.executable()
+	platform := runtime.GOOS + "/" + runtime.GOARCH
+
+	var results []FleetResult
+	for _, tool := range fleet.Tools {
+		name := tool.Name
+		if runtime.GOOS == "windows" {
+			name += ".exe"
+		}
+		if name != filepath.Base(name) {
+			results = append(results, FleetResult{Name: tool.Name, Err: fmt.Errorf("invalid tool name %q", tool.Name)})
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if _, err = os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		res := FleetResult{Name: tool.Name, Path: path}
+		m, ok := tool.Platforms[platform]
+		if !ok {
+			res.Err = fmt.Errorf("no release for %s", platform)
+			results = append(results, res)
+			continue
+		}
+		res.Version = m.Version
+
+		tcfg := cfg
+		tcfg.TargetPath, tcfg.CurrentVer = path, st.Versions[tool.Name]
+		tcfg.Managed = !samePath(path, exe)
+		tcfg.AutoRestart, tcfg.ApplyOn = false, ApplyNow
+
+		if res.Err = verifyChecksum(path, m.Checksum); res.Err == nil {
+			st.Versions[tool.Name] = m.Version
+		}
+		// up to date, or unreadable
+		if !errors.Is(res.Err, ErrChecksumMismatch) {
+			results = append(results, res)
+			continue
+		}
+
+		var newer bool
+		newer, res.Reason, res.Err = shouldUpdate(tcfg, &m)
+		switch {
+		case res.Err != nil:
+		case !newer && !cfg.AllowDowngrade:
+			res.Err = fmt.Errorf("%w: %s (%s)", ErrNotNewer, m.Version, res.Reason)
+		default:
+			res.Reason = ""
+			logInfo("updating %s to %s", tool.Name, m.Version)
+			if res.Err = New(tcfg).Update(&m); res.Err == nil {
+				res.Updated = true
+				st.Versions[tool.Name] = m.Version
+			}
+		}
+		if res.Err != nil {
+			logError("failed to update %s: %v", tool.Name, res.Err)
+		}
+		results = append(results, res)
+	}
+
+	if err = saveState(statePath, st); err != nil {
+		warnLog(cfg, logError)("failed to save fleet state: %v", err)
+	}
+	return results, nil
+}
+
+// fetchFleet fetches the fleet manifest and verifies its signatures, see
+// verifySigners.
+func fetchFleet(cfg Config) (*metadata.Fleet, error) {
+	if !cfg.hasKeys() {
+		return nil, errors.New("fleet manifest requires a public key")
+	}
+
+	ctx, cancel := withTimeout(cfg.metadataTimeout())
+	defer cancel()
+
+	rc, err := cfg.source().FetchMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	f, err := metadata.DecodeFleet(limitReader(rc, cfg.maxMetadataSize(), "metadata"))
+	if err != nil {
+		return nil, err
+	}
+	if err = verifySigners(cfg, f.Verify); err != nil {
+		return nil, fmt.Errorf("fleet manifest: %w", err)
+	}
+	return f, nil
+}
+
+// loadFleetState reads the fleet state at path. A missing or unreadable
+// file yields an empty state.
+func loadFleetState(path string, warn LogFunc) *fleetState {
+	st := &fleetState{}
+	b, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(b, st)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		warn("failed to load fleet state, ignoring: %v", err)
+	}
+	if st.Versions == nil {
+		st.Versions = map[string]string{}
+	}
+	return st
+}
+
+// samePath reports whether a and b name the same file.
+func samePath(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bi, err := os.Stat(b)
+	return err == nil && os.SameFile(ai, bi)
+}
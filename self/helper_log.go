@@ -0,0 +1,89 @@
+package self
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// environment passed to the Windows update helper
+const (
+	envHelperLog         = "GOSAFEDATE_HELPER_LOG"          // file the helper appends to
+	envHelperEventSource = "GOSAFEDATE_HELPER_EVENT_SOURCE" // Windows Event Log source
+)
+
+// eventReporter writes to the system log.
+type eventReporter interface {
+	report(isErr bool, msg string) error
+	close() error
+}
+
+// helperLog records the progress of the update helper, which runs detached
+// from any console: without it, a failed update only leaves a HelperResult.
+// A nil *helperLog discards everything.
+type helperLog struct {
+	w     io.WriteCloser // optional log file
+	event eventReporter  // optional system log
+}
+
+// helperLogEnv returns the logging settings of c as environment entries.
+func (c Config) helperLogEnv() []string {
+	var env []string
+	if c.HelperLogFile != "" {
+		env = append(env, envHelperLog+"="+c.HelperLogFile)
+	}
+	if c.HelperEventSource != "" {
+		env = append(env, envHelperEventSource+"="+c.HelperEventSource)
+	}
+	return env
+}
+
+// openHelperLog opens the log file named in the helper's environment, if
+// any. Logging is best effort: a file which can't be opened is skipped.
+func openHelperLog(getenv func(string) string) *helperLog {
+	l := &helperLog{}
+	if path := getenv(envHelperLog); path != "" {
+		if f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644); err == nil {
+			l.w = f
+		}
+	}
+	return l
+}
+
+func (l *helperLog) infof(format string, args ...any) {
+	l.logf(false, format, args...)
+}
+
+func (l *helperLog) errorf(format string, args ...any) {
+	l.logf(true, format, args...)
+}
+
+func (l *helperLog) logf(isErr bool, format string, args ...any) {
+	if l == nil {
+		return
+	}
+	msg := fmt.Sprintf(format, args...)
+	if l.w != nil {
+		level := "INFO"
+		if isErr {
+			level = "ERROR"
+		}
+		_, _ = fmt.Fprintf(l.w, "%s %s %s\n", time.Now().Format(time.RFC3339), level, msg)
+	}
+	if l.event != nil {
+		_ = l.event.report(isErr, msg)
+	}
+}
+
+func (l *helperLog) close() {
+	if l == nil {
+		return
+	}
+	if l.w != nil {
+		_ = l.w.Close()
+	}
+	if l.event != nil {
+		_ = l.event.close()
+	}
+}
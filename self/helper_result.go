@@ -0,0 +1,60 @@
+package self
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// resultSuffix is appended to the executable for the helper result file.
+const resultSuffix = ".result"
+
+// HelperResult is written by the Windows update helper next to the
+// executable, so the restarted application (or its next run) can tell
+// whether the swap succeeded.
+type HelperResult struct {
+	Success  bool      `json:"success"`
+	Pending  bool      `json:"pending,omitempty"` // scheduled for the next reboot, see HelperRetry.RebootFallback
+	Version  string    `json:"version,omitempty"` // version being installed, if known
+	Error    string    `json:"error,omitempty"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+}
+
+// LastHelperResult returns the result of the last update helper run for the
+// running executable, or nil if there is none. The helper only runs on
+// Windows.
+func LastHelperResult() (*HelperResult, error) {
+	exe, err := executable()
+	if err != nil {
+		return nil, err
+	}
+	if exe, err = filepath.Abs(exe); err != nil {
+		return nil, err
+	}
+
+	b, err := os.ReadFile(exe + resultSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var res HelperResult
+	if err = json.Unmarshal(b, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// writeHelperResult records res for the executable at target.
+func writeHelperResult(target string, res HelperResult) error {
+	b, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(target+resultSuffix, b, 0o644)
+}
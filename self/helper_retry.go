@@ -0,0 +1,123 @@
+package self
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// environment passed to the Windows update helper
+const (
+	envHelperAttempts = "GOSAFEDATE_HELPER_ATTEMPTS"
+	envHelperInterval = "GOSAFEDATE_HELPER_INTERVAL" // time.Duration string
+	envHelperBackoff  = "GOSAFEDATE_HELPER_BACKOFF"
+	envHelperTimeout  = "GOSAFEDATE_HELPER_TIMEOUT" // time.Duration string
+	envHelperReboot   = "GOSAFEDATE_HELPER_REBOOT_FALLBACK"
+)
+
+// ErrExecutableLocked is returned by the Windows update helper when the old
+// executable never becomes replaceable, e.g. because it is held open by an
+// antivirus scanner. The helper exits with code 2 in that case.
+var ErrExecutableLocked = errors.New("executable still locked")
+
+// HelperRetry controls how the Windows update helper waits for the old
+// executable to be unlocked. The zero value retries 100 times every 200ms.
+// The settings are passed to the helper in GOSAFEDATE_HELPER_* environment
+// variables, which can also be set directly.
+type HelperRetry struct {
+	Attempts int           // if 0: 100
+	Interval time.Duration // delay after the first failed attempt; if 0: 200ms
+	Backoff  float64       // interval multiplier per attempt; if < 1: constant interval
+	Timeout  time.Duration // overall limit; if 0: none
+
+	// RebootFallback schedules the replacement for the next reboot
+	// (MoveFileEx with MOVEFILE_DELAY_UNTIL_REBOOT) if the executable stays
+	// locked. This requires administrator rights.
+	RebootFallback bool
+}
+
+func (r HelperRetry) withDefaults() HelperRetry {
+	if r.Attempts <= 0 {
+		r.Attempts = 100
+	}
+	if r.Interval <= 0 {
+		r.Interval = 200 * time.Millisecond
+	}
+	if r.Backoff < 1 {
+		r.Backoff = 1
+	}
+	return r
+}
+
+// env returns the non-zero settings of r as environment entries.
+func (r HelperRetry) env() []string {
+	var env []string
+	if r.Attempts > 0 {
+		env = append(env, envHelperAttempts+"="+strconv.Itoa(r.Attempts))
+	}
+	if r.Interval > 0 {
+		env = append(env, envHelperInterval+"="+r.Interval.String())
+	}
+	if r.Backoff >= 1 {
+		env = append(env, envHelperBackoff+"="+strconv.FormatFloat(r.Backoff, 'g', -1, 64))
+	}
+	if r.Timeout > 0 {
+		env = append(env, envHelperTimeout+"="+r.Timeout.String())
+	}
+	if r.RebootFallback {
+		env = append(env, envHelperReboot+"=1")
+	}
+	return env
+}
+
+// helperRetryFromEnv reads the settings passed to the helper; invalid values
+// are ignored.
+func helperRetryFromEnv(getenv func(string) string) HelperRetry {
+	var r HelperRetry
+	if n, err := strconv.Atoi(getenv(envHelperAttempts)); err == nil {
+		r.Attempts = n
+	}
+	if d, err := time.ParseDuration(getenv(envHelperInterval)); err == nil {
+		r.Interval = d
+	}
+	if f, err := strconv.ParseFloat(getenv(envHelperBackoff), 64); err == nil {
+		r.Backoff = f
+	}
+	if d, err := time.ParseDuration(getenv(envHelperTimeout)); err == nil {
+		r.Timeout = d
+	}
+	r.RebootFallback = getenv(envHelperReboot) == "1"
+	return r.withDefaults()
+}
+
+// do calls fn until it succeeds, the attempts are used up or the timeout
+// expires. The last error is wrapped in ErrExecutableLocked.
+func (r HelperRetry) do(fn func() error, sleep func(time.Duration)) error {
+	r = r.withDefaults()
+
+	var deadline time.Time
+	if r.Timeout > 0 {
+		deadline = time.Now().Add(r.Timeout)
+	}
+
+	interval := r.Interval
+	var (
+		err      error
+		attempts int
+	)
+	for attempts < r.Attempts {
+		attempts++
+		if err = fn(); err == nil {
+			return nil
+		}
+		if !deadline.IsZero() && time.Now().Add(interval).After(deadline) {
+			break
+		}
+		if attempts < r.Attempts {
+			sleep(interval)
+			interval = time.Duration(float64(interval) * r.Backoff)
+		}
+	}
+	return fmt.Errorf("%w after %d attempts: %w", ErrExecutableLocked, attempts, err)
+}
@@ -0,0 +1,87 @@
+// Package instanceid derives a stable, privacy-preserving identifier of the
+// machine an application runs on, e.g. for rollout bucketing or update
+// telemetry. The raw machine ID never leaves this package: identifiers are
+// an HMAC of it keyed per application, so they can't be correlated across
+// applications or reversed.
+package instanceid
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Override, if set, is returned by ID instead of a derived identifier, for
+// applications which manage their own instance IDs.
+var Override func(app string) (string, error)
+
+// machineID is replaced by tests.
+var machineID = readMachineID
+
+// ID returns the instance ID of app on this machine: 32 hex characters,
+// stable across runs and updates. Without a platform machine ID, a random ID
+// persisted in the user's config directory is used instead.
+func ID(app string) (string, error) {
+	if Override != nil {
+		return Override(app)
+	}
+	if app == "" {
+		return "", errors.New("app name required")
+	}
+
+	id, err := machineID()
+	if err != nil || id == "" {
+		if id, err = fallbackID(); err != nil {
+			return "", err
+		}
+	}
+
+	mac := hmac.New(sha256.New, []byte(id))
+	mac.Write([]byte(app))
+	return hex.EncodeToString(mac.Sum(nil)[:16]), nil
+}
+
+// fallbackID returns a random ID created on first use.
+func fallbackID() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "gosafedate", "instance-id")
+
+	if b, err := os.ReadFile(path); err == nil && len(strings.TrimSpace(string(b))) > 0 {
+		return strings.TrimSpace(string(b)), nil
+	}
+
+	buf := make([]byte, 16)
+	if _, err = rand.Read(buf); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(buf)
+	if err = os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return "", err
+	}
+	if err = os.WriteFile(path, []byte(id+"\n"), 0o600); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// readFirst returns the trimmed contents of the first readable file of paths.
+func readFirst(paths ...string) (string, error) {
+	err := error(os.ErrNotExist)
+	for _, p := range paths {
+		var b []byte
+		if b, err = os.ReadFile(p); err == nil {
+			if id := strings.TrimSpace(string(b)); id != "" {
+				return id, nil
+			}
+		}
+	}
+	return "", err
+}
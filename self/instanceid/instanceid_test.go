@@ -0,0 +1,45 @@
+package instanceid
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestID(t *testing.T) {
+	orig := machineID
+	defer func() { machineID = orig }()
+	machineID = func() (string, error) { return "4c4c4544-0042-3510-8051-b4c04f383432", nil }
+
+	a, err := ID("myapp")
+	if err != nil {
+		t.Fatalf("ID returned error: %v", err)
+	}
+	if len(a) != 32 {
+		t.Fatalf("ID = %q, want 32 hex characters", a)
+	}
+	if again, _ := ID("myapp"); again != a {
+		t.Fatalf("ID not stable: %q != %q", again, a)
+	}
+	if other, _ := ID("otherapp"); other == a {
+		t.Fatal("ID is the same for different apps")
+	}
+
+	// without a machine ID a persisted random ID is used
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("AppData", t.TempDir())
+	machineID = func() (string, error) { return "", errors.New("no machine id") }
+	b, err := ID("myapp")
+	if err != nil || b == a {
+		t.Fatalf("fallback ID = %q, %v", b, err)
+	}
+	if again, _ := ID("myapp"); again != b {
+		t.Fatalf("fallback ID not stable: %q != %q", again, b)
+	}
+
+	Override = func(app string) (string, error) { return "fixed-" + app, nil }
+	defer func() { Override = nil }()
+	if id, _ := ID("myapp"); id != "fixed-myapp" {
+		t.Fatalf("ID with Override = %q", id)
+	}
+}
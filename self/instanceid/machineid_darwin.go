@@ -0,0 +1,24 @@
+package instanceid
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// readMachineID returns the IOPlatformUUID of the Mac.
+func readMachineID() (string, error) {
+	out, err := exec.Command("ioreg", "-rd1", "-c", "IOPlatformExpertDevice").Output()
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if !strings.Contains(line, `"IOPlatformUUID"`) {
+			continue
+		}
+		if _, v, ok := strings.Cut(line, "="); ok {
+			return strings.Trim(strings.TrimSpace(v), `"`), nil
+		}
+	}
+	return "", errors.New("IOPlatformUUID not found")
+}
@@ -0,0 +1,5 @@
+package instanceid
+
+func readMachineID() (string, error) {
+	return readFirst("/etc/machine-id", "/var/lib/dbus/machine-id")
+}
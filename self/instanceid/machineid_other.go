@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !windows
+
+package instanceid
+
+// readMachineID returns the host ID of BSD systems, where available.
+func readMachineID() (string, error) {
+	return readFirst("/etc/hostid", "/etc/machine-id", "/var/lib/dbus/machine-id")
+}
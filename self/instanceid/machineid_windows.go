@@ -0,0 +1,32 @@
+package instanceid
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// readMachineID returns the MachineGuid created when Windows was installed.
+func readMachineID() (string, error) {
+	path, err := syscall.UTF16PtrFromString(`SOFTWARE\Microsoft\Cryptography`)
+	if err != nil {
+		return "", err
+	}
+	var key syscall.Handle
+	// KEY_WOW64_64KEY: 32-bit processes would otherwise see a redirected key
+	if err = syscall.RegOpenKeyEx(syscall.HKEY_LOCAL_MACHINE, path, 0, syscall.KEY_READ|0x0100, &key); err != nil {
+		return "", err
+	}
+	defer syscall.RegCloseKey(key)
+
+	name, err := syscall.UTF16PtrFromString("MachineGuid")
+	if err != nil {
+		return "", err
+	}
+	buf := make([]uint16, 64)
+	n := uint32(len(buf) * 2)
+	var typ uint32
+	if err = syscall.RegQueryValueEx(key, name, nil, &typ, (*byte)(unsafe.Pointer(&buf[0])), &n); err != nil {
+		return "", err
+	}
+	return syscall.UTF16ToString(buf[:n/2]), nil
+}
@@ -0,0 +1,148 @@
+package self
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ErrTooLarge is returned when the metadata, the download or the decompressed
+// binary exceed their configured maximum size.
+var ErrTooLarge = errors.New("size limit exceeded")
+
+// default size limits, used when the corresponding Config field is 0
+const (
+	DefaultMaxMetadataSize = 1 << 20 // 1 MiB
+	DefaultMaxDownloadSize = 1 << 30 // 1 GiB
+	DefaultMaxBinarySize   = 2 << 30 // 2 GiB
+)
+
+func (c Config) maxMetadataSize() int64 {
+	return limitOrDefault(c.MaxMetadataSize, DefaultMaxMetadataSize)
+}
+
+func (c Config) maxDownloadSize() int64 {
+	return limitOrDefault(c.MaxDownloadSize, DefaultMaxDownloadSize)
+}
+
+func (c Config) maxBinarySize() int64 {
+	return limitOrDefault(c.MaxBinarySize, DefaultMaxBinarySize)
+}
+
+func limitOrDefault(limit, def int64) int64 {
+	if limit > 0 {
+		return limit
+	}
+	return def
+}
+
+// limitReader returns a reader which fails with ErrTooLarge once more than n
+// bytes have been read from r. Unlike io.LimitReader it does not silently
+// truncate, so an oversized input can't pass for a complete one.
+func limitReader(r io.Reader, n int64, what string) io.Reader {
+	return &limitedReader{r: r, n: n, limit: n, what: what}
+}
+
+type limitedReader struct {
+	r     io.Reader
+	n     int64 // bytes remaining
+	limit int64
+	what  string
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, fmt.Errorf("%w: %s larger than %d bytes", ErrTooLarge, l.what, l.limit)
+	}
+	// allow reading one byte past the limit to detect oversized inputs
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n, fmt.Errorf("%w: %s larger than %d bytes", ErrTooLarge, l.what, l.limit)
+	}
+	return n, err
+}
+
+// limitWriter returns a writer which fails with ErrTooLarge once more than n
+// bytes have been written to w.
+func limitWriter(w io.Writer, n int64, what string) io.Writer {
+	return &limitedWriter{w: w, n: n, limit: n, what: what}
+}
+
+type limitedWriter struct {
+	w     io.Writer
+	n     int64 // bytes remaining
+	limit int64
+	what  string
+
+	size     int64        // expected size from the metadata, 0 if unknown
+	warn     LogFunc      // reports a Content-Length disagreeing with size
+	progress ProgressFunc // optional
+
+	mu      sync.Mutex // guards the progress of chunked downloads
+	written int64
+	total   int64
+}
+
+// downloadWriter returns a limitWriter for an artifact of the given metadata
+// size, which is enforced as the limit if known, reporting to cfg.Progress.
+func downloadWriter(cfg Config, w io.Writer, limit, size int64, warn LogFunc) *limitedWriter {
+	total := int64(-1)
+	if size > 0 {
+		limit, total = min(limit, size), size
+	}
+	return &limitedWriter{w: w, n: limit, limit: limit, what: "download", size: size, warn: warn, progress: cfg.Progress, total: total}
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > l.n {
+		return 0, fmt.Errorf("%w: %s larger than %d bytes", ErrTooLarge, l.what, l.limit)
+	}
+	n, err := l.w.Write(p)
+	l.n -= int64(n)
+	l.report(n)
+	return n, err
+}
+
+func (l *limitedWriter) report(n int) {
+	if l.progress == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.written += int64(n)
+	l.progress(l.written, l.total)
+}
+
+// checkLength checks the Content-Length n of a response, -1 if unknown,
+// before its body is read: oversized responses fail early, and a length
+// disagreeing with the metadata size is reported.
+func (l *limitedWriter) checkLength(n int64) error {
+	if n > l.limit {
+		return fmt.Errorf("%w: %s larger than %d bytes", ErrTooLarge, l.what, l.limit)
+	}
+	if n < 0 {
+		return nil
+	}
+	if l.size > 0 && n != l.size && l.warn != nil {
+		l.warn("%s Content-Length %d differs from the metadata size %d", l.what, n, l.size)
+	}
+	l.mu.Lock()
+	if l.total < 0 {
+		l.total = n
+	}
+	l.mu.Unlock()
+	return nil
+}
+
+// checkContentLength calls checkLength if w is a limitWriter.
+func checkContentLength(w io.Writer, n int64) error {
+	if lw, ok := w.(*limitedWriter); ok {
+		return lw.checkLength(n)
+	}
+	return nil
+}
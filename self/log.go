@@ -0,0 +1,31 @@
+package self
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// logger returns cfg.Logger, or a logger discarding everything.
+func (c Config) logger() *slog.Logger {
+	if c.Logger != nil {
+		return c.Logger
+	}
+	return slog.New(slog.DiscardHandler)
+}
+
+// slogFunc adapts l to a LogFunc logging at level.
+func slogFunc(l *slog.Logger, level slog.Level) LogFunc {
+	return func(format string, args ...interface{}) {
+		l.Log(context.Background(), level, fmt.Sprintf(format, args...))
+	}
+}
+
+// warnLog returns the LogFunc for recoverable errors: Logger's warn level if
+// structured logging is used, logError otherwise.
+func warnLog(c Config, logError LogFunc) LogFunc {
+	if c.LogError == nil && c.Logger != nil {
+		return slogFunc(c.Logger, slog.LevelWarn)
+	}
+	return logError
+}
@@ -0,0 +1,44 @@
+package self
+
+import "time"
+
+// Metrics receives update telemetry, e.g. to feed Prometheus or
+// OpenTelemetry instruments around fleet updates. All hooks are optional and
+// may be called concurrently by concurrent updates.
+type Metrics struct {
+	Check    func(d time.Duration, newer bool, err error)              // metadata check, incl. version comparison
+	Download func(url string, bytes int64, d time.Duration, err error) // per artifact or patch
+	Verify   func(version string, err error)                           // checksum and signature verification
+	Install  func(version string, d time.Duration, err error)          // the whole update, before any restart
+	Rollback func(version string, err error)                           // a partially installed update was undone
+}
+
+func (m *Metrics) check(d time.Duration, newer bool, err error) {
+	if m != nil && m.Check != nil {
+		m.Check(d, newer, err)
+	}
+}
+
+func (m *Metrics) download(url string, bytes int64, d time.Duration, err error) {
+	if m != nil && m.Download != nil {
+		m.Download(url, bytes, d, err)
+	}
+}
+
+func (m *Metrics) verify(version string, err error) {
+	if m != nil && m.Verify != nil {
+		m.Verify(version, err)
+	}
+}
+
+func (m *Metrics) install(version string, d time.Duration, err error) {
+	if m != nil && m.Install != nil {
+		m.Install(version, d, err)
+	}
+}
+
+func (m *Metrics) rollback(version string, err error) {
+	if m != nil && m.Rollback != nil {
+		m.Rollback(version, err)
+	}
+}
@@ -0,0 +1,183 @@
+package self
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// mirrorSource tries the metadata URL and its mirrors in order of health.
+// Artifact URLs below the directory of the primary URL are rewritten to the
+// same relative location on each mirror.
+type mirrorSource struct {
+	cfg  Config
+	urls []string // primary first
+}
+
+// mirrorStatus is the health of a mirror within this process.
+type mirrorStatus struct {
+	failures    int // consecutive failures
+	lastFailure time.Time
+}
+
+// mirrorRetryAfter is how long a failing mirror is demoted.
+const mirrorRetryAfter = 5 * time.Minute
+
+var (
+	mirrorMu     sync.Mutex
+	mirrorHealth = map[string]*mirrorStatus{}
+)
+
+func (c Config) mirrorURLs() []string {
+	urls := []string{c.URL}
+	for _, m := range c.Mirrors {
+		if m != "" && !slices.Contains(urls, m) {
+			urls = append(urls, m)
+		}
+	}
+	return urls
+}
+
+// FetchMetadata implements Source.
+func (s *mirrorSource) FetchMetadata(ctx context.Context) (io.ReadCloser, error) {
+	var errs []error
+	for _, u := range s.ordered() {
+		rc, err := s.sourceFor(u).FetchMetadata(ctx)
+		s.record(u, err)
+		if err == nil {
+			return rc, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", u, err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+// FetchArtifact implements Source.
+func (s *mirrorSource) FetchArtifact(ctx context.Context, url string, w io.Writer) error {
+	var errs []error
+	for _, u := range s.ordered() {
+		cw := &countingWriter{w: w}
+		err := s.sourceFor(u).FetchArtifact(ctx, s.rewrite(url, u), cw)
+		s.record(u, err)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", u, err))
+
+		if errors.Is(err, ErrTooLarge) || ctx.Err() != nil {
+			break
+		}
+		if cw.n > 0 {
+			// a partial download must be discarded before trying the next mirror
+			if rerr := rewind(w); rerr != nil {
+				errs = append(errs, rerr)
+				break
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ArtifactSize implements ArtifactSizer using the healthiest mirror.
+func (s *mirrorSource) ArtifactSize(ctx context.Context, url string) (int64, error) {
+	u := s.ordered()[0]
+	sizer, ok := s.sourceFor(u).(ArtifactSizer)
+	if !ok {
+		return -1, nil
+	}
+	return sizer.ArtifactSize(ctx, s.rewrite(url, u))
+}
+
+// ordered returns the URLs sorted by recent consecutive failures; ties keep
+// the configured order.
+func (s *mirrorSource) ordered() []string {
+	mirrorMu.Lock()
+	defer mirrorMu.Unlock()
+
+	urls := slices.Clone(s.urls)
+	slices.SortStableFunc(urls, func(a, b string) int {
+		return failures(a) - failures(b)
+	})
+	return urls
+}
+
+func failures(url string) int {
+	if st, ok := mirrorHealth[url]; ok && time.Since(st.lastFailure) < mirrorRetryAfter {
+		return st.failures
+	}
+	return 0
+}
+
+func (s *mirrorSource) record(url string, err error) {
+	mirrorMu.Lock()
+	defer mirrorMu.Unlock()
+
+	st, ok := mirrorHealth[url]
+	if !ok {
+		st = &mirrorStatus{}
+		mirrorHealth[url] = st
+	}
+	if err == nil {
+		st.failures = 0
+		return
+	}
+	st.failures++
+	st.lastFailure = time.Now()
+}
+
+// rewrite maps an artifact URL below the primary's directory to mirror.
+func (s *mirrorSource) rewrite(url, mirror string) string {
+	primary := baseDir(s.urls[0])
+	if rel, ok := strings.CutPrefix(url, primary); ok {
+		return baseDir(mirror) + rel
+	}
+	return url
+}
+
+func baseDir(url string) string {
+	return url[:strings.LastIndex(url, "/")+1]
+}
+
+// sourceFor returns the source for a single mirror.
+func (s *mirrorSource) sourceFor(url string) Source {
+	cfg := s.cfg
+	cfg.URL, cfg.Mirrors = url, nil
+	return cfg.source()
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// rewind discards everything written to w so a download can be retried.
+func rewind(w io.Writer) error {
+	switch w := w.(type) {
+	case *limitedWriter:
+		w.n = w.limit
+		return rewind(w.w)
+	case *os.File:
+		if _, err := w.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		return w.Truncate(0)
+	case *bytes.Buffer:
+		w.Reset()
+		return nil
+	default:
+		return fmt.Errorf("can't discard partial download to %T", w)
+	}
+}
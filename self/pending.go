@@ -0,0 +1,80 @@
+package self
+
+import (
+	"errors"
+	"sync"
+)
+
+// ApplyMode selects when a downloaded update is installed.
+type ApplyMode int
+
+const (
+	// ApplyNow installs updates immediately (the default).
+	ApplyNow ApplyMode = iota
+	// OnExit stages verified updates; ApplyPending installs them, typically
+	// from a shutdown hook ("the update will be installed when you quit").
+	OnExit
+	// OnNextStart stages verified updates next to the executable;
+	// ApplyPendingAtStartup installs them early in the next run.
+	OnNextStart
+)
+
+var (
+	pendingMu sync.Mutex
+	pending   = map[string]*StagedUpdate{} // by target path
+)
+
+// setPending registers s, replacing and discarding an older staged update
+// for the same target.
+func setPending(s *StagedUpdate) {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+
+	if old, ok := pending[s.target]; ok && old.Path != s.Path {
+		_ = old.Discard()
+	}
+	pending[s.target] = s
+}
+
+// isPending reports whether version is already staged for cfg's target.
+func isPending(cfg Config, version string) bool {
+	target, err := targetPath(cfg)
+	if err != nil {
+		return false
+	}
+
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+
+	s, ok := pending[target]
+	return ok && s.Metadata.Version == version
+}
+
+// HasPending reports whether updates staged with OnExit are waiting for
+// ApplyPending.
+func HasPending() bool {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+
+	return len(pending) > 0
+}
+
+// ApplyPending installs the updates staged with OnExit. It is meant to be
+// called on shutdown; with AutoRestart set, the updated binary is started.
+func ApplyPending() error {
+	pendingMu.Lock()
+	staged := make([]*StagedUpdate, 0, len(pending))
+	for target, s := range pending {
+		staged = append(staged, s)
+		delete(pending, target)
+	}
+	pendingMu.Unlock()
+
+	var errs []error
+	for _, s := range staged {
+		if err := Apply(s); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,128 @@
+package self
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/napalu/gosafedate/metadata"
+)
+
+// UpdatePlan describes what UpdateFromMetadata would do for the current
+// remote metadata.
+type UpdatePlan struct {
+	CurrentVersion string
+	TargetVersion  string
+	Newer          bool           // true if an update would be applied
+	Reason         NoUpdateReason // if !Newer: why not, e.g. ReasonDevVersion
+	DownloadURL    string         // resolved against cfg.URL
+	Checksum       string         // expected checksum of the uncompressed binary
+	DownloadSize   int64          // bytes to download, -1 if unknown
+	Metadata       *metadata.Metadata
+}
+
+// Plan performs the metadata fetch, version comparison and download URL
+// resolution of an update without downloading the artifact or touching the
+// filesystem. It is meant for CI checks and for prompting users.
+func Plan(cfg Config) (*UpdatePlan, error) {
+	return New(cfg).Plan()
+}
+
+func plan(cfg Config) (*UpdatePlan, error) {
+	logInfo, logError := normalizeLogs(cfg)
+	logInfo("planning update...")
+
+	m, err := fetchMetadata(cfg)
+	if err != nil {
+		logError("failed to fetch metadata: %v", err)
+		return nil, err
+	}
+
+	newer, reason, err := cfg.isNewer(m)
+	if err != nil {
+		logError("failed to determine if we should update version: %v", err)
+		return nil, err
+	}
+
+	resolvedURL, err := resolveURL(cfg.URL, m.DownloadURL, m.Version)
+	if err != nil {
+		logError("failed to resolve download URL: %v", err)
+		return nil, err
+	}
+
+	return &UpdatePlan{
+		CurrentVersion: cfg.CurrentVer,
+		TargetVersion:  m.Version,
+		Newer:          newer,
+		Reason:         reason,
+		DownloadURL:    resolvedURL,
+		Checksum:       m.Checksum,
+		DownloadSize:   downloadSize(cfg, m, resolvedURL),
+		Metadata:       m,
+	}, nil
+}
+
+// VerifyPlan verifies the signature of the release offered by p as
+// UpdateFromMetadata does before installing it: the inline signatures
+// against the keys of cfg, its key manifest and signature threshold, and its
+// transparency log entry; or, for a release signed by a detached signature,
+// the artifact, which is downloaded to a temporary file for it. A key
+// manifest is cached as for an update. It returns nil if cfg has no keys.
+func VerifyPlan(cfg Config, p *UpdatePlan) error {
+	return New(cfg).VerifyPlan(p)
+}
+
+func verifyPlan(cfg Config, p *UpdatePlan) error {
+	_, logError := normalizeLogs(cfg)
+	m := p.Metadata
+
+	if err := checkDetached(cfg); err != nil {
+		return err
+	}
+	currPath, err := targetPath(cfg)
+	if err != nil {
+		return err
+	}
+	if cfg, err = withReleaseKeys(cfg, currPath, warnLog(cfg, logError)); err != nil {
+		return err
+	}
+	if !sidecarSigned(cfg, m) {
+		return verifySignature(cfg, m)
+	}
+	if helperInstalls(cfg, m) {
+		return errors.New("updates installed by the update helper require an inline signature")
+	}
+
+	dir, err := os.MkdirTemp("", "gosafedate-verify-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "artifact")
+	if err = fetchAndDownload(cfg, p.DownloadURL, path, cfg.maxDownloadSize(), m.Size, warnLog(cfg, logError)); err != nil {
+		return err
+	}
+	return verifySidecar(cfg, p.DownloadURL, path)
+}
+
+// downloadSize returns the metadata size of the artifact, or asks the source
+// for it. Errors are not fatal for planning, so -1 is returned when the size
+// can't be determined.
+func downloadSize(cfg Config, m *metadata.Metadata, url string) int64 {
+	if m.Size > 0 {
+		return m.Size
+	}
+	sizer, ok := cfg.source().(ArtifactSizer)
+	if !ok {
+		return -1
+	}
+
+	ctx, cancel := withTimeout(cfg.metadataTimeout())
+	defer cancel()
+
+	size, err := sizer.ArtifactSize(ctx, url)
+	if err != nil {
+		return -1
+	}
+	return size
+}
@@ -0,0 +1,105 @@
+package self
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/napalu/gosafedate/metadata"
+)
+
+var (
+	// ErrVersionNotFound is returned by UpdateTo if the metadata doesn't
+	// list the requested version.
+	ErrVersionNotFound = errors.New("version not found in metadata")
+	// ErrDowngrade is returned by UpdateTo for a version older than
+	// Config.CurrentVer unless Config.AllowDowngrade is set.
+	ErrDowngrade = errors.New("requested version is older than the current version")
+)
+
+// AvailableVersions returns the releases listed by the metadata, sorted by
+// ascending version. A metadata document describing a single release
+// yields just that one; see metadata.Feed for documents listing several.
+func AvailableVersions(cfg Config) ([]metadata.Metadata, error) {
+	return New(cfg).AvailableVersions()
+}
+
+// UpdateTo installs the release of the metadata with version v, e.g. to pin
+// a known-good version or to roll back, after verifying it exactly as
+// UpdateIfNewer would. Unlike UpdateIfNewer it doesn't require v to be newer,
+// and ignores skipped and snoozed versions; an older version than
+// cfg.CurrentVer requires cfg.AllowDowngrade. It does nothing if v is
+// cfg.CurrentVer.
+func UpdateTo(cfg Config, v string) error {
+	return New(cfg).UpdateTo(v)
+}
+
+func availableVersions(cfg Config) ([]metadata.Metadata, error) {
+	releases, _, err := fetchReleasesIf(cfg, Validators{})
+	if err != nil {
+		return nil, err
+	}
+	if err = cfg.sortReleases(releases); err != nil {
+		return nil, err
+	}
+	return releases, nil
+}
+
+func updateTo(cfg Config, v string) error {
+	releases, err := availableVersions(cfg)
+	if err != nil {
+		return err
+	}
+	m := findRelease(cfg, releases, v)
+	if m == nil {
+		return fmt.Errorf("%w: %s", ErrVersionNotFound, v)
+	}
+
+	if sameVersion(cfg, cfg.CurrentVer, m.Version) {
+		return nil
+	}
+	if err = checkDowngrade(cfg, m.Version); err != nil {
+		return err
+	}
+
+	logInfo, _ := normalizeLogs(cfg)
+	logInfo("updating to requested version %s", m.Version)
+	return updateFromMetadata(cfg, m)
+}
+
+// checkDowngrade returns ErrDowngrade if v is older than cfg.CurrentVer and
+// downgrades aren't allowed. Current versions which aren't semantic
+// versions, e.g. development builds, can't be compared and are replaced.
+func checkDowngrade(cfg Config, v string) error {
+	if cfg.AllowDowngrade {
+		return nil
+	}
+	if _, err := cfg.compareVersions(cfg.CurrentVer, cfg.CurrentVer); err != nil {
+		return nil
+	}
+	cmp, err := cfg.compareVersions(v, cfg.CurrentVer)
+	if err != nil {
+		return err
+	}
+	if cmp < 0 {
+		return fmt.Errorf("%w: %s < %s", ErrDowngrade, v, cfg.CurrentVer)
+	}
+	return nil
+}
+
+func sameVersion(cfg Config, a, b string) bool {
+	cmp, err := cfg.compareVersions(a, b)
+	if err != nil {
+		return a == b
+	}
+	return cmp == 0
+}
+
+// findRelease returns the release with version v, ignoring a "v" prefix.
+func findRelease(cfg Config, releases []metadata.Metadata, v string) *metadata.Metadata {
+	for i := range releases {
+		if cmp, err := cfg.compareVersions(releases[i].Version, v); err == nil && cmp == 0 {
+			return &releases[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package self
+
+import (
+	"os"
+	"os/exec"
+)
+
+// Restarter restarts the application once its binary at path has been
+// replaced, e.g. through a process supervisor. If Restart returns nil, the
+// process exits. On Windows, binaries swapped by the update helper are
+// restarted by the helper itself; of the restarters only NoRestart applies
+// there.
+type Restarter interface {
+	Restart(path string) error
+}
+
+// ExecRestart replaces the process image with the new binary on Unix and
+// starts it as a new process on Windows. It is the default.
+type ExecRestart struct{}
+
+func (ExecRestart) Restart(path string) error {
+	return execRestart(Config{}, path)
+}
+
+// SpawnRestart starts the new binary as a child process with the original
+// arguments, after which the current process exits.
+type SpawnRestart struct{}
+
+func (SpawnRestart) Restart(path string) error {
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Start()
+}
+
+// NoRestart leaves the process running even with AutoRestart set; the new
+// binary is used from the next start.
+type NoRestart struct{}
+
+func (NoRestart) Restart(string) error {
+	return nil
+}
+
+// restart restarts the binary at path with c.Restarter.
+func (c Config) restart(path string) error {
+	switch r := c.Restarter.(type) {
+	case nil, ExecRestart:
+		return execRestart(c, path)
+	default:
+		return r.Restart(path)
+	}
+}
+
+// autoRestart reports whether the process is restarted after an update.
+// Managed binaries aren't the running process and are never restarted.
+func (c Config) autoRestart() bool {
+	_, none := c.Restarter.(NoRestart)
+	return c.AutoRestart && !none && !c.Managed
+}
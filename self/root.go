@@ -0,0 +1,153 @@
+package self
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/napalu/gosafedate/metadata"
+	"github.com/napalu/gosafedate/signing"
+)
+
+const rootSuffix = ".root"
+
+// ErrRootExpired is returned when the key manifest is past its expiry date.
+var ErrRootExpired = errors.New("key manifest expired")
+
+// ErrRootRollback is returned when the key manifest at Config.RootURL is
+// older than the one cached, e.g. replayed to reinstate a revoked key.
+var ErrRootRollback = errors.New("key manifest older than the cached one")
+
+// withReleaseKeys returns cfg with the release keys of its key manifest as
+// PubKey and PubKeys, and the manifest's threshold as RequiredSignatures if
+// higher. The manifest is fetched from cfg.RootURL and cached next to
+// target; if it can't be fetched, the cached one is used.
+func withReleaseKeys(cfg Config, target string, logError LogFunc) (Config, error) {
+	if len(cfg.RootKey) == 0 {
+		return cfg, nil
+	}
+	if cfg.RootURL == "" {
+		return cfg, errors.New("root key requires a root URL")
+	}
+
+	cachePath := target + rootSuffix
+	cached, err := loadRoot(cfg.RootKey, cachePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		logError("ignoring cached key manifest: %v", err)
+	}
+
+	keys, raw, err := fetchRoot(cfg)
+	switch {
+	case err != nil && cached == nil:
+		return cfg, fmt.Errorf("key manifest: %w", err)
+	case err != nil:
+		logError("failed to fetch key manifest, using cached one: %v", err)
+		keys, raw = cached, nil
+	case cached != nil && keys.Version < cached.Version:
+		return cfg, fmt.Errorf("%w: version %d < %d", ErrRootRollback, keys.Version, cached.Version)
+	}
+
+	if !keys.Expires.IsZero() && time.Now().After(keys.Expires) {
+		return cfg, fmt.Errorf("%w: version %d on %s", ErrRootExpired, keys.Version, keys.Expires.Format(time.DateOnly))
+	}
+	if raw != nil && (cached == nil || keys.Version > cached.Version) {
+		if err = os.WriteFile(cachePath, raw, 0o644); err != nil {
+			logError("failed to cache key manifest: %v", err)
+		}
+	}
+
+	pubs, err := decodeKeys(keys)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.PubKey, cfg.PubKeys = pubs[0], pubs[1:]
+	cfg.RequiredSignatures = max(cfg.RequiredSignatures, keys.Threshold)
+	return cfg, nil
+}
+
+func fetchRoot(cfg Config) (*metadata.RootKeys, []byte, error) {
+	var buf bytes.Buffer
+	ctx, cancel := withTimeout(cfg.metadataTimeout())
+	defer cancel()
+
+	if err := cfg.source().FetchArtifact(ctx, cfg.RootURL, limitWriter(&buf, cfg.maxMetadataSize(), "key manifest")); err != nil {
+		return nil, nil, err
+	}
+	keys, err := verifyRoot(cfg.RootKey, buf.Bytes())
+	if err != nil {
+		return nil, nil, err
+	}
+	return keys, buf.Bytes(), nil
+}
+
+// loadRoot reads and verifies the cached key manifest at path.
+func loadRoot(rootKey []byte, path string) (*metadata.RootKeys, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return verifyRoot(rootKey, b)
+}
+
+// verifyRoot parses the key manifest b and verifies it is signed by rootKey.
+func verifyRoot(rootKey, b []byte) (*metadata.RootKeys, error) {
+	var root metadata.Root
+	if err := json.Unmarshal(b, &root); err != nil {
+		return nil, fmt.Errorf("parse key manifest: %w", err)
+	}
+
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, root.Signed); err != nil {
+		return nil, fmt.Errorf("parse key manifest: %w", err)
+	}
+	signed := false
+	for _, sig := range root.Signatures {
+		if ok, _ := signing.VerifyRaw(rootKey, compact.String(), sig); ok {
+			signed = true
+			break
+		}
+	}
+	if !signed {
+		return nil, errors.New("key manifest not signed by the root key")
+	}
+
+	var keys metadata.RootKeys
+	if err := json.Unmarshal(root.Signed, &keys); err != nil {
+		return nil, fmt.Errorf("parse key manifest: %w", err)
+	}
+	if len(keys.Keys) == 0 {
+		return nil, errors.New("key manifest lists no keys")
+	}
+	return &keys, nil
+}
+
+func decodeKeys(keys *metadata.RootKeys) ([][]byte, error) {
+	pubs := make([][]byte, 0, len(keys.Keys))
+	for _, k := range keys.Keys {
+		pub, err := base64.StdEncoding.DecodeString(k)
+		if err != nil {
+			return nil, fmt.Errorf("key manifest: invalid key: %w", err)
+		}
+		pubs = append(pubs, pub)
+	}
+	return pubs, nil
+}
+
+// trustedKeys returns rootKey and the release keys of the key manifest
+// cached next to target, for re-verifying a staged update with the key
+// embedded in the binary. The keys of an expired manifest aren't trusted.
+func trustedKeys(rootKey []byte, target string) [][]byte {
+	keys := [][]byte{rootKey}
+	cached, err := loadRoot(rootKey, target+rootSuffix)
+	if err != nil || (!cached.Expires.IsZero() && time.Now().After(cached.Expires)) {
+		return keys
+	}
+	if pubs, err := decodeKeys(cached); err == nil {
+		keys = append(keys, pubs...)
+	}
+	return keys
+}
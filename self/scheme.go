@@ -0,0 +1,138 @@
+package self
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/napalu/gosafedate/metadata"
+	"github.com/napalu/gosafedate/version"
+)
+
+// VersionScheme selects how Config.CurrentVer and release versions are
+// compared.
+type VersionScheme int
+
+const (
+	// SemVer compares semantic versions, e.g. v1.2.3 (the default).
+	SemVer VersionScheme = iota
+	// CalVer compares calendar versions, e.g. 2024.06.1; see version.CalVer.
+	CalVer
+)
+
+// VersionComparator compares versions for products with their own
+// versioning, e.g. build numbers or "git describe" output; see
+// Config.VersionComparator.
+type VersionComparator interface {
+	// Compare returns a negative number, zero or a positive number if a
+	// precedes, equals or follows b, or an error if either is invalid.
+	Compare(a, b string) (int, error)
+}
+
+// PrereleaseComparator is optionally implemented by VersionComparators
+// whose versions include pre-releases, which are only offered with
+// Config.AllowPrerelease.
+type PrereleaseComparator interface {
+	VersionComparator
+	IsPrerelease(v string) bool
+}
+
+// VersionCompareFunc adapts a function to a VersionComparator.
+type VersionCompareFunc func(a, b string) (int, error)
+
+// Compare implements VersionComparator.
+func (f VersionCompareFunc) Compare(a, b string) (int, error) {
+	return f(a, b)
+}
+
+// semVerComparator implements the SemVer scheme; versions may be prefixed
+// by "v".
+type semVerComparator struct{}
+
+func (semVerComparator) Compare(a, b string) (int, error) {
+	va, err := version.NewSemVer(a, "v")
+	if err != nil {
+		return 0, err
+	}
+	vb, err := version.NewSemVer(b, "v")
+	if err != nil {
+		return 0, err
+	}
+	return va.Compare(vb), nil
+}
+
+func (semVerComparator) IsPrerelease(v string) bool {
+	sv, err := version.NewSemVer(v, "v")
+	return err == nil && sv.IsPrerelease()
+}
+
+// calVerComparator implements the CalVer scheme; versions may be prefixed
+// by "v".
+type calVerComparator struct{}
+
+func (calVerComparator) Compare(a, b string) (int, error) {
+	va, err := version.NewCalVer(a, "v")
+	if err != nil {
+		return 0, err
+	}
+	vb, err := version.NewCalVer(b, "v")
+	if err != nil {
+		return 0, err
+	}
+	return va.Compare(vb), nil
+}
+
+func (calVerComparator) IsPrerelease(v string) bool {
+	cv, err := version.NewCalVer(v, "v")
+	return err == nil && cv.IsPrerelease()
+}
+
+// comparator returns c.VersionComparator, or that of c.VersionScheme.
+func (c Config) comparator() VersionComparator {
+	switch {
+	case c.VersionComparator != nil:
+		return c.VersionComparator
+	case c.VersionScheme == CalVer:
+		return calVerComparator{}
+	}
+	return semVerComparator{}
+}
+
+// compareVersions returns a negative number, zero or a positive number if a
+// precedes, equals or follows b.
+func (c Config) compareVersions(a, b string) (int, error) {
+	return c.comparator().Compare(a, b)
+}
+
+// isPrerelease reports whether v is a valid pre-release version.
+func (c Config) isPrerelease(v string) bool {
+	pc, ok := c.comparator().(PrereleaseComparator)
+	return ok && pc.IsPrerelease(v)
+}
+
+// sortReleases sorts releases by ascending version, like metadata.Sort for
+// the versions of c.
+func (c Config) sortReleases(releases []metadata.Metadata) error {
+	for _, m := range releases {
+		if _, err := c.compareVersions(m.Version, m.Version); err != nil {
+			return fmt.Errorf("%w: version %q: %v", metadata.ErrInvalid, m.Version, err)
+		}
+	}
+	slices.SortStableFunc(releases, func(a, b metadata.Metadata) int {
+		n, _ := c.compareVersions(a.Version, b.Version)
+		return n
+	})
+	return nil
+}
+
+// latest returns the release with the highest version, like metadata.Latest
+// for the versions of c.
+func (c Config) latest(releases []metadata.Metadata) (*metadata.Metadata, error) {
+	if len(releases) == 1 {
+		return &releases[0], nil
+	}
+	sorted := slices.Clone(releases)
+	if err := c.sortReleases(sorted); err != nil {
+		return nil, err
+	}
+	return &sorted[len(sorted)-1], nil
+}
@@ -0,0 +1,122 @@
+//go:build windows
+
+package self
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var (
+	procOpenSCManagerW     = advapi32.NewProc("OpenSCManagerW")
+	procOpenServiceW       = advapi32.NewProc("OpenServiceW")
+	procControlService     = advapi32.NewProc("ControlService")
+	procQueryServiceStatus = advapi32.NewProc("QueryServiceStatus")
+	procStartServiceW      = advapi32.NewProc("StartServiceW")
+	procCloseServiceHandle = advapi32.NewProc("CloseServiceHandle")
+)
+
+var (
+	stopService        = scmStop
+	startService       = scmStart
+	serviceStopTimeout = 30 * time.Second
+)
+
+const (
+	errServiceNotActive      = syscall.Errno(1062) // ERROR_SERVICE_NOT_ACTIVE
+	errServiceAlreadyRunning = syscall.Errno(1056) // ERROR_SERVICE_ALREADY_RUNNING
+)
+
+const (
+	scManagerConnect     = 0x0001
+	serviceQueryStatus   = 0x0004
+	serviceStart         = 0x0010
+	serviceStop          = 0x0020
+	serviceControlStop   = 1
+	serviceStateStopped  = 1
+	servicePollInterval  = 250 * time.Millisecond
+	serviceAccessControl = serviceQueryStatus | serviceStart | serviceStop
+)
+
+// serviceStatus is SERVICE_STATUS.
+type serviceStatus struct {
+	ServiceType             uint32
+	CurrentState            uint32
+	ControlsAccepted        uint32
+	Win32ExitCode           uint32
+	ServiceSpecificExitCode uint32
+	CheckPoint              uint32
+	WaitHint                uint32
+}
+
+// openService opens the named service and returns a function closing both
+// handles.
+func openService(name string) (uintptr, func(), error) {
+	scm, _, err := procOpenSCManagerW.Call(0, 0, scManagerConnect)
+	if scm == 0 {
+		return 0, nil, fmt.Errorf("open service manager: %w", err)
+	}
+	p, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		_, _, _ = procCloseServiceHandle.Call(scm)
+		return 0, nil, err
+	}
+	h, _, err := procOpenServiceW.Call(scm, uintptr(unsafe.Pointer(p)), serviceAccessControl)
+	if h == 0 {
+		_, _, _ = procCloseServiceHandle.Call(scm)
+		return 0, nil, fmt.Errorf("open service %q: %w", name, err)
+	}
+	return h, func() {
+		_, _, _ = procCloseServiceHandle.Call(h)
+		_, _, _ = procCloseServiceHandle.Call(scm)
+	}, nil
+}
+
+// scmStop asks the service control manager to stop the named service and
+// waits until it has stopped.
+func scmStop(name string) error {
+	h, closeFn, err := openService(name)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	var st serviceStatus
+	r, _, err := procControlService.Call(h, serviceControlStop, uintptr(unsafe.Pointer(&st)))
+	if r == 0 && !errors.Is(err, errServiceNotActive) {
+		return fmt.Errorf("stop service %q: %w", name, err)
+	}
+
+	deadline := time.Now().Add(serviceStopTimeout)
+	for {
+		r, _, err = procQueryServiceStatus.Call(h, uintptr(unsafe.Pointer(&st)))
+		if r == 0 {
+			return fmt.Errorf("query service %q: %w", name, err)
+		}
+		if st.CurrentState == serviceStateStopped {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("service %q did not stop within %v", name, serviceStopTimeout)
+		}
+		time.Sleep(servicePollInterval)
+	}
+}
+
+// scmStart starts the named service.
+func scmStart(name string) error {
+	h, closeFn, err := openService(name)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	r, _, err := procStartServiceW.Call(h, 0, 0)
+	if r == 0 && !errors.Is(err, errServiceAlreadyRunning) {
+		return fmt.Errorf("start service %q: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package self
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/napalu/gosafedate/metadata"
+	"github.com/napalu/gosafedate/signing"
+)
+
+const (
+	sigSuffix     = ".sig"
+	minisigSuffix = ".minisig"
+)
+
+// ArtifactVerifier verifies downloaded artifacts against a detached
+// signature published next to them, for signing schemes without a static
+// public key such as sigstore's keyless signing. See the self/sigstore
+// package.
+type ArtifactVerifier interface {
+	// SignatureSuffix is appended to the artifact URL to fetch the signature.
+	SignatureSuffix() string
+	// VerifyArtifact verifies the artifact at path against sig.
+	VerifyArtifact(path string, sig []byte) error
+}
+
+// sidecarSigned reports whether m is signed by a detached signature next to
+// its artifact instead of inline. Such releases are produced by generic
+// signing tools, e.g. gosafedate sign-file, which signs the SHA-256 of the
+// artifact rather than "version+sha256", minisign or cosign. Without
+// cfg.Verifier, they are only accepted if cfg.DetachedSignatures is set:
+// the signature covers the artifact alone, so anything the key ever signed,
+// e.g. an old release or a patch, could be served as any version.
+func sidecarSigned(cfg Config, m *metadata.Metadata) bool {
+	if cfg.Verifier != nil {
+		return true
+	}
+	if !cfg.DetachedSignatures || len(cfg.PubKey) == 0 {
+		return false
+	}
+	return len(m.AllSignatures()) == 0 || signing.IsMinisignKey(cfg.PubKey)
+}
+
+// checkDetached rejects cfg if it accepts detached signatures along with
+// several release keys, a signature threshold or a key manifest, which a
+// signature by one key over the artifact alone would bypass, or if it has
+// a minisign key, which only verifies detached signatures, without
+// accepting them.
+func checkDetached(cfg Config) error {
+	switch {
+	case cfg.DetachedSignatures && (len(cfg.PubKeys) > 0 || cfg.RequiredSignatures > 1 || len(cfg.RootKey) > 0):
+		return errors.New("detached signatures can't be used with PubKeys, RequiredSignatures or RootKey")
+	case !cfg.DetachedSignatures && cfg.Verifier == nil && signing.IsMinisignKey(cfg.PubKey):
+		return errors.New("minisign keys require DetachedSignatures")
+	}
+	return nil
+}
+
+// verifySidecar fetches the detached signature of the artifact at
+// artifactURL and verifies it against the downloaded artifact at path: a
+// minisign signature at artifactURL + ".minisig" if cfg.PubKey is a minisign
+// key, otherwise the base64 signature over the artifact's SHA-256 at
+// artifactURL + ".sig". cfg.Verifier, if set, takes precedence over both.
+func verifySidecar(cfg Config, artifactURL, path string) error {
+	minisign := signing.IsMinisignKey(cfg.PubKey)
+	suffix := sigSuffix
+	switch {
+	case cfg.Verifier != nil:
+		suffix = cfg.Verifier.SignatureSuffix()
+	case minisign:
+		suffix = minisigSuffix
+	}
+
+	sig, err := fetchSignature(cfg, artifactURL+suffix)
+	if err != nil {
+		return err
+	}
+	if cfg.Verifier != nil {
+		return cfg.Verifier.VerifyArtifact(path, sig)
+	}
+
+	var ok bool
+	if minisign {
+		ok, err = verifyMinisign(cfg.PubKey, path, sig)
+	} else {
+		ok, err = signing.VerifyBinaryRaw(cfg.PubKey, path, strings.TrimSpace(string(sig)))
+	}
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("signature verification failed")
+	}
+	return nil
+}
+
+// fetchSignature downloads the detached signature at url.
+func fetchSignature(cfg Config, url string) ([]byte, error) {
+	var buf bytes.Buffer
+	ctx, cancel := withTimeout(cfg.metadataTimeout())
+	defer cancel()
+
+	if err := cfg.source().FetchArtifact(ctx, url, limitWriter(&buf, cfg.maxMetadataSize(), "signature")); err != nil {
+		return nil, fmt.Errorf("fetch signature: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// verifyDownload verifies the detached signature of the artifact at path if m
+// has no inline signature.
+func verifyDownload(cfg Config, m *metadata.Metadata, artifactURL, path string, logInfo LogFunc) error {
+	if !sidecarSigned(cfg, m) {
+		return nil
+	}
+	logInfo("verifying detached signature")
+	err := verifySidecar(cfg, artifactURL, path)
+	cfg.Metrics.verify(m.Version, err)
+	return err
+}
+
+func verifyMinisign(pubKey []byte, path string, sig []byte) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	return signing.VerifyMinisign(pubKey, f, sig)
+}
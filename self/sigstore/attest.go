@@ -0,0 +1,223 @@
+package sigstore
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/napalu/gosafedate/metadata"
+	"github.com/napalu/gosafedate/self"
+	"github.com/napalu/gosafedate/signing"
+)
+
+// DefaultRekorURL is the public sigstore Rekor instance.
+const DefaultRekorURL = "https://rekor.sigstore.dev"
+
+// Rekor requires release signatures to be logged in a Rekor transparency log
+// of TrustedRoot, by checking the metadata's transparency log entry. It
+// implements self.LogVerifier. Only Ed25519 and ECDSA signatures can be
+// logged.
+type Rekor struct {
+	TrustedRoot *TrustedRoot
+}
+
+// VerifyLogged verifies that m.TransparencyLog is a Rekor entry of
+// m.Signature by pubKey, promised to be included by its log.
+func (r *Rekor) VerifyLogged(m *metadata.Metadata, pubKey []byte) error {
+	le := m.TransparencyLog
+	if le == nil {
+		return self.ErrNotLogged
+	}
+	if r.TrustedRoot == nil {
+		return errors.New("sigstore: trusted root required")
+	}
+
+	e := tlogEntry{integratedTime: le.IntegratedTime, logIndex: le.LogIndex}
+	var err error
+	if e.body, err = base64.StdEncoding.DecodeString(le.Body); err != nil {
+		return fmt.Errorf("decode log entry: %w", err)
+	}
+	if e.set, err = base64.StdEncoding.DecodeString(le.SignedEntryTimestamp); err != nil {
+		return fmt.Errorf("decode signed entry timestamp: %w", err)
+	}
+	if e.logID, err = hex.DecodeString(le.LogID); err != nil {
+		return fmt.Errorf("decode log ID: %w", err)
+	}
+	if len(e.set) == 0 {
+		return errors.New("log entry has no signed entry timestamp")
+	}
+	if _, err = verifyEntry(r.TrustedRoot, &e, time.Now()); err != nil {
+		return err
+	}
+	return verifyRekord(e.body, m, pubKey)
+}
+
+// verifyRekord checks that the rekord entry body records the signature of
+// m by pubKey.
+func verifyRekord(body []byte, m *metadata.Metadata, pubKey []byte) error {
+	var rec struct {
+		Kind string `json:"kind"`
+		Spec struct {
+			Data struct {
+				Hash struct {
+					Algorithm string `json:"algorithm"`
+					Value     string `json:"value"`
+				} `json:"hash"`
+			} `json:"data"`
+			Signature struct {
+				Content   []byte `json:"content"`
+				PublicKey struct {
+					Content []byte `json:"content"`
+				} `json:"publicKey"`
+			} `json:"signature"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal(body, &rec); err != nil {
+		return fmt.Errorf("parse transparency log entry: %w", err)
+	}
+	if rec.Kind != "rekord" {
+		return fmt.Errorf("unsupported transparency log entry kind %q", rec.Kind)
+	}
+
+	sum := sha256Hex([]byte(m.SigningMessage()))
+	if h := rec.Spec.Data.Hash; h.Algorithm != "sha256" || h.Value != sum {
+		return errors.New("transparency log entry does not match the release")
+	}
+	sig, err := base64.StdEncoding.DecodeString(m.Signature)
+	if err != nil || !bytes.Equal(rec.Spec.Signature.Content, sig) {
+		return errors.New("transparency log entry does not match the signature")
+	}
+
+	want, err := signing.ParsePublicKey(pubKey)
+	if err != nil {
+		return err
+	}
+	block, _ := pem.Decode(rec.Spec.Signature.PublicKey.Content)
+	if block == nil {
+		return errors.New("transparency log entry has no public key")
+	}
+	got, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("parse logged public key: %w", err)
+	}
+	if k, ok := got.(interface{ Equal(crypto.PublicKey) bool }); !ok || !k.Equal(want) {
+		return errors.New("transparency log entry does not match the public key")
+	}
+	return nil
+}
+
+// Attest logs the release signature of m by pubKey in the Rekor instance at
+// rekorURL, or returns its existing entry, for recording in
+// m.TransparencyLog.
+func Attest(ctx context.Context, rekorURL string, m *metadata.Metadata, pubKey []byte) (*metadata.LogEntry, error) {
+	pub, err := signing.ParsePublicKey(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.StdEncoding.DecodeString(m.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("decode signature: %w", err)
+	}
+
+	proposed := map[string]any{
+		"apiVersion": "0.0.1",
+		"kind":       "rekord",
+		"spec": map[string]any{
+			"signature": map[string]any{
+				"format":    "x509",
+				"content":   sig,
+				"publicKey": map[string]any{"content": pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})},
+			},
+			"data": map[string]any{"content": []byte(m.SigningMessage())},
+		},
+	}
+
+	base := strings.TrimSuffix(rekorURL, "/")
+	var created map[string]rekorEntry
+	status, err := postJSON(ctx, base+"/api/v1/log/entries", proposed, &created)
+	if status == http.StatusConflict {
+		var found []map[string]rekorEntry
+		if _, err = postJSON(ctx, base+"/api/v1/log/entries/retrieve", map[string]any{"entries": []any{proposed}}, &found); err != nil {
+			return nil, err
+		}
+		if len(found) > 0 {
+			created = found[0]
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, e := range created {
+		if e.Verification.SignedEntryTimestamp == "" {
+			return nil, errors.New("rekor returned no signed entry timestamp")
+		}
+		return &metadata.LogEntry{
+			LogIndex:             e.LogIndex,
+			LogID:                e.LogID,
+			IntegratedTime:       e.IntegratedTime,
+			Body:                 e.Body,
+			SignedEntryTimestamp: e.Verification.SignedEntryTimestamp,
+		}, nil
+	}
+	return nil, errors.New("rekor returned no log entry")
+}
+
+type rekorEntry struct {
+	Body           string `json:"body"`
+	IntegratedTime int64  `json:"integratedTime"`
+	LogID          string `json:"logID"`
+	LogIndex       int64  `json:"logIndex"`
+	Verification   struct {
+		SignedEntryTimestamp string `json:"signedEntryTimestamp"`
+	} `json:"verification"`
+}
+
+// postJSON posts v to url and decodes the response into out. The status is
+// returned along with errors for non-2xx responses.
+func postJSON(ctx context.Context, url string, v, out any) (int, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return resp.StatusCode, fmt.Errorf("rekor: %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return resp.StatusCode, json.Unmarshal(body, out)
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,126 @@
+package sigstore_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/napalu/gosafedate/metadata"
+	"github.com/napalu/gosafedate/self"
+	"github.com/napalu/gosafedate/self/sigstore"
+)
+
+// fakeRekor logs rekord entries like Rekor, storing the content hash instead
+// of the content in the canonicalized body.
+func (f *fixture) fakeRekor() *httptest.Server {
+	var logged []map[string]any
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var proposed struct {
+			Spec struct {
+				Signature map[string]any `json:"signature"`
+				Data      struct {
+					Content []byte `json:"content"`
+				} `json:"data"`
+			} `json:"spec"`
+		}
+		switch r.URL.Path {
+		case "/api/v1/log/entries":
+			if err := json.NewDecoder(r.Body).Decode(&proposed); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if len(logged) > 0 {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			sum := sha256.Sum256(proposed.Spec.Data.Content)
+			body, _ := json.Marshal(map[string]any{
+				"apiVersion": "0.0.1",
+				"kind":       "rekord",
+				"spec": map[string]any{
+					"data":      map[string]any{"hash": map[string]any{"algorithm": "sha256", "value": hex.EncodeToString(sum[:])}},
+					"signature": proposed.Spec.Signature,
+				},
+			})
+			entry := map[string]any{
+				"body":           body,
+				"integratedTime": time.Now().Unix(),
+				"logID":          hex.EncodeToString(f.logID),
+				"logIndex":       int64(7),
+			}
+			payload, _ := json.Marshal(entry)
+			entry["verification"] = map[string]any{"signedEntryTimestamp": f.rekorSign(payload)}
+			logged = append(logged, map[string]any{"24296fb24b8ad77a": entry})
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(logged[0])
+		case "/api/v1/log/entries/retrieve":
+			_ = json.NewEncoder(w).Encode(logged)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestRekor_AttestAndVerify(t *testing.T) {
+	f := newFixture(t)
+	srv := f.fakeRekor()
+	defer srv.Close()
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	m := &metadata.Metadata{Version: "v1.2.4", Checksum: fmt.Sprintf("%x", sha256.Sum256([]byte("new-binary")))}
+	m.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(m.Version+"+"+m.Checksum)))
+
+	rekor := &sigstore.Rekor{TrustedRoot: f.root}
+	if err = rekor.VerifyLogged(m, pub); !errors.Is(err, self.ErrNotLogged) {
+		t.Fatalf("expected ErrNotLogged, got %v", err)
+	}
+
+	if m.TransparencyLog, err = sigstore.Attest(context.Background(), srv.URL, m, pub); err != nil {
+		t.Fatalf("Attest: %v", err)
+	}
+	if err = rekor.VerifyLogged(m, pub); err != nil {
+		t.Fatalf("VerifyLogged: %v", err)
+	}
+
+	// attesting again returns the existing entry
+	again, err := sigstore.Attest(context.Background(), srv.URL, m, pub)
+	if err != nil {
+		t.Fatalf("Attest (existing): %v", err)
+	}
+	if *again != *m.TransparencyLog {
+		t.Fatalf("Attest (existing) = %+v, want %+v", again, m.TransparencyLog)
+	}
+
+	other, _, _ := ed25519.GenerateKey(nil)
+	if err = rekor.VerifyLogged(m, other); err == nil {
+		t.Fatal("expected other public key to fail")
+	}
+	changed := *m
+	changed.Version = "v1.2.5"
+	if err = rekor.VerifyLogged(&changed, pub); err == nil {
+		t.Fatal("expected other release to fail")
+	}
+	rogue := newFixture(t)
+	if err = (&sigstore.Rekor{TrustedRoot: rogue.root}).VerifyLogged(m, pub); err == nil {
+		t.Fatal("expected untrusted log to fail")
+	}
+	forged := *m.TransparencyLog
+	forged.IntegratedTime++
+	changed = *m
+	changed.TransparencyLog = &forged
+	if err = rekor.VerifyLogged(&changed, pub); err == nil {
+		t.Fatal("expected forged entry to fail")
+	}
+}
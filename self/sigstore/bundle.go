@@ -0,0 +1,216 @@
+package sigstore
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// bundle is the verification material of a signed artifact, normalized from
+// either of the bundle formats.
+type bundle struct {
+	cert      *x509.Certificate
+	signature []byte
+	digest    []byte // SHA-256 of the artifact, if the bundle records it
+	entry     tlogEntry
+}
+
+// tlogEntry is a Rekor log entry with its signed entry timestamp and, for
+// sigstore bundles, its inclusion proof.
+type tlogEntry struct {
+	body           []byte
+	integratedTime int64
+	logIndex       int64
+	logID          []byte
+	set            []byte
+	proof          *inclusionProof
+}
+
+type inclusionProof struct {
+	logIndex   int64
+	treeSize   int64
+	rootHash   []byte
+	hashes     [][]byte
+	checkpoint string
+}
+
+// parseBundle parses a sigstore bundle (application/vnd.dev.sigstore.bundle,
+// written by "cosign sign-blob --new-bundle-format") or a legacy cosign
+// bundle (written by "cosign sign-blob --bundle").
+func parseBundle(data []byte) (*bundle, error) {
+	var probe struct {
+		MediaType string `json:"mediaType"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("parse bundle: %w", err)
+	}
+	if probe.MediaType != "" {
+		return parseSigstoreBundle(data)
+	}
+	return parseCosignBundle(data)
+}
+
+func parseCosignBundle(data []byte) (*bundle, error) {
+	var raw struct {
+		Signature   string `json:"base64Signature"`
+		Cert        string `json:"cert"`
+		RekorBundle *struct {
+			SET     []byte `json:"SignedEntryTimestamp"`
+			Payload struct {
+				Body           []byte `json:"body"`
+				IntegratedTime int64  `json:"integratedTime"`
+				LogIndex       int64  `json:"logIndex"`
+				LogID          string `json:"logID"`
+			} `json:"Payload"`
+		} `json:"rekorBundle"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parse bundle: %w", err)
+	}
+	if raw.RekorBundle == nil {
+		return nil, errors.New("bundle has no transparency log entry")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(raw.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("decode signature: %w", err)
+	}
+	certPEM, err := base64.StdEncoding.DecodeString(raw.Cert)
+	if err != nil {
+		return nil, fmt.Errorf("decode certificate: %w", err)
+	}
+	cert, err := parsePEMCertificate(certPEM)
+	if err != nil {
+		return nil, err
+	}
+	logID, err := hex.DecodeString(raw.RekorBundle.Payload.LogID)
+	if err != nil {
+		return nil, fmt.Errorf("decode log ID: %w", err)
+	}
+
+	p := raw.RekorBundle.Payload
+	return &bundle{
+		cert:      cert,
+		signature: sig,
+		entry: tlogEntry{
+			body:           p.Body,
+			integratedTime: p.IntegratedTime,
+			logIndex:       p.LogIndex,
+			logID:          logID,
+			set:            raw.RekorBundle.SET,
+		},
+	}, nil
+}
+
+func parseSigstoreBundle(data []byte) (*bundle, error) {
+	type rawBytes struct {
+		RawBytes []byte `json:"rawBytes"`
+	}
+	var raw struct {
+		VerificationMaterial struct {
+			Certificate *rawBytes `json:"certificate"`
+			Chain       *struct {
+				Certificates []rawBytes `json:"certificates"`
+			} `json:"x509CertificateChain"`
+			TLogEntries []struct {
+				LogIndex string `json:"logIndex"`
+				LogID    struct {
+					KeyID []byte `json:"keyId"`
+				} `json:"logId"`
+				IntegratedTime   string `json:"integratedTime"`
+				InclusionPromise *struct {
+					SET []byte `json:"signedEntryTimestamp"`
+				} `json:"inclusionPromise"`
+				InclusionProof *struct {
+					LogIndex   string   `json:"logIndex"`
+					RootHash   []byte   `json:"rootHash"`
+					TreeSize   string   `json:"treeSize"`
+					Hashes     [][]byte `json:"hashes"`
+					Checkpoint struct {
+						Envelope string `json:"envelope"`
+					} `json:"checkpoint"`
+				} `json:"inclusionProof"`
+				CanonicalizedBody []byte `json:"canonicalizedBody"`
+			} `json:"tlogEntries"`
+		} `json:"verificationMaterial"`
+		MessageSignature *struct {
+			MessageDigest struct {
+				Algorithm string `json:"algorithm"`
+				Digest    []byte `json:"digest"`
+			} `json:"messageDigest"`
+			Signature []byte `json:"signature"`
+		} `json:"messageSignature"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parse bundle: %w", err)
+	}
+	if raw.MessageSignature == nil {
+		return nil, errors.New("bundle has no message signature")
+	}
+	vm := raw.VerificationMaterial
+	if len(vm.TLogEntries) == 0 {
+		return nil, errors.New("bundle has no transparency log entry")
+	}
+
+	var der []byte
+	switch {
+	case vm.Certificate != nil:
+		der = vm.Certificate.RawBytes
+	case vm.Chain != nil && len(vm.Chain.Certificates) > 0:
+		der = vm.Chain.Certificates[0].RawBytes
+	default:
+		return nil, errors.New("bundle has no certificate")
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("parse certificate: %w", err)
+	}
+
+	b := &bundle{cert: cert, signature: raw.MessageSignature.Signature}
+	if md := raw.MessageSignature.MessageDigest; len(md.Digest) > 0 {
+		if md.Algorithm != "SHA2_256" {
+			return nil, fmt.Errorf("unsupported message digest %q", md.Algorithm)
+		}
+		b.digest = md.Digest
+	}
+
+	e := vm.TLogEntries[0]
+	b.entry = tlogEntry{body: e.CanonicalizedBody, logID: e.LogID.KeyID}
+	if b.entry.logIndex, err = strconv.ParseInt(e.LogIndex, 10, 64); err != nil {
+		return nil, fmt.Errorf("parse log index: %w", err)
+	}
+	if b.entry.integratedTime, err = strconv.ParseInt(e.IntegratedTime, 10, 64); err != nil {
+		return nil, fmt.Errorf("parse integrated time: %w", err)
+	}
+	if e.InclusionPromise != nil {
+		b.entry.set = e.InclusionPromise.SET
+	}
+	if p := e.InclusionProof; p != nil {
+		proof := &inclusionProof{rootHash: p.RootHash, hashes: p.Hashes, checkpoint: p.Checkpoint.Envelope}
+		if proof.logIndex, err = strconv.ParseInt(p.LogIndex, 10, 64); err != nil {
+			return nil, fmt.Errorf("parse inclusion proof: %w", err)
+		}
+		if proof.treeSize, err = strconv.ParseInt(p.TreeSize, 10, 64); err != nil {
+			return nil, fmt.Errorf("parse inclusion proof: %w", err)
+		}
+		b.entry.proof = proof
+	}
+	return b, nil
+}
+
+func parsePEMCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("invalid PEM certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse certificate: %w", err)
+	}
+	return cert, nil
+}
@@ -0,0 +1,206 @@
+package sigstore
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// verifyEntry checks that e was logged by a transparency log of root: its
+// signed entry timestamp and its inclusion proof, whichever are present, at
+// least one of them. It returns the time the signature is dated at: the
+// integrated time if the signed entry timestamp vouches for it, else now, as
+// neither the inclusion proof nor its checkpoint binds the integrated time.
+func verifyEntry(root *TrustedRoot, e *tlogEntry, now time.Time) (time.Time, error) {
+	log, err := root.tlog(e.logID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if e.set == nil && e.proof == nil {
+		return time.Time{}, errors.New("transparency log entry has neither a signed entry timestamp nor an inclusion proof")
+	}
+	t := now
+	if e.set != nil {
+		t = time.Unix(e.integratedTime, 0)
+	}
+	if !log.ValidFor.contains(t) {
+		return time.Time{}, errors.New("transparency log entry outside the validity of its log")
+	}
+
+	if e.set != nil {
+		payload, err := json.Marshal(struct {
+			Body           []byte `json:"body"`
+			IntegratedTime int64  `json:"integratedTime"`
+			LogID          string `json:"logID"`
+			LogIndex       int64  `json:"logIndex"`
+		}{e.body, e.integratedTime, hex.EncodeToString(e.logID), e.logIndex})
+		if err != nil {
+			return time.Time{}, err
+		}
+		if !verifySignature(log.PublicKey, payload, e.set) {
+			return time.Time{}, errors.New("invalid signed entry timestamp")
+		}
+	}
+
+	if p := e.proof; p != nil {
+		leaf := hashLeaf(e.body)
+		if err = verifyInclusion(p.logIndex, p.treeSize, leaf, p.hashes, p.rootHash); err != nil {
+			return time.Time{}, err
+		}
+		if err = verifyCheckpoint(log, p); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return t, nil
+}
+
+// verifyCheckpoint verifies the signed note committing the log to the tree
+// the inclusion proof was computed against.
+func verifyCheckpoint(log *TransparencyLog, p *inclusionProof) error {
+	text, sigs, ok := strings.Cut(p.checkpoint, "\n\n")
+	if !ok {
+		return errors.New("malformed checkpoint")
+	}
+	text += "\n"
+
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	if len(lines) < 3 {
+		return errors.New("malformed checkpoint")
+	}
+	size, err := strconv.ParseInt(lines[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("malformed checkpoint: %w", err)
+	}
+	rootHash, err := base64.StdEncoding.DecodeString(lines[2])
+	if err != nil {
+		return fmt.Errorf("malformed checkpoint: %w", err)
+	}
+	if size != p.treeSize || !bytes.Equal(rootHash, p.rootHash) {
+		return errors.New("checkpoint does not match inclusion proof")
+	}
+
+	for _, line := range strings.Split(sigs, "\n") {
+		fields := strings.Fields(strings.TrimPrefix(line, "— "))
+		if len(fields) != 2 {
+			continue
+		}
+		sig, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil || len(sig) < 5 || len(log.LogID) < 4 || !bytes.Equal(sig[:4], log.LogID[:4]) {
+			continue
+		}
+		if verifySignature(log.PublicKey, []byte(text), sig[4:]) {
+			return nil
+		}
+	}
+	return errors.New("checkpoint not signed by its transparency log")
+}
+
+// verifyInclusion checks the Merkle audit path of the leaf at index in a
+// tree of size leaves against root (RFC 9162, 2.1.3.2).
+func verifyInclusion(index, size int64, leaf []byte, path [][]byte, root []byte) error {
+	if index < 0 || index >= size {
+		return errors.New("inclusion proof index out of range")
+	}
+	fn, sn := index, size-1
+	r := leaf
+	for _, p := range path {
+		if sn == 0 {
+			return errors.New("inclusion proof too long")
+		}
+		if fn&1 == 1 || fn == sn {
+			r = hashChildren(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = hashChildren(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 || !bytes.Equal(r, root) {
+		return errors.New("inclusion proof does not match root hash")
+	}
+	return nil
+}
+
+func hashLeaf(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func hashChildren(l, r []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(l)
+	h.Write(r)
+	return h.Sum(nil)
+}
+
+// verifyBody checks that the hashedrekord entry body records the artifact
+// digest, signature and certificate of the bundle.
+func verifyBody(body []byte, digest []byte, sig []byte, cert *x509.Certificate) error {
+	var rec struct {
+		Kind string `json:"kind"`
+		Spec struct {
+			Data struct {
+				Hash struct {
+					Algorithm string `json:"algorithm"`
+					Value     string `json:"value"`
+				} `json:"hash"`
+			} `json:"data"`
+			Signature struct {
+				Content   []byte `json:"content"`
+				PublicKey struct {
+					Content []byte `json:"content"`
+				} `json:"publicKey"`
+			} `json:"signature"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal(body, &rec); err != nil {
+		return fmt.Errorf("parse transparency log entry: %w", err)
+	}
+	if rec.Kind != "hashedrekord" {
+		return fmt.Errorf("unsupported transparency log entry kind %q", rec.Kind)
+	}
+
+	h := rec.Spec.Data.Hash
+	if h.Algorithm != "sha256" || h.Value != hex.EncodeToString(digest) {
+		return errors.New("transparency log entry does not match the artifact")
+	}
+	if !bytes.Equal(rec.Spec.Signature.Content, sig) {
+		return errors.New("transparency log entry does not match the signature")
+	}
+	block, _ := pem.Decode(rec.Spec.Signature.PublicKey.Content)
+	if block == nil || !bytes.Equal(block.Bytes, cert.Raw) {
+		return errors.New("transparency log entry does not match the certificate")
+	}
+	return nil
+}
+
+// verifySignature verifies sig over msg: ECDSA over its SHA-256, or Ed25519.
+func verifySignature(pub crypto.PublicKey, msg, sig []byte) bool {
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		sum := sha256.Sum256(msg)
+		return ecdsa.VerifyASN1(k, sum[:], sig)
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, msg, sig)
+	}
+	return false
+}
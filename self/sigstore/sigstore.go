@@ -0,0 +1,205 @@
+// Package sigstore verifies artifacts signed keylessly with sigstore, e.g.
+// by "cosign sign-blob", instead of with a static public key. The artifact
+// signature is checked against the short-lived Fulcio certificate in its
+// bundle, the certificate against the Fulcio roots and the identity and
+// issuer constraints of the Verifier, and the Rekor transparency log entry
+// against its signed entry timestamp and inclusion proof.
+//
+// Set a Verifier as self.Config.Verifier; the updater then fetches the
+// bundle from the artifact URL plus ".sigstore.json" and verifies every
+// download against it:
+//
+//	root, err := sigstore.ParseTrustedRoot(trustedRootJSON)
+//	...
+//	cfg.Verifier = &sigstore.Verifier{
+//		TrustedRoot: root,
+//		Identity:    "https://github.com/acme/myapp/.github/workflows/release.yml@refs/heads/main",
+//		Issuer:      "https://token.actions.githubusercontent.com",
+//	}
+//
+// Certificate transparency (SCT) and timestamp authority checks are not
+// performed; the transparency log's integrated time dates the signature if
+// the entry's signed entry timestamp covers it. Entries with an inclusion
+// proof only don't bind it, so their certificate must still be valid at
+// verification time, which short-lived Fulcio certificates rarely are.
+package sigstore
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"time"
+)
+
+// DefaultSuffix is appended to artifact URLs to fetch their bundle.
+const DefaultSuffix = ".sigstore.json"
+
+// ErrIdentity is returned when the signing certificate's identity or issuer
+// doesn't satisfy the Verifier's constraints.
+var ErrIdentity = errors.New("certificate identity not allowed")
+
+var (
+	oidIssuer   = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1} // raw string, deprecated
+	oidIssuerV2 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8} // DER UTF8String
+)
+
+// Verifier verifies artifacts against sigstore bundles. It implements
+// self.ArtifactVerifier. An identity and an issuer constraint are required.
+type Verifier struct {
+	TrustedRoot    *TrustedRoot
+	Identity       string         // exact email or URI in the certificate's SAN
+	IdentityRegexp *regexp.Regexp // alternatively, a pattern the SAN must match
+	Issuer         string         // exact OIDC issuer, e.g. https://accounts.google.com
+	IssuerRegexp   *regexp.Regexp // alternatively, a pattern the issuer must match
+	Suffix         string         // if empty: DefaultSuffix
+}
+
+// SignatureSuffix returns the suffix appended to artifact URLs to fetch their
+// bundle.
+func (v *Verifier) SignatureSuffix() string {
+	if v.Suffix != "" {
+		return v.Suffix
+	}
+	return DefaultSuffix
+}
+
+// VerifyArtifact verifies the artifact at path against bundle.
+func (v *Verifier) VerifyArtifact(path string, bundle []byte) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return v.Verify(f, bundle)
+}
+
+// Verify verifies the artifact read from r against bundle, a sigstore bundle
+// or legacy cosign bundle.
+func (v *Verifier) Verify(r io.Reader, bundle []byte) error {
+	if v.TrustedRoot == nil {
+		return errors.New("sigstore: trusted root required")
+	}
+	if (v.Identity == "" && v.IdentityRegexp == nil) || (v.Issuer == "" && v.IssuerRegexp == nil) {
+		return errors.New("sigstore: identity and issuer constraints required")
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return err
+	}
+	digest := h.Sum(nil)
+
+	b, err := parseBundle(bundle)
+	if err != nil {
+		return err
+	}
+	if b.digest != nil && !bytes.Equal(b.digest, digest) {
+		return errors.New("bundle digest does not match the artifact")
+	}
+
+	pub, ok := b.cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("unsupported certificate key %T", b.cert.PublicKey)
+	}
+	if !ecdsa.VerifyASN1(pub, digest, b.signature) {
+		return errors.New("signature verification failed")
+	}
+
+	signedAt, err := verifyEntry(v.TrustedRoot, &b.entry, time.Now())
+	if err != nil {
+		return err
+	}
+	if err = verifyBody(b.entry.body, digest, b.signature, b.cert); err != nil {
+		return err
+	}
+	if err = v.verifyCertificate(b.cert, signedAt); err != nil {
+		if b.entry.set == nil {
+			err = fmt.Errorf("%w (no signed entry timestamp dates the signature, checked at the current time)", err)
+		}
+		return err
+	}
+	return v.verifyIdentity(b.cert)
+}
+
+// verifyCertificate checks that cert chains to a certificate authority of the
+// trusted root and was valid when its signature was logged at t.
+func (v *Verifier) verifyCertificate(cert *x509.Certificate, t time.Time) error {
+	var err error
+	for _, ca := range v.TrustedRoot.CAs {
+		if !ca.ValidFor.contains(t) {
+			continue
+		}
+		roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+		roots.AddCert(ca.Chain[len(ca.Chain)-1])
+		for _, c := range ca.Chain[:len(ca.Chain)-1] {
+			intermediates.AddCert(c)
+		}
+		_, err = cert.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			CurrentTime:   t,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		})
+		if err == nil {
+			return nil
+		}
+	}
+	if err == nil {
+		err = errors.New("no certificate authority valid at signing time")
+	}
+	return fmt.Errorf("verify certificate: %w", err)
+}
+
+func (v *Verifier) verifyIdentity(cert *x509.Certificate) error {
+	sans := cert.EmailAddresses
+	for _, u := range cert.URIs {
+		sans = append(sans, u.String())
+	}
+	if !anyMatch(sans, v.Identity, v.IdentityRegexp) {
+		return fmt.Errorf("%w: identity %q", ErrIdentity, sans)
+	}
+
+	issuer, err := certIssuer(cert)
+	if err != nil {
+		return err
+	}
+	if !anyMatch([]string{issuer}, v.Issuer, v.IssuerRegexp) {
+		return fmt.Errorf("%w: issuer %q", ErrIdentity, issuer)
+	}
+	return nil
+}
+
+func anyMatch(values []string, exact string, re *regexp.Regexp) bool {
+	for _, s := range values {
+		if (exact != "" && s == exact) || (exact == "" && re.MatchString(s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// certIssuer returns the OIDC issuer Fulcio recorded in cert.
+func certIssuer(cert *x509.Certificate) (string, error) {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidIssuerV2) {
+			var s string
+			if _, err := asn1.UnmarshalWithParams(ext.Value, &s, "utf8"); err != nil {
+				return "", fmt.Errorf("parse certificate issuer: %w", err)
+			}
+			return s, nil
+		}
+	}
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidIssuer) {
+			return string(ext.Value), nil
+		}
+	}
+	return "", errors.New("certificate has no issuer extension")
+}
@@ -0,0 +1,449 @@
+package sigstore_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/napalu/gosafedate/self"
+	"github.com/napalu/gosafedate/self/sigstore"
+)
+
+const (
+	testIdentity = "release@example.com"
+	testIssuer   = "https://accounts.example.com"
+)
+
+// fixture is a private Fulcio CA and Rekor log signing artifacts like cosign.
+type fixture struct {
+	t        *testing.T
+	caKey    *ecdsa.PrivateKey
+	ca       *x509.Certificate
+	rekorKey *ecdsa.PrivateKey
+	rekorDER []byte
+	logID    []byte
+	root     *sigstore.TrustedRoot
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	f := &fixture{t: t, caKey: genKey(t), rekorKey: genKey(t)}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test fulcio"},
+		NotBefore:             time.Now().Add(-48 * time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &f.caKey.PublicKey, f.caKey)
+	if err != nil {
+		t.Fatalf("create CA: %v", err)
+	}
+	if f.ca, err = x509.ParseCertificate(der); err != nil {
+		t.Fatalf("parse CA: %v", err)
+	}
+
+	if f.rekorDER, err = x509.MarshalPKIXPublicKey(&f.rekorKey.PublicKey); err != nil {
+		t.Fatalf("marshal rekor key: %v", err)
+	}
+	sum := sha256.Sum256(f.rekorDER)
+	f.logID = sum[:]
+
+	root, err := json.Marshal(map[string]any{
+		"mediaType": "application/vnd.dev.sigstore.trustedroot+json;version=0.1",
+		"tlogs": []any{map[string]any{
+			"baseUrl":   "https://rekor.example.com",
+			"publicKey": map[string]any{"rawBytes": f.rekorDER, "validFor": map[string]any{"start": "2020-01-01T00:00:00Z"}},
+			"logId":     map[string]any{"keyId": f.logID},
+		}},
+		"certificateAuthorities": []any{map[string]any{
+			"certChain": map[string]any{"certificates": []any{map[string]any{"rawBytes": der}}},
+			"validFor":  map[string]any{"start": "2020-01-01T00:00:00Z"},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.root, err = sigstore.ParseTrustedRoot(root); err != nil {
+		t.Fatalf("ParseTrustedRoot: %v", err)
+	}
+	return f
+}
+
+func genKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return k
+}
+
+// leaf issues a short-lived code signing certificate for email and issuer,
+// issued at.
+func (f *fixture) leaf(key *ecdsa.PrivateKey, email, issuer string, at time.Time) *x509.Certificate {
+	f.t.Helper()
+	iss, _ := asn1.MarshalWithParams(issuer, "utf8")
+	tmpl := &x509.Certificate{
+		SerialNumber:    big.NewInt(2),
+		NotBefore:       at.Add(-time.Minute),
+		NotAfter:        at.Add(10 * time.Minute),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		EmailAddresses:  []string{email},
+		ExtraExtensions: []pkix.Extension{{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}, Value: iss}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, f.ca, &key.PublicKey, f.caKey)
+	if err != nil {
+		f.t.Fatalf("create leaf: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert
+}
+
+// signed is an artifact signature logged in the fixture's transparency log.
+type signed struct {
+	cert           *x509.Certificate
+	sig            []byte
+	digest         []byte
+	body           []byte
+	logIndex       int64
+	integratedTime int64
+	set            []byte
+	rootHash       []byte
+	treeSize       int64
+	hashes         [][]byte
+	checkpoint     string
+}
+
+func (f *fixture) sign(artifact []byte, email, issuer string) *signed {
+	f.t.Helper()
+	return f.signAt(artifact, email, issuer, time.Now())
+}
+
+// signAt signs artifact with a certificate issued at, and logs it then.
+func (f *fixture) signAt(artifact []byte, email, issuer string, at time.Time) *signed {
+	f.t.Helper()
+	key := genKey(f.t)
+	cert := f.leaf(key, email, issuer, at)
+	digest := sha256.Sum256(artifact)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	body, _ := json.Marshal(map[string]any{
+		"apiVersion": "0.0.1",
+		"kind":       "hashedrekord",
+		"spec": map[string]any{
+			"data":      map[string]any{"hash": map[string]any{"algorithm": "sha256", "value": hex.EncodeToString(digest[:])}},
+			"signature": map[string]any{"content": sig, "publicKey": map[string]any{"content": certPEM}},
+		},
+	})
+
+	s := &signed{cert: cert, sig: sig, digest: digest[:], body: body, logIndex: 3, integratedTime: at.Unix()}
+
+	payload, _ := json.Marshal(map[string]any{
+		"body":           body,
+		"integratedTime": s.integratedTime,
+		"logID":          hex.EncodeToString(f.logID),
+		"logIndex":       s.logIndex,
+	})
+	s.set = f.rekorSign(payload)
+
+	leaves := [][]byte{[]byte("a"), []byte("b"), []byte("c"), body, []byte("e")}
+	s.treeSize = int64(len(leaves))
+	s.rootHash = mth(leaves)
+	s.hashes = path(int(s.logIndex), leaves)
+
+	note := fmt.Sprintf("rekor.example.com - 42\n%d\n%s\n", s.treeSize, base64.StdEncoding.EncodeToString(s.rootHash))
+	noteSig := append(append([]byte{}, f.logID[:4]...), f.rekorSign([]byte(note))...)
+	s.checkpoint = note + "\n— rekor.example.com " + base64.StdEncoding.EncodeToString(noteSig) + "\n"
+	return s
+}
+
+func (f *fixture) rekorSign(msg []byte) []byte {
+	sum := sha256.Sum256(msg)
+	sig, err := ecdsa.SignASN1(rand.Reader, f.rekorKey, sum[:])
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return sig
+}
+
+// RFC 6962 Merkle tree hash and audit path, for building inclusion proofs.
+func mth(d [][]byte) []byte {
+	if len(d) == 1 {
+		h := sha256.Sum256(append([]byte{0}, d[0]...))
+		return h[:]
+	}
+	k := split(len(d))
+	h := sha256.Sum256(append(append([]byte{1}, mth(d[:k])...), mth(d[k:])...))
+	return h[:]
+}
+
+func path(m int, d [][]byte) [][]byte {
+	if len(d) == 1 {
+		return nil
+	}
+	k := split(len(d))
+	if m < k {
+		return append(path(m, d[:k]), mth(d[k:]))
+	}
+	return append(path(m-k, d[k:]), mth(d[:k]))
+}
+
+func split(n int) int {
+	k := 1
+	for k*2 < n {
+		k *= 2
+	}
+	return k
+}
+
+// bundle returns s as a sigstore bundle, without an inclusion promise if s
+// has no signed entry timestamp.
+func (s *signed) bundle(logID []byte) []byte {
+	entry := map[string]any{
+		"logIndex":       strconv.FormatInt(s.logIndex, 10),
+		"logId":          map[string]any{"keyId": logID},
+		"kindVersion":    map[string]any{"kind": "hashedrekord", "version": "0.0.1"},
+		"integratedTime": strconv.FormatInt(s.integratedTime, 10),
+		"inclusionProof": map[string]any{
+			"logIndex":   strconv.FormatInt(s.logIndex, 10),
+			"rootHash":   s.rootHash,
+			"treeSize":   strconv.FormatInt(s.treeSize, 10),
+			"hashes":     s.hashes,
+			"checkpoint": map[string]any{"envelope": s.checkpoint},
+		},
+		"canonicalizedBody": s.body,
+	}
+	if s.set != nil {
+		entry["inclusionPromise"] = map[string]any{"signedEntryTimestamp": s.set}
+	}
+	b, _ := json.Marshal(map[string]any{
+		"mediaType": "application/vnd.dev.sigstore.bundle.v0.3+json",
+		"verificationMaterial": map[string]any{
+			"certificate": map[string]any{"rawBytes": s.cert.Raw},
+			"tlogEntries": []any{entry},
+		},
+		"messageSignature": map[string]any{
+			"messageDigest": map[string]any{"algorithm": "SHA2_256", "digest": s.digest},
+			"signature":     s.sig,
+		},
+	})
+	return b
+}
+
+func (s *signed) cosignBundle(logID []byte) []byte {
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.cert.Raw})
+	b, _ := json.Marshal(map[string]any{
+		"base64Signature": base64.StdEncoding.EncodeToString(s.sig),
+		"cert":            base64.StdEncoding.EncodeToString(certPEM),
+		"rekorBundle": map[string]any{
+			"SignedEntryTimestamp": s.set,
+			"Payload": map[string]any{
+				"body":           s.body,
+				"integratedTime": s.integratedTime,
+				"logIndex":       s.logIndex,
+				"logID":          hex.EncodeToString(logID),
+			},
+		},
+	})
+	return b
+}
+
+func (f *fixture) verifier() *sigstore.Verifier {
+	return &sigstore.Verifier{TrustedRoot: f.root, Identity: testIdentity, Issuer: testIssuer}
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	f := newFixture(t)
+	v := f.verifier()
+	artifact := []byte("release artifact")
+	s := f.sign(artifact, testIdentity, testIssuer)
+
+	if err := v.Verify(bytes.NewReader(artifact), s.bundle(f.logID)); err != nil {
+		t.Fatalf("Verify(sigstore bundle): %v", err)
+	}
+	if err := v.Verify(bytes.NewReader(artifact), s.cosignBundle(f.logID)); err != nil {
+		t.Fatalf("Verify(cosign bundle): %v", err)
+	}
+
+	re := &sigstore.Verifier{TrustedRoot: f.root, IdentityRegexp: regexp.MustCompile(`@example\.com$`), Issuer: testIssuer}
+	if err := re.Verify(bytes.NewReader(artifact), s.bundle(f.logID)); err != nil {
+		t.Fatalf("Verify(identity regexp): %v", err)
+	}
+
+	if err := v.Verify(bytes.NewReader([]byte("tampered")), s.bundle(f.logID)); err == nil {
+		t.Fatal("expected tampered artifact to fail")
+	}
+	if err := v.Verify(bytes.NewReader([]byte("tampered")), s.cosignBundle(f.logID)); err == nil {
+		t.Fatal("expected tampered artifact to fail with cosign bundle")
+	}
+
+	other := &sigstore.Verifier{TrustedRoot: f.root, Identity: "mallory@example.com", Issuer: testIssuer}
+	if err := other.Verify(bytes.NewReader(artifact), s.bundle(f.logID)); !errors.Is(err, sigstore.ErrIdentity) {
+		t.Fatalf("expected ErrIdentity for identity, got %v", err)
+	}
+	other = &sigstore.Verifier{TrustedRoot: f.root, Identity: testIdentity, Issuer: "https://evil.example.com"}
+	if err := other.Verify(bytes.NewReader(artifact), s.bundle(f.logID)); !errors.Is(err, sigstore.ErrIdentity) {
+		t.Fatalf("expected ErrIdentity for issuer, got %v", err)
+	}
+	if err := (&sigstore.Verifier{TrustedRoot: f.root}).Verify(bytes.NewReader(artifact), s.bundle(f.logID)); err == nil {
+		t.Fatal("expected missing constraints to fail")
+	}
+
+	// a certificate from another CA
+	rogue := newFixture(t)
+	s2 := rogue.sign(artifact, testIdentity, testIssuer)
+	if err := v.Verify(bytes.NewReader(artifact), s2.cosignBundle(rogue.logID)); err == nil {
+		t.Fatal("expected untrusted log and CA to fail")
+	}
+
+	// a forged signed entry timestamp
+	bad := *s
+	bad.set = rogue.rekorSign([]byte("x"))
+	if err := v.Verify(bytes.NewReader(artifact), bad.cosignBundle(f.logID)); err == nil {
+		t.Fatal("expected forged signed entry timestamp to fail")
+	}
+
+	// an inclusion proof for another tree
+	bad = *s
+	bad.hashes = bad.hashes[1:]
+	if err := v.Verify(bytes.NewReader(artifact), bad.bundle(f.logID)); err == nil {
+		t.Fatal("expected broken inclusion proof to fail")
+	}
+}
+
+func TestVerifier_IntegratedTime(t *testing.T) {
+	f := newFixture(t)
+	v := f.verifier()
+	artifact := []byte("release artifact")
+	// signed a day ago: the certificate has expired since
+	old := f.signAt(artifact, testIdentity, testIssuer, time.Now().Add(-24*time.Hour))
+	fresh := f.sign(artifact, testIdentity, testIssuer)
+
+	withoutSET := func(s *signed) *signed {
+		c := *s
+		c.set = nil
+		return &c
+	}
+	tampered := func(s *signed, integratedTime int64) *signed {
+		c := *s
+		c.integratedTime = integratedTime
+		return &c
+	}
+
+	tests := []struct {
+		name    string
+		bundle  []byte
+		wantErr string
+	}{
+		{name: "signed entry timestamp", bundle: old.bundle(f.logID)},
+		{name: "cosign bundle", bundle: old.cosignBundle(f.logID)},
+		{name: "proof only, certificate still valid", bundle: withoutSET(fresh).bundle(f.logID)},
+		{name: "proof only, certificate expired", bundle: withoutSET(old).bundle(f.logID), wantErr: "no signed entry timestamp"},
+		// the inclusion proof and its checkpoint don't cover the integrated
+		// time: whatever it claims, the certificate is checked now
+		{name: "proof only, integrated time moved into the certificate's validity",
+			bundle: tampered(withoutSET(old), old.cert.NotBefore.Add(time.Minute).Unix()).bundle(f.logID), wantErr: "no signed entry timestamp"},
+		{name: "proof only, integrated time moved out of the certificate's validity",
+			bundle: tampered(withoutSET(fresh), old.integratedTime).bundle(f.logID)},
+		{name: "signed entry timestamp, tampered integrated time", bundle: tampered(old, old.integratedTime+60).bundle(f.logID), wantErr: "invalid signed entry timestamp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.Verify(bytes.NewReader(artifact), tt.bundle)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUpdateIfNewer_Sigstore(t *testing.T) {
+	f := newFixture(t)
+	newData := []byte("new-binary")
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write(newData)
+	_ = zw.Close()
+	s := f.sign(gz.Bytes(), testIdentity, testIssuer)
+	sum := sha256.Sum256(newData)
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/meta.json":
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"version":     "v1.2.4",
+				"sha256":      hex.EncodeToString(sum[:]),
+				"downloadUrl": srv.URL + "/myapp.gz",
+			})
+		case "/myapp.gz":
+			_, _ = w.Write(gz.Bytes())
+		case "/myapp.gz.sigstore.json":
+			_, _ = w.Write(s.bundle(f.logID))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	currPath := filepath.Join(t.TempDir(), "myapp")
+	if err := os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write temp exe: %v", err)
+	}
+
+	cfg := self.Config{
+		URL:        srv.URL + "/meta.json",
+		Verifier:   &sigstore.Verifier{TrustedRoot: f.root, Identity: "mallory@example.com", Issuer: testIssuer},
+		CurrentVer: "v1.2.3",
+		TargetPath: currPath,
+	}
+	if err := self.UpdateIfNewer(cfg); !errors.Is(err, sigstore.ErrIdentity) {
+		t.Fatalf("expected ErrIdentity, got %v", err)
+	}
+
+	cfg.Verifier = f.verifier()
+	if err := self.UpdateIfNewer(cfg); err != nil {
+		t.Fatalf("UpdateIfNewer returned error: %v", err)
+	}
+	got, err := os.ReadFile(currPath)
+	if err != nil {
+		t.Fatalf("read updated exe: %v", err)
+	}
+	if !bytes.Equal(got, newData) {
+		t.Fatalf("exe not replaced; got=%q", got)
+	}
+}
@@ -0,0 +1,115 @@
+package sigstore
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TrustedRoot holds the certificate authorities and transparency logs
+// artifacts are verified against.
+type TrustedRoot struct {
+	CAs   []CertificateAuthority
+	TLogs []TransparencyLog
+}
+
+// CertificateAuthority is a Fulcio instance: its certificate chain, root
+// last, and the period it issued certificates in.
+type CertificateAuthority struct {
+	Chain    []*x509.Certificate
+	ValidFor Validity
+}
+
+// TransparencyLog is a Rekor instance identified by its log ID, the SHA-256
+// of its DER encoded public key.
+type TransparencyLog struct {
+	LogID     []byte
+	PublicKey crypto.PublicKey
+	ValidFor  Validity
+}
+
+// Validity is a time range; a zero End means open ended.
+type Validity struct {
+	Start, End time.Time
+}
+
+func (v Validity) contains(t time.Time) bool {
+	return !t.Before(v.Start) && (v.End.IsZero() || !t.After(v.End))
+}
+
+// ParseTrustedRoot parses a sigstore trusted_root.json as distributed by the
+// sigstore TUF repository or written by "cosign trusted-root create".
+func ParseTrustedRoot(data []byte) (*TrustedRoot, error) {
+	var raw struct {
+		TLogs []struct {
+			PublicKey struct {
+				RawBytes []byte   `json:"rawBytes"`
+				ValidFor validity `json:"validFor"`
+			} `json:"publicKey"`
+			LogID struct {
+				KeyID []byte `json:"keyId"`
+			} `json:"logId"`
+		} `json:"tlogs"`
+		CAs []struct {
+			CertChain struct {
+				Certificates []struct {
+					RawBytes []byte `json:"rawBytes"`
+				} `json:"certificates"`
+			} `json:"certChain"`
+			ValidFor validity `json:"validFor"`
+		} `json:"certificateAuthorities"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parse trusted root: %w", err)
+	}
+
+	root := &TrustedRoot{}
+	for _, l := range raw.TLogs {
+		pub, err := x509.ParsePKIXPublicKey(l.PublicKey.RawBytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse transparency log key: %w", err)
+		}
+		id := l.LogID.KeyID
+		if len(id) == 0 {
+			sum := sha256.Sum256(l.PublicKey.RawBytes)
+			id = sum[:]
+		}
+		root.TLogs = append(root.TLogs, TransparencyLog{LogID: id, PublicKey: pub, ValidFor: Validity(l.PublicKey.ValidFor)})
+	}
+	for _, ca := range raw.CAs {
+		var chain []*x509.Certificate
+		for _, c := range ca.CertChain.Certificates {
+			cert, err := x509.ParseCertificate(c.RawBytes)
+			if err != nil {
+				return nil, fmt.Errorf("parse certificate authority: %w", err)
+			}
+			chain = append(chain, cert)
+		}
+		if len(chain) == 0 {
+			continue
+		}
+		root.CAs = append(root.CAs, CertificateAuthority{Chain: chain, ValidFor: Validity(ca.ValidFor)})
+	}
+	if len(root.TLogs) == 0 {
+		return nil, errors.New("trusted root has no transparency log")
+	}
+	return root, nil
+}
+
+type validity struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+func (r *TrustedRoot) tlog(logID []byte) (*TransparencyLog, error) {
+	for i := range r.TLogs {
+		if string(r.TLogs[i].LogID) == string(logID) {
+			return &r.TLogs[i], nil
+		}
+	}
+	return nil, fmt.Errorf("unknown transparency log %x", logID)
+}
@@ -0,0 +1,71 @@
+package self
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/napalu/gosafedate/metadata"
+)
+
+// SkipVersion makes HasNewer (and thus UpdateIfNewer) ignore version from now
+// on, e.g. for an "ignore this update" button. It is recorded in the state
+// file (see Config.StatePath); later releases are offered as usual.
+// Mandatory releases can't be skipped.
+func SkipVersion(cfg Config, version string) error {
+	return updateState(cfg, func(st *state) {
+		if !slices.Contains(st.Skipped, version) {
+			st.Skipped = append(st.Skipped, version)
+		}
+	})
+}
+
+// Snooze makes HasNewer ignore all releases for d, e.g. for a "remind me
+// later" button. Mandatory releases can't be snoozed.
+func Snooze(cfg Config, d time.Duration) error {
+	return SnoozeVersion(cfg, "", d)
+}
+
+// SnoozeVersion is Snooze for a single release: a later release is offered
+// before the snooze expires.
+func SnoozeVersion(cfg Config, version string, d time.Duration) error {
+	return updateState(cfg, func(st *state) {
+		st.SnoozeUntil, st.SnoozeVersion = time.Now().Add(d), version
+	})
+}
+
+func updateState(cfg Config, fn func(*state)) error {
+	path, err := statePath(cfg)
+	if err != nil {
+		return err
+	}
+	st, err := loadState(path)
+	if err != nil {
+		return err
+	}
+	fn(st)
+	return saveState(path, st)
+}
+
+// suppressed returns why HasNewer keeps quiet about m, or "" if it doesn't.
+func suppressed(cfg Config, m *metadata.Metadata) string {
+	if m.Mandatory {
+		return ""
+	}
+	path, err := statePath(cfg)
+	if err != nil {
+		return ""
+	}
+	st, err := loadState(path)
+	if err != nil {
+		return ""
+	}
+
+	switch {
+	case slices.Contains(st.Skipped, m.Version):
+		return "skipped"
+	case time.Now().Before(st.SnoozeUntil) && (st.SnoozeVersion == "" || st.SnoozeVersion == m.Version):
+		return fmt.Sprintf("snoozed until %s", st.SnoozeUntil.Format(time.RFC3339))
+	}
+	return ""
+}
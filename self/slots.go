@@ -0,0 +1,134 @@
+package self
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/napalu/gosafedate/metadata"
+)
+
+// Slots installs updates into one of two install paths (A/B slots) for
+// power-loss-safe updates, e.g. on embedded devices: the update is always
+// written to the inactive slot, synced and verified, and only then the
+// pointer file is atomically switched to it. Until the switch, the active
+// slot is untouched. A launcher or supervisor starts the binary returned by
+// Active.
+type Slots struct {
+	A, B    string // install paths of the slots
+	Pointer string // file naming the active slot, "A" or "B"; if missing: A
+}
+
+// Apply writes binary to the inactive slot and activates it.
+func (s *Slots) Apply(binary string, m *metadata.Metadata) (string, error) {
+	active, err := s.active()
+	if err != nil {
+		return "", err
+	}
+	next, path := s.other(active)
+
+	part := path + partSuffix
+	if err = copyToSibling(binary, part); err != nil {
+		return "", err
+	}
+	if err = os.Chmod(part, 0o755); err == nil {
+		err = os.Rename(part, path)
+	}
+	if err != nil {
+		_ = os.Remove(part)
+		return "", err
+	}
+	_ = os.Remove(binary)
+
+	// what ends up on disk must be what was verified
+	if err = verifyChecksum(path, m.Checksum); err != nil {
+		return "", err
+	}
+	if err = s.point(next); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// Active returns the path of the active slot.
+func (s *Slots) Active() (string, error) {
+	active, err := s.active()
+	if err != nil {
+		return "", err
+	}
+	return s.path(active), nil
+}
+
+// Switch activates the other slot, e.g. to roll back.
+func (s *Slots) Switch() error {
+	active, err := s.active()
+	if err != nil {
+		return err
+	}
+	next, path := s.other(active)
+	if _, err = os.Stat(path); err != nil {
+		return fmt.Errorf("slot %s: %w", next, err)
+	}
+	return s.point(next)
+}
+
+func (s *Slots) active() (string, error) {
+	b, err := os.ReadFile(s.Pointer)
+	if errors.Is(err, os.ErrNotExist) {
+		return "A", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	switch slot := strings.TrimSpace(string(b)); slot {
+	case "A", "B":
+		return slot, nil
+	default:
+		return "", fmt.Errorf("invalid slot %q in %s", slot, s.Pointer)
+	}
+}
+
+func (s *Slots) other(slot string) (string, string) {
+	if slot == "A" {
+		return "B", s.B
+	}
+	return "A", s.A
+}
+
+func (s *Slots) path(slot string) string {
+	if slot == "A" {
+		return s.A
+	}
+	return s.B
+}
+
+// point durably switches the pointer file to slot.
+func (s *Slots) point(slot string) error {
+	tmp := s.Pointer + partSuffix
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err = f.WriteString(slot + "\n"); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, s.Pointer)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	// persist the rename itself
+	if d, err := os.Open(filepath.Dir(s.Pointer)); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+	return nil
+}
@@ -0,0 +1,293 @@
+package self
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Source retrieves update metadata and artifacts. The default is an
+// HTTPSource for Config.URL; other implementations can serve updates from
+// object stores, corporate artifact repositories or test fixtures.
+type Source interface {
+	// FetchMetadata returns the raw metadata document.
+	FetchMetadata(ctx context.Context) (io.ReadCloser, error)
+	// FetchArtifact writes the artifact at url to w. url is the download URL
+	// of the metadata, resolved against Config.URL.
+	FetchArtifact(ctx context.Context, url string, w io.Writer) error
+}
+
+// ArtifactSizer is optionally implemented by sources which can report the
+// size of an artifact without downloading it. It is used by Plan.
+type ArtifactSizer interface {
+	ArtifactSize(ctx context.Context, url string) (int64, error)
+}
+
+// ErrNotModified is returned by ConditionalSource implementations when the
+// metadata matches the given validators.
+var ErrNotModified = errors.New("metadata not modified")
+
+// Validators identify a version of the metadata document for conditional
+// requests (HTTP ETag and Last-Modified).
+type Validators struct {
+	ETag         string
+	LastModified string
+}
+
+// ConditionalSource is optionally implemented by sources which support
+// conditional metadata requests. It is used when a state file is kept.
+type ConditionalSource interface {
+	// FetchMetadataIf returns ErrNotModified if the metadata still matches v,
+	// or the metadata and its new validators.
+	FetchMetadataIf(ctx context.Context, v Validators) (io.ReadCloser, Validators, error)
+}
+
+// HTTPSource fetches metadata and artifacts with plain HTTP GET requests.
+// Headers are only sent to the host of URL, so credentials don't leak to
+// third-party download hosts, including those a request is redirected to.
+type HTTPSource struct {
+	URL     string       // metadata URL
+	Headers http.Header  // extra request headers, e.g. Authorization
+	Client  *http.Client // if nil: http.DefaultClient
+	Chunks  int          // if > 1: parallel ranged requests per artifact, where supported
+}
+
+// FetchMetadata implements Source.
+func (s *HTTPSource) FetchMetadata(ctx context.Context) (io.ReadCloser, error) {
+	rc, _, err := s.FetchMetadataIf(ctx, Validators{})
+	return rc, err
+}
+
+// FetchMetadataIf implements ConditionalSource with If-None-Match and
+// If-Modified-Since requests.
+func (s *HTTPSource) FetchMetadataIf(ctx context.Context, v Validators) (io.ReadCloser, Validators, error) {
+	h := http.Header{}
+	if v.ETag != "" {
+		h.Set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		h.Set("If-Modified-Since", v.LastModified)
+	}
+
+	resp, err := s.doHeader(ctx, http.MethodGet, s.URL, h)
+	if err != nil {
+		return nil, Validators{}, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, Validators{
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+		}, nil
+	case http.StatusNotModified:
+		_ = resp.Body.Close()
+		return nil, Validators{}, ErrNotModified
+	default:
+		_ = resp.Body.Close()
+		return nil, Validators{}, fmt.Errorf("metadata HTTP %d", resp.StatusCode)
+	}
+}
+
+// FetchArtifact implements Source.
+func (s *HTTPSource) FetchArtifact(ctx context.Context, url string, w io.Writer) error {
+	if s.Chunks > 1 {
+		if ok, err := s.fetchChunked(ctx, url, w); ok {
+			return err
+		}
+	}
+
+	resp, err := s.do(ctx, http.MethodGet, url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download HTTP %d", resp.StatusCode)
+	}
+	if err = checkContentLength(w, resp.ContentLength); err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// ArtifactSize implements ArtifactSizer with a HEAD request.
+func (s *HTTPSource) ArtifactSize(ctx context.Context, url string) (int64, error) {
+	resp, err := s.do(ctx, http.MethodHead, url)
+	if err != nil {
+		return -1, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return -1, fmt.Errorf("HEAD HTTP %d", resp.StatusCode)
+	}
+	return resp.ContentLength, nil
+}
+
+func (s *HTTPSource) do(ctx context.Context, method, url string) (*http.Response, error) {
+	return s.doHeader(ctx, method, url, nil)
+}
+
+func (s *HTTPSource) doHeader(ctx context.Context, method, url string, h http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.Headers) > 0 && sameHost(req.URL.Host, s.URL) {
+		for k, v := range s.Headers {
+			req.Header[k] = v
+		}
+	}
+	for k, v := range h {
+		req.Header[k] = v
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if len(s.Headers) > 0 {
+		c := *client
+		c.CheckRedirect = dropHeaders(s.Headers, req.URL.Host, client.CheckRedirect)
+		client = &c
+	}
+	return client.Do(req)
+}
+
+// dropHeaders returns a redirect policy removing headers from requests
+// redirected away from host, before applying next. Go only removes
+// Authorization and cookies itself, so API key headers would otherwise
+// follow a redirect to a CDN or signed storage URL.
+func dropHeaders(headers http.Header, host string, next func(*http.Request, []*http.Request) error) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if req.URL.Host != host {
+			for k := range headers {
+				delete(req.Header, k) // as set, maybe not canonical
+				req.Header.Del(k)
+			}
+		}
+		if next != nil {
+			return next(req, via)
+		}
+		if len(via) >= 10 { // http.Client's default policy
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+}
+
+func sameHost(host, rawURL string) bool {
+	u, err := neturl.Parse(rawURL)
+	return err == nil && u.Host == host
+}
+
+// FileSource reads metadata and artifacts from the local filesystem, e.g. a
+// mounted USB drive or network share in air-gapped environments. URL is a
+// file:// URL or a plain path; artifact URLs are resolved the same way.
+type FileSource struct {
+	URL string // metadata location
+}
+
+// FetchMetadata implements Source.
+func (s *FileSource) FetchMetadata(_ context.Context) (io.ReadCloser, error) {
+	p, err := localPath(s.URL)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+// FetchArtifact implements Source.
+func (s *FileSource) FetchArtifact(_ context.Context, url string, w io.Writer) error {
+	p, err := localPath(url)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// ArtifactSize implements ArtifactSizer.
+func (s *FileSource) ArtifactSize(_ context.Context, url string) (int64, error) {
+	p, err := localPath(url)
+	if err != nil {
+		return -1, err
+	}
+	fi, err := os.Stat(p)
+	if err != nil {
+		return -1, err
+	}
+	return fi.Size(), nil
+}
+
+// localPath converts a file:// URL (or plain path) to a filesystem path.
+func localPath(raw string) (string, error) {
+	if !strings.HasPrefix(raw, "file:") {
+		return raw, nil
+	}
+
+	u, err := neturl.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	if u.Host != "" && u.Host != "localhost" {
+		return "", fmt.Errorf("unsupported file URL host %q", u.Host)
+	}
+
+	p := u.Path
+	if runtime.GOOS == "windows" && len(p) > 2 && p[0] == '/' && p[2] == ':' {
+		p = p[1:] // file:///C:/dir -> C:/dir
+	}
+	return filepath.FromSlash(p), nil
+}
+
+// fileURL returns the file:// URL for an absolute path.
+func fileURL(path string) string {
+	p := filepath.ToSlash(path)
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return (&neturl.URL{Scheme: "file", Path: p}).String()
+}
+
+func (c Config) source() Source {
+	if c.Source != nil {
+		return c.Source
+	}
+	if len(c.Mirrors) > 0 {
+		return &mirrorSource{cfg: c, urls: c.mirrorURLs()}
+	}
+	if strings.HasPrefix(c.URL, "file:") {
+		return &FileSource{URL: c.URL}
+	}
+	return &HTTPSource{URL: c.URL, Headers: c.httpHeaders(), Client: c.httpClient(), Chunks: c.DownloadChunks}
+}
+
+// httpHeaders returns Headers and AuthToken as request headers.
+func (c Config) httpHeaders() http.Header {
+	h := http.Header{}
+	for k, v := range c.Headers {
+		h.Set(k, v)
+	}
+	if c.AuthToken != "" {
+		h.Set("Authorization", "Bearer "+c.AuthToken)
+	}
+	return h
+}
@@ -0,0 +1,241 @@
+// Package electron provides a self.Source reading updates from the files
+// electron-builder publishes, latest.yml, latest-mac.yml and
+// latest-linux.yml, or from a Squirrel.Windows RELEASES file, so Go and
+// Electron applications of a product suite can share a publishing pipeline
+// and CDN layout.
+//
+// Neither format carries the checksum of the installed binary or a
+// signature gosafedate can verify. As with package github, each file to
+// install is published with a signature file named after it with a ".sig"
+// suffix, holding a single line:
+//
+//	<sha256 of the installed binary> <base64 Ed25519 signature over "version+sha256">
+//
+// The SHA-512 of latest.yml files is checked on download as well. Squirrel
+// packages are installed from the zip archive they are; their SHA-1 is not
+// checked.
+package electron
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/napalu/gosafedate/metadata"
+	"github.com/napalu/gosafedate/version"
+)
+
+// maxFileSize bounds update, RELEASES and signature files.
+const maxFileSize = 8 << 20
+
+// ErrNoRelease is returned if the update file lists no matching release.
+var ErrNoRelease = errors.New("no matching release found")
+
+// Source reads the update described by an electron-builder update file or
+// a Squirrel.Windows RELEASES file.
+type Source struct {
+	URL    string       // of latest.yml, latest-mac.yml, latest-linux.yml or RELEASES; a name ending in "RELEASES" selects the Squirrel format
+	File   string       // glob matching the name of the latest.yml file to install; if empty: the first file
+	Client *http.Client // if nil: http.DefaultClient
+}
+
+// FetchMetadata implements self.Source.
+func (s *Source) FetchMetadata(ctx context.Context) (io.ReadCloser, error) {
+	body, err := s.fetch(ctx, s.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	var m *metadata.Metadata
+	if strings.HasSuffix(path.Base(s.URL), "RELEASES") {
+		m, err = s.fromReleases(body)
+	} else {
+		m, err = s.fromUpdateInfo(body)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.addSignature(ctx, m); err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+// FetchArtifact implements self.Source.
+func (s *Source) FetchArtifact(ctx context.Context, url string, w io.Writer) error {
+	resp, err := s.get(ctx, url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+func (s *Source) fromUpdateInfo(body []byte) (*metadata.Metadata, error) {
+	info, err := ParseUpdateInfo(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	var f *File
+	for i := range info.Files {
+		if matched, _ := path.Match(s.File, path.Base(info.Files[i].URL)); matched || s.File == "" {
+			f = &info.Files[i]
+			break
+		}
+	}
+	if info.Version == "" || f == nil {
+		return nil, fmt.Errorf("%w in %s", ErrNoRelease, s.URL)
+	}
+
+	sum, err := f.Checksum()
+	if err != nil {
+		return nil, err
+	}
+	u, err := s.resolve(f.URL)
+	if err != nil {
+		return nil, err
+	}
+	return &metadata.Metadata{
+		Version:            info.Version,
+		DownloadURL:        u,
+		Size:               f.Size,
+		Compression:        compression(u),
+		ChecksumCompressed: sum,
+	}, nil
+}
+
+func (s *Source) fromReleases(body []byte) (*metadata.Metadata, error) {
+	releases, err := ParseReleases(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		newest *Release
+		newV   *version.Semver
+	)
+	for i := range releases {
+		r := &releases[i]
+		if r.IsDelta() {
+			continue
+		}
+		v, err := version.NewSemVer(r.Version(), "v")
+		if err != nil {
+			continue
+		}
+		if newest == nil || v.GreaterThan(newV) {
+			newest, newV = r, v
+		}
+	}
+	if newest == nil {
+		return nil, fmt.Errorf("%w in %s", ErrNoRelease, s.URL)
+	}
+
+	u, err := s.resolve(newest.Filename)
+	if err != nil {
+		return nil, err
+	}
+	return &metadata.Metadata{
+		Version:     newest.Version(),
+		DownloadURL: u,
+		Size:        newest.Size,
+		Compression: "none",
+		Archive:     "zip",
+	}, nil
+}
+
+// addSignature sets the checksum and signature of m from the signature file
+// of its download.
+func (s *Source) addSignature(ctx context.Context, m *metadata.Metadata) error {
+	sigURL, err := url.Parse(m.DownloadURL)
+	if err != nil {
+		return err
+	}
+	sigURL.Path += ".sig"
+	sigURL.RawPath = ""
+
+	body, err := s.fetch(ctx, sigURL.String())
+	if err != nil {
+		return fmt.Errorf("fetch signature: %w", err)
+	}
+	checksum, signature, ok := strings.Cut(strings.TrimSpace(string(body)), " ")
+	if !ok {
+		return fmt.Errorf("%s: expected \"<sha256> <signature>\"", sigURL)
+	}
+	m.Checksum, m.Signature = checksum, strings.TrimSpace(signature)
+	return nil
+}
+
+// resolve resolves ref, relative to the update file or absolute.
+func (s *Source) resolve(ref string) (string, error) {
+	base, err := url.Parse(s.URL)
+	if err != nil {
+		return "", err
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// compression returns "none" for files not compressed by gosafedate's
+// conventions, e.g. installers, AppImages and zip archives, so they aren't
+// decompressed as gzip.
+func compression(u string) string {
+	name := u
+	if pu, err := url.Parse(u); err == nil {
+		name = pu.Path
+	}
+	for _, ext := range []string{".gz", ".tgz", ".bz2", ".xz", ".zst"} {
+		if strings.HasSuffix(name, ext) {
+			return ""
+		}
+	}
+	return "none"
+}
+
+func (s *Source) fetch(ctx context.Context, url string) ([]byte, error) {
+	resp, err := s.get(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return io.ReadAll(io.LimitReader(resp.Body, maxFileSize))
+}
+
+func (s *Source) get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("electron: GET %s: HTTP %d", url, resp.StatusCode)
+	}
+	return resp, nil
+}
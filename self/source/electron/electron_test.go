@@ -0,0 +1,173 @@
+package electron_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/napalu/gosafedate/self"
+	"github.com/napalu/gosafedate/self/source/electron"
+)
+
+func TestSource_Update(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	newData := []byte("new-binary")
+	sum := fmt.Sprintf("%x", sha256.Sum256(newData))
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte("1.2.4+"+sum)))
+	sha := sha512.Sum512(newData)
+
+	var nupkg bytes.Buffer
+	zw := zip.NewWriter(&nupkg)
+	for name, data := range map[string][]byte{"myapp.nuspec": []byte("<package/>"), "lib/net45/myapp": newData} {
+		f, _ := zw.Create(name)
+		_, _ = f.Write(data)
+	}
+	_ = zw.Close()
+
+	files := map[string]string{
+		"/latest-linux.yml": fmt.Sprintf(`version: 1.2.4
+files:
+  - url: myapp-1.2.4.AppImage
+    sha512: %s
+    size: %d
+    blockMapSize: 1234
+  - url: myapp-1.2.4-linux-amd64
+    sha512: %[1]s
+    size: %[2]d
+path: myapp-1.2.4.AppImage
+sha512: %[1]s
+releaseDate: '2026-10-01T12:00:00.000Z'
+`, base64.StdEncoding.EncodeToString(sha[:]), len(newData)),
+		"/myapp-1.2.4-linux-amd64":     string(newData),
+		"/myapp-1.2.4-linux-amd64.sig": sum + " " + sig + "\n",
+		"/win/RELEASES": "\ufeff" + strings.Repeat("a", 40) + " myapp-1.2.3-full.nupkg 100\r\n" +
+			strings.Repeat("b", 40) + " myapp-1.2.4-delta.nupkg 50\r\n" +
+			strings.Repeat("c", 40) + fmt.Sprintf(" myapp-1.2.4-full.nupkg %d\r\n", nupkg.Len()),
+		"/win/myapp-1.2.4-full.nupkg":     nupkg.String(),
+		"/win/myapp-1.2.4-full.nupkg.sig": sum + " " + sig + "\n",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name string
+		src  *electron.Source
+	}{
+		{name: "latest.yml", src: &electron.Source{URL: srv.URL + "/latest-linux.yml", File: "*-linux-amd64"}},
+		{name: "RELEASES", src: &electron.Source{URL: srv.URL + "/win/RELEASES"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			currPath := filepath.Join(t.TempDir(), "myapp")
+			if err := os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+				t.Fatalf("write temp exe: %v", err)
+			}
+
+			err := self.UpdateIfNewer(self.Config{
+				Source:     tt.src,
+				PubKey:     pub,
+				CurrentVer: "1.2.3",
+				TargetPath: currPath,
+			})
+			if err != nil {
+				t.Fatalf("UpdateIfNewer: %v", err)
+			}
+
+			got, err := os.ReadFile(currPath)
+			if err != nil {
+				t.Fatalf("read updated exe: %v", err)
+			}
+			if !bytes.Equal(got, newData) {
+				t.Fatalf("binary not updated: got %q", got)
+			}
+		})
+	}
+}
+
+func TestParseUpdateInfo(t *testing.T) {
+	sha := sha512.Sum512([]byte("installer"))
+	b64 := base64.StdEncoding.EncodeToString(sha[:])
+
+	tests := []struct {
+		name    string
+		in      string
+		want    electron.File
+		wantErr bool
+	}{
+		{
+			name: "files",
+			in:   "version: 1.2.4\nfiles:\n  - url: 'My App Setup 1.2.4.exe'\n    sha512: " + b64 + "\n    size: 42\npath: other.exe\n",
+			want: electron.File{URL: "My App Setup 1.2.4.exe", SHA512: b64, Size: 42},
+		},
+		{
+			name: "legacy path",
+			in:   "# comment\nversion: \"1.2.4\"\npath: MyApp-1.2.4.dmg\nsha512: " + b64 + "\n",
+			want: electron.File{URL: "MyApp-1.2.4.dmg", SHA512: b64},
+		},
+		{name: "invalid size", in: "version: 1.2.4\nfiles:\n  - url: a.exe\n    size: big\n", wantErr: true},
+		{name: "invalid line", in: "version 1.2.4\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := electron.ParseUpdateInfo(strings.NewReader(tt.in))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseUpdateInfo succeeded: %+v", info)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseUpdateInfo: %v", err)
+			}
+			if info.Version != "1.2.4" || len(info.Files) != 1 || info.Files[0] != tt.want {
+				t.Fatalf("unexpected update info: %+v", info)
+			}
+			if sum, err := info.Files[0].Checksum(); err != nil || sum != fmt.Sprintf("sha512:%x", sha) {
+				t.Fatalf("Checksum = %q, %v", sum, err)
+			}
+		})
+	}
+}
+
+func TestParseReleases(t *testing.T) {
+	in := strings.Repeat("A", 40) + " MyApp-1.2.4-beta.1-full.nupkg 100\n\n" +
+		strings.Repeat("b", 40) + " https://cdn.example.com/MyApp-1.2.4-delta.nupkg?x=1 50\n"
+	releases, err := electron.ParseReleases(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("ParseReleases: %v", err)
+	}
+	if len(releases) != 2 {
+		t.Fatalf("got %d releases", len(releases))
+	}
+	if r := releases[0]; r.SHA1 != strings.Repeat("a", 40) || r.Version() != "1.2.4-beta.1" || r.IsDelta() || r.Size != 100 {
+		t.Fatalf("unexpected release: %+v", r)
+	}
+	if r := releases[1]; r.Version() != "1.2.4" || !r.IsDelta() {
+		t.Fatalf("unexpected release: %+v", r)
+	}
+
+	if _, err = electron.ParseReleases(strings.NewReader("abc MyApp-1.2.4-full.nupkg 1\n")); err == nil {
+		t.Fatal("ParseReleases accepted an invalid SHA-1")
+	}
+}
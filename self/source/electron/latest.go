@@ -0,0 +1,129 @@
+package electron
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// UpdateInfo is an electron-builder update file: latest.yml,
+// latest-mac.yml or latest-linux.yml.
+type UpdateInfo struct {
+	Version     string
+	Files       []File
+	Path        string // legacy: the main file, also listed in Files
+	SHA512      string // legacy: base64 SHA-512 of Path
+	ReleaseDate string
+}
+
+// File is a file of an UpdateInfo.
+type File struct {
+	URL    string // relative to the update file, or absolute
+	SHA512 string // base64 SHA-512 of the file
+	Size   int64
+}
+
+// Checksum returns the SHA-512 of f in the form of package checksum, or ""
+// if f has none.
+func (f *File) Checksum() (string, error) {
+	if f.SHA512 == "" {
+		return "", nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(f.SHA512)
+	if err != nil || len(raw) != 64 {
+		return "", fmt.Errorf("%s: invalid sha512 %q", f.URL, f.SHA512)
+	}
+	return "sha512:" + hex.EncodeToString(raw), nil
+}
+
+// ParseUpdateInfo parses the update file read from r. It reads the flat
+// YAML electron-builder writes, not YAML in general; unknown keys are
+// ignored.
+func ParseUpdateInfo(r io.Reader) (*UpdateInfo, error) {
+	var (
+		info UpdateInfo
+		list string // key of the list being read
+		file *File
+	)
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimRight(sc.Text(), " \t\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+
+		indented := line[0] == ' '
+		item := strings.HasPrefix(strings.TrimSpace(line), "- ")
+		kv := strings.TrimPrefix(strings.TrimSpace(line), "- ")
+		key, value, ok := strings.Cut(kv, ":")
+		if !ok {
+			return nil, fmt.Errorf("parse update info: line %d: expected \"key: value\"", n)
+		}
+		key, value = strings.TrimSpace(key), unquote(strings.TrimSpace(value))
+
+		if !indented {
+			list, file = "", nil
+			switch key {
+			case "version":
+				info.Version = value
+			case "path":
+				info.Path = value
+			case "sha512":
+				info.SHA512 = value
+			case "releaseDate":
+				info.ReleaseDate = value
+			}
+			if value == "" {
+				list = key
+			}
+			continue
+		}
+
+		if list != "files" {
+			continue
+		}
+		if item {
+			info.Files = append(info.Files, File{})
+			file = &info.Files[len(info.Files)-1]
+		}
+		if file == nil {
+			return nil, fmt.Errorf("parse update info: line %d: expected a list item", n)
+		}
+		switch key {
+		case "url":
+			file.URL = value
+		case "sha512":
+			file.SHA512 = value
+		case "size":
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("parse update info: line %d: invalid size %q", n, value)
+			}
+			file.Size = size
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("parse update info: %w", err)
+	}
+
+	if len(info.Files) == 0 && info.Path != "" {
+		info.Files = []File{{URL: info.Path, SHA512: info.SHA512}}
+	}
+	return &info, nil
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '\'' && s[len(s)-1] == '\'' || s[0] == '"' && s[len(s)-1] == '"') {
+		if s[0] == '"' {
+			if u, err := strconv.Unquote(s); err == nil {
+				return u
+			}
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+	}
+	return s
+}
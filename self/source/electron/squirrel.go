@@ -0,0 +1,66 @@
+package electron
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Release is an entry of a Squirrel.Windows RELEASES file.
+type Release struct {
+	SHA1     string // hex SHA-1 of the package
+	Filename string // package name relative to the RELEASES file, or absolute URL
+	Size     int64
+}
+
+var packageName = regexp.MustCompile(`-(\d+\.\d+\.\d+[0-9A-Za-z.+-]*?)-(full|delta)\.nupkg$`)
+
+// Version returns the version in the package name, e.g. "1.2.4" for
+// "MyApp-1.2.4-full.nupkg".
+func (r *Release) Version() string {
+	if m := packageName.FindStringSubmatch(r.name()); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// IsDelta reports whether r is a delta package.
+func (r *Release) IsDelta() bool {
+	m := packageName.FindStringSubmatch(r.name())
+	return m != nil && m[2] == "delta"
+}
+
+func (r *Release) name() string {
+	name, _, _ := strings.Cut(r.Filename, "?")
+	return path.Base(name)
+}
+
+// ParseReleases parses the Squirrel.Windows RELEASES file read from r, with
+// one "<sha1> <filename> <size>" line per package.
+func ParseReleases(r io.Reader) ([]Release, error) {
+	var releases []Release
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(strings.TrimPrefix(sc.Text(), "\ufeff"))
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 || len(fields[0]) != 40 {
+			return nil, fmt.Errorf("parse RELEASES: line %d: expected \"<sha1> <filename> <size>\"", n)
+		}
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse RELEASES: line %d: invalid size %q", n, fields[2])
+		}
+		releases = append(releases, Release{SHA1: strings.ToLower(fields[0]), Filename: fields[1], Size: size})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("parse RELEASES: %w", err)
+	}
+	return releases, nil
+}
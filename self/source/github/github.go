@@ -0,0 +1,287 @@
+// Package github provides a self.Source reading updates from GitHub Releases,
+// so projects publishing there don't need to host a separate metadata file.
+//
+// A release provides an update if it has an asset matching AssetPattern and a
+// signature asset named after it with a ".sig" suffix. The signature asset
+// holds a single line:
+//
+//	<sha256 of the installed binary> <base64 Ed25519 signature over "version+sha256">
+//
+// The release tag (without TagPrefix) is the version. UploadAsset and
+// Sidecar publish releases in this format.
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/napalu/gosafedate/metadata"
+)
+
+// DefaultBaseURL is the GitHub REST API endpoint.
+const DefaultBaseURL = "https://api.github.com"
+
+// ErrNoRelease is returned if no release provides a matching asset.
+var ErrNoRelease = errors.New("no matching release found")
+
+// errNotFound is wrapped by errors for HTTP 404 responses.
+var errNotFound = errors.New("HTTP 404")
+
+// Source reads the latest matching release of a GitHub repository.
+type Source struct {
+	Owner        string
+	Repo         string
+	AssetPattern string       // glob matching the artifact asset name, e.g. "myapp_*_linux_amd64.tar.gz"
+	TagPrefix    string       // if set: only consider tags with this prefix, stripped from the version
+	Prerelease   bool         // if true: consider pre-releases as well
+	Token        string       // optional, required for private repositories
+	BaseURL      string       // if empty: DefaultBaseURL
+	Client       *http.Client // if nil: http.DefaultClient
+}
+
+type release struct {
+	ID         int64   `json:"id"`
+	UploadURL  string  `json:"upload_url"`
+	TagName    string  `json:"tag_name"`
+	Draft      bool    `json:"draft"`
+	Prerelease bool    `json:"prerelease"`
+	Assets     []asset `json:"assets"`
+}
+
+type asset struct {
+	ID                 int64  `json:"id"`
+	Name               string `json:"name"`
+	Size               int64  `json:"size"`
+	URL                string `json:"url"` // API URL, works for private repositories
+	BrowserDownloadURL string `json:"browser_download_url"`
+}
+
+// FetchMetadata implements self.Source. It derives the metadata from the
+// newest matching release and its signature asset.
+func (s *Source) FetchMetadata(ctx context.Context) (io.ReadCloser, error) {
+	var releases []release
+	if err := s.getJSON(ctx, fmt.Sprintf("%s/repos/%s/%s/releases?per_page=100", s.baseURL(), s.Owner, s.Repo), &releases); err != nil {
+		return nil, err
+	}
+
+	for _, r := range releases {
+		if r.Draft || (r.Prerelease && !s.Prerelease) || !strings.HasPrefix(r.TagName, s.TagPrefix) {
+			continue
+		}
+
+		art, sig, ok := s.findAssets(r.Assets)
+		if !ok {
+			continue
+		}
+
+		m, err := s.metadataFor(ctx, r, art, sig)
+		if err != nil {
+			return nil, err
+		}
+
+		b, err := json.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+
+	return nil, fmt.Errorf("%w in %s/%s", ErrNoRelease, s.Owner, s.Repo)
+}
+
+// FetchArtifact implements self.Source.
+func (s *Source) FetchArtifact(ctx context.Context, url string, w io.Writer) error {
+	resp, err := s.do(ctx, url, "application/octet-stream")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+func (s *Source) findAssets(assets []asset) (art, sig *asset, ok bool) {
+	for i := range assets {
+		if strings.HasSuffix(assets[i].Name, ".sig") {
+			continue // never the artifact, even if AssetPattern matches it
+		}
+		if matched, _ := path.Match(s.AssetPattern, assets[i].Name); matched && s.AssetPattern != "" {
+			art = &assets[i]
+			break
+		}
+	}
+	if art == nil {
+		return nil, nil, false
+	}
+	for i := range assets {
+		if assets[i].Name == art.Name+".sig" {
+			return art, &assets[i], true
+		}
+	}
+	return nil, nil, false
+}
+
+func (s *Source) metadataFor(ctx context.Context, r release, art, sig *asset) (*metadata.Metadata, error) {
+	var buf bytes.Buffer
+	if err := s.FetchArtifact(ctx, s.assetURL(sig), &buf); err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", sig.Name, err)
+	}
+
+	checksum, signature, ok := strings.Cut(strings.TrimSpace(buf.String()), " ")
+	if !ok {
+		return nil, fmt.Errorf("%s: expected \"<sha256> <signature>\"", sig.Name)
+	}
+
+	return &metadata.Metadata{
+		Version:     strings.TrimPrefix(r.TagName, s.TagPrefix),
+		Checksum:    checksum,
+		Signature:   strings.TrimSpace(signature),
+		DownloadURL: s.assetURL(art),
+		Size:        art.Size,
+	}, nil
+}
+
+// assetURL returns the API URL for private repositories, which requires the
+// token, and the public download URL otherwise.
+func (s *Source) assetURL(a *asset) string {
+	if s.Token != "" {
+		return a.URL
+	}
+	return a.BrowserDownloadURL
+}
+
+// Sidecar returns the contents of the ".sig" asset of the artifact of the
+// release m.
+func Sidecar(m *metadata.Metadata) []byte {
+	return []byte(m.Checksum + " " + m.Signature + "\n")
+}
+
+// UploadAsset attaches data as the asset name to the release with tag,
+// creating the release if there is none and replacing an asset of the same
+// name. It requires Token.
+func (s *Source) UploadAsset(ctx context.Context, tag, name string, data []byte, contentType string) error {
+	r, err := s.ensureRelease(ctx, tag)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range r.Assets {
+		if a.Name != name {
+			continue
+		}
+		u := fmt.Sprintf("%s/repos/%s/%s/releases/assets/%d", s.baseURL(), s.Owner, s.Repo, a.ID)
+		if err = s.send(ctx, http.MethodDelete, u, nil, "", http.StatusNoContent, nil); err != nil {
+			return err
+		}
+	}
+
+	uploadURL, _, _ := strings.Cut(r.UploadURL, "{")
+	if uploadURL == "" {
+		return fmt.Errorf("github: release %s has no upload URL", tag)
+	}
+	return s.send(ctx, http.MethodPost, uploadURL+"?name="+url.QueryEscape(name), data, contentType, http.StatusCreated, nil)
+}
+
+// ensureRelease returns the release with tag, creating it if necessary.
+func (s *Source) ensureRelease(ctx context.Context, tag string) (*release, error) {
+	var r release
+	err := s.getJSON(ctx, fmt.Sprintf("%s/repos/%s/%s/releases/tags/%s", s.baseURL(), s.Owner, s.Repo, url.PathEscape(tag)), &r)
+	if err == nil || !errors.Is(err, errNotFound) {
+		return &r, err
+	}
+
+	body, err := json.Marshal(map[string]string{"tag_name": tag, "name": tag})
+	if err != nil {
+		return nil, err
+	}
+	err = s.send(ctx, http.MethodPost, fmt.Sprintf("%s/repos/%s/%s/releases", s.baseURL(), s.Owner, s.Repo), body, "application/json", http.StatusCreated, &r)
+	return &r, err
+}
+
+// send sends an authorized request with body, expecting the status want,
+// and decodes the JSON response into v if set.
+func (s *Source) send(ctx context.Context, method, url string, body []byte, contentType string, want int, v any) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != want {
+		return fmt.Errorf("github: %s %s: HTTP %d", method, url, resp.StatusCode)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 8<<20)).Decode(v)
+}
+
+func (s *Source) getJSON(ctx context.Context, url string, v any) error {
+	resp, err := s.do(ctx, url, "application/vnd.github+json")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return json.NewDecoder(io.LimitReader(resp.Body, 8<<20)).Decode(v)
+}
+
+func (s *Source) do(ctx context.Context, url, accept string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	if s.Token != "" && strings.HasPrefix(url, s.baseURL()) {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("github: GET %s: %w", url, errNotFound)
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("github: GET %s: HTTP %d", url, resp.StatusCode)
+	}
+	return resp, nil
+}
+
+func (s *Source) baseURL() string {
+	if s.BaseURL != "" {
+		return strings.TrimSuffix(s.BaseURL, "/")
+	}
+	return DefaultBaseURL
+}
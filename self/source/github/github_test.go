@@ -0,0 +1,149 @@
+package github_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/napalu/gosafedate/metadata"
+	"github.com/napalu/gosafedate/self"
+	"github.com/napalu/gosafedate/self/source/github"
+)
+
+func TestSource_UpdateFromLatestRelease(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	newData := []byte("new-binary")
+	sum := fmt.Sprintf("%x", sha256.Sum256(newData))
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte("v1.2.4+"+sum)))
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write(newData)
+	_ = zw.Close()
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/acme/myapp/releases":
+			dl := srv.URL + "/download/"
+			_ = json.NewEncoder(w).Encode([]map[string]any{
+				{"tag_name": "myapp/v1.3.0", "draft": true},
+				{"tag_name": "other/v9.0.0", "assets": []map[string]any{
+					{"name": "myapp_linux_amd64.gz", "browser_download_url": dl + "other.gz"},
+					{"name": "myapp_linux_amd64.gz.sig", "browser_download_url": dl + "other.gz.sig"},
+				}},
+				{"tag_name": "myapp/v1.2.4", "assets": []map[string]any{
+					{"name": "myapp_linux_amd64.gz", "size": gz.Len(), "browser_download_url": dl + "myapp_linux_amd64.gz"},
+					{"name": "myapp_linux_amd64.gz.sig", "browser_download_url": dl + "myapp_linux_amd64.gz.sig"},
+					{"name": "myapp_darwin_arm64.gz", "browser_download_url": dl + "myapp_darwin_arm64.gz"},
+				}},
+			})
+		case "/download/myapp_linux_amd64.gz":
+			_, _ = w.Write(gz.Bytes())
+		case "/download/myapp_linux_amd64.gz.sig":
+			_, _ = fmt.Fprintf(w, "%s %s\n", sum, sig)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	currPath := filepath.Join(t.TempDir(), "myapp")
+	if err = os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write temp exe: %v", err)
+	}
+
+	err = self.UpdateIfNewer(self.Config{
+		Source: &github.Source{
+			Owner:        "acme",
+			Repo:         "myapp",
+			AssetPattern: "myapp_linux_amd64.gz",
+			TagPrefix:    "myapp/",
+			BaseURL:      srv.URL,
+		},
+		PubKey:     pub,
+		CurrentVer: "v1.2.3",
+		TargetPath: currPath,
+	})
+	if err != nil {
+		t.Fatalf("UpdateIfNewer returned error: %v", err)
+	}
+
+	got, err := os.ReadFile(currPath)
+	if err != nil {
+		t.Fatalf("read updated exe: %v", err)
+	}
+	if !bytes.Equal(got, newData) {
+		t.Fatalf("exe not replaced; got=%q", got)
+	}
+}
+
+func TestSource_UploadAsset(t *testing.T) {
+	var (
+		srv      *httptest.Server
+		created  bool
+		deleted  []string
+		uploaded = map[string]string{}
+	)
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		rel := map[string]any{"id": 1, "tag_name": "v1.2.4", "upload_url": srv.URL + "/uploads/1/assets{?name,label}",
+			"assets": []map[string]any{{"id": 7, "name": "metadata.json"}}}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/acme/myapp/releases/tags/v1.2.4":
+			if !created {
+				http.NotFound(w, r)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(rel)
+		case r.Method == http.MethodPost && r.URL.Path == "/repos/acme/myapp/releases":
+			created = true
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(rel)
+		case r.Method == http.MethodDelete && r.URL.Path == "/repos/acme/myapp/releases/assets/7":
+			deleted = append(deleted, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPost && r.URL.Path == "/uploads/1/assets":
+			var b bytes.Buffer
+			_, _ = b.ReadFrom(r.Body)
+			uploaded[r.URL.Query().Get("name")] = b.String()
+			w.WriteHeader(http.StatusCreated)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	src := &github.Source{Owner: "acme", Repo: "myapp", Token: "token", BaseURL: srv.URL}
+	m := &metadata.Metadata{Version: "v1.2.4", Checksum: "abcd", Signature: "c2ln"}
+	if err := src.UploadAsset(context.Background(), "v1.2.4", "myapp.gz.sig", github.Sidecar(m), "text/plain"); err != nil {
+		t.Fatalf("UploadAsset: %v", err)
+	}
+	if err := src.UploadAsset(context.Background(), "v1.2.4", "metadata.json", []byte("{}"), "application/json"); err != nil {
+		t.Fatalf("UploadAsset replacing an asset: %v", err)
+	}
+
+	if !created || len(deleted) != 1 {
+		t.Fatalf("created = %v, deleted = %v", created, deleted)
+	}
+	if uploaded["myapp.gz.sig"] != "abcd c2ln\n" || uploaded["metadata.json"] != "{}" {
+		t.Fatalf("uploaded = %v", uploaded)
+	}
+}
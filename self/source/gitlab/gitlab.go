@@ -0,0 +1,194 @@
+// Package gitlab provides a self.Source reading updates from GitLab
+// Releases, including self-hosted instances.
+//
+// A release provides an update if it has an asset link matching AssetPattern
+// and a signature link named after it with a ".sig" suffix. The signature
+// asset holds a single line:
+//
+//	<sha256 of the installed binary> <base64 Ed25519 signature over "version+sha256">
+//
+// The release tag (without TagPrefix) is the version.
+package gitlab
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/napalu/gosafedate/metadata"
+)
+
+// DefaultBaseURL is the GitLab.com endpoint.
+const DefaultBaseURL = "https://gitlab.com"
+
+// ErrNoRelease is returned if no release provides a matching asset.
+var ErrNoRelease = errors.New("no matching release found")
+
+// Source reads the latest matching release of a GitLab project.
+type Source struct {
+	Project      string       // numeric ID or full path, e.g. "acme/tools/myapp"
+	AssetPattern string       // glob matching the artifact link name
+	TagPrefix    string       // if set: only consider tags with this prefix, stripped from the version
+	Token        string       // optional personal, project or deploy token
+	JobToken     bool         // if true: Token is a CI job token
+	BaseURL      string       // if empty: DefaultBaseURL
+	Client       *http.Client // if nil: http.DefaultClient
+}
+
+type release struct {
+	TagName  string `json:"tag_name"`
+	Upcoming bool   `json:"upcoming_release"`
+	Assets   struct {
+		Links []link `json:"links"`
+	} `json:"assets"`
+}
+
+type link struct {
+	Name           string `json:"name"`
+	URL            string `json:"url"`
+	DirectAssetURL string `json:"direct_asset_url"`
+}
+
+// FetchMetadata implements self.Source. It derives the metadata from the
+// newest matching release and its signature asset.
+func (s *Source) FetchMetadata(ctx context.Context) (io.ReadCloser, error) {
+	var releases []release
+	u := fmt.Sprintf("%s/api/v4/projects/%s/releases?per_page=100", s.baseURL(), url.PathEscape(s.Project))
+	if err := s.getJSON(ctx, u, &releases); err != nil {
+		return nil, err
+	}
+
+	for _, r := range releases {
+		if r.Upcoming || !strings.HasPrefix(r.TagName, s.TagPrefix) {
+			continue
+		}
+
+		art, sig, ok := s.findLinks(r.Assets.Links)
+		if !ok {
+			continue
+		}
+
+		m, err := s.metadataFor(ctx, r, art, sig)
+		if err != nil {
+			return nil, err
+		}
+
+		b, err := json.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+
+	return nil, fmt.Errorf("%w in %s", ErrNoRelease, s.Project)
+}
+
+// FetchArtifact implements self.Source.
+func (s *Source) FetchArtifact(ctx context.Context, url string, w io.Writer) error {
+	resp, err := s.do(ctx, url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+func (s *Source) findLinks(links []link) (art, sig *link, ok bool) {
+	for i := range links {
+		if matched, _ := path.Match(s.AssetPattern, links[i].Name); matched && s.AssetPattern != "" {
+			art = &links[i]
+			break
+		}
+	}
+	if art == nil {
+		return nil, nil, false
+	}
+	for i := range links {
+		if links[i].Name == art.Name+".sig" {
+			return art, &links[i], true
+		}
+	}
+	return nil, nil, false
+}
+
+func (s *Source) metadataFor(ctx context.Context, r release, art, sig *link) (*metadata.Metadata, error) {
+	var buf bytes.Buffer
+	if err := s.FetchArtifact(ctx, linkURL(sig), &buf); err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", sig.Name, err)
+	}
+
+	checksum, signature, ok := strings.Cut(strings.TrimSpace(buf.String()), " ")
+	if !ok {
+		return nil, fmt.Errorf("%s: expected \"<sha256> <signature>\"", sig.Name)
+	}
+
+	return &metadata.Metadata{
+		Version:     strings.TrimPrefix(r.TagName, s.TagPrefix),
+		Checksum:    checksum,
+		Signature:   strings.TrimSpace(signature),
+		DownloadURL: linkURL(art),
+	}, nil
+}
+
+// linkURL prefers the permanent direct asset URL.
+func linkURL(l *link) string {
+	if l.DirectAssetURL != "" {
+		return l.DirectAssetURL
+	}
+	return l.URL
+}
+
+func (s *Source) getJSON(ctx context.Context, url string, v any) error {
+	resp, err := s.do(ctx, url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return json.NewDecoder(io.LimitReader(resp.Body, 8<<20)).Decode(v)
+}
+
+func (s *Source) do(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	// only send the token to the GitLab instance itself
+	if s.Token != "" && strings.HasPrefix(url, s.baseURL()+"/") {
+		if s.JobToken {
+			req.Header.Set("JOB-TOKEN", s.Token)
+		} else {
+			req.Header.Set("PRIVATE-TOKEN", s.Token)
+		}
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("gitlab: GET %s: HTTP %d", url, resp.StatusCode)
+	}
+	return resp, nil
+}
+
+func (s *Source) baseURL() string {
+	if s.BaseURL != "" {
+		return strings.TrimSuffix(s.BaseURL, "/")
+	}
+	return DefaultBaseURL
+}
@@ -0,0 +1,89 @@
+package gitlab_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/napalu/gosafedate/self"
+	"github.com/napalu/gosafedate/self/source/gitlab"
+)
+
+func TestSource_UpdateFromLatestRelease(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	newData := []byte("new-binary")
+	sum := fmt.Sprintf("%x", sha256.Sum256(newData))
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte("v1.2.4+"+sum)))
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write(newData)
+	_ = zw.Close()
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("PRIVATE-TOKEN") != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.EscapedPath() {
+		case "/api/v4/projects/acme%2Fmyapp/releases":
+			dl := srv.URL + "/acme/myapp/-/releases/v1.2.4/downloads/"
+			_ = json.NewEncoder(w).Encode([]map[string]any{
+				{"tag_name": "v1.3.0", "upcoming_release": true},
+				{"tag_name": "v1.2.4", "assets": map[string]any{"links": []map[string]any{
+					{"name": "myapp_linux_amd64.gz", "direct_asset_url": dl + "myapp_linux_amd64.gz"},
+					{"name": "myapp_linux_amd64.gz.sig", "direct_asset_url": dl + "myapp_linux_amd64.gz.sig"},
+				}}},
+			})
+		case "/acme/myapp/-/releases/v1.2.4/downloads/myapp_linux_amd64.gz":
+			_, _ = w.Write(gz.Bytes())
+		case "/acme/myapp/-/releases/v1.2.4/downloads/myapp_linux_amd64.gz.sig":
+			_, _ = fmt.Fprintf(w, "%s %s\n", sum, sig)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	currPath := filepath.Join(t.TempDir(), "myapp")
+	if err = os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write temp exe: %v", err)
+	}
+
+	err = self.UpdateIfNewer(self.Config{
+		Source: &gitlab.Source{
+			Project:      "acme/myapp",
+			AssetPattern: "myapp_linux_amd64.gz",
+			Token:        "secret",
+			BaseURL:      srv.URL,
+		},
+		PubKey:     pub,
+		CurrentVer: "v1.2.3",
+		TargetPath: currPath,
+	})
+	if err != nil {
+		t.Fatalf("UpdateIfNewer returned error: %v", err)
+	}
+
+	got, err := os.ReadFile(currPath)
+	if err != nil {
+		t.Fatalf("read updated exe: %v", err)
+	}
+	if !bytes.Equal(got, newData) {
+		t.Fatalf("exe not replaced; got=%q", got)
+	}
+}
@@ -0,0 +1,299 @@
+// Package objstore provides a self.Source reading metadata and artifacts
+// straight from object storage:
+//
+//	s3://bucket/releases/myapp/metadata.json
+//	gs://bucket/releases/myapp/metadata.json
+//	az://account/container/releases/myapp/metadata.json
+//
+// Relative download URLs in the metadata are resolved against URL. Objects are
+// fetched over the providers' HTTPS APIs without pulling in their SDKs.
+// Credentials are resolved as the SDKs do, from the environment, the shared
+// configuration files and the instance metadata services:
+//
+//   - S3: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, the static keys of
+//     AWS_PROFILE in ~/.aws/credentials and ~/.aws/config, the ECS/EKS
+//     container credentials or the EC2 instance profile; requests are signed
+//     with SigV4 for AWS_REGION, AWS_DEFAULT_REGION or the profile's region.
+//   - GCS: GOOGLE_OAUTH_ACCESS_TOKEN, the application default credentials
+//     (GOOGLE_APPLICATION_CREDENTIALS or gcloud auth application-default
+//     login) or the GCE service account, sent as a bearer token.
+//   - Azure: AZURE_STORAGE_SAS_TOKEN, appended to the blob URL, else a token
+//     of the service principal or workload identity (AZURE_TENANT_ID,
+//     AZURE_CLIENT_ID and AZURE_CLIENT_SECRET or AZURE_FEDERATED_TOKEN_FILE)
+//     or the managed identity.
+//
+// See internal/cloudauth for the details. Without credentials, objects are
+// fetched anonymously (public buckets); credentials which are configured but
+// can't be resolved, e.g. an AWS_PROFILE missing from the files, are an
+// error. Put uploads objects with the same credentials, e.g. to publish
+// releases. Other credential chains, e.g. profiles assuming a role, can be
+// plugged in via Source.Authorize using the providers' SDKs.
+//
+// Object keys may hold any character: in the URL, escape those with a
+// meaning there, e.g. s3://bucket/my%20app%3F.gz for the key "my app?.gz".
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/napalu/gosafedate/internal/cloudauth"
+	"github.com/napalu/gosafedate/internal/sigv4"
+)
+
+// Source fetches metadata and artifacts from s3://, gs:// or az:// URLs.
+type Source struct {
+	URL string // URL of the metadata document
+
+	// Authorize, if set, authorizes requests instead of the resolved
+	// credentials. It receives the HTTPS request for the object.
+	Authorize func(req *http.Request) error
+	// Anonymous skips resolving credentials, and probing the instance
+	// metadata services for them, for public buckets.
+	Anonymous bool
+
+	S3Endpoint string       // if set: path-style endpoint for S3-compatible stores, e.g. "https://minio.local:9000"
+	Client     *http.Client // if nil: http.DefaultClient
+
+	authOnce sync.Once
+	aws      *cloudauth.AWS
+	google   *cloudauth.Google
+	azure    *cloudauth.Azure
+}
+
+// FetchMetadata implements self.Source.
+func (s *Source) FetchMetadata(ctx context.Context) (io.ReadCloser, error) {
+	resp, err := s.get(ctx, s.URL)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// FetchArtifact implements self.Source.
+func (s *Source) FetchArtifact(ctx context.Context, rawURL string, w io.Writer) error {
+	u, err := s.resolve(rawURL)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.get(ctx, u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// resolve resolves a (possibly relative) download URL against s.URL.
+func (s *Source) resolve(rawURL string) (string, error) {
+	base, err := url.Parse(s.URL)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// Put uploads data as the object at rawURL, an s3://, gs:// or az:// URL,
+// replacing any existing object.
+func (s *Source) Put(ctx context.Context, rawURL string, data []byte, contentType string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "s3" && u.Scheme != "gs" && u.Scheme != "az" {
+		return fmt.Errorf("objstore: unsupported URL scheme %q", u.Scheme)
+	}
+
+	resp, err := s.do(ctx, http.MethodPut, u, data, contentType)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *Source) get(ctx context.Context, rawURL string) (*http.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return s.do(ctx, http.MethodGet, u, nil, "")
+}
+
+func (s *Source) do(ctx context.Context, method string, u *url.URL, body []byte, contentType string) (*http.Response, error) {
+	var (
+		req *http.Request
+		err error
+	)
+	switch u.Scheme {
+	case "s3":
+		req, err = s.s3Request(ctx, method, u, body)
+	case "gs":
+		req, err = s.gcsRequest(ctx, method, u, body)
+	case "az":
+		req, err = s.azureRequest(ctx, method, u, body)
+	case "http", "https":
+		req, err = newRequest(ctx, method, u.String(), body)
+	default:
+		return nil, fmt.Errorf("objstore: unsupported URL scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("objstore: %s %s: HTTP %d", method, u, resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// newRequest returns a request with body, which is nil for GET requests.
+func newRequest(ctx context.Context, method, endpoint string, body []byte) (*http.Request, error) {
+	if body == nil {
+		return http.NewRequestWithContext(ctx, method, endpoint, nil)
+	}
+	return http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+}
+
+// providers returns the credential providers, which cache the credentials
+// they resolve.
+func (s *Source) providers() (*cloudauth.AWS, *cloudauth.Google, *cloudauth.Azure) {
+	s.authOnce.Do(func() {
+		s.aws = &cloudauth.AWS{}
+		s.google = &cloudauth.Google{Scope: "https://www.googleapis.com/auth/devstorage.read_write", Client: s.Client}
+		s.azure = &cloudauth.Azure{Resource: "https://storage.azure.com/", Client: s.Client}
+	})
+	return s.aws, s.google, s.azure
+}
+
+func (s *Source) s3Request(ctx context.Context, method string, u *url.URL, body []byte) (*http.Request, error) {
+	bucket, key := u.Host, escapeKey(strings.TrimPrefix(u.Path, "/"))
+	region := cloudauth.AWSRegion()
+
+	var endpoint string
+	if s.S3Endpoint != "" {
+		endpoint = fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(s.S3Endpoint, "/"), bucket, key)
+	} else {
+		endpoint = fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, region, key)
+	}
+
+	req, err := newRequest(ctx, method, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	if s.Authorize != nil {
+		return req, s.Authorize(req)
+	}
+
+	if s.Anonymous {
+		return req, nil
+	}
+
+	aws, _, _ := s.providers()
+	creds, found, err := aws.Credentials(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("objstore: %w", err)
+	}
+	if found {
+		payloadHash := sigv4.EmptyPayloadHash
+		if body != nil {
+			payloadHash = sigv4.PayloadHash(body)
+		}
+		sigv4.Sign(req, payloadHash, creds, region, "s3", time.Now())
+	}
+	return req, nil
+}
+
+func (s *Source) gcsRequest(ctx context.Context, method string, u *url.URL, body []byte) (*http.Request, error) {
+	endpoint := fmt.Sprintf("https://storage.googleapis.com/%s%s", u.Host, u.EscapedPath())
+	req, err := newRequest(ctx, method, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	if s.Authorize != nil {
+		return req, s.Authorize(req)
+	}
+
+	if s.Anonymous {
+		return req, nil
+	}
+
+	_, google, _ := s.providers()
+	token, found, err := google.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("objstore: %w", err)
+	}
+	if found {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+func (s *Source) azureRequest(ctx context.Context, method string, u *url.URL, body []byte) (*http.Request, error) {
+	endpoint := fmt.Sprintf("https://%s.blob.core.windows.net%s", u.Host, u.EscapedPath())
+	sas := strings.TrimPrefix(os.Getenv("AZURE_STORAGE_SAS_TOKEN"), "?")
+	if s.Authorize == nil && !s.Anonymous && sas != "" {
+		endpoint += "?" + sas
+	}
+
+	req, err := newRequest(ctx, method, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-ms-version", "2021-08-06")
+	if method == http.MethodPut {
+		req.Header.Set("x-ms-blob-type", "BlockBlob")
+	}
+	if s.Authorize != nil {
+		return req, s.Authorize(req)
+	}
+	if s.Anonymous || sas != "" {
+		return req, nil
+	}
+
+	_, _, azure := s.providers()
+	token, found, err := azure.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("objstore: %w", err)
+	}
+	if found {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+// escapeKey escapes the segments of an S3 object key as SigV4 expects them
+// in the canonical request, which signs the path as sent.
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, seg := range segments {
+		segments[i] = sigv4.Escape(seg)
+	}
+	return strings.Join(segments, "/")
+}
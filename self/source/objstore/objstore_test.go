@@ -0,0 +1,207 @@
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSource_S3Endpoint(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_REGION", "eu-west-1")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/bucket/releases/metadata.json":
+			_, _ = io.WriteString(w, `{"version":"v1.0.0"}`)
+		case "/bucket/releases/myapp.gz":
+			_, _ = io.WriteString(w, "artifact")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	src := &Source{URL: "s3://bucket/releases/metadata.json", S3Endpoint: srv.URL}
+
+	rc, err := src.FetchMetadata(context.Background())
+	if err != nil {
+		t.Fatalf("FetchMetadata: %v", err)
+	}
+	b, _ := io.ReadAll(rc)
+	_ = rc.Close()
+	if string(b) != `{"version":"v1.0.0"}` {
+		t.Fatalf("metadata = %q", b)
+	}
+
+	var buf bytes.Buffer
+	if err := src.FetchArtifact(context.Background(), "myapp.gz", &buf); err != nil {
+		t.Fatalf("FetchArtifact: %v", err)
+	}
+	if buf.String() != "artifact" {
+		t.Fatalf("artifact = %q", buf.String())
+	}
+
+	if err := src.FetchArtifact(context.Background(), "missing.gz", io.Discard); err == nil {
+		t.Fatal("expected error for missing object")
+	}
+}
+
+func TestSource_EscapesKeys(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	var got *http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		_, _ = io.WriteString(w, "artifact")
+	}))
+	defer srv.Close()
+
+	src := &Source{URL: "s3://bucket/releases/metadata.json", S3Endpoint: srv.URL}
+	var buf bytes.Buffer
+	if err := src.FetchArtifact(context.Background(), "my%20app%3Fv1%231+2.gz", &buf); err != nil {
+		t.Fatalf("FetchArtifact: %v", err)
+	}
+	if got.URL.Path != "/bucket/releases/my app?v1#1+2.gz" || got.URL.RawQuery != "" {
+		t.Fatalf("path = %q, query = %q", got.URL.Path, got.URL.RawQuery)
+	}
+	if got.URL.EscapedPath() != "/bucket/releases/my%20app%3Fv1%231%2B2.gz" {
+		t.Fatalf("escaped path = %q", got.URL.EscapedPath())
+	}
+
+	var azure *http.Request
+	src = &Source{
+		URL:       "az://acct/releases/app/metadata.json",
+		Authorize: func(req *http.Request) error { azure = req; return context.Canceled },
+	}
+	_ = src.FetchArtifact(context.Background(), "my%20app%3F.gz", &buf)
+	if azure.URL.Path != "/releases/app/my app?.gz" || azure.URL.RawQuery != "" {
+		t.Fatalf("azure path = %q, query = %q", azure.URL.Path, azure.URL.RawQuery)
+	}
+}
+
+func TestSource_Authorize(t *testing.T) {
+	var got *http.Request
+	src := &Source{
+		URL:       "gs://bucket/app/metadata.json",
+		Authorize: func(req *http.Request) error { got = req; return context.Canceled },
+	}
+	if _, err := src.FetchMetadata(context.Background()); err != context.Canceled {
+		t.Fatalf("err = %v, want authorize error", err)
+	}
+	if got.URL.String() != "https://storage.googleapis.com/bucket/app/metadata.json" {
+		t.Fatalf("url = %s", got.URL)
+	}
+
+	src.URL = "az://acct/releases/app/metadata.json"
+	_, _ = src.FetchMetadata(context.Background())
+	if got.URL.String() != "https://acct.blob.core.windows.net/releases/app/metadata.json" {
+		t.Fatalf("url = %s", got.URL)
+	}
+}
+
+func TestSource_Put(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	var got []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != "/bucket/releases/myapp.gz" {
+			http.NotFound(w, r)
+			return
+		}
+		sum := sha256.Sum256([]byte("artifact"))
+		if r.Header.Get("x-amz-content-sha256") != hex.EncodeToString(sum[:]) || r.Header.Get("Content-Type") != "application/gzip" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		got, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	src := &Source{S3Endpoint: srv.URL}
+	if err := src.Put(context.Background(), "s3://bucket/releases/myapp.gz", []byte("artifact"), "application/gzip"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if string(got) != "artifact" {
+		t.Fatalf("uploaded %q", got)
+	}
+
+	if err := src.Put(context.Background(), "s3://bucket/other.gz", []byte("x"), ""); err == nil {
+		t.Fatal("Put succeeded despite HTTP 404")
+	}
+	if err := src.Put(context.Background(), "https://example.com/x", nil, ""); err == nil {
+		t.Fatal("Put to an HTTPS URL succeeded")
+	}
+}
+
+func TestSource_Credentials(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", "")
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+
+	var requests []*http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		_, _ = io.WriteString(w, `{"version":"v1.0.0"}`)
+	}))
+	defer srv.Close()
+	fetch := func(src *Source) error {
+		requests = nil
+		rc, err := src.FetchMetadata(context.Background())
+		if err == nil {
+			_ = rc.Close()
+		}
+		return err
+	}
+
+	// a profile which can't be resolved isn't an anonymous request
+	t.Setenv("AWS_PROFILE", "release")
+	src := &Source{URL: "s3://bucket/metadata.json", S3Endpoint: srv.URL}
+	if err := fetch(src); err == nil || !strings.Contains(err.Error(), `AWS profile "release" not found`) || len(requests) != 0 {
+		t.Fatalf("err = %v, %d requests; want profile error", err, len(requests))
+	}
+	src = &Source{URL: "s3://bucket/metadata.json", S3Endpoint: srv.URL, Anonymous: true}
+	if err := fetch(src); err != nil || requests[0].Header.Get("Authorization") != "" {
+		t.Fatalf("anonymous fetch: %v", err)
+	}
+
+	dir := filepath.Join(home, ".aws")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "credentials"), []byte("[release]\naws_access_key_id = PROFILEID\naws_secret_access_key = secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "config"), []byte("[profile release]\nregion = eu-north-1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	src = &Source{URL: "s3://bucket/metadata.json", S3Endpoint: srv.URL}
+	if err := fetch(src); err != nil {
+		t.Fatalf("FetchMetadata: %v", err)
+	}
+	if auth := requests[0].Header.Get("Authorization"); !strings.Contains(auth, "Credential=PROFILEID/") || !strings.Contains(auth, "/eu-north-1/s3/") {
+		t.Fatalf("Authorization = %q", auth)
+	}
+}
@@ -0,0 +1,276 @@
+// Package sparkle provides a self.Source reading updates from a Sparkle
+// appcast (https://sparkle-project.org), so apps already publishing one can
+// point gosafedate at the same feed.
+//
+// The newest item with an enclosure for OS provides the update: its
+// sparkle:shortVersionString, or sparkle:version, is the version, and the
+// enclosure's url and length the download. sparkle:criticalUpdate makes the
+// update mandatory.
+//
+// Sparkle signs the enclosure itself with EdDSA (sparkle:edSignature); set
+// Config.Verifier to a Verifier with the app's public key (SUPublicEDKey)
+// to check it. The checksum of the installed binary, which appcasts don't
+// carry, goes in an element of the gosafedate namespace, with an optional
+// gosafedate signature over "version+sha256" for use with Config.PubKey:
+//
+//	<rss xmlns:gosafedate="https://github.com/napalu/gosafedate" ...>
+//	  <item>
+//	    <gosafedate:sha256>9f86d081884c7d65...</gosafedate:sha256>
+//	    <gosafedate:signature>mLr4Q1...==</gosafedate:signature>
+package sparkle
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/napalu/gosafedate/metadata"
+	"github.com/napalu/gosafedate/version"
+)
+
+// XML namespaces of appcast extensions.
+const (
+	SparkleNamespace    = "http://www.andymatuschak.org/xml-namespaces/sparkle"
+	GosafedateNamespace = "https://github.com/napalu/gosafedate"
+)
+
+// SignatureSuffix is the suffix under which Source serves the EdDSA
+// signature of an enclosure to a Verifier.
+const SignatureSuffix = ".sparkle-edsig"
+
+// maxAppcastSize bounds the appcast document.
+const maxAppcastSize = 8 << 20
+
+// ErrNoItem is returned if no appcast item provides an update for OS.
+var ErrNoItem = errors.New("no matching appcast item found")
+
+// Appcast is a parsed Sparkle appcast.
+type Appcast struct {
+	Items []Item `xml:"channel>item"`
+}
+
+// Item is a release of an Appcast.
+type Item struct {
+	Title              string    `xml:"title"`
+	Version            string    `xml:"http://www.andymatuschak.org/xml-namespaces/sparkle version"`
+	ShortVersionString string    `xml:"http://www.andymatuschak.org/xml-namespaces/sparkle shortVersionString"`
+	Channel            string    `xml:"http://www.andymatuschak.org/xml-namespaces/sparkle channel"`
+	CriticalUpdate     *struct{} `xml:"http://www.andymatuschak.org/xml-namespaces/sparkle criticalUpdate"`
+	Enclosure          Enclosure `xml:"enclosure"`
+	Checksum           string    `xml:"https://github.com/napalu/gosafedate sha256"`
+	Signature          string    `xml:"https://github.com/napalu/gosafedate signature"`
+}
+
+// Enclosure is the download of an Item. Older appcasts put the versions on
+// the enclosure rather than the item.
+type Enclosure struct {
+	URL                string `xml:"url,attr"`
+	Length             int64  `xml:"length,attr"`
+	Type               string `xml:"type,attr"`
+	Version            string `xml:"http://www.andymatuschak.org/xml-namespaces/sparkle version,attr"`
+	ShortVersionString string `xml:"http://www.andymatuschak.org/xml-namespaces/sparkle shortVersionString,attr"`
+	EdSignature        string `xml:"http://www.andymatuschak.org/xml-namespaces/sparkle edSignature,attr"`
+	OS                 string `xml:"http://www.andymatuschak.org/xml-namespaces/sparkle os,attr"`
+}
+
+// ParseAppcast parses the appcast document read from r.
+func ParseAppcast(r io.Reader) (*Appcast, error) {
+	var a Appcast
+	if err := xml.NewDecoder(r).Decode(&a); err != nil {
+		return nil, fmt.Errorf("parse appcast: %w", err)
+	}
+	return &a, nil
+}
+
+// DisplayVersion returns the version of the item: its short version string,
+// else its version, from the item or its enclosure.
+func (it *Item) DisplayVersion() string {
+	for _, v := range []string{it.ShortVersionString, it.Enclosure.ShortVersionString, it.Version, it.Enclosure.Version} {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// Metadata maps the item onto the gosafedate metadata model.
+func (it *Item) Metadata() *metadata.Metadata {
+	return &metadata.Metadata{
+		Version:     it.DisplayVersion(),
+		Checksum:    strings.TrimSpace(it.Checksum),
+		Signature:   strings.TrimSpace(it.Signature),
+		DownloadURL: strings.TrimSpace(it.Enclosure.URL),
+		Size:        it.Enclosure.Length,
+		Mandatory:   it.CriticalUpdate != nil,
+	}
+}
+
+// Source reads the newest update of an appcast.
+type Source struct {
+	URL      string       // appcast URL
+	OS       string       // sparkle:os of the enclosures to consider, e.g. "macos" or "windows"; if empty: that of runtime.GOOS
+	Channels []string     // sparkle:channel values to consider besides the default channel
+	Client   *http.Client // if nil: http.DefaultClient
+
+	mu         sync.Mutex
+	signatures map[string]string // EdDSA signatures by enclosure URL
+}
+
+// FetchMetadata implements self.Source.
+func (s *Source) FetchMetadata(ctx context.Context) (io.ReadCloser, error) {
+	resp, err := s.get(ctx, s.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	a, err := ParseAppcast(io.LimitReader(resp.Body, maxAppcastSize))
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		newest *Item
+		newV   *version.Semver
+	)
+	for i := range a.Items {
+		it := &a.Items[i]
+		if !s.matches(it) {
+			continue
+		}
+		v, err := version.NewSemVer(it.DisplayVersion(), "v")
+		if err != nil {
+			continue
+		}
+		if newest == nil || v.GreaterThan(newV) {
+			newest, newV = it, v
+		}
+	}
+	if newest == nil {
+		return nil, fmt.Errorf("%w for %s in %s", ErrNoItem, s.os(), s.URL)
+	}
+
+	m := newest.Metadata()
+	if m.Checksum == "" {
+		return nil, fmt.Errorf("appcast item %s has no gosafedate:sha256", m.Version)
+	}
+
+	s.mu.Lock()
+	if s.signatures == nil {
+		s.signatures = map[string]string{}
+	}
+	s.signatures[m.DownloadURL] = newest.Enclosure.EdSignature
+	s.mu.Unlock()
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+// FetchArtifact implements self.Source. The enclosure URL with
+// SignatureSuffix yields its EdDSA signature from the appcast.
+func (s *Source) FetchArtifact(ctx context.Context, url string, w io.Writer) error {
+	if enclosure, ok := strings.CutSuffix(url, SignatureSuffix); ok {
+		s.mu.Lock()
+		sig, ok := s.signatures[enclosure]
+		s.mu.Unlock()
+		if !ok || sig == "" {
+			return fmt.Errorf("sparkle: no edSignature for %s", enclosure)
+		}
+		_, err := io.WriteString(w, sig)
+		return err
+	}
+
+	resp, err := s.get(ctx, url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+func (s *Source) matches(it *Item) bool {
+	if it.Enclosure.URL == "" {
+		return false
+	}
+	if it.Channel != "" && !slices.Contains(s.Channels, it.Channel) {
+		return false
+	}
+	return it.Enclosure.OS == "" || it.Enclosure.OS == s.os()
+}
+
+func (s *Source) os() string {
+	if s.OS != "" {
+		return s.OS
+	}
+	if runtime.GOOS == "darwin" {
+		return "macos"
+	}
+	return runtime.GOOS
+}
+
+func (s *Source) get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("sparkle: GET %s: HTTP %d", url, resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// Verifier is a self.ArtifactVerifier checking the EdDSA signature Sparkle
+// computes over the whole enclosure.
+type Verifier struct {
+	PublicKey []byte // raw 32-byte Ed25519 key; SUPublicEDKey is its base64
+}
+
+// SignatureSuffix implements self.ArtifactVerifier.
+func (v *Verifier) SignatureSuffix() string {
+	return SignatureSuffix
+}
+
+// VerifyArtifact implements self.ArtifactVerifier.
+func (v *Verifier) VerifyArtifact(path string, sig []byte) error {
+	if len(v.PublicKey) != ed25519.PublicKeySize {
+		return errors.New("sparkle: invalid Ed25519 public key")
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil {
+		return fmt.Errorf("sparkle: invalid edSignature: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(v.PublicKey, data, raw) {
+		return errors.New("sparkle: edSignature verification failed")
+	}
+	return nil
+}
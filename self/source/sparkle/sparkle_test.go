@@ -0,0 +1,175 @@
+package sparkle_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/napalu/gosafedate/metadata"
+	"github.com/napalu/gosafedate/self"
+	"github.com/napalu/gosafedate/self/source/sparkle"
+)
+
+const appcast = `<?xml version="1.0" encoding="utf-8"?>
+<rss version="2.0" xmlns:sparkle="http://www.andymatuschak.org/xml-namespaces/sparkle" xmlns:gosafedate="https://github.com/napalu/gosafedate">
+  <channel>
+    <title>MyApp</title>
+    <item>
+      <title>1.3.0 beta</title>
+      <sparkle:version>130</sparkle:version>
+      <sparkle:shortVersionString>1.3.0</sparkle:shortVersionString>
+      <sparkle:channel>beta</sparkle:channel>
+      <enclosure url="%[1]s/myapp-1.3.0.gz" length="1" type="application/octet-stream" sparkle:edSignature="%[2]s"/>
+      <gosafedate:sha256>%[3]s</gosafedate:sha256>
+    </item>
+    <item>
+      <title>1.2.5 for Windows</title>
+      <sparkle:shortVersionString>1.2.5</sparkle:shortVersionString>
+      <enclosure url="%[1]s/myapp-1.2.5.exe" length="1" sparkle:os="windows" sparkle:edSignature="%[2]s"/>
+      <gosafedate:sha256>%[3]s</gosafedate:sha256>
+    </item>
+    <item>
+      <title>1.2.4</title>
+      <sparkle:version>124</sparkle:version>
+      <sparkle:criticalUpdate/>
+      <enclosure url="%[1]s/myapp-1.2.4.gz" length="%[4]d" type="application/octet-stream" sparkle:shortVersionString="1.2.4" sparkle:edSignature="%[2]s"/>
+      <gosafedate:sha256>%[3]s</gosafedate:sha256>
+    </item>
+    <item>
+      <title>1.2.2</title>
+      <sparkle:shortVersionString>1.2.2</sparkle:shortVersionString>
+      <enclosure url="%[1]s/myapp-1.2.2.gz" length="1" sparkle:edSignature="%[2]s"/>
+      <gosafedate:sha256>%[3]s</gosafedate:sha256>
+    </item>
+  </channel>
+</rss>`
+
+func TestSource_UpdateFromAppcast(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	newData := []byte("new-binary")
+	sum := fmt.Sprintf("%x", sha256.Sum256(newData))
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write(newData)
+	_ = zw.Close()
+
+	tests := []struct {
+		name    string
+		edSig   string
+		wantErr bool
+	}{
+		{name: "valid", edSig: base64.StdEncoding.EncodeToString(ed25519.Sign(priv, gz.Bytes()))},
+		{name: "tampered", edSig: base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte("other"))), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var srv *httptest.Server
+			srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/appcast.xml":
+					_, _ = fmt.Fprintf(w, appcast, srv.URL, tt.edSig, sum, gz.Len())
+				case "/myapp-1.2.4.gz":
+					_, _ = w.Write(gz.Bytes())
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer srv.Close()
+
+			currPath := filepath.Join(t.TempDir(), "myapp")
+			if err := os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+				t.Fatalf("write temp exe: %v", err)
+			}
+
+			err := self.UpdateIfNewer(self.Config{
+				Source:     &sparkle.Source{URL: srv.URL + "/appcast.xml", OS: "macos"},
+				Verifier:   &sparkle.Verifier{PublicKey: pub},
+				CurrentVer: "v1.2.3",
+				TargetPath: currPath,
+			})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("UpdateIfNewer succeeded with a tampered edSignature")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UpdateIfNewer: %v", err)
+			}
+
+			got, err := os.ReadFile(currPath)
+			if err != nil {
+				t.Fatalf("read updated exe: %v", err)
+			}
+			if !bytes.Equal(got, newData) {
+				t.Fatalf("binary not updated: got %q", got)
+			}
+		})
+	}
+}
+
+func TestSource_FetchMetadata(t *testing.T) {
+	sum := strings.Repeat("ab", 32)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/empty.xml" {
+			_, _ = io.WriteString(w, `<rss><channel></channel></rss>`)
+			return
+		}
+		_, _ = fmt.Fprintf(w, appcast, "https://example.com", "c2ln", sum, 42)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name      string
+		src       *sparkle.Source
+		version   string
+		url       string
+		mandatory bool
+		wantErr   error
+	}{
+		{name: "default channel", src: &sparkle.Source{URL: srv.URL, OS: "macos"}, version: "1.2.4", url: "https://example.com/myapp-1.2.4.gz", mandatory: true},
+		{name: "beta channel", src: &sparkle.Source{URL: srv.URL, OS: "macos", Channels: []string{"beta"}}, version: "1.3.0", url: "https://example.com/myapp-1.3.0.gz"},
+		{name: "os", src: &sparkle.Source{URL: srv.URL, OS: "windows"}, version: "1.2.5", url: "https://example.com/myapp-1.2.5.exe"},
+		{name: "no item", src: &sparkle.Source{URL: srv.URL + "/empty.xml"}, wantErr: sparkle.ErrNoItem},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc, err := tt.src.FetchMetadata(t.Context())
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("FetchMetadata error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FetchMetadata: %v", err)
+			}
+			defer rc.Close()
+
+			var m metadata.Metadata
+			if err = json.NewDecoder(rc).Decode(&m); err != nil {
+				t.Fatalf("decode metadata: %v", err)
+			}
+			if m.Version != tt.version || m.DownloadURL != tt.url || m.Mandatory != tt.mandatory || m.Checksum != sum {
+				t.Fatalf("unexpected metadata: %+v", m)
+			}
+		})
+	}
+}
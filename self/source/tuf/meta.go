@@ -0,0 +1,215 @@
+package tuf
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"slices"
+	"time"
+)
+
+// top-level roles
+const (
+	roleRoot      = "root"
+	roleTimestamp = "timestamp"
+	roleSnapshot  = "snapshot"
+	roleTargets   = "targets"
+)
+
+type envelope struct {
+	Signed     json.RawMessage `json:"signed"`
+	Signatures []signature     `json:"signatures"`
+}
+
+type signature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"` // hex
+}
+
+// common holds the fields shared by all roles' metadata.
+type common struct {
+	Type    string    `json:"_type"`
+	Version int64     `json:"version"`
+	Expires time.Time `json:"expires"`
+}
+
+type rootMeta struct {
+	common
+	ConsistentSnapshot bool            `json:"consistent_snapshot"`
+	Keys               map[string]key  `json:"keys"`
+	Roles              map[string]role `json:"roles"`
+}
+
+type key struct {
+	KeyType string `json:"keytype"`
+	Scheme  string `json:"scheme"`
+	KeyVal  struct {
+		Public string `json:"public"`
+	} `json:"keyval"`
+}
+
+type role struct {
+	KeyIDs    []string `json:"keyids"`
+	Threshold int      `json:"threshold"`
+}
+
+// metaFile describes another metadata file in timestamp and snapshot.
+type metaFile struct {
+	Version int64             `json:"version"`
+	Length  int64             `json:"length,omitempty"`
+	Hashes  map[string]string `json:"hashes,omitempty"`
+}
+
+type timestampMeta struct {
+	common
+	Meta map[string]metaFile `json:"meta"`
+}
+
+type snapshotMeta struct {
+	common
+	Meta map[string]metaFile `json:"meta"`
+}
+
+type targetsMeta struct {
+	common
+	Targets     map[string]targetFile `json:"targets"`
+	Delegations json.RawMessage       `json:"delegations,omitempty"`
+}
+
+type targetFile struct {
+	Length int64             `json:"length"`
+	Hashes map[string]string `json:"hashes"`
+	Custom json.RawMessage   `json:"custom,omitempty"`
+}
+
+// parseSigned parses the metadata document b of roleName, verifies it is
+// signed by the threshold of keys of r in root and decodes its signed part
+// into v.
+func parseSigned(b []byte, roleName string, root *rootMeta, v any) error {
+	var env envelope
+	if err := json.Unmarshal(b, &env); err != nil {
+		return fmt.Errorf("parse %s: %w", roleName, err)
+	}
+	if err := verifySignatures(env, roleName, root); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(env.Signed, v); err != nil {
+		return fmt.Errorf("parse %s: %w", roleName, err)
+	}
+
+	var c common
+	if err := json.Unmarshal(env.Signed, &c); err != nil {
+		return fmt.Errorf("parse %s: %w", roleName, err)
+	}
+	if c.Type != roleName {
+		return fmt.Errorf("%s: unexpected type %q", roleName, c.Type)
+	}
+	return nil
+}
+
+func verifySignatures(env envelope, roleName string, root *rootMeta) error {
+	r, ok := root.Roles[roleName]
+	if !ok || r.Threshold < 1 {
+		return fmt.Errorf("root has no valid %s role", roleName)
+	}
+	msg, err := canonicalize(env.Signed)
+	if err != nil {
+		return fmt.Errorf("%s: %w", roleName, err)
+	}
+
+	valid := map[string]bool{}
+	for _, s := range env.Signatures {
+		if valid[s.KeyID] || !slices.Contains(r.KeyIDs, s.KeyID) {
+			continue
+		}
+		k, ok := root.Keys[s.KeyID]
+		if !ok {
+			continue
+		}
+		sig, err := hex.DecodeString(s.Sig)
+		if err != nil {
+			continue
+		}
+		if k.verify(msg, sig) {
+			valid[s.KeyID] = true
+		}
+	}
+	if len(valid) < r.Threshold {
+		return fmt.Errorf("%w: %s has %d of %d signatures", ErrVerification, roleName, len(valid), r.Threshold)
+	}
+	return nil
+}
+
+// verify verifies sig over msg with k, for the ed25519, ecdsa-sha2-nistp256
+// and rsassa-pss-sha256 schemes.
+func (k key) verify(msg, sig []byte) bool {
+	pub, err := k.publicKey()
+	if err != nil {
+		return false
+	}
+	digest := sha256.Sum256(msg)
+	switch pub := pub.(type) {
+	case ed25519.PublicKey:
+		return k.Scheme == "ed25519" && ed25519.Verify(pub, msg, sig)
+	case *ecdsa.PublicKey:
+		return k.Scheme == "ecdsa-sha2-nistp256" && ecdsa.VerifyASN1(pub, digest[:], sig)
+	case *rsa.PublicKey:
+		return k.Scheme == "rsassa-pss-sha256" &&
+			rsa.VerifyPSS(pub, crypto.SHA256, digest[:], sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto}) == nil
+	}
+	return false
+}
+
+func (k key) publicKey() (crypto.PublicKey, error) {
+	if k.KeyType == "ed25519" {
+		b, err := hex.DecodeString(k.KeyVal.Public)
+		if err != nil || len(b) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 key")
+		}
+		return ed25519.PublicKey(b), nil
+	}
+	block, _ := pem.Decode([]byte(k.KeyVal.Public))
+	if block == nil {
+		return nil, fmt.Errorf("invalid %s key", k.KeyType)
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// checkFile verifies the length and hashes of a file against its
+// description, if it has any.
+func checkFile(b []byte, length int64, hashes map[string]string) error {
+	if length > 0 && int64(len(b)) != length {
+		return fmt.Errorf("%w: length %d, expected %d", ErrVerification, len(b), length)
+	}
+	for alg, want := range hashes {
+		h := newHash(alg)
+		if h == nil {
+			continue
+		}
+		h.Write(b)
+		if hex.EncodeToString(h.Sum(nil)) != want {
+			return fmt.Errorf("%w: %s mismatch", ErrVerification, alg)
+		}
+	}
+	return nil
+}
+
+func newHash(alg string) hash.Hash {
+	switch alg {
+	case "sha256":
+		return sha256.New()
+	case "sha512":
+		return sha512.New()
+	}
+	return nil
+}
@@ -0,0 +1,463 @@
+// Package tuf provides a self.Source reading updates from a repository of The
+// Update Framework (https://theupdateframework.io). Its metadata replaces
+// gosafedate's own signature: the updater follows the TUF client workflow,
+// from the trusted root shipped with the binary (rotating it as the
+// repository does) through the timestamp, snapshot and targets roles, with
+// their signature thresholds, versions (rollback protection) and expiry
+// dates (freeze protection), and verifies the length and hashes of the
+// downloaded target.
+//
+// The target named Target provides the update. Its custom metadata carries
+// the fields TUF doesn't know about:
+//
+//	"custom": {"version": "v1.2.4", "sha256": "<sha256 of the installed binary>", "compression": "gzip"}
+//
+// "sha256" is only required for compressed or archived targets; a raw
+// binary is checked against its TUF hashes. "archive" and "mandatory" are
+// mapped as in the metadata format as well. Delegated targets are not
+// supported.
+//
+// Leave Config.PubKey empty when using this source: there is no
+// gosafedate signature to verify.
+package tuf
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/napalu/gosafedate/metadata"
+)
+
+// maxRootRotations bounds the root versions fetched in one update.
+const maxRootRotations = 32
+
+// maxMetadataSize bounds metadata files of unknown length.
+const maxMetadataSize = 4 << 20
+
+var (
+	// ErrVerification is returned when metadata or a target fails
+	// verification: too few signatures, or a length, hash or version
+	// mismatch.
+	ErrVerification = errors.New("tuf: verification failed")
+	// ErrRollback is returned when the repository serves older metadata
+	// than previously trusted.
+	ErrRollback = errors.New("tuf: metadata rollback")
+	// ErrExpired is returned when trusted metadata is past its expiry date.
+	ErrExpired = errors.New("tuf: metadata expired")
+	// ErrNoTarget is returned when the targets metadata has no Target.
+	ErrNoTarget = errors.New("tuf: target not found")
+)
+
+var errNotFound = errors.New("not found")
+
+// Source reads the update from the targets metadata of a TUF repository.
+type Source struct {
+	MetadataURL string       // base URL of the metadata files, e.g. https://tuf.example.com/metadata
+	TargetsURL  string       // base URL of the target files, e.g. https://tuf.example.com/targets
+	Root        []byte       // trusted root.json, shipped with the binary
+	Target      string       // target path of the update, e.g. "myapp/linux-amd64/myapp.gz"
+	CacheDir    string       // if set: trusted metadata is kept here across runs; if empty: in memory only
+	Client      *http.Client // if nil: http.DefaultClient
+
+	mu      sync.Mutex
+	trusted map[string][]byte     // trusted metadata by role, if CacheDir is empty
+	targets map[string]targetFile // targets by download URL
+}
+
+type custom struct {
+	Version     string `json:"version"`
+	SHA256      string `json:"sha256"`
+	Compression string `json:"compression"`
+	Archive     string `json:"archive"`
+	Mandatory   bool   `json:"mandatory"`
+}
+
+// FetchMetadata implements self.Source. It refreshes the trusted metadata
+// and derives the update metadata from Target.
+func (s *Source) FetchMetadata(ctx context.Context) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	root, targets, err := s.refresh(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tf, ok := targets.Targets[s.Target]
+	if !ok {
+		if len(targets.Delegations) > 0 {
+			return nil, fmt.Errorf("%w: %s (delegated targets are not supported)", ErrNoTarget, s.Target)
+		}
+		return nil, fmt.Errorf("%w: %s", ErrNoTarget, s.Target)
+	}
+
+	var c custom
+	if len(tf.Custom) > 0 {
+		if err = json.Unmarshal(tf.Custom, &c); err != nil {
+			return nil, fmt.Errorf("target %s: invalid custom metadata: %w", s.Target, err)
+		}
+	}
+	if c.Version == "" {
+		return nil, fmt.Errorf("target %s: no version in custom metadata", s.Target)
+	}
+
+	m := metadata.Metadata{
+		Version:            c.Version,
+		Checksum:           c.SHA256,
+		ChecksumCompressed: tf.Hashes["sha256"],
+		DownloadURL:        s.targetURL(root, tf),
+		Size:               tf.Length,
+		Compression:        c.Compression,
+		Archive:            c.Archive,
+		Mandatory:          c.Mandatory,
+	}
+	if m.Checksum == "" {
+		if (m.Compression != "" && m.Compression != "none") || m.Archive != "" || m.ChecksumCompressed == "" {
+			return nil, fmt.Errorf("target %s: custom sha256 of the binary required", s.Target)
+		}
+		m.Checksum, m.Compression = m.ChecksumCompressed, "none"
+	}
+
+	if s.targets == nil {
+		s.targets = map[string]targetFile{}
+	}
+	s.targets[m.DownloadURL] = tf
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+// FetchArtifact implements self.Source. Only targets returned by
+// FetchMetadata can be fetched; their length and hashes are verified.
+func (s *Source) FetchArtifact(ctx context.Context, url string, w io.Writer) error {
+	s.mu.Lock()
+	tf, ok := s.targets[url]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("tuf: %s is not a verified target", url)
+	}
+
+	resp, err := s.do(ctx, url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	hashes := map[string]hash.Hash{}
+	writers := []io.Writer{w}
+	for alg := range tf.Hashes {
+		if h := newHash(alg); h != nil {
+			hashes[alg] = h
+			writers = append(writers, h)
+		}
+	}
+	if len(hashes) == 0 {
+		return fmt.Errorf("%w: target has no supported hash", ErrVerification)
+	}
+
+	n, err := io.Copy(io.MultiWriter(writers...), io.LimitReader(resp.Body, tf.Length+1))
+	if err != nil {
+		return err
+	}
+	if n != tf.Length {
+		return fmt.Errorf("%w: target length %d, expected %d", ErrVerification, n, tf.Length)
+	}
+	for alg, h := range hashes {
+		if hex.EncodeToString(h.Sum(nil)) != tf.Hashes[alg] {
+			return fmt.Errorf("%w: target %s mismatch", ErrVerification, alg)
+		}
+	}
+	return nil
+}
+
+// targetURL returns the download URL of tf, prefixed with its hash in
+// consistent snapshot repositories.
+func (s *Source) targetURL(root *rootMeta, tf targetFile) string {
+	name := s.Target
+	if root.ConsistentSnapshot {
+		algs := make([]string, 0, len(tf.Hashes))
+		for alg := range tf.Hashes {
+			algs = append(algs, alg)
+		}
+		slices.Sort(algs)
+		if len(algs) > 0 {
+			dir, base := path.Split(name)
+			name = dir + tf.Hashes[algs[0]] + "." + base
+		}
+	}
+	return strings.TrimSuffix(s.TargetsURL, "/") + "/" + name
+}
+
+// refresh runs the TUF client workflow and returns the trusted root and
+// targets metadata.
+func (s *Source) refresh(ctx context.Context) (*rootMeta, *targetsMeta, error) {
+	root, err := s.updateRoot(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// timestamp
+	b, err := s.fetch(ctx, roleTimestamp+".json", maxMetadataSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	var ts timestampMeta
+	if err = parseSigned(b, roleTimestamp, root, &ts); err != nil {
+		return nil, nil, err
+	}
+	var oldTS timestampMeta
+	if s.loadTrusted(roleTimestamp, root, &oldTS) {
+		if ts.Version < oldTS.Version || ts.Meta["snapshot.json"].Version < oldTS.Meta["snapshot.json"].Version {
+			return nil, nil, fmt.Errorf("%w: timestamp version %d < %d", ErrRollback, ts.Version, oldTS.Version)
+		}
+	}
+	if err = checkExpiry(roleTimestamp, ts.common); err != nil {
+		return nil, nil, err
+	}
+	s.save(roleTimestamp, b)
+
+	// snapshot
+	sm, ok := ts.Meta["snapshot.json"]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: timestamp lists no snapshot", ErrVerification)
+	}
+	if b, err = s.fetchMeta(ctx, root, roleSnapshot, sm); err != nil {
+		return nil, nil, err
+	}
+	var snap snapshotMeta
+	if err = parseSigned(b, roleSnapshot, root, &snap); err != nil {
+		return nil, nil, err
+	}
+	if snap.Version != sm.Version {
+		return nil, nil, fmt.Errorf("%w: snapshot version %d, expected %d", ErrVerification, snap.Version, sm.Version)
+	}
+	var oldSnap snapshotMeta
+	if s.loadTrusted(roleSnapshot, root, &oldSnap) {
+		for name, old := range oldSnap.Meta {
+			if m, ok := snap.Meta[name]; !ok || m.Version < old.Version {
+				return nil, nil, fmt.Errorf("%w: %s in snapshot", ErrRollback, name)
+			}
+		}
+	}
+	if err = checkExpiry(roleSnapshot, snap.common); err != nil {
+		return nil, nil, err
+	}
+	s.save(roleSnapshot, b)
+
+	// targets
+	tm, ok := snap.Meta["targets.json"]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: snapshot lists no targets", ErrVerification)
+	}
+	if b, err = s.fetchMeta(ctx, root, roleTargets, tm); err != nil {
+		return nil, nil, err
+	}
+	var targets targetsMeta
+	if err = parseSigned(b, roleTargets, root, &targets); err != nil {
+		return nil, nil, err
+	}
+	if targets.Version != tm.Version {
+		return nil, nil, fmt.Errorf("%w: targets version %d, expected %d", ErrVerification, targets.Version, tm.Version)
+	}
+	if err = checkExpiry(roleTargets, targets.common); err != nil {
+		return nil, nil, err
+	}
+	s.save(roleTargets, b)
+
+	return root, &targets, nil
+}
+
+// updateRoot loads the trusted root, the shipped one or a newer cached one,
+// and follows the root rotations of the repository.
+func (s *Source) updateRoot(ctx context.Context) (*rootMeta, error) {
+	root, err := selfSignedRoot(s.Root)
+	if err != nil {
+		return nil, fmt.Errorf("trusted root: %w", err)
+	}
+	if b := s.load(roleRoot); b != nil {
+		if cached, err := selfSignedRoot(b); err == nil && cached.Version > root.Version && parseSigned(b, roleRoot, cached, &rootMeta{}) == nil {
+			root = cached
+		}
+	}
+
+	for range maxRootRotations {
+		b, err := s.fetch(ctx, fmt.Sprintf("%d.root.json", root.Version+1), maxMetadataSize)
+		if errors.Is(err, errNotFound) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// signed by the threshold of both the trusted and the new root
+		var next rootMeta
+		if err = parseSigned(b, roleRoot, root, &next); err != nil {
+			return nil, err
+		}
+		if err = parseSigned(b, roleRoot, &next, &rootMeta{}); err != nil {
+			return nil, err
+		}
+		if next.Version != root.Version+1 {
+			return nil, fmt.Errorf("%w: root version %d, expected %d", ErrVerification, next.Version, root.Version+1)
+		}
+		if !sameRole(root, &next, roleTimestamp) || !sameRole(root, &next, roleSnapshot) {
+			// recover from a fast-forward attack with compromised keys
+			s.drop(roleTimestamp, roleSnapshot)
+		}
+		root = &next
+		s.save(roleRoot, b)
+	}
+
+	if err = checkExpiry(roleRoot, root.common); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// selfSignedRoot parses the root metadata b, verified by its own keys.
+func selfSignedRoot(b []byte) (*rootMeta, error) {
+	var env envelope
+	if err := json.Unmarshal(b, &env); err != nil {
+		return nil, err
+	}
+	var root rootMeta
+	if err := json.Unmarshal(env.Signed, &root); err != nil {
+		return nil, err
+	}
+	if err := parseSigned(b, roleRoot, &root, &root); err != nil {
+		return nil, err
+	}
+	return &root, nil
+}
+
+func sameRole(a, b *rootMeta, name string) bool {
+	ra, rb := a.Roles[name], b.Roles[name]
+	return ra.Threshold == rb.Threshold && slices.Equal(ra.KeyIDs, rb.KeyIDs)
+}
+
+func checkExpiry(roleName string, c common) error {
+	if time.Now().After(c.Expires) {
+		return fmt.Errorf("%w: %s version %d on %s", ErrExpired, roleName, c.Version, c.Expires.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// fetchMeta fetches the snapshot or targets metadata described by m and
+// checks its length and hashes.
+func (s *Source) fetchMeta(ctx context.Context, root *rootMeta, roleName string, m metaFile) ([]byte, error) {
+	name := roleName + ".json"
+	if root.ConsistentSnapshot {
+		name = fmt.Sprintf("%d.%s", m.Version, name)
+	}
+	limit := int64(maxMetadataSize)
+	if m.Length > 0 {
+		limit = m.Length
+	}
+	b, err := s.fetch(ctx, name, limit)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkFile(b, m.Length, m.Hashes); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return b, nil
+}
+
+func (s *Source) fetch(ctx context.Context, name string, limit int64) ([]byte, error) {
+	resp, err := s.do(ctx, strings.TrimSuffix(s.MetadataURL, "/")+"/"+name)
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", name, err)
+	}
+	if int64(len(b)) > limit {
+		return nil, fmt.Errorf("%w: %s exceeds %d bytes", ErrVerification, name, limit)
+	}
+	return b, nil
+}
+
+func (s *Source) do(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden:
+		resp.Body.Close()
+		return nil, errNotFound
+	case resp.StatusCode != http.StatusOK:
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp, nil
+}
+
+// loadTrusted decodes the trusted metadata of roleName into v, if it still
+// verifies with root.
+func (s *Source) loadTrusted(roleName string, root *rootMeta, v any) bool {
+	b := s.load(roleName)
+	return b != nil && parseSigned(b, roleName, root, v) == nil
+}
+
+func (s *Source) load(roleName string) []byte {
+	if s.CacheDir == "" {
+		return s.trusted[roleName]
+	}
+	b, err := os.ReadFile(filepath.Join(s.CacheDir, roleName+".json"))
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+func (s *Source) save(roleName string, b []byte) {
+	if s.CacheDir == "" {
+		if s.trusted == nil {
+			s.trusted = map[string][]byte{}
+		}
+		s.trusted[roleName] = b
+		return
+	}
+	if err := os.MkdirAll(s.CacheDir, 0o755); err == nil {
+		_ = os.WriteFile(filepath.Join(s.CacheDir, roleName+".json"), b, 0o644)
+	}
+}
+
+func (s *Source) drop(roleNames ...string) {
+	for _, r := range roleNames {
+		if s.CacheDir == "" {
+			delete(s.trusted, r)
+			continue
+		}
+		_ = os.Remove(filepath.Join(s.CacheDir, r+".json"))
+	}
+}
@@ -0,0 +1,330 @@
+package tuf_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/napalu/gosafedate/self"
+	"github.com/napalu/gosafedate/self/source/tuf"
+)
+
+const target = "myapp/linux-amd64/myapp.gz"
+
+// repo is a consistent snapshot TUF repository served over HTTP.
+type repo struct {
+	t       *testing.T
+	srv     *httptest.Server
+	files   map[string][]byte
+	root    ed25519.PrivateKey
+	online  ed25519.PrivateKey // timestamp, snapshot and targets
+	expires time.Time
+}
+
+func newRepo(t *testing.T) *repo {
+	t.Helper()
+	r := &repo{t: t, files: map[string][]byte{}, root: newKey(t), online: newKey(t), expires: time.Now().Add(time.Hour)}
+	r.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		b, ok := r.files[strings.TrimPrefix(req.URL.Path, "/")]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		_, _ = w.Write(b)
+	}))
+	t.Cleanup(r.srv.Close)
+	return r
+}
+
+func newKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return priv
+}
+
+func keyID(priv ed25519.PrivateKey) string {
+	return hex.EncodeToString(priv.Public().(ed25519.PublicKey))
+}
+
+// sign wraps signed in a metadata envelope signed by privs. Go's JSON
+// encoding of maps of ASCII strings and integers is canonical.
+func (r *repo) sign(signed map[string]any, privs ...ed25519.PrivateKey) []byte {
+	r.t.Helper()
+	msg, err := json.Marshal(signed)
+	if err != nil {
+		r.t.Fatalf("marshal: %v", err)
+	}
+	sigs := []map[string]string{}
+	for _, priv := range privs {
+		sigs = append(sigs, map[string]string{"keyid": keyID(priv), "sig": hex.EncodeToString(ed25519.Sign(priv, msg))})
+	}
+	b, err := json.MarshalIndent(map[string]any{"signed": signed, "signatures": sigs}, "", "  ")
+	if err != nil {
+		r.t.Fatalf("marshal: %v", err)
+	}
+	return b
+}
+
+func (r *repo) rootMeta(version int, rootKey ed25519.PrivateKey) map[string]any {
+	keys := map[string]any{}
+	for _, priv := range []ed25519.PrivateKey{rootKey, r.online} {
+		keys[keyID(priv)] = map[string]any{
+			"keytype": "ed25519",
+			"scheme":  "ed25519",
+			"keyval":  map[string]string{"public": keyID(priv)},
+		}
+	}
+	roles := map[string]any{"root": map[string]any{"keyids": []string{keyID(rootKey)}, "threshold": 1}}
+	for _, name := range []string{"timestamp", "snapshot", "targets"} {
+		roles[name] = map[string]any{"keyids": []string{keyID(r.online)}, "threshold": 1}
+	}
+	return map[string]any{
+		"_type":               "root",
+		"spec_version":        "1.0.31",
+		"version":             version,
+		"expires":             r.expires.UTC().Format(time.RFC3339),
+		"consistent_snapshot": true,
+		"keys":                keys,
+		"roles":               roles,
+	}
+}
+
+func fileMeta(version int, b []byte) map[string]any {
+	return map[string]any{
+		"version": version,
+		"length":  len(b),
+		"hashes":  map[string]string{"sha256": fmt.Sprintf("%x", sha256.Sum256(b))},
+	}
+}
+
+// publish publishes data as target with version v of the online metadata.
+func (r *repo) publish(v int, release string, data []byte, binSum string) {
+	sum := fmt.Sprintf("%x", sha256.Sum256(data))
+	r.files["targets/myapp/linux-amd64/"+sum+".myapp.gz"] = data
+
+	targets := r.sign(map[string]any{
+		"_type":        "targets",
+		"spec_version": "1.0.31",
+		"version":      v,
+		"expires":      r.expires.UTC().Format(time.RFC3339),
+		"targets": map[string]any{
+			target: map[string]any{
+				"length": len(data),
+				"hashes": map[string]string{"sha256": sum},
+				"custom": map[string]any{"version": release, "sha256": binSum, "compression": "gzip"},
+			},
+		},
+	}, r.online)
+	r.files[fmt.Sprintf("metadata/%d.targets.json", v)] = targets
+
+	snapshot := r.sign(map[string]any{
+		"_type":        "snapshot",
+		"spec_version": "1.0.31",
+		"version":      v,
+		"expires":      r.expires.UTC().Format(time.RFC3339),
+		"meta":         map[string]any{"targets.json": fileMeta(v, targets)},
+	}, r.online)
+	r.files[fmt.Sprintf("metadata/%d.snapshot.json", v)] = snapshot
+
+	r.files["metadata/timestamp.json"] = r.sign(map[string]any{
+		"_type":        "timestamp",
+		"spec_version": "1.0.31",
+		"version":      v,
+		"expires":      r.expires.UTC().Format(time.RFC3339),
+		"meta":         map[string]any{"snapshot.json": fileMeta(v, snapshot)},
+	}, r.online)
+}
+
+func (r *repo) source(trustedRoot []byte, cacheDir string) *tuf.Source {
+	return &tuf.Source{
+		MetadataURL: r.srv.URL + "/metadata",
+		TargetsURL:  r.srv.URL + "/targets",
+		Root:        trustedRoot,
+		Target:      target,
+		CacheDir:    cacheDir,
+	}
+}
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func fetchMetadata(src *tuf.Source) error {
+	rc, err := src.FetchMetadata(context.Background())
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, rc)
+	return rc.Close()
+}
+
+func TestSource_UpdateWithRootRotation(t *testing.T) {
+	r := newRepo(t)
+	root1 := r.sign(r.rootMeta(1, r.root), r.root)
+	r.files["metadata/1.root.json"] = root1
+
+	// rotate the root key: version 2 is signed by the old and the new key
+	oldRoot := r.root
+	r.root = newKey(t)
+	r.files["metadata/2.root.json"] = r.sign(r.rootMeta(2, r.root), oldRoot, r.root)
+
+	newData := []byte("new-binary")
+	r.publish(1, "v1.2.4", gzipBytes(t, newData), fmt.Sprintf("%x", sha256.Sum256(newData)))
+
+	dir := t.TempDir()
+	currPath := filepath.Join(dir, "myapp")
+	if err := os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write temp exe: %v", err)
+	}
+
+	err := self.UpdateIfNewer(self.Config{
+		Source:     r.source(root1, filepath.Join(dir, "tuf")),
+		CurrentVer: "v1.2.3",
+		TargetPath: currPath,
+	})
+	if err != nil {
+		t.Fatalf("UpdateIfNewer: %v", err)
+	}
+
+	got, err := os.ReadFile(currPath)
+	if err != nil {
+		t.Fatalf("read updated exe: %v", err)
+	}
+	if !bytes.Equal(got, newData) {
+		t.Fatalf("binary not updated: got %q", got)
+	}
+
+	cached, err := os.ReadFile(filepath.Join(dir, "tuf", "root.json"))
+	if err != nil || !bytes.Equal(cached, r.files["metadata/2.root.json"]) {
+		t.Fatalf("rotated root not cached: %v", err)
+	}
+}
+
+func TestSource_Verification(t *testing.T) {
+	newData := []byte("new-binary")
+	binSum := fmt.Sprintf("%x", sha256.Sum256(newData))
+
+	tests := []struct {
+		name    string
+		setup   func(r *repo, src *tuf.Source)
+		wantErr error
+	}{
+		{
+			name:    "valid",
+			setup:   func(r *repo, src *tuf.Source) {},
+			wantErr: nil,
+		},
+		{
+			name: "rollback",
+			setup: func(r *repo, src *tuf.Source) {
+				timestamp := r.files["metadata/timestamp.json"]
+				r.publish(2, "v1.2.5", gzipBytes(t, newData), binSum)
+				if err := fetchMetadata(src); err != nil {
+					t.Fatalf("FetchMetadata: %v", err)
+				}
+				r.files["metadata/timestamp.json"] = timestamp
+			},
+			wantErr: tuf.ErrRollback,
+		},
+		{
+			name: "expired",
+			setup: func(r *repo, src *tuf.Source) {
+				r.expires = time.Now().Add(-time.Minute)
+				r.publish(1, "v1.2.4", gzipBytes(t, newData), binSum)
+			},
+			wantErr: tuf.ErrExpired,
+		},
+		{
+			name: "untrusted key",
+			setup: func(r *repo, src *tuf.Source) {
+				r.online = newKey(t)
+				r.publish(1, "v1.2.4", gzipBytes(t, newData), binSum)
+			},
+			wantErr: tuf.ErrVerification,
+		},
+		{
+			name: "tampered snapshot",
+			setup: func(r *repo, src *tuf.Source) {
+				r.files["metadata/1.snapshot.json"] = append(r.files["metadata/1.snapshot.json"], ' ')
+			},
+			wantErr: tuf.ErrVerification,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRepo(t)
+			root := r.sign(r.rootMeta(1, r.root), r.root)
+			r.files["metadata/1.root.json"] = root
+			r.publish(1, "v1.2.4", gzipBytes(t, newData), binSum)
+
+			src := r.source(root, t.TempDir())
+			tt.setup(r, src)
+
+			err := fetchMetadata(src)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("FetchMetadata error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSource_TamperedTarget(t *testing.T) {
+	r := newRepo(t)
+	root := r.sign(r.rootMeta(1, r.root), r.root)
+	r.files["metadata/1.root.json"] = root
+
+	newData := []byte("new-binary")
+	gz := gzipBytes(t, newData)
+	r.publish(1, "v1.2.4", gz, fmt.Sprintf("%x", sha256.Sum256(newData)))
+
+	src := r.source(root, "")
+	rc, err := src.FetchMetadata(context.Background())
+	if err != nil {
+		t.Fatalf("FetchMetadata: %v", err)
+	}
+	var m struct {
+		DownloadURL string `json:"downloadUrl"`
+	}
+	err = json.NewDecoder(rc).Decode(&m)
+	_ = rc.Close()
+	if err != nil {
+		t.Fatalf("decode metadata: %v", err)
+	}
+
+	path := strings.TrimPrefix(m.DownloadURL, r.srv.URL+"/")
+	r.files[path] = append(bytes.Clone(gz[:len(gz)-1]), gz[len(gz)-1]^1)
+	if err = src.FetchArtifact(context.Background(), m.DownloadURL, io.Discard); !errors.Is(err, tuf.ErrVerification) {
+		t.Fatalf("FetchArtifact error = %v, want %v", err, tuf.ErrVerification)
+	}
+
+	if err = src.FetchArtifact(context.Background(), r.srv.URL+"/targets/other", io.Discard); err == nil {
+		t.Fatal("FetchArtifact of an unlisted URL succeeded")
+	}
+}
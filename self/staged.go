@@ -0,0 +1,257 @@
+package self
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/napalu/gosafedate/metadata"
+)
+
+// StagedUpdate is a downloaded and verified update waiting to be applied.
+type StagedUpdate struct {
+	Metadata *metadata.Metadata
+	Path     string // the verified binary, or the staging directory of a bundle
+
+	cfg        Config
+	target     string
+	installDir string             // bundles only
+	manifest   *metadata.Manifest // bundles only
+}
+
+// Download fetches and verifies the update described by m without
+// installing it, so that Apply can swap it in at a convenient moment, e.g. on
+// shutdown. It returns nil if m is the current version.
+func Download(cfg Config, m *metadata.Metadata) (*StagedUpdate, error) {
+	return New(cfg).Download(m)
+}
+
+// Apply installs a staged update, re-checking its checksum first, and
+// restarts if AutoRestart is set. A nil update is a no-op.
+func Apply(s *StagedUpdate) error {
+	if s == nil {
+		return nil
+	}
+	return apply(s, time.Now())
+}
+
+// Discard removes a staged update which won't be applied.
+func (s *StagedUpdate) Discard() error {
+	return os.RemoveAll(s.Path)
+}
+
+// download fetches, unpacks and verifies the update described by m.
+func download(cfg Config, m *metadata.Metadata) (*StagedUpdate, error) {
+	logInfo, logError := normalizeLogs(cfg)
+	logInfo("updating from %s to %s", cfg.CurrentVer, m.Version)
+
+	currPath, err := targetPath(cfg)
+	if err != nil {
+		logError("failed to determine current executable path: %v", err)
+		return nil, err
+	}
+	if err = CleanupArtifacts(cfg); err != nil {
+		warnLog(cfg, logError)("failed to clean up stale artifacts: %v", err)
+	}
+	if err = checkDetached(cfg); err != nil {
+		logError("failed to verify signature: %v", err)
+		cfg.Metrics.verify(m.Version, err)
+		return nil, err
+	}
+	if cfg, err = withReleaseKeys(cfg, currPath, warnLog(cfg, logError)); err != nil {
+		logError("failed to load release keys: %v", err)
+		return nil, err
+	}
+	if helperInstalls(cfg, m) && sidecarSigned(cfg, m) {
+		// the helper re-verifies the binary once the app has exited, and
+		// only the download is signed
+		err = errors.New("updates installed by the update helper require an inline signature")
+		logError("failed to verify signature: %v", err)
+		return nil, err
+	}
+
+	if err = checkDiskSpace(m.Size, workDir(cfg, currPath), filepath.Dir(currPath)); err != nil {
+		logError("failed disk space check: %v", err)
+		return nil, err
+	}
+
+	resolvedURL, err := resolveURL(cfg.URL, m.DownloadURL, m.Version)
+	if err != nil {
+		logError("failed to resolve download URL: %v", err)
+		return nil, err
+	}
+
+	curFile := filepath.Base(currPath)
+	newFile := filepath.Join(workDir(cfg, currPath), fmt.Sprintf("%s-%s%s", curFile, m.Version, newSuffix))
+
+	if m.Bundle {
+		a, err := downloadArtifact(cfg, m, currPath, resolvedURL, newFile, logInfo, warnLog(cfg, logError))
+		if err != nil {
+			logError("failed to download update: %v", err)
+			return nil, err
+		}
+		defer os.Remove(a.path)
+		if err = verifyDownload(cfg, m, resolvedURL, a.path, logInfo); err != nil {
+			logError("failed to verify signature: %v", err)
+			return nil, err
+		}
+
+		staging, installDir, manifest, err := stageBundle(cfg, m, currPath, a.path, a.arch, a.comp.fn, logInfo)
+		if err != nil {
+			logError("failed to stage bundle: %v", err)
+			return nil, err
+		}
+		return &StagedUpdate{Metadata: m, Path: staging, cfg: cfg, target: currPath, installDir: installDir, manifest: manifest}, nil
+	}
+
+	patched := false
+	if p := patchFor(m, cfg.CurrentVer); p != nil && !sidecarSigned(cfg, m) {
+		logInfo("applying delta update from %s", p.FromVersion)
+		if err = applyDelta(cfg, m, p, currPath, newFile, warnLog(cfg, logError)); err != nil {
+			warnLog(cfg, logError)("delta update failed, falling back to full download: %v", err)
+		} else {
+			patched = true
+		}
+	}
+
+	if !patched {
+		a, err := downloadArtifact(cfg, m, currPath, resolvedURL, newFile, logInfo, warnLog(cfg, logError))
+		if err != nil {
+			logError("failed to download update: %v", err)
+			return nil, err
+		}
+		if a.path != newFile { // uncompressed binaries are downloaded in place
+			defer os.Remove(a.path)
+		}
+		if err = verifyDownload(cfg, m, resolvedURL, a.path, logInfo); err != nil {
+			logError("failed to verify signature: %v", err)
+			_ = os.Remove(newFile)
+			return nil, err
+		}
+
+		if err = a.unpack(cfg, currPath, newFile, logInfo); err != nil {
+			logError("failed to unpack update: %v", err)
+			return nil, err
+		}
+	}
+
+	logInfo("verifying checksum")
+	err = verifyChecksum(newFile, m.Checksum)
+	if err != nil {
+		logError("failed to verify checksum: %v", err)
+		cfg.Metrics.verify(m.Version, err)
+		_ = os.Remove(newFile)
+		return nil, err
+	}
+
+	if cfg.hasKeys() && !sidecarSigned(cfg, m) {
+		logInfo("verifying signature")
+		if err = verifySignature(cfg, m); err != nil {
+			logError("failed to verify signature: %v", err)
+			cfg.Metrics.verify(m.Version, err)
+			_ = os.Remove(newFile)
+			return nil, err
+		}
+	}
+	cfg.Metrics.verify(m.Version, nil)
+
+	return &StagedUpdate{Metadata: m, Path: newFile, cfg: cfg, target: currPath}, nil
+}
+
+// apply installs s and finishes the update; start is reported as the
+// beginning of the install.
+func apply(s *StagedUpdate, start time.Time) error {
+	cfg := s.cfg
+	logInfo, logError := normalizeLogs(cfg)
+
+	// the installed update supersedes one staged for the next start, which
+	// would otherwise replace it again
+	discardStartupUpdate(s.target)
+
+	restartFn, err := s.install(logInfo, logError)
+	cfg.Metrics.install(s.Metadata.Version, time.Since(start), err)
+	if err != nil {
+		return err
+	}
+	return finishUpdate(cfg, s.target, restartFn, logInfo, logError)
+}
+
+// install swaps s into place and returns how to restart it.
+func (s *StagedUpdate) install(logInfo, logError LogFunc) (func(Config, string) error, error) {
+	cfg, m := s.cfg, s.Metadata
+	defer s.Discard() // no-op once moved into place
+
+	if s.manifest != nil {
+		// the staging directory may have been tampered with since Download
+		if _, err := verifyBundle(cfg, m, s.Path); err != nil {
+			logError("staged bundle changed since download: %v", err)
+			return nil, err
+		}
+
+		logInfo("installing %d bundle files into %s", len(s.manifest.Files), s.installDir)
+		if err := swapFiles(cfg, s.Path, s.installDir, s.manifest.Files); err != nil {
+			logError("failed to install bundle: %v", err)
+			cfg.Metrics.rollback(m.Version, err)
+			return nil, err
+		}
+		return restartReplaced, nil
+	}
+
+	if err := verifyChecksum(s.Path, m.Checksum); err != nil {
+		logError("staged update changed since download: %v", err)
+		return nil, err
+	}
+
+	if cfg.Applier != nil {
+		logInfo("installing %s", m.Version)
+		path, err := cfg.Applier.Apply(s.Path, m)
+		if err != nil {
+			logError("failed to install: %v", err)
+			return nil, err
+		}
+		return func(cfg Config, _ string) error { return restartReplaced(cfg, path) }, nil
+	}
+
+	oldInfo, err := os.Stat(s.target)
+	if cfg.Managed && errors.Is(err, os.ErrNotExist) {
+		// first install of a managed binary
+		logInfo("installing %s to %s", m.Version, s.target)
+		if err = replaceBinary(cfg, s.target, s.Path, m); err != nil {
+			logError("failed to install: %v", err)
+			return nil, err
+		}
+		if err = restorePermissions(s.target, 0o755); err != nil {
+			logError("failed to make file executable: %v", err)
+		}
+		return restartBinary, nil
+	}
+	if err != nil {
+		logError("failed to stat current executable: %v", err)
+		return nil, err
+	}
+	oldMode := oldInfo.Mode()
+
+	// before the swap, so chown can't clear copied capabilities
+	if err = restoreOwner(s.Path, oldInfo); err != nil {
+		logError("failed to restore ownership: %v", err)
+	}
+	if cfg.PreserveAttrs {
+		if err = copyAttributes(s.target, s.Path); err != nil {
+			logError("failed to preserve file attributes: %v", err)
+			return nil, err
+		}
+	}
+
+	if err = replaceBinary(cfg, s.target, s.Path, m); err != nil {
+		logError("failed to update: %v", err)
+		return nil, err
+	}
+
+	if err = restorePermissions(s.target, oldMode); err != nil {
+		logError("failed to make file executable: %v", err)
+	}
+
+	return restartBinary, nil
+}
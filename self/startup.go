@@ -0,0 +1,156 @@
+package self
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/napalu/gosafedate/metadata"
+)
+
+// stageForStartup moves the verified binary of s next to the target as
+// "<target>.new", with its metadata in "<target>.new.meta", for
+// ApplyPendingAtStartup.
+func stageForStartup(s *StagedUpdate) error {
+	if s.manifest != nil {
+		_ = s.Discard()
+		return errors.New("bundle updates can't be applied at startup")
+	}
+
+	newPath := s.target + newSuffix
+	metaPath := newPath + metaSuffix
+
+	info, err := os.Stat(s.target)
+	if err != nil {
+		return err
+	}
+
+	if err = os.Rename(s.Path, newPath); err != nil {
+		if err = copyToSibling(s.Path, newPath); err != nil {
+			return err
+		}
+		_ = s.Discard()
+	}
+	if err = restoreOwner(newPath, info); err != nil {
+		return err
+	}
+	if err = os.Chmod(newPath, info.Mode()); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(s.Metadata)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(metaPath, b, 0o600)
+}
+
+// stagedForStartup returns the metadata of the update staged for target with
+// OnNextStart, or nil if there is none or it has expired: its metadata is
+// unreadable, the binary doesn't match its checksum, or it isn't newer than
+// cfg.CurrentVer.
+func stagedForStartup(cfg Config, target string) *metadata.Metadata {
+	newPath := target + newSuffix
+	b, err := os.ReadFile(newPath + metaSuffix)
+	if err != nil {
+		return nil
+	}
+	var m metadata.Metadata
+	if err = json.Unmarshal(b, &m); err != nil || m.Checksum == "" {
+		return nil
+	}
+	if verifyChecksum(newPath, m.Checksum) != nil {
+		return nil
+	}
+	if cfg.CurrentVer != "" {
+		cmp, err := cfg.compareVersions(m.Version, cfg.CurrentVer)
+		if err != nil && m.Version == cfg.CurrentVer || err == nil && cmp <= 0 {
+			return nil
+		}
+	}
+	return &m
+}
+
+// isStagedForStartup reports whether version is already staged with
+// OnNextStart.
+func isStagedForStartup(cfg Config, version string) bool {
+	target, err := targetPath(cfg)
+	if err != nil {
+		return false
+	}
+	m := stagedForStartup(cfg, target)
+	return m != nil && sameVersion(cfg, m.Version, version)
+}
+
+// discardStartupUpdate removes the update staged for target with
+// OnNextStart, if any.
+func discardStartupUpdate(target string) {
+	_ = os.Remove(target + newSuffix + metaSuffix)
+	_ = os.Remove(target + newSuffix)
+}
+
+// ApplyPendingAtStartup installs an update staged with OnNextStart. Call it
+// early in main(): if "<exe>.new" and its metadata exist, the checksum and
+// the signature are verified against pubKey, the new binary replaces the
+// executable and is started with the original arguments. On success it
+// doesn't return. Without a staged update it returns nil; an invalid staged
+// update is removed and reported, and the current binary keeps running.
+// With a key manifest (see Config.RootKey), pass the root key: the release
+// keys of the cached manifest are accepted as well.
+func ApplyPendingAtStartup(pubKey []byte) error {
+	exe, err := executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.Abs(exe); err != nil {
+		return err
+	}
+	if strings.HasSuffix(exe, newSuffix) {
+		return nil // running as the Windows update helper
+	}
+
+	newPath := exe + newSuffix
+	metaPath := newPath + metaSuffix
+
+	b, err := os.ReadFile(metaPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	discard := func(err error) error {
+		_ = os.Remove(newPath)
+		_ = os.Remove(metaPath)
+		return fmt.Errorf("staged update: %w", err)
+	}
+
+	var m metadata.Metadata
+	if err = json.Unmarshal(b, &m); err != nil {
+		return discard(err)
+	}
+	if len(pubKey) == 0 {
+		return discard(errors.New("public key required"))
+	}
+	if err = verifyChecksum(newPath, m.Checksum); err != nil {
+		return discard(err)
+	}
+	if err = verifySignature(Config{PubKeys: trustedKeys(pubKey, exe)}, &m); err != nil {
+		return discard(err)
+	}
+
+	if err = swapRunning(exe, newPath); err != nil {
+		return discard(err)
+	}
+	_ = os.Remove(metaPath)
+
+	if err = restartReplaced(Config{}, exe); err != nil {
+		return err
+	}
+	os.Exit(0)
+	return nil
+}
@@ -0,0 +1,85 @@
+package self
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/napalu/gosafedate/metadata"
+)
+
+const stateSuffix = ".state"
+
+// state is persisted next to the target between runs. It records the
+// outcome of the last update check so that callers invoking the updater on
+// every startup don't hit the metadata endpoint each time, and the cache
+// validators of the metadata for conditional requests.
+type state struct {
+	URL           string             `json:"url,omitempty"`
+	LastCheck     time.Time          `json:"lastCheck"`
+	Metadata      *metadata.Metadata `json:"metadata,omitempty"`
+	ETag          string             `json:"etag,omitempty"`
+	LastModified  string             `json:"lastModified,omitempty"`
+	Skipped       []string           `json:"skipped,omitempty"` // versions ignored by HasNewer
+	SnoozeUntil   time.Time          `json:"snoozeUntil,omitzero"`
+	SnoozeVersion string             `json:"snoozeVersion,omitempty"` // if set: only this version is snoozed
+}
+
+// useState reports whether update checks are recorded in the state file.
+func (c Config) useState() bool {
+	return c.MinCheckInterval > 0 || c.StatePath != ""
+}
+
+func statePath(cfg Config) (string, error) {
+	if cfg.StatePath != "" {
+		return cfg.StatePath, nil
+	}
+	path, err := targetPath(cfg)
+	if err != nil {
+		return "", err
+	}
+	return path + stateSuffix, nil
+}
+
+// loadState reads the state file at path. A missing file yields an empty state.
+func loadState(path string) (*state, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &state{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var st state
+	if err = json.Unmarshal(b, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// saveState atomically writes st, a state or fleetState, to path.
+func saveState(path string, st any) error {
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,59 @@
+package self
+
+import (
+	"net"
+	"os"
+	"os/exec"
+)
+
+// Systemd restarts binaries running as systemd units through systemd
+// instead of re-executing them, so the unit's restart limits, dependencies
+// and sandboxing are respected. Outside systemd it behaves like ExecRestart.
+type Systemd struct {
+	// Unit is restarted with "systemctl restart". If empty, the process
+	// exits and leaves the restart to the unit's Restart= setting.
+	Unit string
+	// ExitCode is the exit status when Unit is empty. Use a non-zero value
+	// for units with Restart=on-failure.
+	ExitCode int
+}
+
+var systemctl = func(args ...string) error {
+	return exec.Command("systemctl", args...).Run()
+}
+
+// underSystemd reports whether the process was started by systemd.
+func underSystemd(getenv func(string) string) bool {
+	return getenv("INVOCATION_ID") != "" || getenv("NOTIFY_SOCKET") != ""
+}
+
+// Restart asks systemd to restart the process.
+func (s *Systemd) Restart(path string) error {
+	if !underSystemd(os.Getenv) {
+		return ExecRestart{}.Restart(path)
+	}
+	sdNotify("STOPPING=1\nSTATUS=restarting after update")
+	if s.Unit == "" {
+		if s.ExitCode != 0 {
+			os.Exit(s.ExitCode)
+		}
+		return nil
+	}
+	// --no-block: systemd stops this process only after the call returns
+	return systemctl("restart", "--no-block", s.Unit)
+}
+
+// sdNotify sends state to the service manager of Type=notify units, best
+// effort.
+func sdNotify(state string) {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return
+	}
+	conn, err := net.Dial("unixgram", addr)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	_, _ = conn.Write([]byte(state))
+}
@@ -0,0 +1,83 @@
+package self
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+
+	"github.com/napalu/gosafedate/metadata"
+	"github.com/napalu/gosafedate/signing"
+)
+
+// ErrInsufficientSignatures is returned when fewer keys than
+// Config.RequiredSignatures have signed a release.
+var ErrInsufficientSignatures = errors.New("not enough valid signatures")
+
+// signedBy is metadata.Metadata.Verify with verify in place of
+// signing.VerifyRaw, so the Windows helper's tests can replace it.
+func signedBy(verify func(pub []byte, data, sig string) (bool, error), pub []byte, m *metadata.Metadata) (bool, error) {
+	var firstErr error
+	for _, sig := range m.AllSignatures() {
+		ok, err := verify(pub, m.SigningMessage(), sig)
+		if ok {
+			return true, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return false, firstErr
+}
+
+// verifyThreshold checks that at least cfg.RequiredSignatures distinct keys
+// of cfg.PubKey and cfg.PubKeys have signed m, at least one.
+func verifyThreshold(cfg Config, m *metadata.Metadata) error {
+	return verifySigners(cfg, m.Verify)
+}
+
+// verifySigners is verifyThreshold for any document, verify reporting
+// whether a key has signed it.
+func verifySigners(cfg Config, verify func(pub []byte) (bool, error)) error {
+	keys := cfg.PubKeys
+	if len(cfg.PubKey) > 0 {
+		keys = append([][]byte{cfg.PubKey}, keys...)
+	}
+	required := max(cfg.RequiredSignatures, 1)
+
+	var signers []crypto.PublicKey
+	for _, k := range keys {
+		pub, err := signing.ParsePublicKey(k)
+		if err != nil {
+			return err
+		}
+		if containsKey(signers, pub) {
+			continue
+		}
+		ok, err := verify(k)
+		if err != nil && len(keys) == 1 {
+			return err
+		}
+		if ok {
+			signers = append(signers, pub)
+		}
+	}
+
+	if len(signers) < required {
+		return fmt.Errorf("signature verification failed: %w: %d of %d", ErrInsufficientSignatures, len(signers), required)
+	}
+	return nil
+}
+
+func containsKey(keys []crypto.PublicKey, pub crypto.PublicKey) bool {
+	for _, k := range keys {
+		if k.(interface{ Equal(crypto.PublicKey) bool }).Equal(pub) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasKeys reports whether cfg has a public key to verify inline signatures.
+func (c Config) hasKeys() bool {
+	return len(c.PubKey) > 0 || len(c.PubKeys) > 0
+}
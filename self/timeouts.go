@@ -0,0 +1,36 @@
+package self
+
+import (
+	"context"
+	"time"
+)
+
+// default timeouts, used when the corresponding Config field is 0
+const (
+	DefaultMetadataTimeout = 30 * time.Second
+	DefaultDownloadTimeout = 30 * time.Minute
+)
+
+func (c Config) metadataTimeout() time.Duration {
+	return timeoutOrDefault(c.MetadataTimeout, DefaultMetadataTimeout)
+}
+
+func (c Config) downloadTimeout() time.Duration {
+	return timeoutOrDefault(c.DownloadTimeout, DefaultDownloadTimeout)
+}
+
+func timeoutOrDefault(d, def time.Duration) time.Duration {
+	if d == 0 {
+		return def
+	}
+	return d
+}
+
+// withTimeout returns a context bounded by d; negative durations disable
+// the timeout.
+func withTimeout(d time.Duration) (context.Context, context.CancelFunc) {
+	if d < 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), d)
+}
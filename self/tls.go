@@ -0,0 +1,55 @@
+package self
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"slices"
+)
+
+// ErrPinMismatch is returned when no certificate presented by the server
+// matches TLSConfig.PinnedSPKI.
+var ErrPinMismatch = errors.New("server certificate does not match pinned keys")
+
+// TLSConfig hardens the TLS connections of the default HTTP source.
+type TLSConfig struct {
+	RootCAs      *x509.CertPool    // if nil: the system roots
+	Certificates []tls.Certificate // client certificates for mutual TLS
+
+	// PinnedSPKI lists base64-encoded SHA-256 hashes of acceptable subject
+	// public keys (as used by HPKP). If set, at least one certificate of the
+	// verified chain must match.
+	PinnedSPKI []string
+}
+
+// SPKIHash returns the pin of cert in the format of TLSConfig.PinnedSPKI.
+func SPKIHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func (t *TLSConfig) clientConfig() *tls.Config {
+	conf := &tls.Config{
+		RootCAs:      t.RootCAs,
+		Certificates: t.Certificates,
+		MinVersion:   tls.VersionTLS12,
+	}
+	if len(t.PinnedSPKI) > 0 {
+		conf.VerifyConnection = t.verifyPins
+	}
+	return conf
+}
+
+// verifyPins runs after regular chain verification.
+func (t *TLSConfig) verifyPins(cs tls.ConnectionState) error {
+	for _, chain := range cs.VerifiedChains {
+		for _, cert := range chain {
+			if slices.Contains(t.PinnedSPKI, SPKIHash(cert)) {
+				return nil
+			}
+		}
+	}
+	return ErrPinMismatch
+}
@@ -0,0 +1,21 @@
+package self
+
+import (
+	"errors"
+
+	"github.com/napalu/gosafedate/metadata"
+)
+
+// LogVerifier checks that the signature of a release was published in a
+// transparency log, so a release signed with a stolen key but kept out of
+// the public log, e.g. served to selected users only, is rejected. See
+// sigstore.Rekor.
+type LogVerifier interface {
+	// VerifyLogged verifies that m.Signature by pubKey is logged, usually
+	// by its m.TransparencyLog entry.
+	VerifyLogged(m *metadata.Metadata, pubKey []byte) error
+}
+
+// ErrNotLogged is returned when Config.TransparencyLog is set and the
+// release has no transparency log entry.
+var ErrNotLogged = errors.New("release signature not logged in the transparency log")
@@ -5,36 +5,111 @@
 package self
 
 import (
-	"compress/gzip"
-	"crypto/sha256"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"net/http"
+	"log/slog"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
 
+	"github.com/napalu/gosafedate/checksum"
 	"github.com/napalu/gosafedate/metadata"
-	"github.com/napalu/gosafedate/signing"
 	"github.com/napalu/gosafedate/version"
 )
 
 type Config struct {
-	AutoRestart bool
-	URL         string
-	PubKey      []byte
-	CurrentVer  string
-	TargetPath  string  // if empty: use os.Executable()
-	LogInfo     LogFunc // optional logger hook
-	LogError    LogFunc // optional logger hook
+	AutoRestart        bool
+	ApplyOn            ApplyMode // ApplyNow, OnExit or OnNextStart
+	URL                string
+	Mirrors            []string          // metadata URLs tried after URL, in order of health
+	Source             Source            // if nil: an HTTPSource for URL
+	Headers            map[string]string // extra HTTP request headers, e.g. for API keys
+	AuthToken          string            // if set: sent as "Authorization: Bearer <token>"
+	TLS                *TLSConfig        // custom CAs, client certificates and key pinning
+	DownloadChunks     int               // if > 1: download large artifacts in this many parallel ranges
+	ProxyURL           string            // http://, https:// or socks5:// proxy, optionally with user:pass@; if empty: the environment
+	MetadataTimeout    time.Duration     // if 0: DefaultMetadataTimeout; if < 0: none
+	DownloadTimeout    time.Duration     // per artifact; if 0: DefaultDownloadTimeout; if < 0: none
+	PubKey             []byte            // raw Ed25519 key, DER encoded ECDSA P-256/RSA key (see signing.VerifyRaw), or minisign key
+	PubKeys            [][]byte          // further release keys, see RequiredSignatures
+	RootKey            []byte            // if set: PubKey and PubKeys are replaced by the keys of the key manifest at RootURL signed by RootKey
+	RootURL            string            // key manifest (metadata.Root), cached next to TargetPath
+	RequiredSignatures int               // if > 1: this many distinct keys of PubKey and PubKeys must have signed a release
+	TransparencyLog    LogVerifier       // if set: inline signatures must be logged, e.g. sigstore.Rekor
+	Verifier           ArtifactVerifier  // verifies artifacts against a detached signature instead of PubKey, e.g. sigstore.Verifier
+	DetachedSignatures bool              // accept releases without an inline signature whose artifact PubKey signed in a .sig or .minisig file; their version isn't signed
+	CurrentVer         string            // version of TargetPath; if both are empty: version.FromBuildInfo()
+	TargetPath         string            // if empty: use os.Executable()
+	Managed            bool              // TargetPath is another binary: replaced directly, never restarted, installed if missing
+	AllowDowngrade     bool              // UpdateTo may install a version older than CurrentVer
+	AllowPrerelease    bool              // offer pre-release versions, e.g. v1.3.0-rc.1, for a beta channel
+	DevVersionPolicy   DevVersionPolicy  // how development builds are treated; if zero: DevSkip
+	VersionScheme      VersionScheme     // how versions are compared; if zero: SemVer
+	VersionComparator  VersionComparator // if set: compares versions instead of VersionScheme
+	StatePath          string            // if set, checks are recorded even without MinCheckInterval; if empty: TargetPath + ".state"
+	WorkDir            string            // download directory; if empty: the directory of TargetPath
+	MaxMetadataSize    int64             // if 0: DefaultMaxMetadataSize
+	MaxDownloadSize    int64             // if 0: DefaultMaxDownloadSize
+	MaxBinarySize      int64             // decompressed size; if 0: DefaultMaxBinarySize
+	BinaryName         string            // archive entry (glob) to install; if empty: base name of TargetPath
+	BundleDir          string            // install directory of bundle artifacts; if empty: the directory of TargetPath
+	MinCheckInterval   time.Duration     // if > 0: HasNewer reuses the last result within this interval
+	LogInfo            LogFunc           // optional logger hook
+	LogError           LogFunc           // optional logger hook
+	Logger             *slog.Logger      // structured logging; also receives the messages of nil LogInfo/LogError hooks
+	Metrics            *Metrics          // optional telemetry hooks
+	Progress           ProgressFunc      // optional download progress hook
+	Restarter          Restarter         // how AutoRestart restarts; if nil: ExecRestart
+	Applier            Applier           // installs the binary instead of replacing TargetPath, e.g. Versioned or Slots
+	PreserveAttrs      bool              // Linux only: copy extended attributes (capabilities, SELinux context) of the old binary
+	Elevate            bool              // Windows only: relaunch the update helper elevated (UAC) if the install directory isn't writable
+	HelperRetry        HelperRetry       // Windows only: how long the update helper waits for the old executable
+	ServiceName        string            // Windows only: service hosting the binary, stopped and started by the update helper
+	HelperLogFile      string            // Windows only: file the update helper appends its progress to
+	HelperEventSource  string            // Windows only: Event Log source the update helper reports to
+
+	updater *Updater // set by New
 }
 
 type LogFunc func(string, ...interface{})
 
-var httpGet = http.Get
+// ProgressFunc is called as an artifact downloads, with the bytes written so
+// far and the total: the metadata size, else the Content-Length, else -1.
+// Parallel downloads call it from several goroutines, one at a time.
+type ProgressFunc func(downloaded, total int64)
+
+// suffixes of the artifacts written next to the target during an update
+const (
+	newSuffix  = ".new"
+	metaSuffix = ".meta"
+	partSuffix = ".part"
+	bakSuffix  = ".bak"
+)
+
+// ErrInsufficientSpace is returned when the work or target directory does not
+// have enough free space for the download and its decompressed binary.
+var ErrInsufficientSpace = errors.New("insufficient disk space")
+
+// ErrNeedsElevation is returned on Windows when the install directory isn't
+// writable and Config.Elevate is unset, or the UAC prompt was declined.
+var ErrNeedsElevation = errors.New("elevation required")
+
+// ErrChecksumMismatch is returned when a download or binary doesn't match
+// the checksum of its metadata.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// ErrSizeMismatch is returned when a download doesn't have the size of its
+// metadata.
+var ErrSizeMismatch = errors.New("size mismatch")
+
+// spaceSafetyFactor is applied to metadata.Size to account for the compressed
+// download, the decompressed binary and filesystem overhead.
+const spaceSafetyFactor = 4
+
 var execSelf = syscall.Exec
 var executable = os.Executable
 var rename = os.Rename
@@ -43,28 +118,43 @@ var rename = os.Rename
 // than cfg.CurrentVer is available. If true, it also returns the
 // parsed metadata used for the decision.
 func HasNewer(cfg Config) (bool, *metadata.Metadata, error) {
+	return New(cfg).Check()
+}
+
+func hasNewer(cfg Config) (bool, *metadata.Metadata, error) {
 	logInfo, logError := normalizeLogs(cfg)
 	logInfo("checking for updates...")
 
-	if cfg.URL == "" {
+	if cfg.URL == "" && cfg.Source == nil {
 		logInfo("no update URL found - can't check")
 		return false, nil, nil
 	}
 
-	m, err := fetchMetadata(cfg.URL)
+	start := time.Now()
+	m, err := checkMetadata(cfg, logInfo, logError)
 	if err != nil {
 		logError("failed to fetch metadata: %v", err)
+		cfg.Metrics.check(time.Since(start), false, err)
 		return false, nil, err
 	}
 
-	newer, err := shouldUpdate(cfg.CurrentVer, m)
+	newer, reason, err := cfg.isNewer(m)
+	if newer {
+		if s := suppressed(cfg, m); s != "" {
+			logInfo("version %s is %s", m.Version, s)
+			newer = false
+		}
+	}
+	cfg.Metrics.check(time.Since(start), newer, err)
 	if err != nil {
 		logError("failed to determine if we should update version: %v", err)
 		return false, nil, err
 	}
+	cfg.logger().Debug("update check", "url", cfg.URL, "current", cfg.CurrentVer,
+		"version", m.Version, "newer", newer, "duration", time.Since(start))
 
-	if !newer {
-		logInfo("no new version found - skipping update")
+	if !newer && reason != "" {
+		logInfo("no new version found - skipping update (%s)", reason)
 	}
 
 	return newer, m, nil
@@ -75,142 +165,231 @@ func HasNewer(cfg Config) (bool, *metadata.Metadata, error) {
 // executable and, if AutoRestart is true, re-executes the process.
 // If already up to date, it simply returns nil.
 func UpdateIfNewer(cfg Config) error {
-	newer, m, err := HasNewer(cfg)
-	if err != nil || !newer {
+	return New(cfg).UpdateIfNewer()
+}
+
+// UpdateFromDir is UpdateIfNewer for a local release directory containing
+// metadata.json and the artifacts it references, e.g. a mounted USB drive.
+// Checksums and signatures are verified exactly as for remote updates.
+func UpdateFromDir(cfg Config, dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
 		return err
 	}
 
-	return UpdateFromMetadata(cfg, m)
+	cfg.URL = fileURL(filepath.Join(abs, "metadata.json"))
+	cfg.Source = &FileSource{URL: cfg.URL}
+	return UpdateIfNewer(cfg)
 }
 
 // UpdateFromMetadata atomically replaces the current executable with a new
 // version downloaded from the provided metadata URL.
 func UpdateFromMetadata(cfg Config, m *metadata.Metadata) error {
-	var err error
-	logInfo, logError := normalizeLogs(cfg)
+	return New(cfg).Update(m)
+}
 
+func updateFromMetadata(cfg Config, m *metadata.Metadata) error {
 	if m == nil || cfg.CurrentVer == m.Version {
 		return nil
 	}
+	if cfg.Managed && cfg.ApplyOn == OnNextStart {
+		return errors.New("managed binaries can't be installed at startup")
+	}
+	if cfg.ApplyOn == OnNextStart && sidecarSigned(cfg, m) {
+		// only the download is signed, not the staged binary
+		return errors.New("updates installed at startup require an inline signature")
+	}
+	if cfg.TransparencyLog != nil && sidecarSigned(cfg, m) && cfg.Verifier == nil {
+		return errors.New("transparency log verification requires an inline signature")
+	}
 
-	logInfo("updating from %s to %s", cfg.CurrentVer, m.Version)
+	if cfg.ApplyOn == OnExit && isPending(cfg, m.Version) {
+		return nil
+	}
+	if cfg.ApplyOn == OnNextStart && isStagedForStartup(cfg, m.Version) {
+		return nil
+	}
 
-	var currPath string
-	if cfg.TargetPath != "" {
-		currPath = cfg.TargetPath
-	} else {
-		currPath, err = executable()
-		if err != nil {
-			logError("failed to determine current executable path: %v", err)
+	start := time.Now()
+	s, err := download(cfg, m)
+	if err != nil {
+		cfg.Metrics.install(m.Version, time.Since(start), err)
+		return err
+	}
+
+	if cfg.ApplyOn == OnExit {
+		logInfo, _ := normalizeLogs(cfg)
+		setPending(s)
+		logInfo("update to %s staged, it will be installed on exit", m.Version)
+		return nil
+	}
+	if cfg.ApplyOn == OnNextStart {
+		logInfo, logError := normalizeLogs(cfg)
+		if err = stageForStartup(s); err != nil {
+			logError("failed to stage update: %v", err)
 			return err
 		}
+		logInfo("update to %s staged, it will be installed on next start", m.Version)
+		return nil
 	}
-	curFile := filepath.Base(currPath)
-	downloadFile := filepath.Join(filepath.Dir(currPath), fmt.Sprintf("%s-%s.gz", curFile, m.Version))
+	return apply(s, start)
+}
 
-	logInfo("downloading")
+// finishUpdate restarts the updated binary if cfg.AutoRestart is set.
+func finishUpdate(cfg Config, currPath string, restartFn func(Config, string) error, logInfo, logError LogFunc) error {
+	if cfg.autoRestart() {
+		logInfo("restarting")
 
-	resolvedURL, err := resolveURL(cfg.URL, m.DownloadURL)
-	if err != nil {
-		logError("failed to resolve download URL: %v", err)
-		return err
+		if err := restartFn(cfg, currPath); err != nil {
+			logError("failed to restart: %v", err)
+			return err
+		}
+
+		os.Exit(0)
 	}
 
-	if err = fetchAndDownload(resolvedURL, downloadFile); err != nil {
-		logError("failed to download update: %v", err)
+	logInfo("update installed, please restart manually")
+	return nil
+}
+
+// verifySignature verifies the signatures over "version+sha256" of m, see
+// verifyThreshold, and that they are logged if cfg.TransparencyLog is set.
+// Without a public key in cfg, there is nothing to verify.
+func verifySignature(cfg Config, m *metadata.Metadata) error {
+	if !cfg.hasKeys() {
+		return nil
+	}
+
+	if err := verifyThreshold(cfg, m); err != nil {
 		return err
 	}
+	if cfg.TransparencyLog != nil {
+		return cfg.TransparencyLog.VerifyLogged(m, cfg.PubKey)
+	}
+	return nil
+}
 
-	defer os.Remove(downloadFile)
+// checkMetadata returns the remote metadata, or the metadata recorded in the
+// state file if the last check happened less than cfg.MinCheckInterval ago
+// or the server reports it as unchanged.
+func checkMetadata(cfg Config, logInfo, logError LogFunc) (*metadata.Metadata, error) {
+	if !cfg.useState() {
+		return fetchMetadata(cfg)
+	}
 
-	gzipFile, err := os.Open(downloadFile)
+	path, err := statePath(cfg)
 	if err != nil {
-		logError("failed to open update file: %v", err)
-		return err
+		return nil, err
 	}
-	defer gzipFile.Close()
-
-	gzipReader, err := gzip.NewReader(gzipFile)
+	st, err := loadState(path)
 	if err != nil {
-		logError("failed to create gzip reader: %v", err)
-		return err
+		warnLog(cfg, logError)("failed to load state, ignoring: %v", err)
+		st = &state{}
 	}
-	defer gzipReader.Close()
 
-	uncompressedFile, err := os.Create(strings.TrimSuffix(downloadFile, ".gz"))
-	if err != nil {
-		logError("failed to create uncompressed file: %v", err)
-		return err
+	cached := st.Metadata != nil && st.URL == cfg.URL
+	if cached && time.Since(st.LastCheck) < cfg.MinCheckInterval {
+		logInfo("last check was less than %s ago - using cached result", cfg.MinCheckInterval)
+		return st.Metadata, nil
 	}
-	defer uncompressedFile.Close()
 
-	_, err = io.Copy(uncompressedFile, gzipReader)
-	if err != nil {
-		logError("failed to decompress update: %v", err)
-		return err
+	var v Validators
+	if cached {
+		v = Validators{ETag: st.ETag, LastModified: st.LastModified}
+	}
+	m, next, err := fetchMetadataIf(cfg, v)
+	switch {
+	case errors.Is(err, ErrNotModified) && cached:
+		logInfo("metadata not modified - using cached result")
+		m, next = st.Metadata, v
+	case err != nil:
+		return nil, err
 	}
 
-	logInfo("verifying checksum")
-	err = verifyChecksum(uncompressedFile.Name(), m)
-	if err != nil {
-		logError("failed to verify checksum: %v", err)
-		return err
+	st.URL = cfg.URL
+	st.LastCheck = time.Now()
+	st.Metadata = m
+	st.ETag, st.LastModified = next.ETag, next.LastModified
+	if err = saveState(path, st); err != nil {
+		warnLog(cfg, logError)("failed to save state: %v", err)
 	}
 
-	if len(cfg.PubKey) > 0 {
-		logInfo("verifying signature")
-		ok, err := signing.VerifyRaw(cfg.PubKey, fmt.Sprintf("%s+%s", m.Version, m.Checksum), m.Signature)
-		if err != nil {
-			logError("failed to verify signature: %v", err)
-			return err
-		}
-		if !ok {
-			err = fmt.Errorf("signature verification failed")
-			logError(err.Error())
-			return err
-		}
+	return m, nil
+}
+
+func targetPath(cfg Config) (string, error) {
+	if cfg.TargetPath != "" {
+		return cfg.TargetPath, nil
+	}
+	if cfg.Managed {
+		return "", errors.New("managed binaries require a TargetPath")
 	}
+	return cfg.executable()
+}
 
-	if err = uncompressedFile.Sync(); err != nil {
-		logError("failed to sync new binary to disk: %v", err)
+func workDir(cfg Config, currPath string) string {
+	if cfg.WorkDir != "" {
+		return cfg.WorkDir
+	}
+	return filepath.Dir(currPath)
+}
+
+// copyToSibling copies src to dst, which is expected to live next to the
+// binary being replaced so that a subsequent rename of dst is atomic. It is
+// used when src can't be renamed because it lives on a different filesystem.
+func copyToSibling(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
 		return err
 	}
+	defer in.Close()
 
-	oldInfo, err := os.Stat(currPath)
+	info, err := in.Stat()
 	if err != nil {
-		logError("failed to stat current executable: %v", err)
 		return err
 	}
-	oldMode := oldInfo.Mode()
 
-	if err = replaceBinary(cfg, currPath, uncompressedFile.Name(), m); err != nil {
-		logError("failed to update: %v", err)
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
 		return err
 	}
 
-	if err = restorePermissions(currPath, oldMode); err != nil {
-		logError("failed to make file executable: %v", err)
+	if _, err = io.Copy(out, in); err != nil {
+		_ = out.Close()
+		_ = os.Remove(dst)
+		return err
+	}
+	if err = out.Sync(); err != nil {
+		_ = out.Close()
+		_ = os.Remove(dst)
+		return err
+	}
+	if err = out.Close(); err != nil {
+		_ = os.Remove(dst)
+		return err
 	}
 
-	if cfg.AutoRestart {
-		logInfo("restarting")
+	return nil
+}
 
-		// Explicit cleanup before os.Exit since defers won't run
-		// Ignore errors here; process is about to exit.
-		_ = gzipReader.Close()
-		_ = gzipFile.Close()
-		_ = os.Remove(downloadFile)
-		_ = uncompressedFile.Close()
+// checkDiskSpace fails with ErrInsufficientSpace if any of dirs has less than
+// size*spaceSafetyFactor bytes available. Unknown sizes are not checked.
+func checkDiskSpace(size int64, dirs ...string) error {
+	if size <= 0 {
+		return nil
+	}
 
-		if err = restartBinary(currPath); err != nil {
-			logError("failed to restart: %v", err)
-			return err
+	need := size * spaceSafetyFactor
+	for _, dir := range dirs {
+		avail, err := freeSpace(dir)
+		if err != nil || avail < 0 {
+			continue
+		}
+		if avail < need {
+			return fmt.Errorf("%w in %s: need %d bytes, have %d", ErrInsufficientSpace, dir, need, avail)
 		}
-
-		os.Exit(0)
 	}
 
-	logInfo("update installed, please restart manually")
 	return nil
 }
 
@@ -218,88 +397,217 @@ func restorePermissions(path string, mode os.FileMode) error {
 	return os.Chmod(path, mode)
 }
 
-func fetchMetadata(url string) (*metadata.Metadata, error) {
-	resp, err := httpGet(url)
+func fetchMetadata(cfg Config) (*metadata.Metadata, error) {
+	m, _, err := fetchMetadataIf(cfg, Validators{})
+	return m, err
+}
+
+// fetchMetadataIf fetches the metadata with a conditional request if the
+// source supports it, returning the latest release and the validators of the
+// response.
+func fetchMetadataIf(cfg Config, v Validators) (*metadata.Metadata, Validators, error) {
+	releases, next, err := fetchReleasesIf(cfg, v)
 	if err != nil {
-		return nil, err
+		return nil, Validators{}, err
 	}
-	defer resp.Body.Close()
+	m, err := cfg.latest(cfg.offered(releases))
+	if err != nil {
+		return nil, Validators{}, err
+	}
+	return m, next, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("metadata HTTP %d", resp.StatusCode)
+// offered returns the releases of a feed to choose the latest from: those
+// compatible with c.CurrentVer which aren't pre-releases unless
+// c.AllowPrerelease is set, or all of them if there are none.
+func (c Config) offered(releases []metadata.Metadata) []metadata.Metadata {
+	if len(releases) == 1 {
+		return releases
+	}
+	var offered []metadata.Metadata
+	for _, m := range releases {
+		if !compatible(c.CurrentVer, &m) {
+			continue
+		}
+		if c.AllowPrerelease || !c.isPrerelease(m.Version) {
+			offered = append(offered, m)
+		}
 	}
+	if len(offered) == 0 {
+		return releases
+	}
+	return offered
+}
 
-	var m metadata.Metadata
-	if err = json.NewDecoder(resp.Body).Decode(&m); err != nil {
-		return nil, err
+// compatible reports whether m may update currentVersion, see
+// metadata.Metadata.CompatibleWith. Current versions which aren't semantic
+// versions, e.g. development builds, can't be checked and are compatible.
+func compatible(currentVersion string, m *metadata.Metadata) bool {
+	if m.CompatibleWith == "" {
+		return true
 	}
-	return &m, nil
+	cv, err := version.NewSemVer(currentVersion, "v")
+	if err != nil {
+		return true
+	}
+	c, err := version.NewConstraint(m.CompatibleWith)
+	return err == nil && c.Check(cv)
 }
 
-func fetchAndDownload(url, dest string) error {
-	resp, err := httpGet(url)
+// fetchReleasesIf is fetchMetadataIf returning all releases of a feed.
+func fetchReleasesIf(cfg Config, v Validators) ([]metadata.Metadata, Validators, error) {
+	var (
+		rc   io.ReadCloser
+		next Validators
+		err  error
+	)
+	ctx, cancel := withTimeout(cfg.metadataTimeout())
+	defer cancel()
+
+	if cs, ok := cfg.source().(ConditionalSource); ok {
+		rc, next, err = cs.FetchMetadataIf(ctx, v)
+	} else {
+		rc, err = cfg.source().FetchMetadata(ctx)
+	}
 	if err != nil {
-		return err
+		return nil, Validators{}, err
 	}
-	defer resp.Body.Close()
+	defer rc.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("download HTTP %d", resp.StatusCode)
+	releases, err := metadata.Decode(limitReader(rc, cfg.maxMetadataSize(), "metadata"))
+	if err != nil {
+		return nil, Validators{}, err
 	}
+	return releases, next, nil
+}
 
-	out, err := os.Create(dest)
+// fetchAndDownload downloads url to dest. A size > 0 is the metadata size of
+// the artifact, which the download must match.
+func fetchAndDownload(cfg Config, url, dest string, limit, size int64, warn LogFunc) error {
+	// download to a .part file first so interrupted downloads are recognizable
+	part := dest + partSuffix
+	out, err := os.Create(part)
 	if err != nil {
 		return err
 	}
-	defer out.Close()
+	defer os.Remove(part)
+
+	start := time.Now()
+	ctx, cancel := withTimeout(cfg.downloadTimeout())
+	defer cancel()
+
+	if err = cfg.source().FetchArtifact(ctx, url, downloadWriter(cfg, out, limit, size, warn)); err != nil {
+		_ = out.Close()
+		cfg.Metrics.download(url, 0, time.Since(start), err)
+		return err
+	}
+	if err = out.Sync(); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
 
-	_, err = io.Copy(out, resp.Body)
-	return err
+	fi, err := os.Stat(part)
+	if err != nil {
+		return err
+	}
+	if size > 0 && fi.Size() != size {
+		return fmt.Errorf("%w: download is %d bytes, metadata size is %d", ErrSizeMismatch, fi.Size(), size)
+	}
+	cfg.logger().Debug("artifact downloaded", "url", url, "bytes", fi.Size(), "duration", time.Since(start))
+	cfg.Metrics.download(url, fi.Size(), time.Since(start), nil)
+	return os.Rename(part, dest)
 }
 
-func verifyChecksum(path string, m *metadata.Metadata) error {
+func verifyChecksum(path, expected string) error {
 	file, err := os.Open(path)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	h := sha256.New()
-	if _, err = io.Copy(h, file); err != nil {
+	sum, err := checksumOf(file, expected)
+	if err != nil {
 		return err
 	}
-
-	sum := fmt.Sprintf("%x", h.Sum(nil))
-	if !strings.EqualFold(sum, m.Checksum) {
-		return fmt.Errorf("checksum mismatch for %s != %s", sum, m.Checksum)
+	if !strings.EqualFold(sum, expected) {
+		return fmt.Errorf("%w for %s != %s", ErrChecksumMismatch, sum, expected)
 	}
 
 	return nil
 }
 
-func shouldUpdate(currentVersion string, metadata *metadata.Metadata) (bool, error) {
-	if currentVersion == "" || strings.Contains(currentVersion, "dev") {
-		return false, nil
+// checksumOf returns the checksum of r with the algorithm of expected.
+func checksumOf(r io.Reader, expected string) (string, error) {
+	alg, err := checksum.Algorithm(expected)
+	if err != nil {
+		return "", err
+	}
+	return checksum.Reader(r, alg)
+}
+
+// isNewer reports whether m is newer than the installed version, and if not,
+// why. A managed binary which isn't installed yet is always out of date.
+func (c Config) isNewer(m *metadata.Metadata) (bool, NoUpdateReason, error) {
+	if c.Managed && c.TargetPath != "" {
+		if _, err := os.Stat(c.TargetPath); errors.Is(err, os.ErrNotExist) {
+			return true, "", nil
+		}
 	}
+	return shouldUpdate(c, m)
+}
 
-	cv, err := version.NewSemVer(currentVersion, "v")
-	if err != nil {
-		return false, err
+// shouldUpdate reports whether m is newer than c.CurrentVer and compatible
+// with it. Pre-releases are only offered if c.AllowPrerelease is set, and
+// development builds are handled according to c.DevVersionPolicy.
+func shouldUpdate(c Config, m *metadata.Metadata) (bool, NoUpdateReason, error) {
+	currentVersion := c.CurrentVer
+	if currentVersion == "" {
+		return false, ReasonUnknownVersion, nil
+	}
+	if isDevVersion(currentVersion) {
+		switch c.DevVersionPolicy {
+		case DevAsZero:
+			currentVersion = "0.0.0"
+		case DevWarn:
+			c.logWarn()("development version %s is not updated", c.CurrentVer)
+			fallthrough
+		default:
+			return false, ReasonDevVersion, nil
+		}
 	}
-	nv, err := version.NewSemVer(metadata.Version, "v")
+
+	cmp, err := c.compareVersions(m.Version, currentVersion)
 	if err != nil {
-		return false, err
+		return false, "", err
 	}
+	if !compatible(c.CurrentVer, m) {
+		return false, ReasonIncompatible, nil
+	}
+	if c.isPrerelease(m.Version) && !c.AllowPrerelease || cmp <= 0 {
+		return false, ReasonUpToDate, nil
+	}
+	return true, "", nil
+}
 
-	return nv.GreaterThan(cv), nil
+// DownloadURL returns the URL the artifact of m is downloaded from: its
+// DownloadURL with placeholders expanded, resolved against cfg.URL.
+func DownloadURL(cfg Config, m *metadata.Metadata) (string, error) {
+	return resolveURL(cfg.URL, m.DownloadURL, m.Version)
 }
 
-func resolveURL(metaURL, downloadURL string) (string, error) {
+// resolveURL expands the placeholders of downloadURL for version, see
+// expandURL, and resolves it against metaURL.
+func resolveURL(metaURL, downloadURL, version string) (string, error) {
+	downloadURL = expandURL(downloadURL, version)
 	du, err := url.Parse(downloadURL)
 	if err != nil {
 		return "", err
 	}
-	if du.IsAbs() {
+	if du.IsAbs() || metaURL == "" {
+		// without a metadata URL, relative URLs are left to the Source
 		return downloadURL, nil
 	}
 	mu, err := url.Parse(metaURL)
@@ -310,16 +618,22 @@ func resolveURL(metaURL, downloadURL string) (string, error) {
 }
 
 func normalizeLogs(c Config) (logInfo, logError LogFunc) {
-	if c.LogInfo == nil {
-		logInfo = func(string, ...interface{}) { /* be quiet */ }
-	} else {
+	switch {
+	case c.LogInfo != nil:
 		logInfo = c.LogInfo
+	case c.Logger != nil:
+		logInfo = slogFunc(c.Logger, slog.LevelInfo)
+	default:
+		logInfo = func(string, ...interface{}) { /* be quiet */ }
 	}
 
-	if c.LogError == nil {
-		logError = func(string, ...interface{}) { /* be quiet */ }
-	} else {
+	switch {
+	case c.LogError != nil:
 		logError = c.LogError
+	case c.Logger != nil:
+		logError = slogFunc(c.Logger, slog.LevelError)
+	default:
+		logError = func(string, ...interface{}) { /* be quiet */ }
 	}
 
 	return logInfo, logError
@@ -2,16 +2,37 @@
 package self
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"bytes"
 	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/napalu/gosafedate/checksum"
+	_ "github.com/napalu/gosafedate/checksum/blake3"
 	"github.com/napalu/gosafedate/metadata"
+	"github.com/napalu/gosafedate/signing"
 )
 
 // helper: gzip []byte
@@ -28,13 +49,50 @@ func gzipBytes(t *testing.T, b []byte) []byte {
 	return buf.Bytes()
 }
 
+// failingSource fails the test if anything is fetched.
+type failingSource struct{ t *testing.T }
+
+func (s *failingSource) FetchMetadata(context.Context) (io.ReadCloser, error) {
+	s.t.Fatalf("metadata should not be fetched")
+	return nil, nil
+}
+
+func (s *failingSource) FetchArtifact(_ context.Context, url string, _ io.Writer) error {
+	s.t.Fatalf("%s should not be downloaded", url)
+	return nil
+}
+
+// memSource serves metadata and artifacts from memory.
+type memSource struct {
+	meta      metadata.Metadata
+	artifacts map[string][]byte
+}
+
+func (s *memSource) FetchMetadata(context.Context) (io.ReadCloser, error) {
+	b, err := json.Marshal(s.meta)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (s *memSource) FetchArtifact(_ context.Context, url string, w io.Writer) error {
+	b, ok := s.artifacts[url]
+	if !ok {
+		return fmt.Errorf("%s: not found", url)
+	}
+	_, err := w.Write(b)
+	return err
+}
+
 func TestUpdateIfNewer_NoUpdateWhenSameVersion(t *testing.T) {
 	t.Helper()
 
 	// metadata says v1.2.3, same as current
 	m := metadata.Metadata{
-		Version:  "v1.2.3",
-		Checksum: "deadbeef",
+		Version:     "v1.2.3",
+		Checksum:    zeroSum,
+		DownloadURL: "bin.gz",
 	}
 
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -85,7 +143,7 @@ func TestUpdateIfNewer_ChecksumMismatch(t *testing.T) {
 	// deliberate wrong checksum
 	m := metadata.Metadata{
 		Version:     "v1.2.4",
-		Checksum:    "0000",
+		Checksum:    zeroSum,
 		DownloadURL: "/bin",
 	}
 
@@ -135,3 +193,2804 @@ func TestUpdateIfNewer_ChecksumMismatch(t *testing.T) {
 		t.Fatalf("expected error on checksum mismatch, got nil")
 	}
 }
+
+func TestHasNewer_MinCheckIntervalUsesCachedResult(t *testing.T) {
+	m := metadata.Metadata{
+		Version:     "v1.2.4",
+		Checksum:    zeroSum,
+		DownloadURL: "bin.gz",
+	}
+
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		_ = json.NewEncoder(w).Encode(m)
+	}))
+	defer srv.Close()
+
+	cfg := Config{
+		URL:              srv.URL,
+		CurrentVer:       "v1.2.3",
+		StatePath:        filepath.Join(t.TempDir(), "myapp.state"),
+		MinCheckInterval: time.Hour,
+	}
+
+	for i := 0; i < 2; i++ {
+		newer, got, err := HasNewer(cfg)
+		if err != nil {
+			t.Fatalf("HasNewer returned error: %v", err)
+		}
+		if !newer || got == nil || got.Version != m.Version {
+			t.Fatalf("expected newer version %s, got newer=%v meta=%+v", m.Version, newer, got)
+		}
+	}
+
+	if hits != 1 {
+		t.Fatalf("expected 1 metadata request, got %d", hits)
+	}
+}
+
+func TestPlan_DoesNotTouchFilesystem(t *testing.T) {
+	gz := gzipBytes(t, []byte("new-binary"))
+	m := metadata.Metadata{
+		Version:     "v1.2.4",
+		Checksum:    zeroSum,
+		DownloadURL: "bin.gz",
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/app/meta.json":
+			_ = json.NewEncoder(w).Encode(m)
+		case "/app/bin.gz":
+			_, _ = w.Write(gz)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	oldRename := rename
+	oldExe := executable
+	defer func() {
+		rename = oldRename
+		executable = oldExe
+	}()
+	rename = func(_, _ string) error {
+		t.Fatalf("rename should not be called when planning")
+		return nil
+	}
+	executable = func() (string, error) {
+		t.Fatalf("executable should not be needed when planning")
+		return "", nil
+	}
+
+	plan, err := Plan(Config{
+		URL:        srv.URL + "/app/meta.json",
+		CurrentVer: "v1.2.3",
+	})
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+	if !plan.Newer || plan.TargetVersion != m.Version {
+		t.Fatalf("unexpected plan: %+v", plan)
+	}
+	if plan.DownloadURL != srv.URL+"/app/bin.gz" {
+		t.Fatalf("unexpected download URL: %s", plan.DownloadURL)
+	}
+	if plan.DownloadSize != int64(len(gz)) {
+		t.Fatalf("expected download size %d, got %d", len(gz), plan.DownloadSize)
+	}
+}
+
+func TestUpdateFromMetadata_InsufficientSpace(t *testing.T) {
+	if avail, _ := freeSpace(os.TempDir()); avail < 0 {
+		t.Skip("free space not available on this platform")
+	}
+
+	tmpDir := t.TempDir()
+	currPath := filepath.Join(tmpDir, "myapp")
+	if err := os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write temp exe: %v", err)
+	}
+
+	err := UpdateFromMetadata(Config{
+		URL:        "https://example.com/meta.json",
+		CurrentVer: "v1.2.3",
+		TargetPath: currPath,
+		Source:     &failingSource{t: t},
+	}, &metadata.Metadata{
+		Version:     "v1.2.4",
+		DownloadURL: "bin.gz",
+		Size:        1 << 50,
+	})
+	if !errors.Is(err, ErrInsufficientSpace) {
+		t.Fatalf("expected ErrInsufficientSpace, got %v", err)
+	}
+}
+
+func TestCleanupArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	currPath := filepath.Join(dir, "myapp")
+
+	stale := []string{
+		"myapp-v1.2.4.gz",
+		"myapp-v1.2.4.gz.part",
+		"myapp-v1.2.4.new",
+		"myapp-v1.2.4.new.part",
+		"myapp-v1.2.4.patch",
+		"myapp-v1.2.4.tar.gz",
+		"myapp-2026.10.1.zip",
+		"myapp.new",
+		"myapp.new.meta",
+		"myapp.bak",
+	}
+	keep := []string{
+		"myapp",
+		"myapp.state",
+		"myapp-config.json",
+		"myapp-assets.zip",
+		"myapp-data.tar.gz",
+		"myapp-notes.part",
+		"other-v1.2.4.gz",
+	}
+
+	for _, name := range append(stale, keep...) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	if err := CleanupArtifacts(Config{TargetPath: currPath}); err != nil {
+		t.Fatalf("CleanupArtifacts returned error: %v", err)
+	}
+
+	for _, name := range stale {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed", name)
+		}
+	}
+	for _, name := range keep {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("expected %s to be kept: %v", name, err)
+		}
+	}
+}
+
+func TestCleanupArtifacts_StagedForStartup(t *testing.T) {
+	newData := []byte("new-binary")
+	sum := fmt.Sprintf("%x", sha256.Sum256(newData))
+
+	tests := []struct {
+		name     string
+		current  string
+		version  string
+		checksum string
+		keep     bool
+	}{
+		{name: "waiting for restart", current: "v1.2.3", version: "v1.2.4", checksum: sum, keep: true},
+		{name: "unknown current version", version: "v1.2.4", checksum: sum, keep: true},
+		{name: "installed", current: "v1.2.4", version: "v1.2.4", checksum: sum},
+		{name: "older", current: "v1.3.0", version: "v1.2.4", checksum: sum},
+		{name: "checksum mismatch", current: "v1.2.3", version: "v1.2.4", checksum: zeroSum},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			currPath := filepath.Join(dir, "myapp")
+			meta, _ := json.Marshal(metadata.Metadata{Version: tt.version, Checksum: tt.checksum})
+			for name, data := range map[string][]byte{
+				"myapp.new":             newData,
+				"myapp.new.meta":        meta,
+				"myapp-v1.2.5.gz.part":  []byte("x"),
+				"myapp-v1.2.5.new.part": []byte("x"),
+			} {
+				if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+					t.Fatalf("write %s: %v", name, err)
+				}
+			}
+
+			if err := CleanupArtifacts(Config{TargetPath: currPath, CurrentVer: tt.current}); err != nil {
+				t.Fatalf("CleanupArtifacts returned error: %v", err)
+			}
+			for _, name := range []string{"myapp.new", "myapp.new.meta"} {
+				if _, err := os.Stat(filepath.Join(dir, name)); (err == nil) != tt.keep {
+					t.Errorf("%s kept: %v, want %v", name, err == nil, tt.keep)
+				}
+			}
+			for _, name := range []string{"myapp-v1.2.5.gz.part", "myapp-v1.2.5.new.part"} {
+				if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+					t.Errorf("expected %s to be removed", name)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateIfNewer_StagedForStartup(t *testing.T) {
+	newData := []byte("new-binary")
+	sum := fmt.Sprintf("%x", sha256.Sum256(newData))
+	src := &memSource{
+		meta:      metadata.Metadata{Version: "v1.2.4", Checksum: sum, DownloadURL: "myapp-v1.2.4.gz"},
+		artifacts: map[string][]byte{"myapp-v1.2.4.gz": gzipBytes(t, newData)},
+	}
+	currPath := filepath.Join(t.TempDir(), "myapp")
+	if err := os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write temp exe: %v", err)
+	}
+	cfg := Config{Source: src, CurrentVer: "v1.2.3", TargetPath: currPath, ApplyOn: OnNextStart}
+
+	if err := UpdateIfNewer(cfg); err != nil {
+		t.Fatalf("UpdateIfNewer returned error: %v", err)
+	}
+	// checking again before the restart keeps the staged update, without
+	// downloading it again
+	src.artifacts = nil
+	if err := UpdateIfNewer(cfg); err != nil {
+		t.Fatalf("UpdateIfNewer of the staged version returned error: %v", err)
+	}
+	if got, err := os.ReadFile(currPath + newSuffix); err != nil || string(got) != string(newData) {
+		t.Fatalf("staged update = %q, %v", got, err)
+	}
+
+	if runtime.GOOS == "windows" {
+		return // the update helper would install the release
+	}
+
+	// installing a release supersedes the staged update
+	newer := []byte("newer-binary")
+	newerSum := fmt.Sprintf("%x", sha256.Sum256(newer))
+	src.meta = metadata.Metadata{Version: "v1.2.5", Checksum: newerSum, DownloadURL: "myapp-v1.2.5.gz"}
+	src.artifacts = map[string][]byte{"myapp-v1.2.5.gz": gzipBytes(t, newer)}
+	cfg.ApplyOn = ApplyNow
+	if err := UpdateIfNewer(cfg); err != nil {
+		t.Fatalf("UpdateIfNewer returned error: %v", err)
+	}
+	if got, _ := os.ReadFile(currPath); string(got) != string(newer) {
+		t.Fatalf("exe = %q, want %q", got, newer)
+	}
+	for _, p := range []string{currPath + newSuffix, currPath + newSuffix + metaSuffix} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Fatalf("superseded %s left behind", p)
+		}
+	}
+}
+
+func TestUpdateFromMetadata_DecompressedSizeLimit(t *testing.T) {
+	gz := gzipBytes(t, bytes.Repeat([]byte{0}, 1<<16))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(gz)
+	}))
+	defer srv.Close()
+
+	tmpDir := t.TempDir()
+	currPath := filepath.Join(tmpDir, "myapp")
+	if err := os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write temp exe: %v", err)
+	}
+
+	err := UpdateFromMetadata(Config{
+		URL:           srv.URL + "/meta.json",
+		CurrentVer:    "v1.2.3",
+		TargetPath:    currPath,
+		MaxBinarySize: 1 << 10,
+	}, &metadata.Metadata{
+		Version:     "v1.2.4",
+		DownloadURL: "bin.gz",
+	})
+	if !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("expected ErrTooLarge, got %v", err)
+	}
+}
+
+func TestUpdateFromMetadata_Size(t *testing.T) {
+	newData := []byte("new-binary")
+	gz := gzipBytes(t, newData)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(gz)
+	}))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		name     string
+		size     int64
+		source   Source
+		wantErr  error
+		wantWarn bool
+	}{
+		{name: "exact", size: int64(len(gz))},
+		{name: "Content-Length too large", size: int64(len(gz)) - 1, wantErr: ErrTooLarge},
+		{name: "body too large", size: int64(len(gz)) - 1, source: &memSource{artifacts: map[string][]byte{srv.URL + "/bin.gz": gz}}, wantErr: ErrTooLarge},
+		{name: "too small", size: int64(len(gz)) + 1, wantWarn: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			currPath := filepath.Join(t.TempDir(), "myapp")
+			if err := os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+				t.Fatalf("write temp exe: %v", err)
+			}
+
+			var warnings []string
+			var downloaded, total int64
+			err := UpdateFromMetadata(Config{
+				URL:        srv.URL + "/meta.json",
+				Source:     tc.source,
+				CurrentVer: "v1.2.3",
+				TargetPath: currPath,
+				LogError: func(format string, args ...interface{}) {
+					warnings = append(warnings, fmt.Sprintf(format, args...))
+				},
+				Progress: func(n, of int64) { downloaded, total = n, of },
+			}, &metadata.Metadata{
+				Version:     "v1.2.4",
+				Checksum:    fmt.Sprintf("%x", sha256.Sum256(newData)),
+				DownloadURL: "bin.gz",
+				Size:        tc.size,
+			})
+
+			switch {
+			case tc.wantErr != nil:
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("expected %v, got %v", tc.wantErr, err)
+				}
+			case tc.wantWarn:
+				if err == nil || !strings.Contains(strings.Join(warnings, "\n"), "Content-Length") {
+					t.Fatalf("expected a size error and a Content-Length warning, got %v, %q", err, warnings)
+				}
+			default:
+				if err != nil {
+					t.Fatalf("UpdateFromMetadata: %v", err)
+				}
+				if downloaded != tc.size || total != tc.size {
+					t.Fatalf("progress = %d/%d, want %d/%d", downloaded, total, tc.size, tc.size)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateFromMetadata_CompressedChecksumMismatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("corrupted-download"))
+	}))
+	defer srv.Close()
+
+	tmpDir := t.TempDir()
+	currPath := filepath.Join(tmpDir, "myapp")
+	if err := os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write temp exe: %v", err)
+	}
+
+	err := UpdateFromMetadata(Config{
+		URL:        srv.URL + "/meta.json",
+		CurrentVer: "v1.2.3",
+		TargetPath: currPath,
+	}, &metadata.Metadata{
+		Version:            "v1.2.4",
+		DownloadURL:        "bin.gz",
+		ChecksumCompressed: "0000",
+	})
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected checksum mismatch before decompression, got %v", err)
+	}
+}
+
+func TestUpdateFromMetadata_Bzip2(t *testing.T) {
+	// bzip2-compressed "new-binary" (stdlib has no bzip2 writer)
+	bz2 := []byte{
+		0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0x2a, 0xa2, 0xa7, 0x19, 0x00, 0x00,
+		0x03, 0x11, 0x80, 0x00, 0x02, 0x32, 0x21, 0x10, 0xa0, 0x20, 0x00, 0x31, 0x06, 0x4c, 0x41, 0x00,
+		0x7a, 0x22, 0x2e, 0xb4, 0x62, 0x7e, 0x2e, 0xe4, 0x8a, 0x70, 0xa1, 0x20, 0x55, 0x45, 0x4e, 0x32,
+	}
+	newData := []byte("new-binary")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(bz2)
+	}))
+	defer srv.Close()
+
+	currPath := filepath.Join(t.TempDir(), "myapp")
+	if err := os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write temp exe: %v", err)
+	}
+
+	err := UpdateFromMetadata(Config{
+		URL:        srv.URL + "/meta.json",
+		CurrentVer: "v1.2.3",
+		TargetPath: currPath,
+	}, &metadata.Metadata{
+		Version:     "v1.2.4",
+		Checksum:    fmt.Sprintf("%x", sha256.Sum256(newData)),
+		DownloadURL: "download?id=42",
+		Compression: "bzip2",
+	})
+	if err != nil {
+		t.Fatalf("UpdateFromMetadata returned error: %v", err)
+	}
+
+	got, err := os.ReadFile(currPath)
+	if err != nil {
+		t.Fatalf("read updated exe: %v", err)
+	}
+	if !bytes.Equal(got, newData) {
+		t.Fatalf("exe not replaced; got=%q", got)
+	}
+}
+
+func TestUpdateFromMetadata_Uncompressed(t *testing.T) {
+	newData := []byte("new-binary")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(newData)
+	}))
+	defer srv.Close()
+
+	currPath := filepath.Join(t.TempDir(), "myapp")
+	if err := os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write temp exe: %v", err)
+	}
+
+	err := UpdateFromMetadata(Config{
+		URL:        srv.URL + "/meta.json",
+		CurrentVer: "v1.2.3",
+		TargetPath: currPath,
+	}, &metadata.Metadata{
+		Version:     "v1.2.4",
+		Checksum:    fmt.Sprintf("%x", sha256.Sum256(newData)),
+		DownloadURL: "myapp-linux-amd64",
+		Compression: "none",
+	})
+	if err != nil {
+		t.Fatalf("UpdateFromMetadata returned error: %v", err)
+	}
+
+	got, err := os.ReadFile(currPath)
+	if err != nil {
+		t.Fatalf("read updated exe: %v", err)
+	}
+	if !bytes.Equal(got, newData) {
+		t.Fatalf("exe not replaced; got=%q", got)
+	}
+}
+
+func TestUpdateFromMetadata_TarGzArchive(t *testing.T) {
+	newData := []byte("new-binary")
+
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	for name, data := range map[string][]byte{
+		"myapp_1.2.4/README.md": []byte("readme"),
+		"myapp_1.2.4/myapp":     newData,
+	} {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o755, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatalf("write tar header: %v", err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatalf("write tar entry: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("close tar: %v", err)
+	}
+	tgz := gzipBytes(t, tarBuf.Bytes())
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(tgz)
+	}))
+	defer srv.Close()
+
+	currPath := filepath.Join(t.TempDir(), "myapp")
+	if err := os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write temp exe: %v", err)
+	}
+
+	err := UpdateFromMetadata(Config{
+		URL:        srv.URL + "/meta.json",
+		CurrentVer: "v1.2.3",
+		TargetPath: currPath,
+	}, &metadata.Metadata{
+		Version:     "v1.2.4",
+		Checksum:    fmt.Sprintf("%x", sha256.Sum256(newData)),
+		DownloadURL: "myapp_1.2.4_linux_amd64.tar.gz",
+	})
+	if err != nil {
+		t.Fatalf("UpdateFromMetadata returned error: %v", err)
+	}
+
+	got, err := os.ReadFile(currPath)
+	if err != nil {
+		t.Fatalf("read updated exe: %v", err)
+	}
+	if !bytes.Equal(got, newData) {
+		t.Fatalf("exe not replaced; got=%q", got)
+	}
+}
+
+func TestUpdateFromMetadata_ZipArchive(t *testing.T) {
+	newData := []byte("new-binary")
+
+	var zipBuf bytes.Buffer
+	zw := zip.NewWriter(&zipBuf)
+	for name, data := range map[string][]byte{
+		"LICENSE":        []byte("license"),
+		"bin/myapp-cli":  newData,
+		"bin/myapp-test": []byte("other-binary"),
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("create zip entry: %v", err)
+		}
+		if _, err = w.Write(data); err != nil {
+			t.Fatalf("write zip entry: %v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("close zip: %v", err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(zipBuf.Bytes())
+	}))
+	defer srv.Close()
+
+	currPath := filepath.Join(t.TempDir(), "myapp")
+	if err := os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write temp exe: %v", err)
+	}
+
+	err := UpdateFromMetadata(Config{
+		URL:        srv.URL + "/meta.json",
+		CurrentVer: "v1.2.3",
+		TargetPath: currPath,
+		BinaryName: "bin/*-cli",
+	}, &metadata.Metadata{
+		Version:     "v1.2.4",
+		Checksum:    fmt.Sprintf("%x", sha256.Sum256(newData)),
+		DownloadURL: "myapp_1.2.4_windows_amd64.zip",
+	})
+	if err != nil {
+		t.Fatalf("UpdateFromMetadata returned error: %v", err)
+	}
+
+	got, err := os.ReadFile(currPath)
+	if err != nil {
+		t.Fatalf("read updated exe: %v", err)
+	}
+	if !bytes.Equal(got, newData) {
+		t.Fatalf("exe not replaced; got=%q", got)
+	}
+}
+
+func TestUpdateFromMetadata_Bundle(t *testing.T) {
+	files := map[string][]byte{
+		"myapp":          []byte("new-binary"),
+		"plugins/foo.so": []byte("new-plugin"),
+	}
+
+	var manifest metadata.Manifest
+	for _, name := range []string{"myapp", "plugins/foo.so"} {
+		manifest.Files = append(manifest.Files, metadata.ManifestFile{
+			Path:     name,
+			Checksum: fmt.Sprintf("%x", sha256.Sum256(files[name])),
+		})
+	}
+	manifestBytes, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatalf("marshal manifest: %v", err)
+	}
+	files[metadata.ManifestName] = manifestBytes
+
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	for name, data := range files {
+		if err = tw.WriteHeader(&tar.Header{Name: name, Mode: 0o755, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatalf("write tar header: %v", err)
+		}
+		if _, err = tw.Write(data); err != nil {
+			t.Fatalf("write tar entry: %v", err)
+		}
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatalf("close tar: %v", err)
+	}
+	tgz := gzipBytes(t, tarBuf.Bytes())
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(tgz)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	currPath := filepath.Join(dir, "myapp")
+	if err = os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write temp exe: %v", err)
+	}
+	if err = os.Mkdir(filepath.Join(dir, "plugins"), 0o755); err != nil {
+		t.Fatalf("create plugins dir: %v", err)
+	}
+	if err = os.WriteFile(filepath.Join(dir, "plugins", "foo.so"), []byte("old-plugin"), 0o644); err != nil {
+		t.Fatalf("write plugin: %v", err)
+	}
+
+	err = UpdateFromMetadata(Config{
+		URL:        srv.URL + "/meta.json",
+		CurrentVer: "v1.2.3",
+		TargetPath: currPath,
+	}, &metadata.Metadata{
+		Version:     "v1.2.4",
+		Checksum:    fmt.Sprintf("%x", sha256.Sum256(manifestBytes)),
+		DownloadURL: "myapp-v1.2.4.tar.gz",
+		Bundle:      true,
+	})
+	if err != nil {
+		t.Fatalf("UpdateFromMetadata returned error: %v", err)
+	}
+
+	for _, name := range []string{"myapp", "plugins/foo.so"} {
+		got, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		if !bytes.Equal(got, files[name]) {
+			t.Fatalf("%s not replaced; got=%q", name, got)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("read dir: %v", err)
+	}
+	for _, e := range entries {
+		if e.Name() != "myapp" && e.Name() != "plugins" {
+			t.Errorf("unexpected leftover %s", e.Name())
+		}
+	}
+}
+
+// BSDIFF40 patch from "old-binary-v1" to "new-binary-v2!"
+// zeroSum is a well-formed checksum for metadata which isn't installed.
+var zeroSum = strings.Repeat("0", 64)
+
+var testPatch = []byte{
+	0x42, 0x53, 0x44, 0x49, 0x46, 0x46, 0x34, 0x30, 0x29, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x2d, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0e, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0x9f, 0xca, 0x1c, 0xcc, 0x00, 0x00,
+	0x05, 0xc0, 0x00, 0x68, 0x0a, 0x20, 0x00, 0x30, 0xcd, 0x00, 0x90, 0x1a, 0x41, 0x56, 0x6e, 0x2e,
+	0xe4, 0x8a, 0x70, 0xa1, 0x21, 0x3f, 0x94, 0x39, 0x98, 0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59,
+	0x26, 0x53, 0x59, 0x3a, 0x99, 0xc0, 0x5b, 0x00, 0x00, 0x04, 0x60, 0x00, 0xe2, 0x00, 0x08, 0x00,
+	0x00, 0x20, 0xa0, 0x00, 0x21, 0x80, 0x0c, 0x02, 0x23, 0x15, 0xdb, 0x8b, 0xb9, 0x22, 0x9c, 0x28,
+	0x48, 0x1d, 0x4c, 0xe0, 0x2d, 0x80, 0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59,
+	0x2d, 0x15, 0xeb, 0x1c, 0x00, 0x00, 0x00, 0x10, 0x00, 0x20, 0x00, 0x20, 0x00, 0x21, 0x18, 0x46,
+	0x82, 0xee, 0x48, 0xa7, 0x0a, 0x12, 0x05, 0xa2, 0xbd, 0x63, 0x80,
+}
+
+func TestUpdateFromMetadata_Delta(t *testing.T) {
+	newData := []byte("new-binary-v2!")
+
+	for _, tc := range []struct {
+		name     string
+		patch    []byte
+		wantFull bool
+	}{
+		{name: "patch applied", patch: testPatch},
+		{name: "corrupt patch falls back", patch: []byte("garbage"), wantFull: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fullDownloads := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/myapp-v1.2.3-v1.2.4.patch":
+					_, _ = w.Write(tc.patch)
+				case "/myapp-v1.2.4.gz":
+					fullDownloads++
+					_, _ = w.Write(gzipBytes(t, newData))
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer srv.Close()
+
+			currPath := filepath.Join(t.TempDir(), "myapp")
+			if err := os.WriteFile(currPath, []byte("old-binary-v1"), 0o755); err != nil {
+				t.Fatalf("write temp exe: %v", err)
+			}
+
+			err := UpdateFromMetadata(Config{
+				URL:        srv.URL + "/meta.json",
+				CurrentVer: "v1.2.3",
+				TargetPath: currPath,
+			}, &metadata.Metadata{
+				Version:     "v1.2.4",
+				Checksum:    fmt.Sprintf("%x", sha256.Sum256(newData)),
+				DownloadURL: "myapp-v1.2.4.gz",
+				Patches: []metadata.Patch{
+					{FromVersion: "v1.2.3", DownloadURL: "myapp-v1.2.3-v1.2.4.patch"},
+				},
+			})
+			if err != nil {
+				t.Fatalf("UpdateFromMetadata returned error: %v", err)
+			}
+
+			got, err := os.ReadFile(currPath)
+			if err != nil {
+				t.Fatalf("read updated exe: %v", err)
+			}
+			if !bytes.Equal(got, newData) {
+				t.Fatalf("exe not replaced; got=%q", got)
+			}
+			if tc.wantFull != (fullDownloads == 1) {
+				t.Fatalf("unexpected number of full downloads: %d", fullDownloads)
+			}
+		})
+	}
+}
+
+func TestUpdateIfNewer_SignedDelta(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	_, otherPriv, _ := ed25519.GenerateKey(nil)
+	newData := []byte("new-binary-v2!")
+	sum := fmt.Sprintf("%x", sha256.Sum256(newData))
+	digest := sha256.Sum256(testPatch)
+	signPatch := func(priv ed25519.PrivateKey) []byte {
+		return []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(priv, digest[:])) + "\n")
+	}
+
+	for _, tc := range []struct {
+		name     string
+		sig      []byte
+		wantFull bool
+	}{
+		{name: "signed patch applied", sig: signPatch(priv)},
+		{name: "unsigned patch falls back", wantFull: true},
+		{name: "patch signed by another key falls back", sig: signPatch(otherPriv), wantFull: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			src := &memSource{
+				meta: metadata.Metadata{
+					Version:     "v1.2.4",
+					Checksum:    sum,
+					Signature:   base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte("v1.2.4+"+sum))),
+					DownloadURL: "myapp-v1.2.4.gz",
+					Patches:     []metadata.Patch{{FromVersion: "v1.2.3", DownloadURL: "myapp-v1.2.4.patch"}},
+				},
+				artifacts: map[string][]byte{"myapp-v1.2.4.patch": testPatch},
+			}
+			if tc.sig != nil {
+				src.artifacts["myapp-v1.2.4.patch.sig"] = tc.sig
+			}
+			if tc.wantFull {
+				src.artifacts["myapp-v1.2.4.gz"] = gzipBytes(t, newData)
+			}
+
+			currPath := filepath.Join(t.TempDir(), "myapp")
+			if err := os.WriteFile(currPath, []byte("old-binary-v1"), 0o755); err != nil {
+				t.Fatalf("write temp exe: %v", err)
+			}
+			var fellBack bool
+			err := UpdateIfNewer(Config{
+				Source:     src,
+				PubKey:     pub,
+				CurrentVer: "v1.2.3",
+				TargetPath: currPath,
+				LogError: func(format string, args ...any) {
+					fellBack = fellBack || strings.Contains(format, "falling back")
+				},
+			})
+			if err != nil {
+				t.Fatalf("UpdateIfNewer: %v", err)
+			}
+			if got, _ := os.ReadFile(currPath); !bytes.Equal(got, newData) {
+				t.Fatalf("exe not replaced; got=%q", got)
+			}
+			if fellBack != tc.wantFull {
+				t.Fatalf("fell back to the full download: %v", fellBack)
+			}
+		})
+	}
+}
+
+func TestUpdateIfNewer_CustomSource(t *testing.T) {
+	newData := []byte("new-binary")
+
+	src := &memSource{
+		meta: metadata.Metadata{
+			Version:     "v1.2.4",
+			Checksum:    fmt.Sprintf("%x", sha256.Sum256(newData)),
+			DownloadURL: "myapp-v1.2.4.gz",
+		},
+		artifacts: map[string][]byte{
+			"myapp-v1.2.4.gz": gzipBytes(t, newData),
+		},
+	}
+
+	currPath := filepath.Join(t.TempDir(), "myapp")
+	if err := os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write temp exe: %v", err)
+	}
+
+	err := UpdateIfNewer(Config{
+		Source:     src,
+		CurrentVer: "v1.2.3",
+		TargetPath: currPath,
+	})
+	if err != nil {
+		t.Fatalf("UpdateIfNewer returned error: %v", err)
+	}
+
+	got, err := os.ReadFile(currPath)
+	if err != nil {
+		t.Fatalf("read updated exe: %v", err)
+	}
+	if !bytes.Equal(got, newData) {
+		t.Fatalf("exe not replaced; got=%q", got)
+	}
+}
+
+func TestUpdateIfNewer_DetachedSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	newData := []byte("new-binary")
+	gz := gzipBytes(t, newData)
+	digest := sha256.Sum256(gz)
+
+	for _, tc := range []struct {
+		name     string
+		signed   []byte
+		detached bool
+		wantErr  bool
+	}{
+		{name: "valid", signed: digest[:], detached: true},
+		{name: "wrong artifact", signed: []byte("tampered"), detached: true, wantErr: true},
+		// the inline signature stripped from a release
+		{name: "not accepted", signed: digest[:], wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sig := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, tc.signed))
+			src := &memSource{
+				meta: metadata.Metadata{
+					Version:     "v1.2.4",
+					Checksum:    fmt.Sprintf("%x", sha256.Sum256(newData)),
+					DownloadURL: "myapp-v1.2.4.gz",
+				},
+				artifacts: map[string][]byte{
+					"myapp-v1.2.4.gz":     gz,
+					"myapp-v1.2.4.gz.sig": []byte(sig + "\n"),
+				},
+			}
+
+			currPath := filepath.Join(t.TempDir(), "myapp")
+			if err := os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+				t.Fatalf("write temp exe: %v", err)
+			}
+
+			cfg := Config{
+				Source:             src,
+				PubKey:             pub,
+				DetachedSignatures: tc.detached,
+				CurrentVer:         "v1.2.3",
+				TargetPath:         currPath,
+			}
+			p, err := Plan(cfg)
+			if err != nil {
+				t.Fatalf("Plan: %v", err)
+			}
+			if err = VerifyPlan(cfg, p); (err != nil) != tc.wantErr {
+				t.Fatalf("VerifyPlan err = %v, wantErr %v", err, tc.wantErr)
+			}
+
+			err = UpdateIfNewer(cfg)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("UpdateIfNewer err = %v, wantErr %v", err, tc.wantErr)
+			}
+
+			got, err := os.ReadFile(currPath)
+			if err != nil {
+				t.Fatalf("read exe: %v", err)
+			}
+			if replaced := bytes.Equal(got, newData); replaced == tc.wantErr {
+				t.Fatalf("exe replaced = %v; got=%q", replaced, got)
+			}
+		})
+	}
+}
+
+func TestUpdateIfNewer_Minisign(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	keyID := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	pubKey := base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), keyID...), pub...))
+
+	newData := []byte("new-binary")
+	gz := gzipBytes(t, newData)
+	fileSig := ed25519.Sign(priv, gz) // legacy minisign signature of the file itself
+	comment := "timestamp:1700000000"
+	minisig := fmt.Sprintf("untrusted comment: signature\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), keyID...), fileSig...)),
+		comment, base64.StdEncoding.EncodeToString(ed25519.Sign(priv, append(fileSig, comment...))))
+
+	src := &memSource{
+		meta: metadata.Metadata{
+			Version:     "v1.2.4",
+			Checksum:    fmt.Sprintf("%x", sha256.Sum256(newData)),
+			DownloadURL: "myapp-v1.2.4.gz",
+		},
+		artifacts: map[string][]byte{
+			"myapp-v1.2.4.gz":         gz,
+			"myapp-v1.2.4.gz.minisig": []byte(minisig),
+		},
+	}
+
+	currPath := filepath.Join(t.TempDir(), "myapp")
+	if err = os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write temp exe: %v", err)
+	}
+
+	cfg := Config{
+		Source:     src,
+		PubKey:     []byte(pubKey),
+		CurrentVer: "v1.2.3",
+		TargetPath: currPath,
+	}
+	if err = UpdateIfNewer(cfg); err == nil {
+		t.Fatal("minisign key accepted without DetachedSignatures")
+	}
+	cfg.DetachedSignatures = true
+	if err = UpdateIfNewer(cfg); err != nil {
+		t.Fatalf("UpdateIfNewer returned error: %v", err)
+	}
+
+	got, err := os.ReadFile(currPath)
+	if err != nil {
+		t.Fatalf("read updated exe: %v", err)
+	}
+	if !bytes.Equal(got, newData) {
+		t.Fatalf("exe not replaced; got=%q", got)
+	}
+}
+
+type logVerifierFunc func(*metadata.Metadata, []byte) error
+
+func (f logVerifierFunc) VerifyLogged(m *metadata.Metadata, pubKey []byte) error { return f(m, pubKey) }
+
+func TestUpdateIfNewer_TransparencyLog(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	newData := []byte("new-binary")
+	sum := fmt.Sprintf("%x", sha256.Sum256(newData))
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte("v1.2.4+"+sum)))
+
+	for _, tc := range []struct {
+		name    string
+		entry   *metadata.LogEntry
+		wantErr bool
+	}{
+		{name: "logged", entry: &metadata.LogEntry{LogIndex: 7}},
+		{name: "not logged", wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			src := &memSource{
+				meta: metadata.Metadata{
+					Version:         "v1.2.4",
+					Checksum:        sum,
+					Signature:       sig,
+					DownloadURL:     "myapp-v1.2.4.gz",
+					TransparencyLog: tc.entry,
+				},
+				artifacts: map[string][]byte{"myapp-v1.2.4.gz": gzipBytes(t, newData)},
+			}
+
+			currPath := filepath.Join(t.TempDir(), "myapp")
+			if err := os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+				t.Fatalf("write temp exe: %v", err)
+			}
+
+			err := UpdateIfNewer(Config{
+				Source: src,
+				PubKey: pub,
+				TransparencyLog: logVerifierFunc(func(m *metadata.Metadata, _ []byte) error {
+					if m.TransparencyLog == nil {
+						return ErrNotLogged
+					}
+					return nil
+				}),
+				CurrentVer: "v1.2.3",
+				TargetPath: currPath,
+			})
+			if tc.wantErr != errors.Is(err, ErrNotLogged) || (!tc.wantErr && err != nil) {
+				t.Fatalf("UpdateIfNewer err = %v, wantErr %v", err, tc.wantErr)
+			}
+
+			got, err := os.ReadFile(currPath)
+			if err != nil {
+				t.Fatalf("read exe: %v", err)
+			}
+			if replaced := bytes.Equal(got, newData); replaced == tc.wantErr {
+				t.Fatalf("exe replaced = %v; got=%q", replaced, got)
+			}
+		})
+	}
+}
+
+func TestUpdateIfNewer_Threshold(t *testing.T) {
+	var (
+		pubs  [][]byte
+		privs []ed25519.PrivateKey
+	)
+	for range 3 {
+		pub, priv, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatalf("generate key: %v", err)
+		}
+		pubs, privs = append(pubs, pub), append(privs, priv)
+	}
+
+	newData := []byte("new-binary")
+	sum := fmt.Sprintf("%x", sha256.Sum256(newData))
+	sign := func(i int) string {
+		return base64.StdEncoding.EncodeToString(ed25519.Sign(privs[i], []byte("v1.2.4+"+sum)))
+	}
+
+	for _, tc := range []struct {
+		name       string
+		signature  string
+		signatures []string
+		wantErr    bool
+	}{
+		{name: "two of three", signature: sign(0), signatures: []string{sign(2)}},
+		{name: "only extra signatures", signatures: []string{sign(1), sign(2)}},
+		{name: "one of three", signature: sign(1), wantErr: true},
+		{name: "same key twice", signature: sign(1), signatures: []string{sign(1)}, wantErr: true},
+		{name: "invalid extra signature", signature: sign(0), signatures: []string{"bm9wZQ=="}, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			src := &memSource{
+				meta: metadata.Metadata{
+					Version:     "v1.2.4",
+					Checksum:    sum,
+					Signature:   tc.signature,
+					Signatures:  tc.signatures,
+					DownloadURL: "myapp-v1.2.4.gz",
+				},
+				artifacts: map[string][]byte{"myapp-v1.2.4.gz": gzipBytes(t, newData)},
+			}
+
+			currPath := filepath.Join(t.TempDir(), "myapp")
+			if err := os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+				t.Fatalf("write temp exe: %v", err)
+			}
+
+			err := UpdateIfNewer(Config{
+				Source:             src,
+				PubKey:             pubs[0],
+				PubKeys:            append(pubs[1:], pubs[0]),
+				RequiredSignatures: 2,
+				CurrentVer:         "v1.2.3",
+				TargetPath:         currPath,
+			})
+			if tc.wantErr != errors.Is(err, ErrInsufficientSignatures) || (!tc.wantErr && err != nil) {
+				t.Fatalf("UpdateIfNewer err = %v, wantErr %v", err, tc.wantErr)
+			}
+
+			got, err := os.ReadFile(currPath)
+			if err != nil {
+				t.Fatalf("read exe: %v", err)
+			}
+			if replaced := bytes.Equal(got, newData); replaced == tc.wantErr {
+				t.Fatalf("exe replaced = %v; got=%q", replaced, got)
+			}
+		})
+	}
+}
+
+func TestUpdateIfNewer_ThresholdRejectsDetachedSignature(t *testing.T) {
+	var (
+		pubs  [][]byte
+		privs []ed25519.PrivateKey
+	)
+	for range 3 {
+		pub, priv, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatalf("generate key: %v", err)
+		}
+		pubs, privs = append(pubs, pub), append(privs, priv)
+	}
+
+	// inline signatures stripped, a detached signature by PubKey alone
+	evil := []byte("evil-binary")
+	gz := gzipBytes(t, evil)
+	digest := sha256.Sum256(gz)
+	src := &memSource{
+		meta: metadata.Metadata{
+			Version:     "v1.2.4",
+			Checksum:    fmt.Sprintf("%x", sha256.Sum256(evil)),
+			DownloadURL: "myapp-v1.2.4.gz",
+		},
+		artifacts: map[string][]byte{
+			"myapp-v1.2.4.gz":     gz,
+			"myapp-v1.2.4.gz.sig": []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(privs[0], digest[:])) + "\n"),
+		},
+	}
+
+	currPath := filepath.Join(t.TempDir(), "myapp")
+	if err := os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write temp exe: %v", err)
+	}
+
+	err := UpdateIfNewer(Config{
+		Source:             src,
+		PubKey:             pubs[0],
+		PubKeys:            pubs[1:],
+		RequiredSignatures: 2,
+		CurrentVer:         "v1.2.3",
+		TargetPath:         currPath,
+	})
+	if !errors.Is(err, ErrInsufficientSignatures) {
+		t.Fatalf("expected ErrInsufficientSignatures, got %v", err)
+	}
+
+	// nor can detached signatures be accepted along with a threshold
+	err = UpdateIfNewer(Config{
+		Source:             src,
+		PubKey:             pubs[0],
+		PubKeys:            pubs[1:],
+		RequiredSignatures: 2,
+		DetachedSignatures: true,
+		CurrentVer:         "v1.2.3",
+		TargetPath:         currPath,
+	})
+	if err == nil || !strings.Contains(err.Error(), "detached signatures can't be used") {
+		t.Fatalf("expected a configuration error, got %v", err)
+	}
+	if got, _ := os.ReadFile(currPath); !bytes.Equal(got, []byte("old-binary")) {
+		t.Fatalf("exe replaced; got=%q", got)
+	}
+}
+
+func TestUpdateIfNewer_RootManifest(t *testing.T) {
+	_, rootPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	rootPub := rootPriv.Public().(ed25519.PublicKey)
+	oldPub, oldPriv, _ := ed25519.GenerateKey(nil)
+	newPub, newPriv, _ := ed25519.GenerateKey(nil)
+
+	rootManifest := func(signer ed25519.PrivateKey, keys metadata.RootKeys) []byte {
+		signed, _ := json.Marshal(keys)
+		b, _ := json.MarshalIndent(metadata.Root{
+			Signed:     signed,
+			Signatures: []string{base64.StdEncoding.EncodeToString(ed25519.Sign(signer, signed))},
+		}, "", "  ")
+		return b
+	}
+	encode := base64.StdEncoding.EncodeToString
+
+	newData := []byte("new-binary")
+	sum := fmt.Sprintf("%x", sha256.Sum256(newData))
+	sign := func(priv ed25519.PrivateKey) string {
+		return base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte("v1.2.4+"+sum)))
+	}
+
+	currPath := filepath.Join(t.TempDir(), "myapp")
+	update := func(root []byte, signer ed25519.PrivateKey) error {
+		if err := os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+			t.Fatalf("write temp exe: %v", err)
+		}
+		src := &memSource{
+			meta: metadata.Metadata{
+				Version:     "v1.2.4",
+				Checksum:    sum,
+				Signature:   sign(signer),
+				DownloadURL: "myapp-v1.2.4.gz",
+			},
+			artifacts: map[string][]byte{"myapp-v1.2.4.gz": gzipBytes(t, newData)},
+		}
+		if root != nil {
+			src.artifacts["root.json"] = root
+		}
+		return UpdateIfNewer(Config{
+			Source:     src,
+			PubKey:     oldPub, // replaced by the manifest
+			RootKey:    rootPub,
+			RootURL:    "root.json",
+			CurrentVer: "v1.2.3",
+			TargetPath: currPath,
+		})
+	}
+
+	v1 := rootManifest(rootPriv, metadata.RootKeys{Version: 1, Keys: []string{encode(oldPub)}})
+	v2 := rootManifest(rootPriv, metadata.RootKeys{Version: 2, Keys: []string{encode(newPub)}})
+
+	if err = update(nil, oldPriv); err == nil {
+		t.Fatal("expected missing key manifest to fail")
+	}
+	forged := rootManifest(oldPriv, metadata.RootKeys{Version: 3, Keys: []string{encode(oldPub)}})
+	if err = update(forged, oldPriv); err == nil {
+		t.Fatal("expected key manifest not signed by the root key to fail")
+	}
+
+	// rotated to the new key
+	if err = update(v2, oldPriv); !errors.Is(err, ErrInsufficientSignatures) {
+		t.Fatalf("expected release by the retired key to fail, got %v", err)
+	}
+	if err = update(v2, newPriv); err != nil {
+		t.Fatalf("UpdateIfNewer: %v", err)
+	}
+	if got, _ := os.ReadFile(currPath); !bytes.Equal(got, newData) {
+		t.Fatalf("exe not replaced; got=%q", got)
+	}
+
+	// the cached manifest is used when the manifest can't be fetched, and
+	// older manifests are rejected
+	if err = update(nil, newPriv); err != nil {
+		t.Fatalf("UpdateIfNewer with cached manifest: %v", err)
+	}
+	if err = update(v1, oldPriv); !errors.Is(err, ErrRootRollback) {
+		t.Fatalf("expected ErrRootRollback, got %v", err)
+	}
+
+	expired := rootManifest(rootPriv, metadata.RootKeys{Version: 3, Keys: []string{encode(newPub)}, Expires: time.Now().Add(-time.Hour)})
+	if err = update(expired, newPriv); !errors.Is(err, ErrRootExpired) {
+		t.Fatalf("expected ErrRootExpired, got %v", err)
+	}
+
+	threshold := rootManifest(rootPriv, metadata.RootKeys{Version: 4, Keys: []string{encode(newPub), encode(oldPub)}, Threshold: 2})
+	if err = update(threshold, newPriv); !errors.Is(err, ErrInsufficientSignatures) {
+		t.Fatalf("expected manifest threshold to apply, got %v", err)
+	}
+
+	// nor can a detached signature meet the manifest's threshold, and
+	// detached signatures can't be accepted with a key manifest at all
+	gz := gzipBytes(t, newData)
+	digest := sha256.Sum256(gz)
+	cfg := Config{
+		Source: &memSource{
+			meta: metadata.Metadata{Version: "v1.2.4", Checksum: sum, DownloadURL: "myapp-v1.2.4.gz"},
+			artifacts: map[string][]byte{
+				"root.json":           threshold,
+				"myapp-v1.2.4.gz":     gz,
+				"myapp-v1.2.4.gz.sig": []byte(encode(ed25519.Sign(newPriv, digest[:])) + "\n"),
+			},
+		},
+		RootKey:    rootPub,
+		RootURL:    "root.json",
+		CurrentVer: "v1.2.3",
+		TargetPath: currPath,
+	}
+	if err = UpdateIfNewer(cfg); !errors.Is(err, ErrInsufficientSignatures) {
+		t.Fatalf("expected manifest threshold to apply to detached signatures, got %v", err)
+	}
+	cfg.DetachedSignatures = true
+	if err = UpdateIfNewer(cfg); err == nil || !strings.Contains(err.Error(), "detached signatures can't be used") {
+		t.Fatalf("expected a configuration error, got %v", err)
+	}
+}
+
+func TestTrustedKeys(t *testing.T) {
+	rootPub, rootPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	releasePub, _, _ := ed25519.GenerateKey(nil)
+	target := filepath.Join(t.TempDir(), "myapp")
+
+	for _, tc := range []struct {
+		name    string
+		expires time.Time
+		want    int
+	}{
+		{"no expiry", time.Time{}, 2},
+		{"valid", time.Now().Add(time.Hour), 2},
+		{"expired", time.Now().Add(-time.Hour), 1},
+	} {
+		signed, _ := json.Marshal(metadata.RootKeys{
+			Version: 1,
+			Keys:    []string{base64.StdEncoding.EncodeToString(releasePub)},
+			Expires: tc.expires,
+		})
+		root, _ := json.Marshal(metadata.Root{
+			Signed:     signed,
+			Signatures: []string{base64.StdEncoding.EncodeToString(ed25519.Sign(rootPriv, signed))},
+		})
+		if err = os.WriteFile(target+rootSuffix, root, 0o644); err != nil {
+			t.Fatalf("write manifest: %v", err)
+		}
+		if got := trustedKeys(rootPub, target); len(got) != tc.want {
+			t.Errorf("%s: trustedKeys returned %d keys, want %d", tc.name, len(got), tc.want)
+		}
+	}
+}
+
+func TestUpdateIfNewer_ChecksumAlgorithms(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	newData := []byte("new-binary")
+
+	for _, alg := range []string{checksum.SHA256, checksum.SHA512, checksum.BLAKE2b, checksum.BLAKE3} {
+		t.Run(alg, func(t *testing.T) {
+			sum, err := checksum.Reader(bytes.NewReader(newData), alg)
+			if err != nil {
+				t.Fatalf("checksum: %v", err)
+			}
+			gz := gzipBytes(t, newData)
+			gzSum, _ := checksum.Reader(bytes.NewReader(gz), alg)
+
+			src := &memSource{
+				meta: metadata.Metadata{
+					Version:            "v1.2.4",
+					Checksum:           sum,
+					ChecksumCompressed: gzSum,
+					Signature:          base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte("v1.2.4+"+sum))),
+					DownloadURL:        "myapp-v1.2.4.gz",
+				},
+				artifacts: map[string][]byte{"myapp-v1.2.4.gz": gz},
+			}
+
+			currPath := filepath.Join(t.TempDir(), "myapp")
+			if err = os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+				t.Fatalf("write temp exe: %v", err)
+			}
+			cfg := Config{Source: src, PubKey: pub, CurrentVer: "v1.2.3", TargetPath: currPath}
+			if err = UpdateIfNewer(cfg); err != nil {
+				t.Fatalf("UpdateIfNewer: %v", err)
+			}
+			if got, _ := os.ReadFile(currPath); !bytes.Equal(got, newData) {
+				t.Fatalf("binary not updated: got %q", got)
+			}
+		})
+	}
+
+	// unknown algorithms are rejected with the metadata
+	src := &memSource{
+		meta: metadata.Metadata{
+			Version:     "v1.2.4",
+			Checksum:    "md5:0123",
+			Signature:   base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte("v1.2.4+md5:0123"))),
+			DownloadURL: "myapp-v1.2.4.gz",
+		},
+		artifacts: map[string][]byte{"myapp-v1.2.4.gz": gzipBytes(t, newData)},
+	}
+	currPath := filepath.Join(t.TempDir(), "myapp")
+	if err = os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write temp exe: %v", err)
+	}
+	err = UpdateIfNewer(Config{Source: src, PubKey: pub, CurrentVer: "v1.2.3", TargetPath: currPath})
+	if !errors.Is(err, metadata.ErrInvalid) {
+		t.Fatalf("expected ErrInvalid, got %v", err)
+	}
+}
+
+func TestUpdateFromDir_Signed(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	newData := []byte("new-binary")
+	sum := fmt.Sprintf("%x", sha256.Sum256(newData))
+
+	releases := t.TempDir()
+	meta, _ := json.Marshal(metadata.Metadata{
+		Version:     "v1.2.4",
+		Checksum:    sum,
+		Signature:   base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte("v1.2.4+"+sum))),
+		DownloadURL: "myapp-v1.2.4.gz",
+	})
+	if err := os.WriteFile(filepath.Join(releases, "metadata.json"), meta, 0o644); err != nil {
+		t.Fatalf("write metadata: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(releases, "myapp-v1.2.4.gz"), gzipBytes(t, newData), 0o644); err != nil {
+		t.Fatalf("write artifact: %v", err)
+	}
+
+	currPath := filepath.Join(t.TempDir(), "myapp")
+	if err := os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write temp exe: %v", err)
+	}
+
+	if err := UpdateFromDir(Config{
+		PubKey:     pub,
+		CurrentVer: "v1.2.3",
+		TargetPath: currPath,
+	}, releases); err != nil {
+		t.Fatalf("UpdateFromDir returned error: %v", err)
+	}
+
+	got, err := os.ReadFile(currPath)
+	if err != nil {
+		t.Fatalf("read updated exe: %v", err)
+	}
+	if !bytes.Equal(got, newData) {
+		t.Fatalf("exe not replaced; got=%q", got)
+	}
+}
+
+func TestUpdateIfNewer_MirrorFallback(t *testing.T) {
+	newData := []byte("new-binary")
+	gz := gzipBytes(t, newData)
+
+	var primaryHits int
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryHits++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/releases/metadata.json":
+			_ = json.NewEncoder(w).Encode(metadata.Metadata{
+				Version:     "v1.2.4",
+				Checksum:    fmt.Sprintf("%x", sha256.Sum256(newData)),
+				DownloadURL: "myapp-v1.2.4.gz",
+			})
+		case "/releases/myapp-v1.2.4.gz":
+			_, _ = w.Write(gz)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer mirror.Close()
+
+	t.Cleanup(func() { mirrorHealth = map[string]*mirrorStatus{} })
+
+	currPath := filepath.Join(t.TempDir(), "myapp")
+	if err := os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write temp exe: %v", err)
+	}
+
+	err := UpdateIfNewer(Config{
+		URL:        primary.URL + "/releases/metadata.json",
+		Mirrors:    []string{mirror.URL + "/releases/metadata.json"},
+		CurrentVer: "v1.2.3",
+		TargetPath: currPath,
+	})
+	if err != nil {
+		t.Fatalf("UpdateIfNewer returned error: %v", err)
+	}
+
+	got, err := os.ReadFile(currPath)
+	if err != nil {
+		t.Fatalf("read updated exe: %v", err)
+	}
+	if !bytes.Equal(got, newData) {
+		t.Fatalf("exe not replaced; got=%q", got)
+	}
+	// the failed primary is demoted, so the artifact comes straight from the mirror
+	if primaryHits != 1 {
+		t.Fatalf("primary hit %d times, want 1", primaryHits)
+	}
+}
+
+func TestUpdateIfNewer_AuthHeadersOnlyToMetadataHost(t *testing.T) {
+	newData := []byte("new-binary")
+	gz := gzipBytes(t, newData)
+
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" || r.Header.Get("X-Api-Key") != "" {
+			t.Errorf("credentials leaked to download host: %v", r.Header)
+		}
+		_, _ = w.Write(gz)
+	}))
+	defer cdn.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" || r.Header.Get("X-Api-Key") != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(metadata.Metadata{
+			Version:     "v1.2.4",
+			Checksum:    fmt.Sprintf("%x", sha256.Sum256(newData)),
+			DownloadURL: cdn.URL + "/myapp-v1.2.4.gz",
+		})
+	}))
+	defer srv.Close()
+
+	currPath := filepath.Join(t.TempDir(), "myapp")
+	if err := os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write temp exe: %v", err)
+	}
+
+	err := UpdateIfNewer(Config{
+		URL:        srv.URL + "/meta.json",
+		AuthToken:  "s3cret",
+		Headers:    map[string]string{"X-Api-Key": "key"},
+		CurrentVer: "v1.2.3",
+		TargetPath: currPath,
+	})
+	if err != nil {
+		t.Fatalf("UpdateIfNewer returned error: %v", err)
+	}
+
+	got, err := os.ReadFile(currPath)
+	if err != nil {
+		t.Fatalf("read updated exe: %v", err)
+	}
+	if !bytes.Equal(got, newData) {
+		t.Fatalf("exe not replaced; got=%q", got)
+	}
+}
+
+func TestUpdateIfNewer_HeadersNotRedirected(t *testing.T) {
+	newData := []byte("new-binary")
+	gz := gzipBytes(t, newData)
+
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" || r.Header.Get("X-Api-Key") != "" || r.Header.Get("Private-Token") != "" {
+			t.Errorf("credentials redirected to storage host: %v", r.Header)
+		}
+		_, _ = w.Write(gz)
+	}))
+	defer storage.Close()
+
+	var redirected bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "key" || r.Header.Get("PRIVATE-TOKEN") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/meta.json":
+			_ = json.NewEncoder(w).Encode(metadata.Metadata{
+				Version:     "v1.2.4",
+				Checksum:    fmt.Sprintf("%x", sha256.Sum256(newData)),
+				DownloadURL: "myapp-v1.2.4.gz",
+			})
+		case "/myapp-v1.2.4.gz": // e.g. to a signed storage URL
+			redirected = true
+			http.Redirect(w, r, storage.URL+"/signed/myapp-v1.2.4.gz", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	currPath := filepath.Join(t.TempDir(), "myapp")
+	if err := os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write temp exe: %v", err)
+	}
+
+	err := UpdateIfNewer(Config{
+		URL:        srv.URL + "/meta.json",
+		AuthToken:  "s3cret",
+		Headers:    map[string]string{"X-Api-Key": "key", "PRIVATE-TOKEN": "token"},
+		CurrentVer: "v1.2.3",
+		TargetPath: currPath,
+	})
+	if err != nil {
+		t.Fatalf("UpdateIfNewer returned error: %v", err)
+	}
+	if !redirected {
+		t.Fatal("artifact not redirected")
+	}
+	if got, _ := os.ReadFile(currPath); !bytes.Equal(got, newData) {
+		t.Fatalf("exe not replaced; got=%q", got)
+	}
+}
+
+func TestHasNewer_TLSPinning(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(metadata.Metadata{Version: "v1.2.4", Checksum: zeroSum, DownloadURL: "bin.gz"})
+	}))
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	cfg := Config{
+		URL:        srv.URL + "/meta.json",
+		CurrentVer: "v1.2.3",
+		TLS: &TLSConfig{
+			RootCAs:    roots,
+			PinnedSPKI: []string{SPKIHash(srv.Certificate())},
+		},
+	}
+	if newer, _, err := HasNewer(cfg); err != nil || !newer {
+		t.Fatalf("HasNewer = %v, %v; want true, nil", newer, err)
+	}
+
+	cfg.TLS.PinnedSPKI = []string{"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="}
+	if _, _, err := HasNewer(cfg); !errors.Is(err, ErrPinMismatch) {
+		t.Fatalf("err = %v, want ErrPinMismatch", err)
+	}
+
+	cfg.TLS = &TLSConfig{} // system roots don't trust the test server
+	if _, _, err := HasNewer(cfg); err == nil {
+		t.Fatal("expected certificate verification error")
+	}
+}
+
+func TestHasNewer_ConditionalMetadataRequest(t *testing.T) {
+	var full, notModified int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v124"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full++
+		w.Header().Set("ETag", `"v124"`)
+		_ = json.NewEncoder(w).Encode(metadata.Metadata{Version: "v1.2.4", Checksum: zeroSum, DownloadURL: "bin.gz"})
+	}))
+	defer srv.Close()
+
+	cfg := Config{
+		URL:        srv.URL + "/meta.json",
+		CurrentVer: "v1.2.3",
+		StatePath:  filepath.Join(t.TempDir(), "myapp.state"),
+	}
+
+	for i := 0; i < 3; i++ {
+		newer, m, err := HasNewer(cfg)
+		if err != nil || !newer || m.Version != "v1.2.4" {
+			t.Fatalf("check %d: HasNewer = %v, %+v, %v", i, newer, m, err)
+		}
+	}
+	if full != 1 || notModified != 2 {
+		t.Fatalf("full=%d notModified=%d, want 1 and 2", full, notModified)
+	}
+}
+
+func TestUpdateFromMetadata_ParallelChunks(t *testing.T) {
+	newData := bytes.Repeat([]byte("0123456789abcdef"), 3*minChunkSize/16+5)
+
+	var mu sync.Mutex
+	var ranges int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			mu.Lock()
+			ranges++
+			mu.Unlock()
+		}
+		http.ServeContent(w, r, "myapp", time.Time{}, bytes.NewReader(newData))
+	}))
+	defer srv.Close()
+
+	currPath := filepath.Join(t.TempDir(), "myapp")
+	if err := os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write temp exe: %v", err)
+	}
+
+	err := UpdateFromMetadata(Config{
+		URL:            srv.URL + "/meta.json",
+		CurrentVer:     "v1.2.3",
+		TargetPath:     currPath,
+		DownloadChunks: 4,
+	}, &metadata.Metadata{
+		Version:     "v1.2.4",
+		Checksum:    fmt.Sprintf("%x", sha256.Sum256(newData)),
+		DownloadURL: "myapp-linux-amd64",
+		Compression: "none",
+	})
+	if err != nil {
+		t.Fatalf("UpdateFromMetadata returned error: %v", err)
+	}
+
+	got, err := os.ReadFile(currPath)
+	if err != nil {
+		t.Fatalf("read updated exe: %v", err)
+	}
+	if !bytes.Equal(got, newData) {
+		t.Fatal("exe not replaced with the reassembled download")
+	}
+	if ranges != 3 {
+		t.Fatalf("got %d ranged requests, want 3", ranges)
+	}
+}
+
+func TestHasNewer_ProxyURL(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := parseProxyAuth(r.Header.Get("Proxy-Authorization"))
+		if !ok || user != "bob" || pass != "secret" {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		if r.URL.Host != "releases.invalid" {
+			t.Errorf("proxied host = %q", r.URL.Host)
+		}
+		_ = json.NewEncoder(w).Encode(metadata.Metadata{Version: "v1.2.4", Checksum: zeroSum, DownloadURL: "bin.gz"})
+	}))
+	defer proxy.Close()
+
+	newer, _, err := HasNewer(Config{
+		URL:        "http://releases.invalid/meta.json",
+		ProxyURL:   strings.Replace(proxy.URL, "http://", "http://bob:secret@", 1),
+		CurrentVer: "v1.2.3",
+	})
+	if err != nil || !newer {
+		t.Fatalf("HasNewer = %v, %v; want true, nil", newer, err)
+	}
+}
+
+func parseProxyAuth(h string) (user, pass string, ok bool) {
+	r := &http.Request{Header: http.Header{"Authorization": {h}}}
+	return r.BasicAuth()
+}
+
+func TestHasNewer_MetadataTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release // a hung endpoint
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	start := time.Now()
+	_, _, err := HasNewer(Config{
+		URL:             srv.URL + "/meta.json",
+		CurrentVer:      "v1.2.3",
+		MetadataTimeout: 50 * time.Millisecond,
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("HasNewer took %s", d)
+	}
+}
+
+func TestUpdateIfNewer_StructuredLogging(t *testing.T) {
+	newData := []byte("new-binary")
+	src := &memSource{
+		meta: metadata.Metadata{
+			Version:     "v1.2.4",
+			Checksum:    fmt.Sprintf("%x", sha256.Sum256(newData)),
+			DownloadURL: "myapp-v1.2.4.gz",
+		},
+		artifacts: map[string][]byte{"myapp-v1.2.4.gz": gzipBytes(t, newData)},
+	}
+
+	currPath := filepath.Join(t.TempDir(), "myapp")
+	if err := os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write temp exe: %v", err)
+	}
+
+	var buf bytes.Buffer
+	err := UpdateIfNewer(Config{
+		Source:     src,
+		CurrentVer: "v1.2.3",
+		TargetPath: currPath,
+		Logger:     slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	})
+	if err != nil {
+		t.Fatalf("UpdateIfNewer returned error: %v", err)
+	}
+
+	records := map[string]map[string]any{}
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var rec map[string]any
+		if err := json.Unmarshal(line, &rec); err != nil {
+			t.Fatalf("decode log record %q: %v", line, err)
+		}
+		records[rec["msg"].(string)] = rec
+	}
+
+	if rec := records["update check"]; rec == nil || rec["level"] != "DEBUG" || rec["version"] != "v1.2.4" || rec["newer"] != true {
+		t.Fatalf("update check record = %v", rec)
+	}
+	if rec := records["artifact downloaded"]; rec == nil || rec["bytes"] == nil || rec["duration"] == nil {
+		t.Fatalf("artifact downloaded record = %v", rec)
+	}
+	if rec := records["update installed, please restart manually"]; rec == nil || rec["level"] != "INFO" {
+		t.Fatalf("install record = %v", rec)
+	}
+}
+
+func TestUpdateIfNewer_Metrics(t *testing.T) {
+	newData := []byte("new-binary")
+	src := &memSource{
+		meta: metadata.Metadata{
+			Version:     "v1.2.4",
+			Checksum:    fmt.Sprintf("%x", sha256.Sum256(newData)),
+			DownloadURL: "myapp-v1.2.4.gz",
+		},
+		artifacts: map[string][]byte{"myapp-v1.2.4.gz": gzipBytes(t, newData)},
+	}
+
+	var events []string
+	metrics := &Metrics{
+		Check: func(_ time.Duration, newer bool, err error) {
+			events = append(events, fmt.Sprintf("check newer=%v err=%v", newer, err))
+		},
+		Download: func(url string, n int64, _ time.Duration, err error) {
+			events = append(events, fmt.Sprintf("download %s bytes=%d err=%v", url, n, err))
+		},
+		Verify: func(version string, err error) {
+			events = append(events, fmt.Sprintf("verify %s err=%v", version, err != nil))
+		},
+		Install: func(version string, _ time.Duration, err error) {
+			events = append(events, fmt.Sprintf("install %s err=%v", version, err != nil))
+		},
+	}
+
+	currPath := filepath.Join(t.TempDir(), "myapp")
+	if err := os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write temp exe: %v", err)
+	}
+	cfg := Config{Source: src, CurrentVer: "v1.2.3", TargetPath: currPath, Metrics: metrics}
+
+	if err := UpdateIfNewer(cfg); err != nil {
+		t.Fatalf("UpdateIfNewer returned error: %v", err)
+	}
+
+	src.meta.Checksum = strings.Repeat("0", 64)
+	if err := UpdateIfNewer(cfg); err == nil {
+		t.Fatal("expected checksum error")
+	}
+
+	gzLen := len(src.artifacts["myapp-v1.2.4.gz"])
+	want := []string{
+		"check newer=true err=<nil>",
+		fmt.Sprintf("download myapp-v1.2.4.gz bytes=%d err=<nil>", gzLen),
+		"verify v1.2.4 err=false",
+		"install v1.2.4 err=false",
+		"check newer=true err=<nil>",
+		fmt.Sprintf("download myapp-v1.2.4.gz bytes=%d err=<nil>", gzLen),
+		"verify v1.2.4 err=true",
+		"install v1.2.4 err=true",
+	}
+	if strings.Join(events, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("events:\n%s\nwant:\n%s", strings.Join(events, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestDownloadThenApply(t *testing.T) {
+	newData := []byte("new-binary")
+	src := &memSource{
+		meta: metadata.Metadata{
+			Version:     "v1.2.4",
+			Checksum:    fmt.Sprintf("%x", sha256.Sum256(newData)),
+			DownloadURL: "myapp-v1.2.4.gz",
+		},
+		artifacts: map[string][]byte{"myapp-v1.2.4.gz": gzipBytes(t, newData)},
+	}
+
+	currPath := filepath.Join(t.TempDir(), "myapp")
+	if err := os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write temp exe: %v", err)
+	}
+	cfg := Config{Source: src, CurrentVer: "v1.2.3", TargetPath: currPath}
+
+	staged, err := Download(cfg, &src.meta)
+	if err != nil {
+		t.Fatalf("Download returned error: %v", err)
+	}
+	if got, _ := os.ReadFile(currPath); string(got) != "old-binary" {
+		t.Fatalf("Download touched the executable: %q", got)
+	}
+
+	// tampering with the staged binary is detected
+	if err := os.WriteFile(staged.Path, []byte("evil"), 0o755); err != nil {
+		t.Fatalf("tamper: %v", err)
+	}
+	if err := Apply(staged); err == nil {
+		t.Fatal("expected checksum error for tampered staged update")
+	}
+	if got, _ := os.ReadFile(currPath); string(got) != "old-binary" {
+		t.Fatalf("tampered update was applied: %q", got)
+	}
+
+	staged, err = Download(cfg, &src.meta)
+	if err != nil {
+		t.Fatalf("Download returned error: %v", err)
+	}
+	if err := Apply(staged); err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	got, err := os.ReadFile(currPath)
+	if err != nil {
+		t.Fatalf("read updated exe: %v", err)
+	}
+	if !bytes.Equal(got, newData) {
+		t.Fatalf("exe not replaced; got=%q", got)
+	}
+	if _, err := os.Stat(staged.Path); !os.IsNotExist(err) {
+		t.Fatalf("staged file left behind: %v", err)
+	}
+}
+
+func TestUpdateIfNewer_ApplyOnExit(t *testing.T) {
+	newData := []byte("new-binary")
+	src := &memSource{
+		meta: metadata.Metadata{
+			Version:     "v1.2.4",
+			Checksum:    fmt.Sprintf("%x", sha256.Sum256(newData)),
+			DownloadURL: "myapp-v1.2.4.gz",
+		},
+		artifacts: map[string][]byte{"myapp-v1.2.4.gz": gzipBytes(t, newData)},
+	}
+
+	currPath := filepath.Join(t.TempDir(), "myapp")
+	if err := os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write temp exe: %v", err)
+	}
+	cfg := Config{Source: src, CurrentVer: "v1.2.3", TargetPath: currPath, ApplyOn: OnExit}
+
+	for i := 0; i < 2; i++ {
+		if err := UpdateIfNewer(cfg); err != nil {
+			t.Fatalf("UpdateIfNewer returned error: %v", err)
+		}
+	}
+	if !HasPending() {
+		t.Fatal("expected a pending update")
+	}
+	if got, _ := os.ReadFile(currPath); string(got) != "old-binary" {
+		t.Fatalf("update applied before exit: %q", got)
+	}
+
+	if err := ApplyPending(); err != nil {
+		t.Fatalf("ApplyPending returned error: %v", err)
+	}
+	if HasPending() {
+		t.Fatal("pending update not cleared")
+	}
+	got, err := os.ReadFile(currPath)
+	if err != nil {
+		t.Fatalf("read updated exe: %v", err)
+	}
+	if !bytes.Equal(got, newData) {
+		t.Fatalf("exe not replaced; got=%q", got)
+	}
+}
+
+func TestVerifySelf(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	exe := filepath.Join(t.TempDir(), "myapp")
+	if err := os.WriteFile(exe, []byte("genuine-binary"), 0o755); err != nil {
+		t.Fatalf("write exe: %v", err)
+	}
+	oldExecutable := executable
+	defer func() { executable = oldExecutable }()
+	executable = func() (string, error) { return exe, nil }
+
+	sum := fmt.Sprintf("%x", sha256.Sum256([]byte("genuine-binary")))
+	m := &metadata.Metadata{
+		Version:   "v1.2.3",
+		Checksum:  sum,
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte("v1.2.3+"+sum))),
+	}
+	if err := VerifySelf(pub, m); err != nil {
+		t.Fatalf("VerifySelf returned error: %v", err)
+	}
+
+	if err := os.WriteFile(exe, []byte("patched-binary"), 0o755); err != nil {
+		t.Fatalf("tamper: %v", err)
+	}
+	if err := VerifySelf(pub, m); !errors.Is(err, ErrTampered) {
+		t.Fatalf("err = %v, want ErrTampered", err)
+	}
+
+	forged := *m
+	forged.Checksum = fmt.Sprintf("%x", sha256.Sum256([]byte("patched-binary")))
+	if err := VerifySelf(pub, &forged); !errors.Is(err, ErrTampered) {
+		t.Fatalf("err = %v, want ErrTampered for forged metadata", err)
+	}
+}
+
+func TestHelperRetry(t *testing.T) {
+	r := HelperRetry{Attempts: 4, Interval: 10 * time.Millisecond, Backoff: 2}
+
+	env := map[string]string{}
+	for _, kv := range r.env() {
+		k, v, _ := strings.Cut(kv, "=")
+		env[k] = v
+	}
+	if got := helperRetryFromEnv(func(k string) string { return env[k] }); got != r {
+		t.Fatalf("round trip = %+v, want %+v", got, r)
+	}
+	if got := helperRetryFromEnv(func(string) string { return "" }); got.Attempts != 100 || got.Interval != 200*time.Millisecond {
+		t.Fatalf("defaults = %+v", got)
+	}
+
+	var sleeps []time.Duration
+	sleep := func(d time.Duration) { sleeps = append(sleeps, d) }
+	locked := errors.New("sharing violation")
+
+	err := r.do(func() error { return locked }, sleep)
+	if !errors.Is(err, ErrExecutableLocked) || !errors.Is(err, locked) {
+		t.Fatalf("err = %v, want ErrExecutableLocked wrapping the last error", err)
+	}
+	want := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond}
+	if fmt.Sprint(sleeps) != fmt.Sprint(want) {
+		t.Fatalf("sleeps = %v, want %v", sleeps, want)
+	}
+
+	calls := 0
+	if err := r.do(func() error {
+		calls++
+		if calls < 2 {
+			return locked
+		}
+		return nil
+	}, sleep); err != nil || calls != 2 {
+		t.Fatalf("do = %v after %d calls", err, calls)
+	}
+}
+
+func TestLastHelperResult(t *testing.T) {
+	exe := filepath.Join(t.TempDir(), "myapp")
+	oldExecutable := executable
+	defer func() { executable = oldExecutable }()
+	executable = func() (string, error) { return exe, nil }
+
+	if res, err := LastHelperResult(); res != nil || err != nil {
+		t.Fatalf("LastHelperResult without result = %+v, %v", res, err)
+	}
+
+	want := HelperResult{
+		Version:  "v1.2.4",
+		Error:    "executable still locked after 100 attempts",
+		Started:  time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		Finished: time.Date(2025, 1, 2, 3, 4, 25, 0, time.UTC),
+	}
+	if err := writeHelperResult(exe, want); err != nil {
+		t.Fatalf("writeHelperResult: %v", err)
+	}
+
+	res, err := LastHelperResult()
+	if err != nil {
+		t.Fatalf("LastHelperResult returned error: %v", err)
+	}
+	if *res != want {
+		t.Fatalf("LastHelperResult = %+v, want %+v", *res, want)
+	}
+}
+
+func TestHelperLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "helper.log")
+	env := Config{HelperLogFile: path, HelperEventSource: "myapp"}.helperLogEnv()
+	getenv := func(key string) string {
+		for _, kv := range env {
+			if k, v, _ := strings.Cut(kv, "="); k == key {
+				return v
+			}
+		}
+		return ""
+	}
+	if getenv(envHelperEventSource) != "myapp" {
+		t.Fatalf("helperLogEnv = %q", env)
+	}
+
+	hlog := openHelperLog(getenv)
+	hlog.infof("installing %s", "v1.2.4")
+	hlog.errorf("failed: %v", ErrExecutableLocked)
+	hlog.close()
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read helper log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], "INFO installing v1.2.4") ||
+		!strings.HasSuffix(lines[1], "ERROR failed: executable still locked") {
+		t.Fatalf("helper log = %q", b)
+	}
+
+	// a nil log discards everything
+	var none *helperLog
+	none.infof("ignored")
+	none.close()
+}
+
+func TestUpdateIfNewer_Slots(t *testing.T) {
+	dir := t.TempDir()
+	slots := &Slots{
+		A:       filepath.Join(dir, "a", "agent"),
+		B:       filepath.Join(dir, "b", "agent"),
+		Pointer: filepath.Join(dir, "active"),
+	}
+	for _, p := range []string{slots.A, slots.B} {
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+	}
+	if err := os.WriteFile(slots.A, []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write slot A: %v", err)
+	}
+
+	newData := []byte("new-binary")
+	err := UpdateIfNewer(Config{
+		Applier:    slots,
+		CurrentVer: "v1.2.3",
+		TargetPath: slots.A,
+		Source: &memSource{
+			meta: metadata.Metadata{
+				Version:     "v1.2.4",
+				Checksum:    fmt.Sprintf("%x", sha256.Sum256(newData)),
+				DownloadURL: "agent.gz",
+			},
+			artifacts: map[string][]byte{"agent.gz": gzipBytes(t, newData)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("UpdateIfNewer returned error: %v", err)
+	}
+
+	// the update went to the inactive slot, which is now active
+	if active, _ := slots.Active(); active != slots.B {
+		t.Fatalf("Active = %q, want slot B", active)
+	}
+	if got, _ := os.ReadFile(slots.B); !bytes.Equal(got, newData) {
+		t.Fatalf("slot B = %q", got)
+	}
+	if got, _ := os.ReadFile(slots.A); string(got) != "old-binary" {
+		t.Fatalf("slot A was modified: %q", got)
+	}
+
+	if err = slots.Switch(); err != nil {
+		t.Fatalf("Switch: %v", err)
+	}
+	if active, _ := slots.Active(); active != slots.A {
+		t.Fatalf("Active after Switch = %q, want slot A", active)
+	}
+}
+
+func TestUpdateIfNewer_Managed(t *testing.T) {
+	// the running executable must not be touched
+	oldExecutable := executable
+	defer func() { executable = oldExecutable }()
+	executable = func() (string, error) { t.Fatal("executable used for a managed binary"); return "", nil }
+
+	newData := []byte("plugin-v2")
+	plugin := filepath.Join(t.TempDir(), "plugin")
+	cfg := Config{
+		Managed:     true,
+		AutoRestart: true, // ignored
+		TargetPath:  plugin,
+		Source: &memSource{
+			meta: metadata.Metadata{
+				Version:     "v2.0.0",
+				Checksum:    fmt.Sprintf("%x", sha256.Sum256(newData)),
+				DownloadURL: "plugin.gz",
+			},
+			artifacts: map[string][]byte{"plugin.gz": gzipBytes(t, newData)},
+		},
+	}
+
+	// not installed yet: installed regardless of CurrentVer
+	if err := UpdateIfNewer(cfg); err != nil {
+		t.Fatalf("UpdateIfNewer returned error: %v", err)
+	}
+	if got, _ := os.ReadFile(plugin); !bytes.Equal(got, newData) {
+		t.Fatalf("plugin = %q", got)
+	}
+
+	// installed and current
+	cfg.CurrentVer = "v2.0.0"
+	if newer, _, err := HasNewer(cfg); err != nil || newer {
+		t.Fatalf("HasNewer = %v, %v", newer, err)
+	}
+
+	cfg.TargetPath, cfg.CurrentVer = "", "v1.0.0"
+	if err := UpdateIfNewer(cfg); err == nil {
+		t.Fatal("managed update without TargetPath succeeded")
+	}
+}
+
+// fleetServer serves the fleet of the given tools, signed by priv, at
+// /fleet.json along with their artifacts. Every tool is released for the
+// current platform only.
+type fleetServer struct {
+	*httptest.Server
+	priv      ed25519.PrivateKey
+	fleet     metadata.Fleet
+	artifacts map[string][]byte
+}
+
+func newFleetServer(t *testing.T, priv ed25519.PrivateKey) *fleetServer {
+	t.Helper()
+	fs := &fleetServer{priv: priv, artifacts: map[string][]byte{}}
+	fs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fleet.json" {
+			_ = json.NewEncoder(w).Encode(fs.fleet)
+			return
+		}
+		b, ok := fs.artifacts[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(b)
+	}))
+	t.Cleanup(fs.Close)
+	return fs
+}
+
+// release returns the signed release of tool name, adding its artifact.
+func (fs *fleetServer) release(t *testing.T, name, version, data string) metadata.Metadata {
+	t.Helper()
+	m := metadata.Metadata{
+		Version:     version,
+		Checksum:    fmt.Sprintf("%x", sha256.Sum256([]byte(data))),
+		DownloadURL: name + "-" + version + ".gz",
+	}
+	if err := m.Sign(signing.KeySigner(fs.priv)); err != nil {
+		t.Fatalf("sign release: %v", err)
+	}
+	fs.artifacts["/"+m.DownloadURL] = gzipBytes(t, []byte(data))
+	return m
+}
+
+// serve serves a fleet of the given releases by tool name, signed unless
+// the releases are tampered with afterwards.
+func (fs *fleetServer) serve(t *testing.T, releases map[string]metadata.Metadata) {
+	t.Helper()
+	platform := runtime.GOOS + "/" + runtime.GOARCH
+	fs.fleet = metadata.Fleet{}
+	for _, name := range slices.Sorted(maps.Keys(releases)) {
+		fs.fleet.Tools = append(fs.fleet.Tools, metadata.FleetTool{
+			Name:      name,
+			Platforms: map[string]metadata.Metadata{platform: releases[name]},
+		})
+	}
+	if err := fs.fleet.Sign(signing.KeySigner(fs.priv)); err != nil {
+		t.Fatalf("sign fleet: %v", err)
+	}
+}
+
+func fleetResults(results []FleetResult) map[string]FleetResult {
+	got := map[string]FleetResult{}
+	for _, r := range results {
+		got[r.Name] = r
+	}
+	return got
+}
+
+// installTools writes the tools of dir, by name, with the given contents.
+func installTools(t *testing.T, dir string, tools map[string]string) func(string) string {
+	t.Helper()
+	exe := func(name string) string {
+		if runtime.GOOS == "windows" {
+			name += ".exe"
+		}
+		return filepath.Join(dir, name)
+	}
+	for name, data := range tools {
+		if err := os.WriteFile(exe(name), []byte(data), 0o755); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	return exe
+}
+
+func TestUpdateFleet(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	srv := newFleetServer(t, priv)
+	srv.serve(t, map[string]metadata.Metadata{
+		"deploy": srv.release(t, "deploy", "v2.0.0", "deploy-v2"),
+		"lint":   srv.release(t, "lint", "v1.1.0", "lint-v1.1"),
+		"other":  srv.release(t, "other", "v1.0.0", "other-v1"), // not installed
+	})
+	srv.fleet.Tools = append(srv.fleet.Tools, metadata.FleetTool{Name: "legacy", Platforms: map[string]metadata.Metadata{"plan9/386": {}}})
+	srv.fleet.Signatures = nil
+	if err = srv.fleet.Sign(signing.KeySigner(priv)); err != nil {
+		t.Fatalf("sign fleet: %v", err)
+	}
+
+	dir := t.TempDir()
+	exe := installTools(t, dir, map[string]string{"deploy": "deploy-v1", "lint": "lint-v1.1", "legacy": "legacy"})
+	cfg := Config{URL: srv.URL + "/fleet.json", PubKey: pub}
+
+	// deploy was installed by other means: its version is unknown
+	results, err := UpdateFleet(cfg, dir)
+	if err != nil {
+		t.Fatalf("UpdateFleet returned error: %v", err)
+	}
+	if r := fleetResults(results)["deploy"]; r.Updated || !errors.Is(r.Err, ErrNotNewer) || r.Reason != ReasonUnknownVersion {
+		t.Fatalf("deploy of unknown version = %+v", r)
+	}
+
+	if err = saveState(filepath.Join(dir, fleetBase+stateSuffix), &fleetState{Versions: map[string]string{"deploy": "v1.0.0"}}); err != nil {
+		t.Fatal(err)
+	}
+	if results, err = UpdateFleet(cfg, dir); err != nil {
+		t.Fatalf("UpdateFleet returned error: %v", err)
+	}
+	got := fleetResults(results)
+	if len(got) != 3 {
+		t.Fatalf("results = %+v, want deploy, lint and legacy", results)
+	}
+	if r := got["deploy"]; !r.Updated || r.Err != nil || r.Version != "v2.0.0" {
+		t.Fatalf("deploy = %+v", r)
+	}
+	if b, _ := os.ReadFile(exe("deploy")); string(b) != "deploy-v2" {
+		t.Fatalf("deploy not updated: %q", b)
+	}
+	if r := got["lint"]; r.Updated || r.Err != nil {
+		t.Fatalf("lint = %+v, want up to date", r)
+	}
+	if r := got["legacy"]; r.Err == nil {
+		t.Fatalf("legacy = %+v, want an error for the missing platform", r)
+	}
+
+	st := loadFleetState(filepath.Join(dir, fleetBase+stateSuffix), t.Logf)
+	if want := map[string]string{"deploy": "v2.0.0", "lint": "v1.1.0"}; !maps.Equal(st.Versions, want) {
+		t.Fatalf("fleet state = %v, want %v", st.Versions, want)
+	}
+}
+
+func TestUpdateFleet_Unsigned(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	srv := newFleetServer(t, priv)
+	srv.serve(t, map[string]metadata.Metadata{"deploy": srv.release(t, "deploy", "v2.0.0", "deploy-v2")})
+	dir := t.TempDir()
+	exe := installTools(t, dir, map[string]string{"deploy": "deploy-v1"})
+
+	srv.fleet.Signatures = nil
+	if _, err = UpdateFleet(Config{URL: srv.URL + "/fleet.json", PubKey: pub}, dir); !errors.Is(err, ErrInsufficientSignatures) {
+		t.Fatalf("UpdateFleet of an unsigned fleet = %v", err)
+	}
+	if _, err = UpdateFleet(Config{URL: srv.URL + "/fleet.json"}, dir); err == nil {
+		t.Fatal("UpdateFleet without a public key succeeded")
+	}
+	if b, _ := os.ReadFile(exe("deploy")); string(b) != "deploy-v1" {
+		t.Fatalf("deploy replaced: %q", b)
+	}
+}
+
+func TestUpdateFleet_SubstitutedTool(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	srv := newFleetServer(t, priv)
+	deploy := srv.release(t, "deploy", "v2.0.0", "deploy-v2")
+	srv.serve(t, map[string]metadata.Metadata{
+		"deploy": deploy,
+		"lint":   srv.release(t, "lint", "v1.1.0", "lint-v1.1"),
+	})
+
+	dir := t.TempDir()
+	exe := installTools(t, dir, map[string]string{"deploy": "deploy-v1", "lint": "lint-v1.0"})
+	if err = saveState(filepath.Join(dir, fleetBase+stateSuffix), &fleetState{Versions: map[string]string{"deploy": "v1.0.0", "lint": "v1.0.0"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// deploy's signed release listed under lint's name
+	for i := range srv.fleet.Tools {
+		if srv.fleet.Tools[i].Name == "lint" {
+			srv.fleet.Tools[i].Platforms[runtime.GOOS+"/"+runtime.GOARCH] = deploy
+		}
+	}
+	if _, err = UpdateFleet(Config{URL: srv.URL + "/fleet.json", PubKey: pub}, dir); !errors.Is(err, ErrInsufficientSignatures) {
+		t.Fatalf("UpdateFleet of a tampered fleet = %v", err)
+	}
+	if b, _ := os.ReadFile(exe("lint")); string(b) != "lint-v1.0" {
+		t.Fatalf("lint replaced: %q", b)
+	}
+}
+
+func TestUpdateFleet_ReplayedRelease(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	srv := newFleetServer(t, priv)
+	v1 := srv.release(t, "deploy", "v1.0.0", "deploy-v1")
+	v2 := srv.release(t, "deploy", "v2.0.0", "deploy-v2")
+
+	dir := t.TempDir()
+	exe := installTools(t, dir, map[string]string{"deploy": "deploy-v1"})
+	cfg := Config{URL: srv.URL + "/fleet.json", PubKey: pub}
+
+	// adopted at v1.0.0, then updated to v2.0.0
+	for _, m := range []metadata.Metadata{v1, v2} {
+		srv.serve(t, map[string]metadata.Metadata{"deploy": m})
+		results, err := UpdateFleet(cfg, dir)
+		if err != nil || len(results) != 1 || results[0].Err != nil {
+			t.Fatalf("UpdateFleet to %s = %+v, %v", m.Version, results, err)
+		}
+	}
+	if b, _ := os.ReadFile(exe("deploy")); string(b) != "deploy-v2" {
+		t.Fatalf("deploy = %q, want v2", b)
+	}
+
+	// the signed fleet of v1.0.0 replayed
+	srv.serve(t, map[string]metadata.Metadata{"deploy": v1})
+	results, err := UpdateFleet(cfg, dir)
+	if err != nil {
+		t.Fatalf("UpdateFleet returned error: %v", err)
+	}
+	if r := results[0]; r.Updated || !errors.Is(r.Err, ErrNotNewer) {
+		t.Fatalf("replayed release = %+v, want ErrNotNewer", r)
+	}
+	if b, _ := os.ReadFile(exe("deploy")); string(b) != "deploy-v2" {
+		t.Fatalf("deploy downgraded: %q", b)
+	}
+
+	cfg.AllowDowngrade = true
+	if results, err = UpdateFleet(cfg, dir); err != nil || !results[0].Updated {
+		t.Fatalf("UpdateFleet with AllowDowngrade = %+v, %v", results, err)
+	}
+	if b, _ := os.ReadFile(exe("deploy")); string(b) != "deploy-v1" {
+		t.Fatalf("deploy = %q, want v1", b)
+	}
+}
+
+func TestHasNewer_SkipVersion(t *testing.T) {
+	latest := "v1.2.4"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(metadata.Metadata{Version: latest, Checksum: zeroSum, DownloadURL: "bin.gz"})
+	}))
+	defer srv.Close()
+
+	cfg := Config{
+		URL:        srv.URL + "/meta.json",
+		CurrentVer: "v1.2.3",
+		TargetPath: filepath.Join(t.TempDir(), "myapp"),
+	}
+	if err := SkipVersion(cfg, "v1.2.4"); err != nil {
+		t.Fatalf("SkipVersion returned error: %v", err)
+	}
+	if newer, _, err := HasNewer(cfg); err != nil || newer {
+		t.Fatalf("HasNewer for a skipped version = %v, %v", newer, err)
+	}
+
+	latest = "v1.2.5"
+	if newer, _, err := HasNewer(cfg); err != nil || !newer {
+		t.Fatalf("HasNewer for a later version = %v, %v", newer, err)
+	}
+}
+
+func TestHasNewer_Snooze(t *testing.T) {
+	latest := metadata.Metadata{Version: "v1.2.4", Checksum: zeroSum, DownloadURL: "bin.gz"}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(latest)
+	}))
+	defer srv.Close()
+
+	cfg := Config{
+		URL:        srv.URL + "/meta.json",
+		CurrentVer: "v1.2.3",
+		StatePath:  filepath.Join(t.TempDir(), "myapp.state"),
+	}
+	check := func(want bool) {
+		t.Helper()
+		if newer, _, err := HasNewer(cfg); err != nil || newer != want {
+			t.Fatalf("HasNewer(%s) = %v, %v; want %v", latest.Version, newer, err, want)
+		}
+	}
+
+	if err := SnoozeVersion(cfg, "v1.2.4", time.Hour); err != nil {
+		t.Fatalf("SnoozeVersion returned error: %v", err)
+	}
+	check(false)
+	latest.Version = "v1.2.5" // a later release breaks through
+	check(true)
+
+	if err := Snooze(cfg, time.Hour); err != nil {
+		t.Fatalf("Snooze returned error: %v", err)
+	}
+	check(false)
+	latest.Mandatory = true
+	check(true)
+
+	latest.Mandatory = false
+	if err := Snooze(cfg, -time.Second); err != nil { // expired
+		t.Fatalf("Snooze returned error: %v", err)
+	}
+	check(true)
+}
+
+// feedSource serves a metadata feed listing several releases.
+type feedSource struct {
+	memSource
+	feed metadata.Feed
+}
+
+func (s *feedSource) FetchMetadata(context.Context) (io.ReadCloser, error) {
+	b, err := json.Marshal(s.feed)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func TestAvailableVersions_UpdateTo(t *testing.T) {
+	src := &feedSource{memSource: memSource{artifacts: map[string][]byte{}}}
+	for _, v := range []string{"v1.2.4", "v1.10.0", "v1.2.3", "v1.3.0"} {
+		data := []byte("binary-" + v)
+		src.feed.Releases = append(src.feed.Releases, metadata.Metadata{
+			Version:     v,
+			Checksum:    fmt.Sprintf("%x", sha256.Sum256(data)),
+			DownloadURL: "myapp-" + v + ".gz",
+		})
+		src.artifacts["myapp-"+v+".gz"] = gzipBytes(t, data)
+	}
+
+	currPath := filepath.Join(t.TempDir(), "myapp")
+	if err := os.WriteFile(currPath, []byte("binary-v1.3.0"), 0o755); err != nil {
+		t.Fatalf("write temp exe: %v", err)
+	}
+	cfg := Config{Source: src, CurrentVer: "v1.3.0", TargetPath: currPath}
+
+	releases, err := AvailableVersions(cfg)
+	if err != nil {
+		t.Fatalf("AvailableVersions: %v", err)
+	}
+	var got []string
+	for _, m := range releases {
+		got = append(got, m.Version)
+	}
+	if want := []string{"v1.2.3", "v1.2.4", "v1.3.0", "v1.10.0"}; !slices.Equal(got, want) {
+		t.Fatalf("AvailableVersions = %v, want %v", got, want)
+	}
+
+	newer, m, err := HasNewer(cfg)
+	if err != nil || !newer || m.Version != "v1.10.0" {
+		t.Fatalf("HasNewer = %v, %+v, %v; want the latest release", newer, m, err)
+	}
+
+	if err = UpdateTo(cfg, "1.2.4"); !errors.Is(err, ErrDowngrade) {
+		t.Fatalf("UpdateTo older version: %v, want ErrDowngrade", err)
+	}
+	if b, _ := os.ReadFile(currPath); string(b) != "binary-v1.3.0" {
+		t.Fatalf("exe = %q, want v1.3.0", b)
+	}
+	if err = UpdateTo(cfg, "1.3.0"); err != nil {
+		t.Fatalf("UpdateTo current version: %v", err)
+	}
+
+	cfg.AllowDowngrade = true
+	if err = UpdateTo(cfg, "1.2.4"); err != nil {
+		t.Fatalf("UpdateTo: %v", err)
+	}
+	if b, _ := os.ReadFile(currPath); string(b) != "binary-v1.2.4" {
+		t.Fatalf("exe = %q, want v1.2.4", b)
+	}
+
+	if err = UpdateTo(cfg, "v9.9.9"); !errors.Is(err, ErrVersionNotFound) {
+		t.Fatalf("UpdateTo unknown version: %v, want ErrVersionNotFound", err)
+	}
+}
+
+func TestUpdateIfNewer_URLPlaceholders(t *testing.T) {
+	newData := []byte("new-binary")
+	gz := gzipBytes(t, newData)
+	platform := runtime.GOOS + "-" + runtime.GOARCH
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/" + platform + "/v1.2.3/metadata.json":
+			_ = json.NewEncoder(w).Encode(metadata.Metadata{
+				Version:     "v1.2.4",
+				Checksum:    fmt.Sprintf("%x", sha256.Sum256(newData)),
+				DownloadURL: "/releases/{{.Version}}/myapp_{{.OS}}_{{.Arch}}.gz",
+			})
+		case "/releases/v1.2.4/myapp_" + runtime.GOOS + "_" + runtime.GOARCH + ".gz":
+			_, _ = w.Write(gz)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	currPath := filepath.Join(t.TempDir(), "myapp")
+	if err := os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write temp exe: %v", err)
+	}
+
+	err := UpdateIfNewer(Config{
+		URL:        srv.URL + "/{{.OS}}-{{.Arch}}/{{.Version}}/metadata.json",
+		CurrentVer: "v1.2.3",
+		TargetPath: currPath,
+	})
+	if err != nil {
+		t.Fatalf("UpdateIfNewer returned error: %v", err)
+	}
+
+	got, err := os.ReadFile(currPath)
+	if err != nil {
+		t.Fatalf("read updated exe: %v", err)
+	}
+	if !bytes.Equal(got, newData) {
+		t.Fatalf("exe not replaced; got=%q", got)
+	}
+}
+
+func TestHasNewer_Prerelease(t *testing.T) {
+	src := &feedSource{}
+	for _, v := range []string{"v1.2.4", "v1.3.0-rc.1", "v1.2.5-beta.1"} {
+		src.feed.Releases = append(src.feed.Releases, metadata.Metadata{Version: v, Checksum: zeroSum, DownloadURL: "myapp-" + v + ".gz"})
+	}
+
+	for _, tc := range []struct {
+		name            string
+		current         string
+		allowPrerelease bool
+		want            string
+		newer           bool
+	}{
+		{name: "stable channel", current: "v1.2.3", want: "v1.2.4", newer: true},
+		{name: "beta channel", current: "v1.2.3", allowPrerelease: true, want: "v1.3.0-rc.1", newer: true},
+		{name: "pre-release installed", current: "v1.2.5-beta.0", want: "v1.2.4"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			newer, m, err := HasNewer(Config{Source: src, CurrentVer: tc.current, AllowPrerelease: tc.allowPrerelease})
+			if err != nil {
+				t.Fatalf("HasNewer: %v", err)
+			}
+			if m.Version != tc.want {
+				t.Fatalf("latest = %s, want %s", m.Version, tc.want)
+			}
+			if newer != tc.newer {
+				t.Fatalf("newer = %v, want %v", newer, tc.newer)
+			}
+		})
+	}
+}
+
+func TestHasNewer_CompatibleWith(t *testing.T) {
+	src := &feedSource{}
+	for _, r := range []struct{ v, compatibleWith string }{{"v1.4.0", "^1.0.0"}, {"v2.0.0", ">=1.4.0"}} {
+		src.feed.Releases = append(src.feed.Releases, metadata.Metadata{
+			Version: r.v, Checksum: zeroSum, DownloadURL: "myapp-" + r.v + ".gz", CompatibleWith: r.compatibleWith,
+		})
+	}
+
+	for _, tc := range []struct {
+		current string
+		want    string
+		newer   bool
+	}{
+		{current: "v1.2.0", want: "v1.4.0", newer: true},
+		{current: "v1.4.0", want: "v2.0.0", newer: true},
+		{current: "v0.9.0", want: "v2.0.0"},
+	} {
+		t.Run(tc.current, func(t *testing.T) {
+			newer, m, err := HasNewer(Config{Source: src, CurrentVer: tc.current})
+			if err != nil {
+				t.Fatalf("HasNewer: %v", err)
+			}
+			if m.Version != tc.want || newer != tc.newer {
+				t.Fatalf("HasNewer = %v, %s; want %v, %s", newer, m.Version, tc.newer, tc.want)
+			}
+		})
+	}
+}
+
+func TestNew_CurrentVerFromBuildInfo(t *testing.T) {
+	defer func(f func() string) { buildVersion = f }(buildVersion)
+	buildVersion = func() string { return "v1.2.3" }
+
+	if got := New(Config{}).Config().CurrentVer; got != "v1.2.3" {
+		t.Fatalf("CurrentVer = %q, want the build version", got)
+	}
+	if got := New(Config{CurrentVer: "v1.0.0"}).Config().CurrentVer; got != "v1.0.0" {
+		t.Fatalf("CurrentVer = %q, want the configured version", got)
+	}
+	// the build version is the running binary's, not another target's
+	if got := New(Config{TargetPath: "/opt/tool"}).Config().CurrentVer; got != "" {
+		t.Fatalf("CurrentVer of another target = %q, want none", got)
+	}
+}
+
+func TestPlan_DevVersionPolicy(t *testing.T) {
+	src := &memSource{meta: metadata.Metadata{Version: "v1.2.4", Checksum: zeroSum, DownloadURL: "myapp.gz", CompatibleWith: "^1.0.0"}}
+
+	for _, tc := range []struct {
+		name     string
+		current  string
+		policy   DevVersionPolicy
+		newer    bool
+		reason   NoUpdateReason
+		warnings int
+	}{
+		{name: "skip", current: "dev", reason: ReasonDevVersion},
+		{name: "warn", current: "v1.3.0-dev.2", policy: DevWarn, reason: ReasonDevVersion, warnings: 1},
+		{name: "as zero", current: "dev", policy: DevAsZero, newer: true},
+		{name: "up to date", current: "v1.2.4", policy: DevAsZero, reason: ReasonUpToDate},
+		{name: "incompatible", current: "v0.9.0", reason: ReasonIncompatible},
+		{name: "unknown", current: "", reason: ReasonUnknownVersion},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var warnings int
+			p, err := Plan(Config{
+				Source: src, CurrentVer: tc.current, TargetPath: "myapp", DevVersionPolicy: tc.policy,
+				LogInfo: func(format string, _ ...interface{}) {
+					if strings.HasPrefix(format, "development version") {
+						warnings++
+					}
+				},
+			})
+			if err != nil {
+				t.Fatalf("Plan: %v", err)
+			}
+			if p.Newer != tc.newer || p.Reason != tc.reason {
+				t.Fatalf("Plan = %v (%q), want %v (%q)", p.Newer, p.Reason, tc.newer, tc.reason)
+			}
+			if warnings != tc.warnings {
+				t.Fatalf("%d warnings, want %d", warnings, tc.warnings)
+			}
+		})
+	}
+}
+
+func TestHasNewer_CalVer(t *testing.T) {
+	src := &feedSource{}
+	for _, v := range []string{"2024.06.1", "2024.10", "2024.9.3", "2025.01.0-rc.1"} {
+		src.feed.Releases = append(src.feed.Releases, metadata.Metadata{Version: v, Checksum: zeroSum, DownloadURL: "myapp-" + v + ".gz"})
+	}
+
+	newer, m, err := HasNewer(Config{Source: src, CurrentVer: "2024.09.3", VersionScheme: CalVer})
+	if err != nil {
+		t.Fatalf("HasNewer: %v", err)
+	}
+	if !newer || m.Version != "2024.10" {
+		t.Fatalf("HasNewer = %v, %s; want 2024.10", newer, m.Version)
+	}
+
+	// 2024.10 isn't a semantic version
+	if _, _, err = HasNewer(Config{Source: src, CurrentVer: "2024.09.3"}); !errors.Is(err, metadata.ErrInvalid) {
+		t.Fatalf("HasNewer with SemVer: %v, want ErrInvalid", err)
+	}
+}
+
+func TestVersionComparator(t *testing.T) {
+	src := &feedSource{}
+	for _, v := range []string{"1041", "1100", "1099"} {
+		src.feed.Releases = append(src.feed.Releases, metadata.Metadata{Version: v, Checksum: zeroSum, DownloadURL: "myapp-" + v + ".gz"})
+	}
+	buildNumbers := VersionCompareFunc(func(a, b string) (int, error) {
+		na, err := strconv.Atoi(a)
+		if err != nil {
+			return 0, err
+		}
+		nb, err := strconv.Atoi(b)
+		return na - nb, err
+	})
+	cfg := Config{Source: src, CurrentVer: "1099", VersionComparator: buildNumbers}
+
+	newer, m, err := HasNewer(cfg)
+	if err != nil || !newer || m.Version != "1100" {
+		t.Fatalf("HasNewer = %v, %v, %v; want 1100", newer, m, err)
+	}
+
+	releases, err := AvailableVersions(cfg)
+	if err != nil || len(releases) != 3 || releases[0].Version != "1041" || releases[2].Version != "1100" {
+		t.Fatalf("AvailableVersions = %v, %v", releases, err)
+	}
+
+	if err = UpdateTo(cfg, "1041"); !errors.Is(err, ErrDowngrade) {
+		t.Fatalf("UpdateTo older build: %v, want ErrDowngrade", err)
+	}
+}
+
+func TestDownloadURL(t *testing.T) {
+	cfg := Config{URL: "https://example.com/app/metadata.json"}
+	for _, tt := range []struct{ downloadURL, want string }{
+		{"app-v1.2.3.gz", "https://example.com/app/app-v1.2.3.gz"},
+		{"../{{.Version}}/app.gz", "https://example.com/v1.2.3/app.gz"},
+		{"https://cdn.example.com/app.gz", "https://cdn.example.com/app.gz"},
+	} {
+		got, err := DownloadURL(cfg, &metadata.Metadata{Version: "v1.2.3", DownloadURL: tt.downloadURL})
+		if err != nil || got != tt.want {
+			t.Errorf("DownloadURL(%q) = %q, %v; want %q", tt.downloadURL, got, err, tt.want)
+		}
+	}
+}
@@ -3,7 +3,9 @@
 package self
 
 import (
+	"errors"
 	"os"
+	"syscall"
 
 	"github.com/napalu/gosafedate/metadata"
 )
@@ -12,14 +14,58 @@ import (
 // It exists so callers can invoke it unconditionally in main().
 func MaybeRunUpdateHelper(_ []byte) {}
 
-func replaceBinary(_ Config, oldPath, newPath string, _ *metadata.Metadata) error {
-	return rename(newPath, oldPath)
+// helperInstalls reports whether the update helper installs m: never on
+// non-Windows platforms.
+func helperInstalls(Config, *metadata.Metadata) bool { return false }
+
+// replaceBinary atomically renames newPath over oldPath. If newPath lives on
+// a different filesystem (EXDEV), it is first copied next to oldPath so the
+// final step is still an atomic rename.
+func replaceBinary(cfg Config, oldPath, newPath string, _ *metadata.Metadata) error {
+	err := cfg.rename(newPath, oldPath)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	sibling := oldPath + newSuffix
+	if err = copyToSibling(newPath, sibling); err != nil {
+		return err
+	}
+	if err = cfg.rename(sibling, oldPath); err != nil {
+		_ = os.Remove(sibling)
+		return err
+	}
+	_ = os.Remove(newPath)
+
+	return nil
+}
+
+// restoreOwner gives newPath the owner and group of the old binary, so
+// daemons installed as a dedicated user keep their ownership. Only root can
+// change ownership; for anyone else this is a no-op.
+func restoreOwner(newPath string, old os.FileInfo) error {
+	st, ok := old.Sys().(*syscall.Stat_t)
+	if !ok || os.Geteuid() != 0 {
+		return nil
+	}
+	return os.Chown(newPath, int(st.Uid), int(st.Gid))
+}
+
+// swapRunning replaces the running executable with newPath.
+func swapRunning(exe, newPath string) error {
+	return rename(newPath, exe)
+}
+
+func restartBinary(cfg Config, path string) error {
+	return cfg.restart(path)
 }
 
-func restartBinary(path string) error {
-	return restart(path)
+// restartReplaced restarts a binary which has already been replaced in place.
+func restartReplaced(cfg Config, path string) error {
+	return cfg.restart(path)
 }
 
-func restart(currPath string) error {
-	return execSelf(currPath, os.Args, os.Environ())
+// execRestart replaces the process image with the binary at path.
+func execRestart(cfg Config, path string) error {
+	return cfg.execSelf(path, os.Args, os.Environ())
 }
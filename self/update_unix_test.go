@@ -0,0 +1,334 @@
+//go:build !windows
+
+package self
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/napalu/gosafedate/metadata"
+)
+
+func TestReplaceBinary_CrossDeviceFallback(t *testing.T) {
+	oldRename := rename
+	defer func() { rename = oldRename }()
+
+	targetDir := t.TempDir()
+	workDir := t.TempDir()
+	oldPath := filepath.Join(targetDir, "myapp")
+	newPath := filepath.Join(workDir, "myapp-v1.2.4")
+
+	if err := os.WriteFile(oldPath, []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write old exe: %v", err)
+	}
+	if err := os.WriteFile(newPath, []byte("new-binary"), 0o755); err != nil {
+		t.Fatalf("write new exe: %v", err)
+	}
+
+	var renames [][2]string
+	rename = func(from, to string) error {
+		renames = append(renames, [2]string{from, to})
+		if filepath.Dir(from) != filepath.Dir(to) {
+			return &os.LinkError{Op: "rename", Old: from, New: to, Err: syscall.EXDEV}
+		}
+		return os.Rename(from, to)
+	}
+
+	if err := replaceBinary(Config{}, oldPath, newPath, nil); err != nil {
+		t.Fatalf("replaceBinary returned error: %v", err)
+	}
+
+	if len(renames) != 2 || renames[1] != [2]string{oldPath + newSuffix, oldPath} {
+		t.Fatalf("unexpected renames: %v", renames)
+	}
+	got, err := os.ReadFile(oldPath)
+	if err != nil {
+		t.Fatalf("read updated exe: %v", err)
+	}
+	if string(got) != "new-binary" {
+		t.Fatalf("old exe not replaced; got=%q", got)
+	}
+	if _, err = os.Stat(newPath); !os.IsNotExist(err) {
+		t.Fatalf("expected %s to be removed", newPath)
+	}
+}
+
+func TestApplyPendingAtStartup(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	newData := []byte("new-binary")
+	sum := fmt.Sprintf("%x", sha256.Sum256(newData))
+	src := &memSource{
+		meta: metadata.Metadata{
+			Version:     "v1.2.4",
+			Checksum:    sum,
+			Signature:   base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte("v1.2.4+"+sum))),
+			DownloadURL: "myapp-v1.2.4.gz",
+		},
+		artifacts: map[string][]byte{"myapp-v1.2.4.gz": gzipBytes(t, newData)},
+	}
+
+	currPath := filepath.Join(t.TempDir(), "myapp")
+	if err := os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write temp exe: %v", err)
+	}
+
+	err = UpdateIfNewer(Config{
+		Source:     src,
+		PubKey:     pub,
+		CurrentVer: "v1.2.3",
+		TargetPath: currPath,
+		ApplyOn:    OnNextStart,
+	})
+	if err != nil {
+		t.Fatalf("UpdateIfNewer returned error: %v", err)
+	}
+	if got, _ := os.ReadFile(currPath); string(got) != "old-binary" {
+		t.Fatalf("update applied before restart: %q", got)
+	}
+
+	oldExecutable, oldExec := executable, execSelf
+	defer func() { executable, execSelf = oldExecutable, oldExec }()
+	executable = func() (string, error) { return currPath, nil }
+
+	errExec := errors.New("exec not possible in tests")
+	var restarted string
+	execSelf = func(argv0 string, _ []string, _ []string) error {
+		restarted = argv0
+		return errExec
+	}
+
+	if err := ApplyPendingAtStartup(pub); !errors.Is(err, errExec) {
+		t.Fatalf("ApplyPendingAtStartup = %v, want restart error", err)
+	}
+	if restarted != currPath {
+		t.Fatalf("restarted %q, want %q", restarted, currPath)
+	}
+	got, err := os.ReadFile(currPath)
+	if err != nil {
+		t.Fatalf("read updated exe: %v", err)
+	}
+	if string(got) != string(newData) {
+		t.Fatalf("exe not replaced; got=%q", got)
+	}
+	for _, p := range []string{currPath + newSuffix, currPath + newSuffix + metaSuffix} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Fatalf("%s left behind", p)
+		}
+	}
+
+	// nothing staged: no-op
+	if err := ApplyPendingAtStartup(pub); err != nil {
+		t.Fatalf("ApplyPendingAtStartup without staged update = %v", err)
+	}
+
+	// a key that didn't sign the staged update must not install it
+	meta, _ := json.Marshal(src.meta)
+	if err := os.WriteFile(currPath+newSuffix, newData, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(currPath+newSuffix+metaSuffix, meta, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, _ := ed25519.GenerateKey(nil)
+	if err := ApplyPendingAtStartup(otherPub); err == nil {
+		t.Fatal("expected signature error")
+	}
+	if _, err := os.Stat(currPath + newSuffix); !os.IsNotExist(err) {
+		t.Fatal("invalid staged update not removed")
+	}
+}
+
+func TestRestart_Systemd(t *testing.T) {
+	origExec, origSystemctl := execSelf, systemctl
+	defer func() { execSelf, systemctl = origExec, origSystemctl }()
+
+	var execed bool
+	execSelf = func(string, []string, []string) error {
+		execed = true
+		return nil
+	}
+	var gotArgs []string
+	systemctl = func(args ...string) error {
+		gotArgs = args
+		return nil
+	}
+	cfg := Config{Restarter: &Systemd{Unit: "myapp.service"}}
+
+	// not started by systemd: exec as usual
+	t.Setenv("INVOCATION_ID", "")
+	t.Setenv("NOTIFY_SOCKET", "")
+	if err := cfg.restart("/usr/bin/myapp"); err != nil || !execed || gotArgs != nil {
+		t.Fatalf("restart outside systemd: err=%v exec=%v systemctl=%q", err, execed, gotArgs)
+	}
+
+	execed = false
+	t.Setenv("INVOCATION_ID", "0123456789abcdef")
+	if err := cfg.restart("/usr/bin/myapp"); err != nil {
+		t.Fatalf("restart returned error: %v", err)
+	}
+	if execed || strings.Join(gotArgs, " ") != "restart --no-block myapp.service" {
+		t.Fatalf("restart under systemd: exec=%v systemctl=%q", execed, gotArgs)
+	}
+}
+
+type recordingRestarter struct{ paths []string }
+
+func (r *recordingRestarter) Restart(path string) error {
+	r.paths = append(r.paths, path)
+	return errors.New("supervisor unavailable")
+}
+
+func TestUpdateIfNewer_Restarter(t *testing.T) {
+	newData := []byte("new-binary")
+	newConfig := func(r Restarter) Config {
+		currPath := filepath.Join(t.TempDir(), "myapp")
+		if err := os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+			t.Fatalf("write temp exe: %v", err)
+		}
+		return Config{
+			AutoRestart: true,
+			Restarter:   r,
+			CurrentVer:  "v1.2.3",
+			TargetPath:  currPath,
+			Source: &memSource{
+				meta: metadata.Metadata{
+					Version:     "v1.2.4",
+					Checksum:    fmt.Sprintf("%x", sha256.Sum256(newData)),
+					DownloadURL: "myapp-v1.2.4.gz",
+				},
+				artifacts: map[string][]byte{"myapp-v1.2.4.gz": gzipBytes(t, newData)},
+			},
+		}
+	}
+
+	// restart errors are returned instead of exiting
+	r := &recordingRestarter{}
+	cfg := newConfig(r)
+	if err := UpdateIfNewer(cfg); err == nil || err.Error() != "supervisor unavailable" {
+		t.Fatalf("UpdateIfNewer = %v, want the restarter's error", err)
+	}
+	if len(r.paths) != 1 || r.paths[0] != cfg.TargetPath {
+		t.Fatalf("restarted %q, want %q", r.paths, cfg.TargetPath)
+	}
+
+	// NoRestart keeps the process running
+	cfg = newConfig(NoRestart{})
+	if err := UpdateIfNewer(cfg); err != nil {
+		t.Fatalf("UpdateIfNewer with NoRestart returned error: %v", err)
+	}
+	if got, _ := os.ReadFile(cfg.TargetPath); string(got) != string(newData) {
+		t.Fatalf("exe not replaced; got=%q", got)
+	}
+}
+
+func TestRestoreOwner(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing ownership requires root")
+	}
+
+	dir := t.TempDir()
+	oldPath := filepath.Join(dir, "myapp")
+	newPath := filepath.Join(dir, "myapp.new")
+	for _, p := range []string{oldPath, newPath} {
+		if err := os.WriteFile(p, []byte("binary"), 0o755); err != nil {
+			t.Fatalf("write %s: %v", p, err)
+		}
+	}
+	if err := os.Chown(oldPath, 1234, 5678); err != nil {
+		t.Fatalf("chown: %v", err)
+	}
+	info, err := os.Stat(oldPath)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+
+	if err = restoreOwner(newPath, info); err != nil {
+		t.Fatalf("restoreOwner returned error: %v", err)
+	}
+	if info, err = os.Stat(newPath); err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if st := info.Sys().(*syscall.Stat_t); st.Uid != 1234 || st.Gid != 5678 {
+		t.Fatalf("owner = %d:%d, want 1234:5678", st.Uid, st.Gid)
+	}
+}
+
+func TestUpdateIfNewer_Versioned(t *testing.T) {
+	dir := t.TempDir()
+	layout := &Versioned{Dir: dir, Name: "myapp", Keep: 2}
+
+	// v1.2.3 is installed and active
+	if err := os.MkdirAll(filepath.Join(dir, "versions", "v1.2.3"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "versions", "v1.2.3", "myapp"), []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write old binary: %v", err)
+	}
+	if err := layout.Activate("v1.2.3"); err != nil {
+		t.Fatalf("Activate: %v", err)
+	}
+
+	update := func(version string, data []byte) {
+		t.Helper()
+		err := UpdateIfNewer(Config{
+			Applier:    layout,
+			CurrentVer: "v1.2.3",
+			TargetPath: filepath.Join(dir, "current", "myapp"),
+			Source: &memSource{
+				meta: metadata.Metadata{
+					Version:     version,
+					Checksum:    fmt.Sprintf("%x", sha256.Sum256(data)),
+					DownloadURL: "myapp.gz",
+				},
+				artifacts: map[string][]byte{"myapp.gz": gzipBytes(t, data)},
+			},
+		})
+		if err != nil {
+			t.Fatalf("UpdateIfNewer(%s) returned error: %v", version, err)
+		}
+	}
+
+	update("v1.2.4", []byte("new-binary"))
+	if got, _ := os.ReadFile(filepath.Join(dir, "current", "myapp")); string(got) != "new-binary" {
+		t.Fatalf("current binary = %q", got)
+	}
+	if current, _ := layout.Current(); current != "v1.2.4" {
+		t.Fatalf("Current = %q", current)
+	}
+
+	// instant rollback
+	if err := layout.Activate("v1.2.3"); err != nil {
+		t.Fatalf("Activate: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "current", "myapp")); string(got) != "old-binary" {
+		t.Fatalf("current binary after rollback = %q", got)
+	}
+
+	// only two versions are kept, never removing the active one
+	update("v1.2.5", []byte("newer-binary"))
+	versions, err := layout.Versions()
+	if err != nil {
+		t.Fatalf("Versions: %v", err)
+	}
+	if !slices.Contains(versions, "v1.2.5") || len(versions) != 2 {
+		t.Fatalf("Versions = %q", versions)
+	}
+
+	if err = layout.Activate("../etc"); err == nil {
+		t.Fatal("Activate accepted a path as version")
+	}
+}
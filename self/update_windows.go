@@ -3,15 +3,17 @@
 package self
 
 import (
-	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
+	"unsafe"
 
 	"github.com/napalu/gosafedate/metadata"
 	"github.com/napalu/gosafedate/signing"
@@ -21,14 +23,24 @@ const (
 	envUpdateHelper = "GOSAFEDATE_UPDATE_HELPER"
 	envAutoRestart  = "GOSAFEDATE_AUTO_RESTART"
 	envOrigArgs     = "GOSAFEDATE_ORIG_ARGS" // JSON []string
+	envService      = "GOSAFEDATE_SERVICE"   // Windows service to stop and start
+)
+
+// errNotSameDevice is ERROR_NOT_SAME_DEVICE, returned when renaming across volumes.
+const errNotSameDevice = syscall.Errno(17)
 
-	newSuffix  = ".new"
-	metaSuffix = ".meta"
+// MoveFileEx flags
+const (
+	movefileReplaceExisting  = 0x1
+	movefileDelayUntilReboot = 0x4
 )
 
+var procMoveFileExW = syscall.NewLazyDLL("kernel32.dll").NewProc("MoveFileExW")
+
 var (
-	execCmd   = exec.Command
-	verifyRaw = signing.VerifyRaw
+	execCmd      = exec.Command
+	verifyRaw    = signing.VerifyRaw
+	moveOnReboot = moveFileOnReboot
 )
 
 // MaybeRunUpdateHelper should be called early in main() on Windows.
@@ -42,26 +54,67 @@ var (
 //
 //  1. Load metadata from "<exe>.meta"
 //  2. Re-verify checksum of <exe> against metadata.sha256
-//  3. Re-verify Ed25519 signature over "version+sha256"
-//  4. Wait until "<exe without .new>" is replacable
-//  5. Atomically rename "<exe>" -> "<exe without .new>"
-//  6. Optionally restart "<exe without .new>" with original args
-//  7. Remove "<exe>.meta" and exit
+//  3. Re-verify Ed25519 signature over "version+sha256"; with several
+//     signatures (see Config.RequiredSignatures), one must be by pubKey, or
+//     by a key of the cached key manifest if pubKey is its root key
+//  4. Wait until "<exe without .new>" is replacable (see HelperRetry)
+//  5. Atomically rename "<exe>" -> "<exe without .new>", or schedule the
+//     rename for the next reboot (see HelperRetry.RebootFallback)
+//  6. Remove "<exe>.meta" and record the outcome (see LastHelperResult)
+//  7. Optionally restart "<exe without .new>" with original args and exit
+//
+// For Windows services (see Config.ServiceName) the helper stops the service
+// before step 4 and starts it again through the service control manager
+// instead of restarting the executable.
+//
+// When started elevated (see Config.Elevate), it first copies itself next to
+// the installed executable and starts the helper from there.
 //
 // If not in helper mode, MaybeRunUpdateHelper returns immediately.
 // On non-Windows platforms, a stub exists so it is safe to call
 // unconditionally from main().
 func MaybeRunUpdateHelper(pubKey []byte) {
+	if len(os.Args) == 3 && os.Args[1] == argElevatedHelper {
+		if err := runElevatedHelper(pubKey, os.Args[2]); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
 	if os.Getenv(envUpdateHelper) != "1" {
 		return
 	}
-	if err := runUpdateHelper(pubKey); err != nil {
-		// in production, just treat any error as fatal for the helper
+	hlog := openHelperLog(os.Getenv)
+	if source := os.Getenv(envHelperEventSource); source != "" {
+		if e, err := openEventLog(source); err == nil {
+			hlog.event = e
+		}
+	}
+
+	res := HelperResult{Started: time.Now()}
+	if err := runUpdateHelper(pubKey, &res, hlog); err != nil {
+		// in production, just treat any error as fatal for the helper,
+		// but leave a trace for the application
+		hlog.errorf("update helper failed: %v", err)
+		hlog.close()
+		res.Error, res.Finished = err.Error(), time.Now()
+		if exePath, err := executable(); err == nil {
+			_ = writeHelperResult(strings.TrimSuffix(exePath, newSuffix), res)
+		}
+		if errors.Is(err, ErrExecutableLocked) {
+			os.Exit(2)
+		}
 		os.Exit(1)
 	}
+	hlog.close()
 	os.Exit(0)
 }
 
+// helperInstalls reports whether the update helper installs m, which it
+// does for binaries replacing the running executable.
+func helperInstalls(cfg Config, m *metadata.Metadata) bool {
+	return !cfg.Managed && cfg.Applier == nil && !m.Bundle
+}
+
 // replaceBinary on Windows does NOT rename directly, because the running
 // executable is usually locked. Instead it:
 //   - renames tmpNewPath -> oldPath+".new"
@@ -71,9 +124,17 @@ func MaybeRunUpdateHelper(pubKey []byte) {
 // The helper will wait for the old exe to be unlocked, verify metadata
 // again, perform an atomic rename, and optionally restart the app.
 //
-// If the process does not have write permission to the install directory,
-// this will return an error (ACCESS_DENIED on Program Files etc.).
+// Managed binaries (see Config.Managed) aren't running and are replaced
+// directly.
+//
+// If the process does not have write permission to the install directory
+// (ACCESS_DENIED on Program Files etc.), this returns ErrNeedsElevation,
+// or relaunches the helper elevated if cfg.Elevate is set.
 func replaceBinary(cfg Config, oldPath, tmpNewPath string, m *metadata.Metadata) error {
+	if cfg.Managed {
+		return replaceManaged(cfg, oldPath, tmpNewPath)
+	}
+
 	absOld, err := filepath.Abs(oldPath)
 	if err != nil {
 		return fmt.Errorf("resolve oldPath: %w", err)
@@ -85,10 +146,24 @@ func replaceBinary(cfg Config, oldPath, tmpNewPath string, m *metadata.Metadata)
 
 	newPath := absOld + newSuffix
 	metaPath := newPath + metaSuffix
+	env := helperEnv(cfg)
 
 	// original process moves temp → .new
-	if err := rename(absTmp, newPath); err != nil {
-		return fmt.Errorf("rename %q -> %q: %w", absTmp, newPath, err)
+	if err := cfg.rename(absTmp, newPath); err != nil {
+		if errors.Is(err, errNotSameDevice) {
+			// WorkDir is on another volume: copy instead, the helper
+			// performs the final atomic rename.
+			err = copyToSibling(absTmp, newPath)
+		}
+		switch {
+		case errors.Is(err, fs.ErrPermission) && cfg.Elevate:
+			return elevate(absOld, absTmp, m, env)
+		case errors.Is(err, fs.ErrPermission):
+			return fmt.Errorf("%w: %w", ErrNeedsElevation, err)
+		case err != nil:
+			return fmt.Errorf("move %q -> %q: %w", absTmp, newPath, err)
+		}
+		_ = os.Remove(absTmp)
 	}
 
 	metaBytes, err := json.Marshal(m)
@@ -99,38 +174,98 @@ func replaceBinary(cfg Config, oldPath, tmpNewPath string, m *metadata.Metadata)
 		return fmt.Errorf("write metadata %q: %w", metaPath, err)
 	}
 
-	env := os.Environ()
-	env = append(env,
-		envUpdateHelper+"=1",
-	)
+	cmd := execCmd(newPath)
+	cmd.Env = append(os.Environ(), env...)
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("starting update helper: %w", err)
+	}
+
+	return nil
+}
 
+// replaceManaged replaces a binary which isn't the running executable, and
+// thus not locked by this process, directly.
+func replaceManaged(cfg Config, oldPath, newPath string) error {
+	err := cfg.rename(newPath, oldPath)
+	if !errors.Is(err, errNotSameDevice) {
+		return err
+	}
+
+	sibling := oldPath + newSuffix
+	if err = copyToSibling(newPath, sibling); err != nil {
+		return err
+	}
+	if err = cfg.rename(sibling, oldPath); err != nil {
+		_ = os.Remove(sibling)
+		return err
+	}
+	_ = os.Remove(newPath)
+	return nil
+}
+
+// helperEnv returns the environment entries which configure the helper.
+func helperEnv(cfg Config) []string {
 	autoRestart := "0"
-	if cfg.AutoRestart {
+	if cfg.autoRestart() {
 		autoRestart = "1"
 	}
-	env = append(env, envAutoRestart+"="+autoRestart)
+	env := []string{envUpdateHelper + "=1", envAutoRestart + "=" + autoRestart}
+	env = append(env, cfg.HelperRetry.env()...)
+	env = append(env, cfg.helperLogEnv()...)
+	if cfg.ServiceName != "" {
+		env = append(env, envService+"="+cfg.ServiceName)
+	}
 
 	if b, err := json.Marshal(os.Args[1:]); err == nil {
 		env = append(env, envOrigArgs+"="+string(b))
 	}
+	return env
+}
 
-	cmd := execCmd(newPath)
-	cmd.Env = env
+// restoreOwner is a no-op on Windows; the new binary inherits the ACLs of
+// the install directory.
+func restoreOwner(_ string, _ os.FileInfo) error {
+	return nil
+}
 
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("starting update helper: %w", err)
+// swapRunning replaces the running executable with newPath. The running
+// image can't be overwritten, but it can be renamed aside; the backup is
+// removed by the next CleanupArtifacts.
+func swapRunning(exe, newPath string) error {
+	bak := exe + bakSuffix
+	_ = os.Remove(bak)
+	if err := rename(exe, bak); err != nil {
+		return err
+	}
+	if err := rename(newPath, exe); err != nil {
+		_ = rename(bak, exe)
+		return err
 	}
-
 	return nil
 }
 
 // restartBinary is a no-op on Windows; restart is handled by the helper.
-func restartBinary(_ string) error {
+func restartBinary(_ Config, _ string) error {
 	return nil
 }
 
-// runUpdateHelper is called by MaybeRunUpdateHelper on Windows.
-func runUpdateHelper(pubKey []byte) error {
+// restartReplaced restarts a binary which has already been replaced in place
+// (bundle updates don't go through the helper).
+func restartReplaced(cfg Config, path string) error {
+	return cfg.restart(path)
+}
+
+// execRestart starts the binary at path with the original arguments.
+func execRestart(_ Config, path string) error {
+	cmd := execCmd(path, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Start()
+}
+
+// runUpdateHelper is called by MaybeRunUpdateHelper on Windows. Progress is
+// written to hlog, which may be nil.
+func runUpdateHelper(pubKey []byte, res *HelperResult, hlog *helperLog) error {
 	exePath, err := executable()
 	if err != nil {
 		return err
@@ -152,46 +287,75 @@ func runUpdateHelper(pubKey []byte) error {
 	if err := json.Unmarshal(metaBytes, &m); err != nil {
 		return err
 	}
+	res.Version = m.Version
+	hlog.infof("update helper started: installing %s to %s", m.Version, oldPath)
 
-	f, err := os.Open(exePath)
-	if err != nil {
-		return err
-	}
-	h := sha256.New()
-	if _, err := io.Copy(h, f); err != nil {
-		f.Close()
+	if err := verifyChecksum(exePath, m.Checksum); err != nil {
 		return err
 	}
-	f.Close()
-	sum := fmt.Sprintf("%x", h.Sum(nil))
-	if !strings.EqualFold(sum, m.Checksum) {
-		return fmt.Errorf("checksum mismatch: %s != %s", sum, m.Checksum)
-	}
 
-	ok, err := verifyRaw(pubKey, fmt.Sprintf("%s+%s", m.Version, m.Checksum), m.Signature)
-	if err != nil {
-		return err
+	var ok bool
+	for _, key := range trustedKeys(pubKey, oldPath) {
+		if ok, err = signedBy(verifyRaw, key, &m); ok {
+			break
+		}
 	}
 	if !ok {
+		if err != nil {
+			return err
+		}
 		return fmt.Errorf("signature verification failed")
 	}
 
-	var lastErr error
-	for i := 0; i < 100; i++ {
-		if err := rename(exePath, oldPath); err == nil {
-			lastErr = nil
-			break
-		} else {
-			lastErr = err
-			time.Sleep(200 * time.Millisecond)
+	// a service is stopped through the service manager, which also
+	// restarts it afterwards
+	service := os.Getenv(envService)
+	if service != "" {
+		hlog.infof("stopping service %s", service)
+		if err := stopService(service); err != nil {
+			return err
 		}
 	}
-	if lastErr != nil {
-		return lastErr
+
+	retry := helperRetryFromEnv(os.Getenv)
+	waiting := false
+	replace := func() error {
+		err := rename(exePath, oldPath)
+		if err != nil && !waiting {
+			hlog.infof("waiting for %s to be unlocked: %v", oldPath, err)
+			waiting = true
+		}
+		return err
+	}
+	if err := retry.do(replace, time.Sleep); err != nil {
+		if service != "" {
+			// bring the old version back up
+			_ = startService(service)
+		}
+		if !retry.RebootFallback {
+			return err
+		}
+		if rerr := moveOnReboot(exePath, oldPath); rerr != nil {
+			return fmt.Errorf("%w; scheduling for reboot: %v", err, rerr)
+		}
+		_ = os.Remove(metaPath)
+		hlog.infof("%v; %s scheduled for the next reboot", err, m.Version)
+		res.Pending, res.Error, res.Finished = true, err.Error(), time.Now()
+		_ = writeHelperResult(oldPath, *res)
+		return nil
 	}
 
 	_ = os.Remove(metaPath)
 
+	// record success before the application is restarted
+	res.Success, res.Finished = true, time.Now()
+	_ = writeHelperResult(oldPath, *res)
+	hlog.infof("installed %s", m.Version)
+
+	if service != "" {
+		hlog.infof("starting service %s", service)
+		return startService(service)
+	}
 	if os.Getenv(envAutoRestart) == "1" {
 		var args []string
 		if raw := os.Getenv(envOrigArgs); raw != "" {
@@ -203,3 +367,21 @@ func runUpdateHelper(pubKey []byte) error {
 
 	return nil
 }
+
+// moveFileOnReboot registers the rename of from to to for the next reboot.
+func moveFileOnReboot(from, to string) error {
+	f, err := syscall.UTF16PtrFromString(from)
+	if err != nil {
+		return err
+	}
+	t, err := syscall.UTF16PtrFromString(to)
+	if err != nil {
+		return err
+	}
+	r, _, err := procMoveFileExW.Call(uintptr(unsafe.Pointer(f)), uintptr(unsafe.Pointer(t)),
+		movefileReplaceExisting|movefileDelayUntilReboot)
+	if r == 0 {
+		return err
+	}
+	return nil
+}
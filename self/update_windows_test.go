@@ -4,13 +4,16 @@ package self
 
 import (
 	"bytes"
+	"crypto/ed25519"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/napalu/gosafedate/metadata"
@@ -98,7 +101,7 @@ func TestRunUpdateHelper_HappyPath_NoRestart(t *testing.T) {
 	// ensure no autostart
 	_ = os.Unsetenv(envAutoRestart)
 
-	if err := runUpdateHelper([]byte("unused")); err != nil {
+	if err := runUpdateHelper([]byte("unused"), &HelperResult{}, nil); err != nil {
 		t.Fatalf("runUpdateHelper returned error: %v", err)
 	}
 
@@ -107,6 +110,16 @@ func TestRunUpdateHelper_HappyPath_NoRestart(t *testing.T) {
 		t.Fatalf("unexpected rename: %q -> %q (expected %q -> %q)", gotFrom, gotTo, newPath, oldPath)
 	}
 
+	// the outcome is recorded for the application
+	rb, err := os.ReadFile(oldPath + resultSuffix)
+	if err != nil {
+		t.Fatalf("read helper result: %v", err)
+	}
+	var res HelperResult
+	if err := json.Unmarshal(rb, &res); err != nil || !res.Success || res.Version != m.Version {
+		t.Fatalf("helper result = %+v, %v", res, err)
+	}
+
 	// oldPath must now contain new data
 	got, err := os.ReadFile(oldPath)
 	if err != nil {
@@ -193,7 +206,7 @@ func TestRunUpdateHelper_HappyPath_WithRestart(t *testing.T) {
 	os.Setenv(envOrigArgs, string(raw))
 	defer os.Unsetenv(envOrigArgs)
 
-	if err := runUpdateHelper([]byte("unused")); err != nil {
+	if err := runUpdateHelper([]byte("unused"), &HelperResult{}, nil); err != nil {
 		t.Fatalf("runUpdateHelper returned error: %v", err)
 	}
 
@@ -264,7 +277,7 @@ func TestRunUpdateHelper_ChecksumMismatch(t *testing.T) {
 		return false, nil
 	}
 
-	err := runUpdateHelper([]byte("unused"))
+	err := runUpdateHelper([]byte("unused"), &HelperResult{}, nil)
 	if err == nil {
 		t.Fatalf("expected error on checksum mismatch, got nil")
 	}
@@ -320,7 +333,7 @@ func TestRunUpdateHelper_SignatureFailure(t *testing.T) {
 		return false, nil
 	}
 
-	err := runUpdateHelper([]byte("unused"))
+	err := runUpdateHelper([]byte("unused"), &HelperResult{}, nil)
 	if err == nil {
 		t.Fatalf("expected error on signature failure, got nil")
 	}
@@ -404,3 +417,200 @@ func TestReplaceBinary_WritesNewAndMetaAndStartsHelper(t *testing.T) {
 		t.Fatalf("expected helper to be started as %q, got %q", expectedNew, helperName)
 	}
 }
+
+func TestReplaceBinary_NeedsElevation(t *testing.T) {
+	oldRename := rename
+	oldShellExecute := shellExecute
+	defer func() {
+		rename = oldRename
+		shellExecute = oldShellExecute
+	}()
+
+	dir := t.TempDir()
+	oldPath := filepath.Join(dir, "myapp.exe")
+	tmpNew := filepath.Join(dir, "tmp-new")
+	if err := os.WriteFile(tmpNew, []byte("new-binary"), 0o755); err != nil {
+		t.Fatalf("write tmp new: %v", err)
+	}
+	m := &metadata.Metadata{Version: "v1.2.3", Checksum: sha256Hex([]byte("new-binary"))}
+
+	// the install directory isn't writable
+	rename = func(from, to string) error {
+		if to == oldPath+".new" {
+			return &os.LinkError{Op: "rename", Old: from, New: to, Err: os.ErrPermission}
+		}
+		return os.Rename(from, to)
+	}
+
+	err := replaceBinary(Config{}, oldPath, tmpNew, m)
+	if !errors.Is(err, ErrNeedsElevation) {
+		t.Fatalf("expected ErrNeedsElevation, got %v", err)
+	}
+
+	var gotExe, gotParams string
+	shellExecute = func(exe, params string) error {
+		gotExe, gotParams = exe, params
+		return nil
+	}
+	if err = replaceBinary(Config{Elevate: true}, oldPath, tmpNew, m); err != nil {
+		t.Fatalf("replaceBinary with Elevate returned error: %v", err)
+	}
+	if gotExe != tmpNew+".exe" {
+		t.Fatalf("elevated helper started as %q, want %q", gotExe, tmpNew+".exe")
+	}
+	if _, err = os.Stat(gotExe); err != nil {
+		t.Fatalf("staged binary missing: %v", err)
+	}
+	if !strings.HasPrefix(gotParams, argElevatedHelper+" ") || !strings.Contains(gotParams, "v1.2.3") {
+		t.Fatalf("unexpected elevated helper params %q", gotParams)
+	}
+}
+
+func TestRunUpdateHelper_RebootFallback(t *testing.T) {
+	oldRename := rename
+	oldExeFn := executable
+	oldVerifyRaw := verifyRaw
+	oldMoveOnReboot := moveOnReboot
+	defer func() {
+		rename = oldRename
+		executable = oldExeFn
+		verifyRaw = oldVerifyRaw
+		moveOnReboot = oldMoveOnReboot
+	}()
+
+	dir := t.TempDir()
+	oldPath := filepath.Join(dir, "myapp.exe")
+	newPath := oldPath + ".new"
+	newData := []byte("new-binary")
+	if err := os.WriteFile(newPath, newData, 0o755); err != nil {
+		t.Fatalf("write new exe: %v", err)
+	}
+	mb, _ := json.Marshal(&metadata.Metadata{Version: "v1.2.3", Checksum: sha256Hex(newData), Signature: "dummy-sig"})
+	if err := os.WriteFile(newPath+".meta", mb, 0o600); err != nil {
+		t.Fatalf("write meta: %v", err)
+	}
+
+	executable = func() (string, error) { return newPath, nil }
+	verifyRaw = func([]byte, string, string) (bool, error) { return true, nil }
+	rename = func(string, string) error { return errors.New("sharing violation") }
+
+	var gotFrom, gotTo string
+	moveOnReboot = func(from, to string) error {
+		gotFrom, gotTo = from, to
+		return nil
+	}
+
+	t.Setenv(envHelperAttempts, "1")
+	t.Setenv(envHelperReboot, "1")
+
+	res := HelperResult{}
+	if err := runUpdateHelper([]byte("unused"), &res, nil); err != nil {
+		t.Fatalf("runUpdateHelper returned error: %v", err)
+	}
+	if gotFrom != newPath || gotTo != oldPath {
+		t.Fatalf("unexpected reboot rename: %q -> %q", gotFrom, gotTo)
+	}
+	if res.Success || !res.Pending {
+		t.Fatalf("helper result = %+v, want pending", res)
+	}
+}
+
+func TestRunUpdateHelper_Service(t *testing.T) {
+	oldRename := rename
+	oldExecCmd := execCmd
+	oldExeFn := executable
+	oldVerifyRaw := verifyRaw
+	oldStop, oldStart := stopService, startService
+	defer func() {
+		rename = oldRename
+		execCmd = oldExecCmd
+		executable = oldExeFn
+		verifyRaw = oldVerifyRaw
+		stopService, startService = oldStop, oldStart
+	}()
+
+	dir := t.TempDir()
+	oldPath := filepath.Join(dir, "agent.exe")
+	newPath := oldPath + ".new"
+	newData := []byte("new-binary")
+	if err := os.WriteFile(newPath, newData, 0o755); err != nil {
+		t.Fatalf("write new exe: %v", err)
+	}
+	mb, _ := json.Marshal(&metadata.Metadata{Version: "v1.2.3", Checksum: sha256Hex(newData), Signature: "dummy-sig"})
+	if err := os.WriteFile(newPath+".meta", mb, 0o600); err != nil {
+		t.Fatalf("write meta: %v", err)
+	}
+
+	executable = func() (string, error) { return newPath, nil }
+	verifyRaw = func([]byte, string, string) (bool, error) { return true, nil }
+	execCmd = func(string, ...string) *exec.Cmd {
+		t.Fatalf("services must be restarted through the service manager")
+		return nil
+	}
+
+	var calls []string
+	stopService = func(name string) error {
+		calls = append(calls, "stop "+name)
+		return nil
+	}
+	rename = func(from, to string) error {
+		calls = append(calls, "rename")
+		return os.Rename(from, to)
+	}
+	startService = func(name string) error {
+		calls = append(calls, "start "+name)
+		return nil
+	}
+
+	t.Setenv(envService, "agent")
+	t.Setenv(envAutoRestart, "1")
+
+	if err := runUpdateHelper([]byte("unused"), &HelperResult{}, nil); err != nil {
+		t.Fatalf("runUpdateHelper returned error: %v", err)
+	}
+	if got := strings.Join(calls, ", "); got != "stop agent, rename, start agent" {
+		t.Fatalf("unexpected calls: %s", got)
+	}
+}
+
+func TestUpdate_HelperRequiresInlineSignature(t *testing.T) {
+	oldExecCmd := execCmd
+	defer func() { execCmd = oldExecCmd }()
+	execCmd = func(name string, args ...string) *exec.Cmd {
+		t.Fatalf("update helper started for a detached signature")
+		return nil
+	}
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	newData := []byte("new-binary")
+	gz := gzipBytes(t, newData)
+	digest := sha256.Sum256(gz)
+	src := &memSource{
+		meta: metadata.Metadata{Version: "v1.2.4", Checksum: sha256Hex(newData), DownloadURL: "myapp-v1.2.4.gz"},
+		artifacts: map[string][]byte{
+			"myapp-v1.2.4.gz":     gz,
+			"myapp-v1.2.4.gz.sig": []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(priv, digest[:])) + "\n"),
+		},
+	}
+
+	currPath := filepath.Join(t.TempDir(), "myapp.exe")
+	if err := os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write exe: %v", err)
+	}
+	cfg := Config{Source: src, PubKey: pub, DetachedSignatures: true, CurrentVer: "v1.2.3", TargetPath: currPath}
+	if err = UpdateIfNewer(cfg); err == nil || !strings.Contains(err.Error(), "inline signature") {
+		t.Fatalf("expected detached signature to be rejected, got %v", err)
+	}
+
+	// managed binaries are replaced directly, without the helper
+	cfg.Managed = true
+	if err = UpdateIfNewer(cfg); err != nil {
+		t.Fatalf("UpdateIfNewer managed: %v", err)
+	}
+	if got, _ := os.ReadFile(currPath); !bytes.Equal(got, newData) {
+		t.Fatalf("managed binary not replaced; got=%q", got)
+	}
+}
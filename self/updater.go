@@ -0,0 +1,152 @@
+package self
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/napalu/gosafedate/metadata"
+	"github.com/napalu/gosafedate/version"
+)
+
+// buildVersion is the version of the running binary, replaced by tests.
+var buildVersion = version.FromBuildInfo
+
+// Updater performs updates for one Config. Unlike the package-level
+// functions, which are thin wrappers around a temporary Updater, it keeps its
+// HTTP client (and thus connections) between calls, and its dependencies on
+// the operating system can be replaced, e.g. by tests and embedders.
+type Updater struct {
+	// Rename, Executable and Exec replace os.Rename, os.Executable and
+	// syscall.Exec. Nil fields use the defaults. Exec is used to restart on
+	// Unix; on Windows, restarts start a new process.
+	Rename     func(oldpath, newpath string) error
+	Executable func() (string, error)
+	Exec       func(argv0 string, argv []string, envv []string) error
+
+	cfg    Config
+	client *http.Client
+}
+
+// New returns an Updater for cfg.
+func New(cfg Config) *Updater {
+	if cfg.CurrentVer == "" && cfg.TargetPath == "" {
+		cfg.CurrentVer = buildVersion()
+	}
+	cfg.URL = expandURL(cfg.URL, cfg.CurrentVer)
+	if len(cfg.Mirrors) > 0 {
+		mirrors := make([]string, len(cfg.Mirrors))
+		for i, m := range cfg.Mirrors {
+			mirrors[i] = expandURL(m, cfg.CurrentVer)
+		}
+		cfg.Mirrors = mirrors
+	}
+	u := &Updater{client: cfg.httpClient()}
+	cfg.updater = u
+	u.cfg = cfg
+	return u
+}
+
+// Config returns the configuration of u.
+func (u *Updater) Config() Config {
+	return u.cfg
+}
+
+// Check reports whether a newer version than Config.CurrentVer is available;
+// see HasNewer.
+func (u *Updater) Check() (bool, *metadata.Metadata, error) {
+	return hasNewer(u.cfg)
+}
+
+// Plan describes the update without performing it; see Plan.
+func (u *Updater) Plan() (*UpdatePlan, error) {
+	return plan(u.cfg)
+}
+
+// VerifyPlan verifies the signature of the release offered by p; see
+// VerifyPlan.
+func (u *Updater) VerifyPlan(p *UpdatePlan) error {
+	return verifyPlan(u.cfg, p)
+}
+
+// Update installs the version described by m; see UpdateFromMetadata.
+func (u *Updater) Update(m *metadata.Metadata) error {
+	return updateFromMetadata(u.cfg, m)
+}
+
+// Download fetches and verifies the update described by m; see Download.
+func (u *Updater) Download(m *metadata.Metadata) (*StagedUpdate, error) {
+	if m == nil || u.cfg.CurrentVer == m.Version {
+		return nil, nil
+	}
+	return download(u.cfg, m)
+}
+
+// Apply installs a staged update; see Apply.
+func (u *Updater) Apply(s *StagedUpdate) error {
+	return Apply(s)
+}
+
+// UpdateIfNewer checks for and installs a newer version; see UpdateIfNewer.
+func (u *Updater) UpdateIfNewer() error {
+	newer, m, err := u.Check()
+	if err != nil || !newer {
+		return err
+	}
+
+	return u.Update(m)
+}
+
+// AvailableVersions returns the releases of the metadata; see
+// AvailableVersions.
+func (u *Updater) AvailableVersions() ([]metadata.Metadata, error) {
+	return availableVersions(u.cfg)
+}
+
+// UpdateTo installs the release with version v; see UpdateTo.
+func (u *Updater) UpdateTo(v string) error {
+	return updateTo(u.cfg, v)
+}
+
+// SkipVersion makes Check ignore version; see SkipVersion.
+func (u *Updater) SkipVersion(version string) error {
+	return SkipVersion(u.cfg, version)
+}
+
+// Snooze makes Check ignore releases for d; see Snooze.
+func (u *Updater) Snooze(d time.Duration) error {
+	return Snooze(u.cfg, d)
+}
+
+// Restart restarts the installed binary with Config.Restarter, for updates
+// applied without AutoRestart. By default, the process image is replaced on
+// Unix; on Windows a new process is started and the caller should exit.
+// Binaries swapped by the Windows update helper are restarted by the helper
+// itself when AutoRestart is set.
+func (u *Updater) Restart() error {
+	path, err := targetPath(u.cfg)
+	if err != nil {
+		return err
+	}
+	return restartReplaced(u.cfg, path)
+}
+
+func (c Config) rename(oldpath, newpath string) error {
+	if c.updater != nil && c.updater.Rename != nil {
+		return c.updater.Rename(oldpath, newpath)
+	}
+	return rename(oldpath, newpath)
+}
+
+func (c Config) executable() (string, error) {
+	if c.updater != nil && c.updater.Executable != nil {
+		return c.updater.Executable()
+	}
+	return executable()
+}
+
+func (c Config) execSelf(argv0 string, argv []string, envv []string) error {
+	if c.updater != nil && c.updater.Exec != nil {
+		return c.updater.Exec(argv0, argv, envv)
+	}
+	return execSelf(argv0, argv, envv)
+}
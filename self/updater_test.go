@@ -0,0 +1,74 @@
+//go:build !windows
+
+package self
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/napalu/gosafedate/metadata"
+)
+
+func TestUpdater_InjectedDependencies(t *testing.T) {
+	// the package-level defaults must not be used
+	origRename, origExecutable, origExec := rename, executable, execSelf
+	defer func() { rename, executable, execSelf = origRename, origExecutable, origExec }()
+	rename = func(string, string) error { t.Fatal("package rename used"); return nil }
+	executable = func() (string, error) { t.Fatal("package executable used"); return "", nil }
+	execSelf = func(string, []string, []string) error { t.Fatal("package execSelf used"); return nil }
+
+	newData := []byte("new-binary")
+	currPath := filepath.Join(t.TempDir(), "myapp")
+	if err := os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write temp exe: %v", err)
+	}
+
+	u := New(Config{
+		CurrentVer: "v1.2.3",
+		Source: &memSource{
+			meta: metadata.Metadata{
+				Version:     "v1.2.4",
+				Checksum:    fmt.Sprintf("%x", sha256.Sum256(newData)),
+				DownloadURL: "myapp-v1.2.4.gz",
+			},
+			artifacts: map[string][]byte{"myapp-v1.2.4.gz": gzipBytes(t, newData)},
+		},
+	})
+
+	var renames int
+	var restarted string
+	u.Executable = func() (string, error) { return currPath, nil }
+	u.Rename = func(oldpath, newpath string) error {
+		renames++
+		return os.Rename(oldpath, newpath)
+	}
+	u.Exec = func(argv0 string, _ []string, _ []string) error {
+		restarted = argv0
+		return nil
+	}
+
+	if err := u.UpdateIfNewer(); err != nil {
+		t.Fatalf("UpdateIfNewer returned error: %v", err)
+	}
+	got, err := os.ReadFile(currPath)
+	if err != nil {
+		t.Fatalf("read updated exe: %v", err)
+	}
+	if !bytes.Equal(got, newData) {
+		t.Fatalf("exe not replaced; got=%q", got)
+	}
+	if renames != 1 {
+		t.Fatalf("Rename called %d times, want 1", renames)
+	}
+
+	if err := u.Restart(); err != nil {
+		t.Fatalf("Restart returned error: %v", err)
+	}
+	if restarted != currPath {
+		t.Fatalf("restarted %q, want %q", restarted, currPath)
+	}
+}
@@ -0,0 +1,21 @@
+package self
+
+import (
+	"runtime"
+	"strings"
+)
+
+// expandURL replaces the placeholders {{.Version}}, {{.OS}} and {{.Arch}} in
+// u with version, runtime.GOOS and runtime.GOARCH, so one metadata file can
+// describe artifacts laid out by version and platform, e.g.
+// "https://cdn.example.com/myapp/{{.Version}}/myapp_{{.OS}}_{{.Arch}}.gz".
+func expandURL(u, version string) string {
+	if !strings.Contains(u, "{{") {
+		return u
+	}
+	return strings.NewReplacer(
+		"{{.Version}}", version,
+		"{{.OS}}", runtime.GOOS,
+		"{{.Arch}}", runtime.GOARCH,
+	).Replace(u)
+}
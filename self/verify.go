@@ -0,0 +1,44 @@
+package self
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/napalu/gosafedate/metadata"
+)
+
+// ErrTampered is returned by VerifySelf when the running executable doesn't
+// match its signed metadata.
+var ErrTampered = errors.New("executable does not match its signed metadata")
+
+// VerifySelf checks the SHA-256 of the running executable against m and the
+// Ed25519 signature of m against pubKey, so security-sensitive applications
+// can detect on-disk tampering at launch. m describes the running version,
+// e.g. shipped next to the binary or fetched from the release server. As
+// with ApplyPendingAtStartup, pubKey may be the root key of a key manifest.
+func VerifySelf(pubKey []byte, m *metadata.Metadata) error {
+	if m == nil {
+		return errors.New("no metadata to verify against")
+	}
+	if len(pubKey) == 0 {
+		return errors.New("public key required")
+	}
+
+	exe, err := executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+
+	if err = verifySignature(Config{PubKeys: trustedKeys(pubKey, exe)}, m); err != nil {
+		return fmt.Errorf("%w: %v", ErrTampered, err)
+	}
+	err = verifyChecksum(exe, m.Checksum)
+	if errors.Is(err, ErrChecksumMismatch) {
+		return fmt.Errorf("%w: %v", ErrTampered, err)
+	}
+	return err
+}
@@ -0,0 +1,158 @@
+package self
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/napalu/gosafedate/metadata"
+)
+
+// Applier installs a verified binary instead of replacing Config.TargetPath
+// in place. binary is a file in the work directory which the Applier may
+// move. It returns the path the application is restarted from.
+type Applier interface {
+	Apply(binary string, m *metadata.Metadata) (string, error)
+}
+
+// Versioned installs each version into Dir/versions/<version>/<Name> and
+// atomically points the symlink Dir/current at it. Earlier versions are kept
+// for instant rollback with Activate. Run the application as
+// Dir/current/<Name> and set Config.TargetPath to that path.
+type Versioned struct {
+	Dir  string
+	Name string
+	Keep int // number of versions kept, including the current one; if 0: all
+}
+
+// Apply installs binary as version m.Version and activates it.
+func (v *Versioned) Apply(binary string, m *metadata.Metadata) (string, error) {
+	dir, err := v.versionDir(m.Version)
+	if err != nil {
+		return "", err
+	}
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	dst := filepath.Join(dir, v.Name)
+	if err = os.Rename(binary, dst); err != nil {
+		if err = copyToSibling(binary, dst); err != nil {
+			return "", err
+		}
+		_ = os.Remove(binary)
+	}
+	if err = os.Chmod(dst, 0o755); err != nil {
+		return "", err
+	}
+
+	if err = v.Activate(m.Version); err != nil {
+		return "", err
+	}
+	return filepath.Join(v.Dir, "current", v.Name), v.prune()
+}
+
+// Activate points Dir/current at an installed version, e.g. to roll back.
+func (v *Versioned) Activate(version string) error {
+	dir, err := v.versionDir(version)
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stat(filepath.Join(dir, v.Name)); err != nil {
+		return fmt.Errorf("version %s not installed: %w", version, err)
+	}
+
+	// a symlink can't be replaced in place: create it aside and rename it
+	// over the old one
+	current := filepath.Join(v.Dir, "current")
+	tmp := current + partSuffix
+	_ = os.Remove(tmp)
+	if err = os.Symlink(filepath.Join("versions", version), tmp); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, current); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// Current returns the active version, or "" if none is active.
+func (v *Versioned) Current() (string, error) {
+	target, err := os.Readlink(filepath.Join(v.Dir, "current"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return filepath.Base(target), nil
+}
+
+// Versions returns the installed versions, oldest first.
+func (v *Versioned) Versions() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(v.Dir, "versions"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	type installed struct {
+		version string
+		mod     int64
+	}
+	var all []installed
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !e.IsDir() {
+			continue
+		}
+		all = append(all, installed{e.Name(), info.ModTime().UnixNano()})
+	}
+	slices.SortFunc(all, func(a, b installed) int {
+		return cmp.Compare(a.mod, b.mod)
+	})
+
+	versions := make([]string, len(all))
+	for i, in := range all {
+		versions[i] = in.version
+	}
+	return versions, nil
+}
+
+// prune removes the oldest versions beyond Keep, never the active one.
+func (v *Versioned) prune() error {
+	if v.Keep <= 0 {
+		return nil
+	}
+	versions, err := v.Versions()
+	if err != nil {
+		return err
+	}
+	current, err := v.Current()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for i := 0; len(versions)-i > v.Keep; i++ {
+		if versions[i] == current {
+			continue
+		}
+		errs = append(errs, os.RemoveAll(filepath.Join(v.Dir, "versions", versions[i])))
+	}
+	return errors.Join(errs...)
+}
+
+func (v *Versioned) versionDir(version string) (string, error) {
+	if version == "" || version == "." || version == ".." || strings.ContainsAny(version, `/\`) {
+		return "", fmt.Errorf("invalid version %q", version)
+	}
+	return filepath.Join(v.Dir, "versions", version), nil
+}
@@ -0,0 +1,30 @@
+// Package xz registers xz decompression with the self updater. It lives in
+// its own package so the core updater stays free of dependencies.
+//
+// Import it for its side effect:
+//
+//	import _ "github.com/napalu/gosafedate/self/xz"
+//
+// Artifacts are then decompressed with xz if the metadata declares
+// "compression": "xz" or the download URL ends in ".xz".
+package xz
+
+import (
+	"io"
+
+	"github.com/napalu/gosafedate/self"
+	"github.com/ulikunitz/xz"
+)
+
+func init() {
+	self.RegisterDecompressor("xz", ".xz", NewReader)
+}
+
+// NewReader returns an xz decompressing reader for r.
+func NewReader(r io.Reader) (io.ReadCloser, error) {
+	xr, err := xz.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(xr), nil
+}
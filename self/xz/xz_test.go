@@ -0,0 +1,64 @@
+package xz_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/napalu/gosafedate/metadata"
+	"github.com/napalu/gosafedate/self"
+	_ "github.com/napalu/gosafedate/self/xz"
+	"github.com/ulikunitz/xz"
+)
+
+func TestUpdateFromMetadata_Xz(t *testing.T) {
+	newData := []byte("new-binary")
+
+	var buf bytes.Buffer
+	w, err := xz.NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("create xz writer: %v", err)
+	}
+	if _, err = w.Write(newData); err != nil {
+		t.Fatalf("write xz: %v", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("close xz: %v", err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(buf.Bytes())
+	}))
+	defer srv.Close()
+
+	currPath := filepath.Join(t.TempDir(), "myapp")
+	if err = os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write temp exe: %v", err)
+	}
+
+	err = self.UpdateFromMetadata(self.Config{
+		URL:        srv.URL + "/meta.json",
+		CurrentVer: "v1.2.3",
+		TargetPath: currPath,
+	}, &metadata.Metadata{
+		Version:     "v1.2.4",
+		Checksum:    fmt.Sprintf("%x", sha256.Sum256(newData)),
+		DownloadURL: "myapp-v1.2.4.xz",
+	})
+	if err != nil {
+		t.Fatalf("UpdateFromMetadata returned error: %v", err)
+	}
+
+	got, err := os.ReadFile(currPath)
+	if err != nil {
+		t.Fatalf("read updated exe: %v", err)
+	}
+	if !bytes.Equal(got, newData) {
+		t.Fatalf("exe not replaced; got=%q", got)
+	}
+}
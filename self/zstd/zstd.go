@@ -0,0 +1,30 @@
+// Package zstd registers zstd decompression with the self updater. It lives
+// in its own package so the core updater stays free of dependencies.
+//
+// Import it for its side effect:
+//
+//	import _ "github.com/napalu/gosafedate/self/zstd"
+//
+// Artifacts are then decompressed with zstd if the metadata declares
+// "compression": "zstd" or the download URL ends in ".zst".
+package zstd
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/napalu/gosafedate/self"
+)
+
+func init() {
+	self.RegisterDecompressor("zstd", ".zst", NewReader)
+}
+
+// NewReader returns a zstd decompressing reader for r.
+func NewReader(r io.Reader) (io.ReadCloser, error) {
+	d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return d.IOReadCloser(), nil
+}
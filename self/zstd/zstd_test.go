@@ -0,0 +1,58 @@
+package zstd_test
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/napalu/gosafedate/metadata"
+	"github.com/napalu/gosafedate/self"
+	_ "github.com/napalu/gosafedate/self/zstd"
+)
+
+func TestUpdateFromMetadata_Zstd(t *testing.T) {
+	newData := []byte("new-binary")
+
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatalf("create zstd encoder: %v", err)
+	}
+	compressed := enc.EncodeAll(newData, nil)
+	_ = enc.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(compressed)
+	}))
+	defer srv.Close()
+
+	currPath := filepath.Join(t.TempDir(), "myapp")
+	if err = os.WriteFile(currPath, []byte("old-binary"), 0o755); err != nil {
+		t.Fatalf("write temp exe: %v", err)
+	}
+
+	err = self.UpdateFromMetadata(self.Config{
+		URL:        srv.URL + "/meta.json",
+		CurrentVer: "v1.2.3",
+		TargetPath: currPath,
+	}, &metadata.Metadata{
+		Version:     "v1.2.4",
+		Checksum:    fmt.Sprintf("%x", sha256.Sum256(newData)),
+		DownloadURL: "myapp-v1.2.4.zst",
+	})
+	if err != nil {
+		t.Fatalf("UpdateFromMetadata returned error: %v", err)
+	}
+
+	got, err := os.ReadFile(currPath)
+	if err != nil {
+		t.Fatalf("read updated exe: %v", err)
+	}
+	if string(got) != string(newData) {
+		t.Fatalf("exe not replaced; got=%q", got)
+	}
+}
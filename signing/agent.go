@@ -0,0 +1,145 @@
+package signing
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+)
+
+// ssh-agent protocol messages, see draft-miller-ssh-agent.
+const (
+	agentFailure          = 5
+	agentRequestIDs       = 11
+	agentIdentitiesAnswer = 12
+	agentSignRequest      = 13
+	agentSignResponse     = 14
+)
+
+// maxAgentReply bounds replies read from the agent.
+const maxAgentReply = 256 << 10
+
+// ErrAgentKeyNotFound is returned by NewAgentSigner if the agent holds no
+// ed25519 key with the requested fingerprint.
+var ErrAgentKeyNotFound = errors.New("key not found in ssh-agent")
+
+// AgentSigner signs with an ed25519 key held by a running ssh-agent, so the
+// private key never touches the disk of the build machine.
+type AgentSigner struct {
+	socket string
+	blob   []byte // public key in SSH wire format
+	pub    ed25519.PublicKey
+}
+
+// NewAgentSigner returns a signer for the ed25519 key with the given
+// fingerprint ("SHA256:...", as printed by ssh-add -l) held by the agent
+// listening on $SSH_AUTH_SOCK.
+func NewAgentSigner(keyFingerprint string) (*AgentSigner, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, errors.New("SSH_AUTH_SOCK is not set")
+	}
+
+	reply, err := agentRequest(socket, []byte{agentRequestIDs})
+	if err != nil {
+		return nil, err
+	}
+	r := sshReader{b: reply}
+	if typ := r.byte(); typ != agentIdentitiesAnswer {
+		return nil, fmt.Errorf("ssh-agent: unexpected reply %d", typ)
+	}
+	for n := r.uint32(); n > 0 && r.err == nil; n-- {
+		blob, _ := r.bytes(), r.string() // key and comment
+		if r.err != nil || Fingerprint(blob) != keyFingerprint {
+			continue
+		}
+		pub, err := parseSSHPublicKey(blob)
+		if err != nil {
+			return nil, fmt.Errorf("ssh-agent key %s: %w", keyFingerprint, err)
+		}
+		return &AgentSigner{socket: socket, blob: bytes.Clone(blob), pub: pub}, nil
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("ssh-agent: %w", r.err)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrAgentKeyNotFound, keyFingerprint)
+}
+
+// Fingerprint returns the OpenSSH SHA-256 fingerprint of a public key in SSH
+// wire format.
+func Fingerprint(blob []byte) string {
+	sum := sha256.Sum256(blob)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// PublicKey implements Signer.
+func (s *AgentSigner) PublicKey() crypto.PublicKey {
+	return s.pub
+}
+
+// Sign implements Signer. Like all ed25519 signers, it signs the message
+// itself.
+func (s *AgentSigner) Sign(msg []byte) ([]byte, error) {
+	req := []byte{agentSignRequest}
+	req = appendSSHBytes(req, s.blob)
+	req = appendSSHBytes(req, msg)
+	req = binary.BigEndian.AppendUint32(req, 0) // flags
+
+	reply, err := agentRequest(s.socket, req)
+	if err != nil {
+		return nil, err
+	}
+	r := sshReader{b: reply}
+	switch typ := r.byte(); typ {
+	case agentSignResponse:
+	case agentFailure:
+		return nil, errors.New("ssh-agent refused to sign")
+	default:
+		return nil, fmt.Errorf("ssh-agent: unexpected reply %d", typ)
+	}
+
+	r = sshReader{b: r.bytes()}
+	format, sig := r.string(), r.bytes()
+	if r.err != nil || format != sshEd25519 || len(sig) != ed25519.SignatureSize {
+		return nil, errors.New("ssh-agent: invalid signature")
+	}
+	return bytes.Clone(sig), nil
+}
+
+// agentRequest sends msg to the agent at socket and returns its reply.
+func agentRequest(socket string, msg []byte) ([]byte, error) {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("ssh-agent: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err = conn.Write(appendSSHBytes(nil, msg)); err != nil {
+		return nil, fmt.Errorf("ssh-agent: %w", err)
+	}
+
+	var n uint32
+	if err = binary.Read(conn, binary.BigEndian, &n); err != nil {
+		return nil, fmt.Errorf("ssh-agent: %w", err)
+	}
+	if n == 0 || n > maxAgentReply {
+		return nil, fmt.Errorf("ssh-agent: invalid reply length %d", n)
+	}
+	reply := make([]byte, n)
+	if _, err = io.ReadFull(conn, reply); err != nil {
+		return nil, fmt.Errorf("ssh-agent: %w", err)
+	}
+	return reply, nil
+}
+
+func appendSSHBytes(b, v []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(v)))
+	return append(b, v...)
+}
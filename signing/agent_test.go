@@ -0,0 +1,100 @@
+package signing_test
+
+import (
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/napalu/gosafedate/signing"
+)
+
+func sshString(b, v []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(v)))
+	return append(b, v...)
+}
+
+// fakeAgent serves the identities and sign requests of the ssh-agent
+// protocol for priv on a socket it points SSH_AUTH_SOCK at, and returns the
+// key's wire format.
+func fakeAgent(t *testing.T, priv ed25519.PrivateKey) []byte {
+	t.Helper()
+	blob := sshString(sshString(nil, []byte("ssh-ed25519")), priv.Public().(ed25519.PublicKey))
+
+	dir, err := os.MkdirTemp("", "agent") // socket paths are length limited
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	sock := filepath.Join(dir, "agent.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	t.Setenv("SSH_AUTH_SOCK", sock)
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			var n uint32
+			if binary.Read(conn, binary.BigEndian, &n) != nil {
+				_ = conn.Close()
+				continue
+			}
+			req := make([]byte, n)
+			_, _ = io.ReadFull(conn, req)
+
+			var reply []byte
+			switch req[0] {
+			case 11: // identities
+				reply = binary.BigEndian.AppendUint32([]byte{12}, 1)
+				reply = sshString(sshString(reply, blob), []byte("test key"))
+			case 13: // sign: key blob, data, flags
+				l := binary.BigEndian.Uint32(req[1:])
+				data := req[5+l+4 : len(req)-4]
+				sig := sshString(sshString(nil, []byte("ssh-ed25519")), ed25519.Sign(priv, data))
+				reply = sshString([]byte{14}, sig)
+			default:
+				reply = []byte{5}
+			}
+			_, _ = conn.Write(sshString(nil, reply))
+			_ = conn.Close()
+		}
+	}()
+	return blob
+}
+
+func TestAgentSigner(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	blob := fakeAgent(t, priv)
+
+	signer, err := signing.NewAgentSigner(signing.Fingerprint(blob))
+	if err != nil {
+		t.Fatalf("NewAgentSigner failed: %v", err)
+	}
+
+	msg := "v1.2.3+deadbeef"
+	sig, err := signing.SignWith(signer, msg)
+	if err != nil {
+		t.Fatalf("SignWith failed: %v", err)
+	}
+	if ok, err := signing.VerifyRaw(pub, msg, sig); err != nil || !ok {
+		t.Fatalf("VerifyRaw = %v, %v", ok, err)
+	}
+
+	_, err = signing.NewAgentSigner("SHA256:unknown")
+	if !errors.Is(err, signing.ErrAgentKeyNotFound) {
+		t.Fatalf("err = %v, want ErrAgentKeyNotFound", err)
+	}
+}
@@ -0,0 +1,74 @@
+package signing
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"os"
+)
+
+// SignBinary signs the SHA-256 digest of the file at filePath, computed
+// internally, so release pipelines don't have to hash and format a message
+// themselves. The 32-byte digest itself is the signed message.
+func SignBinary(privKeyPath, filePath string) (string, error) {
+	key, err := loadPrivateKey(privKeyPath)
+	if err != nil {
+		return "", err
+	}
+	return SignBinaryWith(KeySigner(key), filePath)
+}
+
+// SignBinaryWith is SignBinary with a Signer such as an AgentSigner.
+func SignBinaryWith(signer Signer, filePath string) (string, error) {
+	digest, err := fileDigest(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	sig, err := signWith(signer, digest)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+// VerifyBinary verifies a SignBinary signature of the file at filePath.
+func VerifyBinary(pubKeyPath, filePath, sig string) (bool, error) {
+	pub, err := loadPublicKey(pubKeyPath)
+	if err != nil {
+		return false, err
+	}
+	sigBytes, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return false, err
+	}
+	digest, err := fileDigest(filePath)
+	if err != nil {
+		return false, err
+	}
+
+	return verifyWith(pub, digest, sigBytes)
+}
+
+func fileDigest(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// VerifyBinaryRaw is VerifyBinary with an embedded public key, see VerifyRaw.
+func VerifyBinaryRaw(pub []byte, filePath, sig string) (bool, error) {
+	digest, err := fileDigest(filePath)
+	if err != nil {
+		return false, err
+	}
+	return VerifyRaw(pub, string(digest), sig)
+}
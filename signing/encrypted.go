@@ -0,0 +1,212 @@
+package signing
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+)
+
+// Encrypted private keys are PKCS #8 "ENCRYPTED PRIVATE KEY" PEMs using
+// PBES2 with PBKDF2 and AES-CBC, as written by
+// "openssl pkcs8 -topk8 -v2 aes-256-cbc", so existing keys can be converted
+// with openssl and vice versa.
+
+const encryptedPrivateKey = "ENCRYPTED PRIVATE KEY"
+
+// PassphraseEnv is the environment variable EnvPassphrase reads by default,
+// which Sign, SignFile and SignBinary use for encrypted keys.
+const PassphraseEnv = "GOSAFEDATE_KEY_PASSPHRASE"
+
+// pbkdf2Iterations is the work factor of newly encrypted keys.
+const pbkdf2Iterations = 600_000
+
+var (
+	oidPBES2      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES128CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+var (
+	// ErrEncryptedKey is returned for encrypted private keys if no
+	// passphrase is available.
+	ErrEncryptedKey = errors.New("private key is encrypted, passphrase required")
+	// ErrWrongPassphrase is returned if an encrypted private key can't be
+	// decrypted with the given passphrase.
+	ErrWrongPassphrase = errors.New("wrong passphrase")
+)
+
+// PassphraseFunc returns the passphrase of an encrypted private key. It is
+// only called for encrypted keys.
+type PassphraseFunc func() ([]byte, error)
+
+// EnvPassphrase returns a PassphraseFunc reading the passphrase from the
+// environment variable name.
+func EnvPassphrase(name string) PassphraseFunc {
+	return func() ([]byte, error) {
+		p, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s is not set", ErrEncryptedKey, name)
+		}
+		return []byte(p), nil
+	}
+}
+
+type encryptedPrivateKeyInfo struct {
+	Algo pkix.AlgorithmIdentifier
+	Data []byte
+}
+
+type pbes2Params struct {
+	KDF    pkix.AlgorithmIdentifier
+	Scheme pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt       []byte
+	Iterations int
+	KeyLength  int                      `asn1:"optional"`
+	PRF        pkix.AlgorithmIdentifier `asn1:"optional"` // HMAC-SHA1 if absent
+}
+
+// encryptPKCS8 encrypts the PKCS #8 key der with passphrase.
+func encryptPKCS8(der, passphrase []byte) (*pem.Block, error) {
+	salt := make([]byte, 16)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	key, err := pbkdf2.Key(sha256.New, string(passphrase), salt, pbkdf2Iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	pad := aes.BlockSize - len(der)%aes.BlockSize
+	data := append(bytes.Clone(der), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+
+	kdfParams, err := asn1.Marshal(pbkdf2Params{
+		Salt:       salt,
+		Iterations: pbkdf2Iterations,
+		PRF:        pkix.AlgorithmIdentifier{Algorithm: oidHMACSHA256, Parameters: asn1.NullRawValue},
+	})
+	if err != nil {
+		return nil, err
+	}
+	ivParam, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KDF:    pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdfParams}},
+		Scheme: pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParam}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	b, err := asn1.Marshal(encryptedPrivateKeyInfo{
+		Algo: pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}},
+		Data: data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &pem.Block{Type: encryptedPrivateKey, Bytes: b}, nil
+}
+
+// decryptPKCS8 decrypts an "ENCRYPTED PRIVATE KEY" block, returning the
+// PKCS #8 key.
+func decryptPKCS8(der []byte, passphrase PassphraseFunc) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("invalid encrypted private key: %w", err)
+	}
+	if !info.Algo.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("%w: encryption %v", errUnsupportedKey, info.Algo.Algorithm)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algo.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("invalid encrypted private key: %w", err)
+	}
+	if !params.KDF.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("%w: key derivation %v", errUnsupportedKey, params.KDF.Algorithm)
+	}
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KDF.Parameters.FullBytes, &kdf); err != nil {
+		return nil, fmt.Errorf("invalid encrypted private key: %w", err)
+	}
+
+	var prf func() hash.Hash
+	switch {
+	case len(kdf.PRF.Algorithm) == 0 || kdf.PRF.Algorithm.Equal(oidHMACSHA1):
+		prf = sha1.New
+	case kdf.PRF.Algorithm.Equal(oidHMACSHA256):
+		prf = sha256.New
+	default:
+		return nil, fmt.Errorf("%w: PRF %v", errUnsupportedKey, kdf.PRF.Algorithm)
+	}
+
+	var keyLen int
+	switch {
+	case params.Scheme.Algorithm.Equal(oidAES128CBC):
+		keyLen = 16
+	case params.Scheme.Algorithm.Equal(oidAES192CBC):
+		keyLen = 24
+	case params.Scheme.Algorithm.Equal(oidAES256CBC):
+		keyLen = 32
+	default:
+		return nil, fmt.Errorf("%w: cipher %v", errUnsupportedKey, params.Scheme.Algorithm)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.Scheme.Parameters.FullBytes, &iv); err != nil || len(iv) != aes.BlockSize {
+		return nil, errors.New("invalid encrypted private key: bad IV")
+	}
+	if len(info.Data) == 0 || len(info.Data)%aes.BlockSize != 0 {
+		return nil, errors.New("invalid encrypted private key: bad length")
+	}
+
+	if passphrase == nil {
+		return nil, ErrEncryptedKey
+	}
+	pass, err := passphrase()
+	if err != nil {
+		return nil, err
+	}
+	key, err := pbkdf2.Key(prf, string(pass), kdf.Salt, kdf.Iterations, keyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	data := bytes.Clone(info.Data)
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(data, data)
+
+	pad := int(data[len(data)-1])
+	if pad == 0 || pad > aes.BlockSize || !bytes.Equal(data[len(data)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+		return nil, ErrWrongPassphrase
+	}
+	return data[:len(data)-pad], nil
+}
@@ -0,0 +1,177 @@
+package signing
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// Ed25519 keys are accepted in PKCS #8/PKIX PEM or OpenSSH format. Besides
+// Ed25519, which signs the message itself, keys of these algorithms are
+// accepted, selected by the key:
+//   - ECDSA P-256 over the SHA-256 of the message, ASN.1 encoded
+//   - RSA-PSS (2048 bits or more) over the SHA-256 of the message
+
+// minRSABits is the minimum size of RSA keys.
+const minRSABits = 2048
+
+var errUnsupportedKey = errors.New("unsupported key type")
+
+func publicKeyFromBytes(pubKey []byte) (crypto.PublicKey, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(pubKey), []byte(sshEd25519+" ")) {
+		return parseAuthorizedKey(pubKey)
+	}
+
+	block, _ := pem.Decode(pubKey)
+	if block == nil {
+		return nil, errors.New("invalid public key PEM")
+	}
+
+	var (
+		key crypto.PublicKey
+		err error
+	)
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, errors.New("invalid public key PEM")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key, checkPublicKey(key)
+}
+
+// privateKeyFromBytes parses a PEM private key, reading the passphrase of
+// encrypted keys from PassphraseEnv.
+func privateKeyFromBytes(privKey []byte) (crypto.Signer, error) {
+	return privateKeyFromBytesWith(privKey, EnvPassphrase(PassphraseEnv))
+}
+
+func privateKeyFromBytesWith(privKey []byte, passphrase PassphraseFunc) (crypto.Signer, error) {
+	block, _ := pem.Decode(privKey)
+	if block == nil {
+		return nil, errors.New("invalid private key PEM")
+	}
+
+	var (
+		key any
+		err error
+	)
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case opensshPrivateKey:
+		key, err = parseOpenSSHPrivateKey(block.Bytes)
+	case encryptedPrivateKey:
+		var der []byte
+		if der, err = decryptPKCS8(block.Bytes, passphrase); err != nil {
+			return nil, err
+		}
+		if key, err = x509.ParsePKCS8PrivateKey(der); err != nil {
+			return nil, ErrWrongPassphrase
+		}
+	default:
+		return nil, errors.New("invalid private key PEM")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errUnsupportedKey
+	}
+	return signer, checkPublicKey(signer.Public())
+}
+
+// parseRawPublicKey parses an embedded public key, see VerifyRaw.
+func parseRawPublicKey(pub []byte) (crypto.PublicKey, error) {
+	if len(pub) == ed25519.PublicKeySize {
+		return ed25519.PublicKey(pub), nil
+	}
+	if block, _ := pem.Decode(pub); block != nil || bytes.HasPrefix(pub, []byte(sshEd25519+" ")) {
+		return publicKeyFromBytes(pub)
+	}
+	key, err := x509.ParsePKIXPublicKey(pub)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	return key, checkPublicKey(key)
+}
+
+// rawPublicKey encodes pub for embedding, see PublicKeyFromFile.
+func rawPublicKey(pub crypto.PublicKey) ([]byte, error) {
+	if k, ok := pub.(ed25519.PublicKey); ok {
+		return k, nil
+	}
+	return x509.MarshalPKIXPublicKey(pub)
+}
+
+// checkPublicKey rejects keys of unsupported algorithms and weak keys.
+func checkPublicKey(pub crypto.PublicKey) error {
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		return nil
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return fmt.Errorf("%w: ECDSA keys must use P-256", errUnsupportedKey)
+		}
+		return nil
+	case *rsa.PublicKey:
+		if k.N.BitLen() < minRSABits {
+			return fmt.Errorf("%w: RSA keys must have at least %d bits", errUnsupportedKey, minRSABits)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: %T", errUnsupportedKey, pub)
+	}
+}
+
+// signWith signs msg with s, see Signer.
+func signWith(s Signer, msg []byte) ([]byte, error) {
+	pub := s.PublicKey()
+	if err := checkPublicKey(pub); err != nil {
+		return nil, err
+	}
+	return s.Sign(digestFor(pub, msg))
+}
+
+// digestFor returns what a Signer for pub signs for msg.
+func digestFor(pub crypto.PublicKey, msg []byte) []byte {
+	if _, ok := pub.(ed25519.PublicKey); ok {
+		return msg
+	}
+	digest := sha256.Sum256(msg)
+	return digest[:]
+}
+
+func verifyWith(pub crypto.PublicKey, msg, sig []byte) (bool, error) {
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, msg, sig), nil
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(msg)
+		return ecdsa.VerifyASN1(k, digest[:], sig), nil
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(msg)
+		return rsa.VerifyPSS(k, crypto.SHA256, digest[:], sig, nil) == nil, nil
+	default:
+		return false, fmt.Errorf("%w: %T", errUnsupportedKey, pub)
+	}
+}
@@ -0,0 +1,95 @@
+package kms
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/napalu/gosafedate/internal/sigv4"
+)
+
+type awsKMS struct {
+	cfg      Config
+	keyID    string
+	region   string
+	endpoint string
+}
+
+// newAWS parses awskms:///<key id, ARN or alias>.
+func newAWS(cfg Config, u *url.URL) (*awsKMS, error) {
+	keyID := strings.TrimPrefix(u.Path, "/")
+	if keyID == "" {
+		return nil, fmt.Errorf("kms: missing key in %s", cfg.KeyURI)
+	}
+
+	region := firstEnv("AWS_REGION", "AWS_DEFAULT_REGION")
+	if arn := strings.Split(keyID, ":"); len(arn) > 3 && arn[0] == "arn" {
+		region = arn[3]
+	}
+	if region == "" {
+		return nil, errors.New("kms: AWS region unknown, set AWS_REGION")
+	}
+
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://kms.%s.amazonaws.com/", region)
+	}
+	return &awsKMS{cfg: cfg, keyID: keyID, region: region, endpoint: endpoint}, nil
+}
+
+func (k *awsKMS) call(action string, body, out any) error {
+	return k.cfg.call(http.MethodPost, k.endpoint, body, func(req *http.Request, payload []byte) error {
+		req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+		req.Header.Set("X-Amz-Target", "TrentService."+action)
+
+		keyID, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+		if keyID == "" || secret == "" {
+			return errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are not set")
+		}
+		creds := sigv4.Credentials{KeyID: keyID, Secret: secret, SessionToken: os.Getenv("AWS_SESSION_TOKEN")}
+		sigv4.Sign(req, sigv4.PayloadHash(payload), creds, k.region, "kms", time.Now())
+		return nil
+	}, out)
+}
+
+func (k *awsKMS) publicKey() (crypto.PublicKey, error) {
+	var resp struct {
+		PublicKey []byte
+	}
+	if err := k.call("GetPublicKey", map[string]string{"KeyId": k.keyID}, &resp); err != nil {
+		return nil, err
+	}
+	return x509.ParsePKIXPublicKey(resp.PublicKey)
+}
+
+func (k *awsKMS) sign(pub crypto.PublicKey, digest []byte) ([]byte, error) {
+	req := map[string]any{"KeyId": k.keyID, "Message": digest, "MessageType": "DIGEST"}
+	switch pub.(type) {
+	case ed25519.PublicKey:
+		req["MessageType"] = "RAW"
+		req["SigningAlgorithm"] = "ED25519_SHA_512"
+	case *ecdsa.PublicKey:
+		req["SigningAlgorithm"] = "ECDSA_SHA_256"
+	case *rsa.PublicKey:
+		req["SigningAlgorithm"] = "RSASSA_PSS_SHA_256"
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", pub)
+	}
+
+	var resp struct {
+		Signature []byte
+	}
+	if err := k.call("Sign", req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Signature, nil
+}
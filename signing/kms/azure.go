@@ -0,0 +1,132 @@
+package kms
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const azureAPIVersion = "7.4"
+
+type azureKMS struct {
+	cfg Config
+	key string // URL of the key (version)
+}
+
+// newAzure parses azurekms://<vault host>/<key>[/<version>].
+func newAzure(cfg Config, u *url.URL) (*azureKMS, error) {
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if u.Host == "" || parts[0] == "" || len(parts) > 2 {
+		return nil, fmt.Errorf("kms: %s does not name a key", cfg.KeyURI)
+	}
+
+	base := cfg.Endpoint
+	if base == "" {
+		base = "https://" + u.Host
+	}
+	return &azureKMS{cfg: cfg, key: strings.TrimSuffix(base, "/") + "/keys/" + strings.Join(parts, "/")}, nil
+}
+
+func (k *azureKMS) url(op string) string {
+	return k.key + op + "?api-version=" + azureAPIVersion
+}
+
+func (k *azureKMS) publicKey() (crypto.PublicKey, error) {
+	var resp struct {
+		Key struct {
+			Kty string `json:"kty"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"key"`
+	}
+	if err := k.cfg.call(http.MethodGet, k.url(""), nil, bearer("AZURE_ACCESS_TOKEN"), &resp); err != nil {
+		return nil, err
+	}
+
+	jwk := resp.Key
+	switch strings.TrimSuffix(jwk.Kty, "-HSM") {
+	case "EC":
+		if jwk.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %s", jwk.Crv)
+		}
+		x, err := b64Int(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := b64Int(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	case "RSA":
+		n, err := b64Int(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := b64Int(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", jwk.Kty)
+	}
+}
+
+func (k *azureKMS) sign(pub crypto.PublicKey, digest []byte) ([]byte, error) {
+	var alg string
+	switch pub.(type) {
+	case *ecdsa.PublicKey:
+		alg = "ES256"
+	case *rsa.PublicKey:
+		alg = "PS256"
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", pub)
+	}
+
+	req := map[string]string{"alg": alg, "value": base64.RawURLEncoding.EncodeToString(digest)}
+	var resp struct {
+		Value string `json:"value"`
+	}
+	if err := k.cfg.call(http.MethodPost, k.url("/sign"), req, bearer("AZURE_ACCESS_TOKEN"), &resp); err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(resp.Value, "="))
+	if err != nil {
+		return nil, err
+	}
+	if alg == "ES256" {
+		return rawToASN1(sig)
+	}
+	return sig, nil
+}
+
+// rawToASN1 converts a JOSE ECDSA signature (r || s) to ASN.1.
+func rawToASN1(sig []byte) ([]byte, error) {
+	if len(sig) != 64 {
+		return nil, fmt.Errorf("invalid ES256 signature length %d", len(sig))
+	}
+	return asn1.Marshal(struct{ R, S *big.Int }{
+		new(big.Int).SetBytes(sig[:32]),
+		new(big.Int).SetBytes(sig[32:]),
+	})
+}
+
+func b64Int(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,62 @@
+package kms
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type gcpKMS struct {
+	cfg  Config
+	name string // resource name of the key version
+	base string
+}
+
+// newGCP parses gcpkms://projects/.../cryptoKeyVersions/<version>.
+func newGCP(cfg Config, u *url.URL) (*gcpKMS, error) {
+	name := strings.Trim(u.Host+u.Path, "/")
+	if !strings.HasPrefix(name, "projects/") || !strings.Contains(name, "/cryptoKeyVersions/") {
+		return nil, fmt.Errorf("kms: %s does not name a key version", cfg.KeyURI)
+	}
+
+	base := cfg.Endpoint
+	if base == "" {
+		base = "https://cloudkms.googleapis.com"
+	}
+	return &gcpKMS{cfg: cfg, name: name, base: strings.TrimSuffix(base, "/") + "/v1/" + name}, nil
+}
+
+func (k *gcpKMS) publicKey() (crypto.PublicKey, error) {
+	var resp struct {
+		PEM string `json:"pem"`
+	}
+	if err := k.cfg.call(http.MethodGet, k.base+"/publicKey", nil, bearer("GOOGLE_OAUTH_ACCESS_TOKEN"), &resp); err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode([]byte(resp.PEM))
+	if block == nil {
+		return nil, errors.New("invalid public key PEM")
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+func (k *gcpKMS) sign(pub crypto.PublicKey, digest []byte) ([]byte, error) {
+	req := map[string]any{"digest": map[string][]byte{"sha256": digest}}
+	if _, ok := pub.(ed25519.PublicKey); ok {
+		req = map[string]any{"data": digest}
+	}
+
+	var resp struct {
+		Signature []byte `json:"signature"`
+	}
+	if err := k.cfg.call(http.MethodPost, k.base+":asymmetricSign", req, bearer("GOOGLE_OAUTH_ACCESS_TOKEN"), &resp); err != nil {
+		return nil, err
+	}
+	return resp.Signature, nil
+}
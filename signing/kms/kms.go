@@ -0,0 +1,198 @@
+// Package kms provides signing.Signer implementations backed by cloud key
+// management services, so release signing keys can live in managed HSMs.
+// Keys are addressed by URI:
+//
+//	awskms:///arn:aws:kms:us-east-1:123456789012:key/1234abcd-...
+//	gcpkms://projects/p/locations/l/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1
+//	azurekms://myvault.vault.azure.net/mykey[/version]
+//	hashivault://mykey
+//
+// The services are called over their HTTPS APIs without pulling in their
+// SDKs. Credentials are taken from the environment:
+//
+//   - AWS KMS: AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN
+//     and AWS_REGION (or AWS_DEFAULT_REGION, or the region of the key ARN);
+//     requests are signed with SigV4.
+//   - GCP Cloud KMS: GOOGLE_OAUTH_ACCESS_TOKEN, sent as a bearer token.
+//   - Azure Key Vault: AZURE_ACCESS_TOKEN, a bearer token for the
+//     https://vault.azure.net resource.
+//   - HashiCorp Vault transit: VAULT_ADDR, VAULT_TOKEN and optionally
+//     VAULT_NAMESPACE and TRANSIT_SECRET_ENGINE_PATH (default "transit").
+//
+// Other credential chains can be plugged in via Config.Authorize.
+//
+// Ed25519, ECDSA P-256 and RSA-PSS (SHA-256) keys are supported, as far as
+// the service supports them (Azure Key Vault has no Ed25519 keys).
+package kms
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/napalu/gosafedate/signing"
+)
+
+// DefaultTimeout bounds each request to the service.
+const DefaultTimeout = 30 * time.Second
+
+// maxResponse bounds responses read from the service.
+const maxResponse = 1 << 20
+
+// ErrUnsupportedURI is returned by New for key URIs of unknown services.
+var ErrUnsupportedURI = errors.New("kms: unsupported key URI")
+
+// Config configures a KMS signer.
+type Config struct {
+	KeyURI string // see the package documentation
+
+	// Authorize, if set, authorizes requests instead of the environment
+	// credentials. It receives the HTTPS request to the service, with its
+	// body set.
+	Authorize func(req *http.Request) error
+
+	Endpoint string       // if set: base URL of the service API, e.g. a VPC endpoint
+	Client   *http.Client // if nil: http.DefaultClient
+	Timeout  time.Duration
+}
+
+// New returns a signer for the key at cfg.KeyURI. It fetches the public key
+// of the key, so unreachable services and missing keys fail early.
+func New(cfg Config) (signing.Signer, error) {
+	u, err := url.Parse(cfg.KeyURI)
+	if err != nil {
+		return nil, fmt.Errorf("kms: %w", err)
+	}
+
+	var b backend
+	switch u.Scheme {
+	case "awskms":
+		b, err = newAWS(cfg, u)
+	case "gcpkms":
+		b, err = newGCP(cfg, u)
+	case "azurekms":
+		b, err = newAzure(cfg, u)
+	case "hashivault":
+		b, err = newVault(cfg, u)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedURI, cfg.KeyURI)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pub, err := b.publicKey()
+	if err != nil {
+		return nil, fmt.Errorf("kms: public key of %s: %w", cfg.KeyURI, err)
+	}
+	return &signer{b: b, pub: pub, uri: cfg.KeyURI}, nil
+}
+
+// backend is the service-specific part of a signer.
+type backend interface {
+	publicKey() (crypto.PublicKey, error)
+	sign(pub crypto.PublicKey, digest []byte) ([]byte, error)
+}
+
+type signer struct {
+	b   backend
+	pub crypto.PublicKey
+	uri string
+}
+
+func (s *signer) PublicKey() crypto.PublicKey {
+	return s.pub
+}
+
+func (s *signer) Sign(digest []byte) ([]byte, error) {
+	sig, err := s.b.sign(s.pub, digest)
+	if err != nil {
+		return nil, fmt.Errorf("kms: sign with %s: %w", s.uri, err)
+	}
+	return sig, nil
+}
+
+// call sends a JSON request to the service and decodes the JSON response
+// into out. body may be nil.
+func (c Config) call(method, rawURL string, body any, authorize func(*http.Request, []byte) error, out any) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Authorize != nil {
+		err = c.Authorize(req)
+	} else {
+		err = authorize(req, payload)
+	}
+	if err != nil {
+		return err
+	}
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: HTTP %d: %s", method, req.URL.Redacted(), resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	return json.Unmarshal(b, out)
+}
+
+// bearer returns an authorize func sending the token in the environment
+// variable env as a bearer token.
+func bearer(env string) func(*http.Request, []byte) error {
+	return func(req *http.Request, _ []byte) error {
+		token := os.Getenv(env)
+		if token == "" {
+			return fmt.Errorf("%s is not set", env)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+}
+
+func firstEnv(names ...string) string {
+	for _, n := range names {
+		if v := os.Getenv(n); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,197 @@
+package kms_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/napalu/gosafedate/signing"
+	"github.com/napalu/gosafedate/signing/kms"
+)
+
+func pemPublicKey(t *testing.T, pub crypto.PublicKey) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func TestNew(t *testing.T) {
+	edPub, edPriv, _ := ed25519.GenerateKey(rand.Reader)
+	ecPriv, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rsaPriv, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "gcp-token")
+	t.Setenv("AZURE_ACCESS_TOKEN", "azure-token")
+	t.Setenv("VAULT_TOKEN", "vault-token")
+
+	tests := []struct {
+		name    string
+		uri     string
+		pub     crypto.PublicKey
+		handler func(t *testing.T, w http.ResponseWriter, r *http.Request)
+	}{
+		{
+			name: "aws ed25519",
+			uri:  "awskms:///arn:aws:kms:eu-west-1:123456789012:key/release",
+			pub:  edPub,
+			handler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") ||
+					!strings.Contains(r.Header.Get("Authorization"), "/eu-west-1/kms/") {
+					t.Errorf("unsigned request: %q", r.Header.Get("Authorization"))
+				}
+				var req struct {
+					KeyId, MessageType, SigningAlgorithm string
+					Message                              []byte
+				}
+				_ = json.NewDecoder(r.Body).Decode(&req)
+				switch r.Header.Get("X-Amz-Target") {
+				case "TrentService.GetPublicKey":
+					der, _ := x509.MarshalPKIXPublicKey(edPub)
+					_ = json.NewEncoder(w).Encode(map[string][]byte{"PublicKey": der})
+				case "TrentService.Sign":
+					if req.MessageType != "RAW" || req.SigningAlgorithm != "ED25519_SHA_512" {
+						t.Errorf("unexpected sign request %+v", req)
+					}
+					_ = json.NewEncoder(w).Encode(map[string][]byte{"Signature": ed25519.Sign(edPriv, req.Message)})
+				}
+			},
+		},
+		{
+			name: "gcp ecdsa",
+			uri:  "gcpkms://projects/p/locations/global/keyRings/r/cryptoKeys/release/cryptoKeyVersions/1",
+			pub:  &ecPriv.PublicKey,
+			handler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer gcp-token" {
+					t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+				}
+				const name = "/v1/projects/p/locations/global/keyRings/r/cryptoKeys/release/cryptoKeyVersions/1"
+				switch r.URL.Path {
+				case name + "/publicKey":
+					_ = json.NewEncoder(w).Encode(map[string]string{"pem": pemPublicKey(t, &ecPriv.PublicKey)})
+				case name + ":asymmetricSign":
+					var req struct {
+						Digest struct{ SHA256 []byte } `json:"digest"`
+					}
+					_ = json.NewDecoder(r.Body).Decode(&req)
+					sig, _ := ecdsa.SignASN1(rand.Reader, ecPriv, req.Digest.SHA256)
+					_ = json.NewEncoder(w).Encode(map[string][]byte{"signature": sig})
+				default:
+					http.NotFound(w, r)
+				}
+			},
+		},
+		{
+			name: "azure ecdsa",
+			uri:  "azurekms://myvault.vault.azure.net/release",
+			pub:  &ecPriv.PublicKey,
+			handler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer azure-token" {
+					t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+				}
+				b64 := base64.RawURLEncoding.EncodeToString
+				switch r.URL.Path {
+				case "/keys/release":
+					_ = json.NewEncoder(w).Encode(map[string]any{"key": map[string]string{
+						"kty": "EC-HSM", "crv": "P-256",
+						"x": b64(ecPriv.X.FillBytes(make([]byte, 32))), "y": b64(ecPriv.Y.FillBytes(make([]byte, 32))),
+					}})
+				case "/keys/release/sign":
+					var req struct{ Alg, Value string }
+					_ = json.NewDecoder(r.Body).Decode(&req)
+					digest, _ := base64.RawURLEncoding.DecodeString(req.Value)
+					rr, s, _ := ecdsa.Sign(rand.Reader, ecPriv, digest)
+					sig := append(rr.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+					_ = json.NewEncoder(w).Encode(map[string]string{"value": b64(sig)})
+				default:
+					http.NotFound(w, r)
+				}
+			},
+		},
+		{
+			name: "vault rsa",
+			uri:  "hashivault://release",
+			pub:  &rsaPriv.PublicKey,
+			handler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("X-Vault-Token") != "vault-token" {
+					t.Errorf("X-Vault-Token = %q", r.Header.Get("X-Vault-Token"))
+				}
+				switch r.URL.Path {
+				case "/v1/transit/keys/release":
+					_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{
+						"type": "rsa-2048", "latest_version": 2,
+						"keys": map[string]any{"2": map[string]string{"public_key": pemPublicKey(t, &rsaPriv.PublicKey)}},
+					}})
+				case "/v1/transit/sign/release/sha2-256":
+					var req struct {
+						Input              []byte
+						Prehashed          bool
+						SignatureAlgorithm string `json:"signature_algorithm"`
+					}
+					_ = json.NewDecoder(r.Body).Decode(&req)
+					if !req.Prehashed || req.SignatureAlgorithm != "pss" {
+						t.Errorf("unexpected sign request %+v", req)
+					}
+					sig, _ := rsa.SignPSS(rand.Reader, rsaPriv, crypto.SHA256, req.Input, nil)
+					_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]string{
+						"signature": "vault:v2:" + base64.StdEncoding.EncodeToString(sig),
+					}})
+				default:
+					http.NotFound(w, r)
+				}
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tc.handler(t, w, r)
+			}))
+			defer srv.Close()
+
+			s, err := kms.New(kms.Config{KeyURI: tc.uri, Endpoint: srv.URL})
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+
+			msg := "v1.2.3+" + strings.Repeat("ab", sha256.Size)
+			sig, err := signing.SignWith(s, msg)
+			if err != nil {
+				t.Fatalf("SignWith failed: %v", err)
+			}
+
+			raw, err := x509.MarshalPKIXPublicKey(tc.pub)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok, err := signing.VerifyRaw(raw, msg, sig); err != nil || !ok {
+				t.Fatalf("VerifyRaw = %v, %v", ok, err)
+			}
+		})
+	}
+}
+
+func TestNew_UnsupportedURI(t *testing.T) {
+	_, err := kms.New(kms.Config{KeyURI: "pkcs11:token=release"})
+	if !errors.Is(err, kms.ErrUnsupportedURI) {
+		t.Fatalf("err = %v, want ErrUnsupportedURI", err)
+	}
+}
@@ -0,0 +1,118 @@
+package kms
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type vaultKMS struct {
+	cfg  Config
+	base string // URL of the transit engine
+	key  string
+}
+
+// newVault parses hashivault://<key>.
+func newVault(cfg Config, u *url.URL) (*vaultKMS, error) {
+	key := strings.Trim(u.Host+u.Path, "/")
+	if key == "" {
+		return nil, fmt.Errorf("kms: missing key in %s", cfg.KeyURI)
+	}
+
+	addr := cfg.Endpoint
+	if addr == "" {
+		addr = os.Getenv("VAULT_ADDR")
+	}
+	if addr == "" {
+		return nil, errors.New("kms: VAULT_ADDR is not set")
+	}
+	mount := os.Getenv("TRANSIT_SECRET_ENGINE_PATH")
+	if mount == "" {
+		mount = "transit"
+	}
+	return &vaultKMS{cfg: cfg, base: strings.TrimSuffix(addr, "/") + "/v1/" + strings.Trim(mount, "/"), key: key}, nil
+}
+
+func vaultAuth(req *http.Request, _ []byte) error {
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		return errors.New("VAULT_TOKEN is not set")
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+	return nil
+}
+
+func (k *vaultKMS) publicKey() (crypto.PublicKey, error) {
+	var resp struct {
+		Data struct {
+			Type          string `json:"type"`
+			LatestVersion int    `json:"latest_version"`
+			Keys          map[string]struct {
+				PublicKey string `json:"public_key"`
+			} `json:"keys"`
+		} `json:"data"`
+	}
+	if err := k.cfg.call(http.MethodGet, k.base+"/keys/"+k.key, nil, vaultAuth, &resp); err != nil {
+		return nil, err
+	}
+
+	v, ok := resp.Data.Keys[strconv.Itoa(resp.Data.LatestVersion)]
+	if !ok {
+		return nil, errors.New("latest key version not found")
+	}
+	if resp.Data.Type == "ed25519" {
+		b, err := base64.StdEncoding.DecodeString(v.PublicKey)
+		if err != nil || len(b) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 public key")
+		}
+		return ed25519.PublicKey(b), nil
+	}
+	block, _ := pem.Decode([]byte(v.PublicKey))
+	if block == nil {
+		return nil, fmt.Errorf("no public key for key type %s", resp.Data.Type)
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+func (k *vaultKMS) sign(pub crypto.PublicKey, digest []byte) ([]byte, error) {
+	req := map[string]any{"input": digest, "prehashed": true}
+	switch pub.(type) {
+	case ed25519.PublicKey:
+		req = map[string]any{"input": digest}
+	case *ecdsa.PublicKey:
+	case *rsa.PublicKey:
+		req["signature_algorithm"] = "pss"
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", pub)
+	}
+
+	var resp struct {
+		Data struct {
+			Signature string `json:"signature"`
+		} `json:"data"`
+	}
+	if err := k.cfg.call(http.MethodPost, k.base+"/sign/"+k.key+"/sha2-256", req, vaultAuth, &resp); err != nil {
+		return nil, err
+	}
+
+	// "vault:v<version>:<base64 signature>"
+	parts := strings.SplitN(resp.Data.Signature, ":", 3)
+	if len(parts) != 3 || parts[0] != "vault" {
+		return nil, errors.New("invalid signature")
+	}
+	return base64.StdEncoding.DecodeString(parts[2])
+}
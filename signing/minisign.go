@@ -0,0 +1,135 @@
+package signing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// minisign signature algorithms: legacy signatures sign the file itself,
+// pre-hashed ones (the default since minisign 0.8) its BLAKE2b-512.
+const (
+	minisignLegacy    = "Ed"
+	minisignPrehashed = "ED"
+)
+
+const (
+	minisignKeyIDSize = 8
+	minisignKeySize   = 2 + minisignKeyIDSize + ed25519.PublicKeySize
+	minisignSigSize   = 2 + minisignKeyIDSize + ed25519.SignatureSize
+)
+
+const trustedCommentPrefix = "trusted comment: "
+
+// MinisignKey is a minisign public key.
+type MinisignKey struct {
+	ID  uint64 // as printed by minisign, in hex
+	Key ed25519.PublicKey
+}
+
+// ParseMinisignKey parses a minisign public key: the contents of a
+// minisign.pub file, or its base64 line alone ("RWQ...").
+func ParseMinisignKey(data []byte) (*MinisignKey, error) {
+	line := lastLine(data)
+	raw, err := base64.StdEncoding.DecodeString(line)
+	if err != nil || len(raw) != minisignKeySize || string(raw[:2]) != minisignLegacy {
+		return nil, errors.New("invalid minisign public key")
+	}
+	return &MinisignKey{
+		ID:  binary.LittleEndian.Uint64(raw[2:]),
+		Key: ed25519.PublicKey(raw[2+minisignKeyIDSize:]),
+	}, nil
+}
+
+// IsMinisignKey reports whether data is a minisign public key.
+func IsMinisignKey(data []byte) bool {
+	_, err := ParseMinisignKey(data)
+	return err == nil
+}
+
+// VerifyMinisign verifies the minisign signature sig (the contents of a
+// .minisig file) of the contents of r, including the signature of its
+// trusted comment. pubKey is a minisign public key, see ParseMinisignKey.
+func VerifyMinisign(pubKey []byte, r io.Reader, sig []byte) (bool, error) {
+	key, err := ParseMinisignKey(pubKey)
+	if err != nil {
+		return false, err
+	}
+
+	lines := strings.Split(strings.ReplaceAll(strings.TrimSpace(string(sig)), "\r\n", "\n"), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[2], trustedCommentPrefix) {
+		return false, errors.New("invalid minisign signature")
+	}
+	raw, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil || len(raw) != minisignSigSize {
+		return false, errors.New("invalid minisign signature")
+	}
+	global, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil || len(global) != ed25519.SignatureSize {
+		return false, errors.New("invalid minisign signature")
+	}
+
+	if id := binary.LittleEndian.Uint64(raw[2:]); id != key.ID {
+		return false, fmt.Errorf("signed with key %016X, not %016X", id, key.ID)
+	}
+	fileSig := raw[2+minisignKeyIDSize:]
+
+	var msg []byte
+	switch string(raw[:2]) {
+	case minisignLegacy:
+		msg, err = io.ReadAll(r)
+	case minisignPrehashed:
+		h, _ := blake2b.New512(nil) // fails only for keys over 64 bytes
+		_, err = io.Copy(h, r)
+		msg = h.Sum(nil)
+	default:
+		return false, fmt.Errorf("unsupported minisign algorithm %q", raw[:2])
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if !ed25519.Verify(key.Key, msg, fileSig) {
+		return false, nil
+	}
+	comment := strings.TrimPrefix(lines[2], trustedCommentPrefix)
+	return ed25519.Verify(key.Key, append(bytes.Clone(fileSig), comment...), global), nil
+}
+
+// VerifyMinisignFile verifies the minisign signature at sigPath of the file
+// at filePath with the minisign public key at pubKeyPath.
+func VerifyMinisignFile(pubKeyPath, filePath, sigPath string) (bool, error) {
+	pub, err := os.ReadFile(pubKeyPath)
+	if err != nil {
+		return false, err
+	}
+	sig, err := os.ReadFile(sigPath)
+	if err != nil {
+		return false, err
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	return VerifyMinisign(pub, f, sig)
+}
+
+// lastLine returns the last non-empty line of data, skipping the untrusted
+// comment of minisign files.
+func lastLine(data []byte) string {
+	s := strings.TrimSpace(string(data))
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		s = s[i+1:]
+	}
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,93 @@
+package signing_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/napalu/gosafedate/signing"
+	"golang.org/x/crypto/blake2b"
+)
+
+// minisignFixture returns a minisign public key and a signature of data
+// made with the given algorithm ("Ed" or "ED"), as minisign writes them.
+func minisignFixture(t *testing.T, alg string, data []byte) (pubKey, sig []byte) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	keyID := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+	pubKey = fmt.Appendf(nil, "untrusted comment: minisign public key 0807060504030201\n%s\n",
+		base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), keyID...), pub...)))
+
+	msg := data
+	if alg == "ED" {
+		sum := blake2b.Sum512(data)
+		msg = sum[:]
+	}
+	fileSig := ed25519.Sign(priv, msg)
+	comment := "timestamp:1700000000\tfile:myapp"
+	global := ed25519.Sign(priv, append(bytes.Clone(fileSig), comment...))
+
+	sig = fmt.Appendf(nil, "untrusted comment: signature from minisign secret key\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(append(append([]byte(alg), keyID...), fileSig...)),
+		comment, base64.StdEncoding.EncodeToString(global))
+	return pubKey, sig
+}
+
+func TestParseMinisignKey(t *testing.T) {
+	pub, _ := minisignFixture(t, "ED", nil)
+
+	key, err := signing.ParseMinisignKey(pub)
+	if err != nil {
+		t.Fatalf("ParseMinisignKey failed: %v", err)
+	}
+	if key.ID != 0x0807060504030201 {
+		t.Fatalf("ID = %016X", key.ID)
+	}
+
+	line := strings.Split(string(pub), "\n")[1]
+	if !signing.IsMinisignKey([]byte(line)) {
+		t.Fatal("bare key line not recognized")
+	}
+	if signing.IsMinisignKey([]byte(testPubKey)) {
+		t.Fatal("PEM key recognized as minisign key")
+	}
+}
+
+func TestVerifyMinisign(t *testing.T) {
+	data := []byte("release-binary")
+
+	for _, alg := range []string{"Ed", "ED"} {
+		t.Run(alg, func(t *testing.T) {
+			pub, sig := minisignFixture(t, alg, data)
+
+			ok, err := signing.VerifyMinisign(pub, bytes.NewReader(data), sig)
+			if err != nil || !ok {
+				t.Fatalf("VerifyMinisign = %v, %v", ok, err)
+			}
+
+			ok, err = signing.VerifyMinisign(pub, strings.NewReader("tampered"), sig)
+			if err != nil || ok {
+				t.Fatalf("tampered file: VerifyMinisign = %v, %v", ok, err)
+			}
+
+			forged := bytes.Replace(sig, []byte("file:myapp"), []byte("file:other"), 1)
+			ok, err = signing.VerifyMinisign(pub, bytes.NewReader(data), forged)
+			if err != nil || ok {
+				t.Fatalf("tampered comment: VerifyMinisign = %v, %v", ok, err)
+			}
+
+			other, _ := minisignFixture(t, alg, data)
+			other = bytes.Replace(other, []byte("RWQBAgMEBQYHC"), []byte("RWQCAgMEBQYHC"), 1) // other key ID
+			if _, err = signing.VerifyMinisign(other, bytes.NewReader(data), sig); err == nil {
+				t.Fatal("expected key ID mismatch error")
+			}
+		})
+	}
+}
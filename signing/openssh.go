@@ -0,0 +1,119 @@
+package signing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	sshEd25519         = "ssh-ed25519"
+	opensshPrivateKey  = "OPENSSH PRIVATE KEY"
+	opensshKeyMagic    = "openssh-key-v1\x00"
+	opensshUnencrypted = "none"
+)
+
+var errInvalidSSHKey = errors.New("invalid OpenSSH key")
+
+// parseAuthorizedKey parses an OpenSSH public key line such as
+// "ssh-ed25519 AAAA... comment", as found in id_ed25519.pub. Only ed25519
+// keys are supported.
+func parseAuthorizedKey(line []byte) (ed25519.PublicKey, error) {
+	fields := strings.Fields(string(line))
+	if len(fields) < 2 || fields[0] != sshEd25519 {
+		return nil, errInvalidSSHKey
+	}
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidSSHKey, err)
+	}
+	return parseSSHPublicKey(blob)
+}
+
+// parseSSHPublicKey parses a public key in the SSH wire format.
+func parseSSHPublicKey(blob []byte) (ed25519.PublicKey, error) {
+	r := sshReader{b: blob}
+	typ, key := r.string(), r.bytes()
+	if r.err != nil || typ != sshEd25519 || len(key) != ed25519.PublicKeySize || len(r.b) != 0 {
+		return nil, errInvalidSSHKey
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// parseOpenSSHPrivateKey parses the body of an "OPENSSH PRIVATE KEY" PEM
+// block holding a single unencrypted ed25519 key.
+func parseOpenSSHPrivateKey(der []byte) (ed25519.PrivateKey, error) {
+	if !bytes.HasPrefix(der, []byte(opensshKeyMagic)) {
+		return nil, errInvalidSSHKey
+	}
+	r := sshReader{b: der[len(opensshKeyMagic):]}
+	cipher, _, _ := r.string(), r.string(), r.bytes() // cipher, kdf and its options
+	n := r.uint32()
+	_ = r.bytes() // public key
+	private := r.bytes()
+	if r.err != nil || n != 1 {
+		return nil, errInvalidSSHKey
+	}
+	if cipher != opensshUnencrypted {
+		return nil, fmt.Errorf("encrypted OpenSSH keys are not supported (cipher %s)", cipher)
+	}
+
+	r = sshReader{b: private}
+	check1, check2 := r.uint32(), r.uint32()
+	typ, pub, priv := r.string(), r.bytes(), r.bytes()
+	if r.err != nil || check1 != check2 {
+		return nil, errInvalidSSHKey
+	}
+	if typ != sshEd25519 {
+		return nil, fmt.Errorf("%w: %s", errUnsupportedKey, typ)
+	}
+	if len(priv) != ed25519.PrivateKeySize || !bytes.Equal(priv[32:], pub) {
+		return nil, errInvalidSSHKey
+	}
+	return ed25519.PrivateKey(priv), nil
+}
+
+// sshReader reads the SSH wire format (RFC 4251); the first error sticks.
+type sshReader struct {
+	b   []byte
+	err error
+}
+
+func (r *sshReader) byte() byte {
+	if r.err != nil || len(r.b) < 1 {
+		r.err = errInvalidSSHKey
+		return 0
+	}
+	v := r.b[0]
+	r.b = r.b[1:]
+	return v
+}
+
+func (r *sshReader) uint32() uint32 {
+	if r.err != nil || len(r.b) < 4 {
+		r.err = errInvalidSSHKey
+		return 0
+	}
+	v := binary.BigEndian.Uint32(r.b)
+	r.b = r.b[4:]
+	return v
+}
+
+func (r *sshReader) bytes() []byte {
+	n := r.uint32()
+	if r.err != nil || uint64(len(r.b)) < uint64(n) {
+		r.err = errInvalidSSHKey
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *sshReader) string() string {
+	return string(r.bytes())
+}
@@ -0,0 +1,262 @@
+//go:build cgo && unix
+
+package pkcs11
+
+/*
+#cgo linux LDFLAGS: -ldl
+#include <dlfcn.h>
+#include <stdlib.h>
+
+typedef unsigned long CK_ULONG;
+typedef CK_ULONG CK_RV;
+
+typedef struct {
+	CK_ULONG type;
+	void *pValue;
+	CK_ULONG ulValueLen;
+} CK_ATTRIBUTE;
+
+typedef struct {
+	CK_ULONG mechanism;
+	void *pParameter;
+	CK_ULONG ulParameterLen;
+} CK_MECHANISM;
+
+// The leading part of CK_FUNCTION_LIST, up to C_Sign, in the order of the
+// specification. Unused functions are declared as plain pointers.
+typedef struct {
+	unsigned char version[2];
+	CK_RV (*C_Initialize)(void *);
+	CK_RV (*C_Finalize)(void *);
+	void *C_GetInfo, *C_GetFunctionList, *C_GetSlotList, *C_GetSlotInfo,
+		*C_GetTokenInfo, *C_GetMechanismList, *C_GetMechanismInfo,
+		*C_InitToken, *C_InitPIN, *C_SetPIN;
+	CK_RV (*C_OpenSession)(CK_ULONG, CK_ULONG, void *, void *, CK_ULONG *);
+	CK_RV (*C_CloseSession)(CK_ULONG);
+	void *C_CloseAllSessions, *C_GetSessionInfo, *C_GetOperationState,
+		*C_SetOperationState;
+	CK_RV (*C_Login)(CK_ULONG, CK_ULONG, unsigned char *, CK_ULONG);
+	CK_RV (*C_Logout)(CK_ULONG);
+	void *C_CreateObject, *C_CopyObject, *C_DestroyObject, *C_GetObjectSize;
+	CK_RV (*C_GetAttributeValue)(CK_ULONG, CK_ULONG, CK_ATTRIBUTE *, CK_ULONG);
+	void *C_SetAttributeValue;
+	CK_RV (*C_FindObjectsInit)(CK_ULONG, CK_ATTRIBUTE *, CK_ULONG);
+	CK_RV (*C_FindObjects)(CK_ULONG, CK_ULONG *, CK_ULONG, CK_ULONG *);
+	CK_RV (*C_FindObjectsFinal)(CK_ULONG);
+	void *C_EncryptInit, *C_Encrypt, *C_EncryptUpdate, *C_EncryptFinal,
+		*C_DecryptInit, *C_Decrypt, *C_DecryptUpdate, *C_DecryptFinal,
+		*C_DigestInit, *C_Digest, *C_DigestUpdate, *C_DigestKey, *C_DigestFinal;
+	CK_RV (*C_SignInit)(CK_ULONG, CK_MECHANISM *, CK_ULONG);
+	CK_RV (*C_Sign)(CK_ULONG, unsigned char *, CK_ULONG, unsigned char *, CK_ULONG *);
+} CK_FUNCTION_LIST;
+
+static CK_FUNCTION_LIST *load(const char *path, void **handle) {
+	void *h = dlopen(path, RTLD_NOW | RTLD_LOCAL);
+	if (h == NULL) {
+		return NULL;
+	}
+	CK_RV (*get)(CK_FUNCTION_LIST **) = (CK_RV (*)(CK_FUNCTION_LIST **))dlsym(h, "C_GetFunctionList");
+	CK_FUNCTION_LIST *f = NULL;
+	if (get == NULL || get(&f) != 0 || f == NULL) {
+		dlclose(h);
+		return NULL;
+	}
+	*handle = h;
+	return f;
+}
+
+static CK_RV initialize(CK_FUNCTION_LIST *f) { return f->C_Initialize(NULL); }
+static CK_RV finalize(CK_FUNCTION_LIST *f) { return f->C_Finalize(NULL); }
+static CK_RV open_session(CK_FUNCTION_LIST *f, CK_ULONG slot, CK_ULONG *s) {
+	return f->C_OpenSession(slot, 4, NULL, NULL, s); // CKF_SERIAL_SESSION
+}
+static CK_RV close_session(CK_FUNCTION_LIST *f, CK_ULONG s) { return f->C_CloseSession(s); }
+static CK_RV login(CK_FUNCTION_LIST *f, CK_ULONG s, unsigned char *pin, CK_ULONG n) {
+	return f->C_Login(s, 1, pin, n); // CKU_USER
+}
+static CK_RV logout(CK_FUNCTION_LIST *f, CK_ULONG s) { return f->C_Logout(s); }
+static CK_RV get_attribute_value(CK_FUNCTION_LIST *f, CK_ULONG s, CK_ULONG o, CK_ATTRIBUTE *t, CK_ULONG n) {
+	return f->C_GetAttributeValue(s, o, t, n);
+}
+static CK_RV find_objects_init(CK_FUNCTION_LIST *f, CK_ULONG s, CK_ATTRIBUTE *t, CK_ULONG n) {
+	return f->C_FindObjectsInit(s, t, n);
+}
+static CK_RV find_objects(CK_FUNCTION_LIST *f, CK_ULONG s, CK_ULONG *o, CK_ULONG max, CK_ULONG *n) {
+	return f->C_FindObjects(s, o, max, n);
+}
+static CK_RV find_objects_final(CK_FUNCTION_LIST *f, CK_ULONG s) { return f->C_FindObjectsFinal(s); }
+static CK_RV sign_init(CK_FUNCTION_LIST *f, CK_ULONG s, CK_MECHANISM *m, CK_ULONG k) {
+	return f->C_SignInit(s, m, k);
+}
+static CK_RV sign(CK_FUNCTION_LIST *f, CK_ULONG s, unsigned char *d, CK_ULONG n, unsigned char *sig, CK_ULONG *sn) {
+	return f->C_Sign(s, d, n, sig, sn);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+const (
+	ckrOK                         = 0x000
+	ckrUserAlreadyLoggedIn        = 0x100
+	ckrCryptokiAlreadyInitialized = 0x191
+)
+
+// maxObjects bounds the objects returned by findObjects.
+const maxObjects = 16
+
+type module struct {
+	handle  unsafe.Pointer
+	f       *C.CK_FUNCTION_LIST
+	session C.CK_ULONG
+}
+
+func check(op string, rv C.CK_RV) error {
+	if rv != ckrOK {
+		return fmt.Errorf("pkcs11: %s: CKR %#x", op, uint(rv))
+	}
+	return nil
+}
+
+func openModule(path string, slot uint, pin string) (session, error) {
+	cpath := C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+
+	m := &module{}
+	if m.f = C.load(cpath, &m.handle); m.f == nil {
+		return nil, fmt.Errorf("pkcs11: can't load module %s", path)
+	}
+	if rv := C.initialize(m.f); rv != ckrOK && rv != ckrCryptokiAlreadyInitialized {
+		C.dlclose(m.handle)
+		return nil, check("C_Initialize", rv)
+	}
+	if err := check("C_OpenSession", C.open_session(m.f, C.CK_ULONG(slot), &m.session)); err != nil {
+		m.unload()
+		return nil, err
+	}
+
+	if pin != "" {
+		cpin := C.CBytes([]byte(pin))
+		defer C.free(cpin)
+		rv := C.login(m.f, m.session, (*C.uchar)(cpin), C.CK_ULONG(len(pin)))
+		if rv != ckrOK && rv != ckrUserAlreadyLoggedIn {
+			_ = m.close()
+			return nil, check("C_Login", rv)
+		}
+	}
+	return m, nil
+}
+
+func (m *module) unload() {
+	C.finalize(m.f)
+	C.dlclose(m.handle)
+}
+
+func (m *module) close() error {
+	C.logout(m.f, m.session)
+	err := check("C_CloseSession", C.close_session(m.f, m.session))
+	m.unload()
+	return err
+}
+
+// cTemplate copies template into C memory; free it with freeTemplate.
+func cTemplate(template map[uint][]byte) (*C.CK_ATTRIBUTE, int) {
+	n := len(template)
+	t := (*C.CK_ATTRIBUTE)(C.calloc(C.size_t(max(n, 1)), C.sizeof_CK_ATTRIBUTE))
+	attrs := unsafe.Slice(t, max(n, 1))
+	i := 0
+	for typ, v := range template {
+		attrs[i]._type = C.CK_ULONG(typ)
+		attrs[i].pValue = C.CBytes(v)
+		attrs[i].ulValueLen = C.CK_ULONG(len(v))
+		i++
+	}
+	return t, n
+}
+
+func freeTemplate(t *C.CK_ATTRIBUTE, n int) {
+	for _, a := range unsafe.Slice(t, max(n, 1)) {
+		if a.pValue != nil {
+			C.free(a.pValue)
+		}
+	}
+	C.free(unsafe.Pointer(t))
+}
+
+func (m *module) findObjects(template map[uint][]byte) ([]uint, error) {
+	t, n := cTemplate(template)
+	defer freeTemplate(t, n)
+
+	if err := check("C_FindObjectsInit", C.find_objects_init(m.f, m.session, t, C.CK_ULONG(n))); err != nil {
+		return nil, err
+	}
+	defer C.find_objects_final(m.f, m.session)
+
+	objs := (*C.CK_ULONG)(C.calloc(maxObjects, C.sizeof_CK_ULONG))
+	defer C.free(unsafe.Pointer(objs))
+	var count C.CK_ULONG
+	if err := check("C_FindObjects", C.find_objects(m.f, m.session, objs, maxObjects, &count)); err != nil {
+		return nil, err
+	}
+
+	res := make([]uint, count)
+	for i, o := range unsafe.Slice(objs, count) {
+		res[i] = uint(o)
+	}
+	return res, nil
+}
+
+func (m *module) attributes(obj uint, types ...uint) ([][]byte, error) {
+	t := (*C.CK_ATTRIBUTE)(C.calloc(C.size_t(len(types)), C.sizeof_CK_ATTRIBUTE))
+	defer freeTemplate(t, len(types))
+	attrs := unsafe.Slice(t, len(types))
+	for i, typ := range types {
+		attrs[i]._type = C.CK_ULONG(typ)
+	}
+
+	// the first call returns the lengths, the second the values
+	if err := check("C_GetAttributeValue", C.get_attribute_value(m.f, m.session, C.CK_ULONG(obj), t, C.CK_ULONG(len(types)))); err != nil {
+		return nil, err
+	}
+	for i := range attrs {
+		attrs[i].pValue = C.malloc(C.size_t(max(attrs[i].ulValueLen, 1)))
+	}
+	if err := check("C_GetAttributeValue", C.get_attribute_value(m.f, m.session, C.CK_ULONG(obj), t, C.CK_ULONG(len(types)))); err != nil {
+		return nil, err
+	}
+
+	res := make([][]byte, len(types))
+	for i, a := range attrs {
+		res[i] = C.GoBytes(a.pValue, C.int(a.ulValueLen))
+	}
+	return res, nil
+}
+
+func (m *module) sign(mech uint, param []byte, key uint, data []byte) ([]byte, error) {
+	cm := (*C.CK_MECHANISM)(C.calloc(1, C.sizeof_CK_MECHANISM))
+	defer C.free(unsafe.Pointer(cm))
+	cm.mechanism = C.CK_ULONG(mech)
+	if len(param) > 0 {
+		cm.pParameter = C.CBytes(param)
+		defer C.free(cm.pParameter)
+		cm.ulParameterLen = C.CK_ULONG(len(param))
+	}
+
+	if err := check("C_SignInit", C.sign_init(m.f, m.session, cm, C.CK_ULONG(key))); err != nil {
+		return nil, err
+	}
+
+	cdata := C.CBytes(data)
+	defer C.free(cdata)
+	const maxSig = 1024 // RSA-8192
+	sig := (*C.uchar)(C.malloc(maxSig))
+	defer C.free(unsafe.Pointer(sig))
+	n := C.CK_ULONG(maxSig)
+	if err := check("C_Sign", C.sign(m.f, m.session, (*C.uchar)(cdata), C.CK_ULONG(len(data)), sig, &n)); err != nil {
+		return nil, err
+	}
+	return C.GoBytes(unsafe.Pointer(sig), C.int(n)), nil
+}
@@ -0,0 +1,7 @@
+//go:build !cgo || !unix
+
+package pkcs11
+
+func openModule(string, uint, string) (session, error) {
+	return nil, ErrUnsupported
+}
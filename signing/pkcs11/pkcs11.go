@@ -0,0 +1,289 @@
+// Package pkcs11 provides a signing.Signer backed by a PKCS #11 token, such
+// as a YubiKey (via ykcs11), a smart card (via OpenSC) or a network HSM, so
+// the release key never leaves the hardware.
+//
+// The vendor module is loaded at runtime, which requires cgo; without cgo,
+// New returns ErrUnsupported. Ed25519 (CKM_EDDSA), ECDSA P-256 (CKM_ECDSA)
+// and RSA-PSS (CKM_RSA_PKCS_PSS with SHA-256) keys are supported.
+package pkcs11
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+	"unsafe"
+
+	"github.com/napalu/gosafedate/signing"
+)
+
+// PKCS #11 constants, see the PKCS #11 base specification.
+const (
+	ckoPublicKey  = 2
+	ckoPrivateKey = 3
+
+	ckaClass          = 0x000
+	ckaLabel          = 0x003
+	ckaKeyType        = 0x100
+	ckaID             = 0x102
+	ckaModulus        = 0x120
+	ckaPublicExponent = 0x122
+	ckaECParams       = 0x180
+	ckaECPoint        = 0x181
+
+	ckkRSA        = 0x00
+	ckkEC         = 0x03
+	ckkECEdwards  = 0x40
+	ckmRSAPKCSPSS = 0x0d
+	ckmECDSA      = 0x1041
+	ckmEDDSA      = 0x1057
+	ckmSHA256     = 0x250
+	ckgMGF1SHA256 = 0x02
+)
+
+var (
+	// ErrUnsupported is returned by New in builds without cgo.
+	ErrUnsupported = errors.New("pkcs11: not supported in this build (requires cgo)")
+	// ErrKeyNotFound is returned by New if the token holds no matching key.
+	ErrKeyNotFound = errors.New("pkcs11: key not found")
+)
+
+var (
+	oidP256    = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+	oidEd25519 = asn1.ObjectIdentifier{1, 3, 101, 112}
+)
+
+// Config selects the key of a PKCS #11 token.
+type Config struct {
+	Module string // path of the vendor module, e.g. /usr/lib/libykcs11.so
+	Slot   uint   // slot ID of the token
+	PIN    string // user PIN; if empty: read from PINEnv
+	PINEnv string // environment variable holding the PIN
+
+	// Label and ID select the private key; if both are empty, the only
+	// private key of the token is used.
+	Label string
+	ID    []byte
+}
+
+// session is an open, logged in session with a token.
+type session interface {
+	findObjects(template map[uint][]byte) ([]uint, error)
+	attributes(obj uint, types ...uint) ([][]byte, error)
+	sign(mech uint, param []byte, key uint, data []byte) ([]byte, error)
+	close() error
+}
+
+// openSession is replaced in tests.
+var openSession = openModule
+
+// New opens a session with the token and returns a signer for the selected
+// key. Close the signer when done.
+func New(cfg Config) (*Signer, error) {
+	pin := cfg.PIN
+	if pin == "" && cfg.PINEnv != "" {
+		var ok bool
+		if pin, ok = os.LookupEnv(cfg.PINEnv); !ok {
+			return nil, fmt.Errorf("pkcs11: %s is not set", cfg.PINEnv)
+		}
+	}
+
+	s, err := openSession(cfg.Module, cfg.Slot, pin)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := newSigner(s, cfg)
+	if err != nil {
+		_ = s.close()
+		return nil, err
+	}
+	return signer, nil
+}
+
+// Signer signs with a private key of a PKCS #11 token.
+type Signer struct {
+	mu  sync.Mutex // sessions are not safe for concurrent use
+	s   session
+	key uint
+	pub crypto.PublicKey
+}
+
+var _ signing.Signer = (*Signer)(nil)
+
+func newSigner(s session, cfg Config) (*Signer, error) {
+	template := map[uint][]byte{ckaClass: ulong(ckoPrivateKey)}
+	if cfg.Label != "" {
+		template[ckaLabel] = []byte(cfg.Label)
+	}
+	if len(cfg.ID) > 0 {
+		template[ckaID] = cfg.ID
+	}
+	keys, err := s.findObjects(template)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(keys) == 0:
+		return nil, ErrKeyNotFound
+	case len(keys) > 1:
+		return nil, errors.New("pkcs11: several keys match, select one by label or ID")
+	}
+
+	attrs, err := s.attributes(keys[0], ckaID, ckaLabel)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := publicKey(s, attrs[0], attrs[1])
+	if err != nil {
+		return nil, err
+	}
+	return &Signer{s: s, key: keys[0], pub: pub}, nil
+}
+
+// publicKey reads the public key object with the ID (or, without ID, the
+// label) of the private key.
+func publicKey(s session, id, label []byte) (crypto.PublicKey, error) {
+	template := map[uint][]byte{ckaClass: ulong(ckoPublicKey)}
+	if len(id) > 0 {
+		template[ckaID] = id
+	} else {
+		template[ckaLabel] = label
+	}
+	objs, err := s.findObjects(template)
+	if err != nil {
+		return nil, err
+	}
+	if len(objs) == 0 {
+		return nil, fmt.Errorf("%w: no public key for the private key", ErrKeyNotFound)
+	}
+
+	attrs, err := s.attributes(objs[0], ckaKeyType)
+	if err != nil {
+		return nil, err
+	}
+	switch keyType := fromULong(attrs[0]); keyType {
+	case ckkRSA:
+		if attrs, err = s.attributes(objs[0], ckaModulus, ckaPublicExponent); err != nil {
+			return nil, err
+		}
+		e := new(big.Int).SetBytes(attrs[1])
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(attrs[0]), E: int(e.Int64())}, nil
+	case ckkEC, ckkECEdwards:
+		if attrs, err = s.attributes(objs[0], ckaECParams, ckaECPoint); err != nil {
+			return nil, err
+		}
+		return ecPublicKey(attrs[0], attrs[1])
+	default:
+		return nil, fmt.Errorf("pkcs11: unsupported key type %#x", keyType)
+	}
+}
+
+// ecPublicKey parses the CKA_EC_PARAMS and CKA_EC_POINT of a P-256 or
+// Ed25519 key. The point is a DER OCTET STRING, though some modules return
+// it unwrapped.
+func ecPublicKey(params, point []byte) (crypto.PublicKey, error) {
+	var raw []byte
+	if rest, err := asn1.Unmarshal(point, &raw); err != nil || len(rest) > 0 {
+		raw = point
+	}
+
+	var oid asn1.ObjectIdentifier
+	var name string
+	if _, err := asn1.Unmarshal(params, &oid); err != nil {
+		// Ed25519 keys may name the curve instead
+		if _, err = asn1.Unmarshal(params, &name); err != nil {
+			return nil, fmt.Errorf("pkcs11: invalid EC parameters: %w", err)
+		}
+	}
+
+	switch {
+	case oid.Equal(oidEd25519) || name == "edwards25519":
+		if len(raw) != ed25519.PublicKeySize {
+			return nil, errors.New("pkcs11: invalid Ed25519 point")
+		}
+		return ed25519.PublicKey(bytes.Clone(raw)), nil
+	case oid.Equal(oidP256):
+		pub, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), raw)
+		if err != nil {
+			return nil, fmt.Errorf("pkcs11: invalid P-256 point: %w", err)
+		}
+		return pub, nil
+	default:
+		return nil, fmt.Errorf("pkcs11: unsupported curve %v%s", oid, name)
+	}
+}
+
+// PublicKey implements signing.Signer.
+func (s *Signer) PublicKey() crypto.PublicKey {
+	return s.pub
+}
+
+// Sign implements signing.Signer.
+func (s *Signer) Sign(digest []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch s.pub.(type) {
+	case ed25519.PublicKey:
+		return s.s.sign(ckmEDDSA, nil, s.key, digest)
+	case *ecdsa.PublicKey:
+		sig, err := s.s.sign(ckmECDSA, nil, s.key, digest)
+		if err != nil {
+			return nil, err
+		}
+		return rawToASN1(sig)
+	case *rsa.PublicKey:
+		// CK_RSA_PKCS_PSS_PARAMS: hash, MGF and salt length
+		param := append(append(ulong(ckmSHA256), ulong(ckgMGF1SHA256)...), ulong(32)...)
+		return s.s.sign(ckmRSAPKCSPSS, param, s.key, digest)
+	default:
+		return nil, fmt.Errorf("pkcs11: unsupported key type %T", s.pub)
+	}
+}
+
+// Close logs out of the token and unloads the module.
+func (s *Signer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.s.close()
+}
+
+// rawToASN1 converts a PKCS #11 ECDSA signature (r || s) to ASN.1.
+func rawToASN1(sig []byte) ([]byte, error) {
+	if len(sig) == 0 || len(sig)%2 != 0 {
+		return nil, fmt.Errorf("pkcs11: invalid ECDSA signature length %d", len(sig))
+	}
+	n := len(sig) / 2
+	return asn1.Marshal(struct{ R, S *big.Int }{
+		new(big.Int).SetBytes(sig[:n]),
+		new(big.Int).SetBytes(sig[n:]),
+	})
+}
+
+// ulong encodes v as a CK_ULONG, an unsigned long, which is pointer sized on
+// the supported platforms.
+func ulong(v uint) []byte {
+	if unsafe.Sizeof(uintptr(0)) == 8 {
+		return binary.NativeEndian.AppendUint64(nil, uint64(v))
+	}
+	return binary.NativeEndian.AppendUint32(nil, uint32(v))
+}
+
+func fromULong(b []byte) uint {
+	switch len(b) {
+	case 8:
+		return uint(binary.NativeEndian.Uint64(b))
+	case 4:
+		return uint(binary.NativeEndian.Uint32(b))
+	}
+	return ^uint(0)
+}
@@ -0,0 +1,177 @@
+package pkcs11
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"testing"
+
+	"github.com/napalu/gosafedate/signing"
+)
+
+// fakeToken is a session holding one key pair as objects 1 (private) and
+// 2 (public).
+type fakeToken struct {
+	key    crypto.Signer
+	label  string
+	closed bool
+}
+
+func (f *fakeToken) findObjects(template map[uint][]byte) ([]uint, error) {
+	if l, ok := template[ckaLabel]; ok && string(l) != f.label {
+		return nil, nil
+	}
+	switch fromULong(template[ckaClass]) {
+	case ckoPrivateKey:
+		return []uint{1}, nil
+	case ckoPublicKey:
+		return []uint{2}, nil
+	}
+	return nil, nil
+}
+
+func (f *fakeToken) attributes(_ uint, types ...uint) ([][]byte, error) {
+	res := make([][]byte, len(types))
+	for i, typ := range types {
+		switch pub := f.key.Public().(type) {
+		case ed25519.PublicKey:
+			switch typ {
+			case ckaKeyType:
+				res[i] = ulong(ckkECEdwards)
+			case ckaECParams:
+				res[i], _ = asn1.MarshalWithParams("edwards25519", "printable")
+			case ckaECPoint:
+				res[i], _ = asn1.Marshal([]byte(pub))
+			}
+		case *ecdsa.PublicKey:
+			switch typ {
+			case ckaKeyType:
+				res[i] = ulong(ckkEC)
+			case ckaECParams:
+				res[i], _ = asn1.Marshal(oidP256)
+			case ckaECPoint:
+				res[i], _ = pub.Bytes() // unwrapped, as some modules return it
+			}
+		case *rsa.PublicKey:
+			switch typ {
+			case ckaKeyType:
+				res[i] = ulong(ckkRSA)
+			case ckaModulus:
+				res[i] = pub.N.Bytes()
+			case ckaPublicExponent:
+				res[i] = []byte{1, 0, 1}
+			}
+		}
+		if typ == ckaLabel {
+			res[i] = []byte(f.label)
+		}
+	}
+	return res, nil
+}
+
+func (f *fakeToken) sign(mech uint, param []byte, _ uint, data []byte) ([]byte, error) {
+	switch k := f.key.(type) {
+	case ed25519.PrivateKey:
+		if mech != ckmEDDSA {
+			return nil, errors.New("wrong mechanism")
+		}
+		return ed25519.Sign(k, data), nil
+	case *ecdsa.PrivateKey:
+		if mech != ckmECDSA {
+			return nil, errors.New("wrong mechanism")
+		}
+		r, s, err := ecdsa.Sign(rand.Reader, k, data)
+		if err != nil {
+			return nil, err
+		}
+		return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...), nil
+	case *rsa.PrivateKey:
+		if mech != ckmRSAPKCSPSS || len(param) == 0 || fromULong(param[:len(param)/3]) != ckmSHA256 {
+			return nil, errors.New("wrong mechanism")
+		}
+		return rsa.SignPSS(rand.Reader, k, crypto.SHA256, data, &rsa.PSSOptions{SaltLength: 32})
+	}
+	return nil, errors.New("unsupported key")
+}
+
+func (f *fakeToken) close() error {
+	f.closed = true
+	return nil
+}
+
+func TestSigner(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	for name, key := range map[string]crypto.Signer{"ed25519": edKey, "ecdsa": ecKey, "rsa": rsaKey} {
+		t.Run(name, func(t *testing.T) {
+			tok := &fakeToken{key: key, label: "release"}
+			openSession = func(module string, slot uint, pin string) (session, error) {
+				if module != "/usr/lib/libfake.so" || slot != 1 || pin != "123456" {
+					t.Errorf("openSession(%q, %d, %q)", module, slot, pin)
+				}
+				return tok, nil
+			}
+			defer func() { openSession = openModule }()
+			t.Setenv("TOKEN_PIN", "123456")
+
+			s, err := New(Config{Module: "/usr/lib/libfake.so", Slot: 1, PINEnv: "TOKEN_PIN", Label: "release"})
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+
+			msg := "v1.2.3+deadbeef"
+			sig, err := signing.SignWith(s, msg)
+			if err != nil {
+				t.Fatalf("SignWith failed: %v", err)
+			}
+			raw, _ := x509.MarshalPKIXPublicKey(key.Public())
+			if ok, err := signing.VerifyRaw(raw, msg, sig); err != nil || !ok {
+				t.Fatalf("VerifyRaw = %v, %v", ok, err)
+			}
+
+			if err = s.Close(); err != nil || !tok.closed {
+				t.Fatalf("Close = %v, closed %v", err, tok.closed)
+			}
+		})
+	}
+}
+
+func TestNew_KeyNotFound(t *testing.T) {
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	tok := &fakeToken{key: key, label: "release"}
+	openSession = func(string, uint, string) (session, error) { return tok, nil }
+	defer func() { openSession = openModule }()
+
+	_, err := New(Config{Label: "other"})
+	if !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("err = %v, want ErrKeyNotFound", err)
+	}
+	if !tok.closed {
+		t.Fatal("session not closed")
+	}
+}
+
+func TestECPublicKey_WrappedPoint(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	point, _ := key.PublicKey.Bytes()
+	wrapped, _ := asn1.Marshal(point)
+	params, _ := asn1.Marshal(oidP256)
+
+	pub, err := ecPublicKey(params, wrapped)
+	if err != nil {
+		t.Fatalf("ecPublicKey failed: %v", err)
+	}
+	got, _ := pub.(*ecdsa.PublicKey).Bytes()
+	if !bytes.Equal(got, point) {
+		t.Fatal("point mismatch")
+	}
+}
@@ -0,0 +1,47 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+)
+
+// Signer signs releases with a key which may live outside the process, e.g.
+// in an ssh-agent, a cloud KMS or a hardware token. Signatures must verify
+// with Verify for PublicKey.
+type Signer interface {
+	// Sign signs digest: the SHA-256 of the message for ECDSA P-256 keys
+	// (ASN.1 encoded signature) and RSA keys (PSS), the message itself for
+	// Ed25519 keys, which hash internally.
+	Sign(digest []byte) ([]byte, error)
+	PublicKey() crypto.PublicKey
+}
+
+// KeySigner returns a Signer for a local private key.
+func KeySigner(key crypto.Signer) Signer {
+	return keySigner{key}
+}
+
+type keySigner struct {
+	key crypto.Signer
+}
+
+func (s keySigner) PublicKey() crypto.PublicKey {
+	return s.key.Public()
+}
+
+func (s keySigner) Sign(digest []byte) ([]byte, error) {
+	switch k := s.key.(type) {
+	case ed25519.PrivateKey:
+		return ed25519.Sign(k, digest), nil
+	case *ecdsa.PrivateKey:
+		return ecdsa.SignASN1(rand.Reader, k, digest)
+	case *rsa.PrivateKey:
+		return rsa.SignPSS(rand.Reader, k, crypto.SHA256, digest, nil)
+	default:
+		return nil, fmt.Errorf("%w: %T", errUnsupportedKey, s.key)
+	}
+}
@@ -1,6 +1,7 @@
 package signing
 
 import (
+	"crypto"
 	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/x509"
@@ -25,13 +26,30 @@ func Sign(keyData, data string) (string, error) {
 		return "", fmt.Errorf("keyData is nil")
 	}
 	keyData = strings.Replace(keyData, "\\r\\n", "\r\n", -1)
-	bytes, err := privateKeyFromBytes([]byte(keyData))
+	key, err := privateKeyFromBytes([]byte(keyData))
 	if err != nil {
 		return "", err
 	}
 
-	signature := ed25519.Sign(bytes, []byte(data))
+	signature, err := signWith(KeySigner(key), []byte(data))
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+// SignWith signs data like Sign, with a Signer such as an AgentSigner
+// instead of a PEM key.
+func SignWith(signer Signer, data string) (string, error) {
+	if data == "" {
+		return "", fmt.Errorf("data is empty")
+	}
 
+	signature, err := signWith(signer, []byte(data))
+	if err != nil {
+		return "", err
+	}
 	return base64.StdEncoding.EncodeToString(signature), nil
 }
 
@@ -53,11 +71,17 @@ func Verify(keyData, data, sig string) (bool, error) {
 		return false, err
 	}
 
-	return ed25519.Verify(publicKey, []byte(data), sigData), nil
+	return verifyWith(publicKey, []byte(data), sigData)
 }
 
 // GenerateKeys writes PEM-encoded Ed25519 keys.
 func GenerateKeys(privKeyPath, pubKeyPath string) error {
+	return GenerateEncryptedKeys(privKeyPath, pubKeyPath, nil)
+}
+
+// GenerateEncryptedKeys is GenerateKeys with the private key encrypted with
+// passphrase; an empty passphrase leaves it unencrypted.
+func GenerateEncryptedKeys(privKeyPath, pubKeyPath string, passphrase []byte) error {
 	var (
 		err   error
 		b     []byte
@@ -88,6 +112,11 @@ func GenerateKeys(privKeyPath, pubKeyPath string) error {
 		Type:  "PRIVATE KEY",
 		Bytes: b,
 	}
+	if len(passphrase) > 0 {
+		if block, err = encryptPKCS8(b, passphrase); err != nil {
+			return err
+		}
+	}
 
 	err = os.WriteFile(privKeyPath, pem.EncodeToMemory(block), 0600)
 	if err != nil {
@@ -118,7 +147,10 @@ func SignFile(privateKeyPath, message string) (string, error) {
 		return "", err
 	}
 
-	sig := ed25519.Sign(privateKey, []byte(message))
+	sig, err := signWith(KeySigner(privateKey), []byte(message))
+	if err != nil {
+		return "", err
+	}
 	return base64.StdEncoding.EncodeToString(sig), nil
 }
 
@@ -133,11 +165,12 @@ func VerifyFile(pubKeyPath, message, sig string) (bool, error) {
 		return false, err
 	}
 
-	return ed25519.Verify(pub, []byte(message), sigBytes), nil
+	return verifyWith(pub, []byte(message), sigBytes)
 }
 
-// VerifyRaw verifies data using a raw Ed25519 public key (32-byte slice).
-// sig is base64-encoded.
+// VerifyRaw verifies data using an embedded public key: a raw Ed25519 key
+// (32-byte slice), or the DER (or PEM) encoded PKIX key of other algorithms
+// as printed by PublicKeyFromFile. sig is base64-encoded.
 func VerifyRaw(pub []byte, data, sig string) (bool, error) {
 	if len(pub) == 0 {
 		return false, fmt.Errorf("public key is empty")
@@ -148,63 +181,70 @@ func VerifyRaw(pub []byte, data, sig string) (bool, error) {
 		return false, err
 	}
 
-	return ed25519.Verify(ed25519.PublicKey(pub), []byte(data), sigData), nil
+	key, err := parseRawPublicKey(pub)
+	if err != nil {
+		return false, err
+	}
+	return verifyWith(key, []byte(data), sigData)
 }
 
+// PublicKeyFromFile returns the public key at pubKeyPath for embedding: the
+// raw 32 bytes of an Ed25519 key, or the DER encoded PKIX key otherwise.
 func PublicKeyFromFile(pubKeyPath string) ([]byte, error) {
 	pub, err := loadPublicKey(pubKeyPath)
 	if err != nil {
 		return nil, err
 	}
-	return pub, nil
+	return rawPublicKey(pub)
 }
 
+// ParsePublicKey parses an embedded public key as accepted by VerifyRaw.
+func ParsePublicKey(pub []byte) (crypto.PublicKey, error) {
+	return parseRawPublicKey(pub)
+}
+
+// PrivateKeyFromFile returns the private key at privKeyPath: the raw 64 bytes
+// of an Ed25519 key, or the DER encoded PKCS #8 key otherwise.
 func PrivateKeyFromFile(privKeyPath string) ([]byte, error) {
 	priv, err := loadPrivateKey(privKeyPath)
 	if err != nil {
 		return nil, err
 	}
-	return priv, nil
+	if k, ok := priv.(ed25519.PrivateKey); ok {
+		return k, nil
+	}
+	return x509.MarshalPKCS8PrivateKey(priv)
 }
 
-func loadPrivateKey(path string) (ed25519.PrivateKey, error) {
+// LoadPrivateKey reads the PEM or OpenSSH private key at path for use with
+// SignWith and SignBinaryWith. passphrase is called for encrypted keys only.
+func LoadPrivateKey(path string, passphrase PassphraseFunc) (Signer, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
 
-	return privateKeyFromBytes(data)
-}
-
-func loadPublicKey(path string) (ed25519.PublicKey, error) {
-	data, err := os.ReadFile(path)
+	key, err := privateKeyFromBytesWith(data, passphrase)
 	if err != nil {
 		return nil, err
 	}
-
-	return publicKeyFromBytes(data)
+	return KeySigner(key), nil
 }
 
-func publicKeyFromBytes(pubKey []byte) ([]byte, error) {
-	block, _ := pem.Decode(pubKey)
-	if block == nil || block.Type != "PUBLIC KEY" {
-		return nil, errors.New("invalid public key PEM")
-	}
-	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+func loadPrivateKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
-	return key.(ed25519.PublicKey), nil
+
+	return privateKeyFromBytes(data)
 }
 
-func privateKeyFromBytes(privKey []byte) ([]byte, error) {
-	block, _ := pem.Decode(privKey)
-	if block == nil || block.Type != "PRIVATE KEY" {
-		return nil, errors.New("invalid private key PEM")
-	}
-	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+func loadPublicKey(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
-	return key.(ed25519.PrivateKey), nil
+
+	return publicKeyFromBytes(data)
 }
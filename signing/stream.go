@@ -0,0 +1,100 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+)
+
+// SignReader signs the contents of r in a streaming fashion, so arbitrarily
+// large files can be signed without loading them into memory. Ed25519 keys
+// produce Ed25519ph (RFC 8032) signatures over the SHA-512 of the contents,
+// which differ from Sign's signatures of the same data; ECDSA and RSA keys
+// sign the SHA-256 of the contents exactly like Sign.
+func SignReader(keyData string, r io.Reader) (string, error) {
+	if keyData == "" {
+		return "", fmt.Errorf("keyData is nil")
+	}
+	keyData = strings.Replace(keyData, "\\r\\n", "\r\n", -1)
+	key, err := privateKeyFromBytes([]byte(keyData))
+	if err != nil {
+		return "", err
+	}
+
+	digest, err := digestReader(key.Public(), r)
+	if err != nil {
+		return "", err
+	}
+
+	var sig []byte
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		sig, err = k.Sign(rand.Reader, digest, &ed25519.Options{Hash: crypto.SHA512})
+	case *ecdsa.PrivateKey:
+		sig, err = ecdsa.SignASN1(rand.Reader, k, digest)
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPSS(rand.Reader, k, crypto.SHA256, digest, nil)
+	default:
+		err = fmt.Errorf("%w: %T", errUnsupportedKey, key)
+	}
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+// VerifyReader verifies a SignReader signature of the contents of r in a
+// streaming fashion.
+func VerifyReader(keyData string, r io.Reader, sig string) (bool, error) {
+	if keyData == "" {
+		return false, fmt.Errorf("keyData is empty")
+	}
+	keyData = strings.Replace(keyData, "\\r\\n", "\r\n", -1)
+	pub, err := publicKeyFromBytes([]byte(keyData))
+	if err != nil {
+		return false, err
+	}
+
+	sigData, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return false, err
+	}
+	digest, err := digestReader(pub, r)
+	if err != nil {
+		return false, err
+	}
+
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		return ed25519.VerifyWithOptions(k, digest, sigData, &ed25519.Options{Hash: crypto.SHA512}) == nil, nil
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(k, digest, sigData), nil
+	case *rsa.PublicKey:
+		return rsa.VerifyPSS(k, crypto.SHA256, digest, sigData, nil) == nil, nil
+	default:
+		return false, fmt.Errorf("%w: %T", errUnsupportedKey, pub)
+	}
+}
+
+// digestReader hashes r with the pre-hash of pub's algorithm.
+func digestReader(pub crypto.PublicKey, r io.Reader) ([]byte, error) {
+	var h hash.Hash
+	if _, ok := pub.(ed25519.PublicKey); ok {
+		h = sha512.New()
+	} else {
+		h = sha256.New()
+	}
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
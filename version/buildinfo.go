@@ -0,0 +1,76 @@
+package version
+
+import (
+	"regexp"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"time"
+)
+
+// FromBuildInfo returns the version of the running binary recorded by the Go
+// toolchain: the version of its main module, e.g. "v1.2.3" if built by
+// "go install example.com/app@v1.2.3" or, since Go 1.24, from a checkout of
+// that tag. Other builds of a VCS checkout, which the toolchain gives a
+// pseudo-version such as "v0.0.0-20261016093000-1f2e3d4c5b6a+dirty" or, if
+// modified, the tag with "+dirty", yield a development version made of the
+// commit time and revision, e.g. "0.0.0-dev.20261016093000+1f2e3d4c5b6a",
+// which, containing "dev", isn't updated by package self. It returns "" if
+// the binary has neither.
+func FromBuildInfo() string {
+	return fromBuildInfo(debug.ReadBuildInfo())
+}
+
+// pseudoVersion matches the commit time and revision ending a Go module
+// pseudo-version: vX.0.0-time-rev, vX.Y.Z-pre.0.time-rev or
+// vX.Y.Z-0.time-rev, with optional build metadata.
+var pseudoVersion = regexp.MustCompile(`(?:-|[.-]0\.)(\d{14})-([0-9a-f]{12})(?:\+([0-9A-Za-z.-]+))?$`)
+
+func fromBuildInfo(info *debug.BuildInfo, ok bool) string {
+	if !ok {
+		return ""
+	}
+	v := info.Main.Version
+	if m := pseudoVersion.FindStringSubmatch(v); m != nil {
+		return devVersion(m[1], m[2], slices.Contains(strings.Split(m[3], "."), "dirty"))
+	}
+	if v != "" && v != "(devel)" && !strings.HasSuffix(v, "+dirty") {
+		return v
+	}
+
+	var revision, commitTime string
+	var modified bool
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.time":
+			commitTime = s.Value
+		case "vcs.modified":
+			modified = s.Value == "true"
+		}
+	}
+	if revision == "" {
+		return ""
+	}
+
+	var stamp string
+	if t, err := time.Parse(time.RFC3339, commitTime); err == nil {
+		stamp = t.UTC().Format("20060102150405")
+	}
+	return devVersion(stamp, revision, modified)
+}
+
+// devVersion returns the development version of a build of revision,
+// committed at stamp (in the form 20060102150405, if known).
+func devVersion(stamp, revision string, modified bool) string {
+	v := "0.0.0-dev"
+	if stamp != "" {
+		v += "." + stamp
+	}
+	v += "+" + revision[:min(len(revision), 12)]
+	if modified {
+		v += ".dirty"
+	}
+	return v
+}
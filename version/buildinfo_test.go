@@ -0,0 +1,51 @@
+package version
+
+import (
+	"runtime/debug"
+	"testing"
+)
+
+func TestFromBuildInfo(t *testing.T) {
+	vcs := func(modified string) []debug.BuildSetting {
+		return []debug.BuildSetting{
+			{Key: "vcs", Value: "git"},
+			{Key: "vcs.revision", Value: "1f2e3d4c5b6a7980a1b2c3d4e5f60718293a4b5c"},
+			{Key: "vcs.time", Value: "2026-10-16T09:30:00+02:00"},
+			{Key: "vcs.modified", Value: modified},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		version  string
+		settings []debug.BuildSetting
+		want     string
+	}{
+		{name: "module version", version: "v1.2.3", settings: vcs("false"), want: "v1.2.3"},
+		{name: "untagged", version: "(devel)", settings: vcs("false"), want: "0.0.0-dev.20261016073000+1f2e3d4c5b6a"},
+		{name: "modified", version: "(devel)", settings: vcs("true"), want: "0.0.0-dev.20261016073000+1f2e3d4c5b6a.dirty"},
+		{name: "no VCS", version: "(devel)", want: ""},
+		{name: "pseudo-version", version: "v0.0.0-20261016073000-1f2e3d4c5b6a", settings: vcs("false"), want: "0.0.0-dev.20261016073000+1f2e3d4c5b6a"},
+		{name: "modified pseudo-version", version: "v0.0.0-20261016073000-1f2e3d4c5b6a+dirty", settings: vcs("true"), want: "0.0.0-dev.20261016073000+1f2e3d4c5b6a.dirty"},
+		{name: "pseudo-version after tag", version: "v1.2.4-0.20261016073000-1f2e3d4c5b6a", want: "0.0.0-dev.20261016073000+1f2e3d4c5b6a"},
+		{name: "pseudo-version after pre-release", version: "v1.2.4-rc.1.0.20261016073000-1f2e3d4c5b6a", want: "0.0.0-dev.20261016073000+1f2e3d4c5b6a"},
+		{name: "modified tag", version: "v1.2.3+dirty", settings: vcs("true"), want: "0.0.0-dev.20261016073000+1f2e3d4c5b6a.dirty"},
+		{name: "pre-release", version: "v1.2.4-rc.1", settings: vcs("false"), want: "v1.2.4-rc.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := &debug.BuildInfo{Main: debug.Module{Path: "example.com/app", Version: tt.version}, Settings: tt.settings}
+			got := fromBuildInfo(info, true)
+			if got != tt.want {
+				t.Fatalf("fromBuildInfo = %q, want %q", got, tt.want)
+			}
+			if _, err := NewSemVer(got, "v"); got != "" && err != nil {
+				t.Fatalf("%q is not a semantic version: %v", got, err)
+			}
+		})
+	}
+
+	if got := fromBuildInfo(nil, false); got != "" {
+		t.Fatalf("without build info: %q", got)
+	}
+}
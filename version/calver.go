@@ -0,0 +1,99 @@
+package version
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CalVer is a calendar version (https://calver.org): dot-separated numbers
+// starting with the year, e.g. "2024.06.1" or "24.6", with an optional
+// modifier, e.g. "2024.06.1-rc.1", ordered like a SemVer pre-release.
+type CalVer struct {
+	Parts    []int  // year first; leading zeros of "0M" components are dropped
+	Modifier string // dot-separated identifiers after "-"; if empty: a release
+	Original string // the parsed string, including any prefix
+}
+
+// NewCalVer parses a calendar version after removing the first of prefixes
+// it starts with. The year has four digits, or up to two for the YY and 0Y
+// formats, and is followed by one to three further numbers.
+func NewCalVer(verToParse string, prefixes ...string) (*CalVer, error) {
+	original := verToParse
+	for _, p := range prefixes {
+		if s, ok := strings.CutPrefix(verToParse, p); ok {
+			verToParse = s
+			break
+		}
+	}
+
+	core, modifier, hasModifier := strings.Cut(verToParse, "-")
+	if hasModifier && !validIdentifiers(modifier, true) {
+		return nil, fmt.Errorf("invalid calendar version %q: invalid modifier %q", original, modifier)
+	}
+	fields := strings.Split(core, ".")
+	if len(fields) < 2 || len(fields) > 4 {
+		return nil, fmt.Errorf("invalid calendar version %q: expected YYYY.MM, YYYY.MM.DD or similar", original)
+	}
+	if n := len(fields[0]); n != 4 && n > 2 {
+		return nil, fmt.Errorf("invalid calendar version %q: year %q is neither YYYY nor YY", original, fields[0])
+	}
+
+	cv := &CalVer{Modifier: modifier, Original: original}
+	for _, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 || !isNumeric(f) {
+			return nil, fmt.Errorf("invalid calendar version %q: %q is not a number", original, f)
+		}
+		cv.Parts = append(cv.Parts, n)
+	}
+	return cv, nil
+}
+
+func (cv *CalVer) String() string {
+	parts := make([]string, len(cv.Parts))
+	for i, n := range cv.Parts {
+		parts[i] = strconv.Itoa(n)
+	}
+	s := strings.Join(parts, ".")
+	if cv.Modifier != "" {
+		s += "-" + cv.Modifier
+	}
+	return s
+}
+
+// IsPrerelease reports whether cv has a modifier, e.g. "rc.1".
+func (cv *CalVer) IsPrerelease() bool {
+	return cv.Modifier != ""
+}
+
+// Compare returns -1, 0 or +1 depending on whether cv precedes, equals or
+// follows other: by their numbers, missing ones being zero, so 2024.6 equals
+// 2024.06.0, then a version with a modifier before the one without.
+func (cv *CalVer) Compare(other *CalVer) int {
+	for i := 0; i < len(cv.Parts) || i < len(other.Parts); i++ {
+		var a, b int
+		if i < len(cv.Parts) {
+			a = cv.Parts[i]
+		}
+		if i < len(other.Parts) {
+			b = other.Parts[i]
+		}
+		if a != b {
+			return sign(a - b)
+		}
+	}
+	return comparePrerelease(cv.Modifier, other.Modifier)
+}
+
+func (cv *CalVer) Equal(other *CalVer) bool {
+	return cv.Compare(other) == 0
+}
+
+func (cv *CalVer) LessThan(other *CalVer) bool {
+	return cv.Compare(other) < 0
+}
+
+func (cv *CalVer) GreaterThan(other *CalVer) bool {
+	return cv.Compare(other) > 0
+}
@@ -0,0 +1,61 @@
+package version_test
+
+import (
+	"testing"
+
+	"github.com/napalu/gosafedate/version"
+)
+
+func TestNewCalVer(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "2024.06.1", want: "2024.6.1"},
+		{in: "v2024.06", want: "2024.6"},
+		{in: "24.6.15", want: "24.6.15"},
+		{in: "2024.06.01-rc.1", want: "2024.6.1-rc.1"},
+		{in: "2024", wantErr: true},
+		{in: "2024.06.01.2.1", wantErr: true},
+		{in: "202406.1", wantErr: true},
+		{in: "2024.+6", wantErr: true},
+		{in: "2024.06-", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			v, err := version.NewCalVer(tt.in, "v")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("NewCalVer = %v, want error", v)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewCalVer: %v", err)
+			}
+			if got := v.String(); got != tt.want {
+				t.Fatalf("String = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalVer_Compare(t *testing.T) {
+	ordered := []string{"2023.12.31", "2024.1", "2024.06.1-beta", "2024.06.1-rc.1", "2024.06.1", "2024.06.2", "2024.10.1", "2025.01"}
+	for i := range ordered {
+		for j := range ordered {
+			a, _ := version.NewCalVer(ordered[i])
+			b, _ := version.NewCalVer(ordered[j])
+			if got, want := a.Compare(b), sign(i-j); got != want {
+				t.Errorf("Compare(%s, %s) = %d, want %d", ordered[i], ordered[j], got, want)
+			}
+		}
+	}
+
+	a, _ := version.NewCalVer("2024.06")
+	b, _ := version.NewCalVer("2024.6.0")
+	if !a.Equal(b) {
+		t.Fatal("missing components must compare as zero")
+	}
+}
@@ -0,0 +1,265 @@
+package version
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Constraint is a set of version requirements such as ">=1.2.0, <2.0.0".
+// Terms separated by commas or spaces must all hold, and "||" separates
+// alternatives. A term is a version with an optional operator:
+//
+//	=, !=, >, >=, <, <=  comparisons, e.g. ">=1.2.0"
+//	~1.2.3               patch updates: >=1.2.3, <1.3.0
+//	^1.2.3               updates keeping the left-most non-zero component:
+//	                     >=1.2.3, <2.0.0; ^0.2.3 is >=0.2.3, <0.3.0
+//	1.2.0 - 1.4.0        an inclusive range
+//
+// Omitted components and "x", "X" or "*" are wildcards: "1.2.x" and "1.2"
+// are >=1.2.0, <1.3.0, and "*" matches any version. Versions compare by
+// precedence; upper bounds implied by wildcards, "~" and "^" exclude the
+// pre-releases of the excluded version, so ^1.2.0 doesn't match 2.0.0-rc.1.
+type Constraint struct {
+	s    string
+	alts [][]bounds
+}
+
+// bounds is the range of versions matching a term, inverted for "!=".
+type bounds struct {
+	lo, hi         *Semver // if nil: unbounded
+	loIncl, hiIncl bool
+	not            bool
+}
+
+// partial is a version of a constraint with n specified components.
+type partial struct {
+	v Semver
+	n int
+}
+
+// NewConstraint parses a constraint, see Constraint.
+func NewConstraint(s string) (*Constraint, error) {
+	c := &Constraint{s: s}
+	for alt := range strings.SplitSeq(s, "||") {
+		terms, err := parseTerms(alt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid constraint %q: %v", s, err)
+		}
+		c.alts = append(c.alts, terms)
+	}
+	return c, nil
+}
+
+// Check reports whether v satisfies c.
+func (c *Constraint) Check(v *Semver) bool {
+	for _, terms := range c.alts {
+		ok := true
+		for _, b := range terms {
+			ok = ok && b.contains(v)
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Constraint) String() string {
+	return c.s
+}
+
+func (b bounds) contains(v *Semver) bool {
+	in := true
+	if b.lo != nil {
+		c := v.Compare(b.lo)
+		in = c > 0 || c == 0 && b.loIncl
+	}
+	if in && b.hi != nil {
+		c := v.Compare(b.hi)
+		in = c < 0 || c == 0 && b.hiIncl
+	}
+	return in != b.not
+}
+
+func parseTerms(alt string) ([]bounds, error) {
+	// join operators separated from their version, e.g. ">= 1.2.0"
+	var tokens []string
+	for _, f := range strings.Fields(strings.ReplaceAll(alt, ",", " ")) {
+		if n := len(tokens); n > 0 && strings.Trim(tokens[n-1], "=!<>~^") == "" && tokens[n-1] != "" {
+			tokens[n-1] += f
+			continue
+		}
+		tokens = append(tokens, f)
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty constraint")
+	}
+
+	var terms []bounds
+	for i := 0; i < len(tokens); i++ {
+		if i+2 < len(tokens) && tokens[i+1] == "-" {
+			b, err := parseRange(tokens[i], tokens[i+2])
+			if err != nil {
+				return nil, err
+			}
+			terms = append(terms, b)
+			i += 2
+			continue
+		}
+		b, err := parseTerm(tokens[i])
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, b)
+	}
+	return terms, nil
+}
+
+func parseRange(from, to string) (bounds, error) {
+	lo, err := parsePartial(from)
+	if err != nil {
+		return bounds{}, err
+	}
+	hi, err := parsePartial(to)
+	if err != nil {
+		return bounds{}, err
+	}
+	b := bounds{lo: lo.floor(), loIncl: true}
+	if hi.n == 3 {
+		b.hi, b.hiIncl = &hi.v, true
+	} else {
+		b.hi = hi.next()
+	}
+	return b, nil
+}
+
+func parseTerm(term string) (bounds, error) {
+	op := term[:len(term)-len(strings.TrimLeft(term, "=!<>~^"))]
+	p, err := parsePartial(term[len(op):])
+	if err != nil {
+		return bounds{}, err
+	}
+
+	exact := p.n == 3
+	switch op {
+	case "", "=", "==":
+		if exact {
+			return bounds{lo: &p.v, hi: &p.v, loIncl: true, hiIncl: true}, nil
+		}
+		return bounds{lo: p.floor(), hi: p.next(), loIncl: true}, nil
+	case "!=":
+		if exact {
+			return bounds{lo: &p.v, hi: &p.v, loIncl: true, hiIncl: true, not: true}, nil
+		}
+		return bounds{lo: p.floor(), hi: p.next(), loIncl: true, not: true}, nil
+	case ">":
+		if exact {
+			return bounds{lo: &p.v}, nil
+		}
+		if p.n == 0 {
+			return bounds{}, fmt.Errorf("%q matches no version", term)
+		}
+		return bounds{lo: p.next(), loIncl: true}, nil
+	case ">=":
+		return bounds{lo: p.floor(), loIncl: true}, nil
+	case "<":
+		if exact {
+			return bounds{hi: &p.v}, nil
+		}
+		if p.n == 0 {
+			return bounds{}, fmt.Errorf("%q matches no version", term)
+		}
+		hi := *p.floor()
+		hi.Prerelease = "0"
+		return bounds{hi: &hi}, nil
+	case "<=":
+		if exact {
+			return bounds{hi: &p.v, hiIncl: true}, nil
+		}
+		return bounds{hi: p.next()}, nil
+	case "~":
+		lo := p.floor()
+		if p.n > 2 {
+			p.n = 2
+		}
+		return bounds{lo: lo, hi: p.next(), loIncl: true}, nil
+	case "^":
+		lo := p.floor()
+		switch {
+		case p.v.Major > 0 || p.n == 1:
+			p.n = 1
+		case p.v.Minor > 0 || p.n == 2:
+			p.n = 2
+		}
+		return bounds{lo: lo, hi: p.next(), loIncl: true}, nil
+	}
+	return bounds{}, fmt.Errorf("unknown operator %q", op)
+}
+
+// parsePartial parses a version whose trailing components may be omitted
+// or wildcards.
+func parsePartial(s string) (partial, error) {
+	s = strings.TrimPrefix(s, "v")
+	core, build, hasBuild := strings.Cut(s, "+")
+	core, pre, hasPre := strings.Cut(core, "-")
+	if hasBuild && !validIdentifiers(build, false) || hasPre && !validIdentifiers(pre, true) {
+		return partial{}, fmt.Errorf("invalid version %q", s)
+	}
+
+	parts := strings.Split(core, ".")
+	if len(parts) > 3 {
+		return partial{}, fmt.Errorf("invalid version %q", s)
+	}
+	var (
+		p    = partial{v: Semver{Prerelease: pre, Build: build}}
+		nums = [3]*int{&p.v.Major, &p.v.Minor, &p.v.Patch}
+	)
+	for i, part := range parts {
+		if part == "x" || part == "X" || part == "*" {
+			continue
+		}
+		if p.n != i {
+			return partial{}, fmt.Errorf("invalid version %q: wildcard before %q", s, part)
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return partial{}, fmt.Errorf("invalid version %q", s)
+		}
+		*nums[i] = n
+		p.n++
+	}
+	if p.n < 3 && hasPre {
+		return partial{}, fmt.Errorf("invalid version %q: pre-release of a wildcard", s)
+	}
+	return p, nil
+}
+
+// floor returns the lowest release matching p, or nil if p matches all
+// versions.
+func (p partial) floor() *Semver {
+	if p.n == 3 {
+		return &p.v
+	}
+	if p.n == 0 {
+		return nil
+	}
+	return &Semver{Major: p.v.Major, Minor: p.v.Minor}
+}
+
+// next returns the lowest version after those matching p, or nil if p
+// matches all versions.
+func (p partial) next() *Semver {
+	v := Semver{Major: p.v.Major, Minor: p.v.Minor, Patch: p.v.Patch, Prerelease: "0"}
+	switch p.n {
+	case 0:
+		return nil
+	case 1:
+		v.Major, v.Minor, v.Patch = v.Major+1, 0, 0
+	case 2:
+		v.Minor, v.Patch = v.Minor+1, 0
+	default:
+		v.Patch++
+	}
+	return &v
+}
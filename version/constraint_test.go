@@ -0,0 +1,63 @@
+package version_test
+
+import (
+	"testing"
+
+	"github.com/napalu/gosafedate/version"
+)
+
+func TestConstraint_Check(t *testing.T) {
+	tests := []struct {
+		constraint string
+		match      []string
+		noMatch    []string
+	}{
+		{">=1.2.0, <2.0.0", []string{"1.2.0", "1.9.9"}, []string{"1.1.9", "2.0.0", "1.2.0-rc.1"}},
+		{">= 1.2.0 < 2.0.0", []string{"1.2.0"}, []string{"2.0.0"}},
+		{"1.2.x", []string{"1.2.0", "1.2.99"}, []string{"1.3.0", "1.1.0", "1.3.0-rc.1"}},
+		{"1.2", []string{"1.2.5"}, []string{"1.3.0"}},
+		{"*", []string{"0.0.1", "3.0.0-rc.1"}, nil},
+		{"=1.2.3", []string{"1.2.3", "1.2.3+build5"}, []string{"1.2.4"}},
+		{"!=1.2.3", []string{"1.2.4"}, []string{"1.2.3"}},
+		{"!=1.x", []string{"2.0.0"}, []string{"1.5.0"}},
+		{">1.2", []string{"1.3.0"}, []string{"1.2.9"}},
+		{"<=1.2", []string{"1.2.9"}, []string{"1.3.0"}},
+		{"<1.2", []string{"1.1.9"}, []string{"1.2.0", "1.2.0-rc.1"}},
+		{"~1.2.3", []string{"1.2.3", "1.2.9"}, []string{"1.2.2", "1.3.0"}},
+		{"~1", []string{"1.9.0"}, []string{"2.0.0"}},
+		{"^1.2.3", []string{"1.2.3", "1.9.0"}, []string{"1.2.2", "2.0.0", "2.0.0-rc.1"}},
+		{"^0.2.3", []string{"0.2.9"}, []string{"0.3.0"}},
+		{"^0.0.3", []string{"0.0.3"}, []string{"0.0.4"}},
+		{"^1.2.0-beta.2", []string{"1.2.0-beta.3", "1.2.0"}, []string{"1.2.0-beta.1"}},
+		{"1.2.0 - 1.4", []string{"1.2.0", "1.4.9"}, []string{"1.5.0"}},
+		{"1.2.0 - 1.4.0", []string{"1.4.0"}, []string{"1.4.1"}},
+		{"^1.0.0 || ^3.0.0", []string{"1.5.0", "3.1.0"}, []string{"2.0.0"}},
+		{"v1.x", []string{"1.0.0"}, []string{"2.0.0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.constraint, func(t *testing.T) {
+			c, err := version.NewConstraint(tt.constraint)
+			if err != nil {
+				t.Fatalf("NewConstraint: %v", err)
+			}
+			for _, s := range tt.match {
+				if v, _ := version.NewSemVer(s); !c.Check(v) {
+					t.Errorf("Check(%s) = false, want true", s)
+				}
+			}
+			for _, s := range tt.noMatch {
+				if v, _ := version.NewSemVer(s); c.Check(v) {
+					t.Errorf("Check(%s) = true, want false", s)
+				}
+			}
+		})
+	}
+}
+
+func TestNewConstraint_Invalid(t *testing.T) {
+	for _, s := range []string{"", "1.2.3 ||", ">>1.2.3", "1.x.3", "1.2.3.4", "1.2-rc.1", ">*", "=>1.0.0", "abc"} {
+		if _, err := version.NewConstraint(s); err == nil {
+			t.Errorf("NewConstraint(%q) succeeded, want error", s)
+		}
+	}
+}
@@ -2,69 +2,214 @@ package version
 
 import (
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 )
 
+// Semver is a semantic version (https://semver.org): MAJOR.MINOR.PATCH with
+// an optional pre-release, e.g. "rc.1", and build metadata, e.g. "build5".
 type Semver struct {
-	Major int
-	Minor int
-	Patch int
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease string // dot-separated identifiers after "-"; if empty: a release
+	Build      string // dot-separated identifiers after "+", ignored for precedence
+	Original   string // the parsed string, including any prefix
 }
 
+// NewSemVer parses a strict semantic version after removing the first of
+// prefixes it starts with, e.g. "v".
 func NewSemVer(verToParse string, prefixes ...string) (*Semver, error) {
+	return parse(verToParse, false, prefixes)
+}
+
+// NewTolerant is NewSemVer accepting versions with fewer or more than three
+// components, as emitted by many tools: missing ones are zero, e.g. "v1"
+// and "1.2" are 1.0.0 and 1.2.0, and those beyond the patch version are
+// dropped, e.g. "1.2.3.4" is 1.2.3. Original keeps the string as given.
+func NewTolerant(verToParse string, prefixes ...string) (*Semver, error) {
+	return parse(verToParse, true, prefixes)
+}
+
+func parse(original string, tolerant bool, prefixes []string) (*Semver, error) {
+	verToParse := original
 	for _, p := range prefixes {
-		verToParse = strings.TrimPrefix(verToParse, p)
+		if s, ok := strings.CutPrefix(verToParse, p); ok {
+			verToParse = s
+			break
+		}
 	}
 
-	parts := strings.Split(verToParse, ".")
-	if len(parts) != 3 {
-		return nil, fmt.Errorf("invalid version: %s", verToParse)
+	core, build, hasBuild := strings.Cut(verToParse, "+")
+	core, pre, hasPre := strings.Cut(core, "-")
+	if hasBuild && !validIdentifiers(build, false) {
+		return nil, fmt.Errorf("invalid version %q: invalid build metadata %q", original, build)
 	}
-	major, err := strconv.Atoi(parts[0])
-	if err != nil {
-		return nil, fmt.Errorf("invalid major version: %s", verToParse)
+	if hasPre && !validIdentifiers(pre, true) {
+		return nil, fmt.Errorf("invalid version %q: invalid pre-release %q", original, pre)
 	}
-	minor, err := strconv.Atoi(parts[1])
-	if err != nil {
-		return nil, fmt.Errorf("invalid minor version: %s", verToParse)
+
+	parts := strings.Split(core, ".")
+	if tolerant {
+		for len(parts) < 3 {
+			parts = append(parts, "0")
+		}
+		parts = parts[:3]
 	}
-	patch, err := strconv.Atoi(parts[2])
-	if err != nil {
-		return nil, fmt.Errorf("invalid patch version: %s", verToParse)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid version %q: expected MAJOR.MINOR.PATCH, e.g. 1.2.3", original)
+	}
+
+	var nums [3]int
+	for i, name := range []string{"major", "minor", "patch"} {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid version %q: %s version %q is not a number", original, name, parts[i])
+		}
+		nums[i] = n
 	}
 
 	return &Semver{
-		Major: major,
-		Minor: minor,
-		Patch: patch,
+		Major:      nums[0],
+		Minor:      nums[1],
+		Patch:      nums[2],
+		Prerelease: pre,
+		Build:      build,
+		Original:   original,
 	}, nil
 }
 
+// validIdentifiers reports whether s is a dot-separated list of non-empty
+// alphanumeric identifiers; numeric pre-release identifiers must not have
+// leading zeros.
+func validIdentifiers(s string, prerelease bool) bool {
+	for id := range strings.SplitSeq(s, ".") {
+		if id == "" {
+			return false
+		}
+		for _, c := range id {
+			if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '-') {
+				return false
+			}
+		}
+		if prerelease && len(id) > 1 && id[0] == '0' && isNumeric(id) {
+			return false
+		}
+	}
+	return true
+}
+
+func isNumeric(id string) bool {
+	for _, c := range id {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return id != ""
+}
+
 func (sv *Semver) String() string {
-	return fmt.Sprintf("%d.%d.%d", sv.Major, sv.Minor, sv.Patch)
+	s := fmt.Sprintf("%d.%d.%d", sv.Major, sv.Minor, sv.Patch)
+	if sv.Prerelease != "" {
+		s += "-" + sv.Prerelease
+	}
+	if sv.Build != "" {
+		s += "+" + sv.Build
+	}
+	return s
+}
+
+// IsPrerelease reports whether sv is a pre-release version.
+func (sv *Semver) IsPrerelease() bool {
+	return sv.Prerelease != ""
 }
 
+// Equal reports whether sv and version have the same precedence, that is
+// are equal ignoring build metadata.
 func (sv *Semver) Equal(version *Semver) bool {
-	return sv.String() == version.String()
+	return sv.Compare(version) == 0
 }
 
 func (sv *Semver) LessThan(other *Semver) bool {
-	if sv.Major != other.Major {
-		return sv.Major < other.Major
+	return sv.Compare(other) < 0
+}
+
+func (sv *Semver) GreaterThan(other *Semver) bool {
+	return sv.Compare(other) > 0
+}
+
+func (sv *Semver) LessThanOrEqual(other *Semver) bool {
+	return sv.Compare(other) <= 0
+}
+
+func (sv *Semver) GreaterThanOrEqual(other *Semver) bool {
+	return sv.Compare(other) >= 0
+}
+
+// Compare returns -1, 0 or +1 depending on whether sv precedes, has the
+// same precedence as or follows other: by major, minor and patch version,
+// then a pre-release before the release, then by pre-release identifiers.
+func (sv *Semver) Compare(other *Semver) int {
+	for _, d := range []int{sv.Major - other.Major, sv.Minor - other.Minor, sv.Patch - other.Patch} {
+		if d != 0 {
+			return sign(d)
+		}
 	}
-	if sv.Minor != other.Minor {
-		return sv.Minor < other.Minor
+	return comparePrerelease(sv.Prerelease, other.Prerelease)
+}
+
+// comparePrerelease orders the pre-releases a and b of the same version, ""
+// meaning the release itself, which follows its pre-releases.
+func comparePrerelease(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
 	}
-	return sv.Patch < other.Patch
+
+	ida, idb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(ida) && i < len(idb); i++ {
+		if c := compareIdentifiers(ida[i], idb[i]); c != 0 {
+			return c
+		}
+	}
+	return sign(len(ida) - len(idb))
 }
 
-func (sv *Semver) GreaterThan(other *Semver) bool {
-	if sv.Major != other.Major {
-		return sv.Major > other.Major
+// Sort sorts versions by ascending precedence, keeping the order of those
+// with the same precedence, e.g. differing only in build metadata.
+func Sort(versions []*Semver) {
+	slices.SortStableFunc(versions, (*Semver).Compare)
+}
+
+// compareIdentifiers compares pre-release identifiers: numeric ones
+// numerically and before alphanumeric ones, which compare lexically.
+func compareIdentifiers(a, b string) int {
+	na, nb := isNumeric(a), isNumeric(b)
+	switch {
+	case na && nb:
+		if len(a) != len(b) {
+			return sign(len(a) - len(b))
+		}
+		return strings.Compare(a, b)
+	case na:
+		return -1
+	case nb:
+		return 1
 	}
-	if sv.Minor != other.Minor {
-		return sv.Minor > other.Minor
+	return strings.Compare(a, b)
+}
+
+func sign(d int) int {
+	switch {
+	case d < 0:
+		return -1
+	case d > 0:
+		return 1
 	}
-	return sv.Patch > other.Patch
+	return 0
 }
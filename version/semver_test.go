@@ -0,0 +1,150 @@
+package version_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/napalu/gosafedate/version"
+)
+
+func TestNewSemVer(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    version.Semver
+		wantErr bool
+	}{
+		{in: "v1.2.3", want: version.Semver{Major: 1, Minor: 2, Patch: 3}},
+		{in: "1.2.3-rc.1+build5", want: version.Semver{Major: 1, Minor: 2, Patch: 3, Prerelease: "rc.1", Build: "build5"}},
+		{in: "1.2.3-alpha-2", want: version.Semver{Major: 1, Minor: 2, Patch: 3, Prerelease: "alpha-2"}},
+		{in: "1.2.3+20261016.sha-1f2e", want: version.Semver{Major: 1, Minor: 2, Patch: 3, Build: "20261016.sha-1f2e"}},
+		{in: "1.2.3-", wantErr: true},
+		{in: "1.2.3-rc..1", wantErr: true},
+		{in: "1.2.3-01", wantErr: true},
+		{in: "1.2.3+b_1", wantErr: true},
+		{in: "1.2", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			v, err := version.NewSemVer(tt.in, "v")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("NewSemVer = %+v, want error", v)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewSemVer: %v", err)
+			}
+			tt.want.Original = tt.in
+			if *v != tt.want {
+				t.Fatalf("NewSemVer = %+v, want %+v", *v, tt.want)
+			}
+			if got := v.String(); got != strings.TrimPrefix(tt.in, "v") {
+				t.Fatalf("String = %q, want %q", got, tt.in)
+			}
+		})
+	}
+}
+
+func TestNewTolerant(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "v1", want: "1.0.0"},
+		{in: "1.2", want: "1.2.0"},
+		{in: "1.2.3", want: "1.2.3"},
+		{in: "1.2.3.4", want: "1.2.3"},
+		{in: "v1.2-rc.1+build5", want: "1.2.0-rc.1+build5"},
+		{in: "", wantErr: true},
+		{in: "1..2", wantErr: true},
+		{in: "1.x", wantErr: true},
+		{in: "1.2-", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			v, err := version.NewTolerant(tt.in, "v")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("NewTolerant = %+v, want error", v)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewTolerant: %v", err)
+			}
+			if got := v.String(); got != tt.want {
+				t.Fatalf("String = %q, want %q", got, tt.want)
+			}
+			if v.Original != tt.in {
+				t.Fatalf("Original = %q, want %q", v.Original, tt.in)
+			}
+		})
+	}
+}
+
+func TestSemver_Precedence(t *testing.T) {
+	// in ascending order, from the SemVer specification
+	ordered := []string{
+		"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta",
+		"1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.0.1", "1.1.0", "2.0.0",
+	}
+	for i := range ordered {
+		for j := range ordered {
+			a, _ := version.NewSemVer(ordered[i])
+			b, _ := version.NewSemVer(ordered[j])
+			if got, want := a.LessThan(b), i < j; got != want {
+				t.Errorf("%s < %s = %v, want %v", a, b, got, want)
+			}
+			if got, want := a.GreaterThan(b), i > j; got != want {
+				t.Errorf("%s > %s = %v, want %v", a, b, got, want)
+			}
+			if got, want := a.Compare(b), sign(i-j); got != want {
+				t.Errorf("Compare(%s, %s) = %d, want %d", a, b, got, want)
+			}
+			if got, want := a.LessThanOrEqual(b), i <= j; got != want {
+				t.Errorf("%s <= %s = %v, want %v", a, b, got, want)
+			}
+			if got, want := a.GreaterThanOrEqual(b), i >= j; got != want {
+				t.Errorf("%s >= %s = %v, want %v", a, b, got, want)
+			}
+		}
+	}
+
+	a, _ := version.NewSemVer("1.0.0+build1")
+	b, _ := version.NewSemVer("1.0.0+build2")
+	if !a.Equal(b) {
+		t.Fatal("build metadata must not affect precedence")
+	}
+}
+
+func TestSort(t *testing.T) {
+	var versions []*version.Semver
+	for _, s := range []string{"1.10.0", "1.2.0", "1.2.0-rc.1", "0.9.0+b2", "0.9.0+b1", "2.0.0"} {
+		v, err := version.NewSemVer(s)
+		if err != nil {
+			t.Fatalf("NewSemVer(%q): %v", s, err)
+		}
+		versions = append(versions, v)
+	}
+
+	version.Sort(versions)
+	var got []string
+	for _, v := range versions {
+		got = append(got, v.String())
+	}
+	if want := "0.9.0+b2 0.9.0+b1 1.2.0-rc.1 1.2.0 1.10.0 2.0.0"; strings.Join(got, " ") != want {
+		t.Fatalf("Sort = %v, want %s", got, want)
+	}
+}
+
+func sign(d int) int {
+	switch {
+	case d < 0:
+		return -1
+	case d > 0:
+		return 1
+	}
+	return 0
+}